@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"time"
+)
+
+// Sink receives a record of every rule invocation, e.g. to keep a compliance trail
+// of who ran which command
+type Sink interface {
+	Write(record Record) error
+
+	Close() error
+}
+
+// Record describes a single rule invocation
+type Record struct {
+	Time        time.Time      `json:"time"`
+	Rule        string         `json:"rule"`
+	Status      string         `json:"status"`
+	Service     string         `json:"service"`
+	UserID      string         `json:"user_id,omitempty"`
+	UserName    string         `json:"user_name,omitempty"`
+	ChannelID   string         `json:"channel_id,omitempty"`
+	ChannelName string         `json:"channel_name,omitempty"`
+	Input       string         `json:"input,omitempty"`
+	Actions     []ActionResult `json:"actions,omitempty"`
+	Output      string         `json:"output,omitempty"`
+	DurationMS  int64          `json:"duration_ms"`
+	TraceID     string         `json:"trace_id,omitempty"`
+}
+
+// Record statuses
+const (
+	StatusCompleted = "completed"
+	StatusRejected  = "rejected"
+)
+
+// ActionResult describes the outcome of one action of a rule
+type ActionResult struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Error      string `json:"error,omitempty"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	Aborted    bool   `json:"aborted,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
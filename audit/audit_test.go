@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/storage/memory"
+)
+
+var testRecord = Record{
+	Time:     time.Unix(1546300800, 0),
+	Rule:     "deploy",
+	Status:   StatusCompleted,
+	Service:  "chat",
+	UserName: "jane",
+	Input:    "deploy api",
+	Actions:  []ActionResult{{Name: "call deploy service", Type: "POST", DurationMS: 12}},
+	Output:   "Deployed!",
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "audit.log")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(testRecord); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	sink.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var got Record
+		if err := json.Unmarshal(scanner.Bytes(), &got); err != nil {
+			t.Fatalf("line %d is not a record: %v", lines, err)
+		}
+		if got.Rule != testRecord.Rule || got.Actions[0].Name != testRecord.Actions[0].Name {
+			t.Errorf("line %d = %+v, want %+v", lines, got, testRecord)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("audit log has %d lines, want 2", lines)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	received := make(chan Record, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var got Record
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- got
+	}))
+	defer ts.Close()
+
+	if err := NewWebhookSink(ts.URL).Write(testRecord); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got := <-received; got.UserName != testRecord.UserName {
+		t.Errorf("webhook received %+v, want %+v", got, testRecord)
+	}
+
+	if err := NewWebhookSink(ts.URL + "/missing").Write(Record{}); err == nil {
+		t.Error("Write() expected an error for a rejected record")
+	}
+}
+
+func TestStoreSink(t *testing.T) {
+	store := memory.New()
+	sink := NewStoreSink(store)
+	if err := sink.Write(testRecord); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	records, err := store.List(Bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Errorf("store holds %d records, want 1", len(records))
+	}
+}
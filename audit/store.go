@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/target/flottbot/storage"
+)
+
+// Bucket is the storage bucket holding the records of a StoreSink
+const Bucket = "audit"
+
+// StoreSink keeps records in the bot's storage backend, e.g. a shared Postgres database
+type StoreSink struct {
+	store storage.Storage
+}
+
+// validate that StoreSink adheres to sink interface
+var _ Sink = (*StoreSink)(nil)
+
+// NewStoreSink creates a sink writing records to store
+func NewStoreSink(store storage.Storage) *StoreSink {
+	return &StoreSink{store: store}
+}
+
+// Write implementation to satisfy sink interface.
+// Records are keyed by time so they list in order, and by trace so replicas don't collide.
+func (s *StoreSink) Write(record Record) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%020d-%s-%s", record.Time.UnixNano(), record.Rule, record.TraceID)
+	return s.store.Set(Bucket, key, value, 0)
+}
+
+// Close implementation to satisfy sink interface.
+// The store is owned by the bot and closed with it.
+func (s *StoreSink) Close() error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookSink posts each record as JSON to a URL
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// validate that WebhookSink adheres to sink interface
+var _ Sink = (*WebhookSink)(nil)
+
+// NewWebhookSink creates a sink posting records to url
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Write implementation to satisfy sink interface
+func (s *WebhookSink) Write(record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Audit webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close implementation to satisfy sink interface
+func (s *WebhookSink) Close() error {
+	return nil
+}
@@ -0,0 +1,42 @@
+package awsauth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	sign := func(creds Credentials, body string) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost, "https://sqs.us-east-1.amazonaws.com/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+		req.Header.Set("X-Amz-Target", "AmazonSQS.SendMessage")
+		Sign(req, []byte(body), "sqs", "us-east-1", creds, now)
+		return req
+	}
+
+	req := sign(Credentials{AccessKey: "AKID", SecretKey: "secret"}, "{}")
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20190101/us-east-1/sqs/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-target, Signature=") {
+		t.Errorf("Sign() Authorization = %s", auth)
+	}
+	if req.Header.Get("X-Amz-Date") != "20190101T000000Z" || len(req.Header.Get("X-Amz-Security-Token")) > 0 {
+		t.Errorf("Sign() headers = %v", req.Header)
+	}
+	if auth != sign(Credentials{AccessKey: "AKID", SecretKey: "secret"}, "{}").Header.Get("Authorization") {
+		t.Error("Sign() should be deterministic")
+	}
+	if auth == sign(Credentials{AccessKey: "AKID", SecretKey: "other"}, "{}").Header.Get("Authorization") {
+		t.Error("Sign() should depend on the secret key")
+	}
+	if auth == sign(Credentials{AccessKey: "AKID", SecretKey: "secret"}, "{\"a\":1}").Header.Get("Authorization") {
+		t.Error("Sign() should depend on the body")
+	}
+
+	req = sign(Credentials{AccessKey: "AKID", SecretKey: "secret", SessionToken: "session"}, "{}")
+	if req.Header.Get("X-Amz-Security-Token") != "session" || !strings.Contains(req.Header.Get("Authorization"), "x-amz-date;x-amz-security-token;x-amz-target") {
+		t.Errorf("Sign() with session token headers = %v", req.Header)
+	}
+}
@@ -1,22 +1,33 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"sync"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/viper"
 
 	"github.com/target/flottbot/core"
 	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
 	"github.com/target/flottbot/version"
 )
 
+// env is the environment the bot runs in, e.g. 'production'; its overlay of bot.yml is merged in
+var env string
+
 func init() {
 	ver := flag.Bool("version", false, "print version information")
 	v := flag.Bool("v", false, "print version information")
+	flag.StringVar(&env, "env", os.Getenv("FLOTTBOT_ENV"), "environment whose bot.<env>.yml overlay is merged into bot.yml (default $FLOTTBOT_ENV)")
 
 	flag.Parse()
 	if *v || *ver {
@@ -25,58 +36,308 @@ func init() {
 	}
 }
 
-func newBot() *models.Bot {
+// readConfig reads the bot.yml in the given directories
+func readConfig(configPaths ...string) *viper.Viper {
 	bot := viper.New()
-	bot.AddConfigPath("./config")
-	bot.AddConfigPath(".")
+	for _, configPath := range configPaths {
+		bot.AddConfigPath(configPath)
+	}
 	bot.SetConfigName("bot")
 	err := bot.ReadInConfig()
 	if err != nil {
 		log.Fatalf("Fatal error config file: %s \n", err)
 	}
 
+	// Settings of the environment's overlay (e.g. bot.production.yml next to bot.yml)
+	// replace those of bot.yml; maps are merged, lists are replaced
+	if len(env) > 0 {
+		base := bot.ConfigFileUsed()
+		overlay := filepath.Join(filepath.Dir(base), "bot."+env+filepath.Ext(base))
+		bot.SetConfigFile(overlay)
+		if err := bot.MergeInConfig(); err != nil {
+			log.Fatalf("Fatal error config overlay for environment '%s': %s \n", env, err)
+		}
+	}
+	return bot
+}
+
+// newBot reads the bot in the given directories
+func newBot(configPaths ...string) *models.Bot {
+	return decodeBot(readConfig(configPaths...))
+}
+
+// decodeBot decodes a bot from its configuration
+func decodeBot(conf *viper.Viper) *models.Bot {
 	var botC models.Bot
-	err = bot.Unmarshal(&botC)
+	err := conf.Unmarshal(&botC)
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
 	return &botC
 }
 
+// validate checks the configuration and rules of the bot, and of the additional bots
+// listed in 'bots', and exits with a non-zero status if anything is wrong
+func validate() {
+	// Flags may follow the command, e.g. 'flottbot validate -env production'
+	flag.CommandLine.Parse(flag.Args()[1:])
+
+	conf := readConfig("./config", ".")
+	bot := decodeBot(conf)
+	problems := core.Validate(conf.AllSettings(), conf.ConfigFileUsed(), bot)
+	for _, dir := range bot.Bots {
+		otherConf := readConfig(path.Join("config", dir))
+		other := decodeBot(otherConf)
+		other.ConfigDir = path.Join("config", dir)
+		problems = append(problems, core.Validate(otherConf.AllSettings(), otherConf.ConfigFileUsed(), other)...)
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("Found %d problems\n", len(problems))
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
+
+// simulate feeds a message through the bot's rules, without connecting to the chat application,
+// and prints what the bot would send; it exits with a non-zero status if the rules fail to load
+// or don't finish in time
+func simulate() {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	var sim core.Simulation
+	flags.StringVar(&sim.Text, "text", "", "the message's text")
+	flags.StringVar(&sim.User, "user", os.Getenv("USER"), "the name of the user who sent the message")
+	flags.StringVar(&sim.Channel, "channel", "", "the channel the message was sent in, mentioning the bot (default a direct message)")
+	flags.StringVar(&sim.Remote, "remote", "cli", "the remote the message came from: 'slack', 'discord', or 'cli'")
+	fixturesFile := flags.String("fixtures", "", "file with the canned results of HTTP and exec actions")
+	timeout := flags.Duration("timeout", 30*time.Second, "how long to wait for the rules to finish")
+	flags.StringVar(&env, "env", env, "environment whose bot.<env>.yml overlay is merged into bot.yml")
+	flags.Parse(flag.Args()[1:])
+	if len(sim.Text) == 0 {
+		log.Fatalf("Missing -text, the message to simulate")
+	}
+
+	list := []models.Fixture{}
+	if len(*fixturesFile) > 0 {
+		var err error
+		if list, err = core.ReadFixtures(*fixturesFile); err != nil {
+			log.Fatalf(err.Error())
+		}
+	}
+
+	bot := offlineBot()
+	sent, err := core.Simulate(sim, list, *timeout, bot)
+	for _, message := range sent {
+		printSimulated(message)
+	}
+	if len(sent) == 0 {
+		fmt.Println("(no response)")
+	}
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+}
+
+// replay feeds the payloads recorded with 'record_traffic' back through the remotes and the bot's
+// rules, and prints what the bot would send for each of them
+func replay() {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	file := flags.String("file", "", "file with the recorded payloads (see 'record_file')")
+	fixturesFile := flags.String("fixtures", "", "file with the canned results of HTTP and exec actions")
+	timeout := flags.Duration("timeout", 30*time.Second, "how long to wait for the rules to finish, for each payload")
+	flags.StringVar(&env, "env", env, "environment whose bot.<env>.yml overlay is merged into bot.yml")
+	flags.Parse(flag.Args()[1:])
+	if len(*file) == 0 {
+		log.Fatalf("Missing -file, the recorded payloads to replay")
+	}
+
+	recordings, err := remote.ReadRecordings(*file)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	list := []models.Fixture{}
+	if len(*fixturesFile) > 0 {
+		if list, err = core.ReadFixtures(*fixturesFile); err != nil {
+			log.Fatalf(err.Error())
+		}
+	}
+
+	bot := offlineBot()
+	results, err := core.Replay(recordings, list, *timeout, bot)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	for _, result := range results {
+		fmt.Printf("=== %s %s %s\n", result.Recording.Time.Format(time.RFC3339), result.Recording.Remote, result.Recording.Kind)
+		if result.Input != nil {
+			fmt.Printf("%s: %s\n", result.Input.Vars["_user.name"], result.Input.Input)
+			for _, message := range result.Sent {
+				printSimulated(message)
+			}
+			if len(result.Sent) == 0 {
+				fmt.Println("(no response)")
+			}
+		} else if result.Err == nil {
+			fmt.Println("(no message for the bot)")
+		}
+		if result.Err != nil {
+			fmt.Printf("error: %s\n", result.Err.Error())
+		}
+	}
+}
+
+// migrateRules upgrades the rule files of the bot, and of the additional bots listed in 'bots',
+// that are written for older rule schema versions; with -check it only lists them, and exits with
+// a non-zero status if there are any
+func migrateRules() {
+	flags := flag.NewFlagSet("migrate-rules", flag.ExitOnError)
+	check := flags.Bool("check", false, "list the rule files to upgrade without changing them")
+	flags.StringVar(&env, "env", env, "environment whose bot.<env>.yml overlay is merged into bot.yml")
+	flags.Parse(flag.Args()[1:])
+
+	dirs := []string{path.Join("config", "rules")}
+	for _, dir := range decodeBot(readConfig("./config", ".")).Bots {
+		dirs = append(dirs, path.Join("config", dir, "rules"))
+	}
+
+	outdated, failed := 0, 0
+	for _, dir := range dirs {
+		migrations, err := core.MigrateRules(dir, *check)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		for _, migration := range migrations {
+			if migration.Err != nil {
+				failed++
+				fmt.Printf("%s: %s\n", migration.File, migration.Err.Error())
+				continue
+			}
+			outdated++
+			fmt.Printf("%s: schema version %d -> %d\n", migration.File, migration.From, core.RuleSchemaVersion)
+			for _, note := range migration.Notes {
+				fmt.Printf("  %s\n", note)
+			}
+		}
+	}
+
+	switch {
+	case failed > 0:
+		fmt.Printf("Could not upgrade %d rule files\n", failed)
+		os.Exit(1)
+	case outdated > 0 && *check:
+		fmt.Printf("%d rule files need upgrading\n", outdated)
+		os.Exit(1)
+	case outdated > 0:
+		fmt.Printf("Upgraded %d rule files\n", outdated)
+	default:
+		fmt.Printf("All rule files are at schema version %d\n", core.RuleSchemaVersion)
+	}
+}
+
+// schema prints the JSON Schema of rule files, e.g. for editors to check and complete them with
+func schema() {
+	out, err := json.MarshalIndent(core.RuleSchema(), "", "  ")
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	fmt.Println(string(out))
+}
+
+// offlineBot configures the bot for simulations and replays: it reads from no remote and
+// sends nothing, so it needs no chat application
+func offlineBot() *models.Bot {
+	bot := newBot("./config", ".")
+	bot.ChatApplication = ""
+	bot.CLI = true
+	bot.Scheduler = false
+	bot.RecordTraffic = false
+	core.Configure(bot)
+	return bot
+}
+
+// printSimulated prints a message the bot would send, and where it would send it
+func printSimulated(message models.Message) {
+	to := []string{}
+	switch {
+	case message.DirectMessageOnly || message.Type == models.MsgTypeDirect:
+		to = append(to, "@"+message.Vars["_user.name"])
+	case len(message.OutputToRooms) == 0 && len(message.OutputToUsers) == 0:
+		to = append(to, "#"+message.ChannelName)
+	}
+	for _, room := range message.OutputToRooms {
+		to = append(to, "#"+room)
+	}
+	for _, user := range message.OutputToUsers {
+		to = append(to, "@"+user)
+	}
+
+	fmt.Printf("--- to %s\n", strings.Join(to, ", "))
+	fmt.Println(message.Output)
+	for _, file := range message.Files {
+		fmt.Printf("[file: %s (%d bytes)]\n", file.Name, len(file.Data))
+	}
+	if n := len(message.Remotes.Slack.Attachments); n > 0 {
+		fmt.Printf("[%d Slack attachments]\n", n)
+	}
+}
+
 func main() {
-	var rules = make(map[string]models.Rule)
-	var hitRule = make(chan models.Rule, 1)
-	var inputMsgs = make(chan models.Message, 1)
-	var outputMsgs = make(chan models.Message, 1)
+	switch flag.Arg(0) {
+	case "validate":
+		validate()
+		return
+	case "simulate":
+		simulate()
+		return
+	case "replay":
+		replay()
+		return
+	case "migrate-rules":
+		migrateRules()
+		return
+	case "schema":
+		schema()
+		return
+	}
 
 	// Configure the bot to the core framework
-	bot := newBot()
+	bot := newBot("./config", ".")
 	core.Configure(bot)
 
-	// Populate the global rules map
-	core.Rules(&rules, bot)
+	// Configure the additional bots listed in 'bots', each in a directory with its
+	// own bot.yml, rules, and locales
+	others := []*models.Bot{}
+	for _, dir := range bot.Bots {
+		other := newBot(path.Join("config", dir))
+		other.ConfigDir = path.Join("config", dir)
+		// Only the main bot reads from the terminal
+		other.CLI = false
+		core.Configure(other)
+		others = append(others, other)
+	}
+
+	// Run the bots, each reading, processing, and sending out messages on its own
+	inputMsgs, outputMsgs, rules := core.Run(bot)
+	for _, other := range others {
+		core.Run(other)
+	}
 
 	// Initialize and run Prometheus metrics logging
 	go core.Prommetric("init", bot)
 
-	// Create the wait group for handling concurrent runs (see further down)
-	// Add 3 to the wait group so the three separate processes run concurrently
-	// - process 1: core.Remotes - reads messages
-	// - process 2: core.Matcher - processes messages
-	// - process 3: core.Outpus - sends out messages
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	go core.Remotes(inputMsgs, rules, bot)
-	go core.Matcher(inputMsgs, outputMsgs, rules, hitRule, bot)
-	go core.Outputs(outputMsgs, hitRule, bot)
-
-	defer wg.Done()
-
-	// This will run the bot indefinitely because the wait group will
-	// attempt to wait for the above never-ending go routines.
-	// Since said go routines run forever, they will never finish
-	// and so this program will wait, or essentially run, forever until
-	// terminated
-	wg.Wait()
+	// Serve the admin API for inspecting and managing the running bots
+	go core.AdminAPI(inputMsgs, outputMsgs, rules, bot)
+
+	// Serve the liveness and readiness probes, e.g. for Kubernetes
+	go core.Health(bot)
+
+	// The bots run until they are told to stop, e.g. by Kubernetes during
+	// a rollout; they then finish the messages they already read
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	core.Shutdown(bot)
 }
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mohae/deepcopy"
+
+	"github.com/target/flottbot/audit"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
+	"github.com/target/flottbot/utils"
+)
+
+// runActionGraph runs the actions of a rule with 'parallel_actions' concurrently, each as soon as
+// the actions it 'depends_on' are done. Actions see the variables set by the actions they depend on;
+// what they set themselves is merged into the message when they're done.
+func runActionGraph(message *models.Message, outputMsgs chan<- models.Message, rule *models.Rule, hitRule chan<- models.Rule, span *tracing.Span, bot *models.Bot) []audit.ActionResult {
+	results := make([]audit.ActionResult, len(rule.Actions))
+	if err := validateActionGraph(rule.Actions); err != nil {
+		bot.Log.Errorf("Could not run the actions of rule '%s': %s", rule.Name, err.Error())
+		return results
+	}
+
+	done := make(map[string]chan struct{}, len(rule.Actions))
+	for _, action := range rule.Actions {
+		done[action.Name] = make(chan struct{})
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	aborted := false
+	for i, action := range rule.Actions {
+		wg.Add(1)
+		go func(i int, action models.Action) {
+			defer wg.Done()
+			defer close(done[action.Name])
+			for _, dependency := range action.DependsOn {
+				<-done[dependency]
+			}
+
+			// Each action works on its own copy of the message
+			mu.Lock()
+			// Actions that haven't started when another action aborts the rule, or the run is
+			// cancelled, don't run
+			if aborted || runCancelled(*message) {
+				results[i] = audit.ActionResult{Name: action.Name, Type: action.Type, Skipped: true}
+				mu.Unlock()
+				return
+			}
+			actionMessage := deepcopy.Copy(*message).(models.Message)
+			filesBefore := len(actionMessage.Files)
+			mu.Unlock()
+			before := deepcopy.Copy(actionMessage.Vars).(map[string]string)
+
+			results[i] = runActionSafely(action, &actionMessage, outputMsgs, *rule, hitRule, span, bot)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for k, v := range actionMessage.Vars {
+				if old, ok := before[k]; !ok || old != v {
+					message.Vars[k] = v
+				}
+			}
+			if len(actionMessage.Error) > 0 {
+				message.Error = actionMessage.Error
+			}
+			message.Files = append(message.Files, actionMessage.Files[filesBefore:]...)
+			if results[i].Aborted {
+				aborted = true
+			}
+			// Handle reaction update
+			if !results[i].Skipped {
+				updateReaction(action, rule, message.Vars, bot)
+			}
+		}(i, action)
+	}
+	wg.Wait()
+	return results
+}
+
+// handleActionError makes the error of a failed action available as ${_error.message} and
+// ${_error.action}, and follows the action's 'on_error' instructions. It tells whether the
+// rule should abort, skipping its remaining actions.
+func handleActionError(action models.Action, err error, message *models.Message, outputMsgs chan<- models.Message, rule models.Rule, hitRule chan<- models.Rule, span *tracing.Span, bot *models.Bot) bool {
+	message.Vars["_error.message"] = utils.Redact(err.Error())
+	message.Vars["_error.action"] = action.Name
+
+	// Run the alternate actions, which can have 'on_error' instructions of their own
+	for _, alternate := range action.OnError.Actions {
+		if result := runAction(alternate, message, outputMsgs, rule, hitRule, span, bot); result.Aborted {
+			return true
+		}
+	}
+
+	if len(action.OnError.Message) > 0 {
+		fallback, err := utils.Substitute(action.OnError.Message, message.Vars)
+		if err != nil {
+			bot.Log.Errorf("Could not create the 'on_error' message of action '%s': %s", action.Name, err.Error())
+		} else {
+			message.Error = fallback
+		}
+	}
+
+	switch strings.ToLower(action.OnError.Then) {
+	case "", "continue":
+		return false
+	case "abort":
+		// Don't let the rule's output be made from what the remaining actions would have set
+		if len(message.Error) == 0 {
+			message.Error = translate(*message, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
+		}
+		bot.Log.Debugf("Aborting rule '%s' after action '%s' failed", rule.Name, action.Name)
+		return true
+	default:
+		bot.Log.Warnf("Unknown 'then: %s' in 'on_error' of action '%s', use 'continue' or 'abort'. Continuing", action.OnError.Then, action.Name)
+		return false
+	}
+}
+
+// validateActionGraph makes sure the actions of a rule with 'parallel_actions' have unique names,
+// and only depend on actions that exist, without depending on themselves in a cycle
+func validateActionGraph(actions []models.Action) error {
+	byName := make(map[string]models.Action, len(actions))
+	for _, action := range actions {
+		if _, ok := byName[action.Name]; ok {
+			return fmt.Errorf("Action names must be unique, '%s' is used more than once", action.Name)
+		}
+		byName[action.Name] = action
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(actions))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("Actions depend on each other in a cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dependency := range byName[name].DependsOn {
+			if _, ok := byName[dependency]; !ok {
+				return fmt.Errorf("Action '%s' depends on unknown action '%s'", name, dependency)
+			}
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, action := range actions {
+		if err := visit(action.Name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shouldRunAction evaluates an action's 'run_if' and 'skip_if' conditions, e.g. run_if: ${_exec_status | eq "0"},
+// and its 'when' expression, e.g. when: ${_exec_status} == 0 && ${env} != 'prod' (see utils.Expression)
+func shouldRunAction(action models.Action, vars map[string]string) (bool, error) {
+	if len(action.When) > 0 {
+		ok, err := utils.EvaluateExpression(action.When, vars)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if len(action.RunIf) > 0 {
+		ok, err := evaluateCondition(action.RunIf, vars)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if len(action.SkipIf) > 0 {
+		skip, err := evaluateCondition(action.SkipIf, vars)
+		if err != nil || skip {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// evaluateCondition substitutes the variables in a condition and tells whether the result is true.
+// Empty values, 'false', '0', and 'no' are false, anything else is true.
+func evaluateCondition(condition string, vars map[string]string) (bool, error) {
+	value, err := utils.Substitute(condition, vars)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "0", "no":
+		return false, nil
+	default:
+		return true, nil
+	}
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
+)
+
+func TestRunActionGraph(t *testing.T) {
+	bot := new(models.Bot)
+	msg := models.NewMessage()
+	msg.Vars["env"] = "prod"
+
+	rule := models.Rule{
+		Name:            "deploy",
+		ParallelActions: true,
+		Actions: []models.Action{
+			{Name: "build", Type: "exec", Cmd: `/bin/sh -c "sleep 0.5; echo built"`},
+			{Name: "test", Type: "exec", Cmd: `/bin/sh -c "sleep 0.5; echo tested"`},
+			{Name: "release", Type: "exec", Cmd: `echo released ${env}`, DependsOn: []string{"build", "test"}, RunIf: `${_exec_status | eq "0"}`},
+			{Name: "page", Type: "exec", Cmd: `echo paged`, DependsOn: []string{"release"}, SkipIf: `${env | eq "prod"}`},
+		},
+	}
+
+	start := time.Now()
+	results := runActionGraph(&msg, nil, &rule, nil, tracing.Start("", "rule"), bot)
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("runActionGraph() took %s, independent actions should run concurrently", elapsed)
+	}
+	if msg.Vars["_exec_output"] != "released prod" {
+		t.Errorf("runActionGraph() _exec_output = %q, want %q", msg.Vars["_exec_output"], "released prod")
+	}
+	for i, want := range []bool{false, false, false, true} {
+		if results[i].Name != rule.Actions[i].Name || results[i].Skipped != want || len(results[i].Error) > 0 {
+			t.Errorf("runActionGraph() result %d = %+v, want skipped %v", i, results[i], want)
+		}
+	}
+}
+
+func Test_validateActionGraph(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []models.Action
+		wantErr bool
+	}{
+		{"No dependencies", []models.Action{{Name: "a"}, {Name: "b"}}, false},
+		{"Dependencies", []models.Action{{Name: "a"}, {Name: "b", DependsOn: []string{"a"}}, {Name: "c", DependsOn: []string{"a", "b"}}}, false},
+		{"Unknown dependency", []models.Action{{Name: "a", DependsOn: []string{"z"}}}, true},
+		{"Duplicate names", []models.Action{{Name: "a"}, {Name: "a"}}, true},
+		{"Cycle", []models.Action{{Name: "a", DependsOn: []string{"c"}}, {Name: "b", DependsOn: []string{"a"}}, {Name: "c", DependsOn: []string{"b"}}}, true},
+		{"Depends on itself", []models.Action{{Name: "a", DependsOn: []string{"a"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateActionGraph(tt.actions); (err != nil) != tt.wantErr {
+				t.Errorf("validateActionGraph() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_shouldRunAction(t *testing.T) {
+	vars := map[string]string{"status": "0", "env": "prod", "flag": "no"}
+	tests := []struct {
+		name    string
+		action  models.Action
+		want    bool
+		wantErr bool
+	}{
+		{"No conditions", models.Action{}, true, false},
+		{"run_if true", models.Action{RunIf: `${status | eq "0"}`}, true, false},
+		{"run_if false", models.Action{RunIf: `${status | ne "0"}`}, false, false},
+		{"run_if plain variable", models.Action{RunIf: `${flag}`}, false, false},
+		{"skip_if true", models.Action{SkipIf: `${env | eq "prod"}`}, false, false},
+		{"skip_if false", models.Action{SkipIf: `${env | eq "dev"}`}, true, false},
+		{"Both", models.Action{RunIf: "${status | eq \"0\"}", SkipIf: "${env | eq \"dev\"}"}, true, false},
+		{"when true", models.Action{When: `${status} == 0 && ${env} != 'dev'`}, true, false},
+		{"when false", models.Action{When: `${env} startsWith 'de'`}, false, false},
+		{"Missing variable", models.Action{RunIf: `${missing}`}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := shouldRunAction(tt.action, vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("shouldRunAction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("shouldRunAction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleActionError(t *testing.T) {
+	bot := new(models.Bot)
+	span := tracing.Start("", "rule")
+
+	tests := []struct {
+		name        string
+		onError     models.OnError
+		wantAborted bool
+		wantError   string
+		wantOutput  string
+	}{
+		{"Continue by default", models.OnError{}, false, "", ""},
+		{"Fallback message", models.OnError{Message: "${_error.action} failed: ${_error.message}"}, false, "deploy failed: exit status 1", ""},
+		{"Alternate actions", models.OnError{Actions: []models.Action{{Name: "rollback", Type: "exec", Cmd: "echo rolled back"}}}, false, "", "rolled back"},
+		{"Abort", models.OnError{Then: "abort"}, true, "Error in request made by action 'deploy'. See bot admin for more information", ""},
+		{"Abort with message", models.OnError{Message: "Deploy failed, nothing was changed", Then: "abort"}, true, "Deploy failed, nothing was changed", ""},
+		{"Failing alternate action aborts", models.OnError{Actions: []models.Action{{Name: "rollback", Type: "exec", Cmd: "false", OnError: models.OnError{Then: "abort"}}}}, true, "Error in request made by action 'rollback'. See bot admin for more information", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := models.NewMessage()
+			action := models.Action{Name: "deploy", Type: "exec", Cmd: "false", OnError: tt.onError}
+			result := runAction(action, &msg, nil, models.Rule{Name: "deploy"}, nil, span, bot)
+			if result.Aborted != tt.wantAborted || len(result.Error) == 0 {
+				t.Errorf("runAction() = %+v, want aborted %v", result, tt.wantAborted)
+			}
+			if msg.Error != tt.wantError {
+				t.Errorf("runAction() error message = %q, want %q", msg.Error, tt.wantError)
+			}
+			if msg.Vars["_error.action"] != "deploy" && msg.Vars["_error.action"] != "rollback" {
+				t.Errorf("runAction() _error.action = %q", msg.Vars["_error.action"])
+			}
+			if len(tt.wantOutput) > 0 && msg.Vars["_exec_output"] != tt.wantOutput {
+				t.Errorf("runAction() _exec_output = %q, want %q", msg.Vars["_exec_output"], tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestDoRuleActionsAbort(t *testing.T) {
+	bot := new(models.Bot)
+	rule := models.Rule{
+		Name:         "deploy",
+		FormatOutput: "${_exec_output}",
+		Actions: []models.Action{
+			{Name: "check", Type: "exec", Cmd: "false", OnError: models.OnError{Message: "Checks failed, not deploying", Then: "abort"}},
+			{Name: "deploy", Type: "exec", Cmd: "echo deployed"},
+		},
+	}
+
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+	doRuleActions(models.NewMessage(), outputMsgs, rule, hitRule, bot)
+	if output := (<-outputMsgs).Output; output != "Checks failed, not deploying" {
+		t.Errorf("doRuleActions() output = %q", output)
+	}
+}
@@ -0,0 +1,289 @@
+package core
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/utils"
+)
+
+// maxRecentErrors is the number of error log entries kept for the admin API
+const maxRecentErrors = 50
+
+// recentError is an error logged by the bot
+type recentError struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// errorRecorder is a log hook remembering the most recent errors logged by the bot
+type errorRecorder struct {
+	mu     sync.Mutex
+	errors []recentError
+}
+
+// Levels implementation to satisfy logrus hook interface
+func (r *errorRecorder) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+}
+
+// Fire implementation to satisfy logrus hook interface
+func (r *errorRecorder) Fire(entry *logrus.Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, recentError{Time: entry.Time, Message: utils.Redact(entry.Message)})
+	if len(r.errors) > maxRecentErrors {
+		r.errors = r.errors[len(r.errors)-maxRecentErrors:]
+	}
+	return nil
+}
+
+// recent returns the recorded errors, newest first
+func (r *errorRecorder) recent() []recentError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]recentError, len(r.errors))
+	for i, e := range r.errors {
+		result[len(r.errors)-1-i] = e
+	}
+	return result
+}
+
+var recentErrors = &errorRecorder{}
+
+// ruleInfo is the admin API representation of a loaded rule
+type ruleInfo struct {
+	File     string `json:"file"`
+	Name     string `json:"name"`
+	Active   bool   `json:"active"`
+	Disabled bool   `json:"disabled,omitempty"` // by an admin, at runtime
+	Respond  string `json:"respond,omitempty"`
+	Hear     string `json:"hear,omitempty"`
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// queueInfo describes how full one of the bot's message channels is
+type queueInfo struct {
+	Depth    int `json:"depth"`
+	Capacity int `json:"capacity"`
+}
+
+// configureAdminAPI validates the admin API settings and starts recording errors for it
+func configureAdminAPI(bot *models.Bot) {
+	if !bot.AdminAPI {
+		return
+	}
+
+	token, err := utils.Substitute(bot.AdminAPIToken, map[string]string{})
+	if err != nil || len(token) == 0 {
+		bot.Log.Warn("The admin API needs 'admin_api_token' to be set. Disabling the admin API")
+		bot.AdminAPI = false
+		return
+	}
+	bot.AdminAPIToken = token
+
+	if len(bot.AdminAPIAddress) == 0 {
+		bot.AdminAPIAddress = ":8081"
+	}
+
+	bot.Log.AddHook(recentErrors)
+}
+
+// AdminAPI serves an authenticated HTTP API that lets operators inspect the running bot
+// and change its rules without restarting it
+func AdminAPI(inputMsgs, outputMsgs chan<- models.Message, rules map[string]models.Rule, bot *models.Bot) {
+	if !bot.AdminAPI {
+		return
+	}
+
+	router := adminRouter(inputMsgs, outputMsgs, rules, bot)
+	bot.Log.Infof("Admin API: serving at %s/admin", bot.AdminAPIAddress)
+	if err := remote.ListenAndServe(remote.ServerAdmin, bot.AdminAPIAddress, router, false, bot); err != nil {
+		bot.Log.Errorf("Admin API: %s", err.Error())
+	}
+}
+
+// adminRouter creates the routes of the admin API. The other bots running in the process
+// are managed at /admin/bots/<bot name>/..., e.g. /admin/bots/deploy-bot/rules.
+func adminRouter(inputMsgs, outputMsgs chan<- models.Message, rules map[string]models.Rule, bot *models.Bot) *mux.Router {
+	router := mux.NewRouter()
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(adminAuth(bot))
+
+	for _, other := range runningBots() {
+		if other.bot == bot {
+			continue
+		}
+		addAdminRoutes(admin.PathPrefix("/bots/"+other.bot.Name).Subrouter(), other.inputMsgs, other.outputMsgs, other.rules, other.bot)
+	}
+	addAdminRoutes(admin, inputMsgs, outputMsgs, rules, bot)
+
+	return router
+}
+
+// addAdminRoutes adds the admin API's routes for managing a bot
+func addAdminRoutes(admin *mux.Router, inputMsgs, outputMsgs chan<- models.Message, rules map[string]models.Rule, bot *models.Bot) {
+	admin.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		pipelineOf(bot).rulesMu.RLock()
+		loaded, active := len(rules), 0
+		for _, rule := range rules {
+			if rule.Active {
+				active++
+			}
+		}
+		pipelineOf(bot).rulesMu.RUnlock()
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"name":        bot.Name,
+			"instance_id": bot.InstanceID,
+			"remotes":     remote.Statuses(),
+			"queues": map[string]queueInfo{
+				"input":  {Depth: len(inputMsgs), Capacity: cap(inputMsgs)},
+				"output": {Depth: len(outputMsgs), Capacity: cap(outputMsgs)},
+			},
+			"rules":         map[string]int{"loaded": loaded, "active": active},
+			"recent_errors": recentErrors.recent(),
+		})
+	}).Methods("GET")
+
+	admin.HandleFunc("/errors", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, recentErrors.recent())
+	}).Methods("GET")
+
+	admin.HandleFunc("/rules", func(w http.ResponseWriter, r *http.Request) {
+		pipelineOf(bot).rulesMu.RLock()
+		infos := []ruleInfo{}
+		for ruleFile, rule := range rules {
+			infos = append(infos, newRuleInfo(ruleFile, rule))
+		}
+		pipelineOf(bot).rulesMu.RUnlock()
+		sort.Slice(infos, func(i, j int) bool {
+			return infos[i].Name < infos[j].Name
+		})
+		writeJSON(w, http.StatusOK, infos)
+	}).Methods("GET")
+
+	admin.HandleFunc("/rules/reload", func(w http.ResponseWriter, r *http.Request) {
+		count, err := ReloadRules(rules, bot)
+		if err != nil {
+			bot.Log.Errorf("Admin API: could not reload rules: %s", err.Error())
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"loaded": count})
+	}).Methods("POST")
+
+	admin.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if !bot.RuleStats || bot.Store == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "usage stats of rules aren't kept, set 'rule_stats' in bot.yml"})
+			return
+		}
+		days, err := parseStatsDays([]string{r.URL.Query().Get("days")})
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		pipelineOf(bot).rulesMu.RLock()
+		stats, err := usageStats(days, time.Now(), rules, bot)
+		pipelineOf(bot).rulesMu.RUnlock()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", "attachment; filename=rule-stats.csv")
+			csv.NewWriter(w).WriteAll(statsCSV(stats))
+			return
+		}
+		writeJSON(w, http.StatusOK, stats)
+	}).Methods("GET")
+
+	admin.HandleFunc("/rulesets", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ruleSetInfos(rules, bot))
+	}).Methods("GET")
+
+	admin.HandleFunc("/rulesets/{name}/load", func(w http.ResponseWriter, r *http.Request) {
+		problems, err := LoadRuleSet(mux.Vars(r)["name"], r.URL.Query().Get("dir"), rules, bot)
+		if err != nil {
+			bot.Log.Errorf("Admin API: could not load rule set: %s", err.Error())
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"rulesets": ruleSetInfos(rules, bot), "problems": problems})
+	}).Methods("POST")
+
+	admin.HandleFunc("/rulesets/{name}/activate", func(w http.ResponseWriter, r *http.Request) {
+		count, err := SwitchRuleSet(mux.Vars(r)["name"], rules, bot)
+		if err != nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"active": strings.ToLower(mux.Vars(r)["name"]), "loaded": count})
+	}).Methods("POST")
+
+	admin.HandleFunc("/rulesets/rollback", func(w http.ResponseWriter, r *http.Request) {
+		name, count, err := RollBackRuleSet(rules, bot)
+		if err != nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"active": name, "loaded": count})
+	}).Methods("POST")
+
+	admin.HandleFunc("/rules/{name}/{toggle:enable|disable}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		rule, err := setRuleActive(vars["name"], vars["toggle"] == "enable", disabledRule{By: "admin API", Reason: r.URL.Query().Get("reason")}, rules, bot)
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, newRuleInfo("", rule))
+	}).Methods("POST")
+}
+
+// adminAuth only lets through requests carrying the admin API token as a bearer token
+func adminAuth(bot *models.Bot) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(bot.AdminAPIToken)) != 1 {
+				bot.Log.Warnf("Admin API: rejected unauthorized request to %s", r.URL.Path)
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// newRuleInfo describes a rule for the admin API
+func newRuleInfo(ruleFile string, rule models.Rule) ruleInfo {
+	return ruleInfo{
+		File:     ruleFile,
+		Name:     rule.Name,
+		Active:   rule.Active,
+		Disabled: rule.Disabled,
+		Respond:  rule.Respond,
+		Hear:     rule.Hear,
+		Schedule: rule.Schedule,
+	}
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
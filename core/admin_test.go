@@ -0,0 +1,149 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestAdminAPI(t *testing.T) {
+	testBot := new(models.Bot)
+	testBot.AdminAPIToken = "secret"
+	inputMsgs := make(chan models.Message, 2)
+	outputMsgs := make(chan models.Message, 1)
+	inputMsgs <- models.NewMessage()
+	rules := map[string]models.Rule{
+		"rules/hello.yml": {Name: "hello", Respond: "hi", Active: true},
+		"rules/bye.yml":   {Name: "bye", Respond: "bye", Active: false},
+	}
+	router := adminRouter(inputMsgs, outputMsgs, rules, testBot)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"Missing token", "GET", "/admin/rules", "", http.StatusUnauthorized},
+		{"Wrong token", "GET", "/admin/rules", "nope", http.StatusUnauthorized},
+		{"List rules", "GET", "/admin/rules", "secret", http.StatusOK},
+		{"Status", "GET", "/admin/status", "secret", http.StatusOK},
+		{"Errors", "GET", "/admin/errors", "secret", http.StatusOK},
+		{"Disable rule", "POST", "/admin/rules/hello/disable", "secret", http.StatusOK},
+		{"Enable rule", "POST", "/admin/rules/bye/enable", "secret", http.StatusOK},
+		{"Unknown rule", "POST", "/admin/rules/nope/enable", "secret", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if len(tt.token) > 0 {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, rec.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	if rules["rules/hello.yml"].Active || !rules["rules/bye.yml"].Active {
+		t.Errorf("rules were not toggled: %+v", rules)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/status", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var status struct {
+		Queues map[string]queueInfo `json:"queues"`
+		Rules  map[string]int       `json:"rules"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Queues["input"].Depth != 1 || status.Queues["input"].Capacity != 2 {
+		t.Errorf("input queue = %+v, want depth 1 and capacity 2", status.Queues["input"])
+	}
+	if status.Rules["loaded"] != 2 || status.Rules["active"] != 1 {
+		t.Errorf("rules = %+v, want 2 loaded and 1 active", status.Rules)
+	}
+}
+
+func TestAdminAPIOtherBots(t *testing.T) {
+	mainBot := new(models.Bot)
+	mainBot.AdminAPIToken = "secret"
+	mainRules := map[string]models.Rule{"rules/hello.yml": {Name: "hello", Active: true}}
+
+	otherBot := new(models.Bot)
+	otherBot.Name = "deploy-bot"
+	otherBot.ConfigDir = "config/bots/deploy"
+	otherRules := map[string]models.Rule{"rules/deploy.yml": {Name: "deploy", Active: true}}
+
+	running.Lock()
+	saved := running.bots
+	running.bots = []runningBot{
+		{bot: mainBot, inputMsgs: make(chan models.Message, 1), outputMsgs: make(chan models.Message, 1), rules: mainRules},
+		{bot: otherBot, inputMsgs: make(chan models.Message, 1), outputMsgs: make(chan models.Message, 1), rules: otherRules},
+	}
+	running.Unlock()
+	defer func() {
+		running.Lock()
+		running.bots = saved
+		running.Unlock()
+	}()
+
+	router := adminRouter(make(chan models.Message, 1), make(chan models.Message, 1), mainRules, mainBot)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"Main bot's rule", "/admin/rules/hello/disable", http.StatusOK},
+		{"Other bot's rule on the main bot", "/admin/rules/deploy/disable", http.StatusNotFound},
+		{"Other bot's rule", "/admin/bots/deploy-bot/rules/deploy/disable", http.StatusOK},
+		{"Unknown bot", "/admin/bots/nope/rules/deploy/disable", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("POST %s = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	if mainRules["rules/hello.yml"].Active || otherRules["rules/deploy.yml"].Active {
+		t.Errorf("rules were not disabled: %+v, %+v", mainRules, otherRules)
+	}
+}
+
+func TestErrorRecorder(t *testing.T) {
+	testBot := new(models.Bot)
+	initLogger(testBot)
+	recorder := &errorRecorder{}
+	testBot.Log.AddHook(recorder)
+
+	for i := 0; i < maxRecentErrors+5; i++ {
+		testBot.Log.Error(errors.New("first"))
+	}
+	testBot.Log.Error(errors.New("last"))
+	testBot.Log.Info("not an error")
+
+	recent := recorder.recent()
+	if len(recent) != maxRecentErrors {
+		t.Fatalf("recent() returned %d errors, want %d", len(recent), maxRecentErrors)
+	}
+	if recent[0].Message != "last" {
+		t.Errorf("recent()[0] = %s, want the newest error", recent[0].Message)
+	}
+}
@@ -0,0 +1,211 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/target/flottbot/models"
+)
+
+// aliasBucket is the storage bucket holding the shorthands people defined for themselves, by user
+const aliasBucket = "aliases"
+
+// commandAlias is a shorthand for a command, and where it's defined
+type commandAlias struct {
+	command string // what the shorthand stands for
+	source  string // "" for the sender's own, "bot.yml", or the name of the rule
+}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "alias add", usage: `alias add "<shorthand>" "<command>"`, description: "Define a shorthand for a command, for yourself", args: 2, run: addAliasCommand},
+		builtinCommand{trigger: "alias remove", usage: `alias remove "<shorthand>"`, description: "Remove one of your shorthands", args: 1, run: removeAliasCommand},
+		builtinCommand{trigger: "aliases", usage: "aliases", description: "List the shorthands you can use", run: listAliasesCommand},
+	)
+}
+
+// expandAlias replaces the shorthand a message starts with by the command it stands for, e.g. 'd prod api'
+// by 'deploy production api-service', before it's matched. Only messages addressed to the bot are expanded,
+// only once, and the longest shorthand wins.
+func expandAlias(message *models.Message, rules map[string]models.Rule, bot *models.Bot) {
+	if message.Event != models.MsgEventSent || (message.Service != models.MsgServiceChat && message.Service != models.MsgServiceCLI) {
+		return
+	}
+	if message.Type != models.MsgTypeDirect && !message.BotMentioned {
+		return
+	}
+
+	input := strings.TrimSpace(message.Input)
+	aliases := commandAliases(*message, rules, bot)
+	longest := ""
+	for shorthand := range aliases {
+		if len(shorthand) > len(longest) && startsWithShorthand(input, shorthand) {
+			longest = shorthand
+		}
+	}
+	if len(longest) == 0 {
+		return
+	}
+	command := aliases[longest].command
+	message.Input = command + input[len(longest):]
+	bot.Log.Debugf("Expanded '%s' to '%s'", longest, command)
+}
+
+// startsWithShorthand determines whether the input starts with the shorthand, regardless of case, followed
+// by the end of the input or a space
+func startsWithShorthand(input, shorthand string) bool {
+	if len(input) < len(shorthand) || !strings.EqualFold(input[:len(shorthand)], shorthand) {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(input[len(shorthand):])
+	return len(input) == len(shorthand) || unicode.IsSpace(next)
+}
+
+// commandAliases are the shorthands the sender of the message can use, by lowercased shorthand: their
+// own go before those in bot.yml, which go before the rules' 'aliases'
+func commandAliases(message models.Message, rules map[string]models.Rule, bot *models.Bot) map[string]commandAlias {
+	aliases := make(map[string]commandAlias)
+	// Rules are matched highest priority first, so the first rule with a shorthand gets it
+	for _, rule := range sortRules(rules) {
+		if !rule.Active || len(rule.Respond) == 0 || isRegexTrigger(rule.Respond) {
+			continue
+		}
+		for _, shorthand := range rule.Aliases {
+			key := normalizeShorthand(shorthand)
+			if _, ok := aliases[key]; !ok && len(key) > 0 {
+				aliases[key] = commandAlias{command: rule.Respond, source: rule.Name}
+			}
+		}
+	}
+	for shorthand, command := range bot.CommandAliases {
+		if key := normalizeShorthand(shorthand); len(key) > 0 && len(command) > 0 {
+			aliases[key] = commandAlias{command: command, source: "bot.yml"}
+		}
+	}
+	own, err := getAliases(message, bot)
+	if err != nil {
+		bot.Log.Errorf("Could not look up the aliases of '%s': %s", message.Vars["_user.name"], err.Error())
+	}
+	for shorthand, command := range own {
+		aliases[shorthand] = commandAlias{command: command}
+	}
+	return aliases
+}
+
+// addAliasCommand defines a shorthand for the sender; the first argument is the shorthand, the second
+// the command it stands for
+func addAliasCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	shorthand, command := normalizeShorthand(args[0]), strings.TrimSpace(strings.Join(args[1:], " "))
+	// A shorthand starting like these commands would keep people from changing their shorthands
+	if first := strings.SplitN(shorthand, " ", 2)[0]; len(first) == 0 || first == "alias" || first == "aliases" {
+		return translate(*message, bot, "aliases.reserved", "You can't use '${shorthand}' as a shorthand.", map[string]string{"shorthand": shorthand}), nil
+	}
+	if len(command) == 0 {
+		return translate(*message, bot, "aliases.no_command", "What should '${shorthand}' be short for?", map[string]string{"shorthand": shorthand}), nil
+	}
+
+	aliases, err := getAliases(*message, bot)
+	if err != nil {
+		return "", fmt.Errorf("Could not look up your aliases: %s", err.Error())
+	}
+	aliases[shorthand] = command
+	if err := setAliases(*message, aliases, bot); err != nil {
+		return "", fmt.Errorf("Could not add the alias: %s", err.Error())
+	}
+	return translate(*message, bot, "aliases.added", "Okay, '${shorthand}' is now short for '${command}' for you.", map[string]string{"shorthand": shorthand, "command": command}), nil
+}
+
+// removeAliasCommand removes one of the sender's shorthands
+func removeAliasCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	shorthand := normalizeShorthand(strings.Join(args, " "))
+	aliases, err := getAliases(*message, bot)
+	if err != nil {
+		return "", fmt.Errorf("Could not look up your aliases: %s", err.Error())
+	}
+	if _, ok := aliases[shorthand]; !ok {
+		return translate(*message, bot, "aliases.unknown", "You have no shorthand '${shorthand}'.", map[string]string{"shorthand": shorthand}), nil
+	}
+	delete(aliases, shorthand)
+	if err := setAliases(*message, aliases, bot); err != nil {
+		return "", fmt.Errorf("Could not remove the alias: %s", err.Error())
+	}
+	return translate(*message, bot, "aliases.removed", "Okay, '${shorthand}' is no longer short for anything.", map[string]string{"shorthand": shorthand}), nil
+}
+
+// listAliasesCommand lists the shorthands the sender can use, and where they're defined
+func listAliasesCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	aliases := commandAliases(*message, rules, bot)
+	if len(aliases) == 0 {
+		return translate(*message, bot, "aliases.none", "There are no shorthands, define one with 'alias add'.", nil), nil
+	}
+	shorthands := make([]string, 0, len(aliases))
+	for shorthand := range aliases {
+		shorthands = append(shorthands, shorthand)
+	}
+	sort.Strings(shorthands)
+
+	output := translate(*message, bot, "aliases.list", "These are the shorthands you can use:", nil)
+	for _, shorthand := range shorthands {
+		alias := aliases[shorthand]
+		source := translate(*message, bot, "aliases.yours", "yours", nil)
+		switch {
+		case alias.source == "bot.yml":
+			source = "bot.yml"
+		case len(alias.source) > 0:
+			source = translate(*message, bot, "aliases.rule", "rule '${rule}'", map[string]string{"rule": alias.source})
+		}
+		output = output + fmt.Sprintf("\n • %s: %s (%s)", shorthand, alias.command, source)
+	}
+	return output, nil
+}
+
+// normalizeShorthand lowercases a shorthand and collapses its spaces, the way shorthands are kept
+func normalizeShorthand(shorthand string) string {
+	return strings.ToLower(strings.Join(strings.Fields(shorthand), " "))
+}
+
+// isRegexTrigger determines whether a 'respond' or 'hear' pattern is a regular expression
+func isRegexTrigger(pattern string) bool {
+	return strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+// aliasOwner is who the sender's shorthands are kept for: their user ID, or their name if they have none
+func aliasOwner(message models.Message) string {
+	if id := message.Vars["_user.id"]; len(id) > 0 {
+		return id
+	}
+	return message.Vars["_user.name"]
+}
+
+// getAliases looks up the shorthands the sender of the message defined
+func getAliases(message models.Message, bot *models.Bot) (map[string]string, error) {
+	aliases := make(map[string]string)
+	if bot.Store == nil || len(aliasOwner(message)) == 0 {
+		return aliases, nil
+	}
+	value, ok, err := bot.Store.Get(aliasBucket, aliasOwner(message))
+	if err != nil || !ok {
+		return aliases, err
+	}
+	err = json.Unmarshal(value, &aliases)
+	return aliases, err
+}
+
+// setAliases stores the shorthands the sender of the message defined
+func setAliases(message models.Message, aliases map[string]string, bot *models.Bot) error {
+	if len(aliasOwner(message)) == 0 {
+		return fmt.Errorf("Could not tell who you are")
+	}
+	if len(aliases) == 0 {
+		return bot.Store.Delete(aliasBucket, aliasOwner(message))
+	}
+	value, err := json.Marshal(aliases)
+	if err != nil {
+		return err
+	}
+	return bot.Store.Set(aliasBucket, aliasOwner(message), value, 0)
+}
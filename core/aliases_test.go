@@ -0,0 +1,85 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestExpandAlias(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), CommandAliases: map[string]string{"d prod api": "deploy production api-service", "st": "status"}}
+	initLogger(testBot)
+	rules := map[string]models.Rule{
+		"deploy.yml": {Name: "deploy", Active: true, Respond: "deploy", Aliases: []string{"d", "ship"}},
+		"status.yml": {Name: "status", Active: true, Respond: "status", Aliases: []string{"st"}},
+		"regex.yml":  {Name: "regex", Active: true, Respond: "/^roll (.*)/", Aliases: []string{"r"}},
+	}
+	jane := models.NewMessage()
+	jane.Vars["_user.id"] = "U1"
+	if _, err := addAliasCommand([]string{"ship", "deploy staging"}, &jane, nil, rules, nil, testBot); err != nil {
+		t.Fatalf("addAliasCommand() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		user    string
+		input   string
+		service models.MessageService
+		mention bool
+		want    string
+	}{
+		{"Rule alias", "U2", "d prod web", models.MsgServiceChat, true, "deploy prod web"},
+		{"Longest alias wins", "U2", "D prod api now", models.MsgServiceChat, true, "deploy production api-service now"},
+		{"Bot alias over rule alias", "U2", "st", models.MsgServiceChat, true, "status"},
+		{"Own alias over rule alias", "U1", "ship web", models.MsgServiceChat, true, "deploy staging web"},
+		{"Someone else's alias", "U2", "ship web", models.MsgServiceChat, true, "deploy web"},
+		{"Only whole words", "U2", "dance", models.MsgServiceChat, true, "dance"},
+		{"Not for regular expressions", "U2", "r 2d6", models.MsgServiceChat, true, "r 2d6"},
+		{"Bot not addressed", "U2", "d prod web", models.MsgServiceChat, false, "d prod web"},
+		{"CLI", "", "d prod web", models.MsgServiceCLI, true, "deploy prod web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.Service = tt.service
+			message.Event = models.MsgEventSent
+			message.BotMentioned = tt.mention
+			message.Vars["_user.id"] = tt.user
+			message.Input = tt.input
+			expandAlias(&message, rules, testBot)
+			if message.Input != tt.want {
+				t.Errorf("expandAlias() = %q, want %q", message.Input, tt.want)
+			}
+		})
+	}
+}
+
+func TestAliasCommands(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), CommandAliases: map[string]string{"st": "status"}}
+	initLogger(testBot)
+	rules := map[string]models.Rule{"deploy.yml": {Name: "deploy", Active: true, Respond: "deploy", Aliases: []string{"d"}}}
+	message := models.NewMessage()
+	message.Vars["_user.id"] = "U1"
+
+	tests := []struct {
+		name string
+		run  func(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error)
+		args []string
+		want string
+	}{
+		{"Add", addAliasCommand, []string{"d  prod", "deploy", "production"}, "Okay, 'd prod' is now short for 'deploy production' for you."},
+		{"Reserved", addAliasCommand, []string{"alias", "deploy"}, "You can't use 'alias' as a shorthand."},
+		{"List", listAliasesCommand, nil, "These are the shorthands you can use:\n • d: deploy (rule 'deploy')\n • d prod: deploy production (yours)\n • st: status (bot.yml)"},
+		{"Remove", removeAliasCommand, []string{"D", "prod"}, "Okay, 'd prod' is no longer short for anything."},
+		{"Remove unknown", removeAliasCommand, []string{"st"}, "You have no shorthand 'st'."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.run(tt.args, &message, nil, rules, nil, testBot)
+			if err != nil || got != tt.want {
+				t.Errorf("output = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/target/flottbot/handlers"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// prepareArtifacts creates a temporary directory for the files of a rule that saves or uploads them,
+// available to its actions as ${_artifact.dir}. The function it returns removes the directory.
+func prepareArtifacts(rule models.Rule, msg *models.Message, bot *models.Bot) func() {
+	if !usesArtifacts(rule) || len(msg.Vars["_artifact.dir"]) > 0 {
+		return func() {}
+	}
+	dir, err := ioutil.TempDir("", "flottbot-artifacts-")
+	if err != nil {
+		bot.Log.Errorf("Could not create a directory for the artifacts of rule '%s': %s", rule.Name, err.Error())
+		return func() {}
+	}
+	msg.Vars["_artifact.dir"] = dir
+	return func() {
+		if err := os.RemoveAll(dir); err != nil {
+			bot.Log.Errorf("Could not remove the artifacts of rule '%s': %s", rule.Name, err.Error())
+		}
+	}
+}
+
+// usesArtifacts tells whether a rule uploads files, or has actions that save them
+func usesArtifacts(rule models.Rule) bool {
+	if len(rule.UploadFiles) > 0 {
+		return true
+	}
+	var saves func(actions []models.Action) bool
+	saves = func(actions []models.Action) bool {
+		for _, action := range actions {
+			if len(action.Artifact) > 0 || saves(action.OnError.Actions) {
+				return true
+			}
+		}
+		return false
+	}
+	return saves(rule.Actions)
+}
+
+// uploadArtifacts attaches the files in a rule's 'upload_files' to its output, e.g. ${_artifact.path}.
+// Only files in the rule's artifact directory can be uploaded.
+func uploadArtifacts(rule models.Rule, msg *models.Message, bot *models.Bot) {
+	if len(rule.UploadFiles) == 0 || len(msg.Error) > 0 {
+		return
+	}
+	for _, upload := range rule.UploadFiles {
+		name, err := utils.Substitute(upload, msg.Vars)
+		if err == nil {
+			var file models.File
+			if file, err = handlers.ReadArtifact(name, msg); err == nil {
+				msg.Files = append(msg.Files, file)
+				continue
+			}
+		}
+		bot.Log.Errorf("Could not upload '%s' for rule '%s': %s", upload, rule.Name, err.Error())
+		msg.Output = strings.TrimSpace(fmt.Sprintf("%s\n(a file could not be uploaded: %s)", msg.Output, err.Error()))
+	}
+}
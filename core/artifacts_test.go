@@ -0,0 +1,78 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
+)
+
+func TestArtifactPipeline(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("b\na\nc\n"))
+	}))
+	defer ts.Close()
+
+	bot := new(models.Bot)
+	rule := models.Rule{
+		Name: "report",
+		Actions: []models.Action{
+			{Name: "fetch report", Type: http.MethodGet, URL: ts.URL, Artifact: "report.txt"},
+			{Name: "sort report", Type: "exec", Cmd: `/bin/sh -c "sort ${_artifact.path} > ${_artifact.dir}/sorted.txt"`},
+		},
+		UploadFiles: []string{"${_artifact.dir}/sorted.txt", "${_artifact.path}", "/etc/passwd"},
+	}
+	msg := models.NewMessage()
+	cleanup := prepareArtifacts(rule, &msg, bot)
+	dir := msg.Vars["_artifact.dir"]
+	if len(dir) == 0 {
+		t.Fatal("prepareArtifacts() did not create a directory")
+	}
+
+	span := tracing.Start("", "rule")
+	for _, action := range rule.Actions {
+		if result := runAction(action, &msg, nil, rule, nil, span, bot); len(result.Error) > 0 {
+			t.Fatalf("runAction(%s) error = %s", action.Name, result.Error)
+		}
+	}
+	if msg.Vars["_artifact.name"] != "report.txt" || msg.Vars["_artifact.size"] != "6" {
+		t.Errorf("artifact vars = %v", msg.Vars)
+	}
+
+	uploadArtifacts(rule, &msg, bot)
+	if len(msg.Files) != 2 || msg.Files[0].Name != "sorted.txt" || string(msg.Files[0].Data) != "a\nb\nc\n" || msg.Files[1].Name != "report.txt" {
+		t.Errorf("uploadArtifacts() files = %+v", msg.Files)
+	}
+	if !strings.Contains(msg.Output, "a file could not be uploaded") {
+		t.Errorf("uploadArtifacts() output = %q, want a note about /etc/passwd", msg.Output)
+	}
+
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("cleanup did not remove %s", dir)
+	}
+}
+
+func TestUsesArtifacts(t *testing.T) {
+	tests := []struct {
+		name string
+		rule models.Rule
+		want bool
+	}{
+		{"None", models.Rule{Actions: []models.Action{{Name: "a", Type: "GET"}}}, false},
+		{"Uploads", models.Rule{UploadFiles: []string{"${_artifact.path}"}}, true},
+		{"Saves", models.Rule{Actions: []models.Action{{Name: "a", Type: "GET", Artifact: "a.json"}}}, true},
+		{"Saves on error", models.Rule{Actions: []models.Action{{Name: "a", Type: "GET", OnError: models.OnError{Actions: []models.Action{{Name: "b", Type: "GET", Artifact: "b.json"}}}}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usesArtifacts(tt.rule); got != tt.want {
+				t.Errorf("usesArtifacts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/audit"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// configureAudit sets up the sink that receives a record of every rule invocation.
+// Currently, we support 3 sinks:
+//
+//	file: JSON lines appended to 'audit_target' (default: <state_dir>/audit.log)
+//	webhook: each record is POSTed as JSON to 'audit_target'
+//	storage: records are kept in the bot's storage backend
+func configureAudit(bot *models.Bot) {
+	if len(bot.Audit) == 0 {
+		return
+	}
+
+	target, err := utils.Substitute(bot.AuditTarget, map[string]string{})
+	if err != nil {
+		bot.Log.Fatalf("Could not set audit target: %s", err.Error())
+	}
+
+	sink, err := newAuditSink(strings.ToLower(bot.Audit), target, bot)
+	if err != nil {
+		bot.Log.Fatalf("Could not configure '%s' audit sink: %s", bot.Audit, err.Error())
+	}
+	bot.AuditSink = sink
+	bot.Log.Infof("Auditing rule invocations to '%s' sink", bot.Audit)
+}
+
+// newAuditSink creates the audit sink of the given type
+func newAuditSink(sinkType, target string, bot *models.Bot) (audit.Sink, error) {
+	switch sinkType {
+	case "file":
+		if len(target) == 0 {
+			target = filepath.Join(bot.StateDir, "audit.log")
+		}
+		return audit.NewFileSink(target)
+	case "webhook":
+		if len(target) == 0 {
+			return nil, fmt.Errorf("'audit_target' must be set to the webhook URL")
+		}
+		return audit.NewWebhookSink(target), nil
+	case "storage":
+		return audit.NewStoreSink(bot.Store), nil
+	default:
+		return nil, fmt.Errorf("Unknown audit sink '%s', use 'file', 'webhook', or 'storage'", sinkType)
+	}
+}
+
+// auditRule records a rule invocation, if auditing is enabled, and counts it in the usage stats
+func auditRule(status string, rule models.Rule, message models.Message, actions []audit.ActionResult, start time.Time, bot *models.Bot) {
+	// Usage stats are kept whether or not there's an audit trail
+	recordRuleStats(status, rule, message, actions, start, bot)
+	if bot.AuditSink == nil {
+		return
+	}
+
+	record := audit.Record{
+		Time:        start,
+		Rule:        rule.Name,
+		Status:      status,
+		Service:     serviceName(message.Service),
+		UserID:      message.Vars["_user.id"],
+		UserName:    message.Vars["_user.name"],
+		ChannelID:   message.ChannelID,
+		ChannelName: message.ChannelName,
+		Input:       message.Vars["_raw_user_input"],
+		Actions:     actions,
+		Output:      utils.Redact(message.Output),
+		DurationMS:  int64(time.Since(start) / time.Millisecond),
+		TraceID:     traceID(message.TraceParent),
+	}
+	if err := bot.AuditSink.Write(record); err != nil {
+		bot.Log.Errorf("Could not write audit record for rule '%s': %s", rule.Name, err.Error())
+	}
+}
+
+// serviceName describes where a message came from
+func serviceName(service models.MessageService) string {
+	switch service {
+	case models.MsgServiceChat:
+		return "chat"
+	case models.MsgServiceCLI:
+		return "cli"
+	case models.MsgServiceScheduler:
+		return "scheduler"
+	default:
+		return "unknown"
+	}
+}
+
+// traceID extracts the trace ID from a W3C 'traceparent' value
+func traceID(traceParent string) string {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) != 4 {
+		return ""
+	}
+	return parts[1]
+}
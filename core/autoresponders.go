@@ -0,0 +1,300 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// autoResponseBucket is the storage bucket holding the answers added from chat, by channel ID
+const autoResponseBucket = "auto-responses"
+
+// officeHoursFormat is how the start and end of office hours are written
+const officeHoursFormat = "15:04"
+
+// defaultOfficeDays are the days office hours are on when 'days' is not set
+var defaultOfficeDays = []string{"mon", "tue", "wed", "thu", "fri"}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "autoreply add", usage: `autoreply add "<keyword>[, <keyword>...]" "<answer>" ["<answer outside office hours>"]`, description: "Answer messages in this channel that mention a keyword", args: 2, module: moduleAutoResponders, run: addAutoResponseCommand},
+		builtinCommand{trigger: "autoreply remove", usage: "autoreply remove <number>", description: "Remove one of this channel's answers, numbered like in 'autoreply list'", args: 1, module: moduleAutoResponders, run: removeAutoResponseCommand},
+		builtinCommand{trigger: "autoreply list", usage: "autoreply list", description: "List this channel's answers", module: moduleAutoResponders, run: listAutoResponsesCommand},
+	)
+}
+
+// handleAutoResponse answers a message mentioning one of the keywords of its channel's answers, and
+// reports whether it did. Like 'hear' rules, the bot doesn't have to be addressed.
+func handleAutoResponse(outputMsgs chan<- models.Message, message models.Message, hitRule chan<- models.Rule, bot *models.Bot) bool {
+	if !moduleEnabled(moduleAutoResponders, bot) || message.Service != models.MsgServiceChat {
+		return false
+	}
+	channel, _ := channelResponder(message, bot)
+	answers, err := autoResponses(channel, message, bot)
+	if err != nil {
+		bot.Log.Errorf("Could not look up the answers of channel '%s': %s", message.ChannelName, err.Error())
+	}
+
+	staffed, err := inOfficeHours(officeHours(channel, bot), time.Now())
+	if err != nil {
+		bot.Log.Errorf("Could not determine the office hours of channel '%s': %s", message.ChannelName, err.Error())
+		staffed = true
+	}
+	for _, answer := range answers {
+		if !mentionsKeyword(message.Input, answer.Keywords) {
+			continue
+		}
+		text := answer.Answer
+		if !staffed && len(answer.AfterHours) > 0 {
+			text = answer.AfterHours
+		}
+		// Answers with only 'after_hours' are for when nobody's around
+		if len(text) == 0 {
+			continue
+		}
+		// Channel admins add answers from chat, so they mustn't reach the bot's environment or secrets
+		output := utils.SubstituteVars(text, message.Vars)
+		Prommetric(bot.Name+"-builtin-autoreply", bot)
+
+		message.Output = output
+		sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+		return true
+	}
+	return false
+}
+
+// addAutoResponseCommand adds an answer to the channel; the first argument holds its keywords, separated
+// by commas, the second the answer, and an optional third the answer outside office hours
+func addAutoResponseCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	if !canManageAutoResponses(*message, bot) {
+		return translate(*message, bot, "autoresponders.not_allowed", "Only this channel's admins can change its answers.", nil), nil
+	}
+	answer := models.AutoResponse{Answer: args[1]}
+	for _, keyword := range strings.Split(args[0], ",") {
+		if keyword = strings.TrimSpace(keyword); len(keyword) > 0 {
+			answer.Keywords = append(answer.Keywords, keyword)
+		}
+	}
+	if len(answer.Keywords) == 0 {
+		return translate(*message, bot, "autoresponders.no_keywords", "Which keywords should I answer to?", nil), nil
+	}
+	if len(args) > 2 {
+		answer.AfterHours = args[2]
+	}
+
+	answers, err := getAutoResponses(message.ChannelID, bot)
+	if err != nil {
+		return "", fmt.Errorf("Could not look up the answers of this channel: %s", err.Error())
+	}
+	if err := setAutoResponses(message.ChannelID, append(answers, answer), bot); err != nil {
+		return "", fmt.Errorf("Could not add the answer: %s", err.Error())
+	}
+	return translate(*message, bot, "autoresponders.added", "Okay, I'll answer messages in this channel about ${keywords}.", map[string]string{"keywords": strings.Join(answer.Keywords, ", ")}), nil
+}
+
+// removeAutoResponseCommand removes the answer numbered like in 'autoreply list' from the channel.
+// Answers from bot.yml can only be removed there.
+func removeAutoResponseCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	if !canManageAutoResponses(*message, bot) {
+		return translate(*message, bot, "autoresponders.not_allowed", "Only this channel's admins can change its answers.", nil), nil
+	}
+	channel, _ := channelResponder(*message, bot)
+	answers, err := getAutoResponses(message.ChannelID, bot)
+	if err != nil {
+		return "", fmt.Errorf("Could not look up the answers of this channel: %s", err.Error())
+	}
+
+	n, err := strconv.Atoi(args[0])
+	switch {
+	case err != nil || n < 1 || n > len(channel.Answers)+len(answers):
+		return translate(*message, bot, "autoresponders.unknown", "There's no answer ${number}, see 'autoreply list'.", map[string]string{"number": args[0]}), nil
+	case n <= len(channel.Answers):
+		return translate(*message, bot, "autoresponders.configured", "Answer ${number} is set in bot.yml, and can only be removed there.", map[string]string{"number": args[0]}), nil
+	}
+	i := n - len(channel.Answers) - 1
+	removed := answers[i]
+	if err := setAutoResponses(message.ChannelID, append(answers[:i], answers[i+1:]...), bot); err != nil {
+		return "", fmt.Errorf("Could not remove the answer: %s", err.Error())
+	}
+	return translate(*message, bot, "autoresponders.removed", "Okay, I'll stop answering messages about ${keywords}.", map[string]string{"keywords": strings.Join(removed.Keywords, ", ")}), nil
+}
+
+// listAutoResponsesCommand lists the answers of the channel, those from bot.yml first
+func listAutoResponsesCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	channel, _ := channelResponder(*message, bot)
+	answers, err := autoResponses(channel, *message, bot)
+	if err != nil {
+		return "", fmt.Errorf("Could not look up the answers of this channel: %s", err.Error())
+	}
+	if len(answers) == 0 {
+		return translate(*message, bot, "autoresponders.none", "This channel has no answers, add one with 'autoreply add'.", nil), nil
+	}
+
+	lines := []string{translate(*message, bot, "autoresponders.list", "These are this channel's answers:", nil)}
+	for i, answer := range answers {
+		line := fmt.Sprintf("%d. %s: %s", i+1, strings.Join(answer.Keywords, ", "), answer.Answer)
+		if len(answer.AfterHours) > 0 {
+			line += " " + translate(*message, bot, "autoresponders.after_hours", "(outside office hours: ${answer})", map[string]string{"answer": answer.AfterHours})
+		}
+		if i < len(channel.Answers) {
+			line += " " + translate(*message, bot, "autoresponders.from_config", "(bot.yml)", nil)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// channelResponder finds the auto-responder configured for the message's channel, by name or ID
+func channelResponder(message models.Message, bot *models.Bot) (models.ChannelResponder, bool) {
+	for _, channel := range bot.AutoResponders.Channels {
+		name := strings.TrimPrefix(channel.Channel, "#")
+		if len(name) > 0 && (name == message.ChannelID || strings.EqualFold(name, message.ChannelName)) {
+			return channel, true
+		}
+	}
+	return models.ChannelResponder{}, false
+}
+
+// canManageAutoResponses determines whether the sender of a message may change its channel's answers:
+// the bot's admins, and the admins of the channel's auto-responder
+func canManageAutoResponses(message models.Message, bot *models.Bot) bool {
+	if isAdmin(message, bot) {
+		return true
+	}
+	channel, _ := channelResponder(message, bot)
+	for _, admin := range channel.Admins {
+		if admin == message.Vars["_user.name"] || admin == message.Vars["_user.id"] {
+			return true
+		}
+	}
+	return false
+}
+
+// autoResponses are the answers of the message's channel: those from bot.yml, then those added from chat
+func autoResponses(channel models.ChannelResponder, message models.Message, bot *models.Bot) ([]models.AutoResponse, error) {
+	answers := append([]models.AutoResponse{}, channel.Answers...)
+	if len(message.ChannelID) == 0 {
+		return answers, nil
+	}
+	added, err := getAutoResponses(message.ChannelID, bot)
+	return append(answers, added...), err
+}
+
+// getAutoResponses looks up the answers added from chat to a channel
+func getAutoResponses(channelID string, bot *models.Bot) ([]models.AutoResponse, error) {
+	answers := []models.AutoResponse{}
+	value, ok, err := bot.Store.Get(autoResponseBucket, channelID)
+	if err != nil || !ok {
+		return answers, err
+	}
+	err = json.Unmarshal(value, &answers)
+	return answers, err
+}
+
+// setAutoResponses stores the answers added from chat to a channel
+func setAutoResponses(channelID string, answers []models.AutoResponse, bot *models.Bot) error {
+	if len(answers) == 0 {
+		return bot.Store.Delete(autoResponseBucket, channelID)
+	}
+	value, err := json.Marshal(answers)
+	if err != nil {
+		return err
+	}
+	return bot.Store.Set(autoResponseBucket, channelID, value, 0)
+}
+
+// mentionsKeyword determines whether the input mentions any of the keywords, as whole words and
+// regardless of case
+func mentionsKeyword(input string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if len(keyword) == 0 {
+			continue
+		}
+		pattern := `(?i)(?:^|\W)` + regexp.QuoteMeta(keyword) + `(?:$|\W)`
+		if matched, _ := regexp.MatchString(pattern, input); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// officeHours are the office hours of a channel, or those of all channels if it doesn't set its own
+func officeHours(channel models.ChannelResponder, bot *models.Bot) models.OfficeHours {
+	if len(channel.OfficeHours.Start) > 0 || len(channel.OfficeHours.End) > 0 {
+		return channel.OfficeHours
+	}
+	return bot.AutoResponders.OfficeHours
+}
+
+// inOfficeHours determines whether a time is within office hours. Office hours ending before they start
+// run past midnight, into the next day.
+func inOfficeHours(hours models.OfficeHours, now time.Time) (bool, error) {
+	if len(hours.Start) == 0 && len(hours.End) == 0 {
+		return true, nil
+	}
+	start, err := time.Parse(officeHoursFormat, hours.Start)
+	if err != nil {
+		return true, fmt.Errorf("Invalid start '%s', use a time like '09:00'", hours.Start)
+	}
+	end, err := time.Parse(officeHoursFormat, hours.End)
+	if err != nil {
+		return true, fmt.Errorf("Invalid end '%s', use a time like '17:00'", hours.End)
+	}
+	loc := time.Local
+	if len(hours.Timezone) > 0 {
+		if loc, err = time.LoadLocation(hours.Timezone); err != nil {
+			return true, fmt.Errorf("Unknown timezone '%s'", hours.Timezone)
+		}
+	}
+	days := hours.Days
+	if len(days) == 0 {
+		days = defaultOfficeDays
+	}
+	if err := checkOfficeDays(days); err != nil {
+		return true, err
+	}
+
+	now = now.In(loc)
+	// Office hours running past midnight started the day before
+	minute, from, to := now.Hour()*60+now.Minute(), start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	day := now.Weekday()
+	if to <= from && minute < to {
+		day = (day + 6) % 7
+	}
+	onDay := false
+	for _, d := range days {
+		if strings.HasPrefix(strings.ToLower(day.String()), strings.ToLower(d)) {
+			onDay = true
+		}
+	}
+	if !onDay {
+		return false, nil
+	}
+	if to <= from {
+		return minute >= from || minute < to, nil
+	}
+	return minute >= from && minute < to, nil
+}
+
+// checkOfficeDays checks that the days of office hours are days of the week, e.g. 'mon' or 'Monday'
+func checkOfficeDays(days []string) error {
+	for _, d := range days {
+		known := false
+		for wd := time.Sunday; wd <= time.Saturday; wd++ {
+			name := strings.ToLower(wd.String())
+			if len(d) >= 3 && strings.HasPrefix(name, strings.ToLower(d)) {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("Unknown day '%s', use e.g. 'mon' or 'monday'", d)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestAutoResponders(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Modules: []string{moduleAutoResponders}, Admins: []string{"boss"}}
+	testBot.AutoResponders.Channels = []models.ChannelResponder{{
+		Channel: "#help",
+		Admins:  []string{"U1"},
+		Answers: []models.AutoResponse{{Keywords: []string{"vpn"}, Answer: "See the VPN guide, ${_user.name}."}},
+	}}
+	initLogger(testBot)
+	os.Setenv("FLOTTBOT_TEST_SECRET", "s3cr3t")
+	defer os.Unsetenv("FLOTTBOT_TEST_SECRET")
+
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+	say := func(user, channel, input string, mention bool) string {
+		m := models.NewMessage()
+		m.Service = models.MsgServiceChat
+		m.Event = models.MsgEventSent
+		m.ChannelID, m.ChannelName = channel, channel
+		m.Vars["_user.id"], m.Vars["_user.name"] = user, user
+		m.Input = input
+		m.BotMentioned = mention
+		matcherLoop(m, outputMsgs, map[string]models.Rule{}, hitRule, testBot)
+		select {
+		case m := <-outputMsgs:
+			<-hitRule
+			return m.Output
+		default:
+			return ""
+		}
+	}
+
+	tests := []struct {
+		name    string
+		user    string
+		channel string
+		input   string
+		mention bool
+		want    string
+	}{
+		{"Configured answer", "U2", "help", "How do I set up the VPN?", false, "See the VPN guide, U2."},
+		{"Keyword in a word", "U2", "help", "vpnclient is broken", false, ""},
+		{"Other channel", "U2", "random", "vpn?", false, ""},
+		{"Not an admin", "U2", "help", `autoreply add "wifi" "Ask IT"`, true, "Only this channel's admins can change its answers."},
+		{"Channel admin", "U1", "help", `autoreply add "wifi, wireless" "Ask IT"`, true, "Okay, I'll answer messages in this channel about wifi, wireless."},
+		{"Added answer", "U2", "help", "Wireless is down", false, "Ask IT"},
+		{"List", "U2", "help", "autoreply list", true, "These are this channel's answers:\n1. vpn: See the VPN guide, ${_user.name}. (bot.yml)\n2. wifi, wireless: Ask IT"},
+		{"Remove configured", "U1", "help", "autoreply remove 1", true, "Answer 1 is set in bot.yml, and can only be removed there."},
+		{"Remove unknown", "U1", "help", "autoreply remove 3", true, "There's no answer 3, see 'autoreply list'."},
+		{"Bot admin", "boss", "help", "autoreply remove 2", true, "Okay, I'll stop answering messages about wifi, wireless."},
+		{"Removed answer", "U2", "help", "Wireless is down", false, ""},
+		{"Answer with an environment variable", "U1", "help", `autoreply add "token" "${FLOTTBOT_TEST_SECRET}"`, true, "Okay, I'll answer messages in this channel about token."},
+		{"No environment variables", "U2", "help", "Where's the token?", false, "${FLOTTBOT_TEST_SECRET}"},
+		{"Other channel without answers", "boss", "random", "autoreply list", true, "This channel has no answers, add one with 'autoreply add'."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := say(tt.user, tt.channel, tt.input, tt.mention); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInOfficeHours(t *testing.T) {
+	weekdays := models.OfficeHours{Start: "09:00", End: "17:00", Timezone: "America/Chicago"}
+	nights := models.OfficeHours{Days: []string{"Friday"}, Start: "22:00", End: "06:00", Timezone: "UTC"}
+
+	tests := []struct {
+		name    string
+		hours   models.OfficeHours
+		now     time.Time
+		want    bool
+		wantErr bool
+	}{
+		{"No office hours", models.OfficeHours{}, time.Date(2019, 5, 4, 3, 0, 0, 0, time.UTC), true, false},
+		{"Weekday in time zone", weekdays, time.Date(2019, 5, 1, 15, 0, 0, 0, time.UTC), true, false},
+		{"Before start in time zone", weekdays, time.Date(2019, 5, 1, 13, 59, 0, 0, time.UTC), false, false},
+		{"At end", weekdays, time.Date(2019, 5, 1, 22, 0, 0, 0, time.UTC), false, false},
+		{"Weekend", weekdays, time.Date(2019, 5, 4, 15, 0, 0, 0, time.UTC), false, false},
+		{"Overnight, evening", nights, time.Date(2019, 5, 3, 23, 0, 0, 0, time.UTC), true, false},
+		{"Overnight, next morning", nights, time.Date(2019, 5, 4, 5, 0, 0, 0, time.UTC), true, false},
+		{"Overnight, morning before", nights, time.Date(2019, 5, 3, 5, 0, 0, 0, time.UTC), false, false},
+		{"Invalid start", models.OfficeHours{Start: "9am", End: "17:00"}, time.Now(), true, true},
+		{"Unknown time zone", models.OfficeHours{Start: "09:00", End: "17:00", Timezone: "Mars/Olympus"}, time.Now(), true, true},
+		{"Unknown day", models.OfficeHours{Days: []string{"mo"}, Start: "09:00", End: "17:00"}, time.Now(), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inOfficeHours(tt.hours, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("inOfficeHours() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("inOfficeHours() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"sync"
+
+	"github.com/target/flottbot/models"
+)
+
+// runningBot is a bot running in this process, with its own pipeline of messages and rules
+type runningBot struct {
+	bot        *models.Bot
+	inputMsgs  chan models.Message
+	outputMsgs chan models.Message
+	hitRule    chan models.Rule
+	rules      map[string]models.Rule
+}
+
+// running are the bots running in this process, the main bot first
+var running = struct {
+	sync.Mutex
+	bots []runningBot
+}{}
+
+// Run starts a bot: its remotes read messages into its input queue, its matcher processes them
+// with its rules, and the responses are sent out through its outputs. Several bots can run in
+// one process (see 'bots' in bot.yml), each with a pipeline of its own. The bot's queues and
+// rules are returned, e.g. for the admin API.
+func Run(bot *models.Bot) (chan models.Message, chan models.Message, map[string]models.Rule) {
+	var rules = make(map[string]models.Rule)
+	var hitRule = make(chan models.Rule, 1)
+	// Remotes hand messages to the intake, from where they wait in the (bounded) input queue
+	var intake = make(chan models.Message)
+	var inputMsgs = NewInputQueue(bot)
+	var outputMsgs = make(chan models.Message, 1)
+
+	// Populate the bot's rules map
+	Rules(&rules, bot)
+
+	// Run the three separate processes concurrently
+	// - process 1: Remotes - reads messages
+	// - process 2: Matcher - processes messages
+	// - process 3: Outputs - sends out messages
+	go Remotes(intake, rules, bot)
+	go Enqueue(intake, inputMsgs, outputMsgs, hitRule, bot)
+	go SharedQueue(inputMsgs, outputMsgs, hitRule, bot)
+	go Matcher(inputMsgs, outputMsgs, rules, hitRule, bot)
+	go Outputs(outputMsgs, hitRule, bot)
+
+	// Deliver reminders, close polls, and run standups of the built-in modules that are enabled
+	go Reminders(outputMsgs, hitRule, bot)
+	go Polls(outputMsgs, hitRule, bot)
+	go Standups(outputMsgs, hitRule, bot)
+
+	// Post the digests in bot.yml on their schedule
+	go Digests(outputMsgs, hitRule, bot)
+
+	// Post the feedback on answers, with 'feedback_report' in bot.yml
+	go FeedbackReports(outputMsgs, hitRule, bot)
+
+	// Announce when rules muted with 'mute' may post again
+	go Mutes(outputMsgs, hitRule, bot)
+
+	// Show the bot is alive and watch for silence, with 'heartbeat' in bot.yml
+	go Heartbeat(outputMsgs, hitRule, bot)
+
+	running.Lock()
+	running.bots = append(running.bots, runningBot{bot: bot, inputMsgs: inputMsgs, outputMsgs: outputMsgs, hitRule: hitRule, rules: rules})
+	running.Unlock()
+
+	return inputMsgs, outputMsgs, rules
+}
+
+// runningBots returns the bots running in this process
+func runningBots() []runningBot {
+	running.Lock()
+	defer running.Unlock()
+	return append([]runningBot{}, running.bots...)
+}
+
+// configDir is the directory of a bot's rules and locales
+func configDir(bot *models.Bot) string {
+	if len(bot.ConfigDir) > 0 {
+		return bot.ConfigDir
+	}
+	return "config"
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/render"
+	"github.com/target/flottbot/utils"
+)
+
+// bridgeEcho is how long a relayed message is remembered, so it isn't relayed back when the bot on
+// the other side sees it
+const bridgeEcho = time.Minute
+
+// defaultBridgeFormat is how relayed messages are written, unless the bridge sets 'format'
+const defaultBridgeFormat = "**${user}** (${remote} #${channel}): ${text}"
+
+// relayed are the messages bridges relayed lately, by channel and text
+var (
+	relayedMu sync.Mutex
+	relayed   = make(map[string]time.Time)
+)
+
+// relayBridged relays a message sent in a bridged channel to the channels at the other side of its
+// bridges, saying who sent it where. Messages that were relayed into the channel themselves aren't
+// relayed again, so two-way bridges don't loop.
+func relayBridged(message models.Message, bot *models.Bot) {
+	if message.Service != models.MsgServiceChat || message.Event != models.MsgEventSent || len(strings.TrimSpace(message.Input)) == 0 {
+		return
+	}
+	for _, bridge := range bot.Bridges {
+		if !bridgeChannel(bridge.Channel, message) {
+			continue
+		}
+		if wasRelayed(message.ChannelID, message.Input) {
+			bot.Log.Debugf("Not relaying message %s, it was relayed into the channel", message.ID)
+			return
+		}
+		format := bridge.Format
+		if len(format) == 0 {
+			format = defaultBridgeFormat
+		}
+		channel := message.ChannelName
+		if len(channel) == 0 {
+			channel = message.ChannelID
+		}
+		text, err := utils.Substitute(format, map[string]string{
+			"user":    message.Vars["_user.name"],
+			"remote":  messageRemote(message, bot),
+			"channel": strings.TrimPrefix(channel, "#"),
+			"text":    message.Input,
+		})
+		if err != nil {
+			bot.Log.Errorf("Could not relay message %s: %s", message.ID, err.Error())
+			continue
+		}
+		for _, target := range bridge.To {
+			relay(text, target, message, bot)
+		}
+	}
+}
+
+// relay sends a relayed message to a bridge's target
+func relay(text string, target models.BridgeTarget, message models.Message, bot *models.Bot) {
+	to, ok := findRunningBot(target.Bot, bot)
+	if !ok {
+		bot.Log.Errorf("Could not relay message %s to bot '%s', it isn't running", message.ID, target.Bot)
+		return
+	}
+	channelID := strings.TrimPrefix(target.Channel, "#")
+	if id, ok := to.bot.Rooms[strings.ToLower(channelID)]; ok {
+		channelID = id
+	}
+
+	out := models.NewMessage()
+	out.Type = models.MsgTypeChannel
+	out.Service = models.MsgServiceChat
+	out.ChannelID = channelID
+	out.TraceParent = message.TraceParent
+	out.Output = text
+	if dialect, ok := markdownDialects[strings.ToLower(to.bot.ChatApplication)]; ok {
+		out.Output = render.Markdown(text, dialect)
+	}
+	rememberRelayed(channelID, out.Output)
+	bot.Log.Debugf("Relaying message %s to channel %s of %s", message.ID, channelID, to.bot.Name)
+	sendOutput(to.outputMsgs, to.hitRule, out, models.Rule{}, bot)
+}
+
+// bridgeChannel determines whether a message was sent in a bridge's channel
+func bridgeChannel(channel string, message models.Message) bool {
+	channel = strings.TrimPrefix(channel, "#")
+	return len(channel) > 0 && (channel == message.ChannelID || strings.EqualFold(channel, strings.TrimPrefix(message.ChannelName, "#")))
+}
+
+// findRunningBot finds a bot running in this process by name; no name is the bot itself
+func findRunningBot(name string, bot *models.Bot) (runningBot, bool) {
+	for _, other := range runningBots() {
+		if (len(name) == 0 && other.bot == bot) || (len(name) > 0 && strings.EqualFold(other.bot.Name, name)) {
+			return other, true
+		}
+	}
+	return runningBot{}, false
+}
+
+// rememberRelayed remembers that a message was relayed into a channel, for a while
+func rememberRelayed(channelID, text string) {
+	relayedMu.Lock()
+	defer relayedMu.Unlock()
+	now := time.Now()
+	for key, at := range relayed {
+		if now.Sub(at) > bridgeEcho {
+			delete(relayed, key)
+		}
+	}
+	relayed[channelID+"\x00"+strings.TrimSpace(text)] = now
+}
+
+// wasRelayed determines whether a message was relayed into a channel lately
+func wasRelayed(channelID, text string) bool {
+	relayedMu.Lock()
+	defer relayedMu.Unlock()
+	at, ok := relayed[channelID+"\x00"+strings.TrimSpace(text)]
+	return ok && time.Since(at) <= bridgeEcho
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestRelayBridged(t *testing.T) {
+	slackBot := &models.Bot{Name: "ops-slack", ChatApplication: "slack", Rooms: map[string]string{"incidents": "C123"}}
+	discordBot := &models.Bot{Name: "ops-discord", ChatApplication: "discord"}
+	initLogger(slackBot)
+	initLogger(discordBot)
+	slackBot.Bridges = []models.Bridge{{Channel: "#incidents", To: []models.BridgeTarget{{Bot: "ops-discord", Channel: "987"}}}}
+	discordBot.Bridges = []models.Bridge{{Channel: "987", To: []models.BridgeTarget{{Bot: "ops-slack", Channel: "incidents"}}}}
+
+	slackOut, slackHit := make(chan models.Message, 1), make(chan models.Rule, 1)
+	discordOut, discordHit := make(chan models.Message, 1), make(chan models.Rule, 1)
+	running.Lock()
+	saved := running.bots
+	running.bots = []runningBot{
+		{bot: slackBot, outputMsgs: slackOut, hitRule: slackHit},
+		{bot: discordBot, outputMsgs: discordOut, hitRule: discordHit},
+	}
+	running.Unlock()
+	defer func() {
+		running.Lock()
+		running.bots = saved
+		running.Unlock()
+	}()
+	received := func(out chan models.Message, hit chan models.Rule) (models.Message, bool) {
+		select {
+		case message := <-out:
+			<-hit
+			return message, true
+		default:
+			return models.Message{}, false
+		}
+	}
+
+	// A message in #incidents on Slack is relayed to Discord
+	message := models.NewMessage()
+	message.Service = models.MsgServiceChat
+	message.ChannelID = "C123"
+	message.ChannelName = "incidents"
+	message.Input = "db is down, see <https://status.example.com|status>"
+	message.Vars["_user.name"] = "jane"
+	relayBridged(message, slackBot)
+	relayedMessage, ok := received(discordOut, discordHit)
+	if !ok {
+		t.Fatal("relayBridged() didn't relay the message to Discord")
+	}
+	if want := "**jane** (slack #incidents): db is down, see <https://status.example.com|status>"; relayedMessage.Output != want || relayedMessage.ChannelID != "987" {
+		t.Errorf("relayBridged() = %q to %s, want %q to 987", relayedMessage.Output, relayedMessage.ChannelID, want)
+	}
+
+	// A reply on Discord is relayed back to Slack, attributed
+	reply := models.NewMessage()
+	reply.Service = models.MsgServiceChat
+	reply.ChannelID = "987"
+	reply.Input = "on it"
+	reply.Vars["_user.name"] = "bob"
+	relayBridged(reply, discordBot)
+	relayedReply, ok := received(slackOut, slackHit)
+	if !ok || relayedReply.Output != "*bob* (discord #987): on it" || relayedReply.ChannelID != "C123" {
+		t.Errorf("relayBridged() = %q to %s", relayedReply.Output, relayedReply.ChannelID)
+	}
+
+	// The relayed message, seen by another bot in the Discord channel, isn't relayed back
+	echo := models.NewMessage()
+	echo.Service = models.MsgServiceChat
+	echo.ChannelID = "987"
+	echo.Input = relayedMessage.Output
+	relayBridged(echo, discordBot)
+	if message, ok := received(slackOut, slackHit); ok {
+		t.Errorf("relayBridged() relayed %q back", message.Output)
+	}
+
+	// Other channels aren't relayed
+	other := models.NewMessage()
+	other.Service = models.MsgServiceChat
+	other.ChannelID = "C999"
+	other.Input = "hello"
+	relayBridged(other, slackBot)
+	if message, ok := received(discordOut, discordHit); ok {
+		t.Errorf("relayBridged() relayed %q from another channel", message.Output)
+	}
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mohae/deepcopy"
+
+	"github.com/target/flottbot/audit"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
+	"github.com/target/flottbot/utils"
+)
+
+// maxCallDepth limits how deeply 'call_rule' actions can nest, so rules calling each other can't loop forever
+const maxCallDepth = 5
+
+// setCallableRules lets a bot's 'call_rule' actions run its rules, set by the Matcher
+func setCallableRules(bot *models.Bot, rules map[string]models.Rule) {
+	p := pipelineOf(bot)
+	p.rulesMu.Lock()
+	defer p.rulesMu.Unlock()
+	p.callable = rules
+}
+
+// handleCallRule handles 'call_rule' actions, running the actions of another rule with the message's
+// variables and those the action passes in 'vars'. Its formatted output is available as ${_call_output},
+// and the variables its actions set as ${_call.<name>}.
+// The called rule's triggers and permissions don't apply, it doesn't even have to be active.
+func handleCallRule(action models.Action, msg *models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, span *tracing.Span, bot *models.Bot) error {
+	if len(action.Rule) == 0 {
+		return fmt.Errorf("no rule was supplied for the '%s' action named: %s", action.Type, action.Name)
+	}
+	if msg.CallDepth >= maxCallDepth {
+		return fmt.Errorf("Action '%s' can't call rule '%s', rules may only be nested %d deep", action.Name, action.Rule, maxCallDepth)
+	}
+	rule, ok := findCallableRule(action.Rule, bot)
+	if !ok {
+		return fmt.Errorf("Could not find a rule named '%s' for action '%s'", action.Rule, action.Name)
+	}
+
+	call := deepcopy.Copy(*msg).(models.Message)
+	call.CallDepth++
+	defer prepareArtifacts(rule, &call, bot)()
+	for name, value := range action.Vars {
+		v, err := utils.Substitute(value, msg.Vars)
+		if err != nil {
+			return err
+		}
+		call.Vars[name] = v
+	}
+	before := deepcopy.Copy(call.Vars).(map[string]string)
+
+	var results []audit.ActionResult
+	if rule.ParallelActions {
+		results = runActionGraph(&call, outputMsgs, &rule, hitRule, span, bot)
+	} else {
+		for _, a := range rule.Actions {
+			result := runAction(a, &call, outputMsgs, rule, hitRule, span, bot)
+			results = append(results, result)
+			if result.Aborted {
+				break
+			}
+		}
+	}
+
+	for name, value := range call.Vars {
+		if old, ok := before[name]; !ok || old != value {
+			msg.Vars["_call."+name] = value
+		}
+	}
+	// What the called rule would have done in a dry run shows with the caller's output
+	if actions := call.Vars["_dry_run.actions"]; len(actions) > 0 {
+		msg.Vars["_dry_run.actions"] = actions
+	}
+	if len(call.Error) > 0 {
+		msg.Error = call.Error
+	}
+	msg.Files = call.Files
+	// The caller's 'on_error' takes over when the called rule aborts
+	for _, result := range results {
+		if result.Aborted {
+			return fmt.Errorf("Rule '%s' called by action '%s' aborted after action '%s' failed", rule.Name, action.Name, result.Name)
+		}
+	}
+
+	// Rules that are only called don't need to format an output
+	msg.Vars["_call_output"] = ""
+	if len(rule.FormatOutput) > 0 {
+		output, err := craftResponse(rule, call, bot)
+		if err != nil {
+			return err
+		}
+		msg.Vars["_call_output"] = output
+	}
+
+	bot.Log.Debugf("Successfully executed action '%s'", action.Name)
+	return nil
+}
+
+// findCallableRule looks up one of the bot's rules by name
+func findCallableRule(name string, bot *models.Bot) (models.Rule, bool) {
+	p := pipelineOf(bot)
+	p.rulesMu.RLock()
+	defer p.rulesMu.RUnlock()
+	for _, rule := range p.callable {
+		if strings.EqualFold(rule.Name, name) {
+			return rule, true
+		}
+	}
+	return models.Rule{}, false
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
+)
+
+func TestHandleCallRule(t *testing.T) {
+	bot := new(models.Bot)
+	setCallableRules(bot, map[string]models.Rule{
+		"rules/lookup.yml": {
+			Name:         "lookup owner",
+			FormatOutput: "${service} is owned by ${_exec_output}",
+			Actions: []models.Action{
+				{Name: "owner", Type: "exec", Cmd: "echo platform"},
+			},
+		},
+		"rules/loop.yml": {
+			Name: "loop",
+			Actions: []models.Action{
+				{Name: "again", Type: "call_rule", Rule: "loop"},
+			},
+		},
+	})
+
+	span := tracing.Start("", "rule")
+
+	msg := models.NewMessage()
+	msg.Vars["name"] = "api"
+	action := models.Action{Name: "ask", Type: "call_rule", Rule: "Lookup Owner", Vars: map[string]string{"service": "${name}-gateway"}}
+	if err := handleCallRule(action, &msg, nil, nil, span, bot); err != nil {
+		t.Fatalf("handleCallRule() error = %v", err)
+	}
+	if msg.Vars["_call_output"] != "api-gateway is owned by platform" {
+		t.Errorf("handleCallRule() _call_output = %q", msg.Vars["_call_output"])
+	}
+	if msg.Vars["_call._exec_output"] != "platform" || msg.Vars["_call._exec_status"] != "0" {
+		t.Errorf("handleCallRule() vars = %v", msg.Vars)
+	}
+	if _, ok := msg.Vars["_exec_output"]; ok {
+		t.Error("handleCallRule() leaked the called rule's variables into the caller")
+	}
+
+	// Rules calling themselves stop at the maximum depth
+	loop := models.NewMessage()
+	if err := handleCallRule(models.Action{Name: "start", Type: "call_rule", Rule: "loop"}, &loop, nil, nil, span, bot); err != nil {
+		t.Errorf("handleCallRule() error = %v", err)
+	}
+
+	for _, a := range []models.Action{
+		{Name: "no rule", Type: "call_rule"},
+		{Name: "unknown rule", Type: "call_rule", Rule: "nope"},
+		{Name: "missing variable", Type: "call_rule", Rule: "lookup owner", Vars: map[string]string{"service": "${missing}"}},
+	} {
+		if err := handleCallRule(a, &msg, nil, nil, span, bot); err == nil {
+			t.Errorf("handleCallRule() %s expected an error", a.Name)
+		}
+	}
+
+	deep := models.NewMessage()
+	deep.CallDepth = maxCallDepth
+	if err := handleCallRule(action, &deep, nil, nil, span, bot); err == nil {
+		t.Error("handleCallRule() expected an error beyond the maximum depth")
+	}
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"hash/fnv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/target/flottbot/models"
+)
+
+// Versions of a rule with a canary
+const (
+	versionStable = "stable"
+	versionCanary = "canary"
+)
+
+var ruleVersionsCollector = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "flottbot_ruleVersionCount",
+		Help: "Total No. of bot rules with a canary triggered, by version",
+	},
+	[]string{"rulename", "version"},
+)
+
+// canaries finds the active canaries of rules, by the name of their stable version in lower case
+func canaries(rules map[string]models.Rule) map[string][]models.Rule {
+	found := make(map[string][]models.Rule)
+	for _, rule := range sortRules(rules) {
+		if rule.Active && len(rule.Canary.Of) > 0 {
+			stable := strings.ToLower(rule.Canary.Of)
+			found[stable] = append(found[stable], rule)
+		}
+	}
+	return found
+}
+
+// ruleVersion is the version of a rule a message gets: one of its canaries, if the message is for
+// one, or else the rule itself. Rules without canaries are returned as they are.
+func ruleVersion(rule models.Rule, canaries map[string][]models.Rule, message models.Message) models.Rule {
+	versions, ok := canaries[strings.ToLower(rule.Name)]
+	if !ok {
+		return rule
+	}
+	// The users of a canary get it no matter the percentages
+	for _, canary := range versions {
+		if canaryUser(canary.Canary, message) {
+			canary.Version = versionCanary
+			return canary
+		}
+	}
+	// Messages are split by their ID, so the same message always gets the same version. With several
+	// canaries, their percentages add up: 10 and 5 are the first 10% of messages and the next 5%.
+	h := fnv.New32a()
+	h.Write([]byte(message.ID))
+	share := float64(h.Sum32()%10000) / 100
+	total := 0.0
+	for _, canary := range versions {
+		if canary.Canary.Percent <= 0 {
+			continue
+		}
+		total += canary.Canary.Percent
+		if share < total {
+			canary.Version = versionCanary
+			return canary
+		}
+	}
+	rule.Version = versionStable
+	return rule
+}
+
+// stableVersion finds the rule a canary is a canary of
+func stableVersion(canary models.Rule, rules map[string]models.Rule) (models.Rule, bool) {
+	for _, rule := range rules {
+		if strings.EqualFold(rule.Name, canary.Canary.Of) {
+			return rule, true
+		}
+	}
+	return models.Rule{}, false
+}
+
+// canaryUser determines whether the sender of a message is one of a canary's users
+func canaryUser(canary models.Canary, message models.Message) bool {
+	for _, user := range canary.Users {
+		if user == message.Vars["_user.name"] || user == message.Vars["_user.id"] {
+			return true
+		}
+	}
+	return false
+}
+
+// countRuleVersion counts a hit of a rule with a canary in the metrics, under the name of the stable
+// version, so both versions of a rule can be compared
+func countRuleVersion(rule models.Rule, bot *models.Bot) {
+	if !bot.Metrics || len(rule.Version) == 0 {
+		return
+	}
+	name := rule.Name
+	if len(rule.Canary.Of) > 0 {
+		name = rule.Canary.Of
+	}
+	ruleVersionsCollector.With(prometheus.Labels{"rulename": bot.Name + "-" + name, "version": rule.Version}).Inc()
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestRuleVersion(t *testing.T) {
+	rules := map[string]models.Rule{
+		"deploy.yml":    {Name: "deploy", Active: true, Respond: "deploy"},
+		"deploy-v2.yml": {Name: "deploy-v2", Active: true, Respond: "deploy", Canary: models.Canary{Of: "Deploy", Percent: 10, Users: []string{"jane"}}},
+		"deploy-v3.yml": {Name: "deploy-v3", Active: true, Respond: "deploy", Canary: models.Canary{Of: "deploy", Percent: 5}},
+		"old.yml":       {Name: "deploy-v1", Respond: "deploy", Canary: models.Canary{Of: "deploy", Percent: 50}},
+		"status.yml":    {Name: "status", Active: true, Respond: "status"},
+	}
+	versions := canaries(rules)
+
+	message := func(id, user string) models.Message {
+		m := models.NewMessage()
+		m.ID = id
+		m.Vars["_user.name"] = user
+		return m
+	}
+	if rule := ruleVersion(rules["status.yml"], versions, message("1", "joe")); rule.Name != "status" || len(rule.Version) > 0 {
+		t.Errorf("ruleVersion() of a rule without canaries = %s (%s)", rule.Name, rule.Version)
+	}
+	if rule := ruleVersion(rules["deploy.yml"], versions, message("1", "jane")); rule.Name != "deploy-v2" || rule.Version != versionCanary {
+		t.Errorf("ruleVersion() for a canary user = %s (%s), want deploy-v2 (canary)", rule.Name, rule.Version)
+	}
+
+	// Roughly the canaries' percentages of messages get them, and the same message always gets the same version
+	got := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("msg-%d", i)
+		rule := ruleVersion(rules["deploy.yml"], versions, message(id, "joe"))
+		if again := ruleVersion(rules["deploy.yml"], versions, message(id, "joe")); again.Name != rule.Name {
+			t.Fatalf("ruleVersion() of message %s = %s, then %s", id, rule.Name, again.Name)
+		}
+		got[rule.Name+" ("+rule.Version+")"]++
+	}
+	want := map[string]int{"deploy (stable)": 8500, "deploy-v2 (canary)": 1000, "deploy-v3 (canary)": 500}
+	if len(got) != len(want) {
+		t.Fatalf("ruleVersion() versions = %v, want %v", got, want)
+	}
+	for version, count := range want {
+		if got[version] < count*8/10 || got[version] > count*12/10 {
+			t.Errorf("ruleVersion() gave %s to %d of 10000 messages, want about %d", version, got[version], count)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote/scheduler"
+	"github.com/target/flottbot/utils"
+)
+
+// builtinCommand is a command handled by the bot itself rather than by a rule file.
+// Built-in commands are only considered when no rule matched the message, so rules
+// can always override them.
+type builtinCommand struct {
+	trigger     string // matched like a rule's 'respond' field
+	usage       string // shown when the command is run with missing arguments
+	description string // shown by the help command
+	args        int    // number of required arguments
+	admin       bool   // whether only bot admins may run the command
+	module      string // the built-in module providing the command, if it's not always available
+	run         func(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error)
+}
+
+// builtinCommands holds all built-in commands, in the order they are matched
+var builtinCommands = []builtinCommand{
+	{trigger: "schedules", usage: "schedules", description: "List schedules and whether they are paused", run: listSchedulesCommand},
+	{trigger: "schedule pause", usage: "schedule pause <name>", description: "Pause a schedule", args: 1, admin: true, run: pauseScheduleCommand},
+	{trigger: "schedule resume", usage: "schedule resume <name>", description: "Resume a paused schedule", args: 1, admin: true, run: resumeScheduleCommand},
+	{trigger: "schedule trigger", usage: "schedule trigger <name>", description: "Run a schedule right away", args: 1, admin: true, run: triggerScheduleCommand},
+}
+
+// handleBuiltinCommand runs the built-in command addressed by the message, if any,
+// and reports whether one was found
+func handleBuiltinCommand(outputMsgs chan<- models.Message, message models.Message, hitRule chan<- models.Rule, rules map[string]models.Rule, bot *models.Bot) bool {
+	if message.Service != models.MsgServiceChat && message.Service != models.MsgServiceCLI {
+		return false
+	}
+	// Built-in commands behave like 'respond' rules: the bot must be addressed
+	if message.Type != models.MsgTypeDirect && !message.BotMentioned {
+		return false
+	}
+
+	for _, cmd := range builtinCommands {
+		if len(cmd.module) > 0 && !moduleEnabled(cmd.module, bot) {
+			continue
+		}
+		processedInput, hit := utils.Match(cmd.trigger, message.Input, true)
+		if !hit {
+			continue
+		}
+		bot.Log.Debugf("Found built-in command '%s'", cmd.trigger)
+		Prommetric(bot.Name+"-builtin-"+strings.Replace(cmd.trigger, " ", "-", -1), bot)
+
+		args := utils.FindArgs(processedInput)
+		switch {
+		case cmd.admin && !isAdmin(message, bot):
+			message.Output = translate(message, bot, "errors.not_allowed_command", "You are not allowed to run the '${command}' command.", map[string]string{"command": cmd.trigger})
+		case len(args) < cmd.args:
+			message.Output = translate(message, bot, "errors.missing_args", "You might be missing an argument or two. This is what I'm looking for\n```${usage}```", map[string]string{"usage": cmd.usage})
+		default:
+			output, err := cmd.run(args, &message, outputMsgs, rules, hitRule, bot)
+			if err != nil {
+				bot.Log.Error(err)
+				output = err.Error()
+			}
+			message.Output = output
+		}
+
+		sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+		return true
+	}
+	return false
+}
+
+// isAdmin determines whether the sender of a message is allowed to run admin commands, by their user
+// name, ID, or identity. Messages from the CLI are always trusted since they come from the bot operator.
+func isAdmin(message models.Message, bot *models.Bot) bool {
+	if message.Service == models.MsgServiceCLI {
+		return true
+	}
+	for _, admin := range bot.Admins {
+		if admin == message.Vars["_user.name"] || admin == message.Vars["_user.id"] || (len(message.Vars["_user.identity"]) > 0 && admin == message.Vars["_user.identity"]) {
+			return true
+		}
+	}
+	return false
+}
+
+// listSchedulesCommand lists all active schedules and whether they are paused
+func listSchedulesCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	schedules := Schedules(rules)
+	if len(schedules) == 0 {
+		return "There are no active schedules.", nil
+	}
+	output := "These are my schedules:\n"
+	for _, rule := range schedules {
+		status := "running"
+		if scheduler.IsPaused(rule.Name, bot) {
+			status = "paused"
+		}
+		output = output + fmt.Sprintf("\n • %s (`%s`) - %s", rule.Name, rule.Schedule, status)
+	}
+	return output, nil
+}
+
+// pauseScheduleCommand pauses the schedule named by the first argument
+func pauseScheduleCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	if err := PauseSchedule(args[0], rules, bot); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Paused schedule '%s'.", args[0]), nil
+}
+
+// resumeScheduleCommand resumes the schedule named by the first argument
+func resumeScheduleCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	if err := ResumeSchedule(args[0], rules, bot); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Resumed schedule '%s'.", args[0]), nil
+}
+
+// triggerScheduleCommand runs the schedule named by the first argument right away
+func triggerScheduleCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	if err := TriggerSchedule(args[0], outputMsgs, rules, hitRule, bot); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Triggered schedule '%s'.", args[0]), nil
+}
@@ -1,11 +1,16 @@
 package core
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/target/flottbot/handlers"
 	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
 	"github.com/target/flottbot/utils"
 )
 
@@ -16,10 +21,55 @@ func Configure(bot *models.Bot) {
 
 	initLogger(bot)
 
+	configureEnv(bot)
+
+	configureSecrets(bot)
+
 	validateRemoteSetup(bot)
 
 	configureChatApplication(bot)
 
+	configureStateDir(bot)
+
+	configureStorage(bot)
+
+	configureHighAvailability(bot)
+
+	// Tracing, the admin API, and the health probes are shared by all bots of the process,
+	// and set up by its main bot
+	if len(bot.ConfigDir) == 0 {
+		configureTracing(bot)
+
+		configureAdminAPI(bot)
+
+		configureHealth(bot)
+	} else {
+		// Errors of additional bots show in the main bot's admin API
+		bot.Log.AddHook(recentErrors)
+	}
+
+	configureAudit(bot)
+
+	configureRecording(bot)
+
+	configureRedaction(bot)
+
+	configureMiddleware(bot)
+
+	configureMatchMode(bot)
+
+	configureInputQueue(bot)
+
+	configureCircuitBreaker(bot)
+
+	configureNLU(bot)
+
+	configureLLM(bot)
+
+	configureI18N(bot)
+
+	configureModules(bot)
+
 	bot.Log.Infof("Configured bot '%s'!", bot.Name)
 }
 
@@ -38,6 +88,14 @@ func initLogger(b *models.Bot) {
 	}
 }
 
+// configureEnv fills in the environment variables referenced in bot.yml (and its overlay), and
+// stops the bot if any variable it requires isn't set
+func configureEnv(bot *models.Bot) {
+	if err := utils.ExpandEnv(bot, true); err != nil {
+		bot.Log.Fatalf("Could not configure bot '%s': %s", bot.Name, err.Error())
+	}
+}
+
 // configureChatApplication configures a user's specified chat application
 // TODO: Refactor to keep remote specifics in remote/
 func configureChatApplication(bot *models.Bot) {
@@ -85,6 +143,15 @@ func configureChatApplication(bot *models.Bot) {
 			}
 			bot.SlackWorkspaceToken = wsToken
 
+			// Slack workspace tokens of the workspaces of an Enterprise Grid org
+			for team, token := range bot.SlackWorkspaceTokens {
+				wsToken, err := utils.Substitute(token, map[string]string{})
+				if err != nil {
+					bot.Log.Warnf("Could not set Slack Workspace Token of '%s': %s", team, err.Error())
+				}
+				bot.SlackWorkspaceTokens[team] = wsToken
+			}
+
 			// Get Slack Events path
 			eCallbackPath, err := utils.Substitute(bot.SlackEventsCallbackPath, map[string]string{})
 			if err != nil {
@@ -106,6 +173,18 @@ func configureChatApplication(bot *models.Bot) {
 			}
 			bot.SlackInteractionsCallbackPath = iCallbackPath
 
+			// Addresses of the Events API and Interactive Components servers; bots running
+			// in the same process each need their own
+			if len(bot.SlackEventsAddress) == 0 {
+				bot.SlackEventsAddress = ":3000"
+			}
+			if len(bot.SlackInteractionsAddress) == 0 {
+				bot.SlackInteractionsAddress = ":4000"
+			}
+
+		case "mock":
+			// The in-memory chat application of tests needs no configuration
+
 		default:
 			bot.Log.Errorf("Chat application '%s' is not supported", bot.ChatApplication)
 			bot.RunChat = false
@@ -113,6 +192,119 @@ func configureChatApplication(bot *models.Bot) {
 	}
 }
 
+// configureRecording sets the file that payloads the remotes receive are recorded to, with 'record_traffic'
+func configureRecording(bot *models.Bot) {
+	if !bot.RecordTraffic {
+		return
+	}
+	if len(bot.RecordFile) == 0 {
+		bot.RecordFile = filepath.Join(bot.StateDir, "traffic.jsonl")
+	}
+	bot.Log.Warnf("Recording the payloads received by remotes to '%s'", bot.RecordFile)
+}
+
+// configureStateDir sets the directory where the file-based storage backends keep bot state
+func configureStateDir(bot *models.Bot) {
+	stateDir, err := utils.Substitute(bot.StateDir, map[string]string{})
+	if err != nil {
+		bot.Log.Warnf("Could not set state directory: %s", err.Error())
+		stateDir = ""
+	}
+	if len(stateDir) == 0 {
+		stateDir = "state"
+		// Additional bots of the process keep their state apart from the main bot's
+		if len(bot.ConfigDir) > 0 {
+			stateDir = filepath.Join(stateDir, filepath.Base(bot.ConfigDir))
+		}
+	}
+	bot.StateDir = stateDir
+}
+
+// configureHighAvailability identifies this instance of the bot among its replicas
+func configureHighAvailability(bot *models.Bot) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "flottbot"
+	}
+	bot.InstanceID = hostname + "-" + models.GenerateMessageID()
+
+	if bot.HighAvailability {
+		switch strings.ToLower(bot.Storage) {
+		case "redis", "postgres":
+			bot.Log.Infof("Running in high availability mode as instance '%s'", bot.InstanceID)
+		default:
+			bot.Log.Warnf("High availability mode needs storage shared by all replicas (redis or postgres), but '%s' storage is used", bot.Storage)
+		}
+	} else if bot.SharedQueue {
+		bot.Log.Warn("'shared_queue' only works with 'high_availability', the messages read from chat are processed where they're read")
+	}
+}
+
+// configureTracing exports OpenTelemetry spans for the message pipeline when a collector endpoint is set
+func configureTracing(bot *models.Bot) {
+	endpoint, err := utils.Substitute(bot.TracingEndpoint, map[string]string{})
+	if err != nil {
+		bot.Log.Warnf("Could not set tracing endpoint: %s", err.Error())
+		return
+	}
+	if len(endpoint) == 0 {
+		return
+	}
+	bot.TracingEndpoint = endpoint
+
+	headers := make(map[string]string)
+	for k, v := range bot.TracingHeaders {
+		value, err := utils.Substitute(v, map[string]string{})
+		if err != nil {
+			bot.Log.Warnf("Could not set tracing header '%s': %s", k, err.Error())
+			continue
+		}
+		headers[k] = value
+	}
+
+	tracing.Configure(endpoint, bot.Name, headers, func(err error) {
+		bot.Log.Debugf("Could not export traces: %s", err.Error())
+	})
+	bot.Log.Infof("Exporting traces to '%s'", endpoint)
+}
+
+// configureMatchMode decides whether only the first or all matching rules fire for a message
+func configureMatchMode(bot *models.Bot) {
+	switch strings.ToLower(bot.MatchMode) {
+	case "":
+		bot.MatchMode = matchModeFirst
+	case matchModeFirst, matchModeAll:
+		bot.MatchMode = strings.ToLower(bot.MatchMode)
+	default:
+		bot.Log.Warnf("Unknown match_mode '%s', use '%s' or '%s'. Falling back to '%s'", bot.MatchMode, matchModeFirst, matchModeAll, matchModeFirst)
+		bot.MatchMode = matchModeFirst
+	}
+}
+
+// defaultCircuitBreakerCooldown is how long a URL isn't called after its circuit opened
+const defaultCircuitBreakerCooldown = 30 * time.Second
+
+// configureCircuitBreaker sets up the circuit breaker that stops HTTP actions from calling
+// a service after too many consecutive failures
+func configureCircuitBreaker(bot *models.Bot) {
+	if bot.CircuitBreakerFailures <= 0 {
+		return
+	}
+	cooldown := defaultCircuitBreakerCooldown
+	if len(bot.CircuitBreakerCooldown) > 0 {
+		d, err := time.ParseDuration(bot.CircuitBreakerCooldown)
+		if err != nil {
+			bot.Log.Warnf("Invalid circuit_breaker_cooldown '%s', using %s: %s", bot.CircuitBreakerCooldown, cooldown, err.Error())
+		} else {
+			cooldown = d
+		}
+	}
+	// The bot's rule runs share the circuit breaker, other bots in the process have their own
+	p := pipelineOf(bot)
+	p.runs = handlers.WithCircuitBreaker(p.runs, bot.CircuitBreakerFailures, cooldown)
+	bot.Log.Infof("HTTP actions stop calling a URL for %s after %d consecutive failures", cooldown, bot.CircuitBreakerFailures)
+}
+
 func validateRemoteSetup(bot *models.Bot) {
 	if len(bot.ChatApplication) > 0 {
 		bot.RunChat = true
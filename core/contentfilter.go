@@ -0,0 +1,174 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+// Actions of 'filter' middleware on output with the words it looks for
+const (
+	filterMask  = "mask"
+	filterBlock = "block"
+)
+
+// moderationRequest is what a 'filter' middleware sends its moderation API, like OpenAI's moderation endpoint
+type moderationRequest struct {
+	Input string `json:"input"`
+}
+
+// moderationResponse is what a moderation API answers: whether the text is flagged, either on its own or,
+// like OpenAI's moderation endpoint, in its results
+type moderationResponse struct {
+	Flagged bool               `json:"flagged"`
+	Results []moderationResult `json:"results"`
+}
+
+// moderationResult is the verdict on a text of a moderation API, with the categories it's flagged for
+type moderationResult struct {
+	Flagged    bool            `json:"flagged"`
+	Categories map[string]bool `json:"categories"`
+}
+
+// filterMiddleware checks the output for words, from the middleware's 'words' and 'wordlists', and masks
+// them, or blocks the output with 'action: block'. With a 'url', the output is checked with a moderation
+// API too, and blocked if it's flagged. Blocked output isn't sent, or is replaced by the 'text'.
+func filterMiddleware(conf models.Middleware) (OutputMiddleware, error) {
+	words := append([]string{}, conf.Words...)
+	for _, path := range conf.Wordlists {
+		list, err := readWordlist(path)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read wordlist '%s': %s", path, err.Error())
+		}
+		words = append(words, list...)
+	}
+	action := strings.ToLower(conf.Action)
+	if len(action) == 0 {
+		action = filterMask
+	}
+	if action != filterMask && action != filterBlock {
+		return nil, fmt.Errorf("Unknown action '%s' of filter middleware, use 'mask' or 'block'", conf.Action)
+	}
+	if len(words) == 0 && len(conf.URL) == 0 {
+		return nil, fmt.Errorf("Filter middleware needs 'words', 'wordlists', or a 'url'")
+	}
+	replacement := conf.Replacement
+	if len(replacement) == 0 {
+		replacement = "***"
+	}
+	var pattern *regexp.Regexp
+	if len(words) > 0 {
+		pattern = wordsPattern(words)
+	}
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultMiddlewareTimeout
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+
+	block := func(message *models.Message, reason string, bot *models.Bot) bool {
+		bot.Log.Warnf("Filter middleware blocked the output of message %s: %s", message.ID, reason)
+		if len(conf.Text) == 0 {
+			return false
+		}
+		message.Output = conf.Text
+		return true
+	}
+	return OutputMiddlewareFunc(func(message *models.Message, bot *models.Bot) bool {
+		if len(strings.TrimSpace(message.Output)) == 0 {
+			return true
+		}
+		if pattern != nil && pattern.MatchString(message.Output) {
+			if action == filterBlock {
+				return block(message, "it has words of the wordlists", bot)
+			}
+			message.Output = pattern.ReplaceAllLiteralString(message.Output, replacement)
+		}
+		if len(conf.URL) == 0 {
+			return true
+		}
+		// The rule's run is over by the time its output gets here, so only shutdown stops the check
+		flagged, categories, err := moderate(pipelineOf(bot).runs, client, conf, message.Output)
+		if err != nil {
+			bot.Log.Errorf("Could not check the output of message %s with the moderation API: %s", message.ID, err.Error())
+			if conf.FailClosed {
+				return block(message, "the moderation API failed", bot)
+			}
+			return true
+		}
+		if flagged {
+			return block(message, "the moderation API flagged it "+strings.Join(categories, ", "), bot)
+		}
+		return true
+	}), nil
+}
+
+// moderate asks a moderation API whether a text is flagged, and for which categories. The request stops when ctx is done.
+func moderate(ctx context.Context, client *http.Client, conf models.Middleware, text string) (bool, []string, error) {
+	body, err := json.Marshal(moderationRequest{Input: text})
+	if err != nil {
+		return false, nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if len(conf.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+conf.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, nil, fmt.Errorf("Moderation API responded with %s", resp.Status)
+	}
+	var verdict moderationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return false, nil, err
+	}
+
+	flagged := verdict.Flagged
+	categories := []string{}
+	for _, result := range verdict.Results {
+		flagged = flagged || result.Flagged
+		for category, hit := range result.Categories {
+			if hit {
+				categories = append(categories, category)
+			}
+		}
+	}
+	sort.Strings(categories)
+	return flagged, categories, nil
+}
+
+// readWordlist reads the words of a wordlist, one per line; blank lines and lines starting with '#' are skipped
+func readWordlist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	words := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if len(word) > 0 && !strings.HasPrefix(word, "#") {
+			words = append(words, word)
+		}
+	}
+	return words, scanner.Err()
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestFilterMiddleware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flottbot-filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wordlist := filepath.Join(dir, "words.txt")
+	ioutil.WriteFile(wordlist, []byte("# mild\nheck\n\ndarn\n"), 0644)
+
+	moderation := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req moderationRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case r.Header.Get("Authorization") != "Bearer secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		case strings.Contains(req.Input, "hate"):
+			w.Write([]byte(`{"results":[{"flagged":true,"categories":{"hate":true,"violence":false}}]}`))
+		default:
+			w.Write([]byte(`{"results":[{"flagged":false}]}`))
+		}
+	}))
+	defer moderation.Close()
+
+	tests := []struct {
+		name     string
+		conf     models.Middleware
+		output   string
+		want     string
+		wantSent bool
+	}{
+		{"Masks words of wordlists", models.Middleware{Wordlists: []string{wordlist}, Words: []string{"dang"}}, "Heck, dang it", "***, *** it", true},
+		{"Blocks words", models.Middleware{Wordlists: []string{wordlist}, Action: "block"}, "darn", "darn", false},
+		{"Replaces blocked output", models.Middleware{Words: []string{"darn"}, Action: "block", Text: "Sorry, I can't post that."}, "darn", "Sorry, I can't post that.", true},
+		{"Passes clean output", models.Middleware{Words: []string{"darn"}, URL: moderation.URL, Token: "secret"}, "All good", "All good", true},
+		{"Blocks flagged output", models.Middleware{URL: moderation.URL, Token: "secret"}, "I hate Mondays", "I hate Mondays", false},
+		{"Sends output when the API fails", models.Middleware{URL: moderation.URL}, "I hate Mondays", "I hate Mondays", true},
+		{"Blocks output when the API fails, closed", models.Middleware{URL: moderation.URL, FailClosed: true}, "All good", "All good", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &models.Bot{ChatApplication: "slack"}
+			initLogger(bot)
+			tt.conf.Type = "filter"
+			middleware, err := newOutputMiddleware(tt.conf)
+			if err != nil {
+				t.Fatalf("newOutputMiddleware() error = %v", err)
+			}
+			UseOutputMiddleware(bot, middleware)
+
+			message := models.NewMessage()
+			message.Output = tt.output
+			if sent := processOutput(&message, bot); sent != tt.wantSent || message.Output != tt.want {
+				t.Errorf("processOutput() = %v, %q, want %v, %q", sent, message.Output, tt.wantSent, tt.want)
+			}
+		})
+	}
+
+	for _, conf := range []models.Middleware{
+		{Type: "filter"},
+		{Type: "filter", Words: []string{"darn"}, Action: "shout"},
+		{Type: "filter", Wordlists: []string{filepath.Join(dir, "missing.txt")}},
+	} {
+		if _, err := newOutputMiddleware(conf); err == nil {
+			t.Errorf("newOutputMiddleware(%+v) error = nil", conf)
+		}
+	}
+}
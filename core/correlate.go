@@ -0,0 +1,135 @@
+package core
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/utils"
+)
+
+// correlateBucket is the storage bucket of the messages that repeats of rules with 'correlate' are
+// threaded under, by rule, channel, and correlation key
+const correlateBucket = "correlated_alerts"
+
+// correlateWindow is how long a rule with 'correlate' has to fire again with the same key for the
+// repeat to be threaded, when its 'correlate_window' is not set
+const correlateWindow = 24 * time.Hour
+
+// correlatedAlert is the first message a rule with 'correlate' sent for a key, and how often the rule
+// fired with that key since
+type correlatedAlert struct {
+	ID    string    `json:"id"`   // of the message in the chat application
+	Text  string    `json:"text"` // of the message, before the counter was added
+	Count int       `json:"count"`
+	First time.Time `json:"first"`
+}
+
+// sendCorrelated sends the output of a rule with 'correlate', and reports whether it did. The first
+// time the rule fires with a key, e.g. '${alert}', its output is posted as usual; when it fires
+// again with the same key within the window, the output is posted in the thread of that message,
+// which is edited to count how often the rule fired. The window starts over with every repeat.
+// Outputs that aren't for one channel, or chat applications that can't edit messages, are left to
+// be sent as usual.
+func sendCorrelated(message models.Message, rule models.Rule, now time.Time, bot *models.Bot) bool {
+	if len(rule.Correlate) == 0 || bot.Store == nil || len(strings.TrimSpace(message.Output)) == 0 {
+		return false
+	}
+	channel, ok := correlationChannel(message)
+	if !ok {
+		bot.Log.Debugf("Not correlating the output of rule '%s', it's not for one channel", rule.Name)
+		return false
+	}
+	editor, ok := remoteFor(message, bot).(remote.MessageEditor)
+	if !ok {
+		bot.Log.Debugf("Not correlating the output of rule '%s', %s can't edit messages", rule.Name, bot.ChatApplication)
+		return false
+	}
+	key, err := utils.Substitute(rule.Correlate, message.Vars)
+	if key = strings.TrimSpace(key); err != nil || len(key) == 0 {
+		bot.Log.Debugf("Not correlating the output of rule '%s', its 'correlate' key is empty", rule.Name)
+		return false
+	}
+	window := correlationWindow(rule, bot)
+	storeKey := strings.ToLower(rule.Name) + "/" + channel + "/" + key
+
+	var alert correlatedAlert
+	if value, found, err := bot.Store.Get(correlateBucket, storeKey); err != nil {
+		bot.Log.Errorf("Could not look up earlier outputs of rule '%s', sending it as usual: %s", rule.Name, err.Error())
+		return false
+	} else if found {
+		if err := json.Unmarshal(value, &alert); err != nil {
+			alert = correlatedAlert{}
+		}
+	}
+
+	if len(alert.ID) == 0 {
+		// The first message is posted on its own, so its repeats have a thread to go in
+		id, err := editor.PostMessage(channel, "", message.Output, bot)
+		if err != nil {
+			bot.Log.Errorf("Could not post the output of rule '%s', sending it as usual: %s", rule.Name, err.Error())
+			return false
+		}
+		alert = correlatedAlert{ID: id, Text: message.Output, Count: 1, First: now}
+		saveCorrelatedAlert(storeKey, alert, window, rule, bot)
+		return true
+	}
+
+	alert.Count++
+	// Chat applications without threads only get the counter
+	if client, ok := editor.(remote.Remote); ok && client.Capabilities().Threads {
+		if _, err := editor.PostMessage(channel, alert.ID, message.Output, bot); err != nil {
+			bot.Log.Errorf("Could not post the output of rule '%s' in the thread of '%s': %s", rule.Name, key, err.Error())
+		}
+	}
+	counter := translate(message, bot, "correlate.counter", "_Fired ${count} times, last at ${time}_", map[string]string{
+		"count": strconv.Itoa(alert.Count),
+		"time":  now.UTC().Format("Jan 2 15:04 MST"),
+	})
+	if err := editor.EditMessage(channel, alert.ID, alert.Text+"\n"+counter, bot); err != nil {
+		bot.Log.Errorf("Could not update how often rule '%s' fired for '%s': %s", rule.Name, key, err.Error())
+	}
+	saveCorrelatedAlert(storeKey, alert, window, rule, bot)
+	return true
+}
+
+// correlationChannel is the one channel an output is for, if it's for one
+func correlationChannel(message models.Message) (string, bool) {
+	if message.DirectMessageOnly || message.Type == models.MsgTypeDirect || len(message.OutputToUsers) > 0 {
+		return "", false
+	}
+	switch len(message.OutputToRooms) {
+	case 0:
+		return message.ChannelID, len(message.ChannelID) > 0
+	case 1:
+		return message.OutputToRooms[0], true
+	}
+	return "", false
+}
+
+// correlationWindow is how long a rule has to fire again with the same key for it to be threaded
+func correlationWindow(rule models.Rule, bot *models.Bot) time.Duration {
+	if len(rule.CorrelateWindow) == 0 {
+		return correlateWindow
+	}
+	window, err := utils.ParseDuration(rule.CorrelateWindow)
+	if err != nil || window <= 0 {
+		bot.Log.Errorf("Invalid 'correlate_window' '%s' for rule '%s', using %s", rule.CorrelateWindow, rule.Name, correlateWindow)
+		return correlateWindow
+	}
+	return window
+}
+
+// saveCorrelatedAlert keeps the message repeats of a rule are threaded under for another window
+func saveCorrelatedAlert(key string, alert correlatedAlert, window time.Duration, rule models.Rule, bot *models.Bot) {
+	value, err := json.Marshal(alert)
+	if err == nil {
+		err = bot.Store.Set(correlateBucket, key, value, window)
+	}
+	if err != nil {
+		bot.Log.Errorf("Could not keep the message of rule '%s' for its repeats: %s", rule.Name, err.Error())
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote/mock"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestSendCorrelated(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New()}
+	initLogger(testBot)
+	client := mock.New(testBot)
+
+	rule := models.Rule{Name: "alert", Correlate: "${alert}", CorrelateWindow: "1h"}
+	now := time.Date(2019, 5, 1, 14, 0, 0, 0, time.UTC)
+	fire := func(rule models.Rule, alert, output string, at time.Duration) bool {
+		message := models.NewMessage()
+		message.Service = models.MsgServiceChat
+		message.Type = models.MsgTypeChannel
+		message.ChannelID = "C1"
+		message.Vars["alert"] = alert
+		message.Output = output
+		return sendCorrelated(message, rule, now.Add(at), testBot)
+	}
+
+	if fire(models.Rule{Name: "alert"}, "HighCPU", "CPU at 95%", 0) || fire(rule, "", "No key", 0) {
+		t.Fatalf("sendCorrelated() sent an output without a correlation key")
+	}
+	for i, alert := range []string{"HighCPU", "HighCPU", "DiskFull", "HighCPU"} {
+		if !fire(rule, alert, alert+" firing", time.Duration(i)*time.Minute) {
+			t.Fatalf("sendCorrelated() didn't send firing %d of %s", i+1, alert)
+		}
+	}
+	// A repeat after the window starts over
+	testBot.Store.Delete(correlateBucket, "alert/C1/DiskFull")
+	fire(rule, "DiskFull", "DiskFull firing again", 2*time.Hour)
+
+	sent := client.Sent()
+	got := []string{}
+	for _, m := range sent {
+		thread := ""
+		if len(m.ThreadID) > 0 {
+			thread = " (in thread of " + m.ThreadID + ")"
+		}
+		got = append(got, m.ChannelID+thread+": "+m.Output)
+	}
+	cpu := sent[0].ID
+	assertOutputs(t, "sendCorrelated()", got, []string{
+		"C1: HighCPU firing\n_Fired 3 times, last at May 1 14:03 UTC_",
+		"C1 (in thread of " + cpu + "): HighCPU firing",
+		"C1: DiskFull firing",
+		"C1 (in thread of " + cpu + "): HighCPU firing",
+		"C1: DiskFull firing again",
+	})
+	if edits := client.Edits(); len(edits) != 2 || edits[0].MessageID != cpu || edits[1].MessageID != cpu {
+		t.Errorf("sendCorrelated() edits = %+v", edits)
+	}
+}
+
+func TestCorrelationChannel(t *testing.T) {
+	tests := []struct {
+		name    string
+		message models.Message
+		want    string
+		wantOK  bool
+	}{
+		{"Channel of the trigger", models.Message{Type: models.MsgTypeChannel, ChannelID: "C1"}, "C1", true},
+		{"One room", models.Message{Type: models.MsgTypeChannel, ChannelID: "C1", OutputToRooms: []string{"C2"}}, "C2", true},
+		{"Several rooms", models.Message{Type: models.MsgTypeChannel, ChannelID: "C1", OutputToRooms: []string{"C2", "C3"}}, "", false},
+		{"Users", models.Message{Type: models.MsgTypeChannel, ChannelID: "C1", OutputToUsers: []string{"jane"}}, "", false},
+		{"Direct message", models.Message{Type: models.MsgTypeDirect, ChannelID: "D1"}, "", false},
+		{"Direct message only", models.Message{Type: models.MsgTypeChannel, ChannelID: "C1", DirectMessageOnly: true}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := correlationChannel(tt.message)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("correlationChannel() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// debounceBucket is the storage bucket recording which triggers of rules with 'debounce' ran lately,
+// so that replicas of the bot debounce together
+const debounceBucket = "debounced_triggers"
+
+// debounces are when rules with 'debounce' last ran for a trigger, by bot, for bots without replicas
+var (
+	debouncesMu sync.Mutex
+	debounces   = make(map[*models.Bot]map[string]time.Time)
+)
+
+// debounced determines whether a rule with 'debounce' already ran for the same trigger within its
+// window, in which case this trigger is dropped. Triggers are the same when they're in the same
+// channel and say the same, ignoring case and surrounding whitespace, e.g. a monitoring webhook
+// posting the same alert over and over. The first trigger runs, the ones within the window after it
+// don't.
+func debounced(rule models.Rule, message models.Message, bot *models.Bot) bool {
+	if len(rule.Debounce) == 0 {
+		return false
+	}
+	window, err := utils.ParseDuration(rule.Debounce)
+	if err != nil || window <= 0 {
+		bot.Log.Errorf("Invalid 'debounce' '%s' for rule '%s', not debouncing it", rule.Debounce, rule.Name)
+		return false
+	}
+	key := debounceKey(rule, message)
+
+	if bot.HighAvailability && bot.Store != nil {
+		claimed, err := bot.Store.Claim(debounceBucket, key, []byte(bot.InstanceID+"/"+message.ID), window)
+		if err != nil {
+			// Better to run twice than not at all
+			bot.Log.Errorf("Could not debounce rule '%s', running it anyway: %s", rule.Name, err.Error())
+			return false
+		}
+		return !claimed
+	}
+
+	debouncesMu.Lock()
+	defer debouncesMu.Unlock()
+	if debounces[bot] == nil {
+		debounces[bot] = make(map[string]time.Time)
+	}
+	now := time.Now()
+	// Forget the triggers whose window is over, so the map doesn't grow forever
+	for k, until := range debounces[bot] {
+		if !now.Before(until) {
+			delete(debounces[bot], k)
+		}
+	}
+	if _, ok := debounces[bot][key]; ok {
+		return true
+	}
+	debounces[bot][key] = now.Add(window)
+	return false
+}
+
+// debounceKey identifies the triggers of a rule that are debounced together
+func debounceKey(rule models.Rule, message models.Message) string {
+	input := strings.ToLower(strings.TrimSpace(message.Input))
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s", rule.Name, message.ChannelID, input)))
+	return fmt.Sprintf("%x", sum)
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestDebounced(t *testing.T) {
+	bot := &models.Bot{}
+	initLogger(bot)
+	rule := models.Rule{Name: "disk alert", Hear: "/disk full/", Debounce: "50ms"}
+
+	message := func(channel, input string) models.Message {
+		m := models.NewMessage()
+		m.ChannelID = channel
+		m.Input = input
+		return m
+	}
+
+	steps := []struct {
+		name    string
+		rule    models.Rule
+		message models.Message
+		want    bool
+	}{
+		{"First", rule, message("C1", "Disk full on db1"), false},
+		{"Identical", rule, message("C1", " disk full on DB1 "), true},
+		{"Other text", rule, message("C1", "Disk full on db2"), false},
+		{"Other channel", rule, message("C2", "Disk full on db1"), false},
+		{"No debounce", models.Rule{Name: "disk alert", Hear: "/disk full/"}, message("C1", "Disk full on db1"), false},
+	}
+	for _, tt := range steps {
+		if got := debounced(tt.rule, tt.message, bot); got != tt.want {
+			t.Errorf("%s: debounced() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if debounced(rule, message("C1", "Disk full on db1"), bot) {
+		t.Error("debounced() after the window = true, want false")
+	}
+}
+
+func TestDebouncedReplicas(t *testing.T) {
+	store := memory.New()
+	replica1 := &models.Bot{HighAvailability: true, InstanceID: "replica-1", Store: store}
+	replica2 := &models.Bot{HighAvailability: true, InstanceID: "replica-2", Store: store}
+	initLogger(replica1)
+	initLogger(replica2)
+	rule := models.Rule{Name: "disk alert", Hear: "/disk full/", Debounce: "1m"}
+	message := models.NewMessage()
+	message.ChannelID = "C1"
+	message.Input = "Disk full on db1"
+
+	if debounced(rule, message, replica1) {
+		t.Error("debounced() on the first replica = true, want false")
+	}
+	if !debounced(rule, message, replica2) {
+		t.Error("debounced() on the second replica = false, want true")
+	}
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+// claimedBucket is the storage bucket recording which instance of the bot handles a message
+const claimedBucket = "claimed_messages"
+
+// claimTTL is how long a message is remembered as handled; redeliveries after this are processed again
+const claimTTL = 10 * time.Minute
+
+// claimMessage makes sure that only one replica of the bot processes a message when several of them read it,
+// e.g. when every replica is connected to Slack RTM, or Slack retries an event against another replica.
+// It reports whether this instance should process the message.
+func claimMessage(message models.Message, bot *models.Bot) bool {
+	if !bot.HighAvailability {
+		return true
+	}
+	// Only messages read from chat have an identity of their own (the CLI is local and the Scheduler elects a leader)
+	if message.Service != models.MsgServiceChat || len(message.Timestamp) == 0 {
+		return true
+	}
+
+	// The claim value is unique per delivery, so even this instance won't process a redelivery twice
+	claimed, err := bot.Store.Claim(claimedBucket, messageKey(message), []byte(bot.InstanceID+"/"+message.ID), claimTTL)
+	if err != nil {
+		// Better to risk responding twice than not at all
+		bot.Log.Errorf("Could not claim message %s, processing it anyway: %s", message.ID, err.Error())
+		return true
+	}
+	if !claimed {
+		bot.Log.Debugf("Message %s is already handled by another instance", message.ID)
+	}
+	return claimed
+}
+
+// messageKey identifies a chat message independently of which replica read it
+func messageKey(message models.Message) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%d|%d|%s|%s|%s|%s", message.Service, message.Event, message.ChannelID, message.Timestamp, message.Vars["_user.id"], message.Input)))
+	return fmt.Sprintf("%x", sum)
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestClaimMessage(t *testing.T) {
+	store := memory.New()
+	replica1 := &models.Bot{HighAvailability: true, InstanceID: "replica-1", Store: store}
+	replica2 := &models.Bot{HighAvailability: true, InstanceID: "replica-2", Store: store}
+	standalone := &models.Bot{Store: memory.New()}
+
+	newChatMessage := func(ts string) models.Message {
+		msg := models.NewMessage()
+		msg.Service = models.MsgServiceChat
+		msg.ChannelID = "C123"
+		msg.Timestamp = ts
+		msg.Input = "hello"
+		return msg
+	}
+
+	// every replica reads the same message, e.g. over RTM
+	first := newChatMessage("1530000000.000100")
+	if !claimMessage(first, replica1) {
+		t.Error("claimMessage() = false, want the first replica to process the message")
+	}
+	if claimMessage(newChatMessage("1530000000.000100"), replica2) {
+		t.Error("claimMessage() = true, want the second replica to skip the message")
+	}
+	if claimMessage(newChatMessage("1530000000.000100"), replica1) {
+		t.Error("claimMessage() = true, want a redelivery to the same replica to be skipped")
+	}
+	if !claimMessage(newChatMessage("1530000000.000200"), replica2) {
+		t.Error("claimMessage() = false, want a different message to be processed")
+	}
+
+	// without high availability every message is processed
+	if !claimMessage(first, standalone) || !claimMessage(first, standalone) {
+		t.Error("claimMessage() = false, want every message processed without high availability")
+	}
+
+	// CLI messages are local and never deduplicated
+	cli := models.NewMessage()
+	cli.Service = models.MsgServiceCLI
+	if !claimMessage(cli, replica1) || !claimMessage(cli, replica2) {
+		t.Error("claimMessage() = false, want CLI messages processed")
+	}
+}
+
+func TestSharedQueue(t *testing.T) {
+	store := memory.New()
+	replica1 := &models.Bot{HighAvailability: true, SharedQueue: true, InstanceID: "replica-1", Store: store}
+	replica2 := &models.Bot{HighAvailability: true, SharedQueue: true, InstanceID: "replica-2", Store: store}
+	initLogger(replica1)
+	initLogger(replica2)
+
+	for _, input := range []string{"first", "second", "third"} {
+		msg := models.NewMessage()
+		msg.Service = models.MsgServiceChat
+		msg.Input = input
+		msg.Vars["_user.name"] = "joe"
+		if !publishMessage(msg, replica1) {
+			t.Fatalf("publishMessage(%q) = false", input)
+		}
+	}
+	cli := models.NewMessage()
+	cli.Service = models.MsgServiceCLI
+	if publishMessage(cli, replica1) {
+		t.Error("publishMessage() of a CLI message = true, want it processed where it's read")
+	}
+
+	// Replicas take what they have room for, the oldest messages first, and each message only once
+	taken := takeMessages(2, replica2)
+	if len(taken) != 2 || taken[0].Input != "first" || taken[1].Input != "second" || taken[0].Vars["_user.name"] != "joe" {
+		t.Fatalf("takeMessages(2) = %+v, want the first and second message", taken)
+	}
+	if taken[0].Run.Context() != pipelineOf(replica2).runs {
+		t.Error("takeMessages() didn't make the message part of the replica's runs")
+	}
+	if taken := takeMessages(0, replica1); len(taken) != 0 {
+		t.Errorf("takeMessages(0) = %+v, want none without room", taken)
+	}
+	if taken := takeMessages(5, replica1); len(taken) != 1 || taken[0].Input != "third" {
+		t.Errorf("takeMessages(5) = %+v, want only the third message", taken)
+	}
+	if taken := takeMessages(5, replica2); len(taken) != 0 {
+		t.Errorf("takeMessages() of an empty queue = %+v", taken)
+	}
+	if values, _ := store.List(sharedQueueBucket); len(values) != 0 {
+		t.Errorf("takeMessages() left %d messages in the queue", len(values))
+	}
+	if values, _ := store.List(sharedQueueIndexBucket); len(values) != 0 {
+		t.Errorf("takeMessages() left the index or its lock behind: %v", values)
+	}
+}
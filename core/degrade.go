@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nlopes/slack"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+)
+
+// degrade adapts a message to the features its remote lacks, so they're shown some other way instead
+// of going missing: attachments (e.g. with buttons) become text with numbered options, ephemeral
+// messages go to the user directly, files are named in the text, and replies go to the channel
+// rather than a thread. The rule's attachments go along with the first part of a message.
+func degrade(message *models.Message, rule models.Rule, first bool, caps remote.Capabilities) {
+	if !caps.Attachments {
+		attachments := message.Remotes.Slack.Attachments
+		if len(attachments) == 0 && first {
+			attachments = rule.Remotes.Slack.Attachments
+		}
+		if text := attachmentsText(attachments); len(text) > 0 {
+			message.Output = joinLines(message.Output, text)
+		}
+		message.Remotes.Slack.Attachments = nil
+	}
+	if !caps.Ephemeral && message.IsEphemeral {
+		message.IsEphemeral = false
+		if userID := message.Vars["_user.id"]; len(userID) > 0 && message.Type != models.MsgTypeDirect && len(message.OutputToUsers) == 0 {
+			message.OutputToUsers = []string{userID}
+		}
+	}
+	if !caps.Files && len(message.Files) > 0 {
+		for _, file := range message.Files {
+			message.Output = joinLines(message.Output, fmt.Sprintf("[file: %s (%d bytes)]", file.Name, len(file.Data)))
+		}
+		message.Files = nil
+	}
+	if !caps.Threads {
+		message.ThreadID = ""
+		message.ReplyToID = ""
+		message.StartThread = false
+	}
+}
+
+// attachmentsText writes attachments as text: their title, text, and fields, and their buttons and
+// menu options as numbered options
+func attachmentsText(attachments []slack.Attachment) string {
+	lines := []string{}
+	option := 0
+	for _, a := range attachments {
+		before := len(lines)
+		for _, line := range []string{a.Pretext, a.Title, a.Text} {
+			if len(line) > 0 {
+				lines = append(lines, line)
+			}
+		}
+		if len(a.TitleLink) > 0 {
+			lines = append(lines, a.TitleLink)
+		}
+		for _, field := range a.Fields {
+			lines = append(lines, field.Title+": "+field.Value)
+		}
+		for _, action := range a.Actions {
+			// Each option of a menu is an option of its own
+			choices := []string{}
+			for _, o := range action.Options {
+				choices = append(choices, o.Text)
+			}
+			if len(choices) == 0 {
+				text := action.Text
+				if len(action.URL) > 0 {
+					text += ": " + action.URL
+				}
+				choices = append(choices, text)
+			}
+			for _, choice := range choices {
+				option++
+				lines = append(lines, fmt.Sprintf("%d. %s", option, choice))
+			}
+		}
+		if len(lines) == before && len(a.Fallback) > 0 {
+			lines = append(lines, a.Fallback)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// joinLines appends a line to text
+func joinLines(text, line string) string {
+	if len(text) == 0 {
+		return line
+	}
+	return text + "\n" + line
+}
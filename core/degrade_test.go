@@ -0,0 +1,78 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nlopes/slack"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+)
+
+func TestDegrade(t *testing.T) {
+	approval := models.Rule{Remotes: models.Remotes{Slack: models.SlackConfig{Attachments: []slack.Attachment{{
+		Title:  "Deploy api v2?",
+		Fields: []slack.AttachmentField{{Title: "Env", Value: "prod"}},
+		Actions: []slack.AttachmentAction{
+			{Name: "approve", Text: "Approve", Type: "button"},
+			{Name: "region", Text: "Region", Type: "select", Options: []slack.AttachmentActionOption{{Text: "us-east"}, {Text: "eu-west"}}},
+			{Name: "docs", Text: "Docs", Type: "button", URL: "https://example.com/deploys"},
+		},
+	}}}}}
+
+	tests := []struct {
+		name    string
+		message models.Message
+		rule    models.Rule
+		first   bool
+		caps    remote.Capabilities
+		want    models.Message
+	}{
+		{
+			"Everything supported",
+			models.Message{Output: "Ready", ThreadID: "1554821760.000200", IsEphemeral: true},
+			approval, true, remote.Capabilities{Threads: true, Ephemeral: true, Attachments: true, Reactions: true, Files: true},
+			models.Message{Output: "Ready", ThreadID: "1554821760.000200", IsEphemeral: true},
+		},
+		{
+			"Buttons as numbered options",
+			models.Message{Output: "Ready"},
+			approval, true, remote.Capabilities{},
+			models.Message{Output: "Ready\nDeploy api v2?\nEnv: prod\n1. Approve\n2. us-east\n3. eu-west\n4. Docs: https://example.com/deploys"},
+		},
+		{
+			"Attachments only with the first part",
+			models.Message{Output: "...rest"},
+			approval, false, remote.Capabilities{},
+			models.Message{Output: "...rest"},
+		},
+		{
+			"Ephemeral to the user directly",
+			models.Message{Output: "Only for you", Type: models.MsgTypeChannel, IsEphemeral: true, Vars: map[string]string{"_user.id": "U123"}},
+			models.Rule{}, true, remote.Capabilities{},
+			models.Message{Output: "Only for you", Type: models.MsgTypeChannel, OutputToUsers: []string{"U123"}, Vars: map[string]string{"_user.id": "U123"}},
+		},
+		{
+			"Files named",
+			models.Message{Output: "Report", Files: []models.File{{Name: "report.csv", Data: []byte("a,b\n")}}},
+			models.Rule{}, true, remote.Capabilities{},
+			models.Message{Output: "Report\n[file: report.csv (4 bytes)]"},
+		},
+		{
+			"No threads",
+			models.Message{Output: "Done", ThreadID: "1554821760.000200", ReplyToID: "1554821760.000200", StartThread: true},
+			models.Rule{}, true, remote.Capabilities{},
+			models.Message{Output: "Done"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := tt.message
+			degrade(&message, tt.rule, tt.first, tt.caps)
+			if !reflect.DeepEqual(message, tt.want) {
+				t.Errorf("degrade() = %+v, want %+v", message, tt.want)
+			}
+		})
+	}
+}
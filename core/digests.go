@@ -0,0 +1,293 @@
+package core
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/robfig/cron"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/utils"
+)
+
+// Storage buckets of digests
+const (
+	digestItemsBucket  = "digest-items"  // the outputs collected for each digest, by digest name and when they were collected
+	digestClaimsBucket = "digest-claims" // which replica of the bot posts each digest
+)
+
+// digestInterval is how often digests are looked at, to post those that are due
+const digestInterval = 30 * time.Second
+
+// digestMaxItems is how many outputs, or groups, a digest lists when its 'max_items' is not set
+const digestMaxItems = 20
+
+// digestItemTTL is how long collected outputs are kept, should their digest never be posted
+const digestItemTTL = 7 * 24 * time.Hour
+
+// digestLineLength is how much of an output a digest shows, in characters
+const digestLineLength = 200
+
+// digestItem is the output of a rule collected for a digest
+type digestItem struct {
+	Rule   string    `json:"rule"`
+	Key    string    `json:"key,omitempty"` // the value of the digest's 'group_by'
+	Output string    `json:"output"`
+	Time   time.Time `json:"time"`
+}
+
+// digestGroup is the outputs of a digest with the same 'group_by' value
+type digestGroup struct {
+	key    string
+	count  int
+	latest digestItem
+}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "digest send", usage: "digest send <name>", description: "Post a digest right away", args: 1, admin: true, run: sendDigestCommand},
+	)
+}
+
+// Digests posts the digests configured in bot.yml on their schedule. Like standups, what they collect is
+// kept in the storage backend, and only one replica of the bot posts each of them.
+func Digests(outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	if len(bot.Digests) == 0 {
+		return
+	}
+	schedules := make([]cron.Schedule, len(bot.Digests))
+	for i, digest := range bot.Digests {
+		schedule, err := cron.Parse(digest.Schedule)
+		if err != nil {
+			bot.Log.Errorf("Invalid schedule '%s' of digest '%s', it's only posted with 'digest send': %s", digest.Schedule, digest.Name, err.Error())
+			continue
+		}
+		schedules[i] = schedule
+	}
+
+	since := time.Now()
+	ticker := time.NewTicker(digestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-remote.Stopping():
+			return
+		case now := <-ticker.C:
+			checkDigests(since, now, schedules, outputMsgs, hitRule, bot)
+			since = now
+		}
+	}
+}
+
+// checkDigests posts the digests due since the last check
+func checkDigests(since, now time.Time, schedules []cron.Schedule, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	for i, digest := range bot.Digests {
+		if i >= len(schedules) || schedules[i] == nil {
+			continue
+		}
+		if due := schedules[i].Next(since); !due.After(now) {
+			postDigest(digest, due, outputMsgs, hitRule, bot)
+		}
+	}
+}
+
+// addToDigest collects the output of a run of a rule with a 'digest' for its digest instead of sending
+// it, and reports whether it did. Outputs are sent as usual if the digest isn't configured, or can't
+// keep them.
+func addToDigest(rule models.Rule, message models.Message, now time.Time, bot *models.Bot) bool {
+	if len(rule.Digest) == 0 || len(strings.TrimSpace(message.Output)) == 0 {
+		return false
+	}
+	digest, ok := findDigest(rule.Digest, bot)
+	if !ok {
+		bot.Log.Warnf("Rule '%s' is for digest '%s', which isn't in bot.yml; sending its output", rule.Name, rule.Digest)
+		return false
+	}
+
+	item := digestItem{Rule: rule.Name, Output: message.Output, Time: now}
+	if len(digest.GroupBy) > 0 {
+		key, err := utils.Substitute(digest.GroupBy, message.Vars)
+		if err != nil {
+			bot.Log.Debugf("Could not group the output of rule '%s' in digest '%s': %s", rule.Name, digest.Name, err.Error())
+		}
+		item.Key = strings.TrimSpace(key)
+	}
+	value, err := json.Marshal(item)
+	if err == nil {
+		key := strings.ToLower(digest.Name) + "/" + strconv.FormatInt(now.UnixNano(), 10) + "/" + message.ID
+		err = bot.Store.Set(digestItemsBucket, key, value, digestItemTTL)
+	}
+	if err != nil {
+		bot.Log.Errorf("Could not add the output of rule '%s' to digest '%s', sending it: %s", rule.Name, digest.Name, err.Error())
+		return false
+	}
+	return true
+}
+
+// postDigest posts what a digest collected to its channel, unless it's empty. Posts due at the same
+// time are only made by one replica of the bot.
+func postDigest(digest models.Digest, due time.Time, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) bool {
+	name := strings.ToLower(digest.Name)
+	claimed, err := bot.Store.Claim(digestClaimsBucket, name+"@"+strconv.FormatInt(due.Unix(), 10), []byte(bot.InstanceID), time.Hour)
+	if err != nil || !claimed {
+		return false
+	}
+	items, err := takeDigestItems(name, bot)
+	if err != nil {
+		bot.Log.Errorf("Could not look up what digest '%s' collected: %s", digest.Name, err.Error())
+	}
+	if len(items) == 0 {
+		return false
+	}
+
+	message, ok := channelMessage(digest.Channel, "", bot)
+	if !ok {
+		bot.Log.Errorf("Could not find the channel '%s' of digest '%s'", digest.Channel, digest.Name)
+		return false
+	}
+	message.ChannelName = digest.Channel
+	message.Output = digestText(digest, items, message, bot)
+	sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+	bot.Log.Infof("Posted digest '%s' of %d output(s)", digest.Name, len(items))
+	return true
+}
+
+// digestText is the message a digest is posted as: how many outputs it collected since when, and either
+// the outputs or, with 'group_by', how many there are of each group and the latest of them
+func digestText(digest models.Digest, items []digestItem, message models.Message, bot *models.Bot) string {
+	// The digest's own locale goes before the channel's
+	if len(digest.Locale) > 0 {
+		message = models.NewMessage()
+		message.Vars["_user.locale"] = digest.Locale
+	}
+	location, err := time.LoadLocation(digest.Timezone)
+	if err != nil {
+		bot.Log.Warnf("Unknown timezone '%s' of digest '%s', using UTC", digest.Timezone, digest.Name)
+		location = time.UTC
+	}
+	max := digest.MaxItems
+	if max <= 0 {
+		max = digestMaxItems
+	}
+
+	lines := []string{translate(message, bot, "digests.header", "*${digest}* (${count} since ${since})", map[string]string{
+		"digest": digest.Name,
+		"count":  strconv.Itoa(len(items)),
+		"since":  items[0].Time.In(location).Format("Jan 2 15:04 MST"),
+	})}
+	listed := len(items)
+	if len(digest.GroupBy) == 0 {
+		for i, item := range items {
+			if i == max {
+				break
+			}
+			lines = append(lines, translate(message, bot, "digests.item", "• ${time} ${output}", map[string]string{
+				"time":   item.Time.In(location).Format("15:04"),
+				"output": digestLine(item.Output),
+			}))
+		}
+	} else {
+		groups := groupDigestItems(items)
+		listed = len(groups)
+		for i, group := range groups {
+			if i == max {
+				break
+			}
+			key := group.key
+			if len(key) == 0 {
+				key = translate(message, bot, "digests.ungrouped", "other", nil)
+			}
+			lines = append(lines, translate(message, bot, "digests.group", "• *${key}* ×${count}, last at ${time}: ${output}", map[string]string{
+				"key":    key,
+				"count":  strconv.Itoa(group.count),
+				"time":   group.latest.Time.In(location).Format("15:04"),
+				"output": digestLine(group.latest.Output),
+			}))
+		}
+	}
+	if listed > max {
+		lines = append(lines, translate(message, bot, "digests.more", "…and ${count} more", map[string]string{"count": strconv.Itoa(listed - max)}))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// groupDigestItems counts the outputs of a digest by their 'group_by' value, most frequent first
+func groupDigestItems(items []digestItem) []digestGroup {
+	groups := []digestGroup{}
+	index := make(map[string]int)
+	for _, item := range items {
+		i, ok := index[item.Key]
+		if !ok {
+			i = len(groups)
+			index[item.Key] = i
+			groups = append(groups, digestGroup{key: item.Key})
+		}
+		groups[i].count++
+		groups[i].latest = item
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].count > groups[j].count
+	})
+	return groups
+}
+
+// digestLine is how an output is shown in a digest: its first line, shortened if it's long
+func digestLine(output string) string {
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(output), "\n", 2)[0])
+	if utf8.RuneCountInString(line) > digestLineLength {
+		line = string([]rune(line)[:digestLineLength-1]) + "…"
+	}
+	return line
+}
+
+// takeDigestItems removes what a digest collected from the storage backend, and returns it oldest first
+func takeDigestItems(name string, bot *models.Bot) ([]digestItem, error) {
+	values, err := bot.Store.List(digestItemsBucket)
+	if err != nil {
+		return nil, err
+	}
+	items := []digestItem{}
+	for key, value := range values {
+		if !strings.HasPrefix(key, name+"/") {
+			continue
+		}
+		bot.Store.Delete(digestItemsBucket, key)
+		var item digestItem
+		if err := json.Unmarshal(value, &item); err != nil {
+			bot.Log.Warnf("Skipping an output of digest '%s' that can't be read: %s", name, err.Error())
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Time.Before(items[j].Time)
+	})
+	return items, nil
+}
+
+// findDigest finds a digest in bot.yml by name, regardless of case
+func findDigest(name string, bot *models.Bot) (models.Digest, bool) {
+	for _, digest := range bot.Digests {
+		if strings.EqualFold(digest.Name, name) {
+			return digest, true
+		}
+	}
+	return models.Digest{}, false
+}
+
+// sendDigestCommand posts the digest named by the first argument right away
+func sendDigestCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	digest, ok := findDigest(args[0], bot)
+	if !ok {
+		return translate(*message, bot, "digests.unknown", "There's no digest '${digest}'.", map[string]string{"digest": args[0]}), nil
+	}
+	if !postDigest(digest, time.Now(), outputMsgs, hitRule, bot) {
+		return translate(*message, bot, "digests.empty", "The ${digest} digest has nothing to post yet.", map[string]string{"digest": digest.Name}), nil
+	}
+	return translate(*message, bot, "digests.sent", "Okay, I posted the ${digest} digest.", map[string]string{"digest": digest.Name}), nil
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestDigests(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Rooms: map[string]string{"ops": "C1"}}
+	testBot.Digests = []models.Digest{
+		{Name: "alerts", Channel: "ops", Schedule: "0 0 * * * *", GroupBy: "${alert}", MaxItems: 2},
+		{Name: "deploys", Channel: "ops", Schedule: "0 0 9 * * *", Timezone: "America/Chicago"},
+	}
+	initLogger(testBot)
+
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+	sent := func() []string {
+		outputs := []string{}
+		for {
+			select {
+			case m := <-outputMsgs:
+				<-hitRule
+				outputs = append(outputs, m.OutputToRooms[0]+": "+m.Output)
+			default:
+				return outputs
+			}
+		}
+	}
+	now := time.Date(2019, 5, 1, 14, 0, 0, 0, time.UTC)
+	collect := func(digest, alert, output string, at time.Duration) bool {
+		message := models.NewMessage()
+		message.Vars["alert"] = alert
+		message.Output = output
+		return addToDigest(models.Rule{Name: "alert", Digest: digest}, message, now.Add(at), testBot)
+	}
+
+	if collect("", "HighCPU", "CPU at 95%", 0) || collect("unknown", "HighCPU", "CPU at 95%", 0) {
+		t.Errorf("addToDigest() collected an output of a rule without a configured digest")
+	}
+	collect("alerts", "HighCPU", "CPU at 95% on web-1", time.Minute)
+	collect("alerts", "DiskFull", "Disk full on db-1", 2*time.Minute)
+	collect("alerts", "HighCPU", "CPU at 97% on web-1\nfor 10 minutes", 3*time.Minute)
+	collect("alerts", "", "Something happened", 4*time.Minute)
+	collect("deploys", "", "api 1.2 deployed", 5*time.Minute)
+
+	alerts, _ := cron.Parse(testBot.Digests[0].Schedule)
+	deploys, _ := cron.Parse(testBot.Digests[1].Schedule)
+	schedules := []cron.Schedule{alerts, deploys}
+	checkDigests(now.Add(50*time.Minute), now.Add(61*time.Minute), schedules, outputMsgs, hitRule, testBot)
+	assertOutputs(t, "checkDigests()", sent(), []string{"C1: *alerts* (4 since May 1 14:01 UTC)\n• *HighCPU* ×2, last at 14:03: CPU at 97% on web-1\n• *DiskFull* ×1, last at 14:02: Disk full on db-1\n…and 1 more"})
+
+	// Empty digests aren't posted, and each is posted once
+	checkDigests(now.Add(110*time.Minute), now.Add(121*time.Minute), schedules, outputMsgs, hitRule, testBot)
+	checkDigests(now.Add(50*time.Minute), now.Add(61*time.Minute), schedules, outputMsgs, hitRule, testBot)
+	assertOutputs(t, "checkDigests()", sent(), []string{})
+
+	admin := models.NewMessage()
+	admin.Service = models.MsgServiceCLI
+	for _, tt := range []struct{ args, want string }{
+		{"deploys", "Okay, I posted the deploys digest."},
+		{"deploys", "The deploys digest has nothing to post yet."},
+		{"builds", "There's no digest 'builds'."},
+	} {
+		if got, err := sendDigestCommand([]string{tt.args}, &admin, outputMsgs, nil, hitRule, testBot); err != nil || got != tt.want {
+			t.Errorf("sendDigestCommand(%s) = %q, %v, want %q", tt.args, got, err, tt.want)
+		}
+	}
+	assertOutputs(t, "sendDigestCommand()", sent(), []string{"C1: *deploys* (1 since May 1 09:05 CDT)\n• 09:05 api 1.2 deployed"})
+}
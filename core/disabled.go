@@ -0,0 +1,205 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+// disabledBucket is the storage bucket of the rules disabled at runtime, by rule name in lower case
+const disabledBucket = "disabled-rules"
+
+// disabledRule is a rule an admin disabled at runtime, from chat or through the admin API
+type disabledRule struct {
+	Rule   string    `json:"rule"`
+	By     string    `json:"by"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+var (
+	// ruleChanges are the rules enabled or disabled from chat, by bot, until applyRuleChanges applies them
+	ruleChanges   = make(map[*models.Bot][]models.Rule)
+	ruleChangesMu sync.Mutex
+)
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "rule disable", usage: "rule disable <rule> [reason]", description: "Stop a rule from running, until it's enabled again", args: 1, admin: true, run: disableRuleCommand},
+		builtinCommand{trigger: "rule enable", usage: "rule enable <rule>", description: "Let a disabled rule run again", args: 1, admin: true, run: enableRuleCommand},
+	)
+}
+
+// disableRuleCommand disables the rule named by the first arguments; the rest of the arguments say why
+func disableRuleCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	rule, reason, ok := findRuleArgs(args, rules)
+	if !ok {
+		return translate(*message, bot, "rules.unknown", "I don't have a rule called '${rule}'.", map[string]string{"rule": args[0]}), nil
+	}
+	if inactiveInRuleFile(rule) {
+		return translate(*message, bot, "rules.inactive", "${rule} is set 'active: false' in its rule file, it can't be enabled or disabled from chat.", map[string]string{"rule": rule.Name}), nil
+	}
+	record := disabledRule{By: message.Vars["_user.name"], Reason: strings.Join(reason, " ")}
+	rule, err := queueRuleActive(rule.Name, false, record, rules, bot)
+	if err != nil {
+		return "", err
+	}
+	return translate(*message, bot, "rules.disabled", "Okay, ${rule} is disabled until someone runs 'rule enable ${rule}'.", map[string]string{"rule": rule.Name}), nil
+}
+
+// enableRuleCommand enables the rule named by the arguments
+func enableRuleCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	name := strings.Join(args, " ")
+	rule, rest, ok := findRuleArgs(args, rules)
+	if !ok || len(rest) > 0 {
+		return translate(*message, bot, "rules.unknown", "I don't have a rule called '${rule}'.", map[string]string{"rule": name}), nil
+	}
+	if inactiveInRuleFile(rule) {
+		return translate(*message, bot, "rules.inactive", "${rule} is set 'active: false' in its rule file, it can't be enabled or disabled from chat.", map[string]string{"rule": rule.Name}), nil
+	}
+	rule, err := queueRuleActive(rule.Name, true, disabledRule{}, rules, bot)
+	if err != nil {
+		return "", err
+	}
+	return translate(*message, bot, "rules.enabled", "Okay, ${rule} runs again.", map[string]string{"rule": rule.Name}), nil
+}
+
+// findRuleArgs finds the rule named by the first arguments, as many of them as make up the longest name
+// of a rule, regardless of case, and returns the arguments after it. Quoted names are a single argument.
+func findRuleArgs(args []string, rules map[string]models.Rule) (models.Rule, []string, bool) {
+	for n := len(args); n > 0; n-- {
+		name := strings.Join(args[:n], " ")
+		for _, rule := range rules {
+			if strings.EqualFold(rule.Name, name) {
+				return rule, args[n:], true
+			}
+		}
+	}
+	return models.Rule{}, nil, false
+}
+
+// inactiveInRuleFile reports whether a rule is off because its rule file says 'active: false', rather than
+// because it was disabled at runtime. Chat commands leave those to the rule file, or the admin API.
+func inactiveInRuleFile(rule models.Rule) bool {
+	return !rule.Active && !rule.Disabled
+}
+
+// setRuleActive enables or disables a rule by name, regardless of case, and keeps rules disabled in the
+// storage backend so they stay disabled. It must not be called while the rules are being matched, chat
+// commands use queueRuleActive instead.
+func setRuleActive(name string, active bool, record disabledRule, rules map[string]models.Rule, bot *models.Bot) (models.Rule, error) {
+	p := pipelineOf(bot)
+	p.rulesMu.Lock()
+	defer p.rulesMu.Unlock()
+	ruleFile, rule, err := recordRuleActive(name, active, record, rules, bot)
+	if err != nil {
+		return models.Rule{}, err
+	}
+	rules[ruleFile] = rule
+	return rule, nil
+}
+
+// queueRuleActive enables or disables a rule like setRuleActive, from a built-in command. The Matcher
+// holds the rules for reading while it runs the command, so the change is applied by applyRuleChanges
+// before the next message is matched.
+func queueRuleActive(name string, active bool, record disabledRule, rules map[string]models.Rule, bot *models.Bot) (models.Rule, error) {
+	_, rule, err := recordRuleActive(name, active, record, rules, bot)
+	if err != nil {
+		return models.Rule{}, err
+	}
+	ruleChangesMu.Lock()
+	defer ruleChangesMu.Unlock()
+	ruleChanges[bot] = append(ruleChanges[bot], rule)
+	return rule, nil
+}
+
+// applyRuleChanges applies the rules enabled or disabled from chat since the last message was matched
+func applyRuleChanges(rules map[string]models.Rule, bot *models.Bot) {
+	ruleChangesMu.Lock()
+	changes := ruleChanges[bot]
+	delete(ruleChanges, bot)
+	ruleChangesMu.Unlock()
+	if len(changes) == 0 {
+		return
+	}
+
+	p := pipelineOf(bot)
+	p.rulesMu.Lock()
+	defer p.rulesMu.Unlock()
+	for _, changed := range changes {
+		for ruleFile, rule := range rules {
+			if rule.Name == changed.Name {
+				rule.Active, rule.Disabled = changed.Active, changed.Disabled
+				rules[ruleFile] = rule
+			}
+		}
+	}
+}
+
+// recordRuleActive looks up a rule by name, regardless of case, and returns it enabled or disabled along
+// with its file, after keeping the change in the storage backend. The caller holds the rules for reading.
+func recordRuleActive(name string, active bool, record disabledRule, rules map[string]models.Rule, bot *models.Bot) (string, models.Rule, error) {
+	for ruleFile, rule := range rules {
+		if !strings.EqualFold(rule.Name, name) {
+			continue
+		}
+		if bot.Store != nil {
+			if err := saveDisabledRule(rule.Name, active, record, bot); err != nil {
+				return "", models.Rule{}, fmt.Errorf("Could not keep the state of rule '%s': %s", rule.Name, err.Error())
+			}
+		}
+		rule.Active = active
+		rule.Disabled = !active
+		if active {
+			bot.Log.Infof("Rule '%s' was enabled", rule.Name)
+		} else {
+			bot.Log.Warnf("Rule '%s' was disabled by %s: %s", rule.Name, record.By, record.Reason)
+		}
+		return ruleFile, rule, nil
+	}
+	return "", models.Rule{}, fmt.Errorf("Could not find a rule named '%s'", name)
+}
+
+// saveDisabledRule keeps a rule disabled in the storage backend, or removes it when it's enabled
+func saveDisabledRule(name string, active bool, record disabledRule, bot *models.Bot) error {
+	key := strings.ToLower(name)
+	if active {
+		return bot.Store.Delete(disabledBucket, key)
+	}
+	record.Rule = name
+	record.Time = time.Now()
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return bot.Store.Set(disabledBucket, key, value, 0)
+}
+
+// applyDisabledRules disables the rules kept disabled in the storage backend, and enables those that were
+// disabled at runtime and have been enabled since
+func applyDisabledRules(rules map[string]models.Rule, bot *models.Bot) {
+	if bot.Store == nil {
+		return
+	}
+	values, err := bot.Store.List(disabledBucket)
+	if err != nil {
+		bot.Log.Errorf("Could not look up the disabled rules, running them: %s", err.Error())
+		return
+	}
+	for ruleFile, rule := range rules {
+		_, disabled := values[strings.ToLower(rule.Name)]
+		switch {
+		case disabled && !inactiveInRuleFile(rule):
+			rule.Active, rule.Disabled = false, true
+		case rule.Disabled:
+			rule.Active, rule.Disabled = true, false
+		default:
+			continue
+		}
+		rules[ruleFile] = rule
+	}
+}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestDisableRule(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Admins: []string{"jane"}}
+	initLogger(testBot)
+	fresh := func() map[string]models.Rule {
+		return map[string]models.Rule{
+			"deploy.yml": {Name: "deploy", Active: true, Respond: "deploy", IncludeInHelp: true, Description: "Deploy an app"},
+			"status.yml": {Name: "status", Active: true, Respond: "status", IncludeInHelp: true},
+			"prod.yml":   {Name: "Deploy prod", Active: true, Respond: "deploy prod"},
+			"legacy.yml": {Name: "legacy", Respond: "legacy"},
+		}
+	}
+	rules := fresh()
+	admin := models.NewMessage()
+	admin.Vars["_user.name"] = "jane"
+
+	tests := []struct {
+		name       string
+		run        func(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error)
+		args       []string
+		want       string
+		wantActive bool
+	}{
+		{"Disable", disableRuleCommand, []string{"Deploy", "paging", "everyone"}, "Okay, deploy is disabled until someone runs 'rule enable deploy'.", false},
+		{"Unknown rule", disableRuleCommand, []string{"nope"}, "I don't have a rule called 'nope'.", false},
+		{"Unknown rule to enable", enableRuleCommand, []string{"deploy", "now"}, "I don't have a rule called 'deploy now'.", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.run(tt.args, &admin, nil, rules, nil, testBot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			applyRuleChanges(rules, testBot)
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+			}
+			if rules["deploy.yml"].Active != tt.wantActive {
+				t.Errorf("%s left deploy active = %v, want %v", tt.name, rules["deploy.yml"].Active, tt.wantActive)
+			}
+		})
+	}
+
+	entries := helpEntries("deploy an", admin, rules, testBot)
+	if len(entries) != 1 || entries[0].description != "Deploy an app (disabled for now)" {
+		t.Errorf("helpEntries() = %+v, want deploy shown as disabled", entries)
+	}
+
+	// The rule stays disabled when the rules are read again, e.g. after a restart
+	restarted := fresh()
+	applyDisabledRules(restarted, testBot)
+	if deploy := restarted["deploy.yml"]; deploy.Active || !deploy.Disabled || !restarted["status.yml"].Active {
+		t.Errorf("applyDisabledRules() = %+v, want only deploy disabled", restarted)
+	}
+
+	got, _ := enableRuleCommand([]string{"deploy"}, &admin, nil, rules, nil, testBot)
+	applyRuleChanges(rules, testBot)
+	if got != "Okay, deploy runs again." || !rules["deploy.yml"].Active {
+		t.Errorf("enableRuleCommand() = %q, active %v", got, rules["deploy.yml"].Active)
+	}
+	// Rules read while it was disabled, e.g. of the other rule set, run it again too
+	applyDisabledRules(restarted, testBot)
+	if deploy := restarted["deploy.yml"]; !deploy.Active || deploy.Disabled {
+		t.Errorf("applyDisabledRules() after enabling = %+v", deploy)
+	}
+	if entries := helpEntries("deploy an", admin, rules, testBot); len(entries) != 1 || strings.Contains(entries[0].description, "disabled") {
+		t.Errorf("helpEntries() after enabling = %+v", entries)
+	}
+
+	// Names of several words come before the reason, the longest name that matches
+	got, _ = disableRuleCommand([]string{"deploy", "PROD", "during", "the", "freeze"}, &admin, nil, rules, nil, testBot)
+	applyRuleChanges(rules, testBot)
+	if got != "Okay, Deploy prod is disabled until someone runs 'rule enable Deploy prod'." || rules["prod.yml"].Active || !rules["deploy.yml"].Active {
+		t.Errorf("disableRuleCommand() of a rule with spaces = %q, %+v", got, rules)
+	}
+	if value, _, _ := testBot.Store.Get(disabledBucket, "deploy prod"); !strings.Contains(string(value), `"reason":"during the freeze"`) {
+		t.Errorf("disableRuleCommand() kept %s, want the reason after the rule's name", value)
+	}
+	got, _ = enableRuleCommand([]string{"deploy", "prod"}, &admin, nil, rules, nil, testBot)
+	applyRuleChanges(rules, testBot)
+	if got != "Okay, Deploy prod runs again." || !rules["prod.yml"].Active {
+		t.Errorf("enableRuleCommand() of a rule with spaces = %q, active %v", got, rules["prod.yml"].Active)
+	}
+
+	// Rules turned off in their rule file stay off
+	for _, run := range []func(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error){enableRuleCommand, disableRuleCommand, enableRuleCommand} {
+		got, _ = run([]string{"legacy"}, &admin, nil, rules, nil, testBot)
+		applyRuleChanges(rules, testBot)
+		if got != "legacy is set 'active: false' in its rule file, it can't be enabled or disabled from chat." || rules["legacy.yml"].Active || rules["legacy.yml"].Disabled {
+			t.Errorf("Changing a rule with 'active: false' = %q, %+v", got, rules["legacy.yml"])
+		}
+	}
+}
+
+func TestDisableRuleFromChat(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Admins: []string{"jane"}}
+	initLogger(testBot)
+	rules := map[string]models.Rule{
+		"ping.yml":  {Name: "ping", Active: true, Respond: "ping", FormatOutput: "pong"},
+		"hello.yml": {Name: "hello", Active: true, Respond: "hello", FormatOutput: "hi"},
+	}
+	inputMsgs := make(chan models.Message, 10)
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+	go Matcher(inputMsgs, outputMsgs, rules, hitRule, testBot)
+
+	// The command runs while the Matcher holds the rules, the next messages must still be matched
+	for _, input := range []string{"rule disable ping", "ping", "hello"} {
+		message := models.NewMessage()
+		message.Service = models.MsgServiceChat
+		message.Type = models.MsgTypeDirect
+		message.Input = input
+		message.Vars["_user.name"] = "jane"
+		inputMsgs <- message
+	}
+	// 'ping' isn't answered by its rule anymore, but like any message the bot doesn't understand
+	want := []string{"Okay, ping is disabled until someone runs 'rule enable ping'.", "I understand these commands", "hi"}
+	for _, output := range want {
+		select {
+		case got := <-outputMsgs:
+			<-hitRule
+			if !strings.HasPrefix(got.Output, output) {
+				t.Errorf("Matcher() answered %q, want %q", got.Output, output)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Matcher() didn't answer %q", output)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// dryRunFlag in a message, e.g. 'deploy prod --dry-run', makes the destructive actions of the rule
+// it triggers say what they would do instead of doing it
+var dryRunFlag = regexp.MustCompile(`(^|\s)--dry-run(\s|$)`)
+
+// dryRunTypes are the types of actions that can be marked 'destructive'
+var dryRunTypes = map[string]bool{"get": true, "post": true, "put": true, "exec": true, "ssh": true}
+
+// readDryRun marks a message for a dry run with ${_dry_run}, either because the bot runs every rule
+// dry with 'dry_run' in bot.yml, or because the message asks for it. The flag is removed from the
+// message, so it doesn't count as an argument of the rule.
+func readDryRun(message *models.Message, bot *models.Bot) {
+	if message.Vars == nil {
+		message.Vars = make(map[string]string)
+	}
+	if (message.Service == models.MsgServiceChat || message.Service == models.MsgServiceCLI) && dryRunFlag.MatchString(message.Input) {
+		message.Input = strings.TrimSpace(dryRunFlag.ReplaceAllString(message.Input, " "))
+		message.Vars["_dry_run"] = "true"
+	}
+	if bot.DryRun {
+		message.Vars["_dry_run"] = "true"
+	}
+}
+
+// isDryRun tells whether an action must not run, because it's marked 'destructive' and the message is
+// handled in a dry run
+func isDryRun(action models.Action, message *models.Message) bool {
+	return action.Destructive && message.Vars["_dry_run"] == "true"
+}
+
+// dryRunAction stands in for a destructive exec, ssh, or HTTP action in a dry run. It adds the templated
+// command or request to ${_dry_run.actions}, which the bot shows with the rule's output, and leaves the
+// action's output empty, e.g. ${_exec_output}.
+func dryRunAction(action models.Action, msg *models.Message, bot *models.Bot) error {
+	var would string
+	switch strings.ToLower(action.Type) {
+	case "get", "post", "put":
+		url, err := utils.Substitute(action.URL, msg.Vars)
+		if err != nil {
+			return err
+		}
+		would = fmt.Sprintf("%s %s", strings.ToUpper(action.Type), url)
+		msg.Vars["_raw_http_output"] = ""
+	case "exec", "ssh":
+		cmd, err := utils.Substitute(action.Cmd, msg.Vars)
+		if err != nil {
+			return err
+		}
+		would = cmd
+		prefix := "_exec"
+		if strings.ToLower(action.Type) == "ssh" {
+			host, err := utils.Substitute(action.Host, msg.Vars)
+			if err != nil {
+				return err
+			}
+			if len(action.User) > 0 {
+				host = action.User + "@" + host
+			}
+			would = fmt.Sprintf("ssh %s %s", host, cmd)
+			prefix = "_ssh"
+		}
+		msg.Vars[prefix+"_output"] = ""
+		msg.Vars[prefix+"_status"] = "0"
+	default:
+		return fmt.Errorf("Action '%s' of type %s can't be run dry", action.Name, action.Type)
+	}
+
+	bot.Log.Infof("Dry run of action '%s': %s", action.Name, would)
+	line := fmt.Sprintf("%s: `%s`", action.Name, would)
+	if actions := msg.Vars["_dry_run.actions"]; len(actions) > 0 {
+		line = actions + "\n" + line
+	}
+	msg.Vars["_dry_run.actions"] = line
+	return nil
+}
+
+// dryRunOutput adds what the destructive actions of a rule would have done to its output
+func dryRunOutput(message *models.Message, bot *models.Bot) {
+	actions := message.Vars["_dry_run.actions"]
+	if len(actions) == 0 {
+		return
+	}
+	heading := translate(*message, bot, "dry_run.heading", "Dry run, nothing was changed. This is what would have run:", nil)
+	message.Output = strings.TrimSpace(heading + "\n" + actions + "\n\n" + message.Output)
+}
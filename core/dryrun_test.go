@@ -0,0 +1,120 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestReadDryRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		service   models.MessageService
+		botDryRun bool
+		wantInput string
+		wantDry   bool
+	}{
+		{"No flag", "deploy prod", models.MsgServiceChat, false, "deploy prod", false},
+		{"Flag at the end", "deploy prod --dry-run", models.MsgServiceChat, false, "deploy prod", true},
+		{"Flag in the middle", "deploy --dry-run prod", models.MsgServiceCLI, false, "deploy prod", true},
+		{"Part of a word", "deploy prod--dry-run", models.MsgServiceChat, false, "deploy prod--dry-run", false},
+		{"Scheduled", "deploy prod --dry-run", models.MsgServiceScheduler, false, "deploy prod --dry-run", false},
+		{"Bot runs dry", "deploy prod", models.MsgServiceChat, true, "deploy prod", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.Message{Input: tt.input, Service: tt.service}
+			readDryRun(&message, &models.Bot{DryRun: tt.botDryRun})
+			if message.Input != tt.wantInput {
+				t.Errorf("readDryRun() input = %q, want %q", message.Input, tt.wantInput)
+			}
+			if got := message.Vars["_dry_run"] == "true"; got != tt.wantDry {
+				t.Errorf("readDryRun() dry run = %v, want %v", got, tt.wantDry)
+			}
+		})
+	}
+}
+
+func TestDryRunAction(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  models.Action
+		want    string
+		wantErr bool
+	}{
+		{"Exec", models.Action{Name: "deploy", Type: "exec", Cmd: "./deploy.sh ${env}"}, "deploy: `./deploy.sh prod`", false},
+		{"SSH", models.Action{Name: "restart", Type: "ssh", Host: "${env}.example.com", User: "ops", Cmd: "systemctl restart api"}, "restart: `ssh ops@prod.example.com systemctl restart api`", false},
+		{"HTTP", models.Action{Name: "scale", Type: "POST", URL: "https://api.example.com/${env}/scale"}, "scale: `POST https://api.example.com/prod/scale`", false},
+		{"Undefined variable", models.Action{Name: "deploy", Type: "exec", Cmd: "./deploy.sh ${version}"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &models.Bot{}
+			initLogger(bot)
+			message := models.Message{Vars: map[string]string{"env": "prod"}}
+			err := dryRunAction(tt.action, &message, bot)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dryRunAction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := message.Vars["_dry_run.actions"]; got != tt.want {
+				t.Errorf("dryRunAction() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimulateDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flottbot-dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "rules"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "rules", "deploy.yml"), []byte(`
+name: deploy
+active: true
+respond: deploy
+args: [service]
+actions:
+  - name: check
+    type: exec
+    cmd: echo checked
+  - name: run deploy
+    type: exec
+    cmd: ./deploy.sh ${service}
+    destructive: true
+format_output: "${service}: ${_exec_output}"
+`), 0644)
+
+	tests := []struct {
+		name   string
+		text   string
+		dryRun bool
+		want   string
+	}{
+		{"Flag", "deploy api --dry-run", false, "Dry run, nothing was changed. This is what would have run:\nrun deploy: `./deploy.sh api`\n\napi:"},
+		{"Bot runs dry", "deploy api", true, "Dry run, nothing was changed. This is what would have run:\nrun deploy: `./deploy.sh api`\n\napi:"},
+		{"Not dry", "deploy api", false, "api: deployed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &models.Bot{Name: "bot", ConfigDir: dir, DryRun: tt.dryRun}
+			initLogger(bot)
+
+			// The fixtures stand in for the scripts when they do run
+			fixtures := []models.Fixture{{Action: "check", Body: "checked"}, {Action: "run deploy", Body: "deployed"}}
+			sent, err := Simulate(Simulation{Text: tt.text}, fixtures, 5*time.Second, bot)
+			if err != nil {
+				t.Fatalf("Simulate() error = %v", err)
+			}
+			if len(sent) != 1 || sent[0].Output != tt.want {
+				t.Errorf("Simulate() = %+v, want output %q", sent, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package core
+
+import (
+	"github.com/target/flottbot/handlers"
+	"github.com/target/flottbot/models"
+)
+
+// handleEmail handles 'email' actions
+func handleEmail(action models.Action, msg *models.Message, bot *models.Bot) error {
+	if err := handlers.SendEmail(action, msg, bot); err != nil {
+		msg.Error = translate(*msg, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
+		return err
+	}
+
+	bot.Log.Debugf("Successfully executed action '%s'", action.Name)
+	return nil
+}
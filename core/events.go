@@ -0,0 +1,42 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/target/flottbot/models"
+)
+
+// messageEvents are the events rules can be matched against with 'events'
+var messageEvents = map[string]models.MessageEvent{
+	"sent":    models.MsgEventSent,
+	"edited":  models.MsgEventEdited,
+	"deleted": models.MsgEventDeleted,
+	"joined":  models.MsgEventJoined,
+	"left":    models.MsgEventLeft,
+	// a user joined the workspace; the message is a direct message from them, so the bot can welcome them
+	"user_joined": models.MsgEventUserJoined,
+}
+
+// eventName is the name of a message's event, as rules get it in ${_event}
+func eventName(event models.MessageEvent) string {
+	for name, e := range messageEvents {
+		if e == event {
+			return name
+		}
+	}
+	return ""
+}
+
+// ruleEvent determines whether a rule is matched against messages of a message's event. Rules
+// without 'events' only see messages being sent, not edited or deleted.
+func ruleEvent(rule models.Rule, message models.Message) bool {
+	if len(rule.Events) == 0 {
+		return message.Event == models.MsgEventSent
+	}
+	for _, name := range rule.Events {
+		if event, ok := messageEvents[strings.ToLower(name)]; ok && event == message.Event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestRuleEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		event  models.MessageEvent
+		want   bool
+	}{
+		{"Sent", nil, models.MsgEventSent, true},
+		{"Edited, without events", nil, models.MsgEventEdited, false},
+		{"Edited", []string{"Edited", "deleted"}, models.MsgEventEdited, true},
+		{"Deleted", []string{"edited"}, models.MsgEventDeleted, false},
+		{"Sent, with events", []string{"edited"}, models.MsgEventSent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.Event = tt.event
+			if got := ruleEvent(models.Rule{Events: tt.events}, message); got != tt.want {
+				t.Errorf("ruleEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
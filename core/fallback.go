@@ -0,0 +1,123 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/target/flottbot/handlers"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote/mock"
+	"github.com/target/flottbot/remote/slack"
+)
+
+// userAway looks up a user of 'output_to_users' on the bot's chat application, and whether they're
+// away. Users are never away on chat applications that don't tell.
+func userAway(user string, bot *models.Bot) (string, bool, error) {
+	switch strings.ToLower(bot.ChatApplication) {
+	case "slack":
+		return (&slack.Client{Token: bot.SlackToken}).Away(user, bot)
+	case "mock":
+		if remoteMock, ok := mock.ForBot(bot); ok {
+			return remoteMock.Away(user, bot)
+		}
+	}
+	return user, false, nil
+}
+
+// deliverFallbacks also sends a message to the 'fallback' of its rule for each user of
+// 'output_to_users' who is away. The message is still sent to them, for when they're back.
+func deliverFallbacks(message models.Message, rule models.Rule, bot *models.Bot) {
+	if !rule.Fallback.Identity && len(rule.Fallback.Email) == 0 {
+		return
+	}
+	if message.Service != models.MsgServiceChat && message.Service != models.MsgServiceScheduler {
+		return
+	}
+	for _, user := range message.OutputToUsers {
+		userID, away, err := userAway(user, bot)
+		if err != nil {
+			bot.Log.Errorf("Could not tell whether %s is away: %s", user, err.Error())
+			continue
+		}
+		if !away {
+			continue
+		}
+		bot.Log.Infof("%s is away, sending message %s to the fallback of rule '%s'", user, message.ID, rule.Name)
+		if rule.Fallback.Identity {
+			fallbackToIdentity(userID, message, bot)
+		}
+		if len(rule.Fallback.Email) > 0 {
+			fallbackToEmail(user, message, rule, bot)
+		}
+	}
+}
+
+// fallbackToIdentity sends a message to the accounts a user has on the chat applications of the
+// other bots running in this process
+func fallbackToIdentity(userID string, message models.Message, bot *models.Bot) {
+	remote := messageRemote(message, bot)
+	identity, ok := findIdentity(remote+":"+userID, bot)
+	if !ok {
+		bot.Log.Warnf("Could not fall back to the other accounts of %s, they aren't linked to any", userID)
+		return
+	}
+	for _, account := range identityAccounts(identity, bot) {
+		parts := strings.SplitN(account, ":", 2)
+		if len(parts) != 2 || strings.EqualFold(parts[0], remote) {
+			continue
+		}
+		for _, other := range runningBots() {
+			if other.bot == bot || !strings.EqualFold(other.bot.ChatApplication, parts[0]) {
+				continue
+			}
+			out := models.NewMessage()
+			out.Type = models.MsgTypeDirect
+			out.Service = models.MsgServiceChat
+			out.OutputToUsers = []string{parts[1]}
+			out.TraceParent = message.TraceParent
+			out.Output = message.Output
+			bot.Log.Debugf("Sending message %s to %s through %s", message.ID, account, other.bot.Name)
+			sendOutput(other.outputMsgs, other.hitRule, out, models.Rule{}, bot)
+			break
+		}
+	}
+}
+
+// identityAccounts lists the accounts that belong to an identity
+func identityAccounts(identity string, bot *models.Bot) []string {
+	accounts := append([]string{}, bot.Identities[identity]...)
+	store := identityStore(bot)
+	if store == nil {
+		return accounts
+	}
+	linked, err := store.List(identityBucket)
+	if err != nil {
+		bot.Log.Errorf("Could not list the accounts of '%s': %s", identity, err.Error())
+		return accounts
+	}
+	for account, linkedIdentity := range linked {
+		if string(linkedIdentity) == identity {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts
+}
+
+// fallbackToEmail sends a message to the email address of a rule's fallback
+func fallbackToEmail(user string, message models.Message, rule models.Rule, bot *models.Bot) {
+	vars := make(map[string]string, len(message.Vars)+2)
+	for name, value := range message.Vars {
+		vars[name] = value
+	}
+	vars["user"] = user
+	// The output is passed as a variable, so it isn't searched for variables again
+	vars["_fallback.output"] = message.Output
+	email := models.Message{Vars: vars}
+	subject := rule.Fallback.Subject
+	if len(subject) == 0 {
+		subject = "Message from " + bot.Name
+	}
+	action := models.Action{Name: "fallback", Type: "email", To: []string{rule.Fallback.Email}, Subject: subject, Body: "${_fallback.output}"}
+	if err := handlers.SendEmail(action, &email, bot); err != nil {
+		bot.Log.Errorf("Could not email message %s to %s: %s", message.ID, user, err.Error())
+	}
+}
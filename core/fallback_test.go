@@ -0,0 +1,63 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote/mock"
+)
+
+func TestDeliverFallbacks(t *testing.T) {
+	bot := &models.Bot{Name: "pager", Identities: map[string][]string{"jane": {"mock:jane", "discord:D1"}}}
+	client := mock.New(bot)
+	discordBot := &models.Bot{Name: "pager-discord", ChatApplication: "discord"}
+	initLogger(bot)
+	initLogger(discordBot)
+	discordOut, discordHit := make(chan models.Message, 1), make(chan models.Rule, 1)
+	running.Lock()
+	saved := running.bots
+	running.bots = []runningBot{{bot: bot}, {bot: discordBot, outputMsgs: discordOut, hitRule: discordHit}}
+	running.Unlock()
+	defer func() {
+		running.Lock()
+		running.bots = saved
+		running.Unlock()
+	}()
+
+	message := models.NewMessage()
+	message.Service = models.MsgServiceScheduler
+	message.OutputToUsers = []string{"jane"}
+	message.Output = "The database is down"
+	rule := models.Rule{Name: "page", Fallback: models.Fallback{Identity: true}}
+
+	tests := []struct {
+		name string
+		away bool
+		rule models.Rule
+		want []string
+	}{
+		{"Here", false, rule, nil},
+		{"Away", true, rule, []string{"D1"}},
+		{"No fallback", true, models.Rule{Name: "page"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.SetAway("jane", tt.away)
+			deliverFallbacks(message, tt.rule, bot)
+			var got []string
+			select {
+			case out := <-discordOut:
+				<-discordHit
+				if out.Output != message.Output || out.Type != models.MsgTypeDirect {
+					t.Errorf("deliverFallbacks() sent %q as type %d", out.Output, out.Type)
+				}
+				got = out.OutputToUsers
+			default:
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deliverFallbacks() sent to %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
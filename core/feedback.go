@@ -0,0 +1,192 @@
+package core
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/robfig/cron"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+)
+
+// Storage buckets of feedback
+const (
+	feedbackBucket       = "feedback-answers"       // which rule sent each answer asking for feedback
+	feedbackVotesBucket  = "feedback-votes"         // who gave feedback on each answer
+	feedbackClaimsBucket = "feedback-report-claims" // which replica of the bot posts each report
+)
+
+// feedbackTTL is how long feedback can be given on an answer
+const feedbackTTL = 7 * 24 * time.Hour
+
+// feedbackSchedule is when the feedback report is posted, unless its 'schedule' says otherwise
+const feedbackSchedule = "0 0 9 * * MON"
+
+// feedbackInterval is how often the feedback report is looked at, to post it when it's due
+const feedbackInterval = 30 * time.Second
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "feedback", usage: "feedback <answer> <up|down>", description: "Tell whether an answer helped, like the buttons under answers do", args: 2, run: feedbackCommand},
+	)
+}
+
+// withFeedback adds buttons asking whether the answer helped to the attachments of a rule with
+// 'feedback'. Like the options of a prompt, clicking one sends the bot its value, here 'feedback
+// <answer> <up|down>'. Chat applications without buttons don't ask.
+func withFeedback(rule models.Rule, message models.Message, bot *models.Bot) models.Rule {
+	if !rule.Feedback || bot.Store == nil || len(strings.TrimSpace(message.Output)) == 0 {
+		return rule
+	}
+	if err := bot.Store.Set(feedbackBucket, message.ID, []byte(rule.Name), feedbackTTL); err != nil {
+		bot.Log.Errorf("Could not ask for feedback on the answer of rule '%s': %s", rule.Name, err.Error())
+		return rule
+	}
+	question := translate(message, bot, "feedback.question", "Was this helpful?", nil)
+	attachment := slack.Attachment{Text: question, Fallback: question, CallbackID: message.ID + "-feedback"}
+	for _, vote := range []struct{ value, key, text string }{
+		{"up", "feedback.up", "👍 Yes"},
+		{"down", "feedback.down", "👎 No"},
+	} {
+		attachment.Actions = append(attachment.Actions, slack.AttachmentAction{
+			Name:  "feedback_" + vote.value,
+			Text:  translate(message, bot, vote.key, vote.text, nil),
+			Type:  "button",
+			Value: "feedback " + message.ID + " " + vote.value,
+		})
+	}
+	// The rule's own attachments are shared with every message it sends
+	attachments := append([]slack.Attachment{}, rule.Remotes.Slack.Attachments...)
+	rule.Remotes.Slack.Attachments = append(attachments, attachment)
+	return rule
+}
+
+// feedbackCommand records whether the answer given as first argument helped the sender of the
+// message, by the second argument, 'up' or 'down'. Each user's first feedback on an answer counts.
+func feedbackCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	answer, vote := args[0], strings.ToLower(args[1])
+	if vote != "up" && vote != "down" {
+		return translate(*message, bot, "feedback.usage", "Tell me 'up' if the answer helped, or 'down' if it didn't.", nil), nil
+	}
+	rule, ok, err := bot.Store.Get(feedbackBucket, answer)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return translate(*message, bot, "feedback.unknown", "I can't take feedback on that answer anymore.", nil), nil
+	}
+	// The vote is claimed with the ID of this message, so voting again, even the same way, isn't counted
+	claimed, err := bot.Store.Claim(feedbackVotesBucket, answer+"/"+message.Vars["_user.id"], []byte(message.ID), feedbackTTL)
+	if err != nil {
+		return "", err
+	}
+	if !claimed {
+		return translate(*message, bot, "feedback.again", "You already told me about that answer, thanks!", nil), nil
+	}
+	updateDayStats(string(rule), time.Now(), bot, func(day *dayStats) {
+		if vote == "up" {
+			day.Helpful++
+		} else {
+			day.Unhelpful++
+		}
+	})
+	return translate(*message, bot, "feedback.thanks", "Thanks for the feedback!", nil), nil
+}
+
+// FeedbackReports posts a summary of the feedback on the rules' answers with 'feedback_report' in
+// bot.yml, weekly by default. Only one replica of the bot posts each report.
+func FeedbackReports(outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	if len(bot.FeedbackReport.Channel) == 0 {
+		return
+	}
+	schedule, err := cron.Parse(feedbackReportSchedule(bot.FeedbackReport))
+	if err != nil {
+		bot.Log.Errorf("Invalid schedule '%s' of the feedback report: %s", bot.FeedbackReport.Schedule, err.Error())
+		return
+	}
+
+	since := time.Now()
+	ticker := time.NewTicker(feedbackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-remote.Stopping():
+			return
+		case now := <-ticker.C:
+			if due := schedule.Next(since); !due.After(now) {
+				postFeedbackReport(due, outputMsgs, hitRule, bot)
+			}
+			since = now
+		}
+	}
+}
+
+// postFeedbackReport posts the feedback report due at a time, unless there was no feedback
+func postFeedbackReport(due time.Time, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) bool {
+	claimed, err := bot.Store.Claim(feedbackClaimsBucket, strconv.FormatInt(due.Unix(), 10), []byte(bot.InstanceID), time.Hour)
+	if err != nil || !claimed {
+		return false
+	}
+	days := bot.FeedbackReport.Days
+	if days <= 0 {
+		days = statsDays
+	}
+	stats, err := usageStats(days, due, nil, bot)
+	if err != nil {
+		bot.Log.Errorf("Could not look up the feedback on answers: %s", err.Error())
+		return false
+	}
+
+	message, ok := channelMessage(bot.FeedbackReport.Channel, "", bot)
+	if !ok {
+		bot.Log.Errorf("Could not find the channel '%s' of the feedback report", bot.FeedbackReport.Channel)
+		return false
+	}
+	message.ChannelName = bot.FeedbackReport.Channel
+	message.Output = feedbackText(stats, days, message, bot)
+	if len(message.Output) == 0 {
+		return false
+	}
+	sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+	return true
+}
+
+// feedbackText is the feedback report: how many people found the answers of each rule helpful, the
+// rules with the most feedback first, or nothing if there was no feedback
+func feedbackText(stats []ruleStats, days int, message models.Message, bot *models.Bot) string {
+	rated := []ruleStats{}
+	for _, s := range stats {
+		if s.Helpful+s.Unhelpful > 0 {
+			rated = append(rated, s)
+		}
+	}
+	if len(rated) == 0 {
+		return ""
+	}
+	sort.SliceStable(rated, func(i, j int) bool {
+		return rated[i].Helpful+rated[i].Unhelpful > rated[j].Helpful+rated[j].Unhelpful
+	})
+
+	lines := []string{translate(message, bot, "feedback.header", "*Feedback on my answers in the last ${days} days*", map[string]string{"days": strconv.Itoa(days)})}
+	for _, s := range rated {
+		lines = append(lines, translate(message, bot, "feedback.rule", "• ${rule}: ${helpful}% helpful (${up} 👍, ${down} 👎)", map[string]string{
+			"rule":    s.Rule,
+			"helpful": strconv.Itoa(s.Helpful * 100 / (s.Helpful + s.Unhelpful)),
+			"up":      strconv.Itoa(s.Helpful),
+			"down":    strconv.Itoa(s.Unhelpful),
+		}))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// feedbackReportSchedule is when the feedback report is posted
+func feedbackReportSchedule(report models.FeedbackReport) string {
+	if len(report.Schedule) == 0 {
+		return feedbackSchedule
+	}
+	return report.Schedule
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestWithFeedback(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New()}
+	initLogger(testBot)
+	message := models.NewMessage()
+	message.Output = "Why did the gopher cross the road?"
+
+	own := []slack.Attachment{{Text: "punchline"}}
+	tests := []struct {
+		name   string
+		rule   models.Rule
+		output string
+		want   int
+	}{
+		{"Rule without feedback", models.Rule{Name: "joke"}, message.Output, 0},
+		{"Rule with feedback", models.Rule{Name: "joke", Feedback: true}, message.Output, 1},
+		{"Empty answer", models.Rule{Name: "joke", Feedback: true}, " ", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Remotes.Slack.Attachments = own
+			msg := message
+			msg.Output = tt.output
+			rule := withFeedback(tt.rule, msg, testBot)
+			if got := len(rule.Remotes.Slack.Attachments) - len(own); got != tt.want {
+				t.Fatalf("withFeedback() added %d attachment(s), want %d", got, tt.want)
+			}
+			if tt.want == 0 {
+				return
+			}
+			actions := rule.Remotes.Slack.Attachments[1].Actions
+			if len(actions) != 2 || actions[0].Value != "feedback "+message.ID+" up" || actions[1].Value != "feedback "+message.ID+" down" {
+				t.Errorf("withFeedback() buttons = %+v", actions)
+			}
+			if len(own) != 1 {
+				t.Errorf("withFeedback() changed the rule's own attachments")
+			}
+			if rule, _, _ := testBot.Store.Get(feedbackBucket, message.ID); string(rule) != "joke" {
+				t.Errorf("withFeedback() remembered rule %q, want joke", rule)
+			}
+		})
+	}
+}
+
+func TestFeedbackCommand(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New()}
+	initLogger(testBot)
+	testBot.Store.Set(feedbackBucket, "answer1", []byte("joke"), feedbackTTL)
+
+	vote := func(user, answer, value string) string {
+		message := models.NewMessage()
+		message.Vars["_user.id"] = user
+		output, err := feedbackCommand([]string{answer, value}, &message, nil, nil, nil, testBot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return output
+	}
+	tests := []struct {
+		name   string
+		user   string
+		answer string
+		value  string
+		want   string
+	}{
+		{"Helpful", "jane", "answer1", "up", "Thanks"},
+		{"Voting again", "jane", "answer1", "down", "already"},
+		{"Someone else", "joe", "answer1", "down", "Thanks"},
+		{"Unknown vote", "mallory", "answer1", "meh", "'up'"},
+		{"Expired answer", "jane", "answer0", "up", "anymore"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := vote(tt.user, tt.answer, tt.value); !strings.Contains(got, tt.want) {
+				t.Errorf("feedbackCommand() = %q, want %q in it", got, tt.want)
+			}
+		})
+	}
+
+	stats, err := usageStats(7, time.Now(), nil, testBot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Helpful != 1 || stats[0].Unhelpful != 1 {
+		t.Fatalf("usageStats() = %+v, want one helpful and one unhelpful vote on joke", stats)
+	}
+	want := "*Feedback on my answers in the last 7 days*\n• joke: 50% helpful (1 👍, 1 👎)"
+	if got := feedbackText(stats, 7, models.NewMessage(), testBot); got != want {
+		t.Errorf("feedbackText() = %q, want %q", got, want)
+	}
+	if got := feedbackText([]ruleStats{{Rule: "joke", Runs: 3}}, 7, models.NewMessage(), testBot); got != "" {
+		t.Errorf("feedbackText() without feedback = %q, want nothing", got)
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"encoding/json"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/target/flottbot/models"
+)
+
+// receivedFile is a file shared with the bot, as rules get it in ${_files}
+type receivedFile struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url"`
+}
+
+// receiveFiles makes the files shared along with a message available to rules: the first one as
+// ${_file.name}, ${_file.content_type}, and ${_file.url}, and all of them as a JSON list in ${_files}.
+// They're taken off the message, so replying to it doesn't send them back.
+func receiveFiles(message *models.Message, bot *models.Bot) {
+	if len(message.Files) == 0 {
+		return
+	}
+	files := make([]receivedFile, len(message.Files))
+	for i, file := range message.Files {
+		files[i] = receivedFile{Name: file.Name, ContentType: file.ContentType, URL: file.URL}
+	}
+	data, err := json.Marshal(files)
+	if err != nil {
+		bot.Log.Errorf("Could not pass the files of message %s to rules: %s", message.ID, err.Error())
+		return
+	}
+	message.Vars["_files"] = string(data)
+	message.Vars["_file.count"] = strconv.Itoa(len(files))
+	setFileVars(files[0], message)
+	message.Files = nil
+}
+
+// setFileVars sets ${_file.name}, ${_file.content_type}, and ${_file.url} to a file's
+func setFileVars(file receivedFile, message *models.Message) {
+	message.Vars["_file.name"] = file.Name
+	message.Vars["_file.content_type"] = file.ContentType
+	message.Vars["_file.url"] = file.URL
+}
+
+// receivedFiles are the files shared along with a message
+func receivedFiles(message models.Message) []receivedFile {
+	files := []receivedFile{}
+	if data := message.Vars["_files"]; len(data) > 0 {
+		json.Unmarshal([]byte(data), &files)
+	}
+	return files
+}
+
+// matchFile finds the first file shared along with a message whose name matches one of the patterns
+// of a rule's 'files', e.g. '*.csv'
+func matchFile(patterns []string, message models.Message) (receivedFile, bool) {
+	for _, file := range receivedFiles(message) {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(file.Name)); ok {
+				return file, true
+			}
+		}
+	}
+	return receivedFile{}, false
+}
+
+// linkFiles links the files of a message the bot doesn't have the contents of in its output, since
+// chat applications can only upload files with contents
+func linkFiles(message *models.Message) {
+	var files []models.File
+	for _, file := range message.Files {
+		if len(file.Data) > 0 || len(file.URL) == 0 {
+			files = append(files, file)
+			continue
+		}
+		if len(message.Output) > 0 {
+			message.Output += "\n"
+		}
+		message.Output += file.Name + ": " + file.URL
+	}
+	message.Files = files
+}
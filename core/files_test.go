@@ -0,0 +1,84 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestReceiveFiles(t *testing.T) {
+	bot := &models.Bot{}
+	initLogger(bot)
+	message := models.NewMessage()
+	message.Files = []models.File{
+		{Name: "notes.txt", ContentType: "text/plain", URL: "https://files.example.com/notes.txt"},
+		{Name: "Users.CSV", ContentType: "text/csv", URL: "https://files.example.com/users.csv"},
+	}
+	receiveFiles(&message, bot)
+
+	if len(message.Files) > 0 {
+		t.Errorf("receiveFiles() left files %+v on the message", message.Files)
+	}
+	want := map[string]string{
+		"_file.count":        "2",
+		"_file.name":         "notes.txt",
+		"_file.content_type": "text/plain",
+		"_file.url":          "https://files.example.com/notes.txt",
+	}
+	for name, value := range want {
+		if message.Vars[name] != value {
+			t.Errorf("receiveFiles() set ${%s} = %q, want %q", name, message.Vars[name], value)
+		}
+	}
+	if got := receivedFiles(message); len(got) != 2 || got[1].Name != "Users.CSV" {
+		t.Errorf("receivedFiles() = %+v", got)
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     string
+	}{
+		{"Extension", []string{"*.csv"}, "Users.CSV"},
+		{"First match", []string{"*.csv", "*"}, "notes.txt"},
+		{"No match", []string{"*.pdf"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, ok := matchFile(tt.patterns, message)
+			if ok != (len(tt.want) > 0) || file.Name != tt.want {
+				t.Errorf("matchFile() = %+v, %t, want %q", file, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkFiles(t *testing.T) {
+	chart := models.File{Name: "chart.png", ContentType: "image/png", Data: []byte("png")}
+	tests := []struct {
+		name       string
+		output     string
+		files      []models.File
+		wantOutput string
+		wantFiles  []models.File
+	}{
+		{"Contents", "Here you go", []models.File{chart}, "Here you go", []models.File{chart}},
+		{"URL", "Here you go", []models.File{chart, {Name: "report.pdf", URL: "https://files.example.com/report.pdf"}}, "Here you go\nreport.pdf: https://files.example.com/report.pdf", []models.File{chart}},
+		{"Only a URL", "", []models.File{{Name: "report.pdf", URL: "https://files.example.com/report.pdf"}}, "report.pdf: https://files.example.com/report.pdf", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.Output = tt.output
+			message.Files = tt.files
+			linkFiles(&message)
+			if message.Output != tt.wantOutput {
+				t.Errorf("linkFiles() output = %q, want %q", message.Output, tt.wantOutput)
+			}
+			if !reflect.DeepEqual(message.Files, tt.wantFiles) {
+				t.Errorf("linkFiles() files = %+v, want %+v", message.Files, tt.wantFiles)
+			}
+		})
+	}
+}
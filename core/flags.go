@@ -0,0 +1,219 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/target/flottbot/models"
+)
+
+// parseFlags takes the flags a rule declares out of the arguments given to it, and checks them and fills
+// in their defaults. What's left are the rule's positional args; everything after '--' is one, even if
+// it starts with a dash.
+func parseFlags(rule models.Rule, args []string) ([]string, map[string]string, error) {
+	positional := []string{}
+	given := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		flag, value, hasValue, ok := findFlag(rule.Flags, arg)
+		if !ok {
+			// Anything else starting with a dash, like -5, is an arg
+			if strings.HasPrefix(arg, "--") || (len(arg) == 2 && arg[0] == '-' && !isDigit(arg[1])) {
+				return nil, nil, fmt.Errorf("Unknown flag '%s'", arg)
+			}
+			positional = append(positional, arg)
+			continue
+		}
+		if !hasValue {
+			if isBoolFlag(flag) {
+				value = "true"
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			} else {
+				return nil, nil, fmt.Errorf("Flag '--%s' needs a value", flag.Name)
+			}
+		}
+		given[flag.Name] = value
+	}
+
+	flags := make(map[string]string, len(rule.Flags))
+	for _, flag := range rule.Flags {
+		value, ok := given[flag.Name]
+		if !ok {
+			if flag.Required {
+				return nil, nil, fmt.Errorf("Flag '--%s' is required", flag.Name)
+			}
+			value = flag.Default
+			if len(value) == 0 && isBoolFlag(flag) {
+				value = "false"
+			}
+		}
+		if len(value) == 0 {
+			flags[flag.Name] = ""
+			continue
+		}
+		typed, err := coerceVar(models.Variable{Name: flag.Name, Type: flag.Type}, value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Flag '--%s' must be of type '%s', but is '%s'", flag.Name, flagType(flag), value)
+		}
+		flags[flag.Name] = typed
+	}
+	return positional, flags, nil
+}
+
+// findFlag finds the flag an argument gives, as --name, --name=value, -s, or -s=value
+func findFlag(flags []models.Flag, arg string) (models.Flag, string, bool, bool) {
+	if !strings.HasPrefix(arg, "-") {
+		return models.Flag{}, "", false, false
+	}
+	name, value := arg, ""
+	hasValue := false
+	if i := strings.Index(arg, "="); i > 0 {
+		name, value, hasValue = arg[:i], arg[i+1:], true
+	}
+	for _, flag := range flags {
+		if name == "--"+flag.Name || (len(flag.Short) > 0 && name == "-"+flag.Short) {
+			return flag, value, hasValue, true
+		}
+	}
+	return models.Flag{}, "", false, false
+}
+
+// isBoolFlag determines whether a flag is given without a value, like --force
+func isBoolFlag(flag models.Flag) bool {
+	return strings.EqualFold(flag.Type, "bool")
+}
+
+// flagType is the type of a flag's value, 'string' if it's not declared
+func flagType(flag models.Flag) string {
+	if len(flag.Type) == 0 {
+		return "string"
+	}
+	return strings.ToLower(flag.Type)
+}
+
+// isDigit determines whether a byte is a decimal digit
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// checkArgTypes checks the values given to the args of a rule that are declared with a type in 'vars'
+func checkArgTypes(rule models.Rule, message models.Message) error {
+	isArg := make(map[string]bool, len(rule.Args))
+	for _, arg := range rule.Args {
+		isArg[arg] = true
+	}
+	for _, v := range rule.Vars {
+		value := message.Vars[v.Name]
+		if len(value) == 0 || !isArg[v.Name] {
+			continue
+		}
+		if _, err := coerceVar(v, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ruleUsage is how a rule is run, shown when the arguments it's given don't fit: its 'help_text', or one
+// made from its trigger, args, and flags, followed by what its flags are for
+func ruleUsage(rule models.Rule) string {
+	usage := rule.HelpText
+	if len(usage) == 0 {
+		parts := []string{}
+		if len(rule.Respond) > 0 && !isRegexTrigger(rule.Respond) {
+			parts = append(parts, rule.Respond)
+		}
+		required := requiredArgs(rule)
+		for i, arg := range rule.Args {
+			if i < required {
+				parts = append(parts, "<"+arg+">")
+			} else {
+				parts = append(parts, "["+arg+"]")
+			}
+		}
+		for _, flag := range rule.Flags {
+			synopsis := "--" + flag.Name
+			if !isBoolFlag(flag) {
+				synopsis += " <" + flagType(flag) + ">"
+			}
+			if !flag.Required {
+				synopsis = "[" + synopsis + "]"
+			}
+			parts = append(parts, synopsis)
+		}
+		usage = strings.Join(parts, " ")
+	}
+
+	names := make([]string, len(rule.Flags))
+	width := 0
+	for i, flag := range rule.Flags {
+		names[i] = "--" + flag.Name
+		if len(flag.Short) > 0 {
+			names[i] += ", -" + flag.Short
+		}
+		if len(names[i]) > width {
+			width = len(names[i])
+		}
+	}
+	lines := []string{usage}
+	for i, flag := range rule.Flags {
+		description := flag.Description
+		if len(flag.Default) > 0 {
+			description = strings.TrimSpace(fmt.Sprintf("%s (default: %s)", description, flag.Default))
+		}
+		lines = append(lines, strings.TrimRight(fmt.Sprintf("  %-*s  %s", width, names[i], description), " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validateFlags checks the flags a rule declares
+func validateFlags(rule models.Rule) []string {
+	problems := []string{}
+	if len(rule.Flags) > 0 && len(rule.Respond) == 0 {
+		problems = append(problems, "Only 'respond' rules can have 'flags'")
+	}
+	names := make(map[string]bool, len(rule.Args)+len(rule.Flags))
+	for _, arg := range rule.Args {
+		names[arg] = true
+	}
+	shorts := make(map[string]bool, len(rule.Flags))
+	for i, flag := range rule.Flags {
+		switch {
+		case len(flag.Name) == 0:
+			problems = append(problems, fmt.Sprintf("Flag %d has no name", i+1))
+			continue
+		case strings.HasPrefix(flag.Name, "-") || strings.ContainsAny(flag.Name, " ="):
+			problems = append(problems, fmt.Sprintf("Invalid flag name '%s', leave out the dashes", flag.Name))
+		case flag.Name == "dry-run":
+			problems = append(problems, "Flag '--dry-run' is taken, it makes any rule show what its destructive actions would do")
+		case names[flag.Name]:
+			problems = append(problems, fmt.Sprintf("Flag '--%s' has the same name as another flag or an arg", flag.Name))
+		}
+		names[flag.Name] = true
+		if len(flag.Short) > 0 {
+			if len(flag.Short) != 1 || isDigit(flag.Short[0]) || flag.Short == "-" {
+				problems = append(problems, fmt.Sprintf("Invalid short name '%s' of flag '--%s', use a single letter", flag.Short, flag.Name))
+			} else if shorts[flag.Short] {
+				problems = append(problems, fmt.Sprintf("Flag '--%s' has the same short name as another flag", flag.Name))
+			}
+			shorts[flag.Short] = true
+		}
+		if variableTypes[flagType(flag)] == nil {
+			problems = append(problems, fmt.Sprintf("Flag '--%s' has unknown type '%s', use 'string', 'int', 'number', 'bool', 'duration', or 'json'", flag.Name, flag.Type))
+		} else if len(flag.Default) > 0 {
+			if _, err := coerceVar(models.Variable{Name: flag.Name, Type: flag.Type}, flag.Default); err != nil {
+				problems = append(problems, fmt.Sprintf("Default of flag '--%s' must be of type '%s', but is '%s'", flag.Name, flagType(flag), flag.Default))
+			}
+		}
+		if flag.Required && isBoolFlag(flag) {
+			problems = append(problems, fmt.Sprintf("Flag '--%s' is a 'bool', which can't be required", flag.Name))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestParseFlags(t *testing.T) {
+	rule := models.Rule{Name: "deploy", Respond: "deploy", Args: []string{"service"}, Flags: []models.Flag{
+		{Name: "env", Short: "e", Default: "staging"},
+		{Name: "replicas", Type: "int"},
+		{Name: "force", Short: "f", Type: "bool"},
+	}}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantArgs []string
+		want     map[string]string
+		wantErr  string
+	}{
+		{"Defaults", []string{"api"}, []string{"api"}, map[string]string{"env": "staging", "replicas": "", "force": "false"}, ""},
+		{"Flags with values", []string{"--env", "prod", "api", "--replicas=3"}, []string{"api"}, map[string]string{"env": "prod", "replicas": "3", "force": "false"}, ""},
+		{"Short flags", []string{"-f", "-e=prod", "api"}, []string{"api"}, map[string]string{"env": "prod", "replicas": "", "force": "true"}, ""},
+		{"Bool with a value", []string{"api", "--force=no"}, []string{"api"}, map[string]string{"env": "staging", "replicas": "", "force": "false"}, ""},
+		{"Negative number", []string{"-5"}, []string{"-5"}, map[string]string{"env": "staging", "replicas": "", "force": "false"}, ""},
+		{"After --", []string{"--", "--env"}, []string{"--env"}, map[string]string{"env": "staging", "replicas": "", "force": "false"}, ""},
+		{"Unknown flag", []string{"api", "--region", "us"}, nil, nil, "Unknown flag '--region'"},
+		{"Unknown short flag", []string{"api", "-x"}, nil, nil, "Unknown flag '-x'"},
+		{"Missing value", []string{"api", "--env"}, nil, nil, "Flag '--env' needs a value"},
+		{"Wrong type", []string{"api", "--replicas", "many"}, nil, nil, "Flag '--replicas' must be of type 'int', but is 'many'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, flags, err := parseFlags(rule, tt.args)
+			if err != nil || len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parseFlags() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) || !reflect.DeepEqual(flags, tt.want) {
+				t.Errorf("parseFlags() = %q, %q, want %q, %q", args, flags, tt.wantArgs, tt.want)
+			}
+		})
+	}
+
+	required := models.Rule{Name: "scale", Respond: "scale", Flags: []models.Flag{{Name: "replicas", Required: true}}}
+	if _, _, err := parseFlags(required, nil); err == nil || err.Error() != "Flag '--replicas' is required" {
+		t.Errorf("parseFlags() error = %v, want the flag to be required", err)
+	}
+}
+
+func TestRuleUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		rule models.Rule
+		want string
+	}{
+		{"Help text", models.Rule{Respond: "deploy", HelpText: "deploy <service>", Args: []string{"service"}}, "deploy <service>"},
+		{"Generated", models.Rule{Respond: "deploy", Args: []string{"service", "version"}, Vars: []models.Variable{{Name: "version", Default: "latest"}}}, "deploy <service> [version]"},
+		{"Regular expression", models.Rule{Respond: "/^roll (.*)/", Args: []string{"dice"}}, "<dice>"},
+		{"Flags", models.Rule{Respond: "deploy", Args: []string{"service"}, Flags: []models.Flag{
+			{Name: "env", Short: "e", Default: "staging", Description: "Where to deploy"},
+			{Name: "replicas", Type: "int", Required: true},
+			{Name: "force", Type: "bool", Description: "Skip the checks"},
+		}}, "deploy <service> [--env <string>] --replicas <int> [--force]\n  --env, -e   Where to deploy (default: staging)\n  --replicas\n  --force     Skip the checks"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ruleUsage(tt.rule); got != tt.want {
+				t.Errorf("ruleUsage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagsInRules(t *testing.T) {
+	testBot := &models.Bot{Name: "Testbot"}
+	initLogger(testBot)
+	rule := models.Rule{Name: "scale", Active: true, Respond: "scale", Args: []string{"service", "replicas"}, FormatOutput: "${service} ${replicas} ${env}",
+		Vars:  []models.Variable{{Name: "replicas", Type: "int"}},
+		Flags: []models.Flag{{Name: "env", Default: "staging"}},
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"Valid", "scale api 3 --env prod", "api 3 prod"},
+		{"Unknown flag", "scale api 3 --zone b", "Unknown flag '--zone'. This is what I'm looking for\n```scale <service> <replicas> [--env <string>]\n  --env  (default: staging)```"},
+		{"Wrong arg type", "scale api three", "Variable 'replicas' must be of type 'int', but is 'three'. This is what I'm looking for\n```scale <service> <replicas> [--env <string>]\n  --env  (default: staging)```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.Service = models.MsgServiceChat
+			message.Type = models.MsgTypeDirect
+			message.Input = tt.input
+			outputMsgs := make(chan models.Message, 1)
+			hitRule := make(chan models.Rule, 1)
+			matcherLoop(message, outputMsgs, map[string]models.Rule{"scale.yml": rule}, hitRule, testBot)
+			got := <-outputMsgs
+			<-hitRule
+			if got.Output != tt.want {
+				t.Errorf("output = %q, want %q", got.Output, tt.want)
+			}
+		})
+	}
+}
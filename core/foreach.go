@@ -0,0 +1,126 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/target/flottbot/audit"
+	"github.com/target/flottbot/jsonpath"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
+	"github.com/target/flottbot/utils"
+)
+
+// forEachLimit is the most items a 'for_each' goes through, so that a long list doesn't flood the chat
+const forEachLimit = 100
+
+// forEachItems fills in a 'for_each' value and splits it into items: the elements of a JSON array,
+// e.g. a list extracted from a response, or else its non-empty lines, e.g. what a script printed
+func forEachItems(value string, vars map[string]string, bot *models.Bot) ([]interface{}, error) {
+	value, err := utils.Substitute(value, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []interface{}{}
+	if trimmed := strings.TrimSpace(value); strings.HasPrefix(trimmed, "[") {
+		decoder := json.NewDecoder(bytes.NewReader([]byte(trimmed)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&items); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, line := range strings.Split(value, "\n") {
+			if len(strings.TrimSpace(line)) > 0 {
+				items = append(items, strings.TrimRight(line, "\r"))
+			}
+		}
+	}
+
+	if len(items) > forEachLimit {
+		bot.Log.Warnf("Only going through the first %d of %d items", forEachLimit, len(items))
+		items = items[:forEachLimit]
+	}
+	return items, nil
+}
+
+// setItemVars makes an item available as ${_item}, its fields as ${_item.<field>} when it's a
+// JSON object, and its position, from 1, as ${_index}
+func setItemVars(item interface{}, index int, vars map[string]string) {
+	clearItemVars(vars)
+	vars["_item"], _ = jsonpath.String([]interface{}{item})
+	vars["_index"] = strconv.Itoa(index + 1)
+	if fields, ok := item.(map[string]interface{}); ok {
+		for name, field := range fields {
+			vars["_item."+name], _ = jsonpath.String([]interface{}{field})
+		}
+	}
+}
+
+// clearItemVars removes the variables of the item last gone through
+func clearItemVars(vars map[string]string) {
+	delete(vars, "_item")
+	delete(vars, "_index")
+	for name := range vars {
+		if strings.HasPrefix(name, "_item.") {
+			delete(vars, name)
+		}
+	}
+}
+
+// runActionForEach runs an action with 'for_each' once for every item, e.g. a request per server,
+// or a message per alert. Its 'when', 'run_if', and 'skip_if' are checked for every item, so they can
+// pick items. It stops at the first run that aborts the rule.
+func runActionForEach(action models.Action, message *models.Message, outputMsgs chan<- models.Message, rule models.Rule, hitRule chan<- models.Rule, span *tracing.Span, bot *models.Bot) audit.ActionResult {
+	result := audit.ActionResult{Name: action.Name, Type: action.Type, Skipped: true}
+
+	items, err := forEachItems(action.ForEach, message.Vars, bot)
+	if err != nil {
+		bot.Log.Errorf("Could not get the items of action '%s': %s", action.Name, err.Error())
+		result.Error = utils.Redact(err.Error())
+		result.Skipped = false
+		return result
+	}
+	defer clearItemVars(message.Vars)
+
+	each := action
+	each.ForEach = ""
+	for i, item := range items {
+		setItemVars(item, i, message.Vars)
+		r := runAction(each, message, outputMsgs, rule, hitRule, span, bot)
+		result.DurationMS += r.DurationMS
+		result.Skipped = result.Skipped && r.Skipped
+		if len(result.Error) == 0 {
+			result.Error = r.Error
+		}
+		if r.Aborted {
+			result.Aborted = true
+			break
+		}
+	}
+	return result
+}
+
+// formatItems renders a rule's 'format_item' for every item of its 'for_each', one line each,
+// making them available to 'format_output' as ${_items}
+func formatItems(rule models.Rule, msg *models.Message, bot *models.Bot) error {
+	items, err := forEachItems(rule.ForEach, msg.Vars, bot)
+	if err != nil {
+		return err
+	}
+	defer clearItemVars(msg.Vars)
+
+	lines := make([]string, 0, len(items))
+	for i, item := range items {
+		setItemVars(item, i, msg.Vars)
+		line, err := utils.Substitute(rule.FormatItem, msg.Vars)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, line)
+	}
+	msg.Vars["_items"] = strings.Join(lines, "\n")
+	return nil
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
+)
+
+func TestForEachItems(t *testing.T) {
+	bot := &models.Bot{}
+	initLogger(bot)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"JSON array", `["web1", "web2"]`, []string{"web1", "web2"}, false},
+		{"JSON objects", `[{"name": "web1", "up": true}]`, []string{`{"name":"web1","up":true}`}, false},
+		{"Lines", "web1\n\nweb2\r\n", []string{"web1", "web2"}, false},
+		{"Empty", "", []string{}, false},
+		{"Bad JSON", `["web1"`, nil, true},
+		{"Limit", "[" + strings.Repeat("1,", forEachLimit+10) + "1]", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := forEachItems("${list}", map[string]string{"list": tt.value}, bot)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("forEachItems() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.name == "Limit" {
+				if len(items) != forEachLimit {
+					t.Errorf("forEachItems() got %d items, want %d", len(items), forEachLimit)
+				}
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			vars := map[string]string{}
+			got := []string{}
+			for i, item := range items {
+				setItemVars(item, i, vars)
+				got = append(got, vars["_item"])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("forEachItems() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatItems(t *testing.T) {
+	bot := &models.Bot{}
+	initLogger(bot)
+	rule := models.Rule{
+		Name:       "servers",
+		ForEach:    "${servers}",
+		FormatItem: "${_index}. ${_item.name}: ${_item.status}",
+	}
+
+	msg := models.NewMessage()
+	msg.Vars["servers"] = `[{"name": "web1", "status": "up"}, {"name": "web2", "status": "down", "load": 0.5}]`
+	if err := formatItems(rule, &msg, bot); err != nil {
+		t.Fatalf("formatItems() error = %v", err)
+	}
+	if want := "1. web1: up\n2. web2: down"; msg.Vars["_items"] != want {
+		t.Errorf("formatItems() ${_items} = %q, want %q", msg.Vars["_items"], want)
+	}
+	for _, name := range []string{"_item", "_index", "_item.name", "_item.load"} {
+		if _, ok := msg.Vars[name]; ok {
+			t.Errorf("formatItems() left ${%s} behind", name)
+		}
+	}
+
+	// Without 'format_output', the items are the output
+	output, err := craftResponse(rule, msg, bot)
+	if err != nil || output != "1. web1: up\n2. web2: down" {
+		t.Errorf("craftResponse() = %q, %v", output, err)
+	}
+}
+
+func TestRunActionForEach(t *testing.T) {
+	bot := &models.Bot{}
+	initLogger(bot)
+	action := models.Action{
+		Name:    "report",
+		Type:    "log",
+		ForEach: "${servers}",
+		When:    "${_item.status} != 'up'",
+		Message: "${_item.name} is ${_item.status}",
+	}
+
+	msg := models.NewMessage()
+	msg.Vars["servers"] = `[{"name": "web1", "status": "up"}, {"name": "web2", "status": "down"}, {"name": "web3", "status": "unknown"}]`
+	outputMsgs := make(chan models.Message, 5)
+	hitRule := make(chan models.Rule, 5)
+	result := runAction(action, &msg, outputMsgs, models.Rule{Name: "servers"}, hitRule, tracing.Start("", "test"), bot)
+	if len(result.Error) > 0 || result.Skipped {
+		t.Errorf("runAction() = %+v", result)
+	}
+
+	close(outputMsgs)
+	got := []string{}
+	for output := range outputMsgs {
+		got = append(got, output.Output)
+	}
+	if want := []string{"web2 is down", "web3 is unknown"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("runAction() sent %q, want %q", got, want)
+	}
+	if _, ok := msg.Vars["_item"]; ok {
+		t.Error("runAction() left ${_item} behind")
+	}
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/render"
+	"github.com/target/flottbot/utils"
+)
+
+var fileNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// validateFormat makes sure a rule's 'format' fields make sense when the rule is loaded
+func validateFormat(rule models.Rule) error {
+	switch strings.ToLower(rule.Format) {
+	case "":
+		return nil
+	case "table", "csv":
+	case "chart":
+		if len(rule.ChartLabel) == 0 || len(rule.ChartValue) == 0 {
+			return fmt.Errorf("'format: chart' needs 'chart_label' and 'chart_value' columns")
+		}
+	default:
+		return fmt.Errorf("Unknown 'format: %s', use 'table', 'csv', or 'chart'", rule.Format)
+	}
+	if len(rule.FormatData) == 0 {
+		return fmt.Errorf("'format: %s' needs 'format_data', e.g. '${_sql_rows}'", rule.Format)
+	}
+	return nil
+}
+
+// applyFormat shows the results of a rule's actions the way its 'format' says: 'table' adds them to the
+// output as an aligned table in a code block, 'csv' attaches them as a CSV file, and 'chart' as a bar
+// chart of the 'chart_value' column per 'chart_label'. Results are a JSON array of objects, from 'format_data'.
+func applyFormat(rule models.Rule, message *models.Message, bot *models.Bot) {
+	if len(rule.Format) == 0 || len(message.Error) > 0 {
+		return
+	}
+	if err := formatResults(rule, message); err != nil {
+		bot.Log.Errorf("Could not format the results of rule '%s': %s", rule.Name, err.Error())
+		message.Output = strings.TrimSpace(fmt.Sprintf("%s\n(the results could not be shown: %s)", message.Output, err.Error()))
+	}
+}
+
+// formatResults does the work of applyFormat
+func formatResults(rule models.Rule, message *models.Message) error {
+	data, err := utils.Substitute(rule.FormatData, message.Vars)
+	if err != nil {
+		return err
+	}
+	rows, err := render.Rows(data)
+	if err != nil {
+		return err
+	}
+	columns := rule.FormatColumns
+	if len(columns) == 0 {
+		columns = render.Columns(rows)
+	}
+	name := strings.Trim(fileNameUnsafe.ReplaceAllString(rule.Name, "-"), "-")
+	if len(name) == 0 {
+		name = "results"
+	}
+
+	switch strings.ToLower(rule.Format) {
+	case "table":
+		table := "(no results)"
+		if len(columns) > 0 {
+			table = render.Table(columns, rows)
+		}
+		message.Output = strings.TrimLeft(message.Output+"\n```\n"+table+"\n```", "\n")
+	case "csv":
+		csv, err := render.CSV(columns, rows)
+		if err != nil {
+			return err
+		}
+		message.Files = append(message.Files, models.File{Name: name + ".csv", ContentType: "text/csv", Data: csv})
+	case "chart":
+		labels := make([]string, len(rows))
+		values := make([]float64, len(rows))
+		for i, row := range rows {
+			labels[i] = render.Value(row[rule.ChartLabel])
+			value := render.Value(row[rule.ChartValue])
+			values[i], err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("'%s' of row %d is not a number: '%s'", rule.ChartValue, i+1, value)
+			}
+		}
+		chart, err := render.BarChart(rule.ChartValue, labels, values)
+		if err != nil {
+			return err
+		}
+		message.Files = append(message.Files, models.File{Name: name + ".png", ContentType: "image/png", Data: chart})
+	default:
+		return fmt.Errorf("Unknown 'format: %s'", rule.Format)
+	}
+	return nil
+}
+
+// markdownDialects are the Markdown dialects of the chat applications, for rules with 'markdown: true'
+var markdownDialects = map[string]string{
+	"slack":   render.DialectSlack,
+	"discord": render.DialectDiscord,
+	"cli":     render.DialectPlain,
+}
+
+// convertMarkdown converts the output of a rule with 'markdown: true' from Markdown to the syntax of
+// the chat application it's sent to, e.g. [text](url) links to <url|text> for Slack
+func convertMarkdown(message *models.Message, rule models.Rule, bot *models.Bot) {
+	if !rule.Markdown {
+		return
+	}
+	if dialect, ok := markdownDialects[messageRemote(*message, bot)]; ok {
+		message.Output = render.Markdown(message.Output, dialect)
+	}
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestApplyFormat(t *testing.T) {
+	rows := `[{"service":"api","replicas":3},{"service":"web","replicas":12}]`
+	tests := []struct {
+		name       string
+		rule       models.Rule
+		error      string
+		wantOutput string
+		wantFile   string
+	}{
+		{"No format", models.Rule{}, "", "Services:", ""},
+		{"Table", models.Rule{Format: "table", FormatData: "${rows}", FormatColumns: []string{"service", "replicas"}}, "",
+			"Services:\n```\nservice | replicas\n--------+---------\napi     | 3\nweb     | 12\n```", ""},
+		{"CSV", models.Rule{Name: "service replicas", Format: "csv", FormatData: "${rows}"}, "", "Services:", "service-replicas.csv"},
+		{"Chart", models.Rule{Name: "replicas", Format: "chart", FormatData: "${rows}", ChartLabel: "service", ChartValue: "replicas"}, "", "Services:", "replicas.png"},
+		{"Chart of text", models.Rule{Name: "replicas", Format: "chart", FormatData: "${rows}", ChartLabel: "replicas", ChartValue: "service"}, "",
+			"Services:\n(the results could not be shown: 'service' of row 1 is not a number: 'api')", ""},
+		{"Not JSON", models.Rule{Format: "table", FormatData: "${_exec_output}"}, "",
+			"Services:\n(the results could not be shown: Could not parse rows: invalid character 'o' in literal null (expecting 'u'))", ""},
+		{"Action failed", models.Rule{Format: "csv", FormatData: "${rows}"}, "Something broke", "Services:", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := models.NewMessage()
+			msg.Vars["rows"] = rows
+			msg.Vars["_exec_output"] = "nope"
+			msg.Output = "Services:"
+			msg.Error = tt.error
+
+			applyFormat(tt.rule, &msg, new(models.Bot))
+			if msg.Output != tt.wantOutput {
+				t.Errorf("applyFormat() output = %q, want %q", msg.Output, tt.wantOutput)
+			}
+			if len(tt.wantFile) == 0 {
+				if len(msg.Files) > 0 {
+					t.Errorf("applyFormat() files = %d, want none", len(msg.Files))
+				}
+				return
+			}
+			if len(msg.Files) != 1 || msg.Files[0].Name != tt.wantFile {
+				t.Fatalf("applyFormat() files = %+v, want %s", msg.Files, tt.wantFile)
+			}
+			switch msg.Files[0].ContentType {
+			case "text/csv":
+				if !strings.HasPrefix(string(msg.Files[0].Data), "replicas,service\n3,api\n") {
+					t.Errorf("applyFormat() CSV = %q", msg.Files[0].Data)
+				}
+			case "image/png":
+				if _, err := png.Decode(bytes.NewReader(msg.Files[0].Data)); err != nil {
+					t.Errorf("applyFormat() chart is not a PNG: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    models.Rule
+		wantErr bool
+	}{
+		{"No format", models.Rule{}, false},
+		{"Table", models.Rule{Format: "table", FormatData: "${_sql_rows}"}, false},
+		{"Missing data", models.Rule{Format: "csv"}, true},
+		{"Chart", models.Rule{Format: "chart", FormatData: "${_sql_rows}", ChartLabel: "name", ChartValue: "count"}, false},
+		{"Chart without columns", models.Rule{Format: "chart", FormatData: "${_sql_rows}"}, true},
+		{"Unknown format", models.Rule{Format: "pie", FormatData: "${_sql_rows}"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateFormat(tt.rule); (err != nil) != tt.wantErr {
+				t.Errorf("validateFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConvertMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown bool
+		chatApp  string
+		service  models.MessageService
+		want     string
+	}{
+		{"Slack", true, "slack", models.MsgServiceChat, "*up*, see <https://l.example.com|logs>"},
+		{"Discord", true, "discord", models.MsgServiceChat, "**up**, see logs (https://l.example.com)"},
+		{"CLI", true, "slack", models.MsgServiceCLI, "up, see logs (https://l.example.com)"},
+		{"Not markdown", false, "slack", models.MsgServiceChat, "**up**, see [logs](https://l.example.com)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.Service = tt.service
+			message.Output = "**up**, see [logs](https://l.example.com)"
+			convertMarkdown(&message, models.Rule{Markdown: tt.markdown}, &models.Bot{ChatApplication: tt.chatApp})
+			if message.Output != tt.want {
+				t.Errorf("convertMarkdown() = %q, want %q", message.Output, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"bytes"
+	"path/filepath"
+	"strconv"
+
+	"github.com/target/flottbot/handlers"
+	"github.com/target/flottbot/models"
+)
+
+// handleGrafana handles 'grafana' actions, attaching the rendered panel to the rule's output,
+// or saving it as an artifact when the action sets 'artifact'. The link to the panel is
+// available as ${_grafana_url}.
+func handleGrafana(action models.Action, msg *models.Message, bot *models.Bot) error {
+	image, link, err := handlers.GrafanaRender(withHTTPDefaults(action, bot), msg, bot)
+	if err != nil {
+		msg.Error = translate(*msg, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
+		return err
+	}
+	msg.Vars["_grafana_url"] = link
+
+	if len(action.Artifact) > 0 {
+		path, size, err := handlers.SaveArtifact(image.Name, bytes.NewReader(image.Data), msg)
+		if err != nil {
+			return err
+		}
+		msg.Vars["_artifact.path"] = path
+		msg.Vars["_artifact.name"] = filepath.Base(path)
+		msg.Vars["_artifact.size"] = strconv.FormatInt(size, 10)
+	} else {
+		msg.Files = append(msg.Files, image)
+	}
+
+	bot.Log.Debugf("Successfully executed action '%s'", action.Name)
+	return nil
+}
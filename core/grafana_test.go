@@ -0,0 +1,40 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
+)
+
+func TestHandleGrafana(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("\x89PNG\r\n\x1a\nimage"))
+	}))
+	defer ts.Close()
+	bot := &models.Bot{GrafanaURL: ts.URL}
+
+	// Images rendered by concurrent actions end up with the rule's output too
+	rule := models.Rule{
+		Name:            "graphs",
+		ParallelActions: true,
+		Actions: []models.Action{
+			{Name: "cpu", Type: "grafana", Dashboard: "svc", Panel: 1},
+			{Name: "memory", Type: "grafana", Dashboard: "svc", Panel: 2},
+			{Name: "announce", Type: "message", Message: "Graphs for svc", DependsOn: []string{"cpu", "memory"}},
+		},
+	}
+	outputMsgs := make(chan models.Message, 1)
+	hitRule := make(chan models.Rule, 1)
+	msg := models.NewMessage()
+	runActionGraph(&msg, outputMsgs, &rule, hitRule, tracing.Start("", "rule"), bot)
+
+	if len(msg.Files) != 2 || msg.Vars["_grafana_url"] == "" {
+		t.Errorf("runActionGraph() files = %d, _grafana_url = %q", len(msg.Files), msg.Vars["_grafana_url"])
+	}
+	if announced := <-outputMsgs; len(announced.Files) > 0 {
+		t.Errorf("message action sent %d files, want none", len(announced.Files))
+	}
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+)
+
+// rulesLoaded is set once the rules have been read, so the bot can't be ready before
+var rulesLoaded int32
+
+// readyStates are the states of a remote in which it reads (or can send) messages
+var readyStates = map[string]bool{
+	"connected": true, // e.g. Slack RTM, Discord gateway
+	"listening": true, // e.g. Slack Events API
+	"reading":   true, // CLI
+	"running":   true, // scheduler
+	"standby":   true, // scheduler, another replica runs schedules
+	"idle":      true, // scheduler without schedule-type rules
+}
+
+// remoteHealth is the health of a remote reported by the health probes
+type remoteHealth struct {
+	Ready  bool      `json:"ready"`
+	State  string    `json:"state"`
+	Detail string    `json:"detail,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// healthReport is the body of the health probes' responses
+type healthReport struct {
+	Status      string                  `json:"status"`
+	RulesLoaded bool                    `json:"rules_loaded"`
+	Stopping    bool                    `json:"stopping"`
+	Remotes     map[string]remoteHealth `json:"remotes"`
+}
+
+// configureHealth sets the address of the health probes server
+func configureHealth(bot *models.Bot) {
+	if bot.Health && len(bot.HealthAddress) == 0 {
+		bot.HealthAddress = ":8082"
+	}
+}
+
+// Health serves liveness and readiness probes, e.g. for Kubernetes, at /healthz and /readyz.
+// Both report the state of every remote the bot runs; the readiness probe fails until the rules
+// are loaded and all remotes are connected, and again once the bot starts shutting down.
+func Health(bot *models.Bot) {
+	if !bot.Health {
+		return
+	}
+
+	bot.Log.Infof("Health probes: serving at %s/healthz and %s/readyz", bot.HealthAddress, bot.HealthAddress)
+	if err := remote.ListenAndServe(remote.ServerHealth, bot.HealthAddress, healthRouter(bot), false, bot); err != nil {
+		bot.Log.Errorf("Health probes: %s", err.Error())
+	}
+}
+
+// healthRouter creates the routes of the health probes
+func healthRouter(bot *models.Bot) *mux.Router {
+	router := mux.NewRouter()
+
+	// The bot is alive as long as it answers; a remote that is down only makes it unready
+	router.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		report := checkHealth(bot)
+		report.Status = "alive"
+		writeJSON(w, http.StatusOK, report)
+	}).Methods("GET")
+
+	router.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report := checkHealth(bot)
+		if report.Status != "ready" {
+			writeJSON(w, http.StatusServiceUnavailable, report)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	}).Methods("GET")
+
+	return router
+}
+
+// checkHealth reports the current health of the bot
+func checkHealth(bot *models.Bot) healthReport {
+	stopping := false
+	select {
+	case <-remote.Stopping():
+		stopping = true
+	default:
+	}
+	// The probes cover the remotes of every bot running in the process
+	expected := []string{}
+	bots := runningBots()
+	if len(bots) == 0 {
+		bots = []runningBot{{bot: bot}}
+	}
+	for _, b := range bots {
+		expected = append(expected, expectedRemotes(b.bot)...)
+	}
+	return newHealthReport(expected, remote.Statuses(), atomic.LoadInt32(&rulesLoaded) == 1, stopping)
+}
+
+// newHealthReport works out whether the bot is ready from the state of the remotes it runs
+func newHealthReport(expected []string, statuses map[string]remote.Status, loaded, stopping bool) healthReport {
+	report := healthReport{
+		Status:      "ready",
+		RulesLoaded: loaded,
+		Stopping:    stopping,
+		Remotes:     make(map[string]remoteHealth, len(expected)),
+	}
+	if !loaded || stopping {
+		report.Status = "not ready"
+	}
+	for _, name := range expected {
+		status, ok := statuses[name]
+		if !ok {
+			// The remote hasn't reported anything yet, e.g. it's still connecting
+			status.State = "starting"
+		}
+		health := remoteHealth{
+			Ready:  readyStates[status.State],
+			State:  status.State,
+			Detail: status.Detail,
+			Since:  status.Since,
+		}
+		if !health.Ready {
+			report.Status = "not ready"
+		}
+		report.Remotes[name] = health
+	}
+	return report
+}
+
+// expectedRemotes lists the remotes the bot runs, by the names they report their state under
+func expectedRemotes(bot *models.Bot) []string {
+	expected := []string{}
+	if bot.RunChat {
+		expected = append(expected, remote.StatusName(bot, strings.ToLower(bot.ChatApplication)))
+	}
+	if bot.RunCLI {
+		expected = append(expected, remote.StatusName(bot, "cli"))
+	}
+	if bot.RunScheduler {
+		expected = append(expected, remote.StatusName(bot, "scheduler"))
+	}
+	return expected
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+)
+
+func TestNewHealthReport(t *testing.T) {
+	connected := map[string]remote.Status{
+		"slack":     {State: "connected", Detail: "RTM"},
+		"scheduler": {State: "idle", Detail: "no schedule-type rules"},
+	}
+	tests := []struct {
+		name      string
+		expected  []string
+		statuses  map[string]remote.Status
+		loaded    bool
+		stopping  bool
+		want      string
+		wantReady map[string]bool
+	}{
+		{"Ready", []string{"slack", "scheduler"}, connected, true, false, "ready", map[string]bool{"slack": true, "scheduler": true}},
+		{"Rules not loaded", []string{"slack"}, connected, false, false, "not ready", map[string]bool{"slack": true}},
+		{"Remote still starting", []string{"slack", "discord"}, connected, true, false, "not ready", map[string]bool{"slack": true, "discord": false}},
+		{"Remote disconnected", []string{"slack"}, map[string]remote.Status{"slack": {State: "disconnected", Detail: "invalid authorization"}}, true, false, "not ready", map[string]bool{"slack": false}},
+		{"Shutting down", []string{"slack"}, connected, true, true, "not ready", map[string]bool{"slack": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newHealthReport(tt.expected, tt.statuses, tt.loaded, tt.stopping)
+			if report.Status != tt.want {
+				t.Errorf("newHealthReport() status = %s, want %s", report.Status, tt.want)
+			}
+			if len(report.Remotes) != len(tt.wantReady) {
+				t.Errorf("newHealthReport() remotes = %+v, want %v", report.Remotes, tt.wantReady)
+			}
+			for name, ready := range tt.wantReady {
+				if report.Remotes[name].Ready != ready {
+					t.Errorf("newHealthReport() remote '%s' ready = %v, want %v", name, report.Remotes[name].Ready, ready)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthRouter(t *testing.T) {
+	testBot := new(models.Bot)
+	testBot.RunChat = true
+	testBot.ChatApplication = "health-test"
+	router := healthRouter(testBot)
+	atomic.StoreInt32(&rulesLoaded, 1)
+	defer atomic.StoreInt32(&rulesLoaded, 0)
+
+	probe := func(path string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Code
+	}
+
+	if got := probe("/healthz"); got != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want %d", got, http.StatusOK)
+	}
+	if got := probe("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz before connecting = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+
+	remote.SetStatus("health-test", "connected", "")
+	if got := probe("/readyz"); got != http.StatusOK {
+		t.Errorf("GET /readyz after connecting = %d, want %d", got, http.StatusOK)
+	}
+}
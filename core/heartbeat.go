@@ -0,0 +1,171 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/utils"
+)
+
+// Defaults of 'heartbeat' in bot.yml
+const (
+	defaultHeartbeatInterval = 5 * time.Minute
+	defaultHeartbeatSilence  = 30 * time.Minute
+	defaultHeartbeatMessage  = "Still here"
+)
+
+// heartbeatClient pings the 'heartbeat' URL
+var heartbeatClient = &http.Client{Timeout: 10 * time.Second}
+
+// Heartbeat shows the bot is alive, with 'heartbeat' in bot.yml: every interval it pings a URL,
+// e.g. of a dead man's switch like healthchecks.io, and posts to a channel. It also watches the
+// chat application for silence: a connection that was cut off without the bot noticing (e.g.
+// Slack RTM) delivers nothing anymore. While it's silent for longer than allowed, the alert
+// channel is told, and the bot stops pinging and posting, so the dead man's switch goes off too.
+func Heartbeat(outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	if bot.Heartbeat == (models.Heartbeat{}) {
+		return
+	}
+	interval := heartbeatDuration("interval", bot.Heartbeat.Interval, defaultHeartbeatInterval, bot)
+	silence := heartbeatDuration("silence", bot.Heartbeat.Silence, defaultHeartbeatSilence, bot)
+	started := time.Now()
+	alerted := map[string]bool{}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-remote.Stopping():
+			return
+		case now := <-ticker.C:
+			beat(now, started, interval, silence, alerted, outputMsgs, hitRule, bot)
+		}
+	}
+}
+
+// beat checks for silence, alerting about remotes that fell or stopped being silent, and sends the
+// heartbeat if all is well
+func beat(now, started time.Time, interval, silence time.Duration, alerted map[string]bool, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	silent := silentRemotes(watchedRemotes(bot), remote.Statuses(), now, started, silence)
+	isSilent := map[string]bool{}
+	for _, name := range silent {
+		isSilent[name] = true
+		if !alerted[name] {
+			alerted[name] = true
+			heartbeatAlert(fmt.Sprintf("Haven't heard from %s for more than %s, its connection may have dropped without notice", name, silence), outputMsgs, hitRule, bot)
+		}
+	}
+	for name := range alerted {
+		if !isSilent[name] {
+			delete(alerted, name)
+			heartbeatAlert(fmt.Sprintf("Hearing from %s again", name), outputMsgs, hitRule, bot)
+		}
+	}
+	if len(silent) > 0 {
+		return
+	}
+
+	if len(bot.Heartbeat.URL) > 0 {
+		if err := pingHeartbeat(bot.Heartbeat.URL); err != nil {
+			bot.Log.Errorf("Could not ping the heartbeat URL: %s", err.Error())
+		}
+	}
+	if len(bot.Heartbeat.Channel) > 0 {
+		// With several replicas, only one of them posts each heartbeat
+		if bot.HighAvailability && bot.Store != nil {
+			claimed, err := bot.Store.Claim("heartbeats", bot.Name, []byte(bot.InstanceID), interval/2)
+			if err != nil || !claimed {
+				return
+			}
+		}
+		text := bot.Heartbeat.Message
+		if len(text) == 0 {
+			text = defaultHeartbeatMessage
+		}
+		message, ok := channelMessage(bot.Heartbeat.Channel, text, bot)
+		if !ok {
+			bot.Log.Warnf("Could not post the heartbeat to '%s', the channel was not found", bot.Heartbeat.Channel)
+			return
+		}
+		sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+	}
+}
+
+// watchedRemotes lists the remotes whose silence the heartbeat watches: the chat application's.
+// The CLI and the scheduler are quiet whenever nobody uses them.
+func watchedRemotes(bot *models.Bot) []string {
+	if !bot.RunChat {
+		return nil
+	}
+	return []string{remote.StatusName(bot, strings.ToLower(bot.ChatApplication))}
+}
+
+// silentRemotes lists the remotes that didn't hear anything for longer than allowed, counting from
+// when the heartbeat started for those that never heard anything
+func silentRemotes(watched []string, statuses map[string]remote.Status, now, started time.Time, silence time.Duration) []string {
+	silent := []string{}
+	for _, name := range watched {
+		last := started
+		if heard := statuses[name].LastHeard; heard != nil && heard.After(started) {
+			last = *heard
+		}
+		if now.Sub(last) > silence {
+			silent = append(silent, name)
+		}
+	}
+	sort.Strings(silent)
+	return silent
+}
+
+// heartbeatAlert tells the alert channel about silence, or the log if there's no such channel
+func heartbeatAlert(text string, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	bot.Log.Warn(text)
+	channel := bot.Heartbeat.AlertChannel
+	if len(channel) == 0 {
+		channel = bot.ErrorChannel
+	}
+	if len(channel) == 0 {
+		return
+	}
+	message, ok := channelMessage(channel, text, bot)
+	if !ok {
+		bot.Log.Warnf("Could not alert '%s', the channel was not found", channel)
+		return
+	}
+	sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+}
+
+// pingHeartbeat requests the heartbeat URL, which may refer to secrets
+func pingHeartbeat(url string) error {
+	url, err := utils.Substitute(url, map[string]string{})
+	if err != nil {
+		return err
+	}
+	resp, err := heartbeatClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Heartbeat URL responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// heartbeatDuration reads a duration of 'heartbeat', falling back to its default
+func heartbeatDuration(setting, value string, fallback time.Duration, bot *models.Bot) time.Duration {
+	if len(value) == 0 {
+		return fallback
+	}
+	d, err := utils.ParseDuration(value)
+	if err != nil || d <= 0 {
+		bot.Log.Warnf("Invalid heartbeat %s '%s', using %s", setting, value, fallback)
+		return fallback
+	}
+	return d
+}
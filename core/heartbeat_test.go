@@ -0,0 +1,86 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+)
+
+func TestSilentRemotes(t *testing.T) {
+	now := time.Now()
+	started := now.Add(-time.Hour)
+	recently, long, beforeStart := now.Add(-time.Minute), now.Add(-45*time.Minute), now.Add(-2*time.Hour)
+
+	tests := []struct {
+		name     string
+		statuses map[string]remote.Status
+		want     []string
+	}{
+		{"Heard recently", map[string]remote.Status{"slack": {State: "connected", LastHeard: &recently}}, []string{}},
+		{"Heard long ago", map[string]remote.Status{"slack": {State: "connected", LastHeard: &long}}, []string{"slack"}},
+		{"Never heard", map[string]remote.Status{}, []string{"slack"}},
+		{"Heard before the heartbeat started", map[string]remote.Status{"slack": {State: "connected", LastHeard: &beforeStart}}, []string{"slack"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := silentRemotes([]string{"slack"}, tt.statuses, now, started, 30*time.Minute); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("silentRemotes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := silentRemotes([]string{"slack"}, map[string]remote.Status{}, now, now.Add(-time.Minute), 30*time.Minute); len(got) > 0 {
+		t.Errorf("silentRemotes() right after starting = %q", got)
+	}
+}
+
+func TestBeat(t *testing.T) {
+	pings := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings++
+	}))
+	defer server.Close()
+
+	bot := &models.Bot{
+		Name:            "heartbeat-bot",
+		ConfigDir:       "heartbeat-bot",
+		RunChat:         true,
+		ChatApplication: "slack",
+		Rooms:           map[string]string{"heartbeat": "C1", "ops": "C2"},
+		Heartbeat:       models.Heartbeat{URL: server.URL, Channel: "heartbeat", AlertChannel: "ops"},
+	}
+	initLogger(bot)
+	outputMsgs := make(chan models.Message, 5)
+	hitRule := make(chan models.Rule, 5)
+	sent := func() []string {
+		got := []string{}
+		for len(outputMsgs) > 0 {
+			message := <-outputMsgs
+			<-hitRule
+			got = append(got, message.OutputToRooms[0]+": "+message.Output)
+		}
+		return got
+	}
+
+	alerted := map[string]bool{}
+	started := time.Now().Add(-time.Hour)
+	beat(time.Now(), started, time.Minute, 30*time.Minute, alerted, outputMsgs, hitRule, bot)
+	if want := []string{"C2: Haven't heard from heartbeat-bot/slack for more than 30m0s, its connection may have dropped without notice"}; !reflect.DeepEqual(sent(), want) || pings != 0 {
+		t.Errorf("beat() while silent didn't only alert, pinged %d times", pings)
+	}
+	beat(time.Now(), started, time.Minute, 30*time.Minute, alerted, outputMsgs, hitRule, bot)
+	if got := sent(); len(got) > 0 {
+		t.Errorf("beat() alerted again: %q", got)
+	}
+
+	remote.Heard(remote.StatusName(bot, "slack"))
+	beat(time.Now(), started, time.Minute, 30*time.Minute, alerted, outputMsgs, hitRule, bot)
+	if got, want := sent(), []string{"C2: Hearing from heartbeat-bot/slack again", "C1: Still here"}; !reflect.DeepEqual(got, want) || pings != 1 {
+		t.Errorf("beat() once heard from sent %q and pinged %d times, want %q and 1 ping", got, pings, want)
+	}
+}
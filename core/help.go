@@ -0,0 +1,122 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/target/flottbot/models"
+)
+
+func init() {
+	// The help command lists the built-in commands, so it can't be part of their declaration
+	builtinCommands = append(builtinCommands, builtinCommand{
+		trigger:     "help",
+		usage:       "help [keyword]",
+		description: "Show what I can do, optionally only the commands matching a keyword",
+		run:         helpCommand,
+	})
+}
+
+// helpEntry describes one command in the help output
+type helpEntry struct {
+	usage       string
+	description string
+	example     string
+}
+
+// helpCommand lists the commands the sender of the message is allowed to run,
+// optionally filtered by the keyword given as first argument
+func helpCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	keyword := ""
+	if len(args) > 0 {
+		keyword = strings.Join(args, " ")
+	}
+
+	entries := helpEntries(keyword, *message, rules, bot)
+	if len(entries) == 0 {
+		if len(keyword) > 0 {
+			return translate(*message, bot, "help.no_commands_matching", "I don't know any commands matching '${keyword}'.", map[string]string{"keyword": keyword}), nil
+		}
+		return translate(*message, bot, "help.no_commands", "I don't know any commands you can run.", nil), nil
+	}
+
+	output := translate(*message, bot, "help.commands", "I understand these commands:\n", nil)
+	if len(keyword) > 0 {
+		output = translate(*message, bot, "help.commands_matching", "I understand these commands matching '${keyword}':\n", map[string]string{"keyword": keyword})
+	}
+	for _, entry := range entries {
+		line := fmt.Sprintf("\n • `%s`", entry.usage)
+		if len(entry.description) > 0 {
+			line = line + " - " + entry.description
+		}
+		if len(entry.example) > 0 {
+			line = line + fmt.Sprintf("\n      e.g. `%s`", entry.example)
+		}
+		output = output + line
+	}
+	return output, nil
+}
+
+// helpEntries collects the rules and built-in commands the sender of the message may run, sorted by usage.
+// 'hear' rules and rules without 'include_in_help' are left out, like in the default help text.
+func helpEntries(keyword string, message models.Message, rules map[string]models.Rule, bot *models.Bot) []helpEntry {
+	keyword = strings.ToLower(keyword)
+	entries := []helpEntry{}
+
+	for _, rule := range rules {
+		// Rules an admin disabled are shown as such, so nobody wonders why they don't answer
+		if (!rule.Active && !rule.Disabled) || (len(rule.Respond) == 0 && len(rule.Intent) == 0) || !rule.IncludeInHelp {
+			continue
+		}
+		usage := rule.HelpText
+		if len(usage) == 0 {
+			usage = rule.Respond
+		}
+		if len(usage) == 0 {
+			usage = rule.Intent
+		}
+		if !matchesKeyword(keyword, rule.Name, usage, rule.Description) {
+			continue
+		}
+		if !canTrigger(message, rule, bot) {
+			continue
+		}
+		description := rule.Description
+		if rule.Disabled {
+			description = strings.TrimSpace(description + " " + translate(message, bot, "help.disabled", "(disabled for now)", nil))
+		}
+		entries = append(entries, helpEntry{usage: usage, description: description, example: rule.Example})
+	}
+
+	for _, cmd := range builtinCommands {
+		if cmd.admin && !isAdmin(message, bot) {
+			continue
+		}
+		if len(cmd.module) > 0 && !moduleEnabled(cmd.module, bot) {
+			continue
+		}
+		if !matchesKeyword(keyword, cmd.trigger, cmd.usage, cmd.description) {
+			continue
+		}
+		entries = append(entries, helpEntry{usage: cmd.usage, description: cmd.description})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].usage < entries[j].usage
+	})
+	return entries
+}
+
+// matchesKeyword determines whether any of the given fields contains the keyword, ignoring case
+func matchesKeyword(keyword string, fields ...string) bool {
+	if len(keyword) == 0 {
+		return true
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), keyword) {
+			return true
+		}
+	}
+	return false
+}
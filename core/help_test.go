@@ -0,0 +1,62 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestHelpCommand(t *testing.T) {
+	testBot := new(models.Bot)
+	testBot.Admins = []string{"admin"}
+
+	rules := map[string]models.Rule{
+		"deploy.yml": {Name: "deploy", Respond: "deploy", HelpText: "deploy <service>", Description: "Deploy a service", Example: "deploy api", IncludeInHelp: true, Active: true},
+		"hello.yml":  {Name: "hello", Respond: "hello", Description: "Say hello", IncludeInHelp: true, Active: true},
+		"secret.yml": {Name: "secret", Respond: "secret", Description: "Only for ops", IncludeInHelp: true, Active: true, AllowUsers: []string{"ops"}},
+		"hidden.yml": {Name: "hidden", Respond: "hidden", IncludeInHelp: false, Active: true},
+		"hear.yml":   {Name: "hear", Hear: "/lunch/", IncludeInHelp: true, Active: true},
+		"off.yml":    {Name: "off", Respond: "off", IncludeInHelp: true, Active: false},
+	}
+
+	userMessage := models.NewMessage()
+	userMessage.Service = models.MsgServiceChat
+	userMessage.Vars["_user.name"] = "jane"
+
+	adminMessage := models.NewMessage()
+	adminMessage.Service = models.MsgServiceChat
+	adminMessage.Vars["_user.name"] = "admin"
+
+	tests := []struct {
+		name    string
+		args    []string
+		message models.Message
+		want    []string
+		notWant []string
+	}{
+		{"All commands", nil, userMessage, []string{"`deploy <service>` - Deploy a service", "e.g. `deploy api`", "`hello` - Say hello", "`help [keyword]`", "`schedules`"}, []string{"secret", "hidden", "lunch", "off", "schedule pause"}},
+		{"Admin commands", nil, adminMessage, []string{"`schedule pause <name>`"}, []string{"secret"}},
+		{"Keyword", []string{"DEPLOY"}, userMessage, []string{"matching 'DEPLOY'", "`deploy <service>`"}, []string{"hello", "schedules"}},
+		{"No match", []string{"nope"}, userMessage, []string{"I don't know any commands matching 'nope'."}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := tt.message
+			got, err := helpCommand(tt.args, &message, nil, rules, nil, testBot)
+			if err != nil {
+				t.Fatalf("helpCommand() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("helpCommand() = %s, want it to contain %s", got, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("helpCommand() = %s, should not contain %s", got, notWant)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/target/flottbot/i18n"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// defaultLocale is the locale replies are in when 'default_locale' is not set
+const defaultLocale = "en"
+
+// translationRefPattern finds references to the message catalog in a rule's output, e.g. ${t:greeting}
+var translationRefPattern = regexp.MustCompile(`\$\{t:([^}]+)\}`)
+
+// configureI18N loads the message catalog from the locales directory, next to the rules directory.
+// Each file in it is named after a locale (e.g. 'de.yml') and maps message keys to translations.
+func configureI18N(bot *models.Bot) {
+	if len(bot.DefaultLocale) == 0 {
+		bot.DefaultLocale = defaultLocale
+	}
+
+	localesDir, err := utils.PathExists(path.Join(configDir(bot), "locales"))
+	if err != nil {
+		bot.Log.Debug("No locales directory found, replying in the default language")
+		return
+	}
+
+	catalog, err := i18n.Load(localesDir)
+	if err != nil {
+		bot.Log.Fatalf("Could not load the message catalog: %s", err.Error())
+	}
+	bot.Catalog = catalog
+	bot.Log.Infof("Loaded translations for %d locale(s)", len(catalog))
+}
+
+// messageLocale chooses the locale to reply to a message in: the locale set for the channel
+// in 'channel_locales' (by name or ID), the user's own locale, or else the default locale
+func messageLocale(message models.Message, bot *models.Bot) string {
+	// Keys in bot.yml are read lowercased
+	for _, channel := range []string{message.ChannelName, message.ChannelID} {
+		if locale, ok := bot.ChannelLocales[strings.ToLower(channel)]; ok && len(channel) > 0 {
+			return locale
+		}
+	}
+	if locale := message.Vars["_user.locale"]; len(locale) > 0 {
+		return locale
+	}
+	return bot.DefaultLocale
+}
+
+// translate looks up a message in the catalog for the message's locale, falling back to the
+// default locale and then to the built-in text. Placeholders like ${rule} are filled from args.
+func translate(message models.Message, bot *models.Bot, key, fallback string, args map[string]string) string {
+	text, ok := bot.Catalog.Lookup(key, messageLocale(message, bot), bot.DefaultLocale)
+	if !ok {
+		text = fallback
+	}
+	for name, value := range args {
+		text = strings.Replace(text, "${"+name+"}", value, -1)
+	}
+	return text
+}
+
+// translateRefs replaces references to the message catalog in a rule's output with their translation
+func translateRefs(output string, message models.Message, bot *models.Bot) string {
+	return translationRefPattern.ReplaceAllStringFunc(output, func(ref string) string {
+		key := translationRefPattern.FindStringSubmatch(ref)[1]
+		text, ok := bot.Catalog.Lookup(key, messageLocale(message, bot), bot.DefaultLocale)
+		if !ok {
+			bot.Log.Warnf("No translation found for '%s'", key)
+			return key
+		}
+		return text
+	})
+}
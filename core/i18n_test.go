@@ -0,0 +1,53 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/i18n"
+	"github.com/target/flottbot/models"
+)
+
+func TestTranslate(t *testing.T) {
+	testBot := new(models.Bot)
+	testBot.DefaultLocale = "en"
+	testBot.ChannelLocales = map[string]string{"allgemein": "de", "c0fr": "fr"}
+	testBot.Catalog = i18n.Catalog{
+		"en": {"greeting": "Hello ${_user.firstname}"},
+		"de": {"greeting": "Hallo ${_user.firstname}", "errors.not_allowed_rule": "Du darfst '${rule}' nicht ausführen."},
+		"fr": {"greeting": "Bonjour ${_user.firstname}"},
+	}
+
+	tests := []struct {
+		name        string
+		channelName string
+		channelID   string
+		userLocale  string
+		wantLocale  string
+		wantError   string
+		wantRef     string
+	}{
+		{"Default locale", "general", "C0GEN", "", "en", "You are not allowed to run the 'deploy' rule.", "Hello ${_user.firstname}"},
+		{"User locale", "general", "C0GEN", "de-DE", "de-DE", "Du darfst 'deploy' nicht ausführen.", "Hallo ${_user.firstname}"},
+		{"Channel locale by name", "allgemein", "C0ALL", "fr-FR", "de", "Du darfst 'deploy' nicht ausführen.", "Hallo ${_user.firstname}"},
+		{"Channel locale by ID", "", "C0FR", "de-DE", "fr", "You are not allowed to run the 'deploy' rule.", "Bonjour ${_user.firstname}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.ChannelName = tt.channelName
+			message.ChannelID = tt.channelID
+			message.Vars["_user.locale"] = tt.userLocale
+
+			if got := messageLocale(message, testBot); got != tt.wantLocale {
+				t.Errorf("messageLocale() = %q, want %q", got, tt.wantLocale)
+			}
+			got := translate(message, testBot, "errors.not_allowed_rule", "You are not allowed to run the '${rule}' rule.", map[string]string{"rule": "deploy"})
+			if got != tt.wantError {
+				t.Errorf("translate() = %q, want %q", got, tt.wantError)
+			}
+			if got := translateRefs("${t:greeting}", message, testBot); got != tt.wantRef {
+				t.Errorf("translateRefs() = %q, want %q", got, tt.wantRef)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage"
+	"github.com/target/flottbot/utils"
+)
+
+// Storage buckets of linked accounts, by account, and of the codes linking them, by code
+const (
+	identityBucket     = "identities"
+	identityCodeBucket = "identity_codes"
+)
+
+// identityCodeTTL is how long a code from 'link account' can be used
+const identityCodeTTL = 10 * time.Minute
+
+// identityCodeChars are the characters of 'link account' codes, without ones that look alike
+const identityCodeChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// identityCode is what a 'link account' code stands for
+type identityCode struct {
+	Account  string `json:"account"`
+	Identity string `json:"identity"`
+}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "link account", usage: "link account [code]", description: "Link your accounts on other chat applications to this one", run: linkAccountCommand},
+		builtinCommand{trigger: "unlink account", usage: "unlink account", description: "Unlink this account from your other accounts", run: unlinkAccountCommand},
+	)
+}
+
+// userAccount is the chat application and user ID of the sender of a message, e.g. 'slack:U024BE7LH'
+func userAccount(message models.Message, bot *models.Bot) string {
+	return messageRemote(message, bot) + ":" + message.Vars["_user.id"]
+}
+
+// identityStore is where linked accounts are kept: the storage of the first bot running in this
+// process, so the bots of all chat applications share them
+func identityStore(bot *models.Bot) storage.Storage {
+	if bots := runningBots(); len(bots) > 0 && bots[0].bot.Store != nil {
+		return bots[0].bot.Store
+	}
+	return bot.Store
+}
+
+// findIdentity looks up the identity an account belongs to: in 'identities' in bot.yml, or else
+// linked with 'link account'
+func findIdentity(account string, bot *models.Bot) (string, bool) {
+	for identity, accounts := range bot.Identities {
+		for _, a := range accounts {
+			if strings.EqualFold(a, account) {
+				return identity, true
+			}
+		}
+	}
+	store := identityStore(bot)
+	if store == nil {
+		return "", false
+	}
+	identity, ok, err := store.Get(identityBucket, account)
+	if err != nil {
+		bot.Log.Errorf("Could not look up the identity of %s: %s", account, err.Error())
+		return "", false
+	}
+	return string(identity), ok
+}
+
+// resolveIdentity sets ${_user.identity} to the identity the sender of a message belongs to, so
+// admins, 'allow_users', 'ignore_users', memory, and jobs follow the person across chat applications
+func resolveIdentity(message *models.Message, bot *models.Bot) {
+	if len(message.Vars["_user.id"]) == 0 {
+		return
+	}
+	if identity, ok := findIdentity(userAccount(*message, bot), bot); ok {
+		message.Vars["_user.identity"] = identity
+	}
+}
+
+// personKey identifies the person who sent a message: by their identity, if their account is
+// linked, or else by their user ID
+func personKey(message models.Message) string {
+	if identity := message.Vars["_user.identity"]; len(identity) > 0 {
+		return "identity:" + identity
+	}
+	return message.Vars["_user.id"]
+}
+
+// canTrigger determines whether the sender of a message may run a rule, by their user name, ID,
+// or identity
+func canTrigger(message models.Message, rule models.Rule, bot *models.Bot) bool {
+	name, id, identity := message.Vars["_user.name"], message.Vars["_user.id"], message.Vars["_user.identity"]
+	if len(identity) > 0 {
+		for _, user := range rule.IgnoreUsers {
+			if user == identity || user == name {
+				return false
+			}
+		}
+		for _, user := range rule.AllowUsers {
+			if user == identity {
+				return utils.CanTrigger(identity, id, rule, bot)
+			}
+		}
+	}
+	return utils.CanTrigger(name, id, rule, bot)
+}
+
+// linkAccountCommand links accounts: without arguments it gives a code, and sending the code from
+// another account ('link account <code>') makes both accounts the same person
+func linkAccountCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	store := identityStore(bot)
+	if store == nil || len(message.Vars["_user.id"]) == 0 {
+		return translate(*message, bot, "identity.unavailable", "I can't link accounts here.", nil), nil
+	}
+	account := userAccount(*message, bot)
+	if len(args) == 0 {
+		return startLinkAccount(account, message, store, bot)
+	}
+
+	code := strings.ToUpper(args[0])
+	data, ok, err := store.Get(identityCodeBucket, code)
+	if err != nil {
+		return "", err
+	}
+	var linked identityCode
+	if ok {
+		err = json.Unmarshal(data, &linked)
+	}
+	if !ok || err != nil {
+		return translate(*message, bot, "identity.unknown_code", "I don't know the code '${code}', or it expired. Get a new one with 'link account'.", map[string]string{"code": code}), nil
+	}
+	if linked.Account == account {
+		return translate(*message, bot, "identity.same_account", "Send me the code from the account you want to link, not the one you got it on.", nil), nil
+	}
+	if identity, ok := findIdentity(account, bot); ok && identity != linked.Identity {
+		if _, stored, _ := store.Get(identityBucket, account); !stored {
+			return translate(*message, bot, "identity.configured", "This account belongs to '${identity}' in my configuration, ask an admin to change it.", map[string]string{"identity": identity}), nil
+		}
+	}
+	if err := store.Delete(identityCodeBucket, code); err != nil {
+		return "", err
+	}
+	for _, a := range []string{linked.Account, account} {
+		if err := store.Set(identityBucket, a, []byte(linked.Identity), 0); err != nil {
+			return "", err
+		}
+	}
+	bot.Log.Infof("Linked %s to %s, as '%s'", account, linked.Account, linked.Identity)
+	message.Vars["_user.identity"] = linked.Identity
+	return translate(*message, bot, "identity.linked", "Linked this account to ${account}.", map[string]string{"account": linked.Account}), nil
+}
+
+// startLinkAccount gives the sender of a message a code to link another account to theirs. Codes are
+// only given in direct messages, so no one else can link their account to it.
+func startLinkAccount(account string, message *models.Message, store storage.Storage, bot *models.Bot) (string, error) {
+	if message.Type != models.MsgTypeDirect && message.Service != models.MsgServiceCLI {
+		return translate(*message, bot, "identity.direct_only", "Ask me in a direct message, so no one else sees your code.", nil), nil
+	}
+	identity, ok := findIdentity(account, bot)
+	if !ok {
+		identity = account
+	}
+	code := make([]byte, 8)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(identityCodeChars))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = identityCodeChars[n.Int64()]
+	}
+	data, err := json.Marshal(identityCode{Account: account, Identity: identity})
+	if err != nil {
+		return "", err
+	}
+	if err := store.Set(identityCodeBucket, string(code), data, identityCodeTTL); err != nil {
+		return "", err
+	}
+	return translate(*message, bot, "identity.code", "Send me 'link account ${code}' from your other account within ${minutes} minutes.", map[string]string{"code": string(code), "minutes": strconv.Itoa(int(identityCodeTTL.Minutes()))}), nil
+}
+
+// unlinkAccountCommand unlinks the sender's account from the accounts it was linked to with 'link account'
+func unlinkAccountCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	store := identityStore(bot)
+	if store == nil || len(message.Vars["_user.id"]) == 0 {
+		return translate(*message, bot, "identity.unavailable", "I can't link accounts here.", nil), nil
+	}
+	account := userAccount(*message, bot)
+	if _, ok, err := store.Get(identityBucket, account); err != nil || !ok {
+		if err != nil {
+			return "", err
+		}
+		return translate(*message, bot, "identity.not_linked", "This account isn't linked to any other.", nil), nil
+	}
+	if err := store.Delete(identityBucket, account); err != nil {
+		return "", err
+	}
+	bot.Log.Infof("Unlinked %s", account)
+	delete(message.Vars, "_user.identity")
+	return translate(*message, bot, "identity.unlinked", "This account isn't linked to your other accounts anymore.", nil), nil
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestLinkAccount(t *testing.T) {
+	store := memory.New()
+	slackBot := &models.Bot{Name: "slack", ChatApplication: "slack", Store: store, Admins: []string{"slack:U1"}}
+	discordBot := &models.Bot{Name: "discord", ChatApplication: "discord", Store: store, Identities: map[string][]string{"bob": {"discord:D2"}}}
+	initLogger(slackBot)
+	initLogger(discordBot)
+	newMessage := func(id string, msgType models.MessageType) *models.Message {
+		message := models.NewMessage()
+		message.Service = models.MsgServiceChat
+		message.Type = msgType
+		message.Vars["_user.id"] = id
+		message.Vars["_user.name"] = "jane"
+		return &message
+	}
+
+	// Codes are only given in direct messages
+	if got, _ := linkAccountCommand(nil, newMessage("U1", models.MsgTypeChannel), nil, nil, nil, slackBot); got != "Ask me in a direct message, so no one else sees your code." {
+		t.Errorf("linkAccountCommand() = %q", got)
+	}
+	got, err := linkAccountCommand(nil, newMessage("U1", models.MsgTypeDirect), nil, nil, nil, slackBot)
+	if err != nil {
+		t.Fatalf("linkAccountCommand() error = %v", err)
+	}
+	match := regexp.MustCompile(`link account ([A-Z0-9]{8})`).FindStringSubmatch(got)
+	if match == nil {
+		t.Fatalf("linkAccountCommand() = %q, want a code", got)
+	}
+
+	// The code links a Discord account, which then is the same person
+	if got, _ := linkAccountCommand([]string{"NOTACODE"}, newMessage("D1", models.MsgTypeDirect), nil, nil, nil, discordBot); got != "I don't know the code 'NOTACODE', or it expired. Get a new one with 'link account'." {
+		t.Errorf("linkAccountCommand() = %q", got)
+	}
+	if got, _ := linkAccountCommand([]string{match[1]}, newMessage("D2", models.MsgTypeDirect), nil, nil, nil, discordBot); got != "This account belongs to 'bob' in my configuration, ask an admin to change it." {
+		t.Errorf("linkAccountCommand() = %q", got)
+	}
+	if got, _ := linkAccountCommand([]string{match[1]}, newMessage("D1", models.MsgTypeDirect), nil, nil, nil, discordBot); got != "Linked this account to slack:U1." {
+		t.Errorf("linkAccountCommand() = %q", got)
+	}
+	if got, _ := linkAccountCommand([]string{match[1]}, newMessage("D3", models.MsgTypeDirect), nil, nil, nil, discordBot); got != "I don't know the code '"+match[1]+"', or it expired. Get a new one with 'link account'." {
+		t.Errorf("linkAccountCommand() used a code twice: %q", got)
+	}
+
+	discordMessage := newMessage("D1", models.MsgTypeChannel)
+	resolveIdentity(discordMessage, discordBot)
+	slackMessage := newMessage("U1", models.MsgTypeChannel)
+	resolveIdentity(slackMessage, slackBot)
+	if discordMessage.Vars["_user.identity"] != "slack:U1" || personKey(*discordMessage) != personKey(*slackMessage) {
+		t.Errorf("resolveIdentity() = %q and %q", discordMessage.Vars["_user.identity"], slackMessage.Vars["_user.identity"])
+	}
+	discordBot.Admins = []string{"slack:U1"}
+	if !isAdmin(*discordMessage, discordBot) {
+		t.Error("isAdmin() = false for a linked admin")
+	}
+	if !canTrigger(*discordMessage, models.Rule{AllowUsers: []string{"slack:U1"}}, discordBot) || canTrigger(*discordMessage, models.Rule{IgnoreUsers: []string{"slack:U1"}}, discordBot) {
+		t.Error("canTrigger() doesn't go by identity")
+	}
+	configured := newMessage("D2", models.MsgTypeChannel)
+	if resolveIdentity(configured, discordBot); configured.Vars["_user.identity"] != "bob" {
+		t.Errorf("resolveIdentity() = %q, want %q", configured.Vars["_user.identity"], "bob")
+	}
+
+	// Unlinking leaves the other account linked
+	if got, _ := unlinkAccountCommand(nil, newMessage("D1", models.MsgTypeDirect), nil, nil, nil, discordBot); got != "This account isn't linked to your other accounts anymore." {
+		t.Errorf("unlinkAccountCommand() = %q", got)
+	}
+	unlinked := newMessage("D1", models.MsgTypeChannel)
+	if resolveIdentity(unlinked, discordBot); len(unlinked.Vars["_user.identity"]) > 0 || isAdmin(*unlinked, discordBot) {
+		t.Errorf("resolveIdentity() = %q after unlinking", unlinked.Vars["_user.identity"])
+	}
+	if got, _ := unlinkAccountCommand(nil, newMessage("D1", models.MsgTypeDirect), nil, nil, nil, discordBot); got != "This account isn't linked to any other." {
+		t.Errorf("unlinkAccountCommand() = %q", got)
+	}
+}
@@ -0,0 +1,304 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/remote/mock"
+	"github.com/target/flottbot/remote/slack"
+)
+
+// incidentBucket is the storage bucket holding the open incident of each channel
+const incidentBucket = "incidents"
+
+// incidentChannelPrefix is what incident channels are named with when 'channel_prefix' is not set
+const incidentChannelPrefix = "incident-"
+
+// incidentChannelMaxLength is the longest channel name chat applications take
+const incidentChannelMaxLength = 80
+
+// incidentTimeFormat is how times are shown in incident summaries, timelines, and retros
+const incidentTimeFormat = "2006-01-02 15:04 MST"
+
+// defaultSeverities are the severities incidents can have when 'severities' is not set
+var defaultSeverities = []string{"sev1", "sev2", "sev3", "sev4"}
+
+// nonSlugChars are the characters replaced when an incident's title is made part of a channel name
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// defaultRetroTemplate is posted when an incident is resolved, unless 'retro_template' is set
+const defaultRetroTemplate = `*Retro: ${title}* (${severity})
+Started ${started} by ${commander}, resolved ${resolved} by ${resolver} after ${duration}.
+
+*Timeline*
+${timeline}
+
+*What went well?*
+
+*What went wrong?*
+
+*Action items*`
+
+// incident is an incident being handled in a channel
+type incident struct {
+	Severity    string          `json:"severity"`
+	Title       string          `json:"title"`
+	Commander   string          `json:"commander"` // who started it
+	Channel     string          `json:"channel"`
+	ChannelName string          `json:"channel_name"`
+	Started     time.Time       `json:"started"`
+	Timeline    []timelineEntry `json:"timeline"`
+}
+
+// timelineEntry is something that happened during an incident
+type timelineEntry struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user"`
+	Text string    `json:"text"`
+}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "incident start", usage: "incident start <severity> <title>", description: "Start an incident, with its own channel where chat applications have them", args: 2, module: moduleIncidents, run: startIncidentCommand},
+		builtinCommand{trigger: "incident note", usage: "incident note <text>", description: "Add to the timeline of this channel's incident", args: 1, module: moduleIncidents, run: noteIncidentCommand},
+		builtinCommand{trigger: "incident timeline", usage: "incident timeline", description: "Show the timeline of this channel's incident", module: moduleIncidents, run: incidentTimelineCommand},
+		builtinCommand{trigger: "incident resolve", usage: "incident resolve", description: "Resolve this channel's incident and post a retro template", module: moduleIncidents, run: resolveIncidentCommand},
+	)
+}
+
+// startIncidentCommand starts an incident; the first argument is its severity, the others its title
+func startIncidentCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	return startIncident(args[0], strings.Join(args[1:], " "), *message, outputMsgs, hitRule, bot, time.Now())
+}
+
+// startIncident starts an incident in a channel of its own, where the responders are invited and its
+// summary is pinned. On chat applications without channels the bot can create, it's handled in the
+// channel it's started in.
+func startIncident(severity, title string, message models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot, now time.Time) (string, error) {
+	severities := bot.Incidents.Severities
+	if len(severities) == 0 {
+		severities = defaultSeverities
+	}
+	known := false
+	for _, s := range severities {
+		if strings.EqualFold(s, severity) {
+			severity, known = s, true
+			break
+		}
+	}
+	if !known {
+		return translate(message, bot, "incidents.unknown_severity", "Use one of these severities: ${severities}.", map[string]string{"severities": strings.Join(severities, ", ")}), nil
+	}
+
+	inc := incident{
+		Severity:    strings.ToUpper(severity),
+		Title:       title,
+		Commander:   message.Vars["_user.name"],
+		Channel:     message.ChannelID,
+		ChannelName: message.ChannelName,
+		Started:     now,
+	}
+	summary := translate(message, bot, "incidents.summary", "*${severity} incident: ${title}*\nCommander: ${commander}\nStarted: ${started}\nAdd to the timeline with 'incident note <text>', and run 'incident resolve' when it's over.", incidentVars(inc, "", now))
+
+	manager, ok := channelManager(message, bot)
+	if ok {
+		name := incidentChannelName(title, bot, now)
+		channel, err := manager.CreateChannel(name, bot)
+		if err != nil {
+			return "", fmt.Errorf("Could not create the incident channel '%s': %s", name, err.Error())
+		}
+		inc.Channel, inc.ChannelName = channel, name
+		responders := append([]string{}, bot.Incidents.Responders...)
+		if userID := message.Vars["_user.id"]; len(userID) > 0 {
+			responders = append(responders, userID)
+		}
+		if err := manager.Invite(channel, responders, bot); err != nil {
+			bot.Log.Errorf("Could not invite the responders to '%s': %s", name, err.Error())
+		}
+		if err := manager.Pin(channel, summary, bot); err != nil {
+			bot.Log.Errorf("Could not pin the summary of the incident in '%s': %s", name, err.Error())
+		}
+	} else if _, open, err := getIncident(inc.Channel, bot); err != nil || open {
+		if err != nil {
+			return "", err
+		}
+		return translate(message, bot, "incidents.already_open", "There already is an incident in this channel, resolve it with 'incident resolve' first.", nil), nil
+	}
+
+	inc.Timeline = append(inc.Timeline, timelineEntry{Time: now, User: inc.Commander, Text: fmt.Sprintf("Started the %s incident '%s'", inc.Severity, title)})
+	if err := setIncident(inc, bot); err != nil {
+		return "", err
+	}
+	announceIncident(translate(message, bot, "incidents.announce_start", "${severity} incident '${title}' started by ${commander} in #${channel}", incidentVars(inc, "", now)), outputMsgs, hitRule, bot)
+
+	if !ok {
+		return summary, nil
+	}
+	return translate(message, bot, "incidents.started", "Started the ${severity} incident in #${channel}.", incidentVars(inc, "", now)), nil
+}
+
+// noteIncidentCommand adds the arguments to the timeline of the incident in the message's channel
+func noteIncidentCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	inc, ok, err := getIncident(message.ChannelID, bot)
+	if err != nil || !ok {
+		if err != nil {
+			return "", err
+		}
+		return translate(*message, bot, "incidents.none", "There is no incident in this channel.", nil), nil
+	}
+	inc.Timeline = append(inc.Timeline, timelineEntry{Time: time.Now(), User: message.Vars["_user.name"], Text: strings.Join(args, " ")})
+	if err := setIncident(inc, bot); err != nil {
+		return "", err
+	}
+	return translate(*message, bot, "incidents.noted", "Added to the timeline.", nil), nil
+}
+
+// incidentTimelineCommand shows the timeline of the incident in the message's channel
+func incidentTimelineCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	inc, ok, err := getIncident(message.ChannelID, bot)
+	if err != nil || !ok {
+		if err != nil {
+			return "", err
+		}
+		return translate(*message, bot, "incidents.none", "There is no incident in this channel.", nil), nil
+	}
+	return fmt.Sprintf("*%s*\n%s", inc.Title, incidentTimeline(inc)), nil
+}
+
+// resolveIncidentCommand resolves the incident in the message's channel
+func resolveIncidentCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	return resolveIncident(*message, outputMsgs, hitRule, bot, time.Now())
+}
+
+// resolveIncident closes the incident in the message's channel, and posts the retro template filled in
+// with what happened
+func resolveIncident(message models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot, now time.Time) (string, error) {
+	inc, ok, err := getIncident(message.ChannelID, bot)
+	if err != nil || !ok {
+		if err != nil {
+			return "", err
+		}
+		return translate(message, bot, "incidents.none", "There is no incident in this channel.", nil), nil
+	}
+	resolver := message.Vars["_user.name"]
+	inc.Timeline = append(inc.Timeline, timelineEntry{Time: now, User: resolver, Text: "Resolved the incident"})
+	if err := bot.Store.Delete(incidentBucket, inc.Channel); err != nil {
+		return "", err
+	}
+
+	vars := incidentVars(inc, resolver, now)
+	announceIncident(translate(message, bot, "incidents.announce_resolved", "${severity} incident '${title}' was resolved by ${resolver} after ${duration}", vars), outputMsgs, hitRule, bot)
+
+	retro := translate(message, bot, "incidents.retro", defaultRetroTemplate, nil)
+	if len(bot.Incidents.RetroTemplate) > 0 {
+		retro = bot.Incidents.RetroTemplate
+	}
+	for name, value := range vars {
+		retro = strings.Replace(retro, "${"+name+"}", value, -1)
+	}
+	return retro, nil
+}
+
+// incidentVars are what summaries, announcements, and retro templates can show of an incident
+func incidentVars(inc incident, resolver string, now time.Time) map[string]string {
+	return map[string]string{
+		"severity":  inc.Severity,
+		"title":     inc.Title,
+		"commander": inc.Commander,
+		"channel":   inc.ChannelName,
+		"started":   inc.Started.Format(incidentTimeFormat),
+		"resolved":  now.Format(incidentTimeFormat),
+		"resolver":  resolver,
+		"duration":  incidentDuration(now.Sub(inc.Started)),
+		"timeline":  incidentTimeline(inc),
+	}
+}
+
+// incidentTimeline lists what happened during an incident, a line per entry
+func incidentTimeline(inc incident) string {
+	lines := make([]string, 0, len(inc.Timeline))
+	for _, entry := range inc.Timeline {
+		lines = append(lines, fmt.Sprintf(" • %s %s: %s", entry.Time.Format(incidentTimeFormat), entry.User, entry.Text))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// incidentDuration shows how long an incident took, to the minute
+func incidentDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+}
+
+// incidentChannelName names the channel of an incident after the day it started and its title
+func incidentChannelName(title string, bot *models.Bot, now time.Time) string {
+	prefix := bot.Incidents.ChannelPrefix
+	if len(prefix) == 0 {
+		prefix = incidentChannelPrefix
+	}
+	name := prefix + now.Format("20060102")
+	if slug := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(title), "-"), "-"); len(slug) > 0 {
+		name = name + "-" + slug
+	}
+	if len(name) > incidentChannelMaxLength {
+		name = strings.TrimRight(name[:incidentChannelMaxLength], "-")
+	}
+	return name
+}
+
+// channelManager is the bot's chat application, if it can set up channels for incidents
+func channelManager(message models.Message, bot *models.Bot) (remote.ChannelManager, bool) {
+	if message.Service != models.MsgServiceChat {
+		return nil, false
+	}
+	switch strings.ToLower(bot.ChatApplication) {
+	case "slack":
+		return &slack.Client{Token: bot.SlackToken}, true
+	case "mock":
+		if remoteMock, ok := mock.ForBot(bot); ok {
+			return remoteMock, true
+		}
+	}
+	return nil, false
+}
+
+// announceIncident tells the 'announce_channel' about an incident, if it's set
+func announceIncident(text string, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	if len(bot.Incidents.AnnounceChannel) == 0 {
+		return
+	}
+	message, ok := channelMessage(bot.Incidents.AnnounceChannel, text, bot)
+	if !ok {
+		bot.Log.Errorf("Could not find the incidents announce_channel '%s'", bot.Incidents.AnnounceChannel)
+		return
+	}
+	sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+}
+
+// getIncident looks up the open incident of a channel
+func getIncident(channel string, bot *models.Bot) (incident, bool, error) {
+	var inc incident
+	value, ok, err := bot.Store.Get(incidentBucket, channel)
+	if err != nil || !ok {
+		return inc, false, err
+	}
+	if err := json.Unmarshal(value, &inc); err != nil {
+		return inc, false, err
+	}
+	return inc, true, nil
+}
+
+// setIncident stores the open incident of a channel
+func setIncident(inc incident, bot *models.Bot) error {
+	value, err := json.Marshal(inc)
+	if err != nil {
+		return err
+	}
+	return bot.Store.Set(incidentBucket, inc.Channel, value, 0)
+}
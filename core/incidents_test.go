@@ -0,0 +1,132 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote/mock"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestIncidents(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Modules: []string{moduleIncidents}, Rooms: map[string]string{"ops": "C999"}}
+	testBot.Incidents = models.Incidents{Responders: []string{"oncall"}, AnnounceChannel: "ops"}
+	initLogger(testBot)
+	client := mock.New(testBot)
+
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+	announced := func() string {
+		select {
+		case m := <-outputMsgs:
+			<-hitRule
+			return m.OutputToRooms[0] + ": " + m.Output
+		default:
+			return ""
+		}
+	}
+
+	message := func(channel string) models.Message {
+		m := models.NewMessage()
+		m.Service = models.MsgServiceChat
+		m.ChannelID = channel
+		m.ChannelName = channel
+		m.Vars["_user.id"] = "jane"
+		m.Vars["_user.name"] = "jane"
+		return m
+	}
+	started := time.Date(2019, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	output, err := startIncident("sev5", "API is down", message("general"), outputMsgs, hitRule, testBot, started)
+	if err != nil || output != "Use one of these severities: sev1, sev2, sev3, sev4." {
+		t.Errorf("startIncident() = %q, %v", output, err)
+	}
+
+	output, err = startIncident("SEV1", "API is down!", message("general"), outputMsgs, hitRule, testBot, started)
+	if err != nil || output != "Started the SEV1 incident in #incident-20190501-api-is-down." {
+		t.Fatalf("startIncident() = %q, %v", output, err)
+	}
+	if got, want := announced(), "C999: SEV1 incident 'API is down!' started by jane in #incident-20190501-api-is-down"; got != want {
+		t.Errorf("startIncident() announced %q, want %q", got, want)
+	}
+	channel := client.Channels()["incident-20190501-api-is-down"]
+	if !reflect.DeepEqual(channel.Members, []string{"oncall", "jane"}) {
+		t.Errorf("startIncident() invited %q", channel.Members)
+	}
+	if len(channel.Pins) != 1 || !strings.HasPrefix(channel.Pins[0], "*SEV1 incident: API is down!*\nCommander: jane\nStarted: 2019-05-01 09:00 UTC") {
+		t.Errorf("startIncident() pinned %q", channel.Pins)
+	}
+
+	note := message("incident-20190501-api-is-down")
+	if output, _ := noteIncidentCommand([]string{"rolled", "back"}, &note, outputMsgs, nil, hitRule, testBot); output != "Added to the timeline." {
+		t.Errorf("noteIncidentCommand() = %q", output)
+	}
+	elsewhere := message("general")
+	if output, _ := noteIncidentCommand([]string{"nope"}, &elsewhere, outputMsgs, nil, hitRule, testBot); output != "There is no incident in this channel." {
+		t.Errorf("noteIncidentCommand() = %q", output)
+	}
+
+	testBot.Incidents.RetroTemplate = "${title} took ${duration}\n${timeline}"
+	output, err = resolveIncident(message("incident-20190501-api-is-down"), outputMsgs, hitRule, testBot, started.Add(90*time.Minute))
+	lines := strings.Split(output, "\n")
+	if err != nil || len(lines) != 4 || lines[0] != "API is down! took 1h30m" || !strings.HasSuffix(lines[2], "jane: rolled back") || lines[3] != " • 2019-05-01 10:30 UTC jane: Resolved the incident" {
+		t.Errorf("resolveIncident() = %q, %v", output, err)
+	}
+	if got, want := announced(), "C999: SEV1 incident 'API is down!' was resolved by jane after 1h30m"; got != want {
+		t.Errorf("resolveIncident() announced %q, want %q", got, want)
+	}
+	if _, open, _ := getIncident("incident-20190501-api-is-down", testBot); open {
+		t.Errorf("resolveIncident() left the incident open")
+	}
+}
+
+func TestIncidentInChannel(t *testing.T) {
+	// The CLI can't create channels, so the incident is handled where it's started
+	testBot := &models.Bot{Store: memory.New(), Modules: []string{moduleIncidents}}
+	initLogger(testBot)
+
+	m := models.NewMessage()
+	m.Service = models.MsgServiceCLI
+	m.ChannelID = "cli"
+	m.Vars["_user.name"] = "jane"
+	started := time.Date(2019, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	output, err := startIncident("sev2", "Slow logins", m, nil, nil, testBot, started)
+	if err != nil || !strings.HasPrefix(output, "*SEV2 incident: Slow logins*") {
+		t.Errorf("startIncident() = %q, %v", output, err)
+	}
+	output, _ = startIncident("sev2", "Slow logins again", m, nil, nil, testBot, started)
+	if output != "There already is an incident in this channel, resolve it with 'incident resolve' first." {
+		t.Errorf("startIncident() = %q", output)
+	}
+	output, _ = resolveIncident(m, nil, nil, testBot, started.Add(20*time.Second))
+	if !strings.HasPrefix(output, "*Retro: Slow logins* (SEV2)\nStarted 2019-05-01 09:00 UTC by jane, resolved 2019-05-01 09:00 UTC by jane after 20s.") {
+		t.Errorf("resolveIncident() = %q", output)
+	}
+}
+
+func TestIncidentChannelName(t *testing.T) {
+	now := time.Date(2019, 5, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		prefix string
+		title  string
+		want   string
+	}{
+		{"Slug", "", "API is down!", "incident-20190501-api-is-down"},
+		{"Prefix", "inc-", "Payments", "inc-20190501-payments"},
+		{"No letters", "", "!!!", "incident-20190501"},
+		{"Too long", "", strings.Repeat("a", 100), "incident-20190501-" + strings.Repeat("a", 62)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &models.Bot{Incidents: models.Incidents{ChannelPrefix: tt.prefix}}
+			if got := incidentChannelName(tt.title, bot, now); got != tt.want {
+				t.Errorf("incidentChannelName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
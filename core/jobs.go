@@ -0,0 +1,268 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mohae/deepcopy"
+
+	"github.com/target/flottbot/audit"
+	"github.com/target/flottbot/models"
+)
+
+// jobRetention is how long finished jobs can still be looked up with 'job status'
+const jobRetention = 24 * time.Hour
+
+// What a job is doing
+const (
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+	jobTimedOut  = "timed out"
+)
+
+// job is a run of a rule with 'job: true', tracked so people can check on it, and whoever started
+// it or an admin can cancel it. Jobs are kept in memory: they can only be looked up and cancelled
+// on the instance of the bot running them.
+type job struct {
+	ID          string
+	Rule        string
+	User        string
+	UserID      string
+	Action      string // the action running right now
+	Status      string
+	Started     time.Time
+	Finished    time.Time
+	CancelledBy string
+	cancel      context.CancelFunc
+}
+
+// jobs are the jobs of each bot, by ID
+var (
+	jobsMu    sync.Mutex
+	jobs      = make(map[*models.Bot]map[string]*job)
+	lastJobID int
+)
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "job status", usage: "job status <id>", description: "Show what a job is doing", args: 1, run: jobStatusCommand},
+		builtinCommand{trigger: "job cancel", usage: "job cancel <id>", description: "Cancel a job you started", args: 1, run: cancelJobCommand},
+		builtinCommand{trigger: "cancel", usage: "cancel <id>", description: "Cancel a job you started", args: 1, run: cancelJobCommand},
+		builtinCommand{trigger: "jobs", usage: "jobs", description: "List the running jobs", run: listJobsCommand},
+	)
+}
+
+// startJob tracks a run of a rule as a job, and tells whoever triggered it the job's ID right
+// away. The rule's output goes to the thread of the message that triggered it, once it's done.
+func startJob(message *models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, rule models.Rule, bot *models.Bot) *job {
+	now := time.Now()
+	ctx, cancel := context.WithCancel(message.Run.Context())
+	jobsMu.Lock()
+	lastJobID++
+	j := &job{
+		ID:      strconv.Itoa(lastJobID),
+		Rule:    rule.Name,
+		User:    message.Vars["_user.name"],
+		UserID:  personKey(*message),
+		Status:  jobRunning,
+		Started: now,
+		cancel:  cancel,
+	}
+	if jobs[bot] == nil {
+		jobs[bot] = make(map[string]*job)
+	}
+	for id, old := range jobs[bot] {
+		if old.Status != jobRunning && now.Sub(old.Finished) > jobRetention {
+			delete(jobs[bot], id)
+		}
+	}
+	jobs[bot][j.ID] = j
+	jobsMu.Unlock()
+
+	bot.Log.Infof("Started job %s for rule '%s'", j.ID, rule.Name)
+	message.Run = models.NewRunContext(ctx)
+	message.Vars["_job.id"] = j.ID
+
+	if message.Service != models.MsgServiceChat && message.Service != models.MsgServiceCLI {
+		return j
+	}
+	message.StartThread = true
+	ack := deepcopy.Copy(*message).(models.Message)
+	ack.Output = translate(*message, bot, "jobs.started", "Started job ${id} for '${rule}'. I'll reply here when it's done, ask me 'job status ${id}' to check on it.", map[string]string{"id": j.ID, "rule": rule.Name})
+	ack.DirectMessageOnly = rule.DirectMessageOnly
+	sendOutput(outputMsgs, hitRule, ack, models.Rule{}, bot)
+	return j
+}
+
+// setJobAction records which action a job is running
+func setJobAction(j *job, action string) {
+	if j == nil {
+		return
+	}
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	j.Action = action
+}
+
+// runCancelled determines whether the rule run handling a message was cancelled or timed out
+func runCancelled(message models.Message) bool {
+	return message.Run.Context().Err() != nil
+}
+
+// finishJob records how a job ended, and puts it at the top of the rule's output. The output of
+// a cancelled job tells which of the rule's actions ran.
+func finishJob(j *job, message *models.Message, rule models.Rule, results []audit.ActionResult, bot *models.Bot) {
+	status := jobDone
+	if len(message.Error) > 0 {
+		status = jobFailed
+	}
+	for _, result := range results {
+		if len(result.Error) > 0 {
+			status = jobFailed
+		}
+	}
+	switch message.Run.Context().Err() {
+	case context.Canceled:
+		status = jobCancelled
+	case context.DeadlineExceeded:
+		status = jobTimedOut
+	}
+
+	jobsMu.Lock()
+	j.Status, j.Finished, j.Action = status, time.Now(), ""
+	cancelledBy := j.CancelledBy
+	jobsMu.Unlock()
+	j.cancel()
+	bot.Log.Infof("Job %s for rule '%s' is %s", j.ID, j.Rule, status)
+
+	if message.Service != models.MsgServiceChat && message.Service != models.MsgServiceCLI {
+		return
+	}
+	args := map[string]string{"id": j.ID, "rule": j.Rule, "user": cancelledBy, "timeout": rule.Timeout}
+	var heading string
+	switch {
+	case status == jobDone:
+		heading = translate(*message, bot, "jobs.done", "Job ${id} is done:", args)
+	case status == jobFailed:
+		heading = translate(*message, bot, "jobs.failed", "Job ${id} failed:", args)
+	case status == jobTimedOut:
+		heading = translate(*message, bot, "jobs.timed_out", "Job ${id} didn't finish within ${timeout}.", args) + jobProgress(*message, rule, results, bot)
+	case len(cancelledBy) > 0:
+		heading = translate(*message, bot, "jobs.cancelled", "Job ${id} was cancelled by ${user}.", args) + jobProgress(*message, rule, results, bot)
+	default:
+		heading = translate(*message, bot, "jobs.abandoned", "Job ${id} was stopped, I'm shutting down.", args) + jobProgress(*message, rule, results, bot)
+	}
+	if len(message.Output) == 0 {
+		message.Output = heading
+		return
+	}
+	message.Output = heading + "\n" + message.Output
+}
+
+// jobProgress lists what became of each of the actions of a job that was stopped
+func jobProgress(message models.Message, rule models.Rule, results []audit.ActionResult, bot *models.Bot) string {
+	progress := ""
+	for i, action := range rule.Actions {
+		var status string
+		switch {
+		case i >= len(results) || len(results[i].Name) == 0:
+			status = translate(message, bot, "jobs.action_not_run", "not run", nil)
+		case results[i].Skipped:
+			status = translate(message, bot, "jobs.action_skipped", "skipped", nil)
+		case len(results[i].Error) > 0:
+			status = translate(message, bot, "jobs.action_failed", "stopped", nil)
+		default:
+			status = translate(message, bot, "jobs.action_done", "done", nil)
+		}
+		progress = progress + fmt.Sprintf("\n • %s: %s", action.Name, status)
+	}
+	return progress
+}
+
+// findJob looks up one of the bot's jobs
+func findJob(id string, bot *models.Bot) (*job, bool) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	j, ok := jobs[bot][id]
+	return j, ok
+}
+
+// describeJob tells what a job is doing, or how it ended; jobsMu must be held
+func describeJob(j *job, now time.Time) string {
+	description := fmt.Sprintf("Job %s (%s), started by %s %s ago: ", j.ID, j.Rule, j.User, now.Sub(j.Started).Round(time.Second))
+	took := j.Finished.Sub(j.Started).Round(time.Second)
+	switch j.Status {
+	case jobRunning:
+		if len(j.Action) == 0 {
+			return description + "running"
+		}
+		return description + fmt.Sprintf("running '%s'", j.Action)
+	case jobCancelled:
+		if len(j.CancelledBy) == 0 {
+			return description + fmt.Sprintf("stopped by shutting down after %s", took)
+		}
+		return description + fmt.Sprintf("cancelled by %s after %s", j.CancelledBy, took)
+	}
+	return description + fmt.Sprintf("%s after %s", j.Status, took)
+}
+
+// jobStatusCommand shows what the job with the ID given as first argument is doing
+func jobStatusCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	j, ok := findJob(args[0], bot)
+	if !ok {
+		return translate(*message, bot, "jobs.not_found", "There is no job with ID '${id}'.", map[string]string{"id": args[0]}), nil
+	}
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	return describeJob(j, time.Now()) + ".", nil
+}
+
+// listJobsCommand lists the jobs that are running
+func listJobsCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	running := []*job{}
+	for _, j := range jobs[bot] {
+		if j.Status == jobRunning {
+			running = append(running, j)
+		}
+	}
+	if len(running) == 0 {
+		return "There are no running jobs.", nil
+	}
+	sort.Slice(running, func(i, k int) bool { return running[i].Started.Before(running[k].Started) })
+	output := "These jobs are running:\n"
+	now := time.Now()
+	for _, j := range running {
+		output = output + fmt.Sprintf("\n • %s", describeJob(j, now))
+	}
+	return output, nil
+}
+
+// cancelJobCommand cancels the job with the ID given as first argument, if the sender of the message
+// started it or is an admin: the requests and commands of its running action are stopped, and its
+// remaining actions don't run
+func cancelJobCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	j, ok := findJob(args[0], bot)
+	if !ok {
+		return translate(*message, bot, "jobs.not_found", "There is no job with ID '${id}'.", map[string]string{"id": args[0]}), nil
+	}
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if j.UserID != personKey(*message) && !isAdmin(*message, bot) {
+		return translate(*message, bot, "jobs.not_allowed", "Only whoever started job ${id}, or an admin, can cancel it.", map[string]string{"id": j.ID}), nil
+	}
+	if j.Status != jobRunning || len(j.CancelledBy) > 0 {
+		return fmt.Sprintf("Job %s isn't running anymore.", j.ID), nil
+	}
+	j.CancelledBy = message.Vars["_user.name"]
+	j.cancel()
+	bot.Log.Infof("Job %s for rule '%s' cancelled by %s", j.ID, j.Rule, j.CancelledBy)
+	return fmt.Sprintf("Cancelling job %s (%s).", j.ID, j.Rule), nil
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestJobs(t *testing.T) {
+	bot := &models.Bot{Admins: []string{"admin"}}
+	initLogger(bot)
+
+	tests := []struct {
+		name       string
+		cmd        string
+		timeout    string
+		cancel     bool
+		want       string
+		wantStatus string
+	}{
+		{"Done", `echo "deployed"`, "", false, "Job ${id} is done:\nnotified", ": done after"},
+		{"Failed", `false`, "", false, "Job ${id} failed:", ": failed after"},
+		{"Cancelled", `/bin/sh -c "echo halfway; sleep 30"`, "", true, "Job ${id} was cancelled by admin.\n • deploy it: stopped\n • notify: not run\nhalfway", ": cancelled by admin after"},
+		{"Timed out", `/bin/sh -c "echo halfway; sleep 30"`, "300ms", false, "Job ${id} didn't finish within 300ms.\n • deploy it: stopped\n • notify: not run\nhalfway", ": timed out after"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputMsgs := make(chan models.Message, 10)
+			hitRule := make(chan models.Rule, 10)
+			rule := models.Rule{
+				Name:         "deploy",
+				Job:          true,
+				Timeout:      tt.timeout,
+				Actions:      []models.Action{{Name: "deploy it", Type: "exec", Cmd: tt.cmd, Timeout: 30}, {Name: "notify", Type: "exec", Cmd: `echo "notified"`}},
+				FormatOutput: "${_exec_output}",
+			}
+			message := models.NewMessage()
+			message.Service = models.MsgServiceCLI
+			message.ReplyToID = "1234.5678"
+			message.Vars["_user.name"] = "alice"
+			message.Vars["_user.id"] = "U1"
+			go doRuleActions(message, outputMsgs, rule, hitRule, bot)
+
+			ack := <-outputMsgs
+			<-hitRule
+			id := ack.Vars["_job.id"]
+			if want := "Started job " + id + " for 'deploy'."; !strings.HasPrefix(ack.Output, want) {
+				t.Errorf("startJob() acknowledged with %q, want %q", ack.Output, want)
+			}
+			if ack.OutputThread() != message.ReplyToID {
+				t.Errorf("startJob() acknowledged in thread %q, want %q", ack.OutputThread(), message.ReplyToID)
+			}
+
+			if tt.cancel {
+				// The job gets to its action right after acknowledging
+				var status string
+				for i := 0; i < 100 && !strings.HasSuffix(status, "running 'deploy it'."); i++ {
+					time.Sleep(10 * time.Millisecond)
+					status, _ = jobStatusCommand([]string{id}, &message, outputMsgs, nil, hitRule, bot)
+				}
+				if want := "started by alice"; !strings.Contains(status, want) || !strings.HasSuffix(status, "running 'deploy it'.") {
+					t.Errorf("jobStatusCommand() = %q", status)
+				}
+				stranger := models.NewMessage()
+				stranger.Vars["_user.name"], stranger.Vars["_user.id"] = "bob", "U2"
+				if got, _ := cancelJobCommand([]string{id}, &stranger, outputMsgs, nil, hitRule, bot); got != "Only whoever started job "+id+", or an admin, can cancel it." {
+					t.Errorf("cancelJobCommand() = %q for someone else's job", got)
+				}
+				admin := models.NewMessage()
+				admin.Vars["_user.name"], admin.Vars["_user.id"] = "admin", "U3"
+				if got, _ := cancelJobCommand([]string{id}, &admin, outputMsgs, nil, hitRule, bot); got != "Cancelling job "+id+" (deploy)." {
+					t.Errorf("cancelJobCommand() = %q", got)
+				}
+			}
+
+			select {
+			case done := <-outputMsgs:
+				<-hitRule
+				if want := strings.Replace(tt.want, "${id}", id, -1); !strings.HasPrefix(done.Output, want) {
+					t.Errorf("doRuleActions() sent %q, want %q", done.Output, want)
+				}
+				if done.OutputThread() != message.ReplyToID {
+					t.Errorf("doRuleActions() sent the output to thread %q, want %q", done.OutputThread(), message.ReplyToID)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("doRuleActions() didn't finish the job")
+			}
+
+			status, _ := jobStatusCommand([]string{id}, &message, outputMsgs, nil, hitRule, bot)
+			if !strings.Contains(status, tt.wantStatus) {
+				t.Errorf("jobStatusCommand() = %q", status)
+			}
+			if got, _ := cancelJobCommand([]string{id}, &message, outputMsgs, nil, hitRule, bot); got != "Job "+id+" isn't running anymore." {
+				t.Errorf("cancelJobCommand() = %q for a finished job", got)
+			}
+		})
+	}
+
+	message := models.NewMessage()
+	if got, _ := jobStatusCommand([]string{"nope"}, &message, nil, nil, nil, bot); got != "There is no job with ID 'nope'." {
+		t.Errorf("jobStatusCommand() = %q for a missing job", got)
+	}
+	if got, _ := listJobsCommand(nil, &message, nil, nil, nil, bot); got != "There are no running jobs." {
+		t.Errorf("listJobsCommand() = %q", got)
+	}
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/target/flottbot/models"
+)
+
+// karmaBucket is the storage bucket holding everyone's karma
+const karmaBucket = "karma"
+
+// karmaTop is how many names the 'karma' command lists without arguments
+const karmaTop = 10
+
+// karmaPattern finds 'name++' and 'name--' in messages; names can be chat mentions, e.g. <@U123>++
+var karmaPattern = regexp.MustCompile(`(?:^|\s)(<@!?\w+(?:\|[^>]*)?>|@?[\w.\-]*\w)(\+\+|--)(?:$|[\s.,!?;:])`)
+
+// karmaMention finds the ID in a chat mention
+var karmaMention = regexp.MustCompile(`^<@!?(\w+)`)
+
+func init() {
+	builtinCommands = append(builtinCommands, builtinCommand{
+		trigger:     "karma",
+		usage:       "karma [name]",
+		description: "Show someone's karma, or who has the most",
+		module:      moduleKarma,
+		run:         karmaCommand,
+	})
+}
+
+// handleKarma gives or takes karma for every 'name++' or 'name--' in the message, and reports
+// whether there were any. Like 'hear' rules, the bot doesn't have to be addressed.
+func handleKarma(outputMsgs chan<- models.Message, message models.Message, hitRule chan<- models.Rule, bot *models.Bot) bool {
+	if !moduleEnabled(moduleKarma, bot) {
+		return false
+	}
+	if message.Service != models.MsgServiceChat && message.Service != models.MsgServiceCLI {
+		return false
+	}
+	matches := karmaPattern.FindAllStringSubmatch(message.Input, -1)
+	if len(matches) == 0 {
+		return false
+	}
+
+	lines := []string{}
+	for _, m := range matches {
+		name := karmaName(m[1])
+		if m[2] == "++" && (name == "<@"+message.Vars["_user.id"]+">" || name == strings.ToLower(message.Vars["_user.name"])) {
+			lines = append(lines, translate(message, bot, "karma.self", "Nice try, but you can't give yourself karma.", nil))
+			continue
+		}
+		delta := 1
+		if m[2] == "--" {
+			delta = -1
+		}
+		karma, err := addKarma(name, delta, bot)
+		if err != nil {
+			bot.Log.Errorf("Could not update karma of '%s': %s", name, err.Error())
+			continue
+		}
+		lines = append(lines, translate(message, bot, "karma.changed", "${name} has ${karma} karma.", map[string]string{"name": name, "karma": strconv.Itoa(karma)}))
+	}
+	if len(lines) == 0 {
+		return false
+	}
+	Prommetric(bot.Name+"-builtin-karma", bot)
+
+	message.Output = strings.Join(lines, "\n")
+	sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+	return true
+}
+
+// karmaCommand shows the karma of the name given as first argument, or who has the most karma
+func karmaCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	if len(args) > 0 {
+		name := karmaName(args[0])
+		karma, err := getKarma(name, bot)
+		if err != nil {
+			return "", err
+		}
+		return translate(*message, bot, "karma.changed", "${name} has ${karma} karma.", map[string]string{"name": name, "karma": strconv.Itoa(karma)}), nil
+	}
+
+	stored, err := bot.Store.List(karmaBucket)
+	if err != nil {
+		return "", err
+	}
+	type entry struct {
+		name  string
+		karma int
+	}
+	entries := []entry{}
+	for name, value := range stored {
+		karma, err := strconv.Atoi(string(value))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry{name, karma})
+	}
+	if len(entries) == 0 {
+		return translate(*message, bot, "karma.none", "Nobody has any karma yet.", nil), nil
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].karma != entries[j].karma {
+			return entries[i].karma > entries[j].karma
+		}
+		return entries[i].name < entries[j].name
+	})
+	if len(entries) > karmaTop {
+		entries = entries[:karmaTop]
+	}
+	output := translate(*message, bot, "karma.top", "These have the most karma:", nil) + "\n"
+	for i, e := range entries {
+		output = output + fmt.Sprintf("\n%d. %s - %d", i+1, e.name, e.karma)
+	}
+	return output, nil
+}
+
+// karmaName turns what karma was given to into the name it's kept under. Chat mentions are kept
+// as a plain mention of the user's ID, so they show as a mention again; other names ignore case.
+func karmaName(s string) string {
+	if m := karmaMention.FindStringSubmatch(s); m != nil {
+		return "<@" + m[1] + ">"
+	}
+	return strings.ToLower(strings.TrimPrefix(s, "@"))
+}
+
+// getKarma looks up the karma of a name
+func getKarma(name string, bot *models.Bot) (int, error) {
+	value, ok, err := bot.Store.Get(karmaBucket, name)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return strconv.Atoi(string(value))
+}
+
+// addKarma changes the karma of a name and returns the new karma
+func addKarma(name string, delta int, bot *models.Bot) (int, error) {
+	karma, err := getKarma(name, bot)
+	if err != nil {
+		return 0, err
+	}
+	karma += delta
+	return karma, bot.Store.Set(karmaBucket, name, []byte(strconv.Itoa(karma)), 0)
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestHandleKarma(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Modules: []string{moduleKarma}}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantHit bool
+	}{
+		{"Plain name", "thanks bob++", "bob has 1 karma.", true},
+		{"Names ignore case", "@Bob++ for the fix!", "bob has 2 karma.", true},
+		{"Taking karma", "bob--", "bob has 1 karma.", true},
+		{"Mentions", "<@U222|alice>++ and <@U222>++", "<@U222> has 1 karma.\n<@U222> has 2 karma.", true},
+		{"Self karma", "jane++", "Nice try, but you can't give yourself karma.", true},
+		{"Self karma by mention", "<@U111>++", "Nice try, but you can't give yourself karma.", true},
+		{"Any name", "i++ in a loop is c++ code", "i has 1 karma.\nc has 1 karma.", true},
+		{"Options", "use --force", "", false},
+		{"Nothing", "hello", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputMsgs := make(chan models.Message, 1)
+			hitRule := make(chan models.Rule, 1)
+			message := models.NewMessage()
+			message.Service = models.MsgServiceChat
+			message.Input = tt.input
+			message.Vars["_user.id"] = "U111"
+			message.Vars["_user.name"] = "jane"
+
+			if hit := handleKarma(outputMsgs, message, hitRule, testBot); hit != tt.wantHit {
+				t.Fatalf("handleKarma() = %v, want %v", hit, tt.wantHit)
+			}
+			if !tt.wantHit {
+				return
+			}
+			if got := (<-outputMsgs).Output; got != tt.want {
+				t.Errorf("handleKarma() output = %q, want %q", got, tt.want)
+			}
+			<-hitRule
+		})
+	}
+
+	message := models.NewMessage()
+	got, err := karmaCommand(nil, &message, nil, nil, nil, testBot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "These have the most karma:\n\n1. <@U222> - 2\n2. bob - 1\n3. c - 1\n4. i - 1"
+	if got != want {
+		t.Errorf("karmaCommand() = %q, want %q", got, want)
+	}
+	if got, _ := karmaCommand([]string{"@BOB"}, &message, nil, nil, nil, testBot); got != "bob has 1 karma." {
+		t.Errorf("karmaCommand(@BOB) = %q", got)
+	}
+
+	disabled := &models.Bot{Store: memory.New()}
+	message.Service = models.MsgServiceChat
+	message.Input = "bob++"
+	if handleKarma(nil, message, nil, disabled) {
+		t.Error("handleKarma() should do nothing unless the karma module is enabled")
+	}
+}
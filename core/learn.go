@@ -0,0 +1,156 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// learnedBucket is the storage bucket holding the answers taught from chat, by their phrase in lower case
+const learnedBucket = "learned-responses"
+
+// learnedResponse is an answer taught from chat with 'bot learn', given when the bot is addressed with
+// its phrase, like a rule with only 'respond' and 'format_output'
+type learnedResponse struct {
+	Phrase  string    `json:"phrase"`
+	Answer  string    `json:"answer"`
+	By      string    `json:"by"`
+	Created time.Time `json:"created"`
+}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "bot learn", usage: `bot learn "<phrase>" -> "<answer>"`, description: "Answer a phrase the bot is addressed with, without a rule", args: 2, admin: true, run: learnCommand},
+		builtinCommand{trigger: "bot forget", usage: `bot forget "<phrase>"`, description: "Stop answering a phrase taught with 'bot learn'", args: 1, admin: true, run: forgetCommand},
+		builtinCommand{trigger: "bot learned", usage: "bot learned", description: "List the phrases taught with 'bot learn'", run: listLearnedCommand},
+	)
+}
+
+// handleLearned answers a message starting with the phrase of an answer taught from chat, and reports
+// whether it did. Like 'respond' rules, the bot must be addressed, and rules go first; the longest
+// matching phrase wins.
+func handleLearned(outputMsgs chan<- models.Message, message models.Message, hitRule chan<- models.Rule, bot *models.Bot) bool {
+	if bot.Store == nil || (message.Service != models.MsgServiceChat && message.Service != models.MsgServiceCLI) {
+		return false
+	}
+	if message.Type != models.MsgTypeDirect && !message.BotMentioned {
+		return false
+	}
+	learned, err := loadLearned(bot)
+	if err != nil {
+		bot.Log.Errorf("Could not look up the answers taught from chat: %s", err.Error())
+		return false
+	}
+	for _, response := range learned {
+		if _, hit := utils.Match(regexp.QuoteMeta(response.Phrase), message.Input, true); !hit {
+			continue
+		}
+		// Anyone allowed to teach the bot writes these, so they mustn't reach its environment or secrets
+		output := utils.SubstituteVars(response.Answer, message.Vars)
+		Prommetric(bot.Name+"-builtin-learned", bot)
+		message.Output = output
+		sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+		return true
+	}
+	return false
+}
+
+// learnCommand teaches the bot to answer the phrase given as first argument with the last argument; an
+// arrow between them is optional. Teaching a phrase again changes its answer.
+func learnCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	if len(args) == 3 && args[1] == "->" {
+		args = []string{args[0], args[2]}
+	}
+	phrase, answer := strings.Join(strings.Fields(args[0]), " "), strings.TrimSpace(args[len(args)-1])
+	if len(args) != 2 || len(phrase) == 0 || len(answer) == 0 {
+		return translate(*message, bot, "learn.usage", "Put the phrase and the answer in quotes, e.g. bot learn \"vpn help\" -> \"See https://wiki/vpn\"", nil), nil
+	}
+	if cmd, ok := builtinTrigger(phrase); ok {
+		return translate(*message, bot, "learn.builtin", "'${phrase}' is my '${command}' command, pick another phrase.", map[string]string{"phrase": phrase, "command": cmd}), nil
+	}
+
+	value, err := json.Marshal(learnedResponse{Phrase: phrase, Answer: answer, By: message.Vars["_user.name"], Created: time.Now()})
+	if err != nil {
+		return "", err
+	}
+	if err := bot.Store.Set(learnedBucket, strings.ToLower(phrase), value, 0); err != nil {
+		return "", fmt.Errorf("Could not learn the answer: %s", err.Error())
+	}
+	return translate(*message, bot, "learn.learned", "Okay, I'll answer '${phrase}'.", map[string]string{"phrase": phrase}), nil
+}
+
+// forgetCommand stops answering the phrase given as first argument
+func forgetCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	phrase := strings.Join(strings.Fields(strings.Join(args, " ")), " ")
+	key := strings.ToLower(phrase)
+	if _, ok, err := bot.Store.Get(learnedBucket, key); err != nil || !ok {
+		return translate(*message, bot, "learn.unknown", "I wasn't taught to answer '${phrase}'.", map[string]string{"phrase": phrase}), err
+	}
+	if err := bot.Store.Delete(learnedBucket, key); err != nil {
+		return "", fmt.Errorf("Could not forget the answer: %s", err.Error())
+	}
+	return translate(*message, bot, "learn.forgot", "Okay, I forgot about '${phrase}'.", map[string]string{"phrase": phrase}), nil
+}
+
+// listLearnedCommand lists the phrases taught from chat, in alphabetical order, with their answers
+func listLearnedCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	learned, err := loadLearned(bot)
+	if err != nil {
+		return "", fmt.Errorf("Could not look up the answers taught from chat: %s", err.Error())
+	}
+	if len(learned) == 0 {
+		return translate(*message, bot, "learn.none", "I wasn't taught any answers, teach me with 'bot learn'.", nil), nil
+	}
+	sort.SliceStable(learned, func(i, j int) bool {
+		return strings.ToLower(learned[i].Phrase) < strings.ToLower(learned[j].Phrase)
+	})
+	lines := []string{translate(*message, bot, "learn.list", "I was taught to answer:", nil)}
+	for _, response := range learned {
+		lines = append(lines, translate(*message, bot, "learn.item", " • ${phrase}: ${answer} (by ${user})", map[string]string{
+			"phrase": response.Phrase,
+			"answer": response.Answer,
+			"user":   response.By,
+		}))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// loadLearned loads the answers taught from chat, the longest phrases first
+func loadLearned(bot *models.Bot) ([]learnedResponse, error) {
+	values, err := bot.Store.List(learnedBucket)
+	if err != nil {
+		return nil, err
+	}
+	learned := make([]learnedResponse, 0, len(values))
+	for _, value := range values {
+		var response learnedResponse
+		if err := json.Unmarshal(value, &response); err != nil {
+			bot.Log.Warnf("Skipping an answer taught from chat that can't be read: %s", err.Error())
+			continue
+		}
+		learned = append(learned, response)
+	}
+	sort.SliceStable(learned, func(i, j int) bool {
+		if len(learned[i].Phrase) != len(learned[j].Phrase) {
+			return len(learned[i].Phrase) > len(learned[j].Phrase)
+		}
+		return learned[i].Phrase < learned[j].Phrase
+	})
+	return learned, nil
+}
+
+// builtinTrigger finds the built-in command a phrase would run, if any
+func builtinTrigger(phrase string) (string, bool) {
+	for _, cmd := range builtinCommands {
+		if _, hit := utils.Match(cmd.trigger, phrase, true); hit {
+			return cmd.trigger, true
+		}
+	}
+	return "", false
+}
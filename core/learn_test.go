@@ -0,0 +1,94 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestLearn(t *testing.T) {
+	os.Setenv("FLOTTBOT_TEST_SECRET", "s3cr3t")
+	defer os.Unsetenv("FLOTTBOT_TEST_SECRET")
+	testBot := &models.Bot{Store: memory.New()}
+	initLogger(testBot)
+	admin := models.NewMessage()
+	admin.Vars["_user.name"] = "jane"
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"With an arrow", []string{"vpn help", "->", "See https://wiki/vpn"}, "Okay, I'll answer 'vpn help'."},
+		{"Without an arrow", []string{"vpn", "Ask ${_user.name} in #it"}, "Okay, I'll answer 'vpn'."},
+		{"Environment variable", []string{"whoami", "->", "${FLOTTBOT_TEST_SECRET}"}, "Okay, I'll answer 'whoami'."},
+		{"Unquoted phrase", []string{"wifi", "password", "->", "Ask IT"}, `Put the phrase and the answer in quotes, e.g. bot learn "vpn help" -> "See https://wiki/vpn"`},
+		{"Built-in command", []string{"mutes please", "No"}, "'mutes please' is my 'mutes' command, pick another phrase."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := learnCommand(tt.args, &admin, nil, nil, nil, testBot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("learnCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+	answers := []struct {
+		name      string
+		input     string
+		mentioned bool
+		want      string
+	}{
+		{"Longest phrase wins", "VPN help please", true, "See https://wiki/vpn"},
+		{"Shorter phrase", "vpn", true, "Ask joe in #it"},
+		{"No environment variables", "whoami", true, "${FLOTTBOT_TEST_SECRET}"},
+		{"Not addressed", "vpn help", false, ""},
+		{"Other words", "vpnhelp", true, ""},
+	}
+	for _, tt := range answers {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.Service = models.MsgServiceChat
+			message.Type = models.MsgTypeChannel
+			message.BotMentioned = tt.mentioned
+			message.Input = tt.input
+			message.Vars["_user.name"] = "joe"
+			answered := handleLearned(outputMsgs, message, hitRule, testBot)
+			if answered != (len(tt.want) > 0) {
+				t.Fatalf("handleLearned() = %v, want an answer %q", answered, tt.want)
+			}
+			if !answered {
+				return
+			}
+			got := <-outputMsgs
+			<-hitRule
+			if got.Output != tt.want {
+				t.Errorf("handleLearned() answered %q, want %q", got.Output, tt.want)
+			}
+		})
+	}
+
+	output, err := listLearnedCommand(nil, &admin, nil, nil, nil, testBot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "I was taught to answer:\n • vpn: Ask ${_user.name} in #it (by jane)\n • vpn help: See https://wiki/vpn (by jane)\n • whoami: ${FLOTTBOT_TEST_SECRET} (by jane)"
+	if output != want {
+		t.Errorf("listLearnedCommand() = %q, want %q", output, want)
+	}
+
+	if output, _ := forgetCommand([]string{"VPN", "help"}, &admin, nil, nil, nil, testBot); output != "Okay, I forgot about 'VPN help'." {
+		t.Errorf("forgetCommand() = %q", output)
+	}
+	if output, _ := forgetCommand([]string{"vpn help"}, &admin, nil, nil, nil, testBot); output != "I wasn't taught to answer 'vpn help'." {
+		t.Errorf("forgetCommand() again = %q", output)
+	}
+}
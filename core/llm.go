@@ -0,0 +1,179 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/llm"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// llmHistoryBucket is the storage bucket holding conversations with the LLM
+const llmHistoryBucket = "llm_history"
+
+// llmHistoryTTL is how long a conversation with the LLM is remembered after its last message
+const llmHistoryTTL = 24 * time.Hour
+
+// defaultLLMTimeout bounds how long the LLM may take to reply, in seconds
+const defaultLLMTimeout = 60
+
+// defaultLLMURL is the API used when 'llm_url' is not set
+const defaultLLMURL = "https://api.openai.com/v1"
+
+// configureLLM sets up the OpenAI-compatible LLM used by 'llm' actions and, if enabled,
+// to answer messages addressed to the bot that no rule matched
+func configureLLM(bot *models.Bot) {
+	llmURL, err := utils.Substitute(bot.LLMURL, map[string]string{})
+	if err != nil {
+		bot.Log.Warnf("Could not set LLM URL: %s", err.Error())
+	}
+	if len(llmURL) == 0 {
+		llmURL = defaultLLMURL
+	}
+	bot.LLMURL = llmURL
+
+	token, err := utils.Substitute(bot.LLMToken, map[string]string{})
+	if err != nil {
+		bot.Log.Warnf("Could not set LLM token: %s", err.Error())
+	}
+	bot.LLMToken = token
+	utils.AddSecret(token)
+
+	if bot.LLMFallback && len(bot.LLMModel) == 0 {
+		bot.Log.Warn("The LLM fallback needs 'llm_model' to be set. Disabling the LLM fallback")
+		bot.LLMFallback = false
+	}
+}
+
+// askLLM sends a prompt to the LLM along with the conversation so far in the message's channel,
+// remembering up to 'history' previous messages of the conversation for next time
+func askLLM(client *llm.Client, systemPrompt, prompt string, history int, message models.Message, onChunk func(chunk string), bot *models.Bot) (string, error) {
+	key := "channel:" + message.ChannelID + "/user:" + message.Vars["_user.id"]
+
+	previous := []llm.Message{}
+	if history > 0 {
+		raw, ok, err := bot.Store.Get(llmHistoryBucket, key)
+		if err != nil {
+			bot.Log.Errorf("Could not load LLM conversation: %s", err.Error())
+		} else if ok {
+			if err := json.Unmarshal(raw, &previous); err != nil {
+				bot.Log.Errorf("Could not load LLM conversation: %s", err.Error())
+			}
+		}
+	}
+
+	conversation := []llm.Message{}
+	if len(systemPrompt) > 0 {
+		conversation = append(conversation, llm.Message{Role: llm.RoleSystem, Content: systemPrompt})
+	}
+	conversation = append(conversation, previous...)
+	conversation = append(conversation, llm.Message{Role: llm.RoleUser, Content: prompt})
+
+	// The request stops with the message's run, e.g. at the rule's timeout or on shutdown
+	reply, err := client.Chat(message.Run.Context(), conversation, onChunk)
+	if err != nil {
+		return reply, err
+	}
+
+	if history > 0 {
+		previous = append(previous, llm.Message{Role: llm.RoleUser, Content: prompt}, llm.Message{Role: llm.RoleAssistant, Content: reply})
+		if len(previous) > history {
+			previous = previous[len(previous)-history:]
+		}
+		raw, err := json.Marshal(previous)
+		if err == nil {
+			err = bot.Store.Set(llmHistoryBucket, key, raw, llmHistoryTTL)
+		}
+		if err != nil {
+			bot.Log.Errorf("Could not save LLM conversation: %s", err.Error())
+		}
+	}
+	return reply, nil
+}
+
+// handleLLM handles 'llm' actions, making the model's reply available as ${_llm_output}
+func handleLLM(action models.Action, msg *models.Message, bot *models.Bot) error {
+	llmURL := bot.LLMURL
+	if len(action.URL) > 0 {
+		llmURL = action.URL
+	}
+	model := bot.LLMModel
+	if len(action.Model) > 0 {
+		model = action.Model
+	}
+	if len(model) == 0 {
+		return fmt.Errorf("no model was supplied for the '%s' action named: %s", action.Type, action.Name)
+	}
+	timeout := action.Timeout
+	if timeout == 0 {
+		timeout = defaultLLMTimeout
+	}
+
+	systemPrompt := bot.LLMSystemPrompt
+	if len(action.SystemPrompt) > 0 {
+		systemPrompt = action.SystemPrompt
+	}
+	systemPrompt, err := utils.Substitute(systemPrompt, msg.Vars)
+	if err != nil {
+		return err
+	}
+
+	// Ask the model what the user said, unless the action phrases the prompt itself
+	prompt := msg.Vars["_raw_user_input"]
+	if len(action.Message) > 0 {
+		prompt, err = utils.Substitute(action.Message, msg.Vars)
+		if err != nil {
+			return err
+		}
+	}
+
+	client := llm.NewClient(llmURL, bot.LLMToken, model, time.Duration(timeout)*time.Second)
+	reply, err := askLLM(client, systemPrompt, prompt, action.History, *msg, nil, bot)
+	if err != nil {
+		msg.Error = translate(*msg, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
+		return err
+	}
+
+	bot.Log.Debugf("Successfully executed action '%s'", action.Name)
+	msg.Vars["_llm_output"] = reply
+	return nil
+}
+
+// handleLLMFallback answers a message no rule matched with the LLM, streaming the reply
+// to chat one paragraph at a time as it is generated
+func handleLLMFallback(outputMsgs chan<- models.Message, message models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	send := func(output string) {
+		output = strings.TrimSpace(output)
+		if len(output) == 0 {
+			return
+		}
+		reply := message
+		reply.Output = output
+		sendOutput(outputMsgs, hitRule, reply, models.Rule{}, bot)
+	}
+
+	var pending strings.Builder
+	onChunk := func(chunk string) {
+		pending.WriteString(chunk)
+		// Send every paragraph that is complete
+		if i := strings.LastIndex(pending.String(), "\n\n"); i >= 0 {
+			text := pending.String()
+			send(text[:i])
+			pending.Reset()
+			pending.WriteString(text[i+2:])
+		}
+	}
+
+	client := llm.NewClient(bot.LLMURL, bot.LLMToken, bot.LLMModel, defaultLLMTimeout*time.Second)
+	_, err := askLLM(client, bot.LLMSystemPrompt, message.Input, bot.LLMHistory, message, onChunk, bot)
+	if err != nil {
+		bot.Log.Errorf("LLM fallback failed: %s", err.Error())
+		if pending.Len() == 0 {
+			pending.WriteString(translate(message, bot, "errors.llm_failed", "Sorry, I can't answer that right now.", nil))
+		}
+	}
+	send(pending.String())
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/target/flottbot/llm"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+// fakeLLM answers with how many messages it was sent, streaming when asked to
+func fakeLLM(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []llm.Message `json:"messages"`
+			Stream   bool          `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("could not decode request: %v", err)
+		}
+		if !req.Stream {
+			fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":"%d messages"}}]}`, len(req.Messages))
+			return
+		}
+		for _, chunk := range []string{"First ", "paragraph.\n\nSec", "ond paragraph."} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+}
+
+func TestHandleLLM(t *testing.T) {
+	server := fakeLLM(t)
+	defer server.Close()
+
+	testBot := new(models.Bot)
+	testBot.Store = memory.New()
+	testBot.LLMURL = server.URL
+	testBot.LLMModel = "test-model"
+
+	action := models.Action{Name: "ask", Type: "llm", SystemPrompt: "Be brief", History: 2}
+
+	// Each call sends the system prompt, the remembered history, and the new prompt
+	for _, want := range []string{"2 messages", "4 messages", "4 messages"} {
+		msg := models.NewMessage()
+		msg.ChannelID = "C1"
+		msg.Vars["_user.id"] = "U1"
+		msg.Vars["_raw_user_input"] = "hello"
+		if err := handleLLM(action, &msg, testBot); err != nil {
+			t.Fatalf("handleLLM() error = %v", err)
+		}
+		if got := msg.Vars["_llm_output"]; got != want {
+			t.Errorf("handleLLM() _llm_output = %q, want %q", got, want)
+		}
+	}
+
+	action.Model = ""
+	testBot.LLMModel = ""
+	msg := models.NewMessage()
+	if err := handleLLM(action, &msg, testBot); err == nil {
+		t.Error("handleLLM() without a model should fail")
+	}
+}
+
+func TestHandleLLMFallback(t *testing.T) {
+	server := fakeLLM(t)
+	defer server.Close()
+
+	testBot := new(models.Bot)
+	testBot.Store = memory.New()
+	testBot.LLMURL = server.URL
+	testBot.LLMModel = "test-model"
+
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+
+	message := models.NewMessage()
+	message.Service = models.MsgServiceChat
+	message.Input = "tell me something"
+	handleLLMFallback(outputMsgs, message, hitRule, testBot)
+	close(outputMsgs)
+
+	got := []string{}
+	for msg := range outputMsgs {
+		got = append(got, msg.Output)
+	}
+	want := []string{"First paragraph.", "Second paragraph."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("handleLLMFallback() sent %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mohae/deepcopy"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// ruleLocks are the locks held by the runs of rules with 'max_concurrent' or 'lock', by bot
+var (
+	ruleLocksMu sync.Mutex
+	ruleLocks   = make(map[*models.Bot]map[string]*ruleLock)
+)
+
+// ruleLock limits how many runs of the rules sharing it happen at once. The other runs wait
+// in line, and take the lock in the order they were triggered.
+type ruleLock struct {
+	running int
+	waiting []chan struct{}
+}
+
+// ruleLockName is the lock a run of a rule has to hold, and how many runs may hold it at once;
+// empty if the rule's runs don't wait for each other. Rules naming the same 'lock' share it, and
+// the name may use the message's variables, e.g. 'deploy-${service}', so that only runs for the
+// same service wait for each other.
+func ruleLockName(rule models.Rule, message models.Message, bot *models.Bot) (string, int) {
+	if rule.MaxConcurrent <= 0 && len(rule.Lock) == 0 {
+		return "", 0
+	}
+	limit := rule.MaxConcurrent
+	if limit <= 0 {
+		limit = 1
+	}
+	if len(rule.Lock) == 0 {
+		return "rule:" + rule.Name, limit
+	}
+	name, err := utils.Substitute(rule.Lock, message.Vars)
+	if err != nil {
+		// Better to wait for more runs than necessary than to race
+		bot.Log.Warnf("Could not fill in the lock of rule '%s', using '%s': %s", rule.Name, rule.Lock, err.Error())
+		name = rule.Lock
+	}
+	return "lock:" + name, limit
+}
+
+// acquireRuleLock takes a lock for a run of a rule. If as many runs as the rule allows hold it
+// already, it returns a channel that is closed once the lock is handed to this run, and the
+// number of runs waiting for it, this one included. The returned function releases the lock.
+func acquireRuleLock(name string, limit int, bot *models.Bot) (func(), <-chan struct{}, int) {
+	ruleLocksMu.Lock()
+	defer ruleLocksMu.Unlock()
+	if ruleLocks[bot] == nil {
+		ruleLocks[bot] = make(map[string]*ruleLock)
+	}
+	lock, ok := ruleLocks[bot][name]
+	if !ok {
+		lock = &ruleLock{}
+		ruleLocks[bot][name] = lock
+	}
+
+	release := func() { releaseRuleLock(name, bot) }
+	if lock.running < limit && len(lock.waiting) == 0 {
+		lock.running++
+		return release, nil, 0
+	}
+	turn := make(chan struct{})
+	lock.waiting = append(lock.waiting, turn)
+	return release, turn, len(lock.waiting)
+}
+
+// releaseRuleLock hands a lock to the run that waited longest for it, if any
+func releaseRuleLock(name string, bot *models.Bot) {
+	ruleLocksMu.Lock()
+	defer ruleLocksMu.Unlock()
+	lock := ruleLocks[bot][name]
+	if len(lock.waiting) > 0 {
+		close(lock.waiting[0])
+		lock.waiting = lock.waiting[1:]
+		return
+	}
+	lock.running--
+	if lock.running == 0 {
+		delete(ruleLocks[bot], name)
+	}
+}
+
+// waitForRuleLock makes a run of a rule wait until it holds the rule's lock, if it has one, and
+// tells whoever triggered the rule that their request is queued. It returns the function that
+// releases the lock.
+func waitForRuleLock(message models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, rule models.Rule, bot *models.Bot) func() {
+	name, limit := ruleLockName(rule, message, bot)
+	if len(name) == 0 {
+		return func() {}
+	}
+	release, turn, position := acquireRuleLock(name, limit, bot)
+	if turn == nil {
+		return release
+	}
+	bot.Log.Debugf("Rule '%s' is already running, queued message %s (%d waiting)", rule.Name, message.ID, position)
+	tellQueued(message, outputMsgs, hitRule, rule, position, bot)
+	<-turn
+	return release
+}
+
+// tellQueued tells whoever triggered a rule that it's already running, and their request is
+// queued. Scheduled runs just wait.
+func tellQueued(message models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, rule models.Rule, position int, bot *models.Bot) {
+	if message.Service != models.MsgServiceChat && message.Service != models.MsgServiceCLI {
+		return
+	}
+	args := map[string]string{"rule": rule.Name, "position": strconv.Itoa(position)}
+	text := translate(message, bot, "rules.queued", "'${rule}' is already running, I queued your request (${position} waiting).", args)
+	if len(rule.QueuedMessage) > 0 {
+		text = rule.QueuedMessage
+		for name, value := range args {
+			text = strings.Replace(text, "${"+name+"}", value, -1)
+		}
+		if substituted, err := utils.Substitute(text, message.Vars); err == nil {
+			text = substituted
+		}
+	}
+	reply := deepcopy.Copy(message).(models.Message)
+	reply.Output = text
+	sendOutput(outputMsgs, hitRule, reply, models.Rule{}, bot)
+}
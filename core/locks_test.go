@@ -0,0 +1,124 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestRuleLockName(t *testing.T) {
+	message := models.NewMessage()
+	message.Vars["service"] = "api"
+
+	tests := []struct {
+		name      string
+		rule      models.Rule
+		wantName  string
+		wantLimit int
+	}{
+		{"No limit", models.Rule{Name: "deploy"}, "", 0},
+		{"Max concurrent", models.Rule{Name: "deploy", MaxConcurrent: 2}, "rule:deploy", 2},
+		{"Lock", models.Rule{Name: "deploy", Lock: "deploys"}, "lock:deploys", 1},
+		{"Lock with variables", models.Rule{Name: "deploy", Lock: "deploy-${service}", MaxConcurrent: 3}, "lock:deploy-api", 3},
+		{"Lock with unknown variables", models.Rule{Name: "deploy", Lock: "deploy-${region}"}, "lock:deploy-${region}", 1},
+	}
+	bot := new(models.Bot)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, limit := ruleLockName(tt.rule, message, bot)
+			if name != tt.wantName || limit != tt.wantLimit {
+				t.Errorf("ruleLockName() = %q, %d, want %q, %d", name, limit, tt.wantName, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestAcquireRuleLock(t *testing.T) {
+	bot := new(models.Bot)
+
+	release1, turn1, _ := acquireRuleLock("lock:deploys", 2, bot)
+	release2, turn2, _ := acquireRuleLock("lock:deploys", 2, bot)
+	if turn1 != nil || turn2 != nil {
+		t.Fatal("acquireRuleLock() made a run wait while the limit wasn't reached")
+	}
+	release3, turn3, position3 := acquireRuleLock("lock:deploys", 2, bot)
+	release4, turn4, position4 := acquireRuleLock("lock:deploys", 2, bot)
+	if turn3 == nil || turn4 == nil || position3 != 1 || position4 != 2 {
+		t.Fatalf("acquireRuleLock() positions = %d, %d, want 1, 2", position3, position4)
+	}
+	if _, turn, _ := acquireRuleLock("lock:other", 1, bot); turn != nil {
+		t.Error("acquireRuleLock() made a run wait for another lock")
+	}
+
+	// The run that waited longest goes first
+	release1()
+	select {
+	case <-turn3:
+	default:
+		t.Fatal("releasing the lock didn't hand it to the first waiting run")
+	}
+	select {
+	case <-turn4:
+		t.Fatal("releasing the lock handed it to the second waiting run")
+	default:
+	}
+	release2()
+	<-turn4
+	release3()
+	release4()
+	if _, ok := ruleLocks[bot]["lock:deploys"]; ok {
+		t.Error("acquireRuleLock() kept a lock nobody holds")
+	}
+}
+
+func TestWaitForRuleLock(t *testing.T) {
+	bot := new(models.Bot)
+	initLogger(bot)
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+
+	tests := []struct {
+		name string
+		rule models.Rule
+		want string
+	}{
+		{"Default reply", models.Rule{Name: "deploy", MaxConcurrent: 1}, "'deploy' is already running, I queued your request (1 waiting)."},
+		{"Custom reply", models.Rule{Name: "deploy", Lock: "deploy-${service}", QueuedMessage: "Deploying ${service} already, you're number ${position}"}, "Deploying api already, you're number 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.Service = models.MsgServiceChat
+			message.Vars["service"] = "api"
+
+			release := waitForRuleLock(message, outputMsgs, hitRule, tt.rule, bot)
+			done := make(chan struct{})
+			go func() {
+				waitForRuleLock(message, outputMsgs, hitRule, tt.rule, bot)()
+				close(done)
+			}()
+
+			select {
+			case reply := <-outputMsgs:
+				<-hitRule
+				if reply.Output != tt.want {
+					t.Errorf("waitForRuleLock() replied %q, want %q", reply.Output, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("waitForRuleLock() didn't tell the second run it's queued")
+			}
+			select {
+			case <-done:
+				t.Fatal("waitForRuleLock() let the second run go while the first one held the lock")
+			case <-time.After(50 * time.Millisecond):
+			}
+			release()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("waitForRuleLock() kept the second run waiting after the lock was released")
+			}
+		})
+	}
+}
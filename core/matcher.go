@@ -2,69 +2,189 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html"
 	"html/template"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/leekchan/gtf"
 	"github.com/mohae/deepcopy"
+	"golang.org/x/crypto/ssh"
 
+	"github.com/target/flottbot/audit"
 	"github.com/target/flottbot/handlers"
+	"github.com/target/flottbot/jsonpath"
 	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
 	"github.com/target/flottbot/utils"
 )
 
-// Matcher will search through the map of loaded rules, determine if a rule was hit, and process said rule to be sent out as a message
+// Matcher will search through the map of loaded rules, determine if a rule was hit, and process said rule to be sent out as a message.
+// With 'workers' in bot.yml, several messages are processed at once, one at a time per conversation.
 func Matcher(inputMsgs <-chan models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) {
+	setCallableRules(bot, rules)
+	p := pipelineOf(bot)
+	match := func(message models.Message) {
+		defer atomic.AddInt64(&p.inFlight, -1)
+		span := tracing.Start(message.TraceParent, "match")
+		defer span.End()
+		// A message that makes matching panic is dropped, the bot goes on with the next one
+		defer recoverPanic("", message, outputMsgs, hitRule, bot)
+		message.TraceParent = span.TraceParent()
+		if !processInput(&message, bot) {
+			return
+		}
+		resolveIdentity(&message, bot)
+		// Where the bot is protected, spam and the messages of ignored users are dropped
+		if !protect(&message, time.Now(), outputMsgs, hitRule, bot) {
+			return
+		}
+		receiveFiles(&message, bot)
+		message.Vars["_event"] = eventName(message.Event)
+		setTimeVars(&message, time.Now())
+		relayBridged(message, bot)
+		// A number may choose one of the options the bot offered
+		answerPrompt(&message, bot)
+		// Answers to the standup questions the bot asked aren't matched against the rules
+		if answerStandup(message, outputMsgs, hitRule, bot) {
+			return
+		}
+		// Rules enabled or disabled from chat are changed before the rules are held for matching
+		applyRuleChanges(rules, bot)
+		p.rulesMu.RLock()
+		defer p.rulesMu.RUnlock()
+		matcherLoop(message, outputMsgs, rules, hitRule, bot)
+	}
+
+	var pool *matchPool
+	if bot.Workers > 1 {
+		pool = newMatchPool(bot.Workers, cap(inputMsgs), match)
+	}
 	for {
 		message := <-inputMsgs
-		matcherLoop(message, outputMsgs, rules, hitRule, bot)
+		atomic.AddInt64(&p.inFlight, 1)
+		// Skip messages another replica of the bot is already handling
+		if !claimMessage(message, bot) {
+			atomic.AddInt64(&p.inFlight, -1)
+			continue
+		}
+		if pool == nil {
+			match(message)
+			continue
+		}
+		pool.submit(message)
 	}
 }
 
 func matcherLoop(message models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) {
 	match := false
+	// In 'all' match mode every matching rule fires, otherwise only the first one does
+	matchAll := strings.ToLower(bot.MatchMode) == matchModeAll
+
+	// Expand the shorthand the message starts with, if any
+	expandAlias(&message, rules, bot)
+
+	// Determine the message's intent for 'intent' rules
+	understandMessage(&message, rules, bot)
+
+	// See whether destructive actions should only say what they would do
+	readDryRun(&message, bot)
+
+	// Canaries are matched in place of their stable version, for the messages they're for
+	versions := canaries(rules)
 
 RuleSearch:
-	// Look through rules to see if we can find a match
-	for _, rule := range rules {
-		// Only check active rules.
-		if rule.Active {
+	// Look through rules, highest priority first, to see if we can find a match
+	for _, rule := range sortRules(rules) {
+		if len(rule.Canary.Of) > 0 {
+			continue
+		}
+		if rule.Active && message.Service != models.MsgServiceScheduler {
+			rule = ruleVersion(rule, versions, message)
+		}
+		// Only check active rules, for the messages they're for (e.g. not edited ones)
+		if rule.Active && ruleEvent(rule, message) {
 			// Init some variables for use below
-			processedInput, hit := getProccessedInputAndHitValue(message.Input, rule.Respond, rule.Hear)
+			processedInput, hit := getProccessedInputAndHitValue(message.Input, rule.Respond, rule.Hear, rule.Match)
+			if len(rule.Intent) > 0 {
+				processedInput, hit = message.Input, rule.Intent == message.Vars["_nlu.intent"]
+			}
+			// Rules with only 'files' or 'events' are hit by any message with a matching file, or of their events
+			if len(rule.Respond) == 0 && len(rule.Hear) == 0 && len(rule.Intent) == 0 && (len(rule.Files) > 0 || len(rule.Events) > 0) {
+				hit = true
+			}
+			// 'files' rules need a file with a matching name
+			if len(rule.Files) > 0 {
+				_, found := matchFile(rule.Files, message)
+				hit = hit && found
+			}
 			// Determine what service we are processing the rule for
 			switch message.Service {
 			case models.MsgServiceChat, models.MsgServiceCLI:
 				foundMatch, stopSearch := handleChatServiceRule(outputMsgs, message, hitRule, rule, processedInput, hit, bot)
-				match = foundMatch
-				if stopSearch {
+				match = match || foundMatch
+				if stopSearch && !matchAll {
 					break RuleSearch
 				}
 			case models.MsgServiceScheduler:
 				foundMatch, stopSearch := handleSchedulerServiceRule(outputMsgs, message, hitRule, rule, bot)
-				match = foundMatch
+				match = match || foundMatch
 				if stopSearch {
 					break RuleSearch
 				}
 			}
 		}
 	}
-	// No rule was matched
-	if !match {
+	// No rule was matched, see if the bot knows how to handle it itself; edits and deletions are only for rules
+	if !match && message.Event == models.MsgEventSent && !handleBuiltinCommand(outputMsgs, message, hitRule, rules, bot) && !handleLearned(outputMsgs, message, hitRule, bot) && !handleKarma(outputMsgs, message, hitRule, bot) && !handleAutoResponse(outputMsgs, message, hitRule, bot) {
 		handleNoMatch(outputMsgs, message, hitRule, rules, bot)
 	}
 }
 
-// getProccessedInputAndHitValue gets the processed input from the message input and the true/false if it was a successfully hit rule
-func getProccessedInputAndHitValue(messageInput, ruleRespondValue, ruleHearValue string) (string, bool) {
+// Supported match modes
+const (
+	matchModeFirst = "first" // only the highest priority matching rule fires
+	matchModeAll   = "all"   // all matching rules fire, in priority order
+)
+
+// sortRules orders rules by descending priority. Rules of equal priority are ordered
+// by name (and then by file), so overlapping triggers always behave the same way.
+func sortRules(rules map[string]models.Rule) []models.Rule {
+	ruleFiles := make([]string, 0, len(rules))
+	for ruleFile := range rules {
+		ruleFiles = append(ruleFiles, ruleFile)
+	}
+	sort.Strings(ruleFiles)
+
+	sorted := make([]models.Rule, 0, len(rules))
+	for _, ruleFile := range ruleFiles {
+		sorted = append(sorted, rules[ruleFile])
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// getProccessedInputAndHitValue gets the processed input from the message input and the true/false if it was a successfully hit rule,
+// following the rule's 'match' options
+func getProccessedInputAndHitValue(messageInput, ruleRespondValue, ruleHearValue string, options models.MatchOptions) (string, bool) {
 	processedInput, hit := "", false
+	messageInput = matchInput(messageInput, options)
 	if len(ruleRespondValue) > 0 {
-		processedInput, hit = utils.Match(ruleRespondValue, messageInput, true)
+		processedInput, hit = utils.MatchCase(matchTrigger(ruleRespondValue, options), messageInput, true, options.CaseSensitive)
 	} else if len(ruleHearValue) > 0 { // Are we listening to everything?
-		_, hit = utils.Match(ruleHearValue, messageInput, false)
+		_, hit = utils.MatchCase(matchTrigger(ruleHearValue, options), messageInput, false, options.CaseSensitive)
 	}
 	return processedInput, hit
 }
@@ -72,7 +192,7 @@ func getProccessedInputAndHitValue(messageInput, ruleRespondValue, ruleHearValue
 // handleChatServiceRule handles the processing logic for a rule that came from either the chat application or CLI remote
 func handleChatServiceRule(outputMsgs chan<- models.Message, message models.Message, hitRule chan<- models.Rule, rule models.Rule, processedInput string, hit bool, bot *models.Bot) (bool, bool) {
 	match, stopSearch := false, false
-	if len(rule.Respond) > 0 || len(rule.Hear) > 0 {
+	if len(rule.Respond) > 0 || len(rule.Hear) > 0 || len(rule.Intent) > 0 || len(rule.Files) > 0 || len(rule.Events) > 0 {
 		// You can only use 'respond' OR 'hear'
 		if len(rule.Respond) > 0 && len(rule.Hear) > 0 {
 			bot.Log.Debugf("Rule '%s' has both 'hear' and 'match' or 'respond' defined. Please choose one or the other", rule.Name)
@@ -82,8 +202,8 @@ func handleChatServiceRule(outputMsgs chan<- models.Message, message models.Mess
 			bot.Log.Debugf("Rule '%s' has both 'args' and 'hear' set. To use 'args', use 'respond' instead of 'hear'", rule.Name)
 		}
 
-		// if it's a 'respond' rule, make sure the bot was mentioned
-		if hit && len(rule.Respond) > 0 && !message.BotMentioned && message.Type != models.MsgTypeDirect {
+		// if it's a 'respond' or 'intent' rule, make sure the bot was mentioned
+		if hit && (len(rule.Respond) > 0 || len(rule.Intent) > 0) && !message.BotMentioned && message.Type != models.MsgTypeDirect {
 			return match, stopSearch
 		}
 
@@ -93,30 +213,62 @@ func handleChatServiceRule(outputMsgs chan<- models.Message, message models.Mess
 			match, stopSearch = true, true
 			// Publish metric to prometheus - metricname will be combination of bot name and rule name
 			Prommetric(bot.Name+"-"+rule.Name, bot)
+			countRuleVersion(rule, bot)
 			// Capture untouched user input
 			message.Vars["_raw_user_input"] = message.Input
 			// Do additional checks on the rule before running
 			if !isValidHitChatRule(&message, rule, processedInput, bot) {
-				outputMsgs <- message
-				hitRule <- models.Rule{}
+				sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+				auditRule(audit.StatusRejected, rule, message, nil, time.Now(), bot)
 				// prevent actions from being run; exit early
 				return match, stopSearch
 			}
+			// Rules whose 'when' isn't true leave the message to the rules after them
+			if !ruleWhen(rule, message, bot) {
+				return false, false
+			}
+			// Identical triggers within the rule's 'debounce' window run it once
+			if debounced(rule, message, bot) {
+				bot.Log.Infof("Rule '%s' already ran for this within its debounce window of %s, skipping it", rule.Name, rule.Debounce)
+				return match, stopSearch
+			}
 			msg := deepcopy.Copy(message).(models.Message)
-			go doRuleActions(msg, outputMsgs, rule, hitRule, bot)
+			// ${_rule.version} is which version of a rule with a canary runs
+			if len(rule.Version) > 0 {
+				msg.Vars["_rule.version"] = rule.Version
+			}
+			// ${_file.*} is the file a 'files' rule was hit by
+			if file, ok := matchFile(rule.Files, msg); ok {
+				setFileVars(file, &msg)
+			}
+			inBackground(bot, func() { doRuleActions(msg, outputMsgs, rule, hitRule, bot) })
 			return match, stopSearch
 		}
 	}
 	return match, stopSearch
 }
 
+// inBackground runs a rule's work, e.g. its actions, without holding up the matcher.
+// The work counts as running until it's done, so shutting down can wait for it.
+func inBackground(bot *models.Bot, work func()) {
+	p := pipelineOf(bot)
+	atomic.AddInt64(&p.runningRules, 1)
+	go func() {
+		defer atomic.AddInt64(&p.runningRules, -1)
+		work()
+	}()
+}
+
 // handleSchedulerServiceRule handles the processing logic for a rule that came from the Scheduler remote
 func handleSchedulerServiceRule(outputMsgs chan<- models.Message, message models.Message, hitRule chan<- models.Rule, rule models.Rule, bot *models.Bot) (bool, bool) {
 	match, stopSearch := false, false
 	if len(rule.Schedule) > 0 && rule.Name == message.Attributes["from_schedule"] {
 		match, stopSearch = true, true // Don't go through more rules if rule is matched
+		if !ruleWhen(rule, message, bot) {
+			return match, stopSearch
+		}
 		msg := deepcopy.Copy(message).(models.Message)
-		go doRuleActions(msg, outputMsgs, rule, hitRule, bot)
+		inBackground(bot, func() { doRuleActions(msg, outputMsgs, rule, hitRule, bot) })
 		return match, stopSearch
 	}
 	return match, stopSearch
@@ -126,6 +278,13 @@ func handleSchedulerServiceRule(outputMsgs chan<- models.Message, message models
 func handleNoMatch(outputMsgs chan<- models.Message, message models.Message, hitRule chan<- models.Rule, rules map[string]models.Rule, bot *models.Bot) {
 	// If bot was addressed or was private messaged, print help text by default
 	if message.Type == models.MsgTypeDirect || message.BotMentioned {
+		// Let the LLM answer instead, if configured
+		if bot.LLMFallback && message.Service == models.MsgServiceChat {
+			bot.Log.Debug("Bot was addressed, but no rule matched. Asking the LLM")
+			Prommetric(bot.Name+"-LLM", bot)
+			inBackground(bot, func() { handleLLMFallback(outputMsgs, message, hitRule, bot) })
+			return
+		}
 		bot.Log.Debug("Bot was addressed, but no rule matched. Showing help")
 		// Publish metric as none
 		Prommetric(bot.Name+"-None", bot)
@@ -133,7 +292,7 @@ func handleNoMatch(outputMsgs chan<- models.Message, message models.Message, hit
 		helpMsg := bot.CustomHelpText
 		// If custom_help_text is not set, use default Help Text, for each rule use help_text from rule file
 		if len(helpMsg) == 0 {
-			helpMsg = "I understand these commands: \n"
+			helpMsg = translate(message, bot, "help.header", "I understand these commands: \n", nil)
 			// Go through all the rules and collect the help_text
 			for _, rule := range rules {
 				// Is the rule active and does the user want to expose the help for it? 'hear' rules don't show in help by default
@@ -144,35 +303,73 @@ func handleNoMatch(outputMsgs chan<- models.Message, message models.Message, hit
 		}
 		// Populate output with help text defined above
 		message.Output = helpMsg
-		outputMsgs <- message
-		hitRule <- models.Rule{}
+		sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+	}
+}
+
+// ruleWhen evaluates a rule's 'when' expression (see utils.Expression) against a message, e.g.
+// when: ${_user.email} endsWith '@corp.com' && ${env} != 'prod'. Rules without one always run.
+func ruleWhen(rule models.Rule, message models.Message, bot *models.Bot) bool {
+	if len(rule.When) == 0 {
+		return true
 	}
+	ok, err := utils.EvaluateExpression(rule.When, message.Vars)
+	if err != nil {
+		bot.Log.Errorf("Could not evaluate 'when' of rule '%s', not running it: %s", rule.Name, err.Error())
+		return false
+	}
+	if !ok {
+		bot.Log.Debugf("Rule '%s' doesn't run, its 'when' is false", rule.Name)
+	}
+	return ok
 }
 
 // isValidHitChatRule does additional checks on a successfully hit rule that came from the chat or CLI service
 func isValidHitChatRule(message *models.Message, rule models.Rule, processedInput string, bot *models.Bot) bool {
 	// Check to honor allow_users or allow_usergroups
-	canRunRule := utils.CanTrigger(message.Vars["_user.name"], message.Vars["_user.id"], rule, bot)
+	canRunRule := canTrigger(*message, rule, bot)
 	if !canRunRule {
-		message.Output = fmt.Sprintf("You are not allowed to run the '%s' rule.", rule.Name)
+		message.Output = translate(*message, bot, "errors.not_allowed_rule", "You are not allowed to run the '${rule}' rule.", map[string]string{"rule": rule.Name})
 		// forcing direct message
 		message.DirectMessageOnly = true
 		message.Type = models.MsgTypeDirect
 		return false
 	}
+	// Intent rules get their variables from the entities the NLU service recognized
+	if len(rule.Intent) > 0 {
+		fillSlots(rule, message)
+		return true
+	}
 	// If this wasn't a 'hear' rule, handle the args
 	if len(rule.Hear) == 0 {
 		// Get all the args that the message sender supplied
 		args := utils.FindArgs(processedInput)
+		// Take out the flags the rule declares, and check them
+		if len(rule.Flags) > 0 {
+			positional, flags, err := parseFlags(rule, args)
+			if err != nil {
+				message.Output = translate(*message, bot, "errors.invalid_args", "${error}. This is what I'm looking for\n```${usage}```", map[string]string{"error": err.Error(), "usage": ruleUsage(rule)})
+				return false
+			}
+			args = positional
+			for name, value := range flags {
+				message.Vars[name] = value
+			}
+		}
 		// Are we expecting a number of args but don't have as many as the rule defines? Send a helpful message
-		if len(rule.Args) > 0 && len(args) < len(rule.Args) {
-			msg := fmt.Sprintf("You might be missing an argument or two. This is what I'm looking for\n```%s```", rule.HelpText)
-			message.Output = msg
+		if len(rule.Args) > 0 && len(args) < requiredArgs(rule) {
+			message.Output = translate(*message, bot, "errors.missing_args", "You might be missing an argument or two. This is what I'm looking for\n```${usage}```", map[string]string{"usage": ruleUsage(rule)})
 			return false
 		}
 		// Go through the supplied args and make them available as variables
 		for i, arg := range rule.Args {
-			message.Vars[arg] = args[i]
+			if i < len(args) {
+				message.Vars[arg] = args[i]
+			}
+		}
+		if err := checkArgTypes(rule, *message); err != nil {
+			message.Output = translate(*message, bot, "errors.invalid_args", "${error}. This is what I'm looking for\n```${usage}```", map[string]string{"error": err.Error(), "usage": ruleUsage(rule)})
+			return false
 		}
 	}
 	return true
@@ -180,51 +377,78 @@ func isValidHitChatRule(message *models.Message, rule models.Rule, processedInpu
 
 // core handler routing for all allowed actions
 func doRuleActions(message models.Message, outputMsgs chan<- models.Message, rule models.Rule, hitRule chan<- models.Rule, bot *models.Bot) {
+	defer recoverPanic(rule.Name, message, outputMsgs, hitRule, bot)
+	start := time.Now()
+	span := tracing.Start(message.TraceParent, "rule "+rule.Name)
+	span.SetAttribute("rule.name", rule.Name)
+	defer span.End()
+	message.TraceParent = span.TraceParent()
+
 	// React to message which triggered rule
 	if len(rule.Reaction) > 0 {
 		copyrule := deepcopy.Copy(rule).(models.Rule)
 		copymessage := deepcopy.Copy(message).(models.Message)
-		handleReaction(outputMsgs, &copymessage, hitRule, copyrule)
-	}
-
-	// Deal with the actions associated with the rule asynchronously
-	for _, action := range rule.Actions {
-		var err error
-
-		switch strings.ToLower(action.Type) {
-		// HTTP actions.
-		case "get", "post", "put":
-			bot.Log.Debugf("Executing action '%s'...", action.Name)
-			err = handleHTTP(action, &message, bot)
-		// Exec (script) actions
-		case "exec":
-			bot.Log.Debugf("Executing action '%s'...", action.Name)
-			err = handleExec(action, &message, bot)
-		// Normal message/log actions
-		case "message", "log":
-			bot.Log.Debugf("Executing action '%s'...", action.Name)
-			// Log actions cannot direct message users by default
-			directive := rule.DirectMessageOnly
-			if action.Type == "log" {
-				directive = false
-			}
-			// Create copy of message so as to not overwrite other message action type messages
-			copy := deepcopy.Copy(message).(models.Message)
-			err = handleMessage(action, outputMsgs, &copy, directive, rule.StartMessageThread, hitRule, bot)
-		// Fallback to error if action type is invalid
-		default:
-			bot.Log.Errorf("The rule '%s' of type %s is not a supported action", action.Name, action.Type)
-		}
+		handleReaction(outputMsgs, &copymessage, hitRule, copyrule, bot)
+	}
 
-		// Handle reaction update
-		updateReaction(action, &rule, message.Vars, bot)
+	// Wait for the other runs holding the rule's lock, if it has one
+	defer waitForRuleLock(message, outputMsgs, hitRule, rule, bot)()
 
-		// Handle error
-		if err != nil {
-			bot.Log.Error(err)
+	// Stop the run's requests and scripts once it reaches the rule's 'timeout'
+	ctx, cancel := ruleContext(message, rule, bot)
+	defer cancel()
+	message.Run = models.NewRunContext(ctx)
+
+	// Load any remembered values the rule asked for
+	recallMemory(rule, &message, bot)
+
+	// Give the variables the rule declares their values and types
+	if err := declareVars(rule, &message, bot); err != nil {
+		bot.Log.Debugf("Rule '%s' doesn't run: %s", rule.Name, err.Error())
+		message.Output = err.Error()
+		sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+		auditRule(audit.StatusRejected, rule, message, nil, start, bot)
+		return
+	}
+
+	// Track long rules as jobs people can check on, and admins cancel
+	var j *job
+	if rule.Job {
+		j = startJob(&message, outputMsgs, hitRule, rule, bot)
+	}
+
+	// Make a place for the files the rule's actions save
+	defer prepareArtifacts(rule, &message, bot)()
+
+	// Deal with the actions associated with the rule, one after the other unless
+	// the rule lets them run concurrently
+	var results []audit.ActionResult
+	if rule.ParallelActions {
+		results = runActionGraph(&message, outputMsgs, &rule, hitRule, span, bot)
+	} else {
+		for _, action := range rule.Actions {
+			if runCancelled(message) {
+				break
+			}
+			setJobAction(j, action.Name)
+			result := runActionSafely(action, &message, outputMsgs, rule, hitRule, span, bot)
+			results = append(results, result)
+			// Handle reaction update
+			if !result.Skipped {
+				updateReaction(action, &rule, message.Vars, bot)
+			}
+			if result.Aborted {
+				break
+			}
 		}
 	}
 
+	// Store any values the rule wants remembered
+	rememberMemory(rule, &message, bot)
+
+	// Keep the values of the rule's conversation and global variables for its next runs
+	keepVars(rule, message, bot)
+
 	// Match supplied room names to IDs
 	message.OutputToRooms = utils.GetRoomIDs(rule.OutputToRooms, bot)
 
@@ -233,34 +457,62 @@ func doRuleActions(message models.Message, outputMsgs chan<- models.Message, rul
 
 	// Start a thread if the message is not already part of a thread and
 	// start_message_thread was set for the Rule
-	if rule.StartMessageThread && len(message.ThreadTimestamp) == 0 {
-		message.ThreadTimestamp = message.Timestamp
+	if rule.StartMessageThread {
+		message.StartThread = true
 	}
 
 	// After running through all the actions, compose final message
 	val, err := craftResponse(rule, message, bot)
 	if err != nil {
 		bot.Log.Error(err)
+		span.SetError(err)
 		message.Output = err.Error()
-		outputMsgs <- message
 	} else {
 		message.Output = val
+		// Add the rule's results as a table, CSV file, or chart
+		applyFormat(rule, &message, bot)
+		// Upload the files the rule asks for
+		uploadArtifacts(rule, &message, bot)
 		// Override out with an error message, if one was set
 		if len(message.Error) > 0 {
 			message.Output = message.Error
 		}
 		// Pass along whether the message should be a direct message
 		message.DirectMessageOnly = rule.DirectMessageOnly
-		outputMsgs <- message
 	}
-	// Channel completed rule
-	hitRule <- rule
+	// Show what the destructive actions would have done in a dry run
+	dryRunOutput(&message, bot)
+	// Tell how the job went
+	if j != nil {
+		finishJob(j, &message, rule, results, bot)
+	}
+	// Channel completed rule, unless its output is collected for a digest
+	if !addToDigest(rule, message, time.Now(), bot) {
+		sendOutput(outputMsgs, hitRule, message, rule, bot)
+	}
+
+	// Keep a trail of who ran the rule
+	auditRule(audit.StatusCompleted, rule, message, results, start, bot)
+}
+
+// ruleContext is the context of a run of a rule, with the rule's 'timeout' as deadline
+func ruleContext(message models.Message, rule models.Rule, bot *models.Bot) (context.Context, context.CancelFunc) {
+	if len(rule.Timeout) == 0 {
+		return context.WithCancel(message.Run.Context())
+	}
+	timeout, err := time.ParseDuration(rule.Timeout)
+	if err != nil || timeout <= 0 {
+		bot.Log.Warnf("Invalid timeout '%s' for rule '%s', running it without one", rule.Timeout, rule.Name)
+		return context.WithCancel(message.Run.Context())
+	}
+	return context.WithTimeout(message.Run.Context(), timeout)
 }
 
 // craftResponse handles format_output to make the final message from the bot user-friendly
 func craftResponse(rule models.Rule, msg models.Message, bot *models.Bot) (string, error) {
-	// The user removed the 'format_output' field, or it's not set
-	if len(rule.FormatOutput) == 0 {
+	// The user removed the 'format_output' field, or it's not set; it's optional
+	// when the rule's results are shown with 'format' or a 'template'
+	if len(rule.FormatOutput) == 0 && len(rule.Format) == 0 && len(rule.FormatItem) == 0 && len(rule.Template.Name) == 0 {
 		return "", errors.New("Hmm, the 'format_output' field in your configuration is empty")
 	}
 
@@ -279,8 +531,31 @@ func craftResponse(rule models.Rule, msg models.Message, bot *models.Bot) (strin
 		bot.Log.Debugf("The rule '%s' has 'direct_message_only' set, 'output_to_rooms' will be ignored", rule.Name)
 	}
 
+	// Render a line per item of the rule's 'for_each', shown on their own unless 'format_output' shows them
+	formatOutput := rule.FormatOutput
+	if len(rule.FormatItem) > 0 {
+		if err := formatItems(rule, &msg, bot); err != nil {
+			return "", err
+		}
+		if len(formatOutput) == 0 {
+			formatOutput = "${_items}"
+		}
+	}
+
+	// Render the rule's 'template', shown on its own unless 'format_output' shows it
+	if len(rule.Template.Name) > 0 {
+		text, err := renderTemplate(rule.Template, msg, bot)
+		if err != nil {
+			return "", err
+		}
+		msg.Vars["_template"] = text
+		if len(formatOutput) == 0 {
+			formatOutput = "${_template}"
+		}
+	}
+
 	// Use FormatOutput as source for output and find variables and replace content the variable exists
-	output, err := utils.Substitute(rule.FormatOutput, msg.Vars)
+	output, err := utils.Substitute(translateRefs(formatOutput, msg, bot), msg.Vars)
 
 	// Check if the value contains html/template code, for advanced formatting
 	if strings.Contains(output, "{{") {
@@ -304,14 +579,164 @@ func craftResponse(rule models.Rule, msg models.Message, bot *models.Bot) (strin
 	return output, err
 }
 
+// runAction runs one of a rule's actions, unless its 'run_if' or 'skip_if' condition says otherwise,
+// or once for each item of its 'for_each'
+func runAction(action models.Action, message *models.Message, outputMsgs chan<- models.Message, rule models.Rule, hitRule chan<- models.Rule, span *tracing.Span, bot *models.Bot) audit.ActionResult {
+	// Actions with 'for_each' run once per item
+	if len(action.ForEach) > 0 {
+		return runActionForEach(action, message, outputMsgs, rule, hitRule, span, bot)
+	}
+
+	result := audit.ActionResult{Name: action.Name, Type: action.Type}
+
+	run, err := shouldRunAction(action, message.Vars)
+	if err != nil {
+		bot.Log.Errorf("Could not evaluate the conditions of action '%s': %s", action.Name, err.Error())
+		result.Error = utils.Redact(err.Error())
+		return result
+	}
+	if !run {
+		bot.Log.Debugf("Skipping action '%s'", action.Name)
+		result.Skipped = true
+		return result
+	}
+
+	actionStart := time.Now()
+
+	// Trace each action as a child of the rule, so outbound requests and messages are attributed to it
+	actionSpan := tracing.Start(span.TraceParent(), "action "+action.Name)
+	actionSpan.SetAttribute("action.type", action.Type)
+	message.TraceParent = actionSpan.TraceParent()
+
+	switch strings.ToLower(action.Type) {
+	// HTTP actions.
+	case "get", "post", "put":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		if isDryRun(action, message) {
+			err = dryRunAction(action, message, bot)
+			break
+		}
+		if fixture, ok := findFixture(rule, action); ok {
+			err = mockHTTP(fixture, action, message, bot)
+			break
+		}
+		err = handleHTTP(action, message, bot)
+	// LLM actions
+	case "llm":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		err = handleLLM(action, message, bot)
+	// SQL query actions
+	case "sql":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		err = handleSQL(action, message, bot)
+	// Message broker publish actions
+	case "publish":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		err = handlePublish(action, message, bot)
+	// Prometheus query and Alertmanager silence actions
+	case "prometheus":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		err = handlePrometheus(action, message, bot)
+	case "silence":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		err = handleSilence(action, message, bot)
+	// Grafana panel image actions
+	case "grafana":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		err = handleGrafana(action, message, bot)
+	// On-call lookup actions
+	case "oncall":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		err = handleOnCall(action, message, bot)
+	// Email actions
+	case "email":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		err = handleEmail(action, message, bot)
+	// Remote command actions
+	case "ssh":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		if isDryRun(action, message) {
+			err = dryRunAction(action, message, bot)
+			break
+		}
+		if fixture, ok := findFixture(rule, action); ok {
+			err = mockScript(fixture, "_ssh", message)
+			break
+		}
+		err = handleSSH(action, message, bot)
+	// Actions pausing the rule's run
+	case "wait":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		err = handleWait(action, message, bot)
+	// Actions running another rule
+	case "call_rule":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		err = handleCallRule(action, message, outputMsgs, hitRule, actionSpan, bot)
+	// Exec (script) actions
+	case "exec":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		if isDryRun(action, message) {
+			err = dryRunAction(action, message, bot)
+			break
+		}
+		if fixture, ok := findFixture(rule, action); ok {
+			err = mockScript(fixture, "_exec", message)
+			break
+		}
+		err = handleExec(action, outputMsgs, message, rule, hitRule, bot)
+	// Normal message/log actions
+	case "message", "log":
+		bot.Log.Debugf("Executing action '%s'...", action.Name)
+		// Log actions cannot direct message users by default
+		directive := rule.DirectMessageOnly
+		if action.Type == "log" {
+			directive = false
+		}
+		// Create copy of message so as to not overwrite other message action type messages
+		copy := deepcopy.Copy(*message).(models.Message)
+		// Files go with the rule's output, not with every message
+		copy.Files = nil
+		err = handleMessage(action, outputMsgs, &copy, directive, rule.StartMessageThread, hitRule, bot)
+	// Fallback to error if action type is invalid
+	default:
+		bot.Log.Errorf("The rule '%s' of type %s is not a supported action", action.Name, action.Type)
+	}
+
+	actionSpan.SetError(err)
+	actionSpan.End()
+	message.TraceParent = span.TraceParent()
+
+	result.DurationMS = int64(time.Since(actionStart) / time.Millisecond)
+	if err != nil {
+		result.Error = utils.Redact(err.Error())
+		// Handle error
+		bot.Log.Error(err)
+		// A cancelled run just stops, without the action's 'on_error' handling
+		result.Aborted = runCancelled(*message) || handleActionError(action, err, message, outputMsgs, rule, hitRule, span, bot)
+	}
+	return result
+}
+
 // Handle script execution actions
-func handleExec(action models.Action, msg *models.Message, bot *models.Bot) error {
+func handleExec(action models.Action, outputMsgs chan<- models.Message, msg *models.Message, rule models.Rule, hitRule chan<- models.Rule, bot *models.Bot) error {
 	if len(action.Cmd) == 0 {
 		return fmt.Errorf("no command was supplied for the '%s' action named: %s", action.Type, action.Name)
 	}
 
-	resp := &models.ScriptResponse{}
-	resp, err := handlers.ScriptExec(action, msg, bot)
+	// Stream what the script prints to the message's thread while it runs
+	var onOutput func(string)
+	if action.StreamOutput {
+		onOutput = func(output string) {
+			update := *msg
+			update.Output = "```\n" + output + "\n```"
+			update.Files = nil
+			update.DirectMessageOnly = rule.DirectMessageOnly
+			update.StartThread = true
+			sendOutput(outputMsgs, hitRule, update, models.Rule{}, bot)
+		}
+	}
+
+	resp, err := handlers.ScriptExecStream(action, msg, bot, onOutput)
 
 	// Set explicit variables to make script output, script status code accessible in rules
 	msg.Vars["_exec_output"] = resp.Output
@@ -324,6 +749,38 @@ func handleExec(action models.Action, msg *models.Message, bot *models.Bot) erro
 	return nil
 }
 
+// handleSSH handles 'ssh' actions, making the command's output and exit status available
+// as ${_ssh_output} and ${_ssh_status}. The bot's 'ssh_user' and 'ssh_key' are used unless
+// the action has its own.
+func handleSSH(action models.Action, msg *models.Message, bot *models.Bot) error {
+	if len(action.Cmd) == 0 {
+		return fmt.Errorf("no command was supplied for the '%s' action named: %s", action.Type, action.Name)
+	}
+	if len(action.User) == 0 {
+		action.User = bot.SSHUser
+	}
+	if len(action.SSHKey) == 0 {
+		action.SSHKey = bot.SSHKey
+	}
+
+	resp, err := handlers.SSHExec(action, msg, bot.SSHKnownHosts)
+
+	msg.Vars["_ssh_output"] = resp.Output
+	msg.Vars["_ssh_status"] = strconv.Itoa(resp.Status)
+
+	// Like with 'exec' actions, the output of failed commands is left for the rule to show
+	if _, ran := err.(*ssh.ExitError); ran {
+		return err
+	}
+	if err != nil {
+		msg.Error = translate(*msg, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
+		return err
+	}
+
+	bot.Log.Debugf("Successfully executed action '%s'", action.Name)
+	return nil
+}
+
 // Handle HTTP call actions
 func handleHTTP(action models.Action, msg *models.Message, bot *models.Bot) error {
 	if len(action.URL) == 0 {
@@ -331,11 +788,17 @@ func handleHTTP(action models.Action, msg *models.Message, bot *models.Bot) erro
 	}
 
 	resp := &models.HTTPResponse{}
-	resp, err := handlers.HTTPReq(action, msg)
+	resp, err := handlers.HTTPReq(withHTTPDefaults(action, bot), msg)
 	if err != nil {
-		msg.Error = fmt.Sprintf("Error in request made by action '%s'. See bot admin for more information", action.Name)
+		msg.Error = translate(*msg, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
 		return err
 	}
+	return handleHTTPResponse(action, resp, msg, bot)
+}
+
+// handleHTTPResponse makes the response of an HTTP call action available to the rule
+func handleHTTPResponse(action models.Action, resp *models.HTTPResponse, msg *models.Message, bot *models.Bot) error {
+	var err error
 
 	// Just a friendly debugger warning on failed requests
 	if resp.Status >= 400 {
@@ -347,6 +810,11 @@ func handleHTTP(action models.Action, msg *models.Message, bot *models.Bot) erro
 	// Set explicit variables to make raw response output, http status code accessible in rules
 	msg.Vars["_raw_http_output"] = resp.Raw
 	msg.Vars["_raw_http_status"] = strconv.Itoa(resp.Status)
+	if len(resp.Artifact) > 0 {
+		msg.Vars["_artifact.path"] = resp.Artifact
+		msg.Vars["_artifact.name"] = filepath.Base(resp.Artifact)
+		msg.Vars["_artifact.size"] = strconv.FormatInt(resp.ArtifactSize, 10)
+	}
 
 	// Do we need to expose any fields?
 	if len(action.ExposeJSONFields) > 0 {
@@ -379,6 +847,56 @@ func handleHTTP(action models.Action, msg *models.Message, bot *models.Bot) erro
 		}
 	}
 
+	// Extract fields with JSONPath or jq-style paths
+	if len(action.Extract) > 0 {
+		if err := extractFields(action, resp.Raw, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withHTTPDefaults gives an action the bot's TLS and proxy settings, unless it has its own
+func withHTTPDefaults(action models.Action, bot *models.Bot) models.Action {
+	if len(action.TLSCert) == 0 && len(action.TLSKey) == 0 {
+		action.TLSCert, action.TLSKey = bot.HTTPTLSCert, bot.HTTPTLSKey
+	}
+	if len(action.TLSCA) == 0 {
+		action.TLSCA = bot.HTTPTLSCA
+	}
+	if len(action.Proxy) == 0 {
+		action.Proxy = bot.HTTPProxy
+	}
+	return action
+}
+
+// extractFields makes the values found in a JSON response by the action's 'extract' paths available as variables
+func extractFields(action models.Action, raw string, msg *models.Message) error {
+	data, err := jsonpath.Decode([]byte(raw))
+	if err != nil {
+		return fmt.Errorf("Could not extract fields for action '%s', the response is not JSON: %s", action.Name, err.Error())
+	}
+
+	for name, expr := range action.Extract {
+		expr, err := utils.Substitute(expr, msg.Vars)
+		if err != nil {
+			return err
+		}
+		path, err := jsonpath.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("Could not extract '%s' for action '%s': %s", name, action.Name, err.Error())
+		}
+		values, err := path.Evaluate(data)
+		if err != nil {
+			return fmt.Errorf("Could not extract '%s' for action '%s': %s", name, action.Name, err.Error())
+		}
+		value, err := jsonpath.String(values)
+		if err != nil {
+			return fmt.Errorf("Could not extract '%s' for action '%s': %s", name, action.Name, err.Error())
+		}
+		msg.Vars[name] = value
+	}
 	return nil
 }
 
@@ -388,8 +906,8 @@ func handleMessage(action models.Action, outputMsgs chan<- models.Message, msg *
 		return fmt.Errorf("No message was set")
 	}
 
-	if action.Type == "message" && startMsgThread && len(msg.ThreadTimestamp) == 0 {
-		msg.ThreadTimestamp = msg.Timestamp
+	if action.Type == "message" && startMsgThread {
+		msg.StartThread = true
 	}
 
 	// Get message output from action
@@ -416,15 +934,13 @@ func handleMessage(action models.Action, outputMsgs chan<- models.Message, msg *
 	// Set message directive
 	msg.DirectMessageOnly = direct
 	// Send out message
-	outputMsgs <- *msg
-	hitRule <- models.Rule{}
+	sendOutput(outputMsgs, hitRule, *msg, models.Rule{}, bot)
 	return nil
 }
 
 // Handle initial emoji reaction when rule is matched
-func handleReaction(outputMsgs chan<- models.Message, msg *models.Message, hitRule chan<- models.Rule, rule models.Rule) {
-	outputMsgs <- *msg
-	hitRule <- rule
+func handleReaction(outputMsgs chan<- models.Message, msg *models.Message, hitRule chan<- models.Rule, rule models.Rule, bot *models.Bot) {
+	sendOutput(outputMsgs, hitRule, *msg, rule, bot)
 }
 
 // Update emoji reaction when specified
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/target/flottbot/models"
 )
@@ -192,7 +195,7 @@ func TestHandleExec(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := handleExec(tt.args.action, tt.args.msg, tt.args.bot)
+			err := handleExec(tt.args.action, nil, tt.args.msg, models.Rule{}, nil, tt.args.bot)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("handleExec() error = \"%v\", wantErr %v", err, tt.wantErr)
 				return
@@ -209,6 +212,29 @@ func TestHandleExec(t *testing.T) {
 	}
 }
 
+func TestHandleExecStreaming(t *testing.T) {
+	bot := new(models.Bot)
+	msg := models.NewMessage()
+	msg.ReplyToID = "1554821760.000200"
+	action := models.Action{Name: "Test", Type: "exec", Cmd: `/bin/sh -c "echo one; echo two"`, StreamOutput: true}
+
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+	if err := handleExec(action, outputMsgs, &msg, models.Rule{Name: "Test"}, hitRule, bot); err != nil {
+		t.Fatalf("handleExec() error = %v", err)
+	}
+	if msg.Vars["_exec_output"] != "one\ntwo" {
+		t.Errorf("handleExec() output = %q", msg.Vars["_exec_output"])
+	}
+	if len(outputMsgs) != 1 {
+		t.Fatalf("handleExec() streamed %d messages, want 1", len(outputMsgs))
+	}
+	streamed := <-outputMsgs
+	if streamed.Output != "```\none\ntwo\n```" || streamed.OutputThread() != msg.ReplyToID {
+		t.Errorf("handleExec() streamed %q in thread %q", streamed.Output, streamed.OutputThread())
+	}
+}
+
 func TestHandleHTTP(t *testing.T) {
 	type args struct {
 		action models.Action
@@ -483,7 +509,7 @@ func TestHandleReaction(t *testing.T) {
 		test.args.msg.Output = test.wantMessage
 		test.args.rule.Name = test.wantRuleName
 		// Do test
-		handleReaction(test.args.outputMsgs, test.args.msg, test.args.hitRule, test.args.rule)
+		handleReaction(test.args.outputMsgs, test.args.msg, test.args.hitRule, test.args.rule, new(models.Bot))
 		resultMsg := <-testOutputMsgs
 		resultRule := <-testHitRule
 		if test.wantMessage != resultMsg.Output {
@@ -579,7 +605,7 @@ func Test_getProccessedInputAndHitValue(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1 := getProccessedInputAndHitValue(tt.args.messageInput, tt.args.ruleRespondValue, tt.args.ruleHearValue)
+			got, got1 := getProccessedInputAndHitValue(tt.args.messageInput, tt.args.ruleRespondValue, tt.args.ruleHearValue, models.MatchOptions{})
 			if got != tt.want {
 				t.Errorf("getProccessedInputAndHitValue() got = %v, want %v", got, tt.want)
 			}
@@ -683,6 +709,9 @@ func Test_handleChatServiceRule(t *testing.T) {
 		BotMentioned: true,
 	}
 
+	ruleWithWhen := rule
+	ruleWithWhen.When = "${arg2} == 'other'"
+
 	testMessageBotNotMentioned := models.Message{
 		Input:      "foo arg1 arg2",
 		Vars:       map[string]string{},
@@ -705,6 +734,7 @@ func Test_handleChatServiceRule(t *testing.T) {
 		{"basic", args{}, false, false, ""},
 		{"respond rule - hit false", args{rule: rule, hit: false}, false, false, ""},
 		{"respond rule - hit true - valid", args{rule: rule, hit: true, bot: testBot, message: testMessage, processedInput: "arg1 arg2"}, true, true, "Hmm, the 'format_output' field in your configuration is empty"},
+		{"respond rule - hit true - when false", args{rule: ruleWithWhen, hit: true, bot: testBot, message: testMessage, processedInput: "arg1 arg2"}, false, false, ""},
 		{"respond rule - hit true - bot not mentioned", args{rule: rule, hit: true, bot: testBot, message: testMessageBotNotMentioned, processedInput: "arg1 arg2"}, false, false, ""},
 		{"respond rule - hit true - valid - not enough args", args{rule: rule, hit: true, bot: testBot, message: testMessageNotEnoughArgs, processedInput: "arg1"}, true, true, "You might be missing an argument or two. This is what I'm looking for\n```foo <arg1> <arg2>```"},
 		{"respond rule - hit true - invalid", args{rule: rule, hit: true, bot: testBot, message: testMessage}, true, true, "You might be missing an argument or two. This is what I'm looking for\n```foo <arg1> <arg2>```"},
@@ -778,6 +808,8 @@ func Test_handleSchedulerServiceRule(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			tt.args.outputMsgs = make(chan models.Message, 1)
+			tt.args.hitRule = make(chan models.Rule, 1)
 			got, got1 := handleSchedulerServiceRule(tt.args.outputMsgs, tt.args.message, tt.args.hitRule, tt.args.rule, tt.args.bot)
 			if got != tt.want {
 				t.Errorf("handleSchedulerServiceRule() got = %v, want %v", got, tt.want)
@@ -1062,3 +1094,97 @@ func Test_matcherLoop(t *testing.T) {
 		})
 	}
 }
+
+func Test_sortRules(t *testing.T) {
+	rules := map[string]models.Rule{
+		"b.yml":  {Name: "b"},
+		"a.yml":  {Name: "a"},
+		"hi.yml": {Name: "high", Priority: 10},
+		"lo.yml": {Name: "low", Priority: -1},
+	}
+	got := []string{}
+	for _, rule := range sortRules(rules) {
+		got = append(got, rule.Name)
+	}
+	want := []string{"high", "a", "b", "low"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortRules() = %v, want %v", got, want)
+	}
+}
+
+func Test_matcherLoopMatchModes(t *testing.T) {
+	rules := map[string]models.Rule{
+		"general.yml":  {Name: "general", Active: true, Hear: "/deploy/", FormatOutput: "general"},
+		"specific.yml": {Name: "specific", Active: true, Hear: "/deploy api/", FormatOutput: "specific", Priority: 10},
+	}
+
+	tests := []struct {
+		name      string
+		matchMode string
+		want      []string
+	}{
+		{"First match", matchModeFirst, []string{"specific"}},
+		{"All matches", matchModeAll, []string{"general", "specific"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testBot := new(models.Bot)
+			testBot.MatchMode = tt.matchMode
+			message := models.NewMessage()
+			message.Service = models.MsgServiceChat
+			message.Input = "deploy api"
+
+			testOutput := make(chan models.Message, 4)
+			testHitRule := make(chan models.Rule, 4)
+			matcherLoop(message, testOutput, rules, testHitRule, testBot)
+
+			got := []string{}
+			for range tt.want {
+				got = append(got, (<-testOutput).Output)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matcherLoop() output = %v, want %v", got, tt.want)
+			}
+			select {
+			case extra := <-testOutput:
+				t.Errorf("matcherLoop() sent unexpected output %s", extra.Output)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func Test_extractFields(t *testing.T) {
+	raw := `{"items": [{"name": "api", "replicas": 3}, {"name": "web", "replicas": 2}]}`
+
+	tests := []struct {
+		name    string
+		extract map[string]string
+		raw     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"JSONPath", map[string]string{"first": "$.items[0].name"}, raw, map[string]string{"first": "api"}, false},
+		{"jq", map[string]string{"count": ".items | length", "names": ".items[].name"}, raw, map[string]string{"count": "2", "names": `["api","web"]`}, false},
+		{"Path with variables", map[string]string{"replicas": "$.items[?(@.name == '${service}')].replicas"}, raw, map[string]string{"replicas": "2"}, false},
+		{"Path does not resolve", map[string]string{"missing": "$.items[0].owner"}, raw, map[string]string{}, true},
+		{"Invalid path", map[string]string{"invalid": "items"}, raw, map[string]string{}, true},
+		{"Response is not JSON", map[string]string{"first": "$.items[0].name"}, "hello", map[string]string{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := models.NewMessage()
+			msg.Vars["service"] = "web"
+			err := extractFields(models.Action{Name: "test", Extract: tt.extract}, tt.raw, &msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractFields() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for k, v := range tt.want {
+				if msg.Vars[k] != v {
+					t.Errorf("extractFields() set %s = %q, want %q", k, msg.Vars[k], v)
+				}
+			}
+		})
+	}
+}
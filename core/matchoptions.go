@@ -0,0 +1,68 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/target/flottbot/models"
+)
+
+// plainPunctuation replaces the punctuation keyboards "smarten" by what was typed: curly quotes by
+// straight ones, dashes by hyphens (an em dash is what '--' becomes), and an ellipsis by dots
+var plainPunctuation = strings.NewReplacer(
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'",
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "″", `"`, "«", `"`, "»", `"`,
+	"—", "--", "–", "-", "‐", "-", "‑", "-",
+	"…", "...",
+	"\u00a0", " ",
+)
+
+// matchInput is a message's input the way a rule with 'match' options sees it
+func matchInput(input string, options models.MatchOptions) string {
+	if options.Normalize {
+		input = norm.NFC.String(input)
+	}
+	if options.StripSymbols {
+		input = stripSymbols(input)
+	}
+	return input
+}
+
+// matchTrigger is the 'respond' or 'hear' of a rule with 'match' options; it's composed like the input
+func matchTrigger(pattern string, options models.MatchOptions) string {
+	if options.Normalize {
+		return norm.NFC.String(pattern)
+	}
+	return pattern
+}
+
+// stripSymbols straightens smart punctuation and leaves out emoji, along with the spaces around them
+func stripSymbols(input string) string {
+	input = plainPunctuation.Replace(input)
+	stripped := strings.Map(func(r rune) rune {
+		if isEmoji(r) {
+			return -1
+		}
+		return r
+	}, input)
+	if stripped == input {
+		return input
+	}
+	return strings.Join(strings.Fields(stripped), " ")
+}
+
+// isEmoji determines whether a rune is (part of) an emoji: a symbol, or a character joining, varying,
+// or modifying one, like skin tones
+func isEmoji(r rune) bool {
+	switch {
+	case unicode.Is(unicode.So, r):
+		return true
+	case r == '\u200d' || r == '\u20e3' || (r >= '\ufe00' && r <= '\ufe0f'):
+		return true
+	case r >= 0x1f3fb && r <= 0x1f3ff, r >= 0xe0020 && r <= 0xe007f:
+		return true
+	}
+	return false
+}
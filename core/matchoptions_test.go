@@ -0,0 +1,38 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestMatchOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		respond   string
+		hear      string
+		options   models.MatchOptions
+		want      string
+		wantMatch bool
+	}{
+		{"Case ignored by default", "Deploy api", "deploy", "", models.MatchOptions{}, "api", true},
+		{"Case sensitive", "Deploy api", "deploy", "", models.MatchOptions{CaseSensitive: true}, "", false},
+		{"Case sensitive hit", "deploy Api", "deploy", "", models.MatchOptions{CaseSensitive: true}, "Api", true},
+		{"Decomposed without normalizing", "cafe\u0301 menu", "café", "", models.MatchOptions{}, "", false},
+		{"Decomposed, normalized", "cafe\u0301 menu", "café", "", models.MatchOptions{Normalize: true}, "menu", true},
+		{"Smart quotes", "what’s up", "/^what's up$/", "", models.MatchOptions{StripSymbols: true}, "", true},
+		{"Smart quotes without stripping", "what’s up", "/^what's up$/", "", models.MatchOptions{}, "", false},
+		{"Em dash for a flag", "deploy api —force", "deploy", "", models.MatchOptions{StripSymbols: true}, "api --force", true},
+		{"Emoji", "🚀 deploy 👍🏽 api", "deploy", "", models.MatchOptions{StripSymbols: true}, "api", true},
+		{"Emoji in a hear", "ship it 🚢", "", "/ship it$/", models.MatchOptions{StripSymbols: true}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, hit := getProccessedInputAndHitValue(tt.input, tt.respond, tt.hear, tt.options)
+			if got != tt.want || hit != tt.wantMatch {
+				t.Errorf("getProccessedInputAndHitValue() = %q, %v, want %q, %v", got, hit, tt.want, tt.wantMatch)
+			}
+		})
+	}
+}
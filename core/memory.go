@@ -0,0 +1,85 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// memoryBucket is the storage bucket holding conversation memory
+const memoryBucket = "memory"
+
+// memoryVarPrefix is prepended to recalled keys to build the variable name, e.g. ${memory.last_deploy}
+const memoryVarPrefix = "memory."
+
+// Remember stores a value under the given key for a scope of the message's conversation.
+// Remembering an empty value forgets the key.
+func Remember(scope, key, value string, message models.Message, bot *models.Bot) error {
+	scopeKey, err := memoryScope(scope, message)
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return bot.Store.Delete(memoryBucket, scopeKey+"/"+key)
+	}
+	return bot.Store.Set(memoryBucket, scopeKey+"/"+key, []byte(value), 0)
+}
+
+// Recall looks up a remembered value for a scope of the message's conversation
+func Recall(scope, key string, message models.Message, bot *models.Bot) (string, bool, error) {
+	scopeKey, err := memoryScope(scope, message)
+	if err != nil {
+		return "", false, err
+	}
+	value, ok, err := bot.Store.Get(memoryBucket, scopeKey+"/"+key)
+	return string(value), ok, err
+}
+
+// recallMemory makes the values listed in a rule's 'recall' field available as ${memory.<key>} vars.
+// Keys that were never remembered are set to empty so rules can reference them safely.
+func recallMemory(rule models.Rule, message *models.Message, bot *models.Bot) {
+	for _, m := range rule.Recall {
+		value, _, err := Recall(m.Scope, m.Key, *message, bot)
+		if err != nil {
+			bot.Log.Errorf("Rule '%s' could not recall '%s': %s", rule.Name, m.Key, err.Error())
+			continue
+		}
+		message.Vars[memoryVarPrefix+m.Key] = value
+	}
+}
+
+// rememberMemory stores the values listed in a rule's 'remember' field, substituting any vars,
+// and makes them available as ${memory.<key>} vars for the rest of the rule
+func rememberMemory(rule models.Rule, message *models.Message, bot *models.Bot) {
+	for _, m := range rule.Remember {
+		value, err := utils.Substitute(m.Value, message.Vars)
+		if err != nil {
+			bot.Log.Errorf("Rule '%s' could not remember '%s': %s", rule.Name, m.Key, err.Error())
+			continue
+		}
+		if err := Remember(m.Scope, m.Key, value, *message, bot); err != nil {
+			bot.Log.Errorf("Rule '%s' could not remember '%s': %s", rule.Name, m.Key, err.Error())
+			continue
+		}
+		message.Vars[memoryVarPrefix+m.Key] = value
+	}
+}
+
+// memoryScope builds the key that identifies a memory scope for a message
+func memoryScope(scope string, message models.Message) (string, error) {
+	switch strings.ToLower(scope) {
+	case "", "channel":
+		return "channel:" + message.ChannelID, nil
+	case "user":
+		// Messages nobody sent, e.g. from schedules, would all share one user's memory
+		person := personKey(message)
+		if len(person) == 0 {
+			return "", fmt.Errorf("The 'user' memory scope needs a message sent by a user")
+		}
+		return "user:" + person, nil
+	default:
+		return "", fmt.Errorf("Unknown memory scope '%s', use 'channel' or 'user'", scope)
+	}
+}
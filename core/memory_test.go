@@ -0,0 +1,91 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestRememberRecall(t *testing.T) {
+	testBot := new(models.Bot)
+	testBot.Store = memory.New()
+
+	msgA := models.NewMessage()
+	msgA.ChannelID = "C123"
+	msgA.Vars["_user.id"] = "U111"
+
+	msgB := models.NewMessage()
+	msgB.ChannelID = "C456"
+	msgB.Vars["_user.id"] = "U111"
+
+	if err := Remember("", "version", "1.2.3", msgA, testBot); err != nil {
+		t.Fatalf("Remember() error = %v", err)
+	}
+	if err := Remember("user", "color", "blue", msgA, testBot); err != nil {
+		t.Fatalf("Remember() error = %v", err)
+	}
+
+	noUser := models.NewMessage()
+	noUser.ChannelID = "C123"
+	if err := Remember("user", "color", "red", noUser, testBot); err == nil {
+		t.Error("Remember() for a message without a user should fail")
+	}
+
+	tests := []struct {
+		name      string
+		scope     string
+		key       string
+		message   models.Message
+		wantValue string
+		wantOk    bool
+		wantErr   bool
+	}{
+		{"Channel memory in same channel", "channel", "version", msgA, "1.2.3", true, false},
+		{"Channel memory in other channel", "channel", "version", msgB, "", false, false},
+		{"User memory follows the user", "user", "color", msgB, "blue", true, false},
+		{"Unknown key", "channel", "nope", msgA, "", false, false},
+		{"Unknown scope", "galaxy", "version", msgA, "", false, true},
+		{"User memory without a user", "user", "color", noUser, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := Recall(tt.scope, tt.key, tt.message, testBot)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Recall() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.wantValue || ok != tt.wantOk {
+				t.Errorf("Recall() = %v, %v, want %v, %v", got, ok, tt.wantValue, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestRememberRecallMemoryVars(t *testing.T) {
+	testBot := new(models.Bot)
+	testBot.Store = memory.New()
+
+	rule := models.Rule{
+		Name:     "deploy",
+		Remember: []models.Memory{{Key: "last_deploy", Value: "${version}"}},
+		Recall:   []models.Memory{{Key: "last_deploy"}, {Key: "never_set"}},
+	}
+
+	msg := models.NewMessage()
+	msg.ChannelID = "C789"
+	msg.Vars["version"] = "v42"
+	rememberMemory(rule, &msg, testBot)
+	if msg.Vars["memory.last_deploy"] != "v42" {
+		t.Errorf("rememberMemory() set memory.last_deploy = %q, want %q", msg.Vars["memory.last_deploy"], "v42")
+	}
+
+	next := models.NewMessage()
+	next.ChannelID = "C789"
+	recallMemory(rule, &next, testBot)
+	if next.Vars["memory.last_deploy"] != "v42" {
+		t.Errorf("recallMemory() set memory.last_deploy = %q, want %q", next.Vars["memory.last_deploy"], "v42")
+	}
+	if v, ok := next.Vars["memory.never_set"]; !ok || v != "" {
+		t.Errorf("recallMemory() should set unknown keys to empty, got %q (set: %t)", v, ok)
+	}
+}
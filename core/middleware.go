@@ -0,0 +1,374 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// defaultMiddlewareTimeout is how long a 'script' middleware may take, unless it sets 'timeout'
+const defaultMiddlewareTimeout = 5
+
+// InputMiddleware filters or rewrites the messages a bot receives before they're matched against
+// its rules, e.g. to drop spam, alias users, normalize input, or check who may talk to the bot.
+// Process is given every message received, and may change it; returning false drops it.
+type InputMiddleware interface {
+	Process(message *models.Message, bot *models.Bot) bool
+}
+
+// InputMiddlewareFunc lets a function be used as InputMiddleware
+type InputMiddlewareFunc func(message *models.Message, bot *models.Bot) bool
+
+// Process implementation to satisfy InputMiddleware interface
+func (f InputMiddlewareFunc) Process(message *models.Message, bot *models.Bot) bool {
+	return f(message, bot)
+}
+
+// OutputMiddleware rewrites, enriches, or blocks the messages a bot sends, e.g. to filter
+// profanity, link to the trace of a message, or keep messages within a chat application's limits.
+// Process is given every message about to be sent, and may change it; returning false blocks it.
+type OutputMiddleware interface {
+	Process(message *models.Message, bot *models.Bot) bool
+}
+
+// OutputMiddlewareFunc lets a function be used as OutputMiddleware
+type OutputMiddlewareFunc func(message *models.Message, bot *models.Bot) bool
+
+// Process implementation to satisfy OutputMiddleware interface
+func (f OutputMiddlewareFunc) Process(message *models.Message, bot *models.Bot) bool {
+	return f(message, bot)
+}
+
+// inputMiddleware and outputMiddleware are the chains of middleware of each bot
+var (
+	middlewareMu     sync.Mutex
+	inputMiddleware  = make(map[*models.Bot][]InputMiddleware)
+	outputMiddleware = make(map[*models.Bot][]OutputMiddleware)
+)
+
+// UseInputMiddleware adds middleware to the chain a bot's messages pass through before they're
+// matched, e.g. in a project embedding flottbot. Middleware runs in the order it was added; the
+// middleware in bot.yml's 'input_middleware' is added when the bot is configured.
+func UseInputMiddleware(bot *models.Bot, middleware ...InputMiddleware) {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	inputMiddleware[bot] = append(inputMiddleware[bot], middleware...)
+}
+
+// UseOutputMiddleware adds middleware to the chain a bot's messages pass through before they're
+// sent, e.g. in a project embedding flottbot. Middleware runs in the order it was added; the
+// middleware in bot.yml's 'output_middleware' is added when the bot is configured.
+func UseOutputMiddleware(bot *models.Bot, middleware ...OutputMiddleware) {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	outputMiddleware[bot] = append(outputMiddleware[bot], middleware...)
+}
+
+// configureMiddleware adds the middleware in bot.yml to the bot's chains
+func configureMiddleware(bot *models.Bot) {
+	for i, conf := range bot.InputMiddleware {
+		middleware, err := newInputMiddleware(conf)
+		if err != nil {
+			bot.Log.Errorf("Invalid input_middleware %d: %s", i+1, err.Error())
+			continue
+		}
+		UseInputMiddleware(bot, middleware)
+	}
+	for i, conf := range bot.OutputMiddleware {
+		middleware, err := newOutputMiddleware(conf)
+		if err != nil {
+			bot.Log.Errorf("Invalid output_middleware %d: %s", i+1, err.Error())
+			continue
+		}
+		UseOutputMiddleware(bot, middleware)
+	}
+}
+
+// newInputMiddleware creates the input middleware configured in bot.yml
+func newInputMiddleware(conf models.Middleware) (InputMiddleware, error) {
+	switch strings.ToLower(conf.Type) {
+	case "script":
+		if len(conf.Cmd) == 0 {
+			return nil, fmt.Errorf("Script middleware needs a 'cmd'")
+		}
+		return scriptInputMiddleware(conf), nil
+	case "normalize":
+		return normalizeMiddleware(), nil
+	case "alias":
+		if len(conf.Aliases) == 0 {
+			return nil, fmt.Errorf("Alias middleware needs 'aliases'")
+		}
+		return aliasMiddleware(conf.Aliases), nil
+	}
+	return nil, fmt.Errorf("Unknown type '%s', use 'script', 'normalize', or 'alias'", conf.Type)
+}
+
+// newOutputMiddleware creates the output middleware configured in bot.yml
+func newOutputMiddleware(conf models.Middleware) (OutputMiddleware, error) {
+	switch strings.ToLower(conf.Type) {
+	case "script":
+		if len(conf.Cmd) == 0 {
+			return nil, fmt.Errorf("Script middleware needs a 'cmd'")
+		}
+		return scriptOutputMiddleware(conf), nil
+	case "append":
+		if len(conf.Text) == 0 {
+			return nil, fmt.Errorf("Append middleware needs a 'text'")
+		}
+		return appendMiddleware(conf.Text), nil
+	case "replace":
+		if len(conf.Words) == 0 {
+			return nil, fmt.Errorf("Replace middleware needs 'words'")
+		}
+		return replaceMiddleware(conf.Words, conf.Replacement), nil
+	case "max_length":
+		if len(conf.MaxLength) == 0 {
+			return nil, fmt.Errorf("Max length middleware needs a 'max_length' per chat application")
+		}
+		return maxLengthMiddleware(conf.MaxLength), nil
+	case "filter":
+		return filterMiddleware(conf)
+	}
+	return nil, fmt.Errorf("Unknown type '%s', use 'script', 'append', 'replace', 'filter', or 'max_length'", conf.Type)
+}
+
+// processInput passes a message through the bot's input middleware, and reports whether it
+// should be matched
+func processInput(message *models.Message, bot *models.Bot) bool {
+	middlewareMu.Lock()
+	chain := inputMiddleware[bot]
+	middlewareMu.Unlock()
+	for _, middleware := range chain {
+		if !middleware.Process(message, bot) {
+			bot.Log.Debugf("Input middleware dropped message %s", message.ID)
+			return false
+		}
+	}
+	return true
+}
+
+// processOutput passes a message through the bot's output middleware, and reports whether it
+// should be sent
+func processOutput(message *models.Message, bot *models.Bot) bool {
+	middlewareMu.Lock()
+	chain := outputMiddleware[bot]
+	middlewareMu.Unlock()
+	for _, middleware := range chain {
+		if !middleware.Process(message, bot) {
+			bot.Log.Debugf("Output middleware blocked message %s", message.ID)
+			return false
+		}
+	}
+	return true
+}
+
+// messageRemote is the name of the chat application a message came from, or is sent to
+func messageRemote(message models.Message, bot *models.Bot) string {
+	if message.Service == models.MsgServiceCLI {
+		return "cli"
+	}
+	return strings.ToLower(bot.ChatApplication)
+}
+
+// invisibleInput are the characters normalizeMiddleware replaces: typographic quotes and spaces,
+// which chat applications like to put in, and zero-width characters, which can't be seen
+var invisibleInput = strings.NewReplacer(
+	"\u2018", "'", "\u2019", "'", "\u201a", "'", "\u201b", "'",
+	"\u201c", `"`, "\u201d", `"`, "\u201e", `"`, "\u201f", `"`,
+	"\u00a0", " ", "\u202f", " ",
+	"\u200b", "", "\u200c", "", "\u200d", "", "\u2060", "", "\ufeff", "",
+)
+
+// normalizeMiddleware straightens quotes and removes zero-width characters from the input, so
+// rules match text that was pasted or autocorrected
+func normalizeMiddleware() InputMiddleware {
+	return InputMiddlewareFunc(func(message *models.Message, bot *models.Bot) bool {
+		message.Input = invisibleInput.Replace(message.Input)
+		return true
+	})
+}
+
+// aliasMiddleware gives users another name, by their user name or ID, e.g. to use the same name for
+// someone on every chat application. Rules see it as ${_user.name}, and admins are found by it.
+func aliasMiddleware(aliases map[string]string) InputMiddleware {
+	return InputMiddlewareFunc(func(message *models.Message, bot *models.Bot) bool {
+		alias, ok := aliases[message.Vars["_user.id"]]
+		if !ok {
+			alias, ok = aliases[message.Vars["_user.name"]]
+		}
+		if ok && len(alias) > 0 {
+			message.Vars["_user.name"] = alias
+		}
+		return true
+	})
+}
+
+// appendMiddleware adds a text to the output, e.g. a link to the message's trace. The text may use
+// the message's variables, and ${_trace_id}.
+func appendMiddleware(text string) OutputMiddleware {
+	return OutputMiddlewareFunc(func(message *models.Message, bot *models.Bot) bool {
+		if len(message.Output) == 0 {
+			return true
+		}
+		vars := make(map[string]string, len(message.Vars)+1)
+		for name, value := range message.Vars {
+			vars[name] = value
+		}
+		// traceparent is 00-<trace id>-<span id>-<flags>
+		if parts := strings.Split(message.TraceParent, "-"); len(parts) == 4 {
+			vars["_trace_id"] = parts[1]
+		}
+		appended, err := utils.Substitute(text, vars)
+		if err != nil {
+			bot.Log.Errorf("Could not append '%s' to message %s: %s", text, message.ID, err.Error())
+			return true
+		}
+		message.Output = message.Output + appended
+		return true
+	})
+}
+
+// replaceMiddleware masks words in the output, e.g. profanity; words only match as a whole, in
+// any case
+func replaceMiddleware(words []string, replacement string) OutputMiddleware {
+	if len(replacement) == 0 {
+		replacement = "***"
+	}
+	pattern := wordsPattern(words)
+	return OutputMiddlewareFunc(func(message *models.Message, bot *models.Bot) bool {
+		message.Output = pattern.ReplaceAllLiteralString(message.Output, replacement)
+		return true
+	})
+}
+
+// wordsPattern matches any of the words, as a whole, in any case
+func wordsPattern(words []string) *regexp.Regexp {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	return regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+}
+
+// maxLengthMiddleware cuts the output short where a chat application can't show it in one message.
+// The limits are by chat application ('slack', 'discord', 'cli', ...), 'default' applies to the rest.
+func maxLengthMiddleware(limits map[string]int) OutputMiddleware {
+	return OutputMiddlewareFunc(func(message *models.Message, bot *models.Bot) bool {
+		limit, ok := limits[messageRemote(*message, bot)]
+		if !ok {
+			limit = limits["default"]
+		}
+		runes := []rune(message.Output)
+		if limit <= 0 || len(runes) <= limit {
+			return true
+		}
+		message.Output = string(runes[:limit-1]) + "…"
+		return true
+	})
+}
+
+// scriptMiddlewareInput is what a 'script' middleware reads from stdin, as JSON; input middleware
+// gets the 'input', output middleware the 'output'
+type scriptMiddlewareInput struct {
+	Input   string            `json:"input,omitempty"`
+	Output  string            `json:"output,omitempty"`
+	Remote  string            `json:"remote"`
+	Channel string            `json:"channel"`
+	User    string            `json:"user"`
+	UserID  string            `json:"user_id"`
+	Vars    map[string]string `json:"vars"`
+}
+
+// scriptMiddlewareOutput is what a 'script' middleware prints to stdout, as JSON; leaving out
+// 'input' or 'output' leaves them unchanged. Input middleware can also set 'vars' of the message.
+type scriptMiddlewareOutput struct {
+	Input  *string           `json:"input"`
+	Output *string           `json:"output"`
+	Vars   map[string]string `json:"vars"`
+	Block  bool              `json:"block"`
+}
+
+// scriptInputMiddleware hands received messages to a command, which tells whether to change or drop them
+func scriptInputMiddleware(conf models.Middleware) InputMiddleware {
+	return InputMiddlewareFunc(func(message *models.Message, bot *models.Bot) bool {
+		result, ok := runMiddlewareScript(conf, scriptMiddlewareInput{Input: message.Input}, message, bot)
+		if !ok {
+			return !conf.FailClosed
+		}
+		if result.Block {
+			return false
+		}
+		if result.Input != nil {
+			message.Input = *result.Input
+		}
+		for name, value := range result.Vars {
+			message.Vars[name] = value
+		}
+		return true
+	})
+}
+
+// scriptOutputMiddleware hands messages about to be sent to a command, which tells whether to
+// change or block them
+func scriptOutputMiddleware(conf models.Middleware) OutputMiddleware {
+	return OutputMiddlewareFunc(func(message *models.Message, bot *models.Bot) bool {
+		result, ok := runMiddlewareScript(conf, scriptMiddlewareInput{Output: message.Output}, message, bot)
+		if !ok {
+			return !conf.FailClosed
+		}
+		if result.Block {
+			return false
+		}
+		if result.Output != nil {
+			message.Output = *result.Output
+		}
+		return true
+	})
+}
+
+// runMiddlewareScript runs the command of a 'script' middleware on a message, and reports whether
+// it ran. Unless the middleware is 'fail_closed', messages pass unchanged when the command fails,
+// so a broken script doesn't silence the bot.
+func runMiddlewareScript(conf models.Middleware, data scriptMiddlewareInput, message *models.Message, bot *models.Bot) (scriptMiddlewareOutput, bool) {
+	var result scriptMiddlewareOutput
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultMiddlewareTimeout
+	}
+	data.Remote = messageRemote(*message, bot)
+	data.Channel = message.ChannelName
+	data.User = message.Vars["_user.name"]
+	data.UserID = message.Vars["_user.id"]
+	data.Vars = message.Vars
+	input, err := json.Marshal(data)
+	if err != nil {
+		bot.Log.Errorf("Could not hand message %s to middleware '%s': %s", message.ID, conf.Cmd, err.Error())
+		return result, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	bin := utils.FindArgs(conf.Cmd)
+	cmd := exec.CommandContext(ctx, bin[0], bin[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		bot.Log.Errorf("Middleware '%s' failed on message %s: %s %s", conf.Cmd, message.ID, err.Error(), strings.TrimSpace(stderr.String()))
+		return result, false
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		bot.Log.Errorf("Middleware '%s' printed invalid JSON for message %s: %s", conf.Cmd, message.ID, err.Error())
+		return result, false
+	}
+	return result, true
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestOutputMiddleware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flottbot-middleware")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, []byte("#!/bin/sh\n"+content+"\n"), 0755)
+		return path
+	}
+
+	tests := []struct {
+		name     string
+		conf     models.Middleware
+		output   string
+		service  models.MessageService
+		want     string
+		wantSent bool
+	}{
+		{"Append", models.Middleware{Type: "append", Text: "\ntrace: ${_trace_id}"}, "Deployed", models.MsgServiceChat, "Deployed\ntrace: 0af7651916cd43dd8448eb211c80319c", true},
+		{"Append nothing to nothing", models.Middleware{Type: "append", Text: "\ntrace: ${_trace_id}"}, "", models.MsgServiceChat, "", true},
+		{"Replace", models.Middleware{Type: "replace", Words: []string{"darn", "heck"}}, "Darn, the heckler said heck", models.MsgServiceChat, "***, the heckler said ***", true},
+		{"Max length", models.Middleware{Type: "max_length", MaxLength: map[string]int{"slack": 5}}, "Deployed", models.MsgServiceChat, "Depl…", true},
+		{"Max length of another remote", models.Middleware{Type: "max_length", MaxLength: map[string]int{"slack": 5, "default": 100}}, "Deployed", models.MsgServiceCLI, "Deployed", true},
+		{"Script rewrites", models.Middleware{Type: "script", Cmd: script("rewrite.sh", `sed 's/"output":"[^"]*"/"output":"rewritten"/'`)}, "Deployed", models.MsgServiceChat, "rewritten", true},
+		{"Script blocks", models.Middleware{Type: "script", Cmd: script("block.sh", `echo '{"block": true}'`)}, "Deployed", models.MsgServiceChat, "Deployed", false},
+		{"Script fails", models.Middleware{Type: "script", Cmd: script("fail.sh", `exit 1`)}, "Deployed", models.MsgServiceChat, "Deployed", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &models.Bot{ChatApplication: "slack"}
+			initLogger(bot)
+			middleware, err := newOutputMiddleware(tt.conf)
+			if err != nil {
+				t.Fatalf("newOutputMiddleware() error = %v", err)
+			}
+			UseOutputMiddleware(bot, middleware)
+
+			message := models.NewMessage()
+			message.Service = tt.service
+			message.Output = tt.output
+			message.TraceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+			if sent := processOutput(&message, bot); sent != tt.wantSent || message.Output != tt.want {
+				t.Errorf("processOutput() = %v, %q, want %v, %q", sent, message.Output, tt.wantSent, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputMiddleware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flottbot-middleware")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, []byte("#!/bin/sh\n"+content+"\n"), 0755)
+		return path
+	}
+
+	tests := []struct {
+		name        string
+		conf        models.Middleware
+		input       string
+		want        string
+		wantUser    string
+		wantMatched bool
+	}{
+		{"Normalize", models.Middleware{Type: "normalize"}, "deploy \u201cweb\u201d\u00a0it\u2019s\u200b prod", `deploy "web" it's prod`, "jdoe", true},
+		{"Alias by ID", models.Middleware{Type: "alias", Aliases: map[string]string{"U123": "jane"}}, "hello", "hello", "jane", true},
+		{"Alias by name", models.Middleware{Type: "alias", Aliases: map[string]string{"jdoe": "jane"}}, "hello", "hello", "jane", true},
+		{"No alias", models.Middleware{Type: "alias", Aliases: map[string]string{"bob": "robert"}}, "hello", "hello", "jdoe", true},
+		{"Script rewrites", models.Middleware{Type: "script", Cmd: script("rewrite.sh", `echo '{"input": "hi", "vars": {"_user.name": "jane"}}'`)}, "hello", "hi", "jane", true},
+		{"Script drops", models.Middleware{Type: "script", Cmd: script("drop.sh", `grep -q '"input":"buy now"' && echo '{"block": true}' || echo '{}'`)}, "buy now", "buy now", "jdoe", false},
+		{"Script passes", models.Middleware{Type: "script", Cmd: script("drop.sh", `grep -q '"input":"buy now"' && echo '{"block": true}' || echo '{}'`)}, "hello", "hello", "jdoe", true},
+		{"Script fails open", models.Middleware{Type: "script", Cmd: script("fail.sh", `exit 1`)}, "hello", "hello", "jdoe", true},
+		{"Script fails closed", models.Middleware{Type: "script", Cmd: script("fail.sh", `exit 1`), FailClosed: true}, "hello", "hello", "jdoe", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &models.Bot{ChatApplication: "slack"}
+			initLogger(bot)
+			middleware, err := newInputMiddleware(tt.conf)
+			if err != nil {
+				t.Fatalf("newInputMiddleware() error = %v", err)
+			}
+			UseInputMiddleware(bot, middleware)
+
+			message := models.NewMessage()
+			message.Service = models.MsgServiceChat
+			message.Input = tt.input
+			message.Vars["_user.id"] = "U123"
+			message.Vars["_user.name"] = "jdoe"
+			matched := processInput(&message, bot)
+			if matched != tt.wantMatched || message.Input != tt.want || message.Vars["_user.name"] != tt.wantUser {
+				t.Errorf("processInput() = %v, %q, %q, want %v, %q, %q", matched, message.Input, message.Vars["_user.name"], tt.wantMatched, tt.want, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestUseOutputMiddleware(t *testing.T) {
+	bot := &models.Bot{OutputMiddleware: []models.Middleware{{Type: "append", Text: " (from bot.yml)"}, {Type: "shout"}}}
+	initLogger(bot)
+	UseOutputMiddleware(bot, OutputMiddlewareFunc(func(message *models.Message, bot *models.Bot) bool {
+		message.Output = strings.ToUpper(message.Output)
+		return !strings.Contains(message.Output, "SECRET")
+	}))
+	configureMiddleware(bot)
+
+	message := models.NewMessage()
+	message.Output = "hello"
+	if !processOutput(&message, bot) || message.Output != "HELLO (from bot.yml)" {
+		t.Errorf("processOutput() = %q", message.Output)
+	}
+	message.Output = "the secret"
+	if processOutput(&message, bot) {
+		t.Errorf("processOutput() didn't block %q", message.Output)
+	}
+}
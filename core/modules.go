@@ -0,0 +1,44 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/target/flottbot/models"
+)
+
+// Built-in modules, enabled with 'modules' in bot.yml. They add the commands people
+// expect from a chat bot without having to write rules and services for them.
+const (
+	moduleKarma     = "karma"     // 'name++' and 'name--', and the 'karma' command
+	modulePolls     = "polls"     // the 'poll' and 'vote' commands
+	moduleReminders = "reminders" // the 'remind' command
+	moduleIncidents = "incidents" // the 'incident' commands
+	moduleStandups  = "standups"  // the standups in 'standups', and the 'standup' commands
+
+	moduleAutoResponders = "autoresponders" // the answers in 'auto_responders', and the 'autoreply' commands
+)
+
+// configureModules checks the built-in modules enabled in bot.yml
+func configureModules(bot *models.Bot) {
+	modules := []string{}
+	for _, module := range bot.Modules {
+		switch strings.ToLower(module) {
+		case moduleKarma, modulePolls, moduleReminders, moduleIncidents, moduleStandups, moduleAutoResponders:
+			modules = append(modules, strings.ToLower(module))
+			bot.Log.Infof("Enabled built-in module '%s'", strings.ToLower(module))
+		default:
+			bot.Log.Warnf("Unknown module '%s', use '%s', '%s', '%s', '%s', '%s', or '%s'", module, moduleKarma, modulePolls, moduleReminders, moduleIncidents, moduleStandups, moduleAutoResponders)
+		}
+	}
+	bot.Modules = modules
+}
+
+// moduleEnabled determines whether a built-in module is enabled in bot.yml
+func moduleEnabled(module string, bot *models.Bot) bool {
+	for _, m := range bot.Modules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+// msgLocalTimeFormat is how ${_msg.local_time} shows when a message was sent
+const msgLocalTimeFormat = "2006-01-02 15:04 MST"
+
+// setTimeVars tells rules when the message was sent, so they don't have to parse the chat application's
+// timestamps: ${_msg.time} (RFC 3339, in UTC), ${_msg.unix}, how long ago as ${_msg.age} (e.g. '1m30s')
+// and ${_msg.age_seconds}, and ${_msg.local_time} in the sender's time zone (${_user.timezone}), or the
+// bot's. Messages the chat application doesn't date are dated when the bot read them.
+func setTimeVars(message *models.Message, now time.Time) {
+	sent := message.Time
+	if sent.IsZero() && message.StartTime > 0 {
+		sent = time.Unix(message.StartTime, 0)
+	}
+	if sent.IsZero() {
+		return
+	}
+	age := now.Sub(sent)
+	if age < 0 {
+		age = 0
+	}
+	loc := time.Local
+	if zone := message.Vars["_user.timezone"]; len(zone) > 0 {
+		if userLoc, err := time.LoadLocation(zone); err == nil {
+			loc = userLoc
+		}
+	}
+
+	message.Vars["_msg.time"] = sent.UTC().Format(time.RFC3339)
+	message.Vars["_msg.unix"] = strconv.FormatInt(sent.Unix(), 10)
+	message.Vars["_msg.age"] = age.Round(time.Second).String()
+	message.Vars["_msg.age_seconds"] = strconv.FormatInt(int64(age/time.Second), 10)
+	message.Vars["_msg.local_time"] = sent.In(loc).Format(msgLocalTimeFormat)
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestSetTimeVars(t *testing.T) {
+	sent := time.Date(2019, 5, 21, 14, 30, 0, 0, time.UTC)
+	now := sent.Add(90*time.Second + 400*time.Millisecond)
+
+	tests := []struct {
+		name     string
+		time     time.Time
+		start    int64
+		timezone string
+		want     map[string]string
+	}{
+		{"Dated message", sent, 0, "America/Chicago", map[string]string{
+			"_msg.time": "2019-05-21T14:30:00Z", "_msg.unix": "1558449000", "_msg.age": "1m30s", "_msg.age_seconds": "90", "_msg.local_time": "2019-05-21 09:30 CDT",
+		}},
+		{"Read time", time.Time{}, sent.Unix(), "Europe/Berlin", map[string]string{
+			"_msg.time": "2019-05-21T14:30:00Z", "_msg.age_seconds": "90", "_msg.local_time": "2019-05-21 16:30 CEST",
+		}},
+		{"Sent after now", now.Add(time.Minute), 0, "UTC", map[string]string{"_msg.age": "0s", "_msg.age_seconds": "0"}},
+		{"Undated", time.Time{}, 0, "", map[string]string{"_msg.time": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.Time, message.StartTime = tt.time, tt.start
+			message.Vars["_user.timezone"] = tt.timezone
+			setTimeVars(&message, now)
+			for name, want := range tt.want {
+				if got := message.Vars[name]; got != want {
+					t.Errorf("setTimeVars() %s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/utils"
+)
+
+// Storage buckets of mutes: the rules muted in channels, by rule and channel, and which replica of
+// the bot announces that a mute is over
+const (
+	muteBucket       = "rule-mutes"
+	muteClaimsBucket = "rule-mute-claims"
+)
+
+// muteInterval is how often mutes that are over are looked for, to announce them
+const muteInterval = 30 * time.Second
+
+// muteGrace is how long a mute is kept after it's over, for a replica of the bot to announce it
+const muteGrace = time.Hour
+
+// mute silences the outputs of a rule in a channel until it's over
+type mute struct {
+	Rule      string                `json:"rule"`
+	Service   models.MessageService `json:"service"`
+	Type      models.MessageType    `json:"type"`
+	ChannelID string                `json:"channel_id"`
+	UserID    string                `json:"user_id"`
+	UserName  string                `json:"user_name"`
+	Until     time.Time             `json:"until"`
+}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "mute", usage: "mute <rule> <duration>", description: "Stop a noisy rule from posting in this channel for a while, e.g. 'mute deploy-notifications 2h'", args: 2, run: muteCommand},
+		builtinCommand{trigger: "unmute", usage: "unmute <rule>", description: "Let a rule you muted post in this channel again", args: 1, run: unmuteCommand},
+		builtinCommand{trigger: "mutes", usage: "mutes", description: "List the rules muted in this channel", run: listMutesCommand},
+	)
+}
+
+// muteCommand mutes the rule named by the first argument in the channel of the message, for the
+// duration given as second argument. A rule someone else muted can only be muted again by them, or
+// by an admin.
+func muteCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	return muteRule(args[0], args[1], *message, rules, bot, time.Now())
+}
+
+// muteRule mutes a rule in the channel of a message
+func muteRule(name, duration string, message models.Message, rules map[string]models.Rule, bot *models.Bot, now time.Time) (string, error) {
+	rule, ok := findRuleByName(rules, name)
+	if !ok {
+		return translate(message, bot, "mutes.unknown_rule", "I don't have a rule called '${rule}'.", map[string]string{"rule": name}), nil
+	}
+	length, err := utils.ParseDuration(duration)
+	if err != nil || length <= 0 {
+		return translate(message, bot, "mutes.usage", "Tell me for how long, e.g. 'mute ${rule} 2h'.", map[string]string{"rule": rule}), nil
+	}
+
+	if current, ok := findMute(rule, message.ChannelID, now, bot); ok && !mutedBy(current, message, bot) {
+		return mutedByOther(current, message, bot), nil
+	}
+	m := mute{
+		Rule:      rule,
+		Service:   message.Service,
+		Type:      message.Type,
+		ChannelID: message.ChannelID,
+		UserID:    message.Vars["_user.id"],
+		UserName:  message.Vars["_user.name"],
+		Until:     now.Add(length),
+	}
+	value, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	if err := bot.Store.Set(muteBucket, muteKey(rule, message.ChannelID), value, length+muteGrace); err != nil {
+		return "", err
+	}
+	return translate(message, bot, "mutes.muted", "Okay, ${rule} won't post here until ${until}.", map[string]string{
+		"rule":  rule,
+		"until": m.Until.Format("2006-01-02 15:04 MST"),
+	}), nil
+}
+
+// unmuteCommand lets the rule named by the first argument post in the channel of the message again.
+// Only who muted it, or an admin, may unmute it.
+func unmuteCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	name := args[0]
+	if rule, ok := findRuleByName(rules, name); ok {
+		name = rule
+	}
+	current, ok := findMute(name, message.ChannelID, time.Now(), bot)
+	if !ok {
+		return translate(*message, bot, "mutes.not_muted", "${rule} isn't muted here.", map[string]string{"rule": name}), nil
+	}
+	if !mutedBy(current, *message, bot) {
+		return mutedByOther(current, *message, bot), nil
+	}
+	if err := bot.Store.Delete(muteBucket, muteKey(current.Rule, current.ChannelID)); err != nil {
+		return "", err
+	}
+	return translate(*message, bot, "mutes.unmuted", "Okay, ${rule} can post here again.", map[string]string{"rule": current.Rule}), nil
+}
+
+// listMutesCommand lists the rules muted in the channel of the message, the ones muted longest first
+func listMutesCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	mutes, err := loadMutes(bot)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	lines := []string{}
+	for _, m := range mutes {
+		if m.ChannelID != message.ChannelID || !m.Until.After(now) {
+			continue
+		}
+		lines = append(lines, translate(*message, bot, "mutes.item", " • ${rule} until ${until}, muted by ${user}", map[string]string{
+			"rule":  m.Rule,
+			"until": m.Until.Format("2006-01-02 15:04 MST"),
+			"user":  m.UserName,
+		}))
+	}
+	if len(lines) == 0 {
+		return translate(*message, bot, "mutes.none", "No rules are muted here.", nil), nil
+	}
+	return translate(*message, bot, "mutes.list", "These rules are muted here:", nil) + "\n\n" + strings.Join(lines, "\n"), nil
+}
+
+// Mutes announces in their channel that mutes of rules are over. Mutes are kept in the storage
+// backend, so they survive restarts of the bot, and only one replica of the bot announces each.
+func Mutes(outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	ticker := time.NewTicker(muteInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-remote.Stopping():
+			return
+		case now := <-ticker.C:
+			endMutes(now, outputMsgs, hitRule, bot)
+		}
+	}
+}
+
+// endMutes removes the mutes that are over at the given time, and announces it
+func endMutes(now time.Time, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	mutes, err := loadMutes(bot)
+	if err != nil {
+		bot.Log.Errorf("Could not look up muted rules: %s", err.Error())
+		return
+	}
+	for _, m := range mutes {
+		if m.Until.After(now) {
+			continue
+		}
+		key := muteKey(m.Rule, m.ChannelID)
+		claimed, err := bot.Store.Claim(muteClaimsBucket, key+"@"+strconv.FormatInt(m.Until.Unix(), 10), []byte(bot.InstanceID), muteGrace)
+		if err != nil || !claimed {
+			continue
+		}
+		if err := bot.Store.Delete(muteBucket, key); err != nil {
+			bot.Log.Errorf("Could not unmute rule '%s': %s", m.Rule, err.Error())
+			continue
+		}
+
+		message := models.NewMessage()
+		message.Service = m.Service
+		message.Type = m.Type
+		message.ChannelID = m.ChannelID
+		message.Vars["_user.id"] = m.UserID
+		message.Vars["_user.name"] = m.UserName
+		message.Output = translate(message, bot, "mutes.over", "${rule} can post here again, its mute is over.", map[string]string{"rule": m.Rule})
+		sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+	}
+}
+
+// muted determines whether the output of a rule is muted where it's going. Muted channels are left
+// out of 'output_to_rooms'; the output is only muted when it has nowhere left to go.
+func muted(message *models.Message, rule models.Rule, now time.Time, bot *models.Bot) bool {
+	if len(rule.Name) == 0 || bot.Store == nil {
+		return false
+	}
+	if len(message.OutputToRooms) == 0 {
+		_, ok := findMute(rule.Name, message.ChannelID, now, bot)
+		return ok && len(message.OutputToUsers) == 0 && len(message.ChannelID) > 0
+	}
+	rooms := []string{}
+	for _, room := range message.OutputToRooms {
+		if _, ok := findMute(rule.Name, room, now, bot); !ok {
+			rooms = append(rooms, room)
+		}
+	}
+	if len(rooms) < len(message.OutputToRooms) {
+		bot.Log.Debugf("Rule '%s' is muted in %d of its rooms", rule.Name, len(message.OutputToRooms)-len(rooms))
+	}
+	message.OutputToRooms = rooms
+	return len(rooms) == 0 && len(message.OutputToUsers) == 0
+}
+
+// findMute looks up the mute of a rule in a channel, if it isn't over
+func findMute(rule, channel string, now time.Time, bot *models.Bot) (mute, bool) {
+	value, ok, err := bot.Store.Get(muteBucket, muteKey(rule, channel))
+	if err != nil || !ok {
+		return mute{}, false
+	}
+	var m mute
+	if err := json.Unmarshal(value, &m); err != nil || !m.Until.After(now) {
+		return mute{}, false
+	}
+	return m, true
+}
+
+// loadMutes looks up all mutes, including those that are over but weren't announced yet, soonest over first
+func loadMutes(bot *models.Bot) ([]mute, error) {
+	stored, err := bot.Store.List(muteBucket)
+	if err != nil {
+		return nil, err
+	}
+	mutes := []mute{}
+	for key, value := range stored {
+		var m mute
+		if err := json.Unmarshal(value, &m); err != nil {
+			bot.Log.Errorf("Could not read mute '%s': %s", key, err.Error())
+			continue
+		}
+		mutes = append(mutes, m)
+	}
+	sort.Slice(mutes, func(i, j int) bool {
+		return mutes[i].Until.Before(mutes[j].Until)
+	})
+	return mutes, nil
+}
+
+// mutedBy determines whether the sender of a message may change a mute: who muted the rule, or an admin
+func mutedBy(m mute, message models.Message, bot *models.Bot) bool {
+	return m.UserID == message.Vars["_user.id"] || isAdmin(message, bot)
+}
+
+// mutedByOther tells the sender of a message that someone else muted a rule
+func mutedByOther(m mute, message models.Message, bot *models.Bot) string {
+	return translate(message, bot, "mutes.taken", "${user} muted ${rule} here until ${until}; only they or an admin can change that.", map[string]string{
+		"user":  m.UserName,
+		"rule":  m.Rule,
+		"until": m.Until.Format("2006-01-02 15:04 MST"),
+	})
+}
+
+// muteKey is where the mute of a rule in a channel is stored
+func muteKey(rule, channel string) string {
+	return fmt.Sprintf("%s/%s", strings.ToLower(rule), channel)
+}
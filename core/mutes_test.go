@@ -0,0 +1,126 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestMutes(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Admins: []string{"boss"}}
+	initLogger(testBot)
+	rules := map[string]models.Rule{"deploys.yml": {Name: "deploy-notifications"}}
+	now := time.Date(2019, 5, 1, 14, 0, 0, 0, time.UTC)
+
+	from := func(user, channel string) models.Message {
+		message := models.NewMessage()
+		message.Service = models.MsgServiceChat
+		message.Type = models.MsgTypeChannel
+		message.ChannelID = channel
+		message.Vars["_user.id"] = user
+		message.Vars["_user.name"] = user
+		return message
+	}
+	tests := []struct {
+		name     string
+		message  models.Message
+		rule     string
+		duration string
+		want     string
+	}{
+		{"Unknown rule", from("jane", "C1"), "deploys", "2h", "I don't have a rule called 'deploys'."},
+		{"Bad duration", from("jane", "C1"), "deploy-notifications", "soon", "Tell me for how long, e.g. 'mute deploy-notifications 2h'."},
+		{"Mute", from("jane", "C1"), "Deploy-Notifications", "2h", "Okay, deploy-notifications won't post here until 2019-05-01 16:00 UTC."},
+		{"Muted by someone else", from("joe", "C1"), "deploy-notifications", "1d", "jane muted deploy-notifications here until 2019-05-01 16:00 UTC; only they or an admin can change that."},
+		{"Admin override", from("boss", "C1"), "deploy-notifications", "30m", "Okay, deploy-notifications won't post here until 2019-05-01 14:30 UTC."},
+		{"Other channel", from("joe", "C2"), "deploy-notifications", "1d", "Okay, deploy-notifications won't post here until 2019-05-02 14:00 UTC."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := muteRule(tt.rule, tt.duration, tt.message, rules, testBot, now)
+			if err != nil || got != tt.want {
+				t.Errorf("muteRule() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	output := func(rooms ...string) *models.Message {
+		message := from("jane", "C1")
+		message.OutputToRooms = rooms
+		return &message
+	}
+	rule := models.Rule{Name: "deploy-notifications"}
+	if !muted(output(), rule, now.Add(time.Minute), testBot) {
+		t.Errorf("muted() = false for the channel the rule is muted in")
+	}
+	if muted(output(), models.Rule{Name: "other"}, now.Add(time.Minute), testBot) || muted(output(), rule, now.Add(time.Hour), testBot) {
+		t.Errorf("muted() = true for another rule, or after the mute is over")
+	}
+	if message := output("C1", "C3"); muted(message, rule, now.Add(time.Minute), testBot) || len(message.OutputToRooms) != 1 || message.OutputToRooms[0] != "C3" {
+		t.Errorf("muted() left the rooms %v, want [C3]", message.OutputToRooms)
+	}
+	if !muted(output("C1", "C2"), rule, now.Add(time.Minute), testBot) {
+		t.Errorf("muted() = false with all rooms muted")
+	}
+
+	// The end of a mute is announced once
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+	announced := func() []string {
+		outputs := []string{}
+		for {
+			select {
+			case m := <-outputMsgs:
+				<-hitRule
+				outputs = append(outputs, m.ChannelID+": "+m.Output)
+			default:
+				return outputs
+			}
+		}
+	}
+	endMutes(now.Add(time.Hour), outputMsgs, hitRule, testBot)
+	endMutes(now.Add(time.Hour), outputMsgs, hitRule, testBot)
+	assertOutputs(t, "endMutes()", announced(), []string{"C1: deploy-notifications can post here again, its mute is over."})
+	if _, ok := findMute("deploy-notifications", "C2", now.Add(time.Hour), testBot); !ok {
+		t.Errorf("endMutes() ended a mute that isn't over")
+	}
+}
+
+func TestUnmute(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Admins: []string{"boss"}}
+	initLogger(testBot)
+	rules := map[string]models.Rule{"deploys.yml": {Name: "deploy-notifications"}}
+
+	message := func(user string) *models.Message {
+		m := models.NewMessage()
+		m.Service = models.MsgServiceChat
+		m.Type = models.MsgTypeChannel
+		m.ChannelID = "C1"
+		m.Vars["_user.id"] = user
+		m.Vars["_user.name"] = user
+		return &m
+	}
+	if _, err := muteRule("deploy-notifications", "2h", *message("jane"), rules, testBot, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		user string
+		want string
+	}{
+		{"Someone else", "joe", "jane muted deploy-notifications here until"},
+		{"Admin", "boss", "Okay, deploy-notifications can post here again."},
+		{"Not muted", "jane", "deploy-notifications isn't muted here."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unmuteCommand([]string{"deploy-notifications"}, message(tt.user), nil, rules, nil, testBot)
+			if err != nil || len(got) < len(tt.want) || got[:len(tt.want)] != tt.want {
+				t.Errorf("unmuteCommand() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
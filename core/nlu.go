@@ -0,0 +1,125 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/nlu"
+	"github.com/target/flottbot/utils"
+)
+
+// defaultNLUConfidence is the confidence an intent must be recognized with for 'intent' rules to match
+const defaultNLUConfidence = 0.5
+
+// nluEntityVarPrefix is prepended to recognized entities to build the variable name, e.g. ${_nlu.entity.service}
+const nluEntityVarPrefix = "_nlu.entity."
+
+// configureNLU sets up the natural language understanding service used to match 'intent' rules.
+// Currently, we support 3 services:
+//
+//	rasa: a Rasa server at 'nlu_url' ('nlu_token' if it requires one)
+//	dialogflow: a Dialogflow v2 agent, using the service account key file at 'nlu_credentials'
+//	http: any service at 'nlu_url' implementing flottbot's minimal NLU JSON interface
+func configureNLU(bot *models.Bot) {
+	if len(bot.NLU) == 0 {
+		return
+	}
+	if bot.NLUConfidence == 0 {
+		bot.NLUConfidence = defaultNLUConfidence
+	}
+
+	provider, err := newNLUProvider(strings.ToLower(bot.NLU), bot)
+	if err != nil {
+		bot.Log.Fatalf("Could not configure '%s' NLU: %s", bot.NLU, err.Error())
+	}
+	bot.NLUProvider = provider
+	bot.Log.Infof("Matching intents with '%s' NLU", bot.NLU)
+}
+
+// newNLUProvider creates the NLU provider of the given type
+func newNLUProvider(nluType string, bot *models.Bot) (nlu.Provider, error) {
+	nluURL, err := utils.Substitute(bot.NLUURL, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+	switch nluType {
+	case "rasa":
+		if len(nluURL) == 0 {
+			return nil, fmt.Errorf("'nlu_url' is required for rasa")
+		}
+		token, err := utils.Substitute(bot.NLUToken, map[string]string{})
+		if err != nil {
+			return nil, err
+		}
+		return nlu.NewRasa(nluURL, token), nil
+	case "dialogflow":
+		credentials, err := utils.Substitute(bot.NLUCredentials, map[string]string{})
+		if err != nil {
+			return nil, err
+		}
+		if len(credentials) == 0 {
+			return nil, fmt.Errorf("'nlu_credentials' is required for dialogflow")
+		}
+		return nlu.NewDialogflow(credentials, bot.NLULanguage)
+	case "http":
+		if len(nluURL) == 0 {
+			return nil, fmt.Errorf("'nlu_url' is required for http")
+		}
+		return nlu.NewHTTP(nluURL), nil
+	default:
+		return nil, fmt.Errorf("Unknown NLU '%s', use 'rasa', 'dialogflow', or 'http'", nluType)
+	}
+}
+
+// understandMessage asks the NLU service for the intent of a message addressed to the bot and makes it
+// available as ${_nlu.intent}, ${_nlu.confidence}, and ${_nlu.entity.<name>}.
+// The service is only asked if there are active 'intent' rules the message could match.
+func understandMessage(message *models.Message, rules map[string]models.Rule, bot *models.Bot) {
+	if bot.NLUProvider == nil {
+		return
+	}
+	if message.Service != models.MsgServiceChat && message.Service != models.MsgServiceCLI {
+		return
+	}
+	// 'intent' rules behave like 'respond' rules: the bot must be addressed
+	if message.Type != models.MsgTypeDirect && !message.BotMentioned {
+		return
+	}
+	hasIntentRules := false
+	for _, rule := range rules {
+		if rule.Active && len(rule.Intent) > 0 {
+			hasIntentRules = true
+			break
+		}
+	}
+	if !hasIntentRules {
+		return
+	}
+
+	sessionID := message.ChannelID + "-" + message.Vars["_user.id"]
+	result, err := bot.NLUProvider.Parse(message.Input, sessionID)
+	if err != nil {
+		bot.Log.Errorf("Could not determine intent of message: %s", err.Error())
+		return
+	}
+	bot.Log.Debugf("NLU recognized intent '%s' with confidence %.2f", result.Intent, result.Confidence)
+	if result.Confidence < bot.NLUConfidence {
+		return
+	}
+
+	message.Vars["_nlu.intent"] = result.Intent
+	message.Vars["_nlu.confidence"] = strconv.FormatFloat(result.Confidence, 'f', 2, 64)
+	for name, value := range result.Entities {
+		message.Vars[nluEntityVarPrefix+name] = value
+	}
+}
+
+// fillSlots makes the entities an 'intent' rule maps in its 'slots' field available under the
+// variable names it chose. Entities that weren't recognized are set to empty.
+func fillSlots(rule models.Rule, message *models.Message) {
+	for entity, name := range rule.Slots {
+		message.Vars[name] = message.Vars[nluEntityVarPrefix+entity]
+	}
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/nlu"
+)
+
+// fakeNLU recognizes deployments and nothing else
+type fakeNLU struct {
+	calls int
+}
+
+func (f *fakeNLU) Parse(text, sessionID string) (*nlu.Result, error) {
+	f.calls++
+	switch text {
+	case "ship the api please":
+		return &nlu.Result{Intent: "deploy_service", Confidence: 0.9, Entities: map[string]string{"service": "api"}}, nil
+	case "unsure":
+		return &nlu.Result{Intent: "deploy_service", Confidence: 0.2}, nil
+	default:
+		return nil, errors.New("NLU is down")
+	}
+}
+
+func TestIntentRules(t *testing.T) {
+	rules := map[string]models.Rule{
+		"deploy.yml": {
+			Name:         "deploy",
+			Active:       true,
+			Intent:       "deploy_service",
+			Slots:        map[string]string{"service": "svc", "env": "environment"},
+			FormatOutput: "deploying ${svc} to '${environment}'",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		input     string
+		mentioned bool
+		want      string
+		wantCalls int
+	}{
+		{"Intent recognized", "ship the api please", true, "deploying api to ''", 1},
+		{"Low confidence", "unsure", true, "I understand these commands: \n", 1},
+		{"NLU error", "boom", true, "I understand these commands: \n", 1},
+		{"Bot not addressed", "ship the api please", false, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeNLU{}
+			testBot := new(models.Bot)
+			testBot.NLUProvider = provider
+			testBot.NLUConfidence = defaultNLUConfidence
+
+			message := models.NewMessage()
+			message.Service = models.MsgServiceChat
+			message.Type = models.MsgTypeChannel
+			message.Input = tt.input
+			message.BotMentioned = tt.mentioned
+
+			testOutput := make(chan models.Message, 1)
+			testHitRule := make(chan models.Rule, 1)
+			matcherLoop(message, testOutput, rules, testHitRule, testBot)
+
+			got := ""
+			if len(tt.want) > 0 {
+				// rule actions run asynchronously, so wait for the output
+				got = (<-testOutput).Output
+			}
+			if got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+			if provider.calls != tt.wantCalls {
+				t.Errorf("NLU was called %d times, want %d", provider.calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/handlers"
+	"github.com/target/flottbot/models"
+)
+
+// handleOnCall handles 'oncall' actions. Who is first in line is available as ${_oncall.name},
+// ${_oncall.email}, and ${_oncall.until} (when their shift ends, PagerDuty only); everyone on call
+// as ${_oncall.names} and ${_oncall.emails}, and how many they are as ${_oncall.count}.
+func handleOnCall(action models.Action, msg *models.Message, bot *models.Bot) error {
+	onCalls, err := handlers.OnCall(withHTTPDefaults(action, bot), msg, bot)
+	if err != nil {
+		msg.Error = translate(*msg, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
+		return err
+	}
+
+	names := []string{}
+	emails := []string{}
+	seen := map[string]bool{}
+	for _, o := range onCalls {
+		// People on call at several escalation levels are listed once
+		if seen[o.Email+o.Name] {
+			continue
+		}
+		seen[o.Email+o.Name] = true
+		names = append(names, o.Name)
+		emails = append(emails, o.Email)
+	}
+	msg.Vars["_oncall.count"] = strconv.Itoa(len(names))
+	msg.Vars["_oncall.names"] = strings.Join(names, ", ")
+	msg.Vars["_oncall.emails"] = strings.Join(emails, ", ")
+	msg.Vars["_oncall.name"] = ""
+	msg.Vars["_oncall.email"] = ""
+	msg.Vars["_oncall.until"] = ""
+	if len(onCalls) > 0 {
+		msg.Vars["_oncall.name"] = onCalls[0].Name
+		msg.Vars["_oncall.email"] = onCalls[0].Email
+		if !onCalls[0].Until.IsZero() {
+			msg.Vars["_oncall.until"] = onCalls[0].Until.UTC().Format(time.RFC3339)
+		}
+	}
+
+	bot.Log.Debugf("Successfully executed action '%s'", action.Name)
+	return nil
+}
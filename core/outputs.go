@@ -2,57 +2,148 @@ package core
 
 import (
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
 	"github.com/target/flottbot/remote/cli"
 	"github.com/target/flottbot/remote/discord"
+	"github.com/target/flottbot/remote/mock"
 	"github.com/target/flottbot/remote/slack"
+	"github.com/target/flottbot/tracing"
+	"github.com/target/flottbot/utils"
 )
 
+// sendOutput hands a message and the rule that produced it to the bot's Outputs
+func sendOutput(outputMsgs chan<- models.Message, hitRule chan<- models.Rule, message models.Message, rule models.Rule, bot *models.Bot) {
+	p := pipelineOf(bot)
+	p.outputMu.Lock()
+	defer p.outputMu.Unlock()
+	atomic.AddInt64(&p.pendingSends, 1)
+	outputMsgs <- message
+	hitRule <- rule
+}
+
 // Outputs determines where messages are output based on fields set in the bot.yml
-// TODO: Refactor to keep remote specifics in remote/
 func Outputs(outputMsgs <-chan models.Message, hitRule <-chan models.Rule, bot *models.Bot) {
-	remoteCLI := &cli.Client{}
-	remoteDiscord := &discord.Client{}
-	remoteSlack := &slack.Client{}
+	p := pipelineOf(bot)
 	for {
 		message := <-outputMsgs
 		rule := <-hitRule
-		service := message.Service
-		switch service {
-		case models.MsgServiceChat, models.MsgServiceScheduler:
-			chatApp := strings.ToLower(bot.ChatApplication)
-			switch chatApp {
-			case "discord":
-				if service == models.MsgServiceScheduler {
-					bot.Log.Warn("Scheduler does not currently support Discord")
-					break
-				}
-				remoteDiscord = &discord.Client{Token: bot.DiscordToken}
-				remoteDiscord.Send(message, bot)
-			case "slack":
-				// Create Slack client
-				remoteSlack = &slack.Client{
-					Token:             bot.SlackToken,
-					VerificationToken: bot.SlackVerificationToken,
-					WorkspaceToken:    bot.SlackWorkspaceToken,
-				}
-				if service == models.MsgServiceChat {
-					if bot.InteractiveComponents {
-						remoteSlack.InteractiveComponents(nil, &message, rule, bot)
-					}
-					remoteSlack.Reaction(message, rule, bot)
-				}
-				remoteSlack.Send(message, bot)
-			default:
-				bot.Log.Debugf("Chat application %s is not supported", chatApp)
+		// Rules muted where the message is going don't post there
+		if muted(&message, rule, time.Now(), bot) {
+			bot.Log.Debugf("Rule '%s' is muted, not sending its output", rule.Name)
+			atomic.AddInt64(&p.pendingSends, -1)
+			continue
+		}
+		// Files the bot only knows the URL of are linked rather than uploaded
+		linkFiles(&message)
+		// Never leak credentials into chat, e.g. from an HTTP action's error response
+		message.Output = utils.Redact(message.Output)
+		span := tracing.Start(message.TraceParent, "send")
+		span.SetAttribute("chat.application", strings.ToLower(bot.ChatApplication))
+		// Let the output middleware rewrite or block the message
+		if !processOutput(&message, bot) {
+			span.End()
+			atomic.AddInt64(&p.pendingSends, -1)
+			continue
+		}
+		convertMarkdown(&message, rule, bot)
+		// Users who are away also get the message where the rule's 'fallback' says; looking up
+		// whether they're away mustn't hold up the other messages
+		go deliverFallbacks(message, rule, bot)
+		// Repeats of a rule with 'correlate' go to the thread of its first message instead
+		if sendCorrelated(message, rule, time.Now(), bot) {
+			span.End()
+			atomic.AddInt64(&p.pendingSends, -1)
+			continue
+		}
+		// Messages longer than the chat application allows are sent in parts
+		for i, part := range splitMessage(message, bot) {
+			sendToRemote(part, rule, i == 0, bot)
+		}
+		span.End()
+		atomic.AddInt64(&p.pendingSends, -1)
+	}
+}
+
+// sendToRemote sends a message, or a part of one, to its chat application, adapted to the features
+// the chat application lacks (see degrade). Reactions and interactive components are only handled
+// for the first part of a message.
+func sendToRemote(message models.Message, rule models.Rule, first bool, bot *models.Bot) {
+	client := remoteFor(message, bot)
+	if client == nil {
+		return
+	}
+	service := message.Service
+	chatApp := strings.ToLower(bot.ChatApplication)
+
+	caps := client.Capabilities()
+	if first {
+		rule = withPrompt(rule, message, bot)
+	}
+	// Without buttons to click, options are chosen by their number
+	interactive := caps.Attachments && (bot.InteractiveComponents || chatApp == "mock")
+	if first && !interactive {
+		rememberChoices(message, rule, bot)
+	}
+	// Feedback is only asked for with buttons, a reply to every answer would be noise
+	if first && interactive && service == models.MsgServiceChat {
+		rule = withFeedback(rule, message, bot)
+	}
+	if service == models.MsgServiceChat && first {
+		if interactive {
+			client.InteractiveComponents(nil, &message, rule, bot)
+		}
+		if caps.Reactions {
+			client.Reaction(message, rule, bot)
+		} else if len(rule.Reaction) > 0 {
+			bot.Log.Debugf("Reactions are not supported on %s, not reacting with '%s'", chatApp, rule.Reaction)
+		}
+	}
+	degrade(&message, rule, first, caps)
+	client.Send(message, bot)
+}
+
+// remoteFor creates the client of the chat application a message is sent with, or returns nil if
+// there's none
+// TODO: Refactor to keep remote specifics in remote/
+func remoteFor(message models.Message, bot *models.Bot) remote.Remote {
+	service := message.Service
+	chatApp := strings.ToLower(bot.ChatApplication)
+	switch service {
+	case models.MsgServiceChat, models.MsgServiceScheduler:
+		switch chatApp {
+		case "discord":
+			if service == models.MsgServiceScheduler {
+				bot.Log.Warn("Scheduler does not currently support Discord")
+				return nil
+			}
+			return &discord.Client{Token: bot.DiscordToken}
+		case "slack":
+			// Create Slack client
+			return &slack.Client{
+				Token:             bot.SlackToken,
+				VerificationToken: bot.SlackVerificationToken,
+				WorkspaceToken:    bot.SlackWorkspaceToken,
+			}
+		case "mock":
+			remoteMock, ok := mock.ForBot(bot)
+			if !ok {
+				bot.Log.Errorf("No mock chat application was created for %s", bot.Name)
+				return nil
 			}
-		case models.MsgServiceCLI:
-			remoteCLI.Send(message, bot)
-		case models.MsgServiceUnknown:
-			bot.Log.Error("Found unknown service")
+			return remoteMock
 		default:
-			bot.Log.Errorf("No service found")
+			bot.Log.Debugf("Chat application %s is not supported", chatApp)
 		}
+	case models.MsgServiceCLI:
+		return &cli.Client{}
+	case models.MsgServiceUnknown:
+		bot.Log.Error("Found unknown service")
+	default:
+		bot.Log.Errorf("No service found")
 	}
+	return nil
 }
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"context"
+	"sync"
+
+	"github.com/target/flottbot/models"
+)
+
+// pipeline is the state of a bot's pipeline of messages and rules, so that bots running in the
+// same process don't hold each other up or see each other's work
+type pipeline struct {
+	// The counts of the work in the pipeline, for shutting down; updated atomically, and first in
+	// the struct so they're aligned for 64-bit atomic access on 32-bit platforms
+	inFlight     int64 // messages taken off the input queue that the matcher hasn't finished with
+	runningRules int64 // rules whose actions are still running after the matcher moved on
+	pendingSends int64 // messages handed to Outputs that haven't been sent yet
+
+	// rulesMu guards the rules map, which can be changed at runtime (e.g. via the admin API) while
+	// the Matcher is reading it, and the rules 'call_rule' actions can run
+	rulesMu  sync.RWMutex
+	callable map[string]models.Rule
+
+	// outputMu keeps each message sent to Outputs together with its rule, since messages are sent
+	// from several goroutines (e.g. the matcher's workers, or reminders)
+	outputMu sync.Mutex
+
+	// runs is what the contexts of rule runs derive from. Shutting down cancels it once it gives up
+	// on the rules still running, so their requests and scripts stop instead of outliving the bot.
+	runs        context.Context
+	abandonRuns context.CancelFunc
+}
+
+var (
+	pipelines   = make(map[*models.Bot]*pipeline)
+	pipelinesMu sync.Mutex
+)
+
+// pipelineOf returns the state of a bot's pipeline
+func pipelineOf(bot *models.Bot) *pipeline {
+	pipelinesMu.Lock()
+	defer pipelinesMu.Unlock()
+	p, ok := pipelines[bot]
+	if !ok {
+		p = &pipeline{}
+		p.runs, p.abandonRuns = context.WithCancel(context.Background())
+		pipelines[bot] = p
+	}
+	return p
+}
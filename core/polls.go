@@ -0,0 +1,328 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/utils"
+)
+
+// Storage buckets of polls: the open poll of each channel, and which replica of the bot closes them
+const (
+	pollBucket        = "polls"
+	pollClosingBucket = "poll-closings"
+)
+
+// pollMaxOptions limits how many options a poll can have
+const pollMaxOptions = 10
+
+// pollInterval is how often polls are looked at, to close the ones past their deadline
+const pollInterval = 10 * time.Second
+
+// Flags of the poll command, anywhere after the question
+const (
+	pollFlagAnonymous = "--anonymous" // results don't show who voted for what
+	pollFlagDeadline  = "--deadline"  // followed by a duration, after which the poll closes
+)
+
+// poll is a question people in a channel vote on
+type poll struct {
+	Question  string            `json:"question"`
+	Options   []string          `json:"options"`
+	Creator   string            `json:"creator"`
+	Votes     map[string]int    `json:"votes"`     // user ID to the index of the option voted for
+	Voters    map[string]string `json:"voters"`    // user ID to the name of the user, shown unless it's anonymous
+	Anonymous bool              `json:"anonymous"` // whether results hide who voted for what
+	Deadline  time.Time         `json:"deadline"`  // when the poll closes on its own, if it does
+
+	// Where the poll was started, for posting its results at the deadline
+	Service   models.MessageService `json:"service"`
+	Type      models.MessageType    `json:"type"`
+	ChannelID string                `json:"channel_id"`
+	Thread    string                `json:"thread,omitempty"`
+}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "poll results", usage: "poll results", description: "Show the votes of this channel's poll so far", module: modulePolls, run: pollResultsCommand},
+		builtinCommand{trigger: "poll close", usage: "poll close", description: "Close this channel's poll and show its results", module: modulePolls, run: pollCloseCommand},
+		builtinCommand{trigger: "poll", usage: `poll "<question>" "<option>" "<option>" ... [--anonymous] [--deadline <duration>]`, description: "Start a poll in this channel", args: 3, module: modulePolls, run: pollCommand},
+		builtinCommand{trigger: "vote", usage: "vote <number>", description: "Vote in this channel's poll", args: 1, module: modulePolls, run: voteCommand},
+	)
+}
+
+// pollCommand starts a poll in the message's channel; the first argument is the question, the others are the
+// options, and the flags. Where the chat application has buttons, the options are voted on with them.
+func pollCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	return startPoll(args, message, bot, time.Now())
+}
+
+// startPoll starts a poll in the message's channel, at the given time
+func startPoll(args []string, message *models.Message, bot *models.Bot, now time.Time) (string, error) {
+	if _, ok, err := getPoll(message.ChannelID, bot); err != nil || ok {
+		if err != nil {
+			return "", err
+		}
+		return translate(*message, bot, "polls.already_open", "There already is a poll in this channel, close it with 'poll close' first.", nil), nil
+	}
+
+	p := poll{
+		Creator:   message.Vars["_user.id"],
+		Votes:     map[string]int{},
+		Voters:    map[string]string{},
+		Service:   message.Service,
+		Type:      message.Type,
+		ChannelID: message.ChannelID,
+		Thread:    message.ThreadID,
+	}
+	texts := []string{}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case pollFlagAnonymous:
+			p.Anonymous = true
+		case pollFlagDeadline:
+			var d time.Duration
+			var err error
+			if i+1 < len(args) {
+				d, err = utils.ParseDuration(args[i+1])
+			}
+			if i+1 >= len(args) || err != nil || d <= 0 {
+				return translate(*message, bot, "polls.invalid_deadline", "Give the deadline as a duration, e.g. '--deadline 2h'.", nil), nil
+			}
+			p.Deadline = now.Add(d)
+			i++
+		default:
+			texts = append(texts, args[i])
+		}
+	}
+	if len(texts) < 3 {
+		return translate(*message, bot, "polls.usage", "Give a question and at least two options, e.g. 'poll \"Lunch?\" \":pizza:\" \":sushi:\"'.", nil), nil
+	}
+	if len(texts)-1 > pollMaxOptions {
+		return translate(*message, bot, "polls.too_many_options", "A poll can have at most ${max} options.", map[string]string{"max": strconv.Itoa(pollMaxOptions)}), nil
+	}
+	p.Question, p.Options = texts[0], texts[1:]
+
+	if err := setPoll(message.ChannelID, p, bot); err != nil {
+		return "", err
+	}
+
+	lines := []string{fmt.Sprintf("*%s*", p.Question)}
+	if pollButtons(*message, bot) {
+		message.Remotes.Slack.Attachments = []slack.Attachment{pollAttachment(p)}
+	} else {
+		lines = append(lines, "")
+		for i, option := range p.Options {
+			lines = append(lines, fmt.Sprintf("%d. %s", i+1, option))
+		}
+		lines = append(lines, "", translate(*message, bot, "polls.how_to_vote", "Vote with 'vote <number>'.", nil))
+	}
+	if p.Anonymous {
+		lines = append(lines, translate(*message, bot, "polls.anonymous", "Votes are anonymous.", nil))
+	}
+	if !p.Deadline.IsZero() {
+		lines = append(lines, translate(*message, bot, "polls.deadline", "Voting closes at ${deadline}.", map[string]string{"deadline": p.Deadline.Format("2006-01-02 15:04 MST")}))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// pollButtons determines whether a poll is voted on with buttons: where the chat application has them,
+// and the bot handles interactive components
+func pollButtons(message models.Message, bot *models.Bot) bool {
+	if message.Service != models.MsgServiceChat {
+		return false
+	}
+	switch strings.ToLower(bot.ChatApplication) {
+	case "slack":
+		return bot.InteractiveComponents
+	case "mock":
+		return true
+	}
+	return false
+}
+
+// pollAttachment has a button per option of a poll; clicking one votes for it, like 'vote <number>'
+func pollAttachment(p poll) slack.Attachment {
+	attachment := slack.Attachment{Fallback: p.Question}
+	for i, option := range p.Options {
+		attachment.Actions = append(attachment.Actions, slack.AttachmentAction{
+			Name:  fmt.Sprintf("vote_%d", i+1),
+			Text:  option,
+			Type:  "button",
+			Value: fmt.Sprintf("vote %d", i+1),
+		})
+	}
+	return attachment
+}
+
+// voteCommand votes for the option numbered by the first argument; voting again changes the vote
+func voteCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	p, ok, err := getPoll(message.ChannelID, bot)
+	if err != nil {
+		return "", err
+	}
+	if !ok || (!p.Deadline.IsZero() && time.Now().After(p.Deadline)) {
+		return translate(*message, bot, "polls.none", "There is no poll in this channel.", nil), nil
+	}
+	option, err := strconv.Atoi(args[0])
+	if err != nil || option < 1 || option > len(p.Options) {
+		return translate(*message, bot, "polls.invalid_vote", "Vote with a number from 1 to ${max}.", map[string]string{"max": strconv.Itoa(len(p.Options))}), nil
+	}
+
+	userID := message.Vars["_user.id"]
+	p.Votes[userID] = option - 1
+	if !p.Anonymous {
+		p.Voters[userID] = message.Vars["_user.name"]
+	}
+	if err := setPoll(message.ChannelID, p, bot); err != nil {
+		return "", err
+	}
+	if p.Anonymous {
+		return translate(*message, bot, "polls.voted_anonymously", "Your vote was counted.", nil), nil
+	}
+	return translate(*message, bot, "polls.voted", "You voted for '${option}'.", map[string]string{"option": p.Options[option-1]}), nil
+}
+
+// pollResultsCommand shows the votes of the poll in the message's channel
+func pollResultsCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	p, ok, err := getPoll(message.ChannelID, bot)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return translate(*message, bot, "polls.none", "There is no poll in this channel.", nil), nil
+	}
+	return pollResults(p), nil
+}
+
+// pollCloseCommand closes the poll in the message's channel, which only its creator or a bot admin may do
+func pollCloseCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	p, ok, err := getPoll(message.ChannelID, bot)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return translate(*message, bot, "polls.none", "There is no poll in this channel.", nil), nil
+	}
+	if p.Creator != message.Vars["_user.id"] && !isAdmin(*message, bot) {
+		return translate(*message, bot, "polls.not_creator", "Only whoever started the poll can close it.", nil), nil
+	}
+	if err := bot.Store.Delete(pollBucket, message.ChannelID); err != nil {
+		return "", err
+	}
+	return translate(*message, bot, "polls.closed", "The poll is closed.", nil) + "\n" + pollResults(p), nil
+}
+
+// Polls closes polls when their deadline passes, and posts their results where they were started.
+// Only one replica of the bot closes each of them.
+func Polls(outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	if !moduleEnabled(modulePolls, bot) {
+		return
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-remote.Stopping():
+			return
+		case <-ticker.C:
+			closeDuePolls(time.Now(), outputMsgs, hitRule, bot)
+		}
+	}
+}
+
+// closeDuePolls closes the polls past their deadline at the given time
+func closeDuePolls(now time.Time, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	polls, err := bot.Store.List(pollBucket)
+	if err != nil {
+		bot.Log.Errorf("Could not look up polls: %s", err.Error())
+		return
+	}
+	for channel, value := range polls {
+		var p poll
+		if err := json.Unmarshal(value, &p); err != nil || p.Deadline.IsZero() || p.Deadline.After(now) {
+			continue
+		}
+		// Another replica of the bot may be closing the poll already
+		claimed, err := bot.Store.Claim(pollClosingBucket, channel+"@"+strconv.FormatInt(p.Deadline.Unix(), 10), []byte(bot.InstanceID), time.Minute)
+		if err != nil || !claimed {
+			continue
+		}
+		if err := bot.Store.Delete(pollBucket, channel); err != nil {
+			bot.Log.Errorf("Could not close the poll in '%s': %s", channel, err.Error())
+			continue
+		}
+
+		message := models.NewMessage()
+		message.Service = p.Service
+		message.Type = p.Type
+		message.ChannelID = p.ChannelID
+		message.ThreadID = p.Thread
+		message.Output = translate(message, bot, "polls.closed", "The poll is closed.", nil) + "\n" + pollResults(p)
+		sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+	}
+}
+
+// pollResults shows how many votes each option of a poll got, and who voted for it unless it's anonymous
+func pollResults(p poll) string {
+	counts := make([]int, len(p.Options))
+	voters := make([][]string, len(p.Options))
+	for userID, option := range p.Votes {
+		if option >= 0 && option < len(counts) {
+			counts[option]++
+			if name := p.Voters[userID]; !p.Anonymous && len(name) > 0 {
+				voters[option] = append(voters[option], name)
+			}
+		}
+	}
+	lines := []string{fmt.Sprintf("*%s*", p.Question)}
+	for i, option := range p.Options {
+		votes := "votes"
+		if counts[i] == 1 {
+			votes = "vote"
+		}
+		line := fmt.Sprintf("%d. %s - %d %s", i+1, option, counts[i], votes)
+		if len(voters[i]) > 0 {
+			sort.Strings(voters[i])
+			line = line + fmt.Sprintf(" (%s)", strings.Join(voters[i], ", "))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// getPoll looks up the open poll of a channel
+func getPoll(channel string, bot *models.Bot) (poll, bool, error) {
+	var p poll
+	value, ok, err := bot.Store.Get(pollBucket, channel)
+	if err != nil || !ok {
+		return p, false, err
+	}
+	if err := json.Unmarshal(value, &p); err != nil {
+		return p, false, err
+	}
+	if p.Votes == nil {
+		p.Votes = map[string]int{}
+	}
+	if p.Voters == nil {
+		p.Voters = map[string]string{}
+	}
+	return p, true, nil
+}
+
+// setPoll stores the open poll of a channel
+func setPoll(channel string, p poll, bot *models.Bot) error {
+	value, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return bot.Store.Set(pollBucket, channel, value, 0)
+}
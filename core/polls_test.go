@@ -0,0 +1,116 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestPolls(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Modules: []string{modulePolls}, Admins: []string{"admin"}}
+
+	message := func(user, channel string) *models.Message {
+		m := models.NewMessage()
+		m.Service = models.MsgServiceChat
+		m.ChannelID = channel
+		m.Vars["_user.id"] = user
+		m.Vars["_user.name"] = user
+		return &m
+	}
+
+	tests := []struct {
+		name    string
+		command func(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error)
+		args    []string
+		message *models.Message
+		want    string
+	}{
+		{"No poll", voteCommand, []string{"1"}, message("jane", "C1"), "There is no poll in this channel."},
+		{"Start", pollCommand, []string{"Lunch?", "Pizza", "Tacos"}, message("jane", "C1"), "*Lunch?*\n\n1. Pizza\n2. Tacos\n\nVote with 'vote <number>'."},
+		{"Already open", pollCommand, []string{"Dinner?", "Soup", "Salad"}, message("john", "C1"), "There already is a poll in this channel, close it with 'poll close' first."},
+		{"Vote", voteCommand, []string{"1"}, message("jane", "C1"), "You voted for 'Pizza'."},
+		{"Change vote", voteCommand, []string{"2"}, message("jane", "C1"), "You voted for 'Tacos'."},
+		{"Another vote", voteCommand, []string{"2"}, message("john", "C1"), "You voted for 'Tacos'."},
+		{"Invalid vote", voteCommand, []string{"3"}, message("john", "C1"), "Vote with a number from 1 to 2."},
+		{"Other channel", voteCommand, []string{"1"}, message("john", "C2"), "There is no poll in this channel."},
+		{"Results", pollResultsCommand, nil, message("john", "C1"), "*Lunch?*\n1. Pizza - 0 votes\n2. Tacos - 2 votes (jane, john)"},
+		{"Close by someone else", pollCloseCommand, nil, message("john", "C1"), "Only whoever started the poll can close it."},
+		{"Close by admin", pollCloseCommand, nil, message("admin", "C1"), "The poll is closed.\n*Lunch?*\n1. Pizza - 0 votes\n2. Tacos - 2 votes (jane, john)"},
+		{"Closed", pollResultsCommand, nil, message("john", "C1"), "There is no poll in this channel."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.command(tt.args, tt.message, nil, nil, nil, testBot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPollOptions(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Modules: []string{modulePolls}, ChatApplication: "mock"}
+	initLogger(testBot)
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	message := func(user, channel string) *models.Message {
+		m := models.NewMessage()
+		m.Service = models.MsgServiceChat
+		m.Type = models.MsgTypeChannel
+		m.ChannelID = channel
+		m.Vars["_user.id"] = user
+		m.Vars["_user.name"] = user
+		return &m
+	}
+
+	start := message("jane", "C1")
+	output, err := startPoll([]string{"Lunch?", ":pizza:", "--anonymous", ":sushi:", "--deadline", "30m"}, start, testBot, now)
+	if err != nil || output != "*Lunch?*\nVotes are anonymous.\nVoting closes at 2019-05-01 12:30 UTC." {
+		t.Errorf("startPoll() = %q, %v", output, err)
+	}
+	attachments := start.Remotes.Slack.Attachments
+	if len(attachments) != 1 || len(attachments[0].Actions) != 2 || attachments[0].Actions[1].Text != ":sushi:" || attachments[0].Actions[1].Value != "vote 2" {
+		t.Errorf("startPoll() attachments = %+v, want a button per option", attachments)
+	}
+
+	if output, _ := startPoll([]string{"Lunch?", ":pizza:", "--deadline", "soon"}, message("jane", "C2"), testBot, now); output != "Give the deadline as a duration, e.g. '--deadline 2h'." {
+		t.Errorf("startPoll() = %q", output)
+	}
+	if output, _ := startPoll([]string{"Lunch?", ":pizza:", "--anonymous"}, message("jane", "C2"), testBot, now); !strings.HasPrefix(output, "Give a question and at least two options") {
+		t.Errorf("startPoll() = %q", output)
+	}
+
+	// Votes of anonymous polls are only counted
+	p, _, _ := getPoll("C1", testBot)
+	p.Deadline = time.Now().Add(time.Hour)
+	setPoll("C1", p, testBot)
+	if output, _ := voteCommand([]string{"2"}, message("joe", "C1"), nil, nil, nil, testBot); output != "Your vote was counted." {
+		t.Errorf("voteCommand() = %q", output)
+	}
+
+	// Polls past their deadline are closed, with their results posted where they were started
+	outputMsgs := make(chan models.Message, 1)
+	hitRule := make(chan models.Rule, 1)
+	closeDuePolls(p.Deadline.Add(-time.Minute), outputMsgs, hitRule, testBot)
+	if len(outputMsgs) != 0 {
+		t.Fatalf("closeDuePolls() closed a poll before its deadline")
+	}
+	closeDuePolls(p.Deadline, outputMsgs, hitRule, testBot)
+	if len(outputMsgs) != 1 {
+		t.Fatalf("closeDuePolls() didn't close the poll at its deadline")
+	}
+	closed := <-outputMsgs
+	<-hitRule
+	if closed.ChannelID != "C1" || closed.Output != "The poll is closed.\n*Lunch?*\n1. :pizza: - 0 votes\n2. :sushi: - 1 vote" {
+		t.Errorf("closeDuePolls() sent %q to %q", closed.Output, closed.ChannelID)
+	}
+	if _, open, _ := getPoll("C1", testBot); open {
+		t.Errorf("closeDuePolls() left the poll open")
+	}
+}
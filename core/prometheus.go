@@ -0,0 +1,129 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/handlers"
+	"github.com/target/flottbot/models"
+)
+
+// promSummaryMax limits how many series ${_prom_summary} lists
+const promSummaryMax = 20
+
+// handlePrometheus handles 'prometheus' actions. The result is available as ${_prom_value} (the value of
+// the first series, or its last value for range queries), ${_prom_count} (the number of series),
+// ${_prom_summary} (a line per series), and ${_prom_rows} (a JSON array of the series' labels and values,
+// to be shown with 'format')
+func handlePrometheus(action models.Action, msg *models.Message, bot *models.Bot) error {
+	series, err := handlers.PromQuery(withHTTPDefaults(action, bot), msg, bot, time.Now())
+	if err != nil {
+		msg.Error = translate(*msg, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
+		return err
+	}
+	isRange := len(action.Range) > 0
+
+	msg.Vars["_prom_count"] = strconv.Itoa(len(series))
+	msg.Vars["_prom_value"] = ""
+	if len(series) > 0 && len(series[0].Samples) > 0 {
+		samples := series[0].Samples
+		msg.Vars["_prom_value"] = promValue(samples[len(samples)-1].Value)
+	}
+
+	rows := make([]map[string]interface{}, len(series))
+	lines := []string{}
+	for i, s := range series {
+		row := map[string]interface{}{}
+		for name, value := range s.Metric {
+			row[name] = value
+		}
+		stats := promStats(s.Samples)
+		row["value"] = stats["last"]
+		line := fmt.Sprintf("%s: %s", promSeriesName(s.Metric), stats["last"])
+		if isRange {
+			for _, stat := range []string{"min", "avg", "max"} {
+				row[stat] = stats[stat]
+			}
+			line = fmt.Sprintf("%s: last %s, min %s, avg %s, max %s", promSeriesName(s.Metric), stats["last"], stats["min"], stats["avg"], stats["max"])
+		}
+		rows[i] = row
+		if i < promSummaryMax {
+			lines = append(lines, line)
+		}
+	}
+	if len(series) > promSummaryMax {
+		lines = append(lines, fmt.Sprintf("(and %d more)", len(series)-promSummaryMax))
+	}
+	if len(series) == 0 {
+		lines = append(lines, "(no data)")
+	}
+	msg.Vars["_prom_summary"] = strings.Join(lines, "\n")
+
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	msg.Vars["_prom_rows"] = string(data)
+
+	bot.Log.Debugf("Successfully executed action '%s'", action.Name)
+	return nil
+}
+
+// handleSilence handles 'silence' actions. The silence's ID is available as ${_silence_id},
+// and when it ends as ${_silence_ends_at}.
+func handleSilence(action models.Action, msg *models.Message, bot *models.Bot) error {
+	silence, err := handlers.CreateSilence(withHTTPDefaults(action, bot), msg, bot, time.Now())
+	if err != nil {
+		msg.Error = translate(*msg, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
+		return err
+	}
+	msg.Vars["_silence_id"] = silence.ID
+	msg.Vars["_silence_ends_at"] = silence.EndsAt.UTC().Format(time.RFC3339)
+
+	bot.Log.Debugf("Successfully executed action '%s'", action.Name)
+	return nil
+}
+
+// promSeriesName writes a series the way Prometheus does, e.g. up{instance="a:9100",job="node"}
+func promSeriesName(metric map[string]string) string {
+	labels := []string{}
+	for name, value := range metric {
+		if name != "__name__" {
+			labels = append(labels, fmt.Sprintf("%s=%q", name, value))
+		}
+	}
+	sort.Strings(labels)
+	return metric["__name__"] + "{" + strings.Join(labels, ",") + "}"
+}
+
+// promStats are the last, min, avg, and max values of a series
+func promStats(samples []models.PromSample) map[string]string {
+	if len(samples) == 0 {
+		return map[string]string{"last": "", "min": "", "avg": "", "max": ""}
+	}
+	min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+	for _, s := range samples {
+		min = math.Min(min, s.Value)
+		max = math.Max(max, s.Value)
+		sum += s.Value
+	}
+	return map[string]string{
+		"last": promValue(samples[len(samples)-1].Value),
+		"min":  promValue(min),
+		"avg":  promValue(sum / float64(len(samples))),
+		"max":  promValue(max),
+	}
+}
+
+// promValue rounds a value to three decimals for people to read
+func promValue(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestHandlePrometheus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/query_range" {
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+				{"metric":{"job":"api"},"values":[[1556665200,"1"],[1556665260,"2"],[1556665320,"4.1234"]]}]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"up","job":"web","instance":"b:80"},"value":[1556668800,"0"]},
+			{"metric":{"__name__":"up","job":"api","instance":"a:80"},"value":[1556668800,"1"]}]}}`))
+	}))
+	defer ts.Close()
+	bot := &models.Bot{PrometheusURL: ts.URL}
+
+	tests := []struct {
+		name        string
+		action      models.Action
+		wantValue   string
+		wantSummary string
+		wantRows    string
+	}{
+		{"Instant", models.Action{Name: "up", Query: "up"}, "0",
+			"up{instance=\"b:80\",job=\"web\"}: 0\nup{instance=\"a:80\",job=\"api\"}: 1",
+			`[{"__name__":"up","instance":"b:80","job":"web","value":"0"},{"__name__":"up","instance":"a:80","job":"api","value":"1"}]`},
+		{"Range", models.Action{Name: "rate", Query: "rate(x[5m])", Range: "1h"}, "4.123",
+			"{job=\"api\"}: last 4.123, min 1, avg 2.374, max 4.123",
+			`[{"avg":"2.374","job":"api","max":"4.123","min":"1","value":"4.123"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := models.NewMessage()
+			if err := handlePrometheus(tt.action, &msg, bot); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Vars["_prom_value"] != tt.wantValue {
+				t.Errorf("_prom_value = %q, want %q", msg.Vars["_prom_value"], tt.wantValue)
+			}
+			if msg.Vars["_prom_summary"] != tt.wantSummary {
+				t.Errorf("_prom_summary = %q, want %q", msg.Vars["_prom_summary"], tt.wantSummary)
+			}
+			if msg.Vars["_prom_rows"] != tt.wantRows {
+				t.Errorf("_prom_rows = %s, want %s", msg.Vars["_prom_rows"], tt.wantRows)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
 )
 
 var promRouter *mux.Router
@@ -41,12 +42,13 @@ func Prommetric(input string, bot *models.Bot) {
 			promRouter.HandleFunc("/metrics_health", promHealthHandle).Methods("GET")
 
 			// metrics handler
-			prometheus.MustRegister(botResponseCollector)
+			prometheus.MustRegister(botResponseCollector, ruleVersionsCollector, inputQueueDepth, inputQueueOverflows, panicsCollector)
+			prometheus.MustRegister(remote.Collectors()...)
 			promRouter.HandleFunc("/metrics", prometheus.Handler().ServeHTTP).Methods("GET")
 			// http.Handle("/metrics", prometheus.Handler())
 
 			// start prometheus server
-			go http.ListenAndServe(":8080", promRouter)
+			go remote.ListenAndServe(remote.ServerMetrics, ":8080", promRouter, false, bot)
 			bot.Log.Info("Prometheus Server: serving metrics at /metrics")
 		} else {
 			botResponseCollector.With(prometheus.Labels{"rulename": input}).Inc()
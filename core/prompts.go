@@ -0,0 +1,142 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// promptBucket is the storage bucket holding the choices a channel can answer with a number
+const promptBucket = "prompts"
+
+// promptTTL is how long choices can be answered
+const promptTTL = 24 * time.Hour
+
+// choices are the options a message offered in a channel, to be answered with their number on chat
+// applications without buttons
+type choices struct {
+	Rule   string   `json:"rule"`
+	UserID string   `json:"user_id,omitempty"` // only this user may answer, if set
+	Values []string `json:"values"`
+}
+
+// withPrompt adds the rule's 'prompt' to its attachments, the one way the bot offers options: as
+// buttons where the chat application has them, and as numbered options to answer otherwise (see
+// degrade and rememberChoices). Choosing either way sends the bot the option's value. Discord is
+// answered by number, its components aren't supported by the Discord package yet.
+func withPrompt(rule models.Rule, message models.Message, bot *models.Bot) models.Rule {
+	if len(rule.Prompt.Options) == 0 {
+		return rule
+	}
+	attachment := slack.Attachment{Text: rule.Prompt.Text, Fallback: rule.Prompt.Text, CallbackID: message.ID}
+	for i, option := range rule.Prompt.Options {
+		value, err := utils.Substitute(option.Value, message.Vars)
+		if err != nil {
+			bot.Log.Warnf("Could not fill in option %d of the prompt of rule '%s': %s", i+1, rule.Name, err.Error())
+		}
+		attachment.Actions = append(attachment.Actions, slack.AttachmentAction{
+			Name:  fmt.Sprintf("option_%d", i+1),
+			Text:  option.Text,
+			Type:  "button",
+			Value: value,
+			Style: option.Style,
+		})
+	}
+	// The rule's own attachments are shared with every message it sends
+	attachments := append([]slack.Attachment{}, rule.Remotes.Slack.Attachments...)
+	rule.Remotes.Slack.Attachments = append(attachments, attachment)
+	return rule
+}
+
+// rememberChoices keeps the options of a message's attachments that are shown as numbered options,
+// so the next message in its channel(s) can choose one by its number
+func rememberChoices(message models.Message, rule models.Rule, bot *models.Bot) {
+	if bot.Store == nil {
+		return
+	}
+	attachments := message.Remotes.Slack.Attachments
+	if len(attachments) == 0 {
+		attachments = rule.Remotes.Slack.Attachments
+	}
+	c := choices{Rule: rule.Name, UserID: message.Vars["_user.id"]}
+	for _, a := range attachments {
+		for _, action := range a.Actions {
+			if len(action.URL) > 0 && len(action.Options) == 0 {
+				// Links can be followed, but not chosen; they keep their number though
+				c.Values = append(c.Values, "")
+				continue
+			}
+			values := []string{action.Value}
+			if len(action.Options) > 0 {
+				values = values[:0]
+				for _, o := range action.Options {
+					values = append(values, o.Value)
+				}
+			}
+			for _, value := range values {
+				if substituted, err := utils.Substitute(value, message.Vars); err == nil {
+					value = substituted
+				}
+				c.Values = append(c.Values, value)
+			}
+		}
+	}
+	if len(c.Values) == 0 {
+		return
+	}
+
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	channels := message.OutputToRooms
+	if len(channels) == 0 {
+		channels = []string{message.ChannelID}
+	}
+	for _, channel := range channels {
+		if err := bot.Store.Set(promptBucket, channel, raw, promptTTL); err != nil {
+			bot.Log.Errorf("Could not keep the options of rule '%s': %s", rule.Name, err.Error())
+		}
+	}
+}
+
+// answerPrompt turns a number sent in a channel with open choices into the value of the option
+// with that number, as if that was sent, so the rules pick up from there like with a button.
+// ${_interaction.rule} is the rule that offered the options.
+func answerPrompt(message *models.Message, bot *models.Bot) {
+	if bot.Store == nil || message.Event != models.MsgEventSent {
+		return
+	}
+	number, err := strconv.Atoi(strings.TrimSpace(message.Input))
+	if err != nil || number < 1 {
+		return
+	}
+	raw, ok, err := bot.Store.Get(promptBucket, message.ChannelID)
+	if err != nil || !ok {
+		return
+	}
+	var c choices
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return
+	}
+	if number > len(c.Values) || len(c.Values[number-1]) == 0 {
+		return
+	}
+	if len(c.UserID) > 0 && c.UserID != message.Vars["_user.id"] {
+		return
+	}
+	if err := bot.Store.Delete(promptBucket, message.ChannelID); err != nil {
+		bot.Log.Errorf("Could not close the options of rule '%s': %s", c.Rule, err.Error())
+	}
+
+	message.Input = c.Values[number-1]
+	message.BotMentioned = true
+	message.Vars["_interaction.rule"] = c.Rule
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestPrompts(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New()}
+	initLogger(testBot)
+
+	rule := models.Rule{Name: "deploy", Prompt: models.Prompt{Text: "Deploy ${app} where?", Options: []models.PromptOption{
+		{Text: "Staging", Value: "deploy ${app} staging"},
+		{Text: "Production", Value: "deploy ${app} prod", Style: "danger"},
+	}}}
+
+	sent := models.NewMessage()
+	sent.ID = "abc"
+	sent.ChannelID = "C1"
+	sent.Vars["app"] = "api"
+	sent.Vars["_user.id"] = "U1"
+
+	prompted := withPrompt(rule, sent, testBot)
+	attachments := prompted.Remotes.Slack.Attachments
+	if len(attachments) != 1 || len(attachments[0].Actions) != 2 {
+		t.Fatalf("withPrompt() attachments = %+v, want one with two buttons", attachments)
+	}
+	if got := attachments[0].Actions[1]; got.Value != "deploy api prod" || got.Style != "danger" || got.Name != "option_2" {
+		t.Errorf("withPrompt() second button = %+v", got)
+	}
+	if attachments[0].CallbackID != "abc" {
+		t.Errorf("withPrompt() callback = %q, want %q", attachments[0].CallbackID, "abc")
+	}
+	if len(rule.Remotes.Slack.Attachments) != 0 {
+		t.Errorf("withPrompt() changed the rule's own attachments")
+	}
+
+	rememberChoices(sent, prompted, testBot)
+
+	answer := func(user, channel, input string) models.Message {
+		m := models.NewMessage()
+		m.Event = models.MsgEventSent
+		m.ChannelID = channel
+		m.Input = input
+		m.Vars["_user.id"] = user
+		answerPrompt(&m, testBot)
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		user    string
+		channel string
+		input   string
+		want    string
+	}{
+		{"Not a number", "U1", "C1", "prod please", "prod please"},
+		{"Out of range", "U1", "C1", "3", "3"},
+		{"Other channel", "U1", "C2", "2", "2"},
+		{"Other user", "U2", "C1", "2", "2"},
+		{"Chosen", "U1", "C1", " 2 ", "deploy api prod"},
+		{"Already answered", "U1", "C1", "1", "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := answer(tt.user, tt.channel, tt.input)
+			if got.Input != tt.want {
+				t.Errorf("answerPrompt() input = %q, want %q", got.Input, tt.want)
+			}
+			if chosen := got.Input != tt.input; chosen != got.BotMentioned || (chosen && got.Vars["_interaction.rule"] != "deploy") {
+				t.Errorf("answerPrompt() mentioned = %v, rule = %q", got.BotMentioned, got.Vars["_interaction.rule"])
+			}
+		})
+	}
+}
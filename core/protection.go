@@ -0,0 +1,425 @@
+package core
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// ignoredBucket is the storage bucket of the users the bot ignores where it's protected, by user ID, or
+// by user name when an admin named them
+const ignoredBucket = "ignored-users"
+
+// Defaults of 'protection' in bot.yml
+const (
+	floodMessages = 10
+	floodWindow   = time.Minute
+	ignoreFor     = time.Hour
+)
+
+// Why a user is ignored
+const (
+	ignoreReasonAdmin  = "admin"
+	ignoreReasonFlood  = "flood"
+	ignoreReasonLink   = "link"
+	ignoreReasonInvite = "invite"
+)
+
+// ignoreReports are what the moderators are told when a user is ignored, by why
+var ignoreReports = map[string]string{
+	ignoreReasonFlood:  "I'm ignoring ${user} until ${until}, they sent too many messages in ${channel}.",
+	ignoreReasonLink:   "I'm ignoring ${user} until ${until}, they posted a link that isn't allowed in ${channel}: ${input}",
+	ignoreReasonInvite: "I'm ignoring ${user} until ${until}, they posted an invite in ${channel}: ${input}",
+}
+
+// links finds the links in a message, with or without a scheme; chat applications put some in <>
+var links = regexp.MustCompile(`(?i)\bhttps?://[^\s<>|]+|\bwww\.[^\s<>|]+`)
+
+// invites finds invites to Discord servers and Telegram groups, which are spam more often than not
+var invites = regexp.MustCompile(`(?i)\b(?:discord(?:app)?\.com/invite|discord\.(?:gg|io|me)|t\.me/(?:joinchat/|\+))/?[^\s<>|]*`)
+
+// ignoredUser is a user the bot ignores where it's protected, until a time or, without one, until an
+// admin unignores them
+type ignoredUser struct {
+	UserID   string    `json:"user_id"`
+	UserName string    `json:"user_name"`
+	Reason   string    `json:"reason"`
+	By       string    `json:"by,omitempty"` // the admin who ignored them
+	Until    time.Time `json:"until,omitempty"`
+}
+
+// LinkFilter decides which links users may post where the bot is protected, see 'protection' in bot.yml.
+// Allow is given every link in the messages of users who aren't admins; returning false ignores the
+// user for a while, and tells the moderators.
+type LinkFilter interface {
+	Allow(link string, message models.Message, bot *models.Bot) bool
+}
+
+// LinkFilterFunc lets a function be used as LinkFilter
+type LinkFilterFunc func(link string, message models.Message, bot *models.Bot) bool
+
+// Allow implementation to satisfy LinkFilter interface
+func (f LinkFilterFunc) Allow(link string, message models.Message, bot *models.Bot) bool {
+	return f(link, message, bot)
+}
+
+// linkFilters are the link filters of each bot, and floods the recent messages of each user, by bot
+var (
+	protectionMu sync.Mutex
+	linkFilters  = make(map[*models.Bot][]LinkFilter)
+	floods       = make(map[*models.Bot]map[string][]time.Time)
+)
+
+// UseLinkFilter adds filters to the ones deciding which links users may post, e.g. in a project embedding
+// flottbot. They're asked after 'block_invites' and 'block_links' in bot.yml, in the order they were added.
+func UseLinkFilter(bot *models.Bot, filters ...LinkFilter) {
+	protectionMu.Lock()
+	defer protectionMu.Unlock()
+	linkFilters[bot] = append(linkFilters[bot], filters...)
+}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "ignore", usage: "ignore <user> [duration]", description: "Ignore a user's messages where I'm protected, for good or for a while, without telling them", args: 1, admin: true, run: ignoreCommand},
+		builtinCommand{trigger: "unignore", usage: "unignore <user>", description: "Stop ignoring a user", args: 1, admin: true, run: unignoreCommand},
+		builtinCommand{trigger: "ignored", usage: "ignored", description: "List the users I ignore", admin: true, run: listIgnoredCommand},
+	)
+}
+
+// protect determines whether a message on a chat application with 'protection' may be matched. Messages
+// of ignored users are dropped without telling them; users who send too many messages, or links the
+// filters don't allow, are ignored for a while, and the moderators are told. Admins are never ignored.
+func protect(message *models.Message, now time.Time, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) bool {
+	if !protected(*message, bot) || isAdmin(*message, bot) {
+		return true
+	}
+	if ignored(*message, now, bot) {
+		bot.Log.Debugf("Ignoring message %s of user '%s'", message.ID, message.Vars["_user.name"])
+		return false
+	}
+
+	reason := filterLinks(*message, bot)
+	if flooding(*message, now, bot) {
+		reason = ignoreReasonFlood
+	}
+	if len(reason) == 0 {
+		return true
+	}
+	ignoreUser(reason, *message, now, outputMsgs, hitRule, bot)
+	return false
+}
+
+// protected determines whether a message was received on a chat application with 'protection'
+func protected(message models.Message, bot *models.Bot) bool {
+	if message.Service != models.MsgServiceChat || len(message.Vars["_user.id"]) == 0 {
+		return false
+	}
+	for _, name := range bot.Protection.Remotes {
+		if strings.EqualFold(strings.TrimSpace(name), messageRemote(message, bot)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored determines whether the sender of a message is ignored, by 'shadow_ignore' in bot.yml or
+// in the storage backend
+func ignored(message models.Message, now time.Time, bot *models.Bot) bool {
+	id, name := message.Vars["_user.id"], message.Vars["_user.name"]
+	for _, user := range bot.Protection.ShadowIgnore {
+		if user == id || (len(name) > 0 && strings.EqualFold(user, name)) {
+			return true
+		}
+	}
+	if bot.Store == nil {
+		return false
+	}
+	for _, key := range []string{ignoreKey(id), ignoreKey(name)} {
+		if _, ok := findIgnored(key, now, bot); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// flooding counts the message of its sender, and determines whether they sent more than 'flood_messages'
+// within 'flood_window'. Replicas of the bot count the messages they handle each.
+func flooding(message models.Message, now time.Time, bot *models.Bot) bool {
+	max := bot.Protection.FloodMessages
+	if max <= 0 {
+		max = floodMessages
+	}
+	window := protectionDuration(bot.Protection.FloodWindow, floodWindow)
+
+	protectionMu.Lock()
+	defer protectionMu.Unlock()
+	if floods[bot] == nil {
+		floods[bot] = make(map[string][]time.Time)
+	}
+	// Forget the messages older than the window, so the map doesn't grow forever
+	for user, times := range floods[bot] {
+		recent := times[:0]
+		for _, t := range times {
+			if now.Sub(t) < window {
+				recent = append(recent, t)
+			}
+		}
+		if len(recent) == 0 {
+			delete(floods[bot], user)
+			continue
+		}
+		floods[bot][user] = recent
+	}
+	user := message.Vars["_user.id"]
+	floods[bot][user] = append(floods[bot][user], now)
+	if len(floods[bot][user]) <= max {
+		return false
+	}
+	// Once they're ignored, they start over
+	delete(floods[bot], user)
+	return true
+}
+
+// filterLinks determines why the links in a message aren't allowed, by 'block_invites', 'block_links',
+// and the link filters, or returns an empty string if they are
+func filterLinks(message models.Message, bot *models.Bot) string {
+	if bot.Protection.BlockInvites && invites.MatchString(message.Input) {
+		return ignoreReasonInvite
+	}
+	found := links.FindAllString(message.Input, -1)
+	if len(found) == 0 {
+		return ""
+	}
+	protectionMu.Lock()
+	filters := linkFilters[bot]
+	protectionMu.Unlock()
+	for _, link := range found {
+		if bot.Protection.BlockLinks && !allowedDomain(link, bot.Protection.AllowedDomains) {
+			return ignoreReasonLink
+		}
+		for _, filter := range filters {
+			if !filter.Allow(link, message, bot) {
+				return ignoreReasonLink
+			}
+		}
+	}
+	return ""
+}
+
+// allowedDomain determines whether a link goes to one of the domains, or their subdomains
+func allowedDomain(link string, domains []string) bool {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "."))
+		if len(domain) > 0 && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreUser ignores the sender of a message for 'ignore_for', and tells the moderators why
+func ignoreUser(reason string, message models.Message, now time.Time, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	length := protectionDuration(bot.Protection.IgnoreFor, ignoreFor)
+	user := ignoredUser{
+		UserID:   message.Vars["_user.id"],
+		UserName: message.Vars["_user.name"],
+		Reason:   reason,
+		Until:    now.Add(length),
+	}
+	if err := saveIgnored(ignoreKey(user.UserID), user, bot); err != nil {
+		bot.Log.Errorf("Could not ignore user '%s': %s", user.UserName, err.Error())
+	}
+	bot.Log.Warnf("Ignoring user '%s' (%s) until %s, for %s", user.UserName, user.UserID, user.Until.Format(time.RFC3339), reason)
+
+	channel := bot.Protection.ModeratorChannel
+	if len(channel) == 0 {
+		channel = bot.ErrorChannel
+	}
+	if len(channel) == 0 {
+		return
+	}
+	report, ok := channelMessage(channel, "", bot)
+	if !ok {
+		bot.Log.Errorf("Could not find the moderator channel '%s'", channel)
+		return
+	}
+	report.ChannelName = channel
+	report.Output = translate(report, bot, "protection."+reason, ignoreReports[reason], map[string]string{
+		"user":    user.UserName,
+		"id":      user.UserID,
+		"channel": message.ChannelName,
+		"until":   user.Until.Format("2006-01-02 15:04 MST"),
+		"input":   digestLine(message.Input),
+	})
+	sendOutput(outputMsgs, hitRule, report, models.Rule{}, bot)
+}
+
+// ignoreCommand ignores the user named, or mentioned, by the first argument, for good or for the duration
+// given as second argument
+func ignoreCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	return ignoreUserCommand(args, *message, time.Now(), bot)
+}
+
+// ignoreUserCommand ignores the user named by the first argument
+func ignoreUserCommand(args []string, message models.Message, now time.Time, bot *models.Bot) (string, error) {
+	name := userArg(args[0])
+	user := ignoredUser{UserID: name, UserName: args[0], Reason: ignoreReasonAdmin, By: message.Vars["_user.name"]}
+	var length time.Duration
+	if len(args) > 1 {
+		d, err := utils.ParseDuration(args[1])
+		if err != nil || d <= 0 {
+			return translate(message, bot, "protection.usage", "Tell me for how long, e.g. 'ignore ${user} 1d', or leave it out to ignore them until you unignore them.", map[string]string{"user": args[0]}), nil
+		}
+		length = d
+		user.Until = now.Add(d)
+	}
+	if err := saveIgnored(ignoreKey(name), user, bot); err != nil {
+		return "", err
+	}
+	if length == 0 {
+		return translate(message, bot, "protection.ignoring", "Okay, I'm ignoring ${user} until you unignore them.", map[string]string{"user": args[0]}), nil
+	}
+	return translate(message, bot, "protection.ignoring_until", "Okay, I'm ignoring ${user} until ${until}.", map[string]string{
+		"user":  args[0],
+		"until": user.Until.Format("2006-01-02 15:04 MST"),
+	}), nil
+}
+
+// unignoreCommand stops ignoring the user named, or mentioned, by the first argument
+func unignoreCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	key := ignoreKey(userArg(args[0]))
+	if _, ok := findIgnored(key, time.Now(), bot); !ok {
+		// Users ignored automatically are kept by ID, look them up by name too
+		found := false
+		for k, user := range loadIgnored(time.Now(), bot) {
+			if strings.EqualFold(user.UserName, args[0]) {
+				key, found = k, true
+				break
+			}
+		}
+		if !found {
+			return translate(*message, bot, "protection.not_ignored", "I'm not ignoring ${user}.", map[string]string{"user": args[0]}), nil
+		}
+	}
+	if err := bot.Store.Delete(ignoredBucket, key); err != nil {
+		return "", err
+	}
+	return translate(*message, bot, "protection.unignored", "Okay, I'm listening to ${user} again.", map[string]string{"user": args[0]}), nil
+}
+
+// listIgnoredCommand lists the users the bot ignores, and why
+func listIgnoredCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	users := loadIgnored(time.Now(), bot)
+	lines := []string{}
+	for _, user := range bot.Protection.ShadowIgnore {
+		lines = append(lines, translate(*message, bot, "protection.item_config", " • ${user}, by shadow_ignore in bot.yml", map[string]string{"user": user}))
+	}
+	keys := make([]string, 0, len(users))
+	for key := range users {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		user := users[key]
+		until := translate(*message, bot, "protection.forever", "until unignored", nil)
+		if !user.Until.IsZero() {
+			until = user.Until.Format("2006-01-02 15:04 MST")
+		}
+		lines = append(lines, translate(*message, bot, "protection.item", " • ${user} (${reason}), ${until}", map[string]string{
+			"user":   user.UserName,
+			"reason": user.Reason,
+			"until":  until,
+		}))
+	}
+	if len(lines) == 0 {
+		return translate(*message, bot, "protection.none", "I'm not ignoring anyone.", nil), nil
+	}
+	return translate(*message, bot, "protection.list", "I'm ignoring these users:", nil) + "\n\n" + strings.Join(lines, "\n"), nil
+}
+
+// findIgnored looks up an ignored user in the storage backend
+func findIgnored(key string, now time.Time, bot *models.Bot) (ignoredUser, bool) {
+	if len(key) == 0 {
+		return ignoredUser{}, false
+	}
+	value, ok, err := bot.Store.Get(ignoredBucket, key)
+	if err != nil || !ok {
+		return ignoredUser{}, false
+	}
+	var user ignoredUser
+	if err := json.Unmarshal(value, &user); err != nil {
+		bot.Log.Warnf("Skipping an ignored user that can't be read: %s", err.Error())
+		return ignoredUser{}, false
+	}
+	if !user.Until.IsZero() && !user.Until.After(now) {
+		return ignoredUser{}, false
+	}
+	return user, true
+}
+
+// loadIgnored loads the users ignored in the storage backend, by key
+func loadIgnored(now time.Time, bot *models.Bot) map[string]ignoredUser {
+	users := make(map[string]ignoredUser)
+	values, err := bot.Store.List(ignoredBucket)
+	if err != nil {
+		bot.Log.Errorf("Could not look up the ignored users: %s", err.Error())
+		return users
+	}
+	for key, value := range values {
+		var user ignoredUser
+		if err := json.Unmarshal(value, &user); err != nil || (!user.Until.IsZero() && !user.Until.After(now)) {
+			continue
+		}
+		users[key] = user
+	}
+	return users
+}
+
+// saveIgnored keeps an ignored user in the storage backend, until they're no longer ignored
+func saveIgnored(key string, user ignoredUser, bot *models.Bot) error {
+	value, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	var ttl time.Duration
+	if !user.Until.IsZero() {
+		ttl = time.Until(user.Until)
+	}
+	return bot.Store.Set(ignoredBucket, key, value, ttl)
+}
+
+// userArg is the user ID of a mention, e.g. <@U123>, or else the user name or ID given
+func userArg(arg string) string {
+	if m := karmaMention.FindStringSubmatch(arg); m != nil {
+		return m[1]
+	}
+	return strings.TrimPrefix(arg, "@")
+}
+
+// ignoreKey is the key of an ignored user in the storage backend
+func ignoreKey(user string) string {
+	return strings.ToLower(strings.TrimSpace(user))
+}
+
+// protectionDuration parses a duration of 'protection', or returns the default if it's not set or invalid
+func protectionDuration(value string, def time.Duration) time.Duration {
+	if d, err := utils.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestProtect(t *testing.T) {
+	testBot := &models.Bot{
+		Store:           memory.New(),
+		ChatApplication: "discord",
+		Admins:          []string{"mod"},
+		Rooms:           map[string]string{"mods": "C9"},
+		Protection: models.Protection{
+			Remotes:          []string{"discord"},
+			FloodMessages:    3,
+			BlockInvites:     true,
+			BlockLinks:       true,
+			AllowedDomains:   []string{"github.com"},
+			ShadowIgnore:     []string{"troll"},
+			ModeratorChannel: "mods",
+		},
+	}
+	initLogger(testBot)
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+	told := func() []string {
+		outputs := []string{}
+		for {
+			select {
+			case m := <-outputMsgs:
+				<-hitRule
+				outputs = append(outputs, m.ChannelID+": "+m.Output)
+			default:
+				return outputs
+			}
+		}
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name  string
+		user  string
+		input string
+		at    time.Duration
+		want  bool
+	}{
+		{"Allowed link", "U1", "see https://github.com/target/flottbot", 0, true},
+		{"Allowed subdomain", "U1", "see https://gist.github.com/x", time.Second, true},
+		{"Shadow ignored user", "troll", "hello", 0, false},
+		{"Invite", "U2", "join discord.gg/free-nitro", 0, false},
+		{"Ignored after an invite", "U2", "hello", time.Second, false},
+		{"Link to another domain", "U3", "<https://evil.example/x>", 0, false},
+		{"Admin posting links", "mod", "https://evil.example/x", 0, true},
+		{"Third message in a minute", "U1", "hi", 2 * time.Second, true},
+		{"Fourth message in a minute", "U1", "hi", 3 * time.Second, false},
+		{"Ignored after flooding", "U1", "hi", 2 * time.Minute, false},
+		{"Flooding is over after ignore_for", "U1", "hi", 2 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.Service = models.MsgServiceChat
+			message.ChannelName = "general"
+			message.Vars["_user.id"] = tt.user
+			message.Vars["_user.name"] = tt.user
+			message.Input = tt.input
+			if got := protect(&message, now.Add(tt.at), outputMsgs, hitRule, testBot); got != tt.want {
+				t.Errorf("protect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	outputs := told()
+	if len(outputs) != 3 {
+		t.Fatalf("protect() told the moderators %v, want about the invite, the link, and the flood", outputs)
+	}
+	if want := "C9: I'm ignoring U2 until"; outputs[0][:len(want)] != want {
+		t.Errorf("protect() told the moderators %q, want it to start with %q", outputs[0], want)
+	}
+}
+
+func TestIgnoreCommands(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Protection: models.Protection{ShadowIgnore: []string{"troll"}}}
+	initLogger(testBot)
+	now := time.Now()
+	admin := models.NewMessage()
+	admin.Vars["_user.name"] = "mod"
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		ignored bool
+	}{
+		{"Mention for good", []string{"<@123>"}, "Okay, I'm ignoring <@123> until you unignore them.", true},
+		{"Name for a while", []string{"spammer", "1d"}, "Okay, I'm ignoring spammer until " + now.Add(24*time.Hour).Format("2006-01-02 15:04 MST") + ".", true},
+		{"Invalid duration", []string{"spammer2", "soon"}, "Tell me for how long, e.g. 'ignore spammer2 1d', or leave it out to ignore them until you unignore them.", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ignoreUserCommand(tt.args, admin, now, testBot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ignoreUserCommand() = %q, want %q", got, tt.want)
+			}
+			if _, ok := findIgnored(ignoreKey(userArg(tt.args[0])), now, testBot); ok != tt.ignored {
+				t.Errorf("ignoreUserCommand() ignored = %v, want %v", ok, tt.ignored)
+			}
+		})
+	}
+
+	output, err := listIgnoredCommand(nil, &admin, nil, nil, nil, testBot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "I'm ignoring these users:\n\n • troll, by shadow_ignore in bot.yml\n • <@123> (admin), until unignored\n • spammer (admin), " + now.Add(24*time.Hour).Format("2006-01-02 15:04 MST")
+	if output != want {
+		t.Errorf("listIgnoredCommand() = %q, want %q", output, want)
+	}
+
+	if output, _ := unignoreCommand([]string{"<@123>"}, &admin, nil, nil, nil, testBot); output != "Okay, I'm listening to <@123> again." {
+		t.Errorf("unignoreCommand() = %q", output)
+	}
+	if output, _ := unignoreCommand([]string{"nobody"}, &admin, nil, nil, nil, testBot); output != "I'm not ignoring nobody." {
+		t.Errorf("unignoreCommand() = %q", output)
+	}
+}
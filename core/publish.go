@@ -0,0 +1,20 @@
+package core
+
+import (
+	"github.com/target/flottbot/handlers"
+	"github.com/target/flottbot/models"
+)
+
+// handlePublish handles 'publish' actions. The ID the broker assigned to the message
+// (SQS only) is available as ${_publish_id}.
+func handlePublish(action models.Action, msg *models.Message, bot *models.Bot) error {
+	id, err := handlers.Publish(action, msg, bot)
+	if err != nil {
+		msg.Error = translate(*msg, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
+		return err
+	}
+	msg.Vars["_publish_id"] = id
+
+	bot.Log.Debugf("Successfully executed action '%s'", action.Name)
+	return nil
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/target/flottbot/models"
+)
+
+// defaultInputQueueSize is how many messages may wait to be processed, unless bot.yml sets 'input_queue_size'
+const defaultInputQueueSize = 100
+
+// What happens to a message read while the input queue is full
+const (
+	overflowBlock      = "block"       // the remote waits until there is room (default)
+	overflowDropOldest = "drop_oldest" // the message that waited longest is dropped to make room
+	overflowReject     = "reject"      // the message is dropped, and its sender told the bot is busy
+)
+
+var (
+	inputQueueDepth = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "flottbot_input_queue_depth",
+			Help: "No. of messages waiting to be processed",
+		},
+		func() float64 {
+			// Summed over all bots running in the process
+			depth := 0
+			for _, b := range runningBots() {
+				depth += len(b.inputMsgs)
+			}
+			return float64(depth)
+		},
+	)
+	inputQueueOverflows = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "flottbot_input_queue_overflows",
+			Help: "Total No. of messages dropped because too many were waiting to be processed",
+		},
+		[]string{"policy"},
+	)
+)
+
+// NewInputQueue creates the queue of messages waiting to be processed, as big as bot.yml says
+func NewInputQueue(bot *models.Bot) chan models.Message {
+	size := bot.InputQueueSize
+	if size <= 0 {
+		size = defaultInputQueueSize
+	}
+	return make(chan models.Message, size)
+}
+
+// configureInputQueue checks the input queue's overflow policy
+func configureInputQueue(bot *models.Bot) {
+	switch strings.ToLower(bot.InputQueueOverflow) {
+	case "":
+		bot.InputQueueOverflow = overflowBlock
+	case overflowBlock, overflowDropOldest, overflowReject:
+		bot.InputQueueOverflow = strings.ToLower(bot.InputQueueOverflow)
+	default:
+		bot.Log.Warnf("Unknown input_queue_overflow '%s', use '%s', '%s', or '%s'. Falling back to '%s'", bot.InputQueueOverflow, overflowBlock, overflowDropOldest, overflowReject, overflowBlock)
+		bot.InputQueueOverflow = overflowBlock
+	}
+}
+
+// Enqueue moves the messages read by the remotes into the input queue. When the queue is full, the
+// overflow policy in bot.yml decides whether to wait for room, drop the oldest waiting message, or
+// reject the new one, so remotes don't get stuck behind a busy bot.
+func Enqueue(intake <-chan models.Message, inputMsgs chan models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	for message := range intake {
+		message.Run = models.NewRunContext(pipelineOf(bot).runs)
+		// With a shared queue, the replicas take turns at the messages any of them read
+		if publishMessage(message, bot) {
+			continue
+		}
+		enqueue(message, inputMsgs, outputMsgs, hitRule, bot)
+	}
+}
+
+// enqueue adds a message to the input queue, applying the overflow policy when it's full
+func enqueue(message models.Message, inputMsgs chan models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	if bot.InputQueueOverflow == overflowBlock || len(bot.InputQueueOverflow) == 0 {
+		inputMsgs <- message
+		return
+	}
+	for {
+		select {
+		case inputMsgs <- message:
+			return
+		default:
+		}
+		// The queue is full
+		if bot.Metrics {
+			inputQueueOverflows.With(prometheus.Labels{"policy": bot.InputQueueOverflow}).Inc()
+		}
+		switch bot.InputQueueOverflow {
+		case overflowDropOldest:
+			select {
+			case dropped := <-inputMsgs:
+				bot.Log.Warnf("Input queue is full, dropped message %s", dropped.ID)
+			default:
+			}
+		case overflowReject:
+			bot.Log.Warnf("Input queue is full, rejected message %s", message.ID)
+			rejectMessage(message, outputMsgs, hitRule, bot)
+			return
+		}
+	}
+}
+
+// rejectMessage tells whoever sent a message that the bot is too busy to handle it.
+// Only people addressing the bot are told, so the bot doesn't talk over every message in a channel.
+func rejectMessage(message models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	if message.Service != models.MsgServiceChat && message.Service != models.MsgServiceCLI {
+		return
+	}
+	if message.Type != models.MsgTypeDirect && !message.BotMentioned {
+		return
+	}
+	message.Output = translate(message, bot, "errors.busy", "I'm a bit busy right now, please try again in a moment.", nil)
+	sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+}
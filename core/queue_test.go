@@ -0,0 +1,73 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestEnqueue(t *testing.T) {
+	message := func(id string, mentioned bool) models.Message {
+		m := models.NewMessage()
+		m.ID = id
+		m.Service = models.MsgServiceChat
+		m.Type = models.MsgTypeChannel
+		m.BotMentioned = mentioned
+		return m
+	}
+
+	tests := []struct {
+		name      string
+		overflow  string
+		mentioned bool
+		wantQueue []string
+		wantReply string
+	}{
+		{"Drop oldest", overflowDropOldest, true, []string{"2", "3"}, ""},
+		{"Reject", overflowReject, true, []string{"1", "2"}, "I'm a bit busy right now, please try again in a moment."},
+		{"Reject without reply", overflowReject, false, []string{"1", "2"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &models.Bot{InputQueueOverflow: tt.overflow}
+			inputMsgs := make(chan models.Message, 2)
+			outputMsgs := make(chan models.Message, 1)
+			hitRule := make(chan models.Rule, 1)
+
+			for _, id := range []string{"1", "2", "3"} {
+				enqueue(message(id, tt.mentioned), inputMsgs, outputMsgs, hitRule, bot)
+			}
+
+			close(inputMsgs)
+			got := []string{}
+			for m := range inputMsgs {
+				got = append(got, m.ID)
+			}
+			if len(got) != len(tt.wantQueue) || got[0] != tt.wantQueue[0] || got[1] != tt.wantQueue[1] {
+				t.Errorf("enqueue() left %v in the queue, want %v", got, tt.wantQueue)
+			}
+
+			reply := ""
+			if len(outputMsgs) > 0 {
+				m := <-outputMsgs
+				<-hitRule
+				if m.ID != "3" {
+					t.Errorf("enqueue() replied to message %s, want 3", m.ID)
+				}
+				reply = m.Output
+			}
+			if reply != tt.wantReply {
+				t.Errorf("enqueue() replied %q, want %q", reply, tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestNewInputQueue(t *testing.T) {
+	if got := cap(NewInputQueue(&models.Bot{})); got != defaultInputQueueSize {
+		t.Errorf("NewInputQueue() size = %d, want %d", got, defaultInputQueueSize)
+	}
+	if got := cap(NewInputQueue(&models.Bot{InputQueueSize: 5})); got != 5 {
+		t.Errorf("NewInputQueue() size = %d, want 5", got)
+	}
+}
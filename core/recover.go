@@ -0,0 +1,78 @@
+package core
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/target/flottbot/audit"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
+	"github.com/target/flottbot/utils"
+)
+
+var panicsCollector = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "flottbot_panics",
+		Help: "Total No. of panics recovered from while handling messages",
+	},
+	[]string{"rulename"},
+)
+
+// recoverPanic keeps a panic while handling a message, e.g. a nil dereference in an action, from
+// taking down the bot: deferred, it recovers and reports the panic, so only that message (or rule)
+// is affected. rule is the name of the rule being handled, empty while the rules are matched.
+func recoverPanic(rule string, message models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	if value := recover(); value != nil {
+		reportPanic(value, rule, message, outputMsgs, hitRule, bot)
+	}
+}
+
+// runActionSafely runs an action like runAction, but an action that panics fails the rule instead of the bot
+func runActionSafely(action models.Action, message *models.Message, outputMsgs chan<- models.Message, rule models.Rule, hitRule chan<- models.Rule, span *tracing.Span, bot *models.Bot) (result audit.ActionResult) {
+	defer func() {
+		if value := recover(); value != nil {
+			reportPanic(value, rule.Name, *message, outputMsgs, hitRule, bot)
+			result = audit.ActionResult{Name: action.Name, Type: action.Type, Error: fmt.Sprintf("Panicked: %v", value), Aborted: true}
+		}
+	}()
+	return runAction(action, message, outputMsgs, rule, hitRule, span, bot)
+}
+
+// reportPanic logs a recovered panic with its stack, counts it in the metrics, and tells the
+// 'error_channel' about it, if bot.yml has one
+func reportPanic(value interface{}, rule string, message models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	where := "while matching rules"
+	if len(rule) > 0 {
+		where = fmt.Sprintf("in rule '%s'", rule)
+	}
+	bot.Log.Errorf("Recovered from a panic %s, handling message %s from '%s' in '%s': %v\n%s", where, message.ID, message.Vars["_user.name"], message.ChannelName, value, debug.Stack())
+	panicsCollector.With(prometheus.Labels{"rulename": rule}).Inc()
+
+	if len(bot.ErrorChannel) == 0 || outputMsgs == nil {
+		return
+	}
+	report, ok := channelMessage(bot.ErrorChannel, fmt.Sprintf("Recovered from a panic %s, handling a message from %s in #%s: %v", where, message.Vars["_user.name"], message.ChannelName, value), bot)
+	if !ok {
+		bot.Log.Warnf("Could not report the panic to error_channel '%s', the channel was not found", bot.ErrorChannel)
+		return
+	}
+	sendOutput(outputMsgs, hitRule, report, models.Rule{}, bot)
+}
+
+// channelMessage creates a message the bot posts to one of its channels on its own, e.g. to report
+// a problem. It's false when the bot doesn't know the channel.
+func channelMessage(channel, output string, bot *models.Bot) (models.Message, bool) {
+	rooms := utils.GetRoomIDs([]string{channel}, bot)
+	if len(rooms) == 0 {
+		return models.Message{}, false
+	}
+	message := models.NewMessage()
+	message.Service = models.MsgServiceChat
+	message.Type = models.MsgTypeChannel
+	message.ChannelID = rooms[0]
+	message.OutputToRooms = rooms
+	message.Output = output
+	return message, true
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	bot := &models.Bot{ErrorChannel: "flottbot-errors", Rooms: map[string]string{"flottbot-errors": "C999"}}
+	initLogger(bot)
+
+	message := models.NewMessage()
+	message.ChannelName = "deploys"
+	message.Vars["_user.name"] = "gopher"
+	outputMsgs := make(chan models.Message, 1)
+	hitRule := make(chan models.Rule, 1)
+
+	func() {
+		defer recoverPanic("deploy", message, outputMsgs, hitRule, bot)
+		var rule *models.Rule
+		_ = rule.Name
+	}()
+
+	select {
+	case report := <-outputMsgs:
+		if len(report.OutputToRooms) != 1 || report.OutputToRooms[0] != "C999" {
+			t.Errorf("recoverPanic() reported to %q, want C999", report.OutputToRooms)
+		}
+		if want := "Recovered from a panic in rule 'deploy', handling a message from gopher in #deploys: runtime error"; !strings.HasPrefix(report.Output, want) {
+			t.Errorf("recoverPanic() reported %q, want it to start with %q", report.Output, want)
+		}
+	default:
+		t.Error("recoverPanic() did not report the panic to the error channel")
+	}
+
+	// Without an error channel the panic is only logged
+	bot.ErrorChannel = ""
+	func() {
+		defer recoverPanic("", message, outputMsgs, hitRule, bot)
+		panic("boom")
+	}()
+	if len(outputMsgs) > 0 {
+		t.Error("recoverPanic() reported to chat without an error channel")
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// redactingFormatter masks secrets in log entries after they have been formatted
+type redactingFormatter struct {
+	logrus.Formatter
+}
+
+// Format implementation to satisfy logrus formatter interface
+func (f redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	out, err := f.Formatter.Format(entry)
+	if err != nil {
+		return out, err
+	}
+	return []byte(utils.Redact(string(out))), nil
+}
+
+// configureRedaction keeps the bot's credentials, secrets resolved from a secrets manager,
+// and anything that looks like a token out of the logs and out of messages sent to chat.
+// Additional values to redact can be matched with 'redact_patterns' in bot.yml.
+func configureRedaction(bot *models.Bot) {
+	for _, secret := range []string{
+		bot.SlackToken,
+		bot.SlackVerificationToken,
+		bot.SlackWorkspaceToken,
+		bot.DiscordToken,
+		bot.AdminAPIToken,
+	} {
+		utils.AddSecret(secret)
+	}
+	for _, token := range bot.SlackWorkspaceTokens {
+		utils.AddSecret(token)
+	}
+	for _, value := range bot.TracingHeaders {
+		utils.AddSecret(value)
+	}
+	if u, err := url.Parse(bot.StorageURL); err == nil && u.User != nil {
+		password, _ := u.User.Password()
+		utils.AddSecret(password)
+	}
+
+	for _, pattern := range bot.RedactPatterns {
+		if err := utils.AddRedactPattern(pattern); err != nil {
+			bot.Log.Errorf("Invalid redact pattern '%s': %s", pattern, err.Error())
+		}
+	}
+
+	bot.Log.Formatter = redactingFormatter{bot.Log.Formatter}
+}
@@ -0,0 +1,27 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestConfigureRedaction(t *testing.T) {
+	testBot := new(models.Bot)
+	testBot.SlackToken = "my-slack-token-value"
+	initLogger(testBot)
+	configureRedaction(testBot)
+
+	buf := new(bytes.Buffer)
+	testBot.Log.Out = buf
+	testBot.Log.Errorf("Could not connect with token %s", testBot.SlackToken)
+
+	if strings.Contains(buf.String(), testBot.SlackToken) {
+		t.Errorf("log contains the Slack token: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "[REDACTED]") {
+		t.Errorf("log does not show where the token was redacted: %s", buf.String())
+	}
+}
@@ -0,0 +1,326 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/utils"
+)
+
+// Storage buckets of reminders: the reminders themselves, and which replica of the bot delivers them
+const (
+	reminderBucket   = "reminders"
+	deliveriesBucket = "reminder-deliveries"
+)
+
+// reminderInterval is how often due reminders are looked for
+const reminderInterval = 10 * time.Second
+
+// reminderPattern parses what follows 'remind': who to remind, when, and of what,
+// e.g. 'me in 2h to check the deploy' or '#ops at 2019-05-01 09:00 release day'
+var reminderPattern = regexp.MustCompile(`(?is)^(me|here|<#[^>]+>|#\S+)\s+(?:in\s+(\S+)|at\s+(\d{4}-\d{1,2}-\d{1,2}[ T]\d{1,2}:\d{2}|\d{1,2}:\d{2}))\s+(?:to\s+)?(.+)$`)
+
+// channelMention finds the ID in a chat mention of a channel, e.g. <#C123|general>
+var channelMention = regexp.MustCompile(`^<#(\w+)`)
+
+// reminder is something the bot was asked to remind someone (or a channel) of
+type reminder struct {
+	ID        string                `json:"id"`
+	Text      string                `json:"text"`
+	Due       time.Time             `json:"due"`
+	UserID    string                `json:"user_id"`
+	UserName  string                `json:"user_name"`
+	Service   models.MessageService `json:"service"`
+	Type      models.MessageType    `json:"type"`
+	ChannelID string                `json:"channel_id"`
+	Thread    string                `json:"thread,omitempty"`
+	Channel   string                `json:"channel,omitempty"` // the channel reminded, if it's not the user
+}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{
+			trigger:     "remind",
+			usage:       "remind <me|here|#channel> <in <duration>|at <time>> to <what>",
+			description: "Remind you or a channel of something later, e.g. 'remind me in 2h to check the deploy'",
+			args:        4,
+			module:      moduleReminders,
+			run:         remindCommand,
+		},
+		builtinCommand{trigger: "reminders cancel", usage: "reminders cancel <id>", description: "Cancel a reminder you set", args: 1, module: moduleReminders, run: cancelReminderCommand},
+		builtinCommand{trigger: "reminders", usage: "reminders", description: "List the reminders you set", module: moduleReminders, run: listRemindersCommand},
+	)
+}
+
+// remindCommand schedules a reminder for the sender of the message, or for a channel
+func remindCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	return scheduleReminder(strings.Join(args, " "), *message, bot, time.Now())
+}
+
+// scheduleReminder schedules the reminder described by what follows 'remind' in a message
+func scheduleReminder(input string, message models.Message, bot *models.Bot, now time.Time) (string, error) {
+	usage := translate(message, bot, "reminders.usage", "Tell me who, when, and what, e.g. 'remind me in 2h to check the deploy' or 'remind #ops at 9:00 to start the release'.", nil)
+	m := reminderPattern.FindStringSubmatch(input)
+	if m == nil {
+		return usage, nil
+	}
+
+	r := reminder{
+		Text:      m[4],
+		UserID:    message.Vars["_user.id"],
+		UserName:  message.Vars["_user.name"],
+		Service:   message.Service,
+		Type:      message.Type,
+		ChannelID: message.ChannelID,
+		Thread:    message.ThreadID,
+	}
+
+	switch {
+	case len(m[2]) > 0:
+		after, err := utils.ParseDuration(m[2])
+		if err != nil || after <= 0 {
+			return usage, nil
+		}
+		r.Due = now.Add(after)
+	default:
+		due, err := reminderTime(m[3], now)
+		if err != nil {
+			return usage, nil
+		}
+		if !due.After(now) {
+			return translate(message, bot, "reminders.past", "That time has already passed.", nil), nil
+		}
+		r.Due = due
+	}
+
+	switch target := strings.ToLower(m[1]); {
+	case target == "me", target == "here" && message.Type == models.MsgTypeDirect:
+	case target == "here":
+		r.Channel = reminderChannel(r)
+	default:
+		channelID := ""
+		if mention := channelMention.FindStringSubmatch(m[1]); mention != nil {
+			channelID = mention[1]
+		} else if ids := utils.GetRoomIDs([]string{strings.TrimPrefix(m[1], "#")}, bot); len(ids) > 0 {
+			channelID = ids[0]
+		}
+		if len(channelID) == 0 {
+			return translate(message, bot, "reminders.unknown_channel", "I don't know the channel ${channel}.", map[string]string{"channel": m[1]}), nil
+		}
+		r.Type = models.MsgTypeChannel
+		r.ChannelID = channelID
+		r.Thread = ""
+		r.Channel = reminderChannel(r)
+	}
+
+	if err := storeReminder(&r, bot); err != nil {
+		return "", err
+	}
+	vars := map[string]string{"due": r.Due.Format("2006-01-02 15:04 MST"), "id": r.ID}
+	if len(r.Channel) > 0 {
+		vars["channel"] = r.Channel
+		return translate(message, bot, "reminders.scheduled_channel", "Okay, I'll remind ${channel} at ${due} (ID `${id}`).", vars), nil
+	}
+	return translate(message, bot, "reminders.scheduled", "Okay, I'll remind you at ${due} (ID `${id}`).", vars), nil
+}
+
+// listRemindersCommand lists the reminders the sender of the message set, soonest first
+func listRemindersCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	reminders, err := userReminders(message.Vars["_user.id"], bot)
+	if err != nil {
+		return "", err
+	}
+	if len(reminders) == 0 {
+		return translate(*message, bot, "reminders.none", "You have no reminders.", nil), nil
+	}
+	output := translate(*message, bot, "reminders.list", "These are your reminders:", nil) + "\n"
+	for _, r := range reminders {
+		line := fmt.Sprintf("\n • `%s` %s - %s", r.ID, r.Due.In(time.Local).Format("2006-01-02 15:04 MST"), r.Text)
+		if len(r.Channel) > 0 {
+			line = line + fmt.Sprintf(" (%s)", r.Channel)
+		}
+		output = output + line
+	}
+	return output, nil
+}
+
+// cancelReminderCommand cancels the reminder with the ID given as first argument, if the sender of the message set it
+func cancelReminderCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	reminders, err := userReminders(message.Vars["_user.id"], bot)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range reminders {
+		if r.ID != args[0] {
+			continue
+		}
+		if err := bot.Store.Delete(reminderBucket, r.ID); err != nil {
+			return "", err
+		}
+		return translate(*message, bot, "reminders.cancelled", "Cancelled the reminder to ${text}.", map[string]string{"text": r.Text}), nil
+	}
+	// Other people's reminders look just like missing ones
+	return translate(*message, bot, "reminders.not_found", "You have no reminder with ID '${id}'.", map[string]string{"id": args[0]}), nil
+}
+
+// Reminders delivers reminders when they are due, back to the chat application they were set in.
+// Reminders are kept in the storage backend, so they survive restarts of the bot, and only
+// one replica of the bot delivers each of them.
+func Reminders(outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	if !moduleEnabled(moduleReminders, bot) {
+		return
+	}
+	ticker := time.NewTicker(reminderInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-remote.Stopping():
+			return
+		case <-ticker.C:
+			deliverReminders(time.Now(), outputMsgs, hitRule, bot)
+		}
+	}
+}
+
+// deliverReminders sends out the reminders that are due at the given time
+func deliverReminders(now time.Time, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	reminders, err := loadReminders(bot)
+	if err != nil {
+		bot.Log.Errorf("Could not look up reminders: %s", err.Error())
+		return
+	}
+	for _, r := range reminders {
+		if r.Due.After(now) {
+			continue
+		}
+		// Another replica of the bot may be delivering the reminder already
+		claimed, err := bot.Store.Claim(deliveriesBucket, r.ID, []byte(bot.InstanceID), time.Minute)
+		if err != nil || !claimed {
+			continue
+		}
+		if err := bot.Store.Delete(reminderBucket, r.ID); err != nil {
+			bot.Log.Errorf("Could not remove reminder '%s': %s", r.ID, err.Error())
+			continue
+		}
+
+		sendOutput(outputMsgs, hitRule, reminderMessage(r, bot), models.Rule{}, bot)
+	}
+}
+
+// reminderMessage builds the message delivering a reminder
+func reminderMessage(r reminder, bot *models.Bot) models.Message {
+	message := models.NewMessage()
+	message.Service = r.Service
+	message.Type = r.Type
+	message.ChannelID = r.ChannelID
+	message.ThreadID = r.Thread
+	message.Vars["_user.id"] = r.UserID
+	message.Vars["_user.name"] = r.UserName
+
+	// People are mentioned so they get notified, except on the CLI
+	who := r.UserName
+	if r.Service == models.MsgServiceChat && len(r.UserID) > 0 {
+		who = "<@" + r.UserID + ">"
+	}
+	vars := map[string]string{"user": who, "text": r.Text}
+	if len(r.Channel) > 0 {
+		message.Output = translate(message, bot, "reminders.channel_reminder", "Reminder from ${user}: ${text}", vars)
+	} else {
+		message.Output = translate(message, bot, "reminders.reminder", "${user}, you asked me to remind you to ${text}", vars)
+	}
+	return message
+}
+
+// reminderTime parses when a reminder is due: a date and time, or a time of day, which is
+// today if it's still to come and tomorrow otherwise. Times are in the bot's time zone.
+func reminderTime(at string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{"2006-1-2 15:04", "2006-1-2T15:04"} {
+		if t, err := time.ParseInLocation(layout, at, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	t, err := time.ParseInLocation("15:04", at, now.Location())
+	if err != nil {
+		return time.Time{}, err
+	}
+	due := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !due.After(now) {
+		due = due.AddDate(0, 0, 1)
+	}
+	return due, nil
+}
+
+// reminderChannel describes the channel a reminder is delivered to
+func reminderChannel(r reminder) string {
+	if r.Service == models.MsgServiceChat {
+		return "<#" + r.ChannelID + ">"
+	}
+	return "#" + r.ChannelID
+}
+
+// storeReminder stores a new reminder under a short ID people can type to cancel it
+func storeReminder(r *reminder, bot *models.Bot) error {
+	for attempt := 0; attempt < 5; attempt++ {
+		id := make([]byte, 3)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		r.ID = hex.EncodeToString(id)
+		value, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		// Claiming the ID makes sure no other reminder has it
+		claimed, err := bot.Store.Claim(reminderBucket, r.ID, value, 0)
+		if err != nil || claimed {
+			return err
+		}
+	}
+	return errors.New("Could not find a free ID for the reminder")
+}
+
+// loadReminders looks up all reminders
+func loadReminders(bot *models.Bot) ([]reminder, error) {
+	stored, err := bot.Store.List(reminderBucket)
+	if err != nil {
+		return nil, err
+	}
+	reminders := []reminder{}
+	for id, value := range stored {
+		var r reminder
+		if err := json.Unmarshal(value, &r); err != nil {
+			bot.Log.Errorf("Could not read reminder '%s': %s", id, err.Error())
+			continue
+		}
+		r.ID = id
+		reminders = append(reminders, r)
+	}
+	sort.Slice(reminders, func(i, j int) bool {
+		return reminders[i].Due.Before(reminders[j].Due)
+	})
+	return reminders, nil
+}
+
+// userReminders looks up the reminders a user set, soonest first
+func userReminders(userID string, bot *models.Bot) ([]reminder, error) {
+	reminders, err := loadReminders(bot)
+	if err != nil {
+		return nil, err
+	}
+	mine := []reminder{}
+	for _, r := range reminders {
+		if r.UserID == userID {
+			mine = append(mine, r)
+		}
+	}
+	return mine, nil
+}
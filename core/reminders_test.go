@@ -0,0 +1,155 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestScheduleReminder(t *testing.T) {
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	testBot := &models.Bot{Store: memory.New(), Modules: []string{moduleReminders}, Rooms: map[string]string{"ops": "C999"}}
+
+	message := models.NewMessage()
+	message.Service = models.MsgServiceChat
+	message.Type = models.MsgTypeChannel
+	message.ChannelID = "C1"
+	message.ThreadID = "1556668800.000100"
+	message.Vars["_user.id"] = "U111"
+	message.Vars["_user.name"] = "jane"
+
+	tests := []struct {
+		name        string
+		input       string
+		want        string
+		wantDue     time.Time
+		wantChannel string
+	}{
+		{"In minutes", "me in 30m to check the deploy", "Okay, I'll remind you at 2019-05-01 12:30 UTC", now.Add(30 * time.Minute), "C1"},
+		{"In days", "me in 1d stretch", "Okay, I'll remind you at 2019-05-02 12:00 UTC", now.Add(24 * time.Hour), "C1"},
+		{"At a time today", "me at 14:30 to leave", "Okay, I'll remind you at 2019-05-01 14:30 UTC", now.Add(150 * time.Minute), "C1"},
+		{"At a time tomorrow", "me at 9:00 to start", "Okay, I'll remind you at 2019-05-02 09:00 UTC", now.Add(21 * time.Hour), "C1"},
+		{"At a date", "here at 2019-05-03 10:00 to release", "Okay, I'll remind <#C1> at 2019-05-03 10:00 UTC", now.Add(46 * time.Hour), "C1"},
+		{"Channel by name", "#ops in 1h to rotate the keys", "Okay, I'll remind <#C999> at 2019-05-01 13:00 UTC", now.Add(time.Hour), "C999"},
+		{"Channel by mention", "<#C888|dev> in 1h to rotate the keys", "Okay, I'll remind <#C888> at 2019-05-01 13:00 UTC", now.Add(time.Hour), "C888"},
+		{"Unknown channel", "#nope in 1h to rotate the keys", "I don't know the channel #nope.", time.Time{}, ""},
+		{"Past date", "me at 2019-04-30 10:00 to release", "That time has already passed.", time.Time{}, ""},
+		{"No time", "me to check the deploy", "Tell me who, when, and what", time.Time{}, ""},
+		{"Invalid duration", "me in soon to check the deploy", "Tell me who, when, and what", time.Time{}, ""},
+		{"Negative duration", "me in -1h to check the deploy", "Tell me who, when, and what", time.Time{}, ""},
+		{"No one", "them in 1h to check the deploy", "Tell me who, when, and what", time.Time{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := testBot.Store.List(reminderBucket)
+			got, err := scheduleReminder(tt.input, message, testBot, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("scheduleReminder() = %q, want it to start with %q", got, tt.want)
+			}
+			after, _ := testBot.Store.List(reminderBucket)
+			if tt.wantDue.IsZero() {
+				if len(after) != len(before) {
+					t.Error("scheduleReminder() should not store a reminder")
+				}
+				return
+			}
+			reminders, _ := loadReminders(testBot)
+			var r reminder
+			for _, r = range reminders {
+				if strings.Contains(got, r.ID) {
+					break
+				}
+			}
+			if !r.Due.Equal(tt.wantDue) || r.ChannelID != tt.wantChannel {
+				t.Errorf("scheduleReminder() stored %+v", r)
+			}
+		})
+	}
+}
+
+func TestListAndCancelReminders(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Modules: []string{moduleReminders}}
+	now := time.Now()
+
+	jane := models.NewMessage()
+	jane.Service = models.MsgServiceChat
+	jane.ChannelID = "C1"
+	jane.Vars["_user.id"] = "U111"
+	john := jane
+	john.Vars = map[string]string{"_user.id": "U222"}
+
+	scheduleReminder("me in 2h to stretch", jane, testBot, now)
+	scheduleReminder("here in 1h to check the deploy", jane, testBot, now)
+	scheduleReminder("me in 1h to go home", john, testBot, now)
+
+	got, err := listRemindersCommand(nil, &jane, nil, nil, nil, testBot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "check the deploy (<#C1>)") || strings.Index(got, "deploy") > strings.Index(got, "stretch") || strings.Contains(got, "go home") {
+		t.Errorf("listRemindersCommand() = %q", got)
+	}
+
+	reminders, _ := userReminders("U222", testBot)
+	if got, _ := cancelReminderCommand([]string{reminders[0].ID}, &jane, nil, nil, nil, testBot); !strings.HasPrefix(got, "You have no reminder with ID") {
+		t.Errorf("cancelReminderCommand() of someone else's reminder = %q", got)
+	}
+	if got, _ := cancelReminderCommand([]string{reminders[0].ID}, &john, nil, nil, nil, testBot); got != "Cancelled the reminder to go home." {
+		t.Errorf("cancelReminderCommand() = %q", got)
+	}
+	if got, _ := listRemindersCommand(nil, &john, nil, nil, nil, testBot); got != "You have no reminders." {
+		t.Errorf("listRemindersCommand() = %q", got)
+	}
+}
+
+func TestDeliverReminders(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Modules: []string{moduleReminders}, InstanceID: "replica-1"}
+	now := time.Now()
+
+	message := models.NewMessage()
+	message.Service = models.MsgServiceChat
+	message.Type = models.MsgTypeChannel
+	message.ChannelID = "C1"
+	message.ThreadID = "1556668800.000100"
+	message.Vars["_user.id"] = "U111"
+	message.Vars["_user.name"] = "jane"
+	scheduleReminder("me in 30m to check the deploy", message, testBot, now)
+	scheduleReminder("<#C2> in 2h to go home", message, testBot, now)
+
+	outputMsgs := make(chan models.Message, 2)
+	hitRule := make(chan models.Rule, 2)
+	deliverReminders(now, outputMsgs, hitRule, testBot)
+	if len(outputMsgs) != 0 {
+		t.Fatalf("deliverReminders() sent %d reminders before they were due", len(outputMsgs))
+	}
+
+	deliverReminders(now.Add(time.Hour), outputMsgs, hitRule, testBot)
+	if len(outputMsgs) != 1 {
+		t.Fatalf("deliverReminders() sent %d reminders, want 1", len(outputMsgs))
+	}
+	got := <-outputMsgs
+	if got.Output != "<@U111>, you asked me to remind you to check the deploy" {
+		t.Errorf("deliverReminders() output = %q", got.Output)
+	}
+	if got.ChannelID != "C1" || got.ThreadID != message.ThreadID || got.Service != models.MsgServiceChat {
+		t.Errorf("deliverReminders() sent the reminder to %+v", got)
+	}
+
+	// Delivered reminders are gone
+	deliverReminders(now.Add(time.Hour), outputMsgs, hitRule, testBot)
+	if len(outputMsgs) != 0 {
+		t.Errorf("deliverReminders() sent a reminder twice")
+	}
+
+	deliverReminders(now.Add(3*time.Hour), outputMsgs, hitRule, testBot)
+	got = <-outputMsgs
+	if got.Output != "Reminder from <@U111>: go home" || got.ChannelID != "C2" || len(got.ThreadID) > 0 {
+		t.Errorf("deliverReminders() sent %q to %s", got.Output, got.ChannelID)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/target/flottbot/models"
 	"github.com/target/flottbot/remote/cli"
 	"github.com/target/flottbot/remote/discord"
+	"github.com/target/flottbot/remote/mock"
 	"github.com/target/flottbot/remote/scheduler"
 	"github.com/target/flottbot/remote/slack"
 )
@@ -50,6 +51,14 @@ func Remotes(inputMsgs chan<- models.Message, rules map[string]models.Rule, bot
 			// Read messages from Slack
 			go remoteSlack.Read(inputMsgs, rules, bot)
 			go remoteSlack.InteractiveComponents(inputMsgs, nil, rules[""], bot)
+		// Setup remote to read the messages of tests, see the 'mock' package
+		case "mock":
+			remoteMock, ok := mock.ForBot(bot)
+			if !ok {
+				bot.Log.Errorf("No mock chat application was created for %s", bot.Name)
+				break
+			}
+			go remoteMock.Read(inputMsgs, rules, bot)
 		default:
 			bot.Log.Errorf("Chat application '%s' is not supported", chatApp)
 		}
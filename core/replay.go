@@ -0,0 +1,66 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/remote/discord"
+	"github.com/target/flottbot/remote/slack"
+)
+
+// Replayed is what the bot did with a recorded payload when it was replayed
+type Replayed struct {
+	Recording remote.Recording
+	Input     *models.Message  // the message read from the payload; nil if it had none for the bot
+	Sent      []models.Message // the messages the bot would send
+	Err       error
+}
+
+// Replay feeds payloads recorded with 'record_traffic' back through the remotes that received them
+// and the bot's rules, one after the other, e.g. to reproduce why the bot didn't respond to an event.
+// Like Simulate, the bot sends nothing, and actions with a fixture use it instead of running.
+func Replay(recordings []remote.Recording, list []models.Fixture, timeout time.Duration, bot *models.Bot) ([]Replayed, error) {
+	// Like 'flottbot validate', look for the rules in the working directory
+	rules, err := readRulesDir(path.Join(configDir(bot), "rules"), bot)
+	if err != nil {
+		return nil, err
+	}
+	setCallableRules(bot, rules)
+
+	defer useFixtures(list)()
+
+	replayers := map[string]remote.Replayer{
+		"slack":   &slack.Client{Token: bot.SlackToken},
+		"discord": &discord.Client{Token: bot.DiscordToken},
+	}
+
+	results := make([]Replayed, 0, len(recordings))
+	for _, recording := range recordings {
+		result := Replayed{Recording: recording}
+		replayer, ok := replayers[strings.ToLower(recording.Remote)]
+		if !ok {
+			result.Err = fmt.Errorf("Payloads of remote '%s' can't be replayed", recording.Remote)
+			results = append(results, result)
+			continue
+		}
+
+		// Mentions of the bot are recognized by the ID it had when the payload was recorded
+		if len(recording.BotID) > 0 {
+			bot.ID = recording.BotID
+		}
+		message, ok, err := replayer.Replay(recording, bot)
+		if err != nil || !ok {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+		result.Input = &message
+		result.Sent, result.Err = simulateMessage(message, rules, timeout, bot)
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -1,11 +1,13 @@
 package core
 
 import (
+	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
 	"github.com/target/flottbot/models"
@@ -17,35 +19,101 @@ import (
 // and then finally populates a rules map with said Rule objects.
 // The rules map is used to dictate the bots behavior and response patterns.
 func Rules(rules *map[string]models.Rule, bot *models.Bot) {
+	loaded, err := readRules(bot)
+	if err != nil {
+		bot.Log.Fatalf("Could not parse rules: %v", err)
+	}
+	if err := loadTemplates(bot); err != nil {
+		bot.Log.Fatalf("%v", err)
+	}
+
+	pipelineOf(bot).rulesMu.Lock()
+	for ruleFile, rule := range loaded {
+		(*rules)[ruleFile] = rule
+	}
+	pipelineOf(bot).rulesMu.Unlock()
+	atomic.StoreInt32(&rulesLoaded, 1)
+
+	bot.Log.Infof("Configured '%s' rules!", bot.Name)
+}
+
+// ReloadRules re-reads the rules and templates directories and replaces the contents of the rules map.
+// The rules are read from the directory of the active rule set (see SwitchRuleSet).
+// The rules map is left untouched if any rule fails to parse.
+// Note: schedules are set up when the bot starts and are not affected by a reload.
+func ReloadRules(rules map[string]models.Rule, bot *models.Bot) (int, error) {
+	loaded, err := readRules(bot)
+	if err != nil {
+		return 0, err
+	}
+	if err := loadTemplates(bot); err != nil {
+		return 0, err
+	}
+
+	p := pipelineOf(bot)
+	p.rulesMu.Lock()
+	defer p.rulesMu.Unlock()
+	for ruleFile := range rules {
+		delete(rules, ruleFile)
+	}
+	for ruleFile, rule := range loaded {
+		rules[ruleFile] = rule
+	}
+
+	bot.Log.Infof("Reloaded %d rules", len(loaded))
+	return len(loaded), nil
+}
+
+// SetRuleActive enables or disables the rule with the given name. Rules disabled this way stay
+// disabled when the rules are reloaded, the rule set is switched, or the bot restarts, until they're
+// enabled again.
+func SetRuleActive(name string, active bool, rules map[string]models.Rule, bot *models.Bot) (models.Rule, error) {
+	return setRuleActive(name, active, disabledRule{By: "admin API"}, rules, bot)
+}
+
+// readRules parses every rule file in the rules directory, keyed by file path
+func readRules(bot *models.Bot) (map[string]models.Rule, error) {
 	// Check if the rules directory even exists
 	bot.Log.Debug("Looking for rules directory...")
-	searchDir, err := utils.PathExists(path.Join("config", "rules"))
+	searchDir, err := utils.PathExists(path.Join(configDir(bot), activeRulesDir(bot)))
 	if err != nil {
-		bot.Log.Fatalf("Could not parse rules: %v", err)
+		return nil, err
+	}
+	rules, err := readRulesDir(searchDir, bot)
+	if err != nil {
+		return nil, err
 	}
+	applyDisabledRules(rules, bot)
+	return rules, nil
+}
+
+// readRulesDir parses every rule file in a directory, keyed by file path
+func readRulesDir(searchDir string, bot *models.Bot) (map[string]models.Rule, error) {
+	rules := make(map[string]models.Rule)
 
 	// Loop through the rules directory and create a list of rules
 	bot.Log.Debug("Fetching all rule files...")
 	fileList := []string{}
-	err = filepath.Walk(searchDir, func(path string, f os.FileInfo, err error) error {
+	err := filepath.Walk(searchDir, func(path string, f os.FileInfo, err error) error {
 		if !f.IsDir() {
 			fileList = append(fileList, path)
 		}
 		return nil
 	})
 	if err != nil {
-		bot.Log.Fatalf("Could not parse rules: %v", err)
+		return nil, err
 	}
 
 	// If the rules directory is empty, log a warning and exit the function
 	if len(fileList) == 0 {
 		bot.Log.Warn("Looks like there aren't any rules")
-		return
+		return rules, nil
 	}
 
 	// Loop through the list of rules, creating a Rule object
 	// for each rule, then populate the map of Rule objects
 	bot.Log.Debug("Reading and parsing rule files...")
+	outdated := 0
 	for _, ruleFile := range fileList {
 		ruleConf := viper.New()
 		ruleConf.SetConfigFile(ruleFile)
@@ -54,13 +122,42 @@ func Rules(rules *map[string]models.Rule, bot *models.Bot) {
 			bot.Log.Errorf("Error while reading rule file '%s': %s \n", ruleFile, err)
 		}
 
-		rule := models.Rule{}
-		err = ruleConf.Unmarshal(&rule)
+		// Rule files written for older schema versions are upgraded as they're read; settings the
+		// bot doesn't know are only ignored in those
+		settings := ruleConf.AllSettings()
+		version, notes, err := upgradeRule(settings)
 		if err != nil {
-			log.Fatalf(err.Error())
+			return nil, fmt.Errorf("Error while parsing rule file '%s': %s", ruleFile, err)
 		}
-		(*rules)[ruleFile] = rule
+		if version < RuleSchemaVersion {
+			outdated++
+			bot.Log.Debugf("Rule file '%s' is written for rule schema version %d", ruleFile, version)
+			for _, note := range notes {
+				bot.Log.Debugf("Rule file '%s': %s", ruleFile, note)
+			}
+		}
+		rule := models.Rule{}
+		if problems := decodeSettings(settings, &rule, version == RuleSchemaVersion); len(problems) > 0 {
+			return nil, fmt.Errorf("Error while parsing rule file '%s': %s", ruleFile, strings.Join(problems, "; "))
+		}
+		if err := utils.ExpandEnv(&rule, false); err != nil {
+			return nil, fmt.Errorf("Error while parsing rule file '%s': %s", ruleFile, err)
+		}
+		if rule.ParallelActions {
+			if err := validateActionGraph(rule.Actions); err != nil {
+				bot.Log.Errorf("Disabling rule '%s': %s", rule.Name, err.Error())
+				rule.Active = false
+			}
+		}
+		if err := validateFormat(rule); err != nil {
+			bot.Log.Errorf("Disabling rule '%s': %s", rule.Name, err.Error())
+			rule.Active = false
+		}
+		rules[ruleFile] = rule
+	}
+	if outdated > 0 {
+		bot.Log.Warnf("%d rule files are written for older rule schema versions; run 'flottbot migrate-rules' to upgrade them to version %d", outdated, RuleSchemaVersion)
 	}
 
-	bot.Log.Infof("Configured '%s' rules!", bot.Name)
+	return rules, nil
 }
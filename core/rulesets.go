@@ -0,0 +1,188 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// The two rule sets of a bot: one is active, the other one can be loaded, e.g. with a large
+// refactoring of the rules, and switched to, or back to
+const (
+	ruleSetBlue  = "blue"
+	ruleSetGreen = "green"
+)
+
+// ruleSet is a snapshot of rules read from a directory
+type ruleSet struct {
+	dir      string
+	rules    map[string]models.Rule
+	loadedAt time.Time
+}
+
+// ruleSetInfo is the admin API representation of a rule set
+type ruleSetInfo struct {
+	Name     string    `json:"name"`
+	Dir      string    `json:"dir,omitempty"`
+	Rules    int       `json:"rules"`
+	LoadedAt time.Time `json:"loaded_at,omitempty"`
+	Active   bool      `json:"active"`
+}
+
+// ruleSets are the rule sets of a bot, and which one is active
+type ruleSets struct {
+	active string
+	sets   map[string]*ruleSet
+}
+
+// botRuleSets are the rule sets of the bots, created when the admin API first uses them. The rules
+// the bot started with are the blue set.
+var (
+	ruleSetsMu  sync.Mutex
+	botRuleSets = make(map[*models.Bot]*ruleSets)
+)
+
+// ruleSetsOf returns the rule sets of a bot; ruleSetsMu must be held
+func ruleSetsOf(rules map[string]models.Rule, bot *models.Bot) *ruleSets {
+	if sets, ok := botRuleSets[bot]; ok {
+		return sets
+	}
+	pipelineOf(bot).rulesMu.RLock()
+	started := copyRules(rules)
+	pipelineOf(bot).rulesMu.RUnlock()
+	sets := &ruleSets{
+		active: ruleSetBlue,
+		sets:   map[string]*ruleSet{ruleSetBlue: {dir: "rules", rules: started, loadedAt: time.Now()}},
+	}
+	botRuleSets[bot] = sets
+	return sets
+}
+
+// ruleSetInfos describes the rule sets of a bot, blue first
+func ruleSetInfos(rules map[string]models.Rule, bot *models.Bot) []ruleSetInfo {
+	ruleSetsMu.Lock()
+	defer ruleSetsMu.Unlock()
+	sets := ruleSetsOf(rules, bot)
+	infos := []ruleSetInfo{}
+	for _, name := range []string{ruleSetBlue, ruleSetGreen} {
+		info := ruleSetInfo{Name: name, Active: name == sets.active}
+		if set, ok := sets.sets[name]; ok {
+			info.Dir, info.Rules, info.LoadedAt = set.dir, len(set.rules), set.loadedAt
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// LoadRuleSet reads the rules in a directory of the config directory, e.g. 'rules-v2', into the
+// rule set that isn't active, without running them, and returns the problems validating them
+// finds. The rule set is only switched to with SwitchRuleSet.
+func LoadRuleSet(name, dir string, rules map[string]models.Rule, bot *models.Bot) ([]Problem, error) {
+	name = strings.ToLower(name)
+	if name != ruleSetBlue && name != ruleSetGreen {
+		return nil, fmt.Errorf("Unknown rule set '%s', use '%s' or '%s'", name, ruleSetBlue, ruleSetGreen)
+	}
+	searchDir, err := ruleSetDir(dir, bot)
+	if err != nil {
+		return nil, err
+	}
+	ruleSetsMu.Lock()
+	if ruleSetsOf(rules, bot).active == name {
+		ruleSetsMu.Unlock()
+		return nil, fmt.Errorf("Rule set '%s' is active, load the other one", name)
+	}
+	ruleSetsMu.Unlock()
+
+	loaded, err := readRulesDir(searchDir, bot)
+	if err != nil {
+		return nil, err
+	}
+	problems := validateRuleSet(loaded, bot)
+	applyDisabledRules(loaded, bot)
+
+	ruleSetsMu.Lock()
+	defer ruleSetsMu.Unlock()
+	ruleSetsOf(rules, bot).sets[name] = &ruleSet{dir: dir, rules: loaded, loadedAt: time.Now()}
+	bot.Log.Infof("Loaded %d rules from '%s' into rule set '%s'", len(loaded), dir, name)
+	return problems, nil
+}
+
+// SwitchRuleSet makes a loaded rule set the one the bot runs, at once, and returns how many rules
+// it has. The rules that were running are kept as they are, e.g. with rules disabled through the
+// admin API, to switch back to.
+// Note: like reloading, switching doesn't affect the schedules set up when the bot started.
+func SwitchRuleSet(name string, rules map[string]models.Rule, bot *models.Bot) (int, error) {
+	name = strings.ToLower(name)
+	ruleSetsMu.Lock()
+	defer ruleSetsMu.Unlock()
+	sets := ruleSetsOf(rules, bot)
+	target, ok := sets.sets[name]
+	if !ok {
+		return 0, fmt.Errorf("Rule set '%s' isn't loaded", name)
+	}
+	if sets.active == name {
+		return len(target.rules), nil
+	}
+
+	pipelineOf(bot).rulesMu.Lock()
+	sets.sets[sets.active].rules = copyRules(rules)
+	for ruleFile := range rules {
+		delete(rules, ruleFile)
+	}
+	for ruleFile, rule := range target.rules {
+		rules[ruleFile] = rule
+	}
+	// Rules may have been disabled or enabled since the set was loaded
+	applyDisabledRules(rules, bot)
+	pipelineOf(bot).rulesMu.Unlock()
+
+	bot.Log.Infof("Switched from rule set '%s' to '%s', with %d rules", sets.active, name, len(target.rules))
+	sets.active = name
+	return len(target.rules), nil
+}
+
+// RollBackRuleSet switches back to the rule set that isn't active
+func RollBackRuleSet(rules map[string]models.Rule, bot *models.Bot) (string, int, error) {
+	ruleSetsMu.Lock()
+	other := ruleSetGreen
+	if ruleSetsOf(rules, bot).active == ruleSetGreen {
+		other = ruleSetBlue
+	}
+	ruleSetsMu.Unlock()
+	count, err := SwitchRuleSet(other, rules, bot)
+	return other, count, err
+}
+
+// activeRulesDir is the directory of the active rule set, which reloading the rules reads
+func activeRulesDir(bot *models.Bot) string {
+	ruleSetsMu.Lock()
+	defer ruleSetsMu.Unlock()
+	if sets, ok := botRuleSets[bot]; ok {
+		return sets.sets[sets.active].dir
+	}
+	return "rules"
+}
+
+// ruleSetDir finds a rule set's directory, which must be in the config directory
+func ruleSetDir(dir string, bot *models.Bot) (string, error) {
+	clean := path.Clean("/" + filepath.ToSlash(dir))
+	if len(dir) == 0 || clean == "/" || clean != "/"+filepath.ToSlash(dir) {
+		return "", fmt.Errorf("Invalid rule set directory '%s', name a directory in the config directory, like 'rules-v2'", dir)
+	}
+	return utils.PathExists(path.Join(configDir(bot), dir))
+}
+
+// copyRules copies a rules map
+func copyRules(rules map[string]models.Rule) map[string]models.Rule {
+	copied := make(map[string]models.Rule, len(rules))
+	for ruleFile, rule := range rules {
+		copied[ruleFile] = rule
+	}
+	return copied
+}
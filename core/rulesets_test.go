@@ -0,0 +1,89 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestRuleSets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flottbot-rulesets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for file, content := range map[string]string{
+		"rules/hello.yml":    "schema_version: 2\nname: hello\nrespond: hello\nactive: true\n",
+		"rules-v2/hello.yml": "schema_version: 2\nname: hello\nrespond: hi\nactive: true\n",
+		"rules-v2/bye.yml":   "schema_version: 2\nname: bye\nrespond: bye\nactive: true\n",
+	} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(file)), 0755)
+		ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644)
+	}
+
+	testBot := &models.Bot{ConfigDir: dir, AdminAPIToken: "secret"}
+	initLogger(testBot)
+	rules, err := readRules(testBot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := adminRouter(make(chan models.Message), make(chan models.Message), rules, testBot)
+	respond := func(rule models.Rule) string { return rule.Name + ": " + rule.Respond }
+	running := func() []string {
+		got := []string{}
+		for _, rule := range sortRules(rules) {
+			got = append(got, respond(rule))
+		}
+		return got
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		want       []string // the rules running afterwards
+	}{
+		{"Switch to a rule set that isn't loaded", "/admin/rulesets/green/activate", http.StatusConflict, []string{"hello: hello"}},
+		{"Load the active rule set", "/admin/rulesets/blue/load?dir=rules-v2", http.StatusBadRequest, []string{"hello: hello"}},
+		{"Load from outside the config directory", "/admin/rulesets/green/load?dir=../rules", http.StatusBadRequest, []string{"hello: hello"}},
+		{"Load", "/admin/rulesets/green/load?dir=rules-v2", http.StatusOK, []string{"hello: hello"}},
+		{"Switch", "/admin/rulesets/green/activate", http.StatusOK, []string{"bye: bye", "hello: hi"}},
+		{"Roll back", "/admin/rulesets/rollback", http.StatusOK, []string{"hello: hello"}},
+		{"Switch again", "/admin/rulesets/Green/activate", http.StatusOK, []string{"bye: bye", "hello: hi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("POST %s = %d, want %d: %s", tt.path, rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			assertOutputs(t, "rules", running(), tt.want)
+		})
+	}
+
+	// Reloading reads the active rule set's directory
+	if count, err := ReloadRules(rules, testBot); err != nil || count != 2 {
+		t.Errorf("ReloadRules() = %d, %v, want 2 rules of rules-v2", count, err)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/rulesets", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var infos []ruleSetInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Active || infos[0].Rules != 1 || !infos[1].Active || infos[1].Dir != "rules-v2" {
+		t.Errorf("GET /admin/rulesets = %+v", infos)
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote/scheduler"
+)
+
+// Schedules returns all active schedule-type rules, sorted by name
+func Schedules(rules map[string]models.Rule) []models.Rule {
+	schedules := []models.Rule{}
+	for _, rule := range rules {
+		if rule.Active && len(rule.Schedule) > 0 {
+			schedules = append(schedules, rule)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+	return schedules
+}
+
+// PauseSchedule stops the named schedule from firing until it is resumed.
+// The paused state is persisted, so it survives restarts.
+func PauseSchedule(name string, rules map[string]models.Rule, bot *models.Bot) error {
+	rule, err := findSchedule(name, rules)
+	if err != nil {
+		return err
+	}
+	bot.Log.Infof("Pausing schedule '%s'", rule.Name)
+	return scheduler.Pause(rule.Name, bot)
+}
+
+// ResumeSchedule lets a paused schedule fire again
+func ResumeSchedule(name string, rules map[string]models.Rule, bot *models.Bot) error {
+	rule, err := findSchedule(name, rules)
+	if err != nil {
+		return err
+	}
+	bot.Log.Infof("Resuming schedule '%s'", rule.Name)
+	return scheduler.Resume(rule.Name, bot)
+}
+
+// TriggerSchedule runs the named schedule immediately, regardless of whether it is paused
+func TriggerSchedule(name string, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) error {
+	rule, err := findSchedule(name, rules)
+	if err != nil {
+		return err
+	}
+	bot.Log.Infof("Triggering schedule '%s'", rule.Name)
+	handleSchedulerServiceRule(outputMsgs, scheduler.NewMessage(rule, bot), hitRule, rule, bot)
+	return nil
+}
+
+// findSchedule looks up an active schedule-type rule by its name
+func findSchedule(name string, rules map[string]models.Rule) (models.Rule, error) {
+	for _, rule := range Schedules(rules) {
+		if rule.Name == name {
+			return rule, nil
+		}
+	}
+	return models.Rule{}, fmt.Errorf("Could not find an active schedule named '%s'", name)
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/target/flottbot/models"
+)
+
+// RuleSchemaVersion is the version of the rule file format this flottbot reads, set with 'schema_version'
+// in rule files. Rule files without it are version 1, from before the format was versioned.
+const RuleSchemaVersion = 2
+
+// ruleMigration upgrades a rule file from one schema version to the next
+type ruleMigration struct {
+	// settings upgrades the settings read from a rule file, and tells what it changed
+	settings func(settings map[string]interface{}) []string
+	// yaml upgrades the lines of a YAML rule file in the same way, keeping its comments and layout
+	yaml func(lines []string) []string
+}
+
+// ruleMigrations upgrade rule files to the current schema version: the first one from version 1
+// to version 2, and so on
+var ruleMigrations = []ruleMigration{
+	// Version 2: rule files state their 'schema_version', and settings the bot doesn't know are
+	// errors instead of being ignored. The rule's 'debug' setting, which had no effect, is gone.
+	{
+		settings: func(settings map[string]interface{}) []string {
+			if _, ok := settings["debug"]; !ok {
+				return nil
+			}
+			delete(settings, "debug")
+			return []string{"Removed 'debug', which had no effect"}
+		},
+		yaml: func(lines []string) []string {
+			return removeYAMLKey(lines, "debug")
+		},
+	},
+}
+
+// RuleMigration is what 'flottbot migrate-rules' did, or would do, to a rule file
+type RuleMigration struct {
+	File  string
+	From  int      // the schema version the file was written for
+	Notes []string // what was changed besides the version
+	Err   error    // why the file can't be upgraded
+}
+
+// ruleSchemaVersion is the schema version a rule file was written for
+func ruleSchemaVersion(settings map[string]interface{}) (int, error) {
+	value, ok := settings["schema_version"]
+	if !ok {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(fmt.Sprint(value))
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("Invalid schema_version '%v'", value)
+	}
+	if version > RuleSchemaVersion {
+		return version, fmt.Errorf("Rule schema version %d is newer than version %d, which this flottbot reads; upgrade flottbot", version, RuleSchemaVersion)
+	}
+	return version, nil
+}
+
+// upgradeRule brings the settings of a rule file up to the current schema version. It returns
+// the version the file was written for, and what was changed besides the version.
+func upgradeRule(settings map[string]interface{}) (int, []string, error) {
+	version, err := ruleSchemaVersion(settings)
+	if err != nil {
+		return version, nil, err
+	}
+	notes := []string{}
+	for v := version; v < RuleSchemaVersion; v++ {
+		notes = append(notes, ruleMigrations[v-1].settings(settings)...)
+	}
+	settings["schema_version"] = RuleSchemaVersion
+	return version, notes, nil
+}
+
+// MigrateRules upgrades the rule files in a directory that were written for older schema versions,
+// rewriting them in place unless check is set. Only YAML files can be rewritten, and only if the
+// result is a valid rule: settings the bot doesn't know have to be fixed by hand first.
+func MigrateRules(searchDir string, check bool) ([]RuleMigration, error) {
+	if _, err := os.Stat(searchDir); err != nil {
+		return nil, err
+	}
+	fileList := []string{}
+	filepath.Walk(searchDir, func(path string, f os.FileInfo, err error) error {
+		if err == nil && !f.IsDir() {
+			fileList = append(fileList, path)
+		}
+		return nil
+	})
+	sort.Strings(fileList)
+
+	migrations := []RuleMigration{}
+	for _, ruleFile := range fileList {
+		if migration, ok := migrateRuleFile(ruleFile, check); ok {
+			migrations = append(migrations, migration)
+		}
+	}
+	return migrations, nil
+}
+
+// migrateRuleFile upgrades a rule file, and tells whether it needed upgrading
+func migrateRuleFile(ruleFile string, check bool) (RuleMigration, bool) {
+	migration := RuleMigration{File: ruleFile}
+	ruleConf := viper.New()
+	ruleConf.SetConfigFile(ruleFile)
+	if err := ruleConf.ReadInConfig(); err != nil {
+		migration.Err = err
+		return migration, true
+	}
+	settings := ruleConf.AllSettings()
+	version, notes, err := upgradeRule(settings)
+	migration.From, migration.Notes, migration.Err = version, notes, err
+	if err != nil {
+		return migration, true
+	}
+	if version == RuleSchemaVersion {
+		return migration, false
+	}
+
+	if problems := decodeStrict(settings, &models.Rule{}); len(problems) > 0 {
+		migration.Err = fmt.Errorf("Fix these first: %s", strings.Join(problems, "; "))
+		return migration, true
+	}
+	switch strings.ToLower(filepath.Ext(ruleFile)) {
+	case ".yml", ".yaml":
+	default:
+		migration.Err = fmt.Errorf("Only YAML rule files can be upgraded, set 'schema_version: %d' and make the changes by hand", RuleSchemaVersion)
+		return migration, true
+	}
+	if check {
+		return migration, true
+	}
+
+	info, err := os.Stat(ruleFile)
+	if err != nil {
+		migration.Err = err
+		return migration, true
+	}
+	content, err := ioutil.ReadFile(ruleFile)
+	if err != nil {
+		migration.Err = err
+		return migration, true
+	}
+	lines := strings.Split(string(content), "\n")
+	for v := version; v < RuleSchemaVersion; v++ {
+		lines = ruleMigrations[v-1].yaml(lines)
+	}
+	lines = setYAMLKey(lines, "schema_version", strconv.Itoa(RuleSchemaVersion))
+	migration.Err = ioutil.WriteFile(ruleFile, []byte(strings.Join(lines, "\n")), info.Mode())
+	return migration, true
+}
+
+// yamlKey finds a top-level key of a YAML file
+func yamlKey(key string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(key) + `\s*:`)
+}
+
+// removeYAMLKey removes a top-level key of a YAML file, along with its value
+func removeYAMLKey(lines []string, key string) []string {
+	pattern := yamlKey(key)
+	result := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); i++ {
+		if !pattern.MatchString(lines[i]) {
+			result = append(result, lines[i])
+			continue
+		}
+		// The value may continue on the following lines, indented or as a list
+		for i+1 < len(lines) && (strings.HasPrefix(lines[i+1], " ") || strings.HasPrefix(lines[i+1], "\t") || strings.HasPrefix(lines[i+1], "-")) {
+			i++
+		}
+	}
+	return result
+}
+
+// setYAMLKey sets a top-level key of a YAML file to a scalar value. A new key goes before the first
+// setting, after the comments at the top of the file.
+func setYAMLKey(lines []string, key, value string) []string {
+	pattern := yamlKey(key)
+	line := key + ": " + value
+	for i := range lines {
+		if pattern.MatchString(lines[i]) {
+			lines[i] = line
+			return lines
+		}
+	}
+	i := 0
+	for i < len(lines) {
+		trimmed := strings.TrimSpace(lines[i])
+		if len(trimmed) > 0 && !strings.HasPrefix(trimmed, "#") && trimmed != "---" {
+			break
+		}
+		i++
+	}
+	return append(lines[:i], append([]string{line}, lines[i:]...)...)
+}
+
+// RuleSchema describes the current rule file format as a JSON Schema, e.g. for editors to check and
+// complete rule files with
+func RuleSchema() map[string]interface{} {
+	definitions := make(map[string]interface{})
+	schema := structSchema(reflect.TypeOf(models.Rule{}), definitions)
+	delete(definitions, "Rule")
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = fmt.Sprintf("flottbot rule (schema version %d)", RuleSchemaVersion)
+	schema["required"] = []string{"name", "schema_version"}
+	schema["properties"].(map[string]interface{})["schema_version"] = map[string]interface{}{"type": "integer", "enum": []int{RuleSchemaVersion}}
+	schema["definitions"] = definitions
+	return schema
+}
+
+// modelsPackage is where the types of rule settings are defined; other types (e.g. Slack attachments)
+// are described as any object
+var modelsPackage = reflect.TypeOf(models.Rule{}).PkgPath()
+
+// typeSchema describes the settings decoded into a type as a JSON Schema. The types of rule settings
+// are referred to by name, since they can contain themselves (e.g. the actions run 'on_error'), and
+// added to the definitions.
+func typeSchema(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), definitions)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), definitions)}
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), definitions)
+	case reflect.Struct:
+		if t.PkgPath() != modelsPackage {
+			return map[string]interface{}{"type": "object"}
+		}
+		if _, ok := definitions[t.Name()]; !ok {
+			structSchema(t, definitions)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema describes the settings decoded into a struct of the models package, and adds it to the definitions
+func structSchema(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	schema := map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+	definitions[t.Name()] = schema
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// Fields without a tag aren't read from rule files
+		name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if len(name) == 0 || name == "-" || len(field.PkgPath) > 0 {
+			continue
+		}
+		properties[name] = typeSchema(field.Type, definitions)
+	}
+	return schema
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestMigrateRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		want     string // the file's content afterwards
+		wantFrom int
+		wantErr  bool
+		migrated bool
+	}{
+		{"Version 1", "hello.yml", "# meta\nname: hello\ndebug: true\n# trigger\nrespond: hello\n", "# meta\nschema_version: 2\nname: hello\n# trigger\nrespond: hello\n", 1, false, true},
+		{"Nested value", "list.yml", "name: list\ndebug:\n  - true\nrespond: list\n", "schema_version: 2\nname: list\nrespond: list\n", 1, false, true},
+		{"Current version", "current.yml", "schema_version: 2\nname: current\n", "schema_version: 2\nname: current\n", 0, false, false},
+		{"Unknown setting", "typo.yml", "name: typo\nrespnd: typo\n", "name: typo\nrespnd: typo\n", 1, true, true},
+		{"Newer version", "future.yml", "schema_version: 3\nname: future\n", "schema_version: 3\nname: future\n", 3, true, true},
+		{"Not YAML", "json.json", `{"name": "json"}`, `{"name": "json"}`, 1, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "flottbot-migrate")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			file := filepath.Join(dir, tt.file)
+			ioutil.WriteFile(file, []byte(tt.content), 0644)
+
+			// Checking leaves the file alone
+			checked, err := MigrateRules(dir, true)
+			if err != nil {
+				t.Fatalf("MigrateRules() error = %v", err)
+			}
+			if content, _ := ioutil.ReadFile(file); string(content) != tt.content {
+				t.Errorf("MigrateRules() with check changed the file to %q", content)
+			}
+
+			migrations, err := MigrateRules(dir, false)
+			if err != nil {
+				t.Fatalf("MigrateRules() error = %v", err)
+			}
+			if len(migrations) != len(checked) {
+				t.Errorf("MigrateRules() = %+v, checking found %+v", migrations, checked)
+			}
+			if (len(migrations) > 0) != tt.migrated {
+				t.Fatalf("MigrateRules() = %+v, want migrated %v", migrations, tt.migrated)
+			}
+			if tt.migrated {
+				if migrations[0].From != tt.wantFrom {
+					t.Errorf("MigrateRules() from = %d, want %d", migrations[0].From, tt.wantFrom)
+				}
+				if (migrations[0].Err != nil) != tt.wantErr {
+					t.Errorf("MigrateRules() error = %v, wantErr %v", migrations[0].Err, tt.wantErr)
+				}
+			}
+			if content, _ := ioutil.ReadFile(file); string(content) != tt.want {
+				t.Errorf("MigrateRules() changed the file to %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRulesSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"Version 1 with unknown settings", "name: hello\nrespnd: hello\ndebug: true\n", false},
+		{"Current version", "schema_version: 2\nname: hello\nrespond: hello\n", false},
+		{"Current version with unknown settings", "schema_version: 2\nname: hello\nrespnd: hello\n", true},
+		{"Newer version", "schema_version: 3\nname: hello\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "flottbot-rules")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			ioutil.WriteFile(filepath.Join(dir, "hello.yml"), []byte(tt.content), 0644)
+
+			bot := &models.Bot{}
+			initLogger(bot)
+			rules, err := readRulesDir(dir, bot)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readRulesDir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && rules[filepath.Join(dir, "hello.yml")].SchemaVersion != RuleSchemaVersion {
+				t.Errorf("readRulesDir() = %+v, want schema version %d", rules, RuleSchemaVersion)
+			}
+		})
+	}
+}
+
+func TestRuleSchema(t *testing.T) {
+	schema := RuleSchema()
+	if !reflect.DeepEqual(schema["required"], []string{"name", "schema_version"}) {
+		t.Errorf("RuleSchema() required = %v", schema["required"])
+	}
+	properties := schema["properties"].(map[string]interface{})
+	for _, name := range []string{"name", "respond", "actions", "remotes"} {
+		if _, ok := properties[name]; !ok {
+			t.Errorf("RuleSchema() has no property %q", name)
+		}
+	}
+	if _, ok := properties["debug"]; ok {
+		t.Error("RuleSchema() has the property 'debug', which was removed in version 2")
+	}
+	if got := properties["actions"].(map[string]interface{})["items"]; !reflect.DeepEqual(got, map[string]interface{}{"$ref": "#/definitions/Action"}) {
+		t.Errorf("RuleSchema() actions = %v", got)
+	}
+	action := schema["definitions"].(map[string]interface{})["Action"].(map[string]interface{})
+	if action["additionalProperties"] != false {
+		t.Errorf("RuleSchema() actions allow unknown settings")
+	}
+	if got := action["properties"].(map[string]interface{})["timeout"]; !reflect.DeepEqual(got, map[string]interface{}{"type": "integer"}) {
+		t.Errorf("RuleSchema() action timeout = %v", got)
+	}
+}
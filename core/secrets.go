@@ -0,0 +1,48 @@
+package core
+
+import (
+	"os"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/secrets"
+	"github.com/target/flottbot/utils"
+)
+
+// configureSecrets lets bot and rule configuration reference secrets kept in a secrets manager
+// instead of plaintext YAML or environment variables, e.g.
+//
+//	slack_token: vault:secret/data/flottbot#slack_token
+//	Authorization: Bearer ${awssm:flottbot/api#token}
+//
+// Currently, we support 2 secrets managers, configured via their standard environment variables:
+//
+//	vault: HashiCorp Vault (VAULT_ADDR, VAULT_TOKEN)
+//	awssm: AWS Secrets Manager (AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN)
+//
+// Secrets are cached until their lease expires (or for 15 minutes if they have none), so values
+// used by actions pick up rotated secrets without restarting the bot.
+func configureSecrets(bot *models.Bot) {
+	resolver := secrets.NewResolver()
+	configured := false
+
+	if addr := os.Getenv("VAULT_ADDR"); len(addr) > 0 {
+		resolver.Register("vault", secrets.NewVault(addr, os.Getenv("VAULT_TOKEN")))
+		bot.Log.Infof("Resolving 'vault:' secrets from %s", addr)
+		configured = true
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if len(region) == 0 {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if len(region) > 0 && len(os.Getenv("AWS_ACCESS_KEY_ID")) > 0 {
+		resolver.Register("awssm", secrets.NewAWSSecretsManager(region,
+			os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")))
+		bot.Log.Infof("Resolving 'awssm:' secrets from AWS Secrets Manager in %s", region)
+		configured = true
+	}
+
+	if configured {
+		utils.SecretResolver = resolver.Resolve
+	}
+}
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+// sharedQueueBucket is the storage bucket of the messages waiting in the queue shared by the replicas
+const sharedQueueBucket = "inbound_queue"
+
+// sharedQueueIndexBucket is the storage bucket of the shared queue's index, the keys of its messages
+// oldest first, and of the lock held while the index changes
+const sharedQueueIndexBucket = "inbound_queue_index"
+
+// sharedQueueLockTTL is how long the shared queue's lock is held at most, should its replica go away
+const sharedQueueLockTTL = 5 * time.Second
+
+// sharedQueueLockTries is how often a replica tries to get the shared queue's lock before giving up
+const sharedQueueLockTries = 10
+
+// sharedQueueTTL is how long a message waits in the shared queue; one nobody took by then is dropped
+const sharedQueueTTL = 10 * time.Minute
+
+// sharedQueueInterval is how often a replica looks for messages in the shared queue
+const sharedQueueInterval = 200 * time.Millisecond
+
+// usesSharedQueue reports whether the messages read from chat go through the queue shared by the replicas
+func usesSharedQueue(bot *models.Bot) bool {
+	return bot.HighAvailability && bot.SharedQueue && bot.Store != nil
+}
+
+// publishMessage puts a message read from chat in the shared queue, for whichever replica has room
+// for it, and reports whether it did. Keys start with the time, so the index stays oldest first.
+func publishMessage(message models.Message, bot *models.Bot) bool {
+	if !usesSharedQueue(bot) || message.Service != models.MsgServiceChat {
+		return false
+	}
+	value, err := json.Marshal(message)
+	if err != nil {
+		bot.Log.Errorf("Could not put message %s in the shared queue, processing it here: %s", message.ID, err.Error())
+		return false
+	}
+	key := fmt.Sprintf("%020d-%s", time.Now().UnixNano(), message.ID)
+	if err := bot.Store.Set(sharedQueueBucket, key, value, sharedQueueTTL); err != nil {
+		bot.Log.Errorf("Could not put message %s in the shared queue, processing it here: %s", message.ID, err.Error())
+		return false
+	}
+	err = withSharedQueueLock(bot, func() error {
+		keys, err := queuedKeys(bot)
+		if err != nil {
+			return err
+		}
+		// Messages nobody took in time are gone, so are their keys
+		cutoff := fmt.Sprintf("%020d", time.Now().Add(-sharedQueueTTL).UnixNano())
+		for len(keys) > 0 && keys[0] < cutoff {
+			keys = keys[1:]
+		}
+		return setQueuedKeys(append(keys, key), bot)
+	})
+	if err != nil {
+		bot.Store.Delete(sharedQueueBucket, key)
+		bot.Log.Errorf("Could not put message %s in the shared queue, processing it here: %s", message.ID, err.Error())
+		return false
+	}
+	return true
+}
+
+// SharedQueue moves messages from the queue shared by the replicas into the input queue, while it
+// has room, so the replicas take turns at the messages any of them read and a busy replica leaves
+// them to the others. Only one replica takes each message.
+func SharedQueue(inputMsgs chan models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	if !usesSharedQueue(bot) {
+		return
+	}
+	bot.Log.Infof("Sharing the messages read from chat with the other replicas")
+	for range time.Tick(sharedQueueInterval) {
+		for _, message := range takeMessages(cap(inputMsgs)-len(inputMsgs), bot) {
+			enqueue(message, inputMsgs, outputMsgs, hitRule, bot)
+		}
+	}
+}
+
+// takeMessages takes up to max messages off the shared queue, the oldest first. It reads the
+// index and only the messages it takes, however long the queue is.
+func takeMessages(max int, bot *models.Bot) []models.Message {
+	if max <= 0 {
+		return nil
+	}
+	// Most of the time the queue is empty, which the index tells without taking the lock
+	keys, err := queuedKeys(bot)
+	if err != nil {
+		bot.Log.Errorf("Could not look at the shared queue: %s", err.Error())
+		return nil
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	var mine []string
+	err = withSharedQueueLock(bot, func() error {
+		keys, err := queuedKeys(bot)
+		if err != nil {
+			return err
+		}
+		if len(keys) > max {
+			mine, keys = keys[:max], keys[max:]
+		} else {
+			mine, keys = keys, nil
+		}
+		return setQueuedKeys(keys, bot)
+	})
+	if err != nil {
+		bot.Log.Errorf("Could not take messages off the shared queue: %s", err.Error())
+		return nil
+	}
+
+	taken := []models.Message{}
+	for _, key := range mine {
+		value, ok, err := bot.Store.Get(sharedQueueBucket, key)
+		if err != nil {
+			bot.Log.Errorf("Dropping a message in the shared queue that can't be read: %s", err.Error())
+			continue
+		}
+		// Nobody took it in time
+		if !ok {
+			continue
+		}
+		if err := bot.Store.Delete(sharedQueueBucket, key); err != nil {
+			bot.Log.Warnf("Could not remove a message from the shared queue: %s", err.Error())
+		}
+		var message models.Message
+		if err := json.Unmarshal(value, &message); err != nil {
+			bot.Log.Errorf("Dropping a message in the shared queue that can't be read: %s", err.Error())
+			continue
+		}
+		message.Run = models.NewRunContext(pipelineOf(bot).runs)
+		taken = append(taken, message)
+	}
+	return taken
+}
+
+// queuedKeys reads the keys of the messages in the shared queue, oldest first
+func queuedKeys(bot *models.Bot) ([]string, error) {
+	value, ok, err := bot.Store.Get(sharedQueueIndexBucket, "keys")
+	if err != nil || !ok {
+		return nil, err
+	}
+	var keys []string
+	err = json.Unmarshal(value, &keys)
+	return keys, err
+}
+
+// setQueuedKeys replaces the keys of the messages in the shared queue; callers must hold its lock
+func setQueuedKeys(keys []string, bot *models.Bot) error {
+	if len(keys) == 0 {
+		return bot.Store.Delete(sharedQueueIndexBucket, "keys")
+	}
+	value, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return bot.Store.Set(sharedQueueIndexBucket, "keys", value, sharedQueueTTL)
+}
+
+// withSharedQueueLock runs change while holding the lock of the shared queue's index, which only
+// one replica, and one goroutine of it, holds at a time
+func withSharedQueueLock(bot *models.Bot, change func() error) error {
+	owner := []byte(fmt.Sprintf("%s-%d", bot.InstanceID, time.Now().UnixNano()))
+	for try := 0; ; try++ {
+		held, err := bot.Store.Claim(sharedQueueIndexBucket, "lock", owner, sharedQueueLockTTL)
+		if err != nil {
+			return err
+		}
+		if held {
+			break
+		}
+		if try == sharedQueueLockTries {
+			return errors.New("The shared queue is busy")
+		}
+		time.Sleep(sharedQueueInterval / 10)
+	}
+	defer func() {
+		// The lock may have expired and gone to someone else
+		if value, ok, err := bot.Store.Get(sharedQueueIndexBucket, "lock"); err == nil && ok && bytes.Equal(value, owner) {
+			bot.Store.Delete(sharedQueueIndexBucket, "lock")
+		}
+	}()
+	return change()
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+)
+
+// defaultShutdownTimeout is how long the bot finishes its work when shutting down, unless bot.yml sets 'shutdown_timeout'
+const defaultShutdownTimeout = 30 * time.Second
+
+// drainInterval is how often shutting down checks whether all messages have been handled
+const drainInterval = 50 * time.Millisecond
+
+// Shutdown stops the bots running in the process gracefully, e.g. when Kubernetes replaces it during
+// a rollout. It stops the remotes from reading messages, lets the messages already read be processed
+// and their responses be sent, and then closes the HTTP servers, audit sinks, and storage. Whatever
+// is still unfinished after the main bot's 'shutdown_timeout' is abandoned.
+func Shutdown(bot *models.Bot) {
+	bots := runningBots()
+
+	timeout := shutdownTimeout(bot)
+	bot.Log.Infof("Shutting down, finishing work for up to %s", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := remote.StopReaders(ctx); err != nil {
+		bot.Log.Errorf("Could not stop reading messages: %s", err.Error())
+	}
+	if drain(ctx, bots) {
+		bot.Log.Info("Handled all messages")
+	} else {
+		for _, b := range bots {
+			p := pipelineOf(b.bot)
+			b.bot.Log.Warnf("Gave up on %d queued, %d processing, and %d unsent messages, and %d running rules", len(b.inputMsgs), atomic.LoadInt64(&p.inFlight), atomic.LoadInt64(&p.pendingSends), atomic.LoadInt64(&p.runningRules))
+			p.abandonRuns()
+		}
+	}
+	if err := remote.ShutdownServers(ctx); err != nil {
+		bot.Log.Errorf("Could not shut down HTTP servers: %s", err.Error())
+	}
+
+	for _, b := range bots {
+		if b.bot.AuditSink != nil {
+			if err := b.bot.AuditSink.Close(); err != nil {
+				b.bot.Log.Errorf("Could not close audit sink: %s", err.Error())
+			}
+		}
+		if b.bot.Store != nil {
+			if err := b.bot.Store.Close(); err != nil {
+				b.bot.Log.Errorf("Could not close storage: %s", err.Error())
+			}
+		}
+	}
+}
+
+// drain waits until every message in the input queues of the bots has been processed and its
+// responses sent. It reports whether that happened before the context was done.
+func drain(ctx context.Context, bots []runningBot) bool {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	// A message is briefly in none of the counts while it moves along, e.g. from the
+	// input queue to the matcher, so the bot has to look idle twice in a row
+	idleChecks := 0
+	for {
+		if idle(bots) {
+			idleChecks++
+			if idleChecks == 2 {
+				return true
+			}
+		} else {
+			idleChecks = 0
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// idle reports whether none of the bots has a message waiting, being processed, or being sent, or
+// a rule running
+func idle(bots []runningBot) bool {
+	for _, b := range bots {
+		p := pipelineOf(b.bot)
+		if len(b.inputMsgs) > 0 || atomic.LoadInt64(&p.inFlight) > 0 || atomic.LoadInt64(&p.runningRules) > 0 || atomic.LoadInt64(&p.pendingSends) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// shutdownTimeout is how long the bot finishes its work when shutting down
+func shutdownTimeout(bot *models.Bot) time.Duration {
+	if len(bot.ShutdownTimeout) == 0 {
+		return defaultShutdownTimeout
+	}
+	timeout, err := time.ParseDuration(bot.ShutdownTimeout)
+	if err != nil || timeout <= 0 {
+		bot.Log.Warnf("Invalid shutdown_timeout '%s', using %s", bot.ShutdownTimeout, defaultShutdownTimeout)
+		return defaultShutdownTimeout
+	}
+	return timeout
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		name     string
+		queued   int
+		inFlight int64
+		running  int64
+		pending  int64
+		finish   time.Duration // when the work is done; 0 means never
+		want     bool
+	}{
+		{"Idle", 0, 0, 0, 0, 0, true},
+		{"Finishes in time", 1, 1, 1, 1, 100 * time.Millisecond, true},
+		{"Message stuck in the queue", 1, 0, 0, 0, 0, false},
+		{"Slow match", 0, 1, 0, 0, 0, false},
+		{"Slow action", 0, 0, 1, 0, 0, false},
+		{"Unsent response", 0, 0, 0, 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputMsgs := make(chan models.Message, 1)
+			for i := 0; i < tt.queued; i++ {
+				inputMsgs <- models.NewMessage()
+			}
+			// Another bot in the process, whose work doesn't hold up this one
+			bots := []runningBot{{bot: new(models.Bot), inputMsgs: inputMsgs}}
+			p := pipelineOf(bots[0].bot)
+			atomic.StoreInt64(&p.inFlight, tt.inFlight)
+			atomic.StoreInt64(&p.runningRules, tt.running)
+			atomic.StoreInt64(&p.pendingSends, tt.pending)
+			atomic.StoreInt64(&pipelineOf(new(models.Bot)).inFlight, 1)
+			if tt.finish > 0 {
+				time.AfterFunc(tt.finish, func() {
+					<-inputMsgs
+					atomic.StoreInt64(&p.inFlight, 0)
+					atomic.StoreInt64(&p.runningRules, 0)
+					atomic.StoreInt64(&p.pendingSends, 0)
+				})
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			if got := drain(ctx, bots); got != tt.want {
+				t.Errorf("drain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout string
+		want    time.Duration
+	}{
+		{"Default", "", defaultShutdownTimeout},
+		{"Configured", "10s", 10 * time.Second},
+		{"Invalid", "soon", defaultShutdownTimeout},
+		{"Negative", "-5s", defaultShutdownTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := new(models.Bot)
+			bot.ShutdownTimeout = tt.timeout
+			if got := shutdownTimeout(bot); got != tt.want {
+				t.Errorf("shutdownTimeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
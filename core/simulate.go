@@ -0,0 +1,226 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// fixtures are the canned results of actions used while rules are simulated
+var fixtures = struct {
+	sync.RWMutex
+	list []models.Fixture
+}{}
+
+// Simulation is a message to feed through a bot's rules with Simulate, as if a remote had read it
+type Simulation struct {
+	Text    string
+	User    string
+	Channel string // the channel the message was sent in, mentioning the bot; a direct message if empty
+	Remote  string // 'slack', 'discord', or 'cli'
+}
+
+// ReadFixtures reads a fixtures file, which lists the canned results of HTTP and exec actions:
+//
+//	fixtures:
+//	  - rule: deploy         # optional, the action of any rule if not set
+//	    action: get status
+//	    status: 200
+//	    body: '{"version": "1.2.3"}'
+//	  - action: run deploy
+//	    status: 1
+//	    body: permission denied
+func ReadFixtures(file string) ([]models.Fixture, error) {
+	conf := viper.New()
+	conf.SetConfigFile(file)
+	if err := conf.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("Could not read fixtures file '%s': %s", file, err.Error())
+	}
+	list := []models.Fixture{}
+	if err := conf.UnmarshalKey("fixtures", &list); err != nil {
+		return nil, fmt.Errorf("Could not parse fixtures file '%s': %s", file, err.Error())
+	}
+	for i, fixture := range list {
+		if len(fixture.Action) == 0 {
+			return nil, fmt.Errorf("Fixture %d in '%s' has no 'action'", i+1, file)
+		}
+	}
+	return list, nil
+}
+
+// Simulate feeds a message through a bot's rules like the matcher does with the messages its remotes
+// read, without connecting to the chat application, e.g. to test rules offline. Actions with a fixture
+// don't run, and get the fixture's result instead; all other actions run as usual. The messages the
+// bot would send are returned once its rules are done, or when the timeout is up.
+func Simulate(sim Simulation, list []models.Fixture, timeout time.Duration, bot *models.Bot) ([]models.Message, error) {
+	// Like 'flottbot validate', look for the rules in the working directory
+	rules, err := readRulesDir(path.Join(configDir(bot), "rules"), bot)
+	if err != nil {
+		return nil, err
+	}
+	setCallableRules(bot, rules)
+
+	defer useFixtures(list)()
+
+	message, err := simulatedMessage(sim, bot)
+	if err != nil {
+		return nil, err
+	}
+	return simulateMessage(message, rules, timeout, bot)
+}
+
+// useFixtures makes actions use the given fixtures, until the returned function is called
+func useFixtures(list []models.Fixture) func() {
+	fixtures.Lock()
+	fixtures.list = list
+	fixtures.Unlock()
+	return func() {
+		fixtures.Lock()
+		fixtures.list = nil
+		fixtures.Unlock()
+	}
+}
+
+// simulateMessage runs the rules matching a message, and returns the messages the bot would send
+// once the rules are done, or when the timeout is up
+func simulateMessage(message models.Message, rules map[string]models.Rule, timeout time.Duration, bot *models.Bot) ([]models.Message, error) {
+	// Collect what the bot would send, instead of sending it
+	var (
+		mu   sync.Mutex
+		sent []models.Message
+	)
+	outputMsgs := make(chan models.Message, 1)
+	hitRule := make(chan models.Rule, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case output := <-outputMsgs:
+				rule := <-hitRule
+				// Remote-specific parts of the rule, like Slack attachments, are added when sending
+				output.Remotes = rule.Remotes
+				output.Output = utils.Redact(output.Output)
+				mu.Lock()
+				sent = append(sent, output)
+				mu.Unlock()
+				atomic.AddInt64(&pipelineOf(bot).pendingSends, -1)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	pipelineOf(bot).rulesMu.RLock()
+	matcherLoop(message, outputMsgs, rules, hitRule, bot)
+	pipelineOf(bot).rulesMu.RUnlock()
+
+	var err error
+	deadline := time.Now().Add(timeout)
+	for !idle([]runningBot{{bot: bot}}) {
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("Rules were still running after %s", timeout)
+			break
+		}
+		time.Sleep(drainInterval)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]models.Message{}, sent...), err
+}
+
+// simulatedMessage creates the message of a simulation the way the remote would from a message it read
+func simulatedMessage(sim Simulation, bot *models.Bot) (models.Message, error) {
+	message := models.NewMessage()
+	message.Input = sim.Text
+	message.Time = time.Now()
+	message.Timestamp = strconv.FormatInt(message.Time.Unix(), 10)
+
+	switch strings.ToLower(sim.Remote) {
+	case "slack", "discord":
+		message.Service = models.MsgServiceChat
+		bot.ChatApplication = strings.ToLower(sim.Remote)
+	case "", "cli":
+		message.Service = models.MsgServiceCLI
+	default:
+		return message, fmt.Errorf("Unknown remote '%s', use 'slack', 'discord', or 'cli'", sim.Remote)
+	}
+
+	message.Type = models.MsgTypeDirect
+	if len(sim.Channel) > 0 {
+		message.Type = models.MsgTypeChannel
+		message.ChannelName = sim.Channel
+		message.ChannelID = sim.Channel
+		if id, ok := bot.Rooms[sim.Channel]; ok {
+			message.ChannelID = id
+		}
+		message.BotMentioned = true
+	}
+
+	user := sim.User
+	if len(user) == 0 {
+		user = os.Getenv("USER")
+	}
+	message.Vars["_user.id"] = user
+	message.Vars["_user.name"] = user
+	message.Vars["_user.firstname"] = user
+	return message, nil
+}
+
+// findFixture finds the fixture of a rule's action, if it has one
+func findFixture(rule models.Rule, action models.Action) (models.Fixture, bool) {
+	fixtures.RLock()
+	defer fixtures.RUnlock()
+	for _, fixture := range fixtures.list {
+		if fixture.Action == action.Name && (len(fixture.Rule) == 0 || fixture.Rule == rule.Name) {
+			return fixture, true
+		}
+	}
+	return models.Fixture{}, false
+}
+
+// mockHTTP gives an HTTP call action the response of its fixture
+func mockHTTP(fixture models.Fixture, action models.Action, msg *models.Message, bot *models.Bot) error {
+	if len(fixture.Error) > 0 {
+		msg.Error = translate(*msg, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
+		return errors.New(fixture.Error)
+	}
+
+	resp := &models.HTTPResponse{Status: fixture.Status, Raw: fixture.Body, Data: fixture.Body}
+	if resp.Status == 0 {
+		resp.Status = 200
+	}
+	// Like real responses, JSON objects are available to 'expose_json_fields'
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(fixture.Body), &data); err == nil {
+		resp.Data = data
+	}
+	return handleHTTPResponse(action, resp, msg, bot)
+}
+
+// mockScript gives an exec or ssh action the output and exit status of its fixture,
+// e.g. ${_exec_output} and ${_exec_status}
+func mockScript(fixture models.Fixture, prefix string, msg *models.Message) error {
+	msg.Vars[prefix+"_output"] = fixture.Body
+	msg.Vars[prefix+"_status"] = strconv.Itoa(fixture.Status)
+	if len(fixture.Error) > 0 {
+		return errors.New(fixture.Error)
+	}
+	if fixture.Status != 0 {
+		return fmt.Errorf("exit status %d", fixture.Status)
+	}
+	return nil
+}
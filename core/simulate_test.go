@@ -0,0 +1,113 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestSimulate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flottbot-simulate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "rules"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "rules", "deploy.yml"), []byte(`
+name: deploy
+active: true
+respond: deploy
+args: [service]
+actions:
+  - name: get version
+    type: GET
+    url: https://deploy.example.com/${service}
+    expose_json_fields:
+      version: .version
+  - name: run deploy
+    type: exec
+    cmd: ./deploy.sh ${service} ${version}
+format_output: "${service} ${version}: ${_exec_output}"
+`), 0644)
+
+	tests := []struct {
+		name     string
+		sim      Simulation
+		fixtures []models.Fixture
+		want     []string
+	}{
+		{"Mocked actions", Simulation{Text: "deploy api", User: "alice", Remote: "slack"}, []models.Fixture{
+			{Action: "get version", Body: `{"version": "1.2.3"}`},
+			{Rule: "deploy", Action: "run deploy", Body: "done"},
+		}, []string{"api 1.2.3: done"}},
+		{"Fixture of another rule", Simulation{Text: "deploy api", Channel: "ops"}, []models.Fixture{
+			{Action: "get version", Body: `{"version": "1.2.3"}`},
+			{Rule: "rollback", Action: "run deploy", Body: "done"},
+			{Action: "run deploy", Status: 2, Body: "permission denied"},
+		}, []string{"api 1.2.3: permission denied"}},
+		{"Failed request", Simulation{Text: "deploy api"}, []models.Fixture{
+			{Action: "get version", Error: "connection refused"},
+			{Action: "run deploy", Body: "done"},
+		}, []string{"Variable 'version' has not been defined."}},
+		{"Missing argument", Simulation{Text: "deploy"}, nil, []string{"You might be missing an argument or two. This is what I'm looking for\n```deploy <service>```"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &models.Bot{Name: "bot", ConfigDir: dir}
+			initLogger(bot)
+
+			sent, err := Simulate(tt.sim, tt.fixtures, 5*time.Second, bot)
+			if err != nil {
+				t.Fatalf("Simulate() error = %v", err)
+			}
+			got := []string{}
+			for _, message := range sent {
+				got = append(got, message.Output)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Simulate() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Simulate()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flottbot-fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{"Fixtures", "fixtures:\n  - action: get version\n    body: '{}'\n  - rule: deploy\n    action: run deploy\n    status: 1\n", 2, false},
+		{"No action", "fixtures:\n  - rule: deploy\n    body: done\n", 0, true},
+		{"Not YAML", "fixtures: [", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, "fixtures.yml")
+			ioutil.WriteFile(file, []byte(tt.content), 0644)
+			got, err := ReadFixtures(file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadFixtures() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("ReadFixtures() = %+v, want %d fixtures", got, tt.want)
+			}
+		})
+	}
+}
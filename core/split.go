@@ -0,0 +1,154 @@
+package core
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/target/flottbot/models"
+)
+
+// What happens to messages longer than a chat application allows
+const (
+	outputSplit    = "split"    // send them as several messages
+	outputThread   = "thread"   // send them as several messages, in the thread of the message that triggered the rule
+	outputTruncate = "truncate" // cut them short
+)
+
+// codeFence starts and ends a block of code in Markdown
+const codeFence = "```"
+
+// defaultOutputLimits are the longest messages the chat applications take
+var defaultOutputLimits = models.OutputLimits{
+	"slack":   {MaxLength: 40000, Policy: outputSplit},
+	"discord": {MaxLength: 2000, Policy: outputSplit},
+}
+
+// outputLimit determines how long a message sent to a chat application can be, and what happens
+// to longer ones; 'output_limits' in bot.yml overrides the defaults
+func outputLimit(message models.Message, bot *models.Bot) models.OutputLimit {
+	remote := messageRemote(message, bot)
+	limit := defaultOutputLimits[remote]
+	if len(limit.Policy) == 0 {
+		limit.Policy = outputSplit
+	}
+	if conf, ok := bot.OutputLimits[remote]; ok {
+		if conf.MaxLength > 0 {
+			limit.MaxLength = conf.MaxLength
+		}
+		if len(conf.Policy) > 0 {
+			limit.Policy = strings.ToLower(conf.Policy)
+		}
+	}
+	return limit
+}
+
+// splitMessage splits a message whose output is longer than its chat application allows into
+// several, or cuts it short. The files and attachments of the message are sent with the last part.
+func splitMessage(message models.Message, bot *models.Bot) []models.Message {
+	limit := outputLimit(message, bot)
+	if limit.MaxLength <= 0 || utf8.RuneCountInString(message.Output) <= limit.MaxLength {
+		return []models.Message{message}
+	}
+
+	if limit.Policy == outputTruncate {
+		message.Output = splitOutput(message.Output, limit.MaxLength-2)[0] + "\n…"
+		return []models.Message{message}
+	}
+	if limit.Policy == outputThread && message.Service == models.MsgServiceChat {
+		message.StartThread = true
+	}
+	parts := splitOutput(message.Output, limit.MaxLength)
+	bot.Log.Debugf("Splitting message %s into %d parts of at most %d characters", message.ID, len(parts), limit.MaxLength)
+	messages := make([]models.Message, len(parts))
+	for i, part := range parts {
+		messages[i] = message
+		messages[i].Output = part
+		if i < len(parts)-1 {
+			messages[i].Files = nil
+			messages[i].Remotes = models.Remotes{}
+		}
+	}
+	return messages
+}
+
+// splitOutput splits text into parts of at most limit characters, between lines where it can.
+// A block of code that is split is closed at the end of one part and opened again at the start of
+// the next, so each part shows it as code.
+func splitOutput(text string, limit int) []string {
+	if limit <= 0 || utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	parts := []string{}
+	lines := []string{}
+	size := 0
+	fence := "" // the line opening the block of code the current part is in
+	add := func(line string) {
+		if len(lines) > 0 {
+			size++
+		}
+		lines = append(lines, line)
+		size += utf8.RuneCountInString(line)
+	}
+	flush := func() {
+		part := strings.Join(lines, "\n")
+		if len(fence) > 0 {
+			part = part + "\n" + codeFence
+		}
+		parts = append(parts, part)
+		lines, size = nil, 0
+		if len(fence) > 0 {
+			add(fence)
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		isFence := strings.HasPrefix(strings.TrimSpace(line), codeFence)
+		// Room is left to open and close the block of code a line is in
+		room, closing := limit, 0
+		if len(fence) > 0 && !isFence {
+			room = limit - utf8.RuneCountInString(fence) - len(codeFence) - 2
+			closing = len(codeFence) + 1
+		}
+		for _, piece := range splitLine(line, room) {
+			length := utf8.RuneCountInString(piece)
+			if len(lines) > 0 {
+				length++
+			}
+			if len(lines) > 0 && size+length+closing > limit {
+				flush()
+			}
+			add(piece)
+		}
+		switch {
+		case isFence && len(fence) == 0:
+			fence = strings.TrimSpace(line)
+		case isFence:
+			fence = ""
+		}
+	}
+	if len(lines) > 0 {
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+	return parts
+}
+
+// splitLine splits a line longer than limit characters, between words where it can
+func splitLine(line string, limit int) []string {
+	if limit <= 0 {
+		return []string{line}
+	}
+	pieces := []string{}
+	runes := []rune(line)
+	for len(runes) > limit {
+		cut, next := limit, limit
+		for i := limit; i > limit/2; i-- {
+			if runes[i] == ' ' {
+				cut, next = i, i+1
+				break
+			}
+		}
+		pieces = append(pieces, string(runes[:cut]))
+		runes = runes[next:]
+	}
+	return append(pieces, string(runes))
+}
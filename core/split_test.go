@@ -0,0 +1,88 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestSplitOutput(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"Short", "hello", 10, []string{"hello"}},
+		{"No limit", "hello", 0, []string{"hello"}},
+		{"Between lines", "one\ntwo\nthree", 8, []string{"one\ntwo", "three"}},
+		{"Between words", "the quick brown fox", 10, []string{"the quick", "brown fox"}},
+		{"Long word", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"Characters, not bytes", "ääää\nöö", 6, []string{"ääää", "öö"}},
+		{"Code block", "Logs:\n```\nline 1\nline 2\nline 3\n```\nDone", 20, []string{"Logs:\n```\nline 1\n```", "```\nline 2\n```", "```\nline 3\n```\nDone"}},
+		{"Code block with language", "```go\nfunc a() {}\nfunc b() {}\n```", 24, []string{"```go\nfunc a() {}\n```", "```go\nfunc b() {}\n```"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitOutput(tt.text, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitOutput() = %q, want %q", got, tt.want)
+			}
+			for _, part := range got {
+				if tt.limit > 0 && utf8.RuneCountInString(part) > tt.limit {
+					t.Errorf("splitOutput() part %q is longer than %d", part, tt.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	long := strings.Repeat("word ", 500)
+	tests := []struct {
+		name       string
+		chatApp    string
+		limits     models.OutputLimits
+		output     string
+		wantParts  int
+		wantThread string
+	}{
+		{"Fits", "discord", nil, "hello", 1, ""},
+		{"Discord default", "discord", nil, long, 2, ""},
+		{"Slack default", "slack", nil, long, 1, ""},
+		{"Configured length", "slack", models.OutputLimits{"slack": {MaxLength: 1000}}, long, 3, ""},
+		{"Thread", "slack", models.OutputLimits{"slack": {MaxLength: 1000, Policy: "thread"}}, long, 3, "1555.0001"},
+		{"Truncate", "discord", models.OutputLimits{"discord": {Policy: "truncate"}}, long, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := &models.Bot{ChatApplication: tt.chatApp, OutputLimits: tt.limits}
+			initLogger(bot)
+			message := models.NewMessage()
+			message.Service = models.MsgServiceChat
+			message.ReplyToID = "1555.0001"
+			message.Output = tt.output
+			message.Files = []models.File{{Name: "report.csv"}}
+
+			got := splitMessage(message, bot)
+			if len(got) != tt.wantParts {
+				t.Fatalf("splitMessage() = %d parts, want %d", len(got), tt.wantParts)
+			}
+			limit := outputLimit(message, bot).MaxLength
+			for i, part := range got {
+				if utf8.RuneCountInString(part.Output) > limit {
+					t.Errorf("splitMessage() part %d is %d characters long", i, utf8.RuneCountInString(part.Output))
+				}
+				if part.OutputThread() != tt.wantThread {
+					t.Errorf("splitMessage() part %d is in thread %q, want %q", i, part.OutputThread(), tt.wantThread)
+				}
+				if wantFiles := i == len(got)-1; (len(part.Files) > 0) != wantFiles {
+					t.Errorf("splitMessage() part %d has files %v", i, part.Files)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/target/flottbot/handlers"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/render"
+)
+
+// handleSQL handles 'sql' actions. The rows returned are available as ${_sql_rows} (JSON),
+// ${_sql_table} (a plain text table), and the first row's columns as ${_sql.<column>}.
+func handleSQL(action models.Action, msg *models.Message, bot *models.Bot) error {
+	result, err := handlers.SQLQuery(action, msg, bot)
+	if err != nil {
+		msg.Error = translate(*msg, bot, "errors.action_failed", "Error in request made by action '${action}'. See bot admin for more information", map[string]string{"action": action.Name})
+		return err
+	}
+
+	msg.Vars["_sql_rows_affected"] = strconv.FormatInt(result.RowsAffected, 10)
+	msg.Vars["_sql_row_count"] = strconv.Itoa(len(result.Rows))
+	msg.Vars["_sql_truncated"] = strconv.FormatBool(result.Truncated)
+
+	rows, err := json.Marshal(result.Rows)
+	if err != nil {
+		return err
+	}
+	msg.Vars["_sql_rows"] = string(rows)
+	msg.Vars["_sql_table"] = sqlTable(result)
+	if len(result.Rows) > 0 {
+		for _, column := range result.Columns {
+			msg.Vars["_sql."+column] = sqlValue(result.Rows[0][column])
+		}
+	}
+
+	bot.Log.Debugf("Successfully executed action '%s'", action.Name)
+
+	// Rows can be picked apart like HTTP responses
+	if len(action.Extract) > 0 {
+		return extractFields(action, string(rows), msg)
+	}
+	return nil
+}
+
+// sqlValue formats a column's value; NULL is empty
+func sqlValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// sqlTable renders a query's result as a plain text table, to be shown in a code block
+func sqlTable(result *models.SQLResult) string {
+	table := render.Table(result.Columns, result.Rows)
+	if result.Truncated {
+		table += fmt.Sprintf("\n(only the first %d rows are shown)", len(result.Rows))
+	}
+	return table
+}
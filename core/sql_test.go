@@ -0,0 +1,26 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func Test_sqlTable(t *testing.T) {
+	result := &models.SQLResult{
+		Columns: []string{"name", "replicas", "owner"},
+		Rows: []map[string]interface{}{
+			{"name": "api", "replicas": int64(3), "owner": "platform"},
+			{"name": "web-frontend", "replicas": int64(12), "owner": nil},
+		},
+		Truncated: true,
+	}
+	want := "name         | replicas | owner\n" +
+		"-------------+----------+---------\n" +
+		"api          | 3        | platform\n" +
+		"web-frontend | 12       |\n" +
+		"(only the first 2 rows are shown)"
+	if got := sqlTable(result); got != want {
+		t.Errorf("sqlTable() =\n%s\nwant\n%s", got, want)
+	}
+}
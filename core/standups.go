@@ -0,0 +1,494 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/utils"
+)
+
+// Storage buckets of standups
+const (
+	standupRunsBucket      = "standup-runs"      // the open run of each standup, by name
+	standupAnswersBucket   = "standup-answers"   // what members answered in a run, by standup name and user ID
+	standupAskingBucket    = "standup-asking"    // the standup each member is answering, by user ID
+	standupOptOutsBucket   = "standup-optouts"   // members who opted out, by standup name and user ID
+	standupVacationsBucket = "standup-vacations" // members who are away, by user ID, until they're back
+	standupClaimsBucket    = "standup-claims"    // which replica of the bot starts and posts each run
+)
+
+// standupInterval is how often standups are looked at, to start them or post their summary
+const standupInterval = 30 * time.Second
+
+// standupCollect is how long answers are collected when a standup's 'collect' is not set
+const standupCollect = 2 * time.Hour
+
+// defaultStandupQuestions are asked when a standup's 'questions' are not set
+var defaultStandupQuestions = []string{"What did you do since the last standup?", "What will you do today?", "Is anything blocking you?"}
+
+// standupMu keeps a replica of the bot from posting a standup's summary twice, when the last member
+// answers as it's due
+var standupMu sync.Mutex
+
+// standupRun is a standup whose answers are being collected
+type standupRun struct {
+	Started time.Time `json:"started"`
+	Post    time.Time `json:"post"`           // when the summary is posted, if not everyone answered before
+	Asked   []string  `json:"asked"`          // the members asked, by user ID
+	Away    []string  `json:"away,omitempty"` // the members on vacation
+}
+
+// standupAnswers are what a member answered in a standup's run
+type standupAnswers struct {
+	Answers []string `json:"answers"`
+	Skipped bool     `json:"skipped,omitempty"`
+	Done    bool     `json:"done,omitempty"`
+}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "standup start", usage: "standup start <name>", description: "Start a standup right away", args: 1, admin: true, module: moduleStandups, run: startStandupCommand},
+		builtinCommand{trigger: "standup optout", usage: "standup optout [name]", description: "Stop being asked for a standup, this channel's by default", module: moduleStandups, run: standupOptOutCommand},
+		builtinCommand{trigger: "standup optin", usage: "standup optin [name]", description: "Be asked for a standup again, this channel's by default", module: moduleStandups, run: standupOptInCommand},
+		builtinCommand{trigger: "standup vacation", usage: "standup vacation <YYYY-MM-DD|duration>", description: "Skip all standups while you're away, e.g. 'standup vacation 2019-05-10' or 'standup vacation 3d'", args: 1, module: moduleStandups, run: standupVacationCommand},
+		builtinCommand{trigger: "standup back", usage: "standup back", description: "Be asked for standups again after a vacation", module: moduleStandups, run: standupBackCommand},
+	)
+}
+
+// Standups starts the standups configured in bot.yml on their schedule, and posts their summary once
+// everyone answered or their 'collect' time is over. Like reminders, they're kept in the storage backend,
+// and only one replica of the bot runs each of them.
+func Standups(outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	if !moduleEnabled(moduleStandups, bot) || len(bot.Standups) == 0 {
+		return
+	}
+	schedules := make([]cron.Schedule, len(bot.Standups))
+	for i, standup := range bot.Standups {
+		schedule, err := cron.Parse(standup.Schedule)
+		if err != nil {
+			bot.Log.Errorf("Invalid schedule '%s' of standup '%s', it only starts with 'standup start': %s", standup.Schedule, standupName(standup), err.Error())
+			continue
+		}
+		schedules[i] = schedule
+	}
+
+	since := time.Now()
+	ticker := time.NewTicker(standupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-remote.Stopping():
+			return
+		case now := <-ticker.C:
+			checkStandups(since, now, schedules, outputMsgs, hitRule, bot)
+			since = now
+		}
+	}
+}
+
+// checkStandups starts the standups due since the last check, and posts the summaries that are due
+func checkStandups(since, now time.Time, schedules []cron.Schedule, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	for i, standup := range bot.Standups {
+		name := standupName(standup)
+		if i < len(schedules) && schedules[i] != nil {
+			if due := schedules[i].Next(since); !due.After(now) {
+				// Another replica of the bot may be starting the standup already
+				claimed, err := bot.Store.Claim(standupClaimsBucket, "start:"+name+"@"+strconv.FormatInt(due.Unix(), 10), []byte(bot.InstanceID), time.Hour)
+				if err == nil && claimed {
+					startStandup(standup, now, outputMsgs, hitRule, bot)
+				}
+			}
+		}
+		if run, ok, err := getStandupRun(name, bot); err == nil && ok && !run.Post.After(now) {
+			postStandup(standup, outputMsgs, hitRule, bot)
+		}
+	}
+}
+
+// startStandup asks the members of a standup its first question, except those who opted out or are
+// on vacation. A run of the standup still open is posted first.
+func startStandup(standup models.Standup, now time.Time, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	name := standupName(standup)
+	if _, ok, err := getStandupRun(name, bot); err == nil && ok {
+		postStandup(standup, outputMsgs, hitRule, bot)
+	}
+
+	collect := standupCollectTime(standup)
+	run := standupRun{Started: now, Post: now.Add(collect)}
+	for _, member := range standup.Members {
+		if _, out, _ := bot.Store.Get(standupOptOutsBucket, name+"/"+member); out {
+			continue
+		}
+		if _, away, _ := bot.Store.Get(standupVacationsBucket, member); away {
+			run.Away = append(run.Away, member)
+			continue
+		}
+		run.Asked = append(run.Asked, member)
+	}
+	if err := setStandupRun(name, run, bot); err != nil {
+		bot.Log.Errorf("Could not start standup '%s': %s", name, err.Error())
+		return
+	}
+
+	questions := standupQuestions(standup)
+	for _, member := range run.Asked {
+		if err := setStandupAnswers(name, member, standupAnswers{}, collect, bot); err != nil {
+			bot.Log.Errorf("Could not ask %s for standup '%s': %s", member, name, err.Error())
+			continue
+		}
+		if err := bot.Store.Set(standupAskingBucket, member, []byte(name), collect); err != nil {
+			bot.Log.Errorf("Could not ask %s for standup '%s': %s", member, name, err.Error())
+			continue
+		}
+		message := standupMessage(member)
+		message.Output = translate(message, bot, "standups.intro", "Time for the ${standup} standup! Answer 'skip' to skip it this time.\n\n${question}", map[string]string{"standup": name, "question": questions[0]})
+		sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+	}
+	bot.Log.Infof("Started standup '%s', asking %d member(s)", name, len(run.Asked))
+}
+
+// answerStandup takes a direct message from a member answering a standup as their answer to the
+// question they were asked last, and asks the next one. It reports whether the message was an answer,
+// which isn't matched against the rules then. Built-in standup commands are never taken as answers.
+func answerStandup(message models.Message, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) bool {
+	if bot.Store == nil || !moduleEnabled(moduleStandups, bot) {
+		return false
+	}
+	if message.Service != models.MsgServiceChat || message.Type != models.MsgTypeDirect || message.Event != models.MsgEventSent {
+		return false
+	}
+	input := strings.TrimSpace(message.Input)
+	if len(input) == 0 || strings.HasPrefix(strings.ToLower(input), "standup") {
+		return false
+	}
+	userID := message.Vars["_user.id"]
+	raw, ok, err := bot.Store.Get(standupAskingBucket, userID)
+	if err != nil || !ok {
+		return false
+	}
+	standup, ok := findStandup(string(raw), bot)
+	if !ok {
+		bot.Store.Delete(standupAskingBucket, userID)
+		return false
+	}
+	name := standupName(standup)
+	answers, _, err := getStandupAnswers(name, userID, bot)
+	if err != nil {
+		bot.Log.Errorf("Could not look up the answers of %s for standup '%s': %s", userID, name, err.Error())
+		return false
+	}
+
+	questions := standupQuestions(standup)
+	if strings.EqualFold(input, "skip") {
+		answers.Skipped = true
+	} else {
+		answers.Answers = append(answers.Answers, input)
+	}
+	answers.Done = answers.Skipped || len(answers.Answers) >= len(questions)
+	if err := setStandupAnswers(name, userID, answers, standupCollectTime(standup), bot); err != nil {
+		bot.Log.Errorf("Could not keep the answers of %s for standup '%s': %s", userID, name, err.Error())
+		return false
+	}
+
+	switch {
+	case answers.Skipped:
+		message.Output = translate(message, bot, "standups.skipped", "Okay, skipping this one.", nil)
+	case answers.Done:
+		message.Output = translate(message, bot, "standups.done", "Thanks! I'll share your answers in the standup summary.", nil)
+	default:
+		message.Output = questions[len(answers.Answers)]
+	}
+	if answers.Done {
+		bot.Store.Delete(standupAskingBucket, userID)
+	}
+	sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+
+	// The summary doesn't wait once everyone answered
+	if answers.Done && standupAnswered(name, bot) {
+		postStandup(standup, outputMsgs, hitRule, bot)
+	}
+	return true
+}
+
+// standupAnswered determines whether every member asked in a standup's run is done answering
+func standupAnswered(name string, bot *models.Bot) bool {
+	run, ok, err := getStandupRun(name, bot)
+	if err != nil || !ok {
+		return false
+	}
+	for _, member := range run.Asked {
+		if answers, _, err := getStandupAnswers(name, member, bot); err != nil || !answers.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// postStandup posts the summary of a standup's run to its channel, and closes the run
+func postStandup(standup models.Standup, outputMsgs chan<- models.Message, hitRule chan<- models.Rule, bot *models.Bot) {
+	standupMu.Lock()
+	defer standupMu.Unlock()
+
+	name := standupName(standup)
+	run, ok, err := getStandupRun(name, bot)
+	if err != nil || !ok {
+		return
+	}
+	// Another replica of the bot may be posting the summary already
+	claimed, err := bot.Store.Claim(standupClaimsBucket, "post:"+name+"@"+strconv.FormatInt(run.Started.Unix(), 10), []byte(bot.InstanceID), time.Hour)
+	if err != nil || !claimed {
+		return
+	}
+
+	questions := standupQuestions(standup)
+	sections := []string{translate(models.NewMessage(), bot, "standups.summary", "*${standup} standup*", map[string]string{"standup": name})}
+	var missing, skipped []string
+	for _, member := range run.Asked {
+		answers, _, err := getStandupAnswers(name, member, bot)
+		if err != nil {
+			bot.Log.Errorf("Could not look up the answers of %s for standup '%s': %s", member, name, err.Error())
+		}
+		bot.Store.Delete(standupAnswersBucket, name+"/"+member)
+		if asking, ok, _ := bot.Store.Get(standupAskingBucket, member); ok && string(asking) == name {
+			bot.Store.Delete(standupAskingBucket, member)
+		}
+
+		switch {
+		case answers.Skipped:
+			skipped = append(skipped, mentionUser(member))
+		case len(answers.Answers) == 0:
+			missing = append(missing, mentionUser(member))
+		default:
+			lines := []string{mentionUser(member)}
+			for i, answer := range answers.Answers {
+				if i < len(questions) {
+					lines = append(lines, fmt.Sprintf("_%s_", questions[i]))
+				}
+				lines = append(lines, answer)
+			}
+			sections = append(sections, strings.Join(lines, "\n"))
+		}
+	}
+	for _, list := range []struct {
+		key, text string
+		members   []string
+	}{
+		{"standups.missing", "No update from: ${members}", missing},
+		{"standups.skipped_by", "Skipped: ${members}", skipped},
+		{"standups.away", "Away: ${members}", mentionUsers(run.Away)},
+	} {
+		if len(list.members) > 0 {
+			sections = append(sections, translate(models.NewMessage(), bot, list.key, list.text, map[string]string{"members": strings.Join(list.members, ", ")}))
+		}
+	}
+	if err := bot.Store.Delete(standupRunsBucket, name); err != nil {
+		bot.Log.Errorf("Could not close standup '%s': %s", name, err.Error())
+	}
+
+	message, ok := channelMessage(standup.Channel, strings.Join(sections, "\n\n"), bot)
+	if !ok {
+		bot.Log.Errorf("Could not find the channel '%s' of standup '%s'", standup.Channel, name)
+		return
+	}
+	sendOutput(outputMsgs, hitRule, message, models.Rule{}, bot)
+}
+
+// startStandupCommand starts the standup named by the first argument right away
+func startStandupCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	standup, ok := findStandup(args[0], bot)
+	if !ok {
+		return "", fmt.Errorf("Could not find a standup named '%s'", args[0])
+	}
+	startStandup(standup, time.Now(), outputMsgs, hitRule, bot)
+	return fmt.Sprintf("Started standup '%s'.", standupName(standup)), nil
+}
+
+// standupOptOutCommand stops asking the sender for a standup
+func standupOptOutCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	standup, ok := standupFor(args, *message, bot)
+	if !ok {
+		return translate(*message, bot, "standups.which", "Which standup? Use its name, or run this in its channel.", nil), nil
+	}
+	name, userID := standupName(standup), message.Vars["_user.id"]
+	if err := bot.Store.Set(standupOptOutsBucket, name+"/"+userID, []byte("true"), 0); err != nil {
+		return "", err
+	}
+	if asking, ok, _ := bot.Store.Get(standupAskingBucket, userID); ok && string(asking) == name {
+		bot.Store.Delete(standupAskingBucket, userID)
+	}
+	return translate(*message, bot, "standups.opted_out", "Okay, I won't ask you for the ${standup} standup anymore.", map[string]string{"standup": name}), nil
+}
+
+// standupOptInCommand asks the sender for a standup again after they opted out
+func standupOptInCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	standup, ok := standupFor(args, *message, bot)
+	if !ok {
+		return translate(*message, bot, "standups.which", "Which standup? Use its name, or run this in its channel.", nil), nil
+	}
+	name := standupName(standup)
+	if err := bot.Store.Delete(standupOptOutsBucket, name+"/"+message.Vars["_user.id"]); err != nil {
+		return "", err
+	}
+	return translate(*message, bot, "standups.opted_in", "Okay, I'll ask you for the ${standup} standup again.", map[string]string{"standup": name}), nil
+}
+
+// standupVacationCommand skips all standups for the sender until a date, or for a while
+func standupVacationCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	return standupVacation(args[0], *message, bot, time.Now())
+}
+
+// standupVacation puts the sender of a message on vacation until a date (through the end of that day)
+// or for a duration. Vacations end on their own.
+func standupVacation(until string, message models.Message, bot *models.Bot, now time.Time) (string, error) {
+	var back time.Time
+	if day, err := time.ParseInLocation("2006-01-02", until, now.Location()); err == nil {
+		back = day.AddDate(0, 0, 1)
+	} else if d, err := utils.ParseDuration(until); err == nil && d > 0 {
+		back = now.Add(d)
+	}
+	if !back.After(now) {
+		return translate(message, bot, "standups.vacation_usage", "Tell me until when, e.g. 'standup vacation 2019-05-10' or 'standup vacation 3d'.", nil), nil
+	}
+	userID := message.Vars["_user.id"]
+	if err := bot.Store.Set(standupVacationsBucket, userID, []byte(back.Format(time.RFC3339)), back.Sub(now)); err != nil {
+		return "", err
+	}
+	bot.Store.Delete(standupAskingBucket, userID)
+	return translate(message, bot, "standups.vacation", "Enjoy! I won't ask you for standups until ${back}.", map[string]string{"back": back.Format("2006-01-02 15:04 MST")}), nil
+}
+
+// standupBackCommand ends the sender's vacation
+func standupBackCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	if err := bot.Store.Delete(standupVacationsBucket, message.Vars["_user.id"]); err != nil {
+		return "", err
+	}
+	return translate(*message, bot, "standups.back", "Welcome back! I'll ask you for standups again.", nil), nil
+}
+
+// standupFor finds the standup a command is about: the one named by its argument, the one of the
+// channel it's run in, or the only one there is
+func standupFor(args []string, message models.Message, bot *models.Bot) (models.Standup, bool) {
+	if len(args) > 0 {
+		return findStandup(args[0], bot)
+	}
+	for _, standup := range bot.Standups {
+		if len(message.ChannelID) > 0 && (strings.EqualFold(standup.Channel, message.ChannelName) || standup.Channel == message.ChannelID) {
+			return standup, true
+		}
+	}
+	if len(bot.Standups) == 1 {
+		return bot.Standups[0], true
+	}
+	return models.Standup{}, false
+}
+
+// findStandup finds a standup by name
+func findStandup(name string, bot *models.Bot) (models.Standup, bool) {
+	for _, standup := range bot.Standups {
+		if strings.EqualFold(standupName(standup), name) {
+			return standup, true
+		}
+	}
+	return models.Standup{}, false
+}
+
+// standupName is what a standup is called, its channel unless it has a 'name'
+func standupName(standup models.Standup) string {
+	if len(standup.Name) > 0 {
+		return standup.Name
+	}
+	return standup.Channel
+}
+
+// standupQuestions are what the members of a standup are asked
+func standupQuestions(standup models.Standup) []string {
+	if len(standup.Questions) > 0 {
+		return standup.Questions
+	}
+	return defaultStandupQuestions
+}
+
+// standupCollectTime is how long the answers of a standup are collected
+func standupCollectTime(standup models.Standup) time.Duration {
+	if d, err := utils.ParseDuration(standup.Collect); err == nil && d > 0 {
+		return d
+	}
+	return standupCollect
+}
+
+// standupMessage builds a direct message to a member of a standup
+func standupMessage(userID string) models.Message {
+	message := models.NewMessage()
+	message.Service = models.MsgServiceChat
+	message.Type = models.MsgTypeDirect
+	message.DirectMessageOnly = true
+	message.Vars["_user.id"] = userID
+	return message
+}
+
+// mentionUser mentions a user by ID, so they get notified
+func mentionUser(userID string) string {
+	return "<@" + userID + ">"
+}
+
+// mentionUsers mentions users by ID
+func mentionUsers(userIDs []string) []string {
+	mentions := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		mentions[i] = mentionUser(userID)
+	}
+	return mentions
+}
+
+// getStandupRun looks up the open run of a standup
+func getStandupRun(name string, bot *models.Bot) (standupRun, bool, error) {
+	var run standupRun
+	value, ok, err := bot.Store.Get(standupRunsBucket, name)
+	if err != nil || !ok {
+		return run, false, err
+	}
+	if err := json.Unmarshal(value, &run); err != nil {
+		return run, false, err
+	}
+	return run, true, nil
+}
+
+// setStandupRun stores the open run of a standup
+func setStandupRun(name string, run standupRun, bot *models.Bot) error {
+	value, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return bot.Store.Set(standupRunsBucket, name, value, 0)
+}
+
+// getStandupAnswers looks up what a member answered in a standup's run
+func getStandupAnswers(name, userID string, bot *models.Bot) (standupAnswers, bool, error) {
+	var answers standupAnswers
+	value, ok, err := bot.Store.Get(standupAnswersBucket, name+"/"+userID)
+	if err != nil || !ok {
+		return answers, false, err
+	}
+	if err := json.Unmarshal(value, &answers); err != nil {
+		return answers, false, err
+	}
+	return answers, true, nil
+}
+
+// setStandupAnswers stores what a member answered in a standup's run; answers left behind by a run
+// that's never posted expire
+func setStandupAnswers(name, userID string, answers standupAnswers, ttl time.Duration, bot *models.Bot) error {
+	value, err := json.Marshal(answers)
+	if err != nil {
+		return err
+	}
+	return bot.Store.Set(standupAnswersBucket, name+"/"+userID, value, ttl+time.Hour)
+}
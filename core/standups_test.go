@@ -0,0 +1,95 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestStandups(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), Modules: []string{moduleStandups}, Rooms: map[string]string{"team": "C1"}}
+	testBot.Standups = []models.Standup{{Channel: "team", Members: []string{"U1", "U2", "U3"}, Questions: []string{"Yesterday?", "Today?"}}}
+	initLogger(testBot)
+
+	outputMsgs := make(chan models.Message, 10)
+	hitRule := make(chan models.Rule, 10)
+	sent := func() []string {
+		outputs := []string{}
+		for {
+			select {
+			case m := <-outputMsgs:
+				<-hitRule
+				to := m.Vars["_user.id"]
+				if len(m.OutputToRooms) > 0 {
+					to = m.OutputToRooms[0]
+				}
+				outputs = append(outputs, to+": "+m.Output)
+			default:
+				return outputs
+			}
+		}
+	}
+	answer := func(user, text string) bool {
+		m := standupMessage(user)
+		m.Event = models.MsgEventSent
+		m.Input = text
+		return answerStandup(m, outputMsgs, hitRule, testBot)
+	}
+	now := time.Date(2019, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	away := standupMessage("U3")
+	if output, err := standupVacation("2019-05-03", away, testBot, now); err != nil || output != "Enjoy! I won't ask you for standups until 2019-05-04 00:00 UTC." {
+		t.Errorf("standupVacation() = %q, %v", output, err)
+	}
+
+	startStandup(testBot.Standups[0], now, outputMsgs, hitRule, testBot)
+	assertOutputs(t, "startStandup()", sent(), []string{
+		"U1: Time for the team standup! Answer 'skip' to skip it this time.\n\nYesterday?",
+		"U2: Time for the team standup! Answer 'skip' to skip it this time.\n\nYesterday?",
+	})
+
+	if answer("U1", "standup optout") || answer("U3", "Fixed the build") {
+		t.Errorf("answerStandup() took a command, or an answer from a member who wasn't asked")
+	}
+	answer("U1", "Fixed the build")
+	answer("U1", "Reviews")
+	assertOutputs(t, "answerStandup()", sent(), []string{"U1: Today?", "U1: Thanks! I'll share your answers in the standup summary."})
+
+	// The last answer posts the summary right away
+	answer("U2", "skip")
+	assertOutputs(t, "answerStandup()", sent(), []string{
+		"U2: Okay, skipping this one.",
+		"C1: *team standup*\n\n<@U1>\n_Yesterday?_\nFixed the build\n_Today?_\nReviews\n\nSkipped: <@U2>\n\nAway: <@U3>",
+	})
+	if answer("U1", "More") {
+		t.Errorf("answerStandup() took an answer after the summary was posted")
+	}
+
+	// Standups start on their schedule, and are posted when their time is up
+	schedule, _ := cron.Parse("0 0 9 * * *")
+	standupBackCommand(nil, &away, outputMsgs, nil, hitRule, testBot)
+	checkStandups(now.Add(23*time.Hour+59*time.Minute), now.Add(24*time.Hour+time.Minute), []cron.Schedule{schedule}, outputMsgs, hitRule, testBot)
+	if got := sent(); len(got) != 3 {
+		t.Errorf("checkStandups() sent %q, want 3 questions", got)
+	}
+	answer("U3", "Vacation")
+	sent()
+	checkStandups(now.Add(26*time.Hour), now.Add(27*time.Hour), []cron.Schedule{schedule}, outputMsgs, hitRule, testBot)
+	assertOutputs(t, "checkStandups()", sent(), []string{"C1: *team standup*\n\n<@U3>\n_Yesterday?_\nVacation\n\nNo update from: <@U1>, <@U2>"})
+}
+
+func assertOutputs(t *testing.T, name string, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s sent %q, want %q", name, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s sent %q, want %q", name, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/audit"
+	"github.com/target/flottbot/models"
+)
+
+// statsBucket is the storage bucket of the usage stats of rules, by rule and day
+const statsBucket = "rule-stats"
+
+// statsRetention is how long the usage stats of a day are kept
+const statsRetention = 90 * 24 * time.Hour
+
+// statsDays is how many days 'bot stats' and the export cover, unless they're told otherwise
+const statsDays = 7
+
+// statsSamples is how many durations of runs a day keeps to work out the p95 latency from
+const statsSamples = 500
+
+// statsMu keeps runs of rules from updating the same day of stats at once
+var statsMu sync.Mutex
+
+// dayStats is how a rule was used on a day
+type dayStats struct {
+	Runs      int             `json:"runs"`
+	Failures  int             `json:"failures"`
+	Rejected  int             `json:"rejected"`
+	Helpful   int             `json:"helpful,omitempty"` // feedback on the rule's answers, see 'feedback'
+	Unhelpful int             `json:"unhelpful,omitempty"`
+	Users     map[string]bool `json:"users"`
+	Channels  map[string]bool `json:"channels"`
+	Durations []int64         `json:"durations"` // a sample of the runs' durations, in milliseconds
+}
+
+// ruleStats is how a rule was used over some days
+type ruleStats struct {
+	Rule        string  `json:"rule"`
+	Runs        int     `json:"runs"`
+	Failures    int     `json:"failures"`
+	Rejected    int     `json:"rejected"`
+	FailureRate float64 `json:"failure_rate"` // of the runs
+	Users       int     `json:"users"`
+	Channels    int     `json:"channels"`
+	P95MS       int64   `json:"p95_ms"`
+	Helpful     int     `json:"helpful"`
+	Unhelpful   int     `json:"unhelpful"`
+}
+
+func init() {
+	builtinCommands = append(builtinCommands,
+		builtinCommand{trigger: "bot stats", usage: "bot stats [days]", description: "Show how much each rule was used lately, and which weren't", run: statsCommand},
+	)
+}
+
+// recordRuleStats counts a run of a rule in its usage stats, with 'rule_stats' in bot.yml. Runs
+// that were rejected, e.g. for users who aren't allowed to run the rule, are counted apart.
+func recordRuleStats(status string, rule models.Rule, message models.Message, actions []audit.ActionResult, start time.Time, bot *models.Bot) {
+	if !bot.RuleStats || bot.Store == nil || len(rule.Name) == 0 {
+		return
+	}
+	updateDayStats(rule.Name, start, bot, func(day *dayStats) {
+		if status == audit.StatusRejected {
+			day.Rejected++
+		} else {
+			day.Runs++
+			if failed(actions) {
+				day.Failures++
+			}
+			// Keep a uniform sample of the durations, so busy rules don't grow their stats forever
+			duration := int64(time.Since(start) / time.Millisecond)
+			if len(day.Durations) < statsSamples {
+				day.Durations = append(day.Durations, duration)
+			} else if i := rand.Intn(day.Runs); i < statsSamples {
+				day.Durations[i] = duration
+			}
+		}
+		if user := message.Vars["_user.id"]; len(user) > 0 {
+			day.Users[user] = true
+		}
+		if len(message.ChannelID) > 0 && message.Type != models.MsgTypeDirect {
+			day.Channels[message.ChannelID] = true
+		}
+	})
+}
+
+// updateDayStats changes the usage stats of a rule on the day of a time
+func updateDayStats(rule string, t time.Time, bot *models.Bot, update func(day *dayStats)) {
+	key := statsKey(rule, t)
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	day := dayStats{}
+	if value, ok, err := bot.Store.Get(statsBucket, key); err == nil && ok {
+		json.Unmarshal(value, &day)
+	}
+	if day.Users == nil {
+		day.Users = make(map[string]bool)
+	}
+	if day.Channels == nil {
+		day.Channels = make(map[string]bool)
+	}
+	update(&day)
+
+	value, err := json.Marshal(day)
+	if err == nil {
+		err = bot.Store.Set(statsBucket, key, value, statsRetention)
+	}
+	if err != nil {
+		bot.Log.Errorf("Could not record the usage of rule '%s': %s", rule, err.Error())
+	}
+}
+
+// failed determines whether an action of a run of a rule failed
+func failed(actions []audit.ActionResult) bool {
+	for _, action := range actions {
+		if len(action.Error) > 0 || action.Aborted {
+			return true
+		}
+	}
+	return false
+}
+
+// usageStats adds up the usage stats of the rules over the days up to now, busiest first. Active
+// rules that weren't used are included, with no runs. The caller holds the rules for reading, like
+// the Matcher does when it runs 'bot stats'.
+func usageStats(days int, now time.Time, rules map[string]models.Rule, bot *models.Bot) ([]ruleStats, error) {
+	stored, err := bot.Store.List(statsBucket)
+	if err != nil {
+		return nil, err
+	}
+	since := now.UTC().AddDate(0, 0, -days+1).Format("2006-01-02")
+	totals := make(map[string]*ruleStats)
+	users := make(map[string]map[string]bool)
+	channels := make(map[string]map[string]bool)
+	durations := make(map[string][]int64)
+	total := func(name string) *ruleStats {
+		if _, ok := totals[name]; !ok {
+			totals[name] = &ruleStats{Rule: name}
+			users[name] = make(map[string]bool)
+			channels[name] = make(map[string]bool)
+		}
+		return totals[name]
+	}
+
+	for _, rule := range rules {
+		if rule.Active {
+			total(rule.Name)
+		}
+	}
+
+	for key, value := range stored {
+		i := strings.LastIndex(key, "/")
+		if i < 0 || key[i+1:] < since {
+			continue
+		}
+		var day dayStats
+		if err := json.Unmarshal(value, &day); err != nil {
+			continue
+		}
+		name := key[:i]
+		t := total(name)
+		t.Runs += day.Runs
+		t.Failures += day.Failures
+		t.Rejected += day.Rejected
+		t.Helpful += day.Helpful
+		t.Unhelpful += day.Unhelpful
+		for user := range day.Users {
+			users[name][user] = true
+		}
+		for channel := range day.Channels {
+			channels[name][channel] = true
+		}
+		durations[name] = append(durations[name], day.Durations...)
+	}
+
+	stats := []ruleStats{}
+	for name, t := range totals {
+		t.Users, t.Channels = len(users[name]), len(channels[name])
+		if t.Runs > 0 {
+			t.FailureRate = float64(t.Failures) / float64(t.Runs)
+		}
+		t.P95MS = percentile(durations[name], 95)
+		stats = append(stats, *t)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Runs != stats[j].Runs {
+			return stats[i].Runs > stats[j].Runs
+		}
+		return stats[i].Rule < stats[j].Rule
+	})
+	return stats, nil
+}
+
+// percentile is the p-th percentile of durations, by the nearest rank
+func percentile(durations []int64, p int) int64 {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]int64{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// statsCommand shows the usage stats of the rules over the last days, 7 unless the first argument
+// says otherwise, e.g. 'bot stats 30'
+func statsCommand(args []string, message *models.Message, outputMsgs chan<- models.Message, rules map[string]models.Rule, hitRule chan<- models.Rule, bot *models.Bot) (string, error) {
+	if !bot.RuleStats {
+		return translate(*message, bot, "stats.off", "Usage stats of rules aren't kept, set 'rule_stats' in bot.yml to keep them.", nil), nil
+	}
+	days, err := parseStatsDays(args)
+	if err != nil {
+		return translate(*message, bot, "stats.usage", "Tell me how many days to look back, e.g. 'bot stats 30'.", nil), nil
+	}
+	stats, err := usageStats(days, time.Now(), rules, bot)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{translate(*message, bot, "stats.header", "Rules in the last ${days} days, busiest first:", map[string]string{"days": strconv.Itoa(days)}), ""}
+	unused := []string{}
+	for _, s := range stats {
+		if s.Runs == 0 && s.Rejected == 0 {
+			unused = append(unused, s.Rule)
+			continue
+		}
+		lines = append(lines, translate(*message, bot, "stats.rule", " • ${rule}: ${runs} runs by ${users} users in ${channels} channels, ${failures}% failed, p95 ${p95}", map[string]string{
+			"rule":     s.Rule,
+			"runs":     strconv.Itoa(s.Runs),
+			"users":    strconv.Itoa(s.Users),
+			"channels": strconv.Itoa(s.Channels),
+			"failures": strconv.FormatFloat(s.FailureRate*100, 'f', 1, 64),
+			"p95":      (time.Duration(s.P95MS) * time.Millisecond).String(),
+		}))
+	}
+	if len(lines) == 2 {
+		lines = lines[:1]
+	}
+	if len(unused) > 0 {
+		lines = append(lines, "", translate(*message, bot, "stats.unused", "Not used: ${rules}", map[string]string{"rules": strings.Join(unused, ", ")}))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// parseStatsDays parses how many days the stats cover, e.g. '30' or '30d'
+func parseStatsDays(args []string) (int, error) {
+	if len(args) == 0 || len(args[0]) == 0 {
+		return statsDays, nil
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(args[0], "d"))
+	if err != nil || days < 1 {
+		return 0, fmt.Errorf("Invalid number of days '%s'", args[0])
+	}
+	return days, nil
+}
+
+// statsCSV lays out usage stats as the rows of a CSV file, with a header row
+func statsCSV(stats []ruleStats) [][]string {
+	rows := [][]string{{"rule", "runs", "failures", "rejected", "failure_rate", "users", "channels", "p95_ms", "helpful", "unhelpful"}}
+	for _, s := range stats {
+		rows = append(rows, []string{
+			s.Rule,
+			strconv.Itoa(s.Runs),
+			strconv.Itoa(s.Failures),
+			strconv.Itoa(s.Rejected),
+			strconv.FormatFloat(s.FailureRate, 'f', 4, 64),
+			strconv.Itoa(s.Users),
+			strconv.Itoa(s.Channels),
+			strconv.FormatInt(s.P95MS, 10),
+			strconv.Itoa(s.Helpful),
+			strconv.Itoa(s.Unhelpful),
+		})
+	}
+	return rows
+}
+
+// statsKey is where the stats of a rule on the day of a time are stored
+func statsKey(rule string, t time.Time) string {
+	return rule + "/" + t.UTC().Format("2006-01-02")
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/audit"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestUsageStats(t *testing.T) {
+	testBot := &models.Bot{Store: memory.New(), RuleStats: true, AdminAPIToken: "secret"}
+	initLogger(testBot)
+	rules := map[string]models.Rule{
+		"deploy.yml": {Name: "deploy", Active: true},
+		"status.yml": {Name: "status", Active: true},
+		"old.yml":    {Name: "old", Active: true},
+		"off.yml":    {Name: "off"},
+	}
+
+	run := func(rule, user, channel string, took time.Duration, status string, actions ...audit.ActionResult) {
+		message := models.NewMessage()
+		message.Type = models.MsgTypeChannel
+		message.ChannelID = channel
+		message.Vars["_user.id"] = user
+		recordRuleStats(status, models.Rule{Name: rule}, message, actions, time.Now().Add(-took), testBot)
+	}
+	for i := 1; i <= 20; i++ {
+		run("deploy", "jane", "C1", time.Duration(i)*100*time.Millisecond, audit.StatusCompleted)
+	}
+	run("deploy", "joe", "C2", time.Second, audit.StatusCompleted, audit.ActionResult{Name: "ship", Error: "Timed out"})
+	run("deploy", "mallory", "C2", 0, audit.StatusRejected)
+	run("status", "joe", "C1", 10*time.Millisecond, audit.StatusCompleted)
+	// Days before the ones asked for aren't included
+	testBot.Store.Set(statsBucket, statsKey("old", time.Now().AddDate(0, 0, -10)), []byte(`{"runs":5}`), 0)
+
+	stats, err := usageStats(7, time.Now(), rules, testBot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 3 {
+		t.Fatalf("usageStats() = %+v, want deploy, status, and old", stats)
+	}
+	deploy := stats[0]
+	if deploy.Rule != "deploy" || deploy.Runs != 21 || deploy.Failures != 1 || deploy.Rejected != 1 || deploy.Users != 3 || deploy.Channels != 2 {
+		t.Errorf("usageStats() deploy = %+v", deploy)
+	}
+	if deploy.P95MS < 1850 || deploy.P95MS > 1950 {
+		t.Errorf("usageStats() deploy p95 = %dms, want about 1.9s", deploy.P95MS)
+	}
+	if stats[1].Rule != "status" || stats[2].Rule != "old" || stats[2].Runs != 0 {
+		t.Errorf("usageStats() = %+v, want status, then old with no runs", stats)
+	}
+
+	message := models.NewMessage()
+	output, err := statsCommand(nil, &message, nil, rules, nil, testBot)
+	if err != nil || !strings.Contains(output, " • deploy: 21 runs by 3 users in 2 channels, 4.8% failed, p95 1.9s") || !strings.HasSuffix(output, "Not used: old") {
+		t.Errorf("statsCommand() = %q, %v", output, err)
+	}
+
+	router := adminRouter(make(chan models.Message), make(chan models.Message), rules, testBot)
+	req := httptest.NewRequest("GET", "/admin/stats?days=7&format=csv", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if rec.Code != http.StatusOK || len(lines) != 4 || lines[0] != "rule,runs,failures,rejected,failure_rate,users,channels,p95_ms,helpful,unhelpful" || !strings.HasPrefix(lines[1], "deploy,21,1,1,0.0476,3,2,") {
+		t.Errorf("GET /admin/stats = %d %q", rec.Code, lines)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []int64
+		want      int64
+	}{
+		{"None", nil, 0},
+		{"One", []int64{7}, 7},
+		{"Unsorted", []int64{5, 1, 4, 2, 3}, 5},
+		{"Hundred", func() []int64 {
+			d := []int64{}
+			for i := int64(100); i > 0; i-- {
+				d = append(d, i)
+			}
+			return d
+		}(), 95},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.durations, 95); got != tt.want {
+				t.Errorf("percentile() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// templatesMu guards outputTemplates, which are read again when the rules are reloaded
+var templatesMu sync.RWMutex
+
+// outputTemplates are the templates rules can show their output with, keyed by lowercased name
+var outputTemplates = map[string]models.Template{}
+
+// loadTemplates reads the templates directory, next to the rules directory, and replaces the templates
+// rules can refer to. Having no templates directory is fine; the templates are left untouched if any
+// template fails to parse.
+func loadTemplates(bot *models.Bot) error {
+	templatesDir := path.Join(configDir(bot), "templates")
+	if _, err := os.Stat(templatesDir); err != nil {
+		bot.Log.Debug("No templates directory found")
+		return nil
+	}
+
+	loaded, problems := readTemplatesDir(templatesDir, false)
+	if len(problems) > 0 {
+		errs := make([]string, len(problems))
+		for i, problem := range problems {
+			errs[i] = problem.String()
+		}
+		return fmt.Errorf("Could not parse templates: %s", strings.Join(errs, "; "))
+	}
+
+	templatesMu.Lock()
+	outputTemplates = loaded
+	templatesMu.Unlock()
+
+	bot.Log.Infof("Loaded %d template(s)", len(loaded))
+	return nil
+}
+
+// readTemplatesDir parses every template file in a directory, keyed by lowercased template name.
+// Strictly parsing also reports settings that templates don't have.
+func readTemplatesDir(searchDir string, strict bool) (map[string]models.Template, []Problem) {
+	fileList := []string{}
+	filepath.Walk(searchDir, func(path string, f os.FileInfo, err error) error {
+		if err == nil && !f.IsDir() {
+			fileList = append(fileList, path)
+		}
+		return nil
+	})
+	sort.Strings(fileList)
+
+	templates := make(map[string]models.Template)
+	problems := []Problem{}
+	files := make(map[string]string)
+	for _, templateFile := range fileList {
+		conf := viper.New()
+		conf.SetConfigFile(templateFile)
+		if err := conf.ReadInConfig(); err != nil {
+			problems = append(problems, Problem{File: templateFile, Message: err.Error()})
+			continue
+		}
+		tmpl := models.Template{}
+		for _, problem := range decodeSettings(conf.AllSettings(), &tmpl, strict) {
+			problems = append(problems, Problem{File: templateFile, Message: problem})
+		}
+		switch key := strings.ToLower(tmpl.Name); {
+		case len(key) == 0:
+			problems = append(problems, Problem{File: templateFile, Message: "Template has no name"})
+		case len(files[key]) > 0:
+			problems = append(problems, Problem{File: templateFile, Message: fmt.Sprintf("Another template has the same name, in %s", files[key])})
+		default:
+			files[key] = templateFile
+			templates[key] = tmpl
+		}
+	}
+	return templates, problems
+}
+
+// renderTemplate fills in the template a rule refers to. Its parameters are filled in with the message's
+// variables first; the template's text can refer to both its parameters and the message's variables.
+func renderTemplate(ref models.TemplateRef, message models.Message, bot *models.Bot) (string, error) {
+	templatesMu.RLock()
+	tmpl, ok := outputTemplates[strings.ToLower(ref.Name)]
+	templatesMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("Could not find a template named '%s'", ref.Name)
+	}
+
+	vars := make(map[string]string, len(message.Vars)+len(tmpl.Params))
+	for name, value := range message.Vars {
+		vars[name] = value
+	}
+	params := templateParams(ref)
+	for _, param := range tmpl.Params {
+		value, passed := params[strings.ToLower(param.Name)]
+		if !passed {
+			if param.Required {
+				return "", fmt.Errorf("Template '%s' needs the parameter '%s'", tmpl.Name, param.Name)
+			}
+			value = param.Default
+		}
+		value, err := utils.Substitute(value, message.Vars)
+		if err != nil {
+			return "", fmt.Errorf("Could not fill in parameter '%s' of template '%s': %s", param.Name, tmpl.Name, err.Error())
+		}
+		vars[param.Name] = value
+	}
+
+	return utils.Substitute(translateRefs(tmpl.Text, message, bot), vars)
+}
+
+// templateParams are the parameters a rule passes to a template, keyed by lowercased name like the
+// parameters read from rule files
+func templateParams(ref models.TemplateRef) map[string]string {
+	params := make(map[string]string, len(ref.Params))
+	for name, value := range ref.Params {
+		params[strings.ToLower(name)] = value
+	}
+	return params
+}
+
+// validateTemplates checks that the templates rules refer to exist, and get the parameters they need
+func validateTemplates(rules map[string]models.Rule, templates map[string]models.Template) []Problem {
+	ruleFiles := []string{}
+	for ruleFile := range rules {
+		ruleFiles = append(ruleFiles, ruleFile)
+	}
+	sort.Strings(ruleFiles)
+
+	problems := []Problem{}
+	for _, ruleFile := range ruleFiles {
+		rule := rules[ruleFile]
+		if len(rule.Template.Name) == 0 {
+			continue
+		}
+		report := func(format string, args ...interface{}) {
+			problems = append(problems, Problem{File: ruleFile, Rule: rule.Name, Message: fmt.Sprintf(format, args...)})
+		}
+		tmpl, ok := templates[strings.ToLower(rule.Template.Name)]
+		if !ok {
+			report("Refers to template '%s', which doesn't exist", rule.Template.Name)
+			continue
+		}
+		params := templateParams(rule.Template)
+		known := make(map[string]bool, len(tmpl.Params))
+		for _, param := range tmpl.Params {
+			known[strings.ToLower(param.Name)] = true
+			if _, passed := params[strings.ToLower(param.Name)]; param.Required && !passed {
+				report("Doesn't pass the parameter '%s' that template '%s' needs", param.Name, tmpl.Name)
+			}
+		}
+		names := []string{}
+		for name := range params {
+			if !known[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			report("Passes the parameter '%s', which template '%s' doesn't have", name, tmpl.Name)
+		}
+	}
+	return problems
+}
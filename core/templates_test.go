@@ -0,0 +1,79 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flottbot-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "templates"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "templates", "deploy.yml"), []byte("name: deploy\nparams:\n  - name: app\n    required: true\n  - name: env\n    default: production\ntext: '${app} went to ${env}, thanks ${_user.name}'\n"), 0644)
+
+	bot := &models.Bot{ConfigDir: dir}
+	initLogger(bot)
+	if err := loadTemplates(bot); err != nil {
+		t.Fatalf("loadTemplates() error = %v", err)
+	}
+	defer func() { outputTemplates = map[string]models.Template{} }()
+
+	message := models.NewMessage()
+	message.Vars["app"] = "api"
+	message.Vars["_user.name"] = "jane"
+
+	tests := []struct {
+		name    string
+		rule    models.Rule
+		want    string
+		wantErr bool
+	}{
+		{"Default", models.Rule{Template: models.TemplateRef{Name: "deploy", Params: map[string]string{"app": "${app}"}}}, "api went to production, thanks jane", false},
+		{"Passed", models.Rule{Template: models.TemplateRef{Name: "Deploy", Params: map[string]string{"app": "web", "env": "staging"}}}, "web went to staging, thanks jane", false},
+		{"Shown in format_output", models.Rule{FormatOutput: ":rocket: ${_template}", Template: models.TemplateRef{Name: "deploy", Params: map[string]string{"app": "web"}}}, ":rocket: web went to production, thanks jane", false},
+		{"Missing parameter", models.Rule{Template: models.TemplateRef{Name: "deploy"}}, "", true},
+		{"Unknown template", models.Rule{Template: models.TemplateRef{Name: "incident"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := craftResponse(tt.rule, message, bot)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("craftResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("craftResponse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	templates := map[string]models.Template{"deploy": {Name: "deploy", Params: []models.TemplateParam{{Name: "app", Required: true}, {Name: "env"}}}}
+	rules := map[string]models.Rule{
+		"ok.yml":      {Name: "ok", Template: models.TemplateRef{Name: "deploy", Params: map[string]string{"app": "api"}}},
+		"missing.yml": {Name: "missing", Template: models.TemplateRef{Name: "deploy", Params: map[string]string{"region": "us"}}},
+		"unknown.yml": {Name: "unknown", Template: models.TemplateRef{Name: "incident"}},
+		"none.yml":    {Name: "none"},
+	}
+
+	got := []string{}
+	for _, problem := range validateTemplates(rules, templates) {
+		got = append(got, problem.String())
+	}
+	want := []string{
+		"missing.yml: rule 'missing': Doesn't pass the parameter 'app' that template 'deploy' needs",
+		"missing.yml: rule 'missing': Passes the parameter 'region', which template 'deploy' doesn't have",
+		"unknown.yml: rule 'unknown': Refers to template 'incident', which doesn't exist",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("validateTemplates() = %q, want %q", got, want)
+	}
+}
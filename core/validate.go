@@ -0,0 +1,712 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nlopes/slack"
+	"github.com/robfig/cron"
+	"github.com/spf13/viper"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/utils"
+)
+
+// actionTypes are the supported action types (see runAction)
+var actionTypes = map[string]bool{
+	"get": true, "post": true, "put": true, "llm": true, "sql": true, "publish": true,
+	"prometheus": true, "silence": true, "grafana": true, "oncall": true, "email": true,
+	"ssh": true, "call_rule": true, "exec": true, "message": true, "log": true, "wait": true,
+}
+
+// varRefPattern finds the variables a rule refers to, e.g. ${name} or ${name | upper}.
+// System variables (${_user.name}), memory (${memory.key}), and translations (${t:key}) aren't included.
+var varRefPattern = regexp.MustCompile(`\$\{\s*([A-Za-z][A-Za-z0-9_\-]*)\s*(?:\||\})`)
+
+// envVarName is what environment variables, which rules may refer to as well, are usually named like
+var envVarName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// Problem is something wrong with a bot's configuration or rules, found by Validate
+type Problem struct {
+	File    string `json:"file"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// String describes the problem, e.g. for printing it
+func (p Problem) String() string {
+	if len(p.Rule) > 0 {
+		return fmt.Sprintf("%s: rule '%s': %s", p.File, p.Rule, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.File, p.Message)
+}
+
+// Validate checks a bot's configuration (as read from configFile) and all of its rules without
+// running the bot, e.g. in the CI pipeline of a rules repository. It finds unknown or mistyped
+// settings, required environment variables that aren't set, rule files written for older schema
+// versions, bad regexes, variables a rule refers to but never gets, duplicate triggers, and rules
+// that can never run.
+func Validate(settings map[string]interface{}, configFile string, bot *models.Bot) []Problem {
+	problems := validateBot(settings, configFile, bot)
+	return append(problems, validateRules(bot)...)
+}
+
+// validateBot checks a bot's configuration
+func validateBot(settings map[string]interface{}, configFile string, bot *models.Bot) []Problem {
+	problems := []Problem{}
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, Problem{File: configFile, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, err := range decodeStrict(settings, &models.Bot{}) {
+		add("%s", err)
+	}
+	if err := utils.ExpandEnv(bot, true); err != nil {
+		add("%s", err.Error())
+	}
+
+	switch strings.ToLower(bot.ChatApplication) {
+	case "", "slack", "discord", "mock":
+	default:
+		add("Chat application '%s' is not supported", bot.ChatApplication)
+	}
+	switch strings.ToLower(bot.MatchMode) {
+	case "", matchModeFirst, matchModeAll:
+	default:
+		add("Unknown match_mode '%s', use '%s' or '%s'", bot.MatchMode, matchModeFirst, matchModeAll)
+	}
+	switch strings.ToLower(bot.InputQueueOverflow) {
+	case "", overflowBlock, overflowDropOldest, overflowReject:
+	default:
+		add("Unknown input_queue_overflow '%s', use '%s', '%s', or '%s'", bot.InputQueueOverflow, overflowBlock, overflowDropOldest, overflowReject)
+	}
+	for _, module := range bot.Modules {
+		switch strings.ToLower(module) {
+		case moduleKarma, modulePolls, moduleReminders, moduleIncidents, moduleStandups, moduleAutoResponders:
+		default:
+			add("Unknown module '%s', use '%s', '%s', '%s', '%s', '%s', or '%s'", module, moduleKarma, modulePolls, moduleReminders, moduleIncidents, moduleStandups, moduleAutoResponders)
+		}
+	}
+	standups := make(map[string]bool, len(bot.Standups))
+	for i, standup := range bot.Standups {
+		if len(standup.Channel) == 0 {
+			add("Standup %d has no 'channel'", i+1)
+		}
+		if _, err := cron.Parse(standup.Schedule); err != nil {
+			add("Invalid schedule '%s' of standup %d: %s", standup.Schedule, i+1, err.Error())
+		}
+		if d, err := utils.ParseDuration(standup.Collect); len(standup.Collect) > 0 && (err != nil || d <= 0) {
+			add("Invalid collect '%s' of standup %d, use a duration like '2h'", standup.Collect, i+1)
+		}
+		if name := strings.ToLower(standupName(standup)); standups[name] && len(name) > 0 {
+			add("Standup %d has the same name as another, set a 'name'", i+1)
+		} else {
+			standups[name] = true
+		}
+	}
+	digests := make(map[string]bool, len(bot.Digests))
+	for i, digest := range bot.Digests {
+		switch name := strings.ToLower(digest.Name); {
+		case len(name) == 0:
+			add("Digest %d has no 'name'", i+1)
+		case digests[name]:
+			add("Digest %d has the same name as another", i+1)
+		default:
+			digests[name] = true
+		}
+		if len(digest.Channel) == 0 {
+			add("Digest %d has no 'channel'", i+1)
+		}
+		if _, err := cron.Parse(digest.Schedule); err != nil {
+			add("Invalid schedule '%s' of digest %d: %s", digest.Schedule, i+1, err.Error())
+		}
+		if _, err := time.LoadLocation(digest.Timezone); err != nil {
+			add("Unknown timezone '%s' of digest %d", digest.Timezone, i+1)
+		}
+		if digest.MaxItems < 0 {
+			add("Invalid max_items %d of digest %d", digest.MaxItems, i+1)
+		}
+	}
+	if report := bot.FeedbackReport; len(report.Channel) == 0 && (len(report.Schedule) > 0 || report.Days != 0) {
+		add("The feedback_report has no 'channel'")
+	} else if len(report.Channel) > 0 {
+		if _, err := cron.Parse(feedbackReportSchedule(report)); err != nil {
+			add("Invalid schedule '%s' of the feedback_report: %s", report.Schedule, err.Error())
+		}
+		if report.Days < 0 {
+			add("Invalid days %d of the feedback_report", report.Days)
+		}
+	}
+	shorthands := make([]string, 0, len(bot.CommandAliases))
+	for shorthand := range bot.CommandAliases {
+		shorthands = append(shorthands, shorthand)
+	}
+	sort.Strings(shorthands)
+	for _, shorthand := range shorthands {
+		if len(strings.TrimSpace(bot.CommandAliases[shorthand])) == 0 {
+			add("Command alias '%s' has no command", shorthand)
+		}
+	}
+	for i, prefix := range bot.MentionPrefixes {
+		if len(strings.TrimSpace(prefix)) == 0 {
+			add("Mention prefix %d is empty", i+1)
+		}
+	}
+	if _, err := inOfficeHours(bot.AutoResponders.OfficeHours, time.Now()); err != nil {
+		add("Invalid office_hours of auto_responders: %s", err.Error())
+	}
+	for i, channel := range bot.AutoResponders.Channels {
+		if len(channel.Channel) == 0 {
+			add("Auto-responder %d has no 'channel'", i+1)
+		}
+		if _, err := inOfficeHours(channel.OfficeHours, time.Now()); err != nil {
+			add("Invalid office_hours of auto-responder %d: %s", i+1, err.Error())
+		}
+		for j, answer := range channel.Answers {
+			if len(answer.Keywords) == 0 || (len(answer.Answer) == 0 && len(answer.AfterHours) == 0) {
+				add("Answer %d of auto-responder %d needs 'keywords', and an 'answer' or 'after_hours'", j+1, i+1)
+			}
+		}
+	}
+	if bot.Protection.FloodMessages < 0 {
+		add("Invalid flood_messages %d of protection", bot.Protection.FloodMessages)
+	}
+	for _, setting := range [][2]string{
+		{"slack_user_cache_ttl", bot.SlackUserCacheTTL},
+		{"shutdown_timeout", bot.ShutdownTimeout},
+		{"circuit_breaker_cooldown", bot.CircuitBreakerCooldown},
+		{"heartbeat interval", bot.Heartbeat.Interval},
+		{"heartbeat silence", bot.Heartbeat.Silence},
+		{"protection flood_window", bot.Protection.FloodWindow},
+		{"protection ignore_for", bot.Protection.IgnoreFor},
+	} {
+		if len(setting[1]) == 0 {
+			continue
+		}
+		if _, err := utils.ParseDuration(setting[1]); err != nil {
+			add("Invalid %s '%s': %s", setting[0], setting[1], err.Error())
+		}
+	}
+	for i, key := range bot.StorageEncryptionKeys {
+		// Keys kept in a secrets manager or the environment are checked when the bot starts
+		if strings.Contains(key, ":") || strings.Contains(key, "${") {
+			continue
+		}
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key)); err != nil || (len(decoded) != 16 && len(decoded) != 24 && len(decoded) != 32) {
+			add("Invalid storage encryption key #%d, use 16, 24, or 32 base64 encoded bytes", i+1)
+		}
+	}
+	for _, pattern := range bot.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			add("Invalid redact pattern '%s': %s", pattern, err.Error())
+		}
+	}
+	for i, conf := range bot.InputMiddleware {
+		if _, err := newInputMiddleware(conf); err != nil {
+			add("Invalid input_middleware %d: %s", i+1, err.Error())
+		}
+	}
+	for i, conf := range bot.OutputMiddleware {
+		if _, err := newOutputMiddleware(conf); err != nil {
+			add("Invalid output_middleware %d: %s", i+1, err.Error())
+		}
+	}
+	for i, bridge := range bot.Bridges {
+		if len(bridge.Channel) == 0 {
+			add("Bridge %d has no 'channel'", i+1)
+		}
+		if len(bridge.To) == 0 {
+			add("Bridge %d relays to no channels, set 'to'", i+1)
+		}
+		for k, target := range bridge.To {
+			if len(target.Channel) == 0 {
+				add("Bridge %d: target %d has no 'channel'", i+1, k+1)
+			}
+		}
+	}
+	remotes := make([]string, 0, len(bot.OutputLimits))
+	for remote := range bot.OutputLimits {
+		remotes = append(remotes, remote)
+	}
+	sort.Strings(remotes)
+	for _, remote := range remotes {
+		limit := bot.OutputLimits[remote]
+		if limit.MaxLength < 0 {
+			add("Invalid output_limits max_length %d for '%s', it must be at least 1", limit.MaxLength, remote)
+		}
+		switch strings.ToLower(limit.Policy) {
+		case "", outputSplit, outputThread, outputTruncate:
+		default:
+			add("Invalid output_limits policy '%s' for '%s', use '%s', '%s', or '%s'", limit.Policy, remote, outputSplit, outputThread, outputTruncate)
+		}
+	}
+	servers := []string{}
+	for server := range bot.HTTPAuth {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	for _, server := range servers {
+		auth := bot.HTTPAuth[server]
+		known := false
+		for _, name := range remote.ServerNames {
+			known = known || name == server
+		}
+		if !known {
+			add("Unknown http_auth server '%s', use 'events', 'interactions', 'admin', 'health', 'metrics', or 'all'", server)
+		}
+		if _, err := remote.ParseNetworks(auth.AllowIPs); err != nil {
+			add("Invalid http_auth allow_ips for '%s': %s", server, err.Error())
+		}
+		if _, err := remote.ParseNetworks(auth.TrustedProxies); err != nil {
+			add("Invalid http_auth trusted_proxies for '%s': %s", server, err.Error())
+		}
+		if (len(auth.Username) > 0) != (len(auth.Password) > 0) {
+			add("Invalid http_auth for '%s', set both 'username' and 'password'", server)
+		}
+		switch strings.ToLower(auth.HMACAlgorithm) {
+		case "", "sha1", "sha256", "sha512":
+		default:
+			add("Invalid http_auth hmac_algorithm '%s' for '%s', use 'sha256', 'sha1', or 'sha512'", auth.HMACAlgorithm, server)
+		}
+	}
+	if _, err := remote.ParseLimits(bot.HTTPLimits); err != nil {
+		add("Invalid http_limits: %s", err.Error())
+	}
+	return problems
+}
+
+// validateRules checks all rules of a bot, on their own and against each other
+func validateRules(bot *models.Bot) []Problem {
+	// Unlike when the bot runs, the rules are looked up in the working directory (like bot.yml),
+	// e.g. the checkout of a rules repository, rather than next to the executable
+	searchDir := path.Join(configDir(bot), "rules")
+	if _, err := os.Stat(searchDir); err != nil {
+		return []Problem{{File: searchDir, Message: err.Error()}}
+	}
+
+	fileList := []string{}
+	filepath.Walk(searchDir, func(path string, f os.FileInfo, err error) error {
+		if err == nil && !f.IsDir() {
+			fileList = append(fileList, path)
+		}
+		return nil
+	})
+	sort.Strings(fileList)
+
+	problems := []Problem{}
+	rules := make(map[string]models.Rule)
+	for _, ruleFile := range fileList {
+		ruleConf := viper.New()
+		ruleConf.SetConfigFile(ruleFile)
+		if err := ruleConf.ReadInConfig(); err != nil {
+			problems = append(problems, Problem{File: ruleFile, Message: err.Error()})
+			continue
+		}
+		settings := ruleConf.AllSettings()
+		version, _, err := upgradeRule(settings)
+		if err != nil {
+			problems = append(problems, Problem{File: ruleFile, Message: err.Error()})
+			continue
+		}
+		rule := models.Rule{}
+		for _, err := range decodeStrict(settings, &rule) {
+			problems = append(problems, Problem{File: ruleFile, Rule: rule.Name, Message: err})
+		}
+		if version < RuleSchemaVersion {
+			problems = append(problems, Problem{File: ruleFile, Rule: rule.Name, Message: fmt.Sprintf("Written for rule schema version %d; run 'flottbot migrate-rules' to upgrade it to version %d", version, RuleSchemaVersion)})
+		}
+		if err := utils.ExpandEnv(&rule, false); err != nil {
+			problems = append(problems, Problem{File: ruleFile, Rule: rule.Name, Message: err.Error()})
+		}
+		for _, problem := range validateRule(rule) {
+			problems = append(problems, Problem{File: ruleFile, Rule: rule.Name, Message: problem})
+		}
+		rules[ruleFile] = rule
+	}
+
+	templates := map[string]models.Template{}
+	templatesDir := path.Join(configDir(bot), "templates")
+	if _, err := os.Stat(templatesDir); err == nil {
+		var templateProblems []Problem
+		templates, templateProblems = readTemplatesDir(templatesDir, true)
+		problems = append(problems, templateProblems...)
+	}
+	problems = append(problems, validateTemplates(rules, templates)...)
+	return append(problems, validateRuleSet(rules, bot)...)
+}
+
+// validateRule checks a rule on its own
+func validateRule(rule models.Rule) []string {
+	problems := []string{}
+	if len(rule.Name) == 0 {
+		problems = append(problems, "Rule has no name")
+	}
+	if len(rule.Respond) > 0 && len(rule.Hear) > 0 {
+		problems = append(problems, "Rule has both 'respond' and 'hear', choose one")
+	}
+	for _, trigger := range [][2]string{{"respond", rule.Respond}, {"hear", rule.Hear}} {
+		if len(trigger[1]) == 0 {
+			continue
+		}
+		if _, err := utils.MatchRegexp(trigger[1]); err != nil {
+			problems = append(problems, fmt.Sprintf("Invalid '%s' pattern '%s': %s", trigger[0], trigger[1], err.Error()))
+		}
+	}
+	if len(rule.Aliases) > 0 && (len(rule.Respond) == 0 || isRegexTrigger(rule.Respond)) {
+		problems = append(problems, "Only rules with a 'respond' that isn't a regular expression can have 'aliases'")
+	}
+	for _, pattern := range rule.Files {
+		if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+			problems = append(problems, fmt.Sprintf("Invalid 'files' pattern '%s', use e.g. '*.csv'", pattern))
+		}
+	}
+	for _, event := range rule.Events {
+		if _, ok := messageEvents[strings.ToLower(event)]; !ok {
+			problems = append(problems, fmt.Sprintf("Invalid 'events' value '%s', use 'sent', 'edited', 'deleted', 'joined', 'left', or 'user_joined'", event))
+		}
+	}
+	for _, action := range rule.Actions {
+		if !actionTypes[strings.ToLower(action.Type)] {
+			problems = append(problems, fmt.Sprintf("Action '%s' has unsupported type '%s'", action.Name, action.Type))
+		}
+		if action.Destructive && !dryRunTypes[strings.ToLower(action.Type)] {
+			problems = append(problems, fmt.Sprintf("Action '%s' of type '%s' can't be marked 'destructive', only exec, ssh, and HTTP actions can", action.Name, action.Type))
+		}
+		if len(action.When) > 0 {
+			if _, err := utils.ParseExpression(action.When); err != nil {
+				problems = append(problems, fmt.Sprintf("Action '%s' has an invalid 'when': %s", action.Name, err.Error()))
+			}
+		}
+		if strings.EqualFold(action.Type, "wait") && !strings.Contains(action.Wait, "${") {
+			if wait, err := utils.ParseDuration(action.Wait); err != nil || wait < 0 {
+				problems = append(problems, fmt.Sprintf("Action '%s' has invalid 'wait' '%s', use a duration like '30s'", action.Name, action.Wait))
+			}
+		}
+	}
+	if len(rule.Timeout) > 0 {
+		if timeout, err := time.ParseDuration(rule.Timeout); err != nil || timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("Invalid 'timeout' '%s', use a duration like '10m'", rule.Timeout))
+		}
+	}
+	if len(rule.ForEach) > 0 && len(rule.FormatItem) == 0 {
+		problems = append(problems, "Rule has a 'for_each' but no 'format_item' to show its items with")
+	}
+	if len(rule.FormatItem) > 0 && len(rule.ForEach) == 0 {
+		problems = append(problems, "Rule has a 'format_item' but no 'for_each' to go through")
+	}
+	declared := make(map[string]bool)
+	for _, v := range rule.Vars {
+		if len(v.Name) == 0 {
+			problems = append(problems, "Variable in 'vars' has no name")
+			continue
+		}
+		if declared[v.Name] {
+			problems = append(problems, fmt.Sprintf("Variable '%s' is declared more than once", v.Name))
+		}
+		declared[v.Name] = true
+		if len(v.Type) > 0 && variableTypes[strings.ToLower(v.Type)] == nil {
+			problems = append(problems, fmt.Sprintf("Variable '%s' has unknown type '%s', use 'string', 'int', 'number', 'bool', 'duration', or 'json'", v.Name, v.Type))
+		} else if len(v.Default) > 0 && !strings.Contains(v.Default, "${") {
+			if _, err := coerceVar(v, v.Default); err != nil {
+				problems = append(problems, fmt.Sprintf("Default of variable '%s': %s", v.Name, err.Error()))
+			}
+		}
+		if len(v.Scope) > 0 && !variableScopes[strings.ToLower(v.Scope)] {
+			problems = append(problems, fmt.Sprintf("Variable '%s' has unknown scope '%s', use 'rule', 'conversation', or 'global'", v.Name, v.Scope))
+		}
+	}
+	problems = append(problems, validateFlags(rule)...)
+	if len(rule.When) > 0 {
+		if _, err := utils.ParseExpression(rule.When); err != nil {
+			problems = append(problems, fmt.Sprintf("Invalid 'when': %s", err.Error()))
+		}
+	}
+	if len(rule.Debounce) > 0 {
+		if window, err := utils.ParseDuration(rule.Debounce); err != nil || window <= 0 {
+			problems = append(problems, fmt.Sprintf("Invalid 'debounce' '%s', use a duration like '5m'", rule.Debounce))
+		}
+	}
+	if len(rule.CorrelateWindow) > 0 {
+		if window, err := utils.ParseDuration(rule.CorrelateWindow); err != nil || window <= 0 {
+			problems = append(problems, fmt.Sprintf("Invalid 'correlate_window' '%s', use a duration like '24h'", rule.CorrelateWindow))
+		} else if len(rule.Correlate) == 0 {
+			problems = append(problems, "Rule has a 'correlate_window' but no 'correlate' key")
+		}
+	}
+	if len(rule.Correlate) > 0 && len(rule.Digest) > 0 {
+		problems = append(problems, "Rule has a 'correlate' key and a 'digest', its outputs go to the digest")
+	}
+	if len(rule.Canary.Of) == 0 && (rule.Canary.Percent != 0 || len(rule.Canary.Users) > 0) {
+		problems = append(problems, "Rule has a 'canary' without 'of', the name of its stable version")
+	}
+	if rule.Canary.Percent < 0 || rule.Canary.Percent > 100 {
+		problems = append(problems, fmt.Sprintf("Invalid canary 'percent' %g, it must be between 0 and 100", rule.Canary.Percent))
+	}
+	if rule.MaxConcurrent < 0 {
+		problems = append(problems, fmt.Sprintf("Invalid 'max_concurrent' %d, it must be at least 1", rule.MaxConcurrent))
+	}
+	if len(rule.Prompt.Text) > 0 && len(rule.Prompt.Options) == 0 {
+		problems = append(problems, "Rule has a 'prompt' without 'options' to choose from")
+	}
+	for i, option := range rule.Prompt.Options {
+		if len(option.Text) == 0 || len(option.Value) == 0 {
+			problems = append(problems, fmt.Sprintf("Prompt option %d needs a 'text' and a 'value'", i+1))
+		}
+	}
+	if (rule.Fallback.Identity || len(rule.Fallback.Email) > 0) && len(rule.OutputToUsers) == 0 {
+		problems = append(problems, "Rule has a 'fallback' but no 'output_to_users' to fall back for")
+	}
+	if len(rule.QueuedMessage) > 0 && rule.MaxConcurrent == 0 && len(rule.Lock) == 0 {
+		problems = append(problems, "Rule has a 'queued_message' but neither 'max_concurrent' nor 'lock', so it never queues")
+	}
+	if rule.ParallelActions {
+		if err := validateActionGraph(rule.Actions); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if err := validateFormat(rule); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// validateRuleSet checks the rules against each other: duplicate names and triggers,
+// 'call_rule' actions calling rules that don't exist, rules that can never run, and
+// variables that rules refer to but never get
+func validateRuleSet(rules map[string]models.Rule, bot *models.Bot) []Problem {
+	problems := []Problem{}
+	ruleFiles := make(map[string]string, len(rules))
+	byName := make(map[string]string, len(rules))
+	for ruleFile, rule := range rules {
+		ruleFiles[rule.Name] = ruleFile
+	}
+
+	// Variables passed to rules by the 'call_rule' actions calling them
+	called := make(map[string]bool)
+	passed := make(map[string][]string)
+	for ruleFile, rule := range rules {
+		for _, action := range rule.Actions {
+			if strings.ToLower(action.Type) != "call_rule" {
+				continue
+			}
+			target, ok := findRuleByName(rules, action.Rule)
+			if !ok {
+				problems = append(problems, Problem{File: ruleFile, Rule: rule.Name, Message: fmt.Sprintf("Action '%s' calls rule '%s', which doesn't exist", action.Name, action.Rule)})
+				continue
+			}
+			called[target] = true
+			for name := range action.Vars {
+				passed[target] = append(passed[target], name)
+			}
+		}
+	}
+
+	// Rules in the order they're matched in, so the rule that's shadowed is the one reported
+	triggers := make(map[string]models.Rule)
+	aliases := make(map[string]models.Rule)
+	for _, rule := range sortRules(rules) {
+		ruleFile := ruleFiles[rule.Name]
+		report := func(format string, args ...interface{}) {
+			problems = append(problems, Problem{File: ruleFile, Rule: rule.Name, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if other, ok := byName[strings.ToLower(rule.Name)]; ok && len(rule.Name) > 0 {
+			report("Another rule has the same name, in %s", other)
+		}
+		byName[strings.ToLower(rule.Name)] = ruleFile
+
+		if !rule.Active {
+			continue
+		}
+		trigger := ruleTrigger(rule)
+		// Canaries are matched in place of their stable version, so they share its trigger
+		if len(rule.Canary.Of) > 0 {
+			switch stable, ok := stableVersion(rule, rules); {
+			case !ok:
+				report("Is a canary of rule '%s', which doesn't exist", rule.Canary.Of)
+			case len(stable.Canary.Of) > 0:
+				report("Is a canary of rule '%s', which is a canary itself", stable.Name)
+			}
+		}
+		if len(trigger) > 0 && len(rule.Canary.Of) == 0 {
+			if other, ok := triggers[trigger]; ok {
+				if strings.ToLower(bot.MatchMode) == matchModeAll {
+					report("Has the same trigger as rule '%s'", other.Name)
+				} else {
+					report("Never runs, rule '%s' has the same trigger and is matched first", other.Name)
+				}
+			} else {
+				triggers[trigger] = rule
+			}
+		}
+		for _, shorthand := range rule.Aliases {
+			key := normalizeShorthand(shorthand)
+			if other, ok := aliases[key]; ok {
+				report("Alias '%s' is also an alias of rule '%s', which is matched first", shorthand, other.Name)
+			} else {
+				aliases[key] = rule
+			}
+		}
+		if _, ok := findDigest(rule.Digest, bot); len(rule.Digest) > 0 && !ok {
+			report("Is for digest '%s', which isn't in 'digests' in bot.yml", rule.Digest)
+		}
+		switch {
+		case len(trigger) == 0 && len(rule.Schedule) == 0 && len(rule.Intent) == 0 && !called[rule.Name]:
+			report("Never runs, it has no 'respond', 'hear', 'intent', 'files', 'events', or 'schedule' and no rule calls it")
+		case len(rule.Schedule) > 0 && !bot.Scheduler:
+			report("Never runs, it has a 'schedule' but the scheduler is off")
+		case len(rule.Intent) > 0 && len(bot.NLU) == 0:
+			report("Never runs, it has an 'intent' but 'nlu' isn't set")
+		}
+
+		for _, name := range undefinedVars(rule, passed[rule.Name]) {
+			report("Refers to ${%s}, which it never gets (from 'args', 'slots', 'expose_json_fields', 'extract', or a calling rule)", name)
+		}
+	}
+	return problems
+}
+
+// ruleTrigger is what makes a chat message trigger a rule, for finding duplicates
+func ruleTrigger(rule models.Rule) string {
+	trigger := ""
+	switch {
+	case len(rule.Respond) > 0:
+		trigger = "respond:" + strings.ToLower(strings.TrimSpace(rule.Respond))
+	case len(rule.Hear) > 0:
+		trigger = "hear:" + strings.ToLower(strings.TrimSpace(rule.Hear))
+	}
+	if len(rule.Files) > 0 {
+		trigger += "|files:" + strings.ToLower(strings.Join(rule.Files, ","))
+	}
+	if len(rule.Events) > 0 {
+		trigger += "|events:" + strings.ToLower(strings.Join(rule.Events, ","))
+	}
+	return trigger
+}
+
+// findRuleByName looks up a rule by name the way 'call_rule' actions do
+func findRuleByName(rules map[string]models.Rule, name string) (string, bool) {
+	for _, rule := range rules {
+		if strings.EqualFold(rule.Name, name) {
+			return rule.Name, true
+		}
+	}
+	return "", false
+}
+
+// undefinedVars lists the variables a rule refers to but never gets. Names that look like
+// environment variables, or are set in the environment, aren't included.
+func undefinedVars(rule models.Rule, passed []string) []string {
+	defined := make(map[string]bool)
+	for _, name := range append(rule.Args, passed...) {
+		defined[name] = true
+	}
+	for _, name := range rule.Slots {
+		defined[name] = true
+	}
+	for _, v := range rule.Vars {
+		defined[v.Name] = true
+	}
+	for _, flag := range rule.Flags {
+		defined[flag.Name] = true
+	}
+	for _, action := range rule.Actions {
+		for name := range action.ExposeJSONFields {
+			defined[name] = true
+		}
+		for name := range action.Extract {
+			defined[name] = true
+		}
+	}
+
+	undefined := []string{}
+	seen := make(map[string]bool)
+	utils.MapStrings(&rule, func(s string) string {
+		for _, loc := range varRefPattern.FindAllStringSubmatchIndex(s, -1) {
+			// $${...} is escaped
+			if loc[0] > 0 && s[loc[0]-1] == '$' {
+				continue
+			}
+			name := s[loc[2]:loc[3]]
+			if defined[name] || seen[name] || envVarName.MatchString(name) {
+				continue
+			}
+			if _, ok := os.LookupEnv(name); ok {
+				continue
+			}
+			seen[name] = true
+			undefined = append(undefined, name)
+		}
+		return s
+	})
+	sort.Strings(undefined)
+	return undefined
+}
+
+// slackAttachmentHook decodes the Slack attachments of rules the way Slack's JSON is decoded, since
+// their settings are named after the JSON fields, e.g. 'callback_id'
+func slackAttachmentHook(strict bool) mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if to != reflect.TypeOf(slack.Attachment{}) || from.Kind() != reflect.Map {
+			return data, nil
+		}
+		raw, err := json.Marshal(utils.MakeNiceJSON(map[string]interface{}{"attachment": data})["attachment"])
+		if err != nil {
+			return nil, err
+		}
+		var attachment slack.Attachment
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		if strict {
+			decoder.DisallowUnknownFields()
+		}
+		if err := decoder.Decode(&attachment); err != nil {
+			return nil, fmt.Errorf("Invalid Slack attachment: %s", err.Error())
+		}
+		return attachment, nil
+	}
+}
+
+// decodeStrict decodes settings like viper does, but reports unknown settings and values of the wrong type
+func decodeStrict(settings map[string]interface{}, result interface{}) []string {
+	return decodeSettings(settings, result, true)
+}
+
+// decodeSettings decodes settings like viper does, reporting values of the wrong type, and unknown
+// settings if strict is set
+func decodeSettings(settings map[string]interface{}, result interface{}, strict bool) []string {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           result,
+		WeaklyTypedInput: true,
+		ErrorUnused:      strict,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+			slackAttachmentHook(strict),
+		),
+	})
+	if err != nil {
+		return []string{err.Error()}
+	}
+	err = decoder.Decode(settings)
+	if err == nil {
+		return nil
+	}
+	if merr, ok := err.(*mapstructure.Error); ok {
+		errs := append([]string{}, merr.Errors...)
+		sort.Strings(errs)
+		return errs
+	}
+	return []string{err.Error()}
+}
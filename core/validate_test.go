@@ -0,0 +1,194 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestValidateRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule models.Rule
+		want []string
+	}{
+		{"Valid", models.Rule{Name: "hello", Respond: "hello", Actions: []models.Action{{Name: "say", Type: "message"}}}, []string{}},
+		{"No name", models.Rule{Respond: "hello"}, []string{"Rule has no name"}},
+		{"Respond and hear", models.Rule{Name: "hello", Respond: "hello", Hear: "hi"}, []string{"Rule has both 'respond' and 'hear', choose one"}},
+		{"Bad regex", models.Rule{Name: "hello", Hear: "/hel(lo/"}, []string{"Invalid 'hear' pattern '/hel(lo/': error parsing regexp: missing closing ): `(?i)hel(lo`"}},
+		{"Aliases of a regex", models.Rule{Name: "deploy", Respond: "/deploy (.*)/", Aliases: []string{"d"}}, []string{"Only rules with a 'respond' that isn't a regular expression can have 'aliases'"}},
+		{"Bad flags", models.Rule{Name: "deploy", Respond: "deploy", Args: []string{"env"}, Flags: []models.Flag{
+			{Name: "env"}, {Name: "--force", Short: "f", Type: "bool", Required: true}, {Name: "replicas", Short: "f", Type: "int", Default: "two"}, {},
+		}}, []string{
+			"Flag '--env' has the same name as another flag or an arg",
+			"Invalid flag name '--force', leave out the dashes",
+			"Flag '----force' is a 'bool', which can't be required",
+			"Flag '--replicas' has the same short name as another flag",
+			"Default of flag '--replicas' must be of type 'int', but is 'two'",
+			"Flag 4 has no name",
+		}},
+		{"Bad files pattern", models.Rule{Name: "import", Files: []string{"*.csv", "[a-"}}, []string{"Invalid 'files' pattern '[a-', use e.g. '*.csv'"}},
+		{"Bad event", models.Rule{Name: "moderate", Hear: "password", Events: []string{"edited", "reacted"}}, []string{"Invalid 'events' value 'reacted', use 'sent', 'edited', 'deleted', 'joined', 'left', or 'user_joined'"}},
+		{"Unknown action type", models.Rule{Name: "hello", Respond: "hello", Actions: []models.Action{{Name: "fetch", Type: "GETT"}}}, []string{"Action 'fetch' has unsupported type 'GETT'"}},
+		{"Destructive message", models.Rule{Name: "hello", Respond: "hello", Actions: []models.Action{{Name: "greet", Type: "message", Destructive: true}}}, []string{"Action 'greet' of type 'message' can't be marked 'destructive', only exec, ssh, and HTTP actions can"}},
+		{"Bad timeout", models.Rule{Name: "deploy", Respond: "deploy", Timeout: "10"}, []string{"Invalid 'timeout' '10', use a duration like '10m'"}},
+		{"Bad wait", models.Rule{Name: "deploy", Respond: "deploy", Actions: []models.Action{{Name: "settle", Type: "wait", Wait: "30"}}}, []string{"Action 'settle' has invalid 'wait' '30', use a duration like '30s'"}},
+		{"Bad when", models.Rule{Name: "deploy", Respond: "deploy", When: "${env} = 'prod'", Actions: []models.Action{{Name: "ship", Type: "exec", When: "upper(${env}"}}}, []string{"Action 'ship' has an invalid 'when': Invalid expression 'upper(${env}': expected ')' at the end", "Invalid 'when': Invalid expression '${env} = 'prod'': unexpected '='"}},
+		{"for_each without format_item", models.Rule{Name: "servers", Respond: "servers", ForEach: "${servers}"}, []string{"Rule has a 'for_each' but no 'format_item' to show its items with"}},
+		{"Bad vars", models.Rule{Name: "scale", Respond: "scale", Vars: []models.Variable{{Name: "replicas", Type: "int", Default: "three"}, {Name: "replicas"}, {Name: "env", Type: "text", Scope: "team"}}}, []string{"Default of variable 'replicas': Variable 'replicas' must be of type 'int', but is 'three'", "Variable 'replicas' is declared more than once", "Variable 'env' has unknown type 'text', use 'string', 'int', 'number', 'bool', 'duration', or 'json'", "Variable 'env' has unknown scope 'team', use 'rule', 'conversation', or 'global'"}},
+		{"Bad debounce", models.Rule{Name: "alert", Hear: "alert", Debounce: "soon"}, []string{"Invalid 'debounce' 'soon', use a duration like '5m'"}},
+		{"Bad correlate window", models.Rule{Name: "alert", Hear: "alert", Correlate: "${alert}", CorrelateWindow: "soon"}, []string{"Invalid 'correlate_window' 'soon', use a duration like '24h'"}},
+		{"Correlate window without key", models.Rule{Name: "alert", Hear: "alert", CorrelateWindow: "1h"}, []string{"Rule has a 'correlate_window' but no 'correlate' key"}},
+		{"Canary without stable version", models.Rule{Name: "deploy-v2", Respond: "deploy", Canary: models.Canary{Percent: 150}}, []string{"Rule has a 'canary' without 'of', the name of its stable version", "Invalid canary 'percent' 150, it must be between 0 and 100"}},
+		{"Negative max_concurrent", models.Rule{Name: "deploy", Respond: "deploy", MaxConcurrent: -1}, []string{"Invalid 'max_concurrent' -1, it must be at least 1"}},
+		{"Fallback without users", models.Rule{Name: "page", Schedule: "@hourly", Fallback: models.Fallback{Identity: true}}, []string{"Rule has a 'fallback' but no 'output_to_users' to fall back for"}},
+		{"Prompt without options", models.Rule{Name: "deploy", Respond: "deploy", Prompt: models.Prompt{Text: "Where to?"}}, []string{"Rule has a 'prompt' without 'options' to choose from"}},
+		{"Prompt option without value", models.Rule{Name: "deploy", Respond: "deploy", Prompt: models.Prompt{Text: "Where to?", Options: []models.PromptOption{{Text: "Prod"}}}}, []string{"Prompt option 1 needs a 'text' and a 'value'"}},
+		{"Queued message without limit", models.Rule{Name: "deploy", Respond: "deploy", QueuedMessage: "Wait"}, []string{"Rule has a 'queued_message' but neither 'max_concurrent' nor 'lock', so it never queues"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateRule(tt.rule); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateRule() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRuleSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules map[string]models.Rule
+		bot   *models.Bot
+		want  []string
+	}{
+		{"Valid", map[string]models.Rule{
+			"a.yml": {Name: "deploy", Active: true, Respond: "deploy", Args: []string{"service"}, Actions: []models.Action{
+				{Name: "call", Type: "call_rule", Rule: "status", Vars: map[string]string{"env": "prod"}},
+			}, FormatOutput: "Deployed ${service}"},
+			"b.yml": {Name: "status", Active: true, FormatOutput: "${env} is ${STATUS} at ${_user.name}, $${literal}"},
+		}, &models.Bot{}, []string{}},
+		{"Duplicate name", map[string]models.Rule{
+			"a.yml": {Name: "hello", Active: true, Respond: "hello", Priority: 1},
+			"b.yml": {Name: "Hello", Active: true, Respond: "hi"},
+		}, &models.Bot{}, []string{"b.yml: rule 'Hello': Another rule has the same name, in a.yml"}},
+		{"Duplicate trigger", map[string]models.Rule{
+			"a.yml": {Name: "hello", Active: true, Respond: "hello", Priority: 1},
+			"b.yml": {Name: "greet", Active: true, Respond: "Hello"},
+		}, &models.Bot{}, []string{"b.yml: rule 'greet': Never runs, rule 'hello' has the same trigger and is matched first"}},
+		{"Duplicate trigger, all matching rules fire", map[string]models.Rule{
+			"a.yml": {Name: "hello", Active: true, Respond: "hello", Priority: 1},
+			"b.yml": {Name: "greet", Active: true, Respond: "hello"},
+		}, &models.Bot{MatchMode: "all"}, []string{"b.yml: rule 'greet': Has the same trigger as rule 'hello'"}},
+		{"Duplicate alias", map[string]models.Rule{
+			"a.yml": {Name: "deploy", Active: true, Respond: "deploy", Aliases: []string{"d"}, Priority: 1},
+			"b.yml": {Name: "describe", Active: true, Respond: "describe", Aliases: []string{"D", "desc"}},
+		}, &models.Bot{}, []string{"b.yml: rule 'describe': Alias 'D' is also an alias of rule 'deploy', which is matched first"}},
+		{"Inactive duplicate", map[string]models.Rule{
+			"a.yml": {Name: "hello", Active: true, Respond: "hello"},
+			"b.yml": {Name: "greet", Respond: "hello"},
+		}, &models.Bot{}, []string{}},
+		{"Unknown rule called", map[string]models.Rule{
+			"a.yml": {Name: "hello", Active: true, Respond: "hello", Actions: []models.Action{{Name: "call", Type: "call_rule", Rule: "nope"}}},
+		}, &models.Bot{}, []string{"a.yml: rule 'hello': Action 'call' calls rule 'nope', which doesn't exist"}},
+		{"Unreachable", map[string]models.Rule{
+			"a.yml": {Name: "orphan", Active: true},
+			"b.yml": {Name: "nightly", Active: true, Schedule: "@daily"},
+			"c.yml": {Name: "intent", Active: true, Intent: "greet"},
+		}, &models.Bot{}, []string{
+			"c.yml: rule 'intent': Never runs, it has an 'intent' but 'nlu' isn't set",
+			"b.yml: rule 'nightly': Never runs, it has a 'schedule' but the scheduler is off",
+			"a.yml: rule 'orphan': Never runs, it has no 'respond', 'hear', 'intent', 'files', 'events', or 'schedule' and no rule calls it",
+		}},
+		{"Undefined variables", map[string]models.Rule{
+			"a.yml": {Name: "hello", Active: true, Respond: "hello", Args: []string{"name"},
+				Actions:      []models.Action{{Name: "get", Type: "get", ExposeJSONFields: map[string]string{"id": ".id"}}},
+				FormatOutput: "${name} ${id} ${greeting | upper} ${greeting}"},
+		}, &models.Bot{}, []string{"a.yml: rule 'hello': Refers to ${greeting}, which it never gets (from 'args', 'slots', 'expose_json_fields', 'extract', or a calling rule)"}},
+		{"Unknown digest", map[string]models.Rule{
+			"a.yml": {Name: "alert", Active: true, Respond: "alert", Digest: "alerts", FormatOutput: "fired"},
+			"b.yml": {Name: "deploy", Active: true, Respond: "deploy", Digest: "Deploys", FormatOutput: "deployed"},
+		}, &models.Bot{Digests: []models.Digest{{Name: "deploys"}}}, []string{"a.yml: rule 'alert': Is for digest 'alerts', which isn't in 'digests' in bot.yml"}},
+		{"Canaries", map[string]models.Rule{
+			"a.yml": {Name: "deploy", Active: true, Respond: "deploy"},
+			"b.yml": {Name: "deploy-v2", Active: true, Respond: "deploy", Canary: models.Canary{Of: "Deploy", Percent: 10}},
+			"c.yml": {Name: "deploy-v3", Active: true, Respond: "deploy", Canary: models.Canary{Of: "deploy-v2"}},
+			"d.yml": {Name: "status-v2", Active: true, Respond: "status", Canary: models.Canary{Of: "status"}},
+		}, &models.Bot{}, []string{
+			"c.yml: rule 'deploy-v3': Is a canary of rule 'deploy-v2', which is a canary itself",
+			"d.yml: rule 'status-v2': Is a canary of rule 'status', which doesn't exist",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, problem := range validateRuleSet(tt.rules, tt.bot) {
+				got = append(got, problem.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateRuleSet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flottbot-validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "rules"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "rules", "hello.yml"), []byte("name: hello\nactive: true\nrespond: hello\nrespnd: typo\nformat_output: hi\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "rules", "future.yml"), []byte("schema_version: 3\nname: future\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "rules", "deploy.yml"), []byte("schema_version: 2\nname: deploy\nactive: true\nrespond: deploy\nformat_output: ${TOKEN:?deploy token}\n"), 0644)
+
+	os.Unsetenv("TOKEN")
+	bot := &models.Bot{ConfigDir: dir, ChatApplication: "irc", ShutdownTimeout: "soon", StorageEncryptionKeys: []string{"c2hvcnQ=", "vault:secret/data/flottbot#storage_key"}, InputMiddleware: []models.Middleware{{Type: "alias"}}, OutputMiddleware: []models.Middleware{{Type: "shout"}}, OutputLimits: models.OutputLimits{"slack": {Policy: "drop"}}, HTTPAuth: map[string]models.HTTPAuth{"webhooks": {Username: "ops"}, "events": {AllowIPs: []string{"10.0.0.0/33"}}}, HTTPLimits: models.HTTPLimits{ReadTimeout: "forever"}, Bridges: []models.Bridge{{Channel: "incidents", To: []models.BridgeTarget{{Bot: "discord"}}}}, Standups: []models.Standup{{Schedule: "daily"}}, Digests: []models.Digest{{Name: "alerts", Channel: "ops", Schedule: "hourly", Timezone: "Mars/Olympus"}}, CommandAliases: map[string]string{"d": ""}, MentionPrefixes: []string{"!", " "}, AutoResponders: models.AutoResponders{Channels: []models.ChannelResponder{{OfficeHours: models.OfficeHours{Start: "9am", End: "17:00"}, Answers: []models.AutoResponse{{Answer: "Ask IT"}}}}}}
+	settings := map[string]interface{}{"name": "bot", "chat_application": "irc", "shutdown_timeout": "soon", "scheduller": true}
+
+	got := []string{}
+	for _, problem := range Validate(settings, "bot.yml", bot) {
+		got = append(got, problem.String())
+	}
+	want := []string{
+		"bot.yml: '' has invalid keys: scheduller",
+		"bot.yml: Chat application 'irc' is not supported",
+		"bot.yml: Standup 1 has no 'channel'",
+		"bot.yml: Invalid schedule 'daily' of standup 1: ",
+		"bot.yml: Invalid schedule 'hourly' of digest 1: ",
+		"bot.yml: Unknown timezone 'Mars/Olympus' of digest 1",
+		"bot.yml: Command alias 'd' has no command",
+		"bot.yml: Mention prefix 2 is empty",
+		"bot.yml: Auto-responder 1 has no 'channel'",
+		"bot.yml: Invalid office_hours of auto-responder 1: Invalid start '9am', use a time like '09:00'",
+		"bot.yml: Answer 1 of auto-responder 1 needs 'keywords', and an 'answer' or 'after_hours'",
+		"bot.yml: Invalid shutdown_timeout 'soon': ",
+		"bot.yml: Invalid storage encryption key #1, use 16, 24, or 32 base64 encoded bytes",
+		"bot.yml: Invalid input_middleware 1: Alias middleware needs 'aliases'",
+		"bot.yml: Invalid output_middleware 1: Unknown type 'shout', use 'script', 'append', 'replace', 'filter', or 'max_length'",
+		"bot.yml: Bridge 1: target 1 has no 'channel'",
+		"bot.yml: Invalid output_limits policy 'drop' for 'slack', use 'split', 'thread', or 'truncate'",
+		"bot.yml: Invalid http_auth allow_ips for 'events': '10.0.0.0/33' is not an IP address or CIDR range",
+		"bot.yml: Unknown http_auth server 'webhooks', use 'events', 'interactions', 'admin', 'health', 'metrics', or 'all'",
+		"bot.yml: Invalid http_auth for 'webhooks', set both 'username' and 'password'",
+		"bot.yml: Invalid http_limits: Invalid 'read_timeout' 'forever', use a duration like '30s'",
+		filepath.Join(dir, "rules", "deploy.yml") + ": rule 'deploy': Required environment variables are not set: TOKEN (deploy token)",
+		filepath.Join(dir, "rules", "future.yml") + ": Rule schema version 3 is newer than version 2, which this flottbot reads; upgrade flottbot",
+		filepath.Join(dir, "rules", "hello.yml") + ": rule 'hello': '' has invalid keys: respnd",
+		filepath.Join(dir, "rules", "hello.yml") + ": rule 'hello': Written for rule schema version 1; run 'flottbot migrate-rules' to upgrade it to version 2",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Validate() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("Validate()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// variablesBucket is the storage bucket holding the values of rule variables kept beyond a run
+const variablesBucket = "variables"
+
+// variableTypes are the types rule variables can be declared with, and how values are checked
+// and written the same way, e.g. 'yes' as 'true' for 'bool'
+var variableTypes = map[string]func(string) (string, error){
+	"string": func(value string) (string, error) { return value, nil },
+	"int": func(value string) (string, error) {
+		i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		return strconv.FormatInt(i, 10), err
+	},
+	"number": func(value string) (string, error) {
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return strconv.FormatFloat(f, 'f', -1, 64), err
+	},
+	"bool": func(value string) (string, error) {
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "true", "yes", "on", "1":
+			return "true", nil
+		case "false", "no", "off", "0":
+			return "false", nil
+		}
+		return "", fmt.Errorf("not a bool")
+	},
+	"duration": func(value string) (string, error) {
+		d, err := utils.ParseDuration(value)
+		return d.String(), err
+	},
+	"json": func(value string) (string, error) {
+		if !json.Valid([]byte(value)) {
+			return "", fmt.Errorf("not JSON")
+		}
+		return value, nil
+	},
+}
+
+// variableScopes are how long the values of rule variables are kept: for the run of the rule,
+// for the conversation (the thread, or the channel outside of threads), or for good
+var variableScopes = map[string]bool{"rule": true, "conversation": true, "global": true}
+
+// declareVars gives the variables a rule declares in 'vars' their values for a run: the value the
+// rule was triggered with (e.g. an argument), else the one kept for the variable's scope, else its
+// default. Values are checked against, and written as, the variable's type. A required variable
+// without a value, or a value of the wrong type, is an error telling which variable it is.
+func declareVars(rule models.Rule, message *models.Message, bot *models.Bot) error {
+	for _, v := range rule.Vars {
+		value, ok := message.Vars[v.Name]
+		if (!ok || len(value) == 0) && isScoped(v) {
+			kept, found, err := recallVar(v, *message, bot)
+			if err != nil {
+				bot.Log.Errorf("Rule '%s' could not look up the value of '%s': %s", rule.Name, v.Name, err.Error())
+			}
+			if found {
+				value, ok = kept, true
+			}
+		}
+		if (!ok || len(value) == 0) && len(v.Default) > 0 {
+			def, err := utils.Substitute(v.Default, message.Vars)
+			if err != nil {
+				return fmt.Errorf("The default of variable '%s' could not be filled in: %s", v.Name, err.Error())
+			}
+			value, ok = def, true
+		}
+		if !ok || len(value) == 0 {
+			if v.Required {
+				return fmt.Errorf("Variable '%s' is required, but has no value", v.Name)
+			}
+			message.Vars[v.Name] = ""
+			continue
+		}
+
+		typed, err := coerceVar(v, value)
+		if err != nil {
+			return err
+		}
+		message.Vars[v.Name] = typed
+	}
+	return nil
+}
+
+// requiredArgs is how many of a rule's args have to be given. Trailing args declared in 'vars'
+// with a default, or with a value kept for their scope, can be left out.
+func requiredArgs(rule models.Rule) int {
+	optional := make(map[string]bool)
+	for _, v := range rule.Vars {
+		optional[v.Name] = !v.Required && (len(v.Default) > 0 || isScoped(v))
+	}
+	required := len(rule.Args)
+	for required > 0 && optional[rule.Args[required-1]] {
+		required--
+	}
+	return required
+}
+
+// keepVars keeps the values the variables of a rule with the 'conversation' or 'global' scope
+// have at the end of a run, for the next runs of the rule
+func keepVars(rule models.Rule, message models.Message, bot *models.Bot) {
+	for _, v := range rule.Vars {
+		if !isScoped(v) {
+			continue
+		}
+		value, err := coerceVar(v, message.Vars[v.Name])
+		if err != nil && len(message.Vars[v.Name]) > 0 {
+			bot.Log.Errorf("Rule '%s' could not keep '%s': %s", rule.Name, v.Name, err.Error())
+			continue
+		}
+		if bot.Store == nil {
+			continue
+		}
+		key := varScopeKey(v, message) + "/" + v.Name
+		if len(message.Vars[v.Name]) == 0 {
+			err = bot.Store.Delete(variablesBucket, key)
+		} else {
+			err = bot.Store.Set(variablesBucket, key, []byte(value), 0)
+		}
+		if err != nil {
+			bot.Log.Errorf("Rule '%s' could not keep '%s': %s", rule.Name, v.Name, err.Error())
+		}
+	}
+}
+
+// coerceVar checks a value against a variable's type, and writes it the way the type does
+func coerceVar(v models.Variable, value string) (string, error) {
+	typeName := strings.ToLower(v.Type)
+	if len(typeName) == 0 {
+		typeName = "string"
+	}
+	coerce, ok := variableTypes[typeName]
+	if !ok {
+		return "", fmt.Errorf("Variable '%s' has unknown type '%s'", v.Name, v.Type)
+	}
+	typed, err := coerce(value)
+	if err != nil {
+		return "", fmt.Errorf("Variable '%s' must be of type '%s', but is '%s'", v.Name, typeName, value)
+	}
+	return typed, nil
+}
+
+// isScoped determines whether a variable is kept beyond the run of its rule
+func isScoped(v models.Variable) bool {
+	scope := strings.ToLower(v.Scope)
+	return scope == "conversation" || scope == "global"
+}
+
+// recallVar looks up the value kept for a variable's scope
+func recallVar(v models.Variable, message models.Message, bot *models.Bot) (string, bool, error) {
+	if bot.Store == nil {
+		return "", false, nil
+	}
+	value, ok, err := bot.Store.Get(variablesBucket, varScopeKey(v, message)+"/"+v.Name)
+	return string(value), ok, err
+}
+
+// varScopeKey builds the key that identifies the scope of a variable for a message
+func varScopeKey(v models.Variable, message models.Message) string {
+	if strings.EqualFold(v.Scope, "global") {
+		return "global"
+	}
+	return "conversation:" + message.ChannelID + "/" + message.ThreadID
+}
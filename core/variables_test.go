@@ -0,0 +1,106 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestDeclareVars(t *testing.T) {
+	bot := &models.Bot{}
+	initLogger(bot)
+
+	tests := []struct {
+		name    string
+		vars    []models.Variable
+		given   map[string]string
+		want    map[string]string
+		wantErr string
+	}{
+		{"Untyped", []models.Variable{{Name: "env"}}, map[string]string{"env": "prod"}, map[string]string{"env": "prod"}, ""},
+		{"Default", []models.Variable{{Name: "replicas", Type: "int", Default: "3"}}, nil, map[string]string{"replicas": "3"}, ""},
+		{"Default with variables", []models.Variable{{Name: "target", Default: "${env}-db"}}, map[string]string{"env": "prod"}, map[string]string{"target": "prod-db"}, ""},
+		{"Optional", []models.Variable{{Name: "reason"}}, nil, map[string]string{"reason": ""}, ""},
+		{"Coerced", []models.Variable{{Name: "force", Type: "bool"}, {Name: "ratio", Type: "number"}, {Name: "wait", Type: "duration"}}, map[string]string{"force": "Yes", "ratio": " 0.50", "wait": "90s"}, map[string]string{"force": "true", "ratio": "0.5", "wait": "1m30s"}, ""},
+		{"Required", []models.Variable{{Name: "env", Required: true}}, nil, nil, "Variable 'env' is required, but has no value"},
+		{"Wrong type", []models.Variable{{Name: "replicas", Type: "int"}}, map[string]string{"replicas": "lots"}, nil, "Variable 'replicas' must be of type 'int', but is 'lots'"},
+		{"Bad JSON", []models.Variable{{Name: "labels", Type: "json"}}, map[string]string{"labels": "{"}, nil, "Variable 'labels' must be of type 'json', but is '{'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			for name, value := range tt.given {
+				message.Vars[name] = value
+			}
+			err := declareVars(models.Rule{Name: "deploy", Vars: tt.vars}, &message, bot)
+			if len(tt.wantErr) > 0 {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("declareVars() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("declareVars() error = %v", err)
+			}
+			for name, value := range tt.want {
+				if got, ok := message.Vars[name]; !ok || got != value {
+					t.Errorf("declareVars() ${%s} = %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestScopedVars(t *testing.T) {
+	bot := &models.Bot{Store: memory.New()}
+	initLogger(bot)
+	rule := models.Rule{Name: "env", Vars: []models.Variable{
+		{Name: "env", Scope: "conversation", Default: "staging"},
+		{Name: "region", Scope: "global"},
+	}}
+
+	run := func(channel, thread string, given map[string]string) map[string]string {
+		message := models.NewMessage()
+		message.ChannelID = channel
+		message.ThreadID = thread
+		for name, value := range given {
+			message.Vars[name] = value
+		}
+		if err := declareVars(rule, &message, bot); err != nil {
+			t.Fatalf("declareVars() error = %v", err)
+		}
+		keepVars(rule, message, bot)
+		return message.Vars
+	}
+
+	run("C1", "", map[string]string{"env": "prod", "region": "eu"})
+	if vars := run("C1", "", nil); vars["env"] != "prod" || vars["region"] != "eu" {
+		t.Errorf("Same conversation got env %q and region %q, want 'prod' and 'eu'", vars["env"], vars["region"])
+	}
+	if vars := run("C1", "1554821760.000200", nil); vars["env"] != "staging" || vars["region"] != "eu" {
+		t.Errorf("Other conversation got env %q and region %q, want 'staging' and 'eu'", vars["env"], vars["region"])
+	}
+}
+
+func TestRequiredArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		rule models.Rule
+		want int
+	}{
+		{"No vars", models.Rule{Args: []string{"service", "version"}}, 2},
+		{"Trailing default", models.Rule{Args: []string{"service", "version"}, Vars: []models.Variable{{Name: "version", Default: "latest"}}}, 1},
+		{"Trailing scoped", models.Rule{Args: []string{"service", "env"}, Vars: []models.Variable{{Name: "env", Scope: "conversation"}}}, 1},
+		{"Default in between", models.Rule{Args: []string{"service", "version"}, Vars: []models.Variable{{Name: "service", Default: "api"}}}, 2},
+		{"Required with default", models.Rule{Args: []string{"service", "version"}, Vars: []models.Variable{{Name: "version", Default: "latest", Required: true}}}, 2},
+		{"Typed only", models.Rule{Args: []string{"replicas"}, Vars: []models.Variable{{Name: "replicas", Type: "int"}}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requiredArgs(tt.rule); got != tt.want {
+				t.Errorf("requiredArgs() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
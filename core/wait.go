@@ -0,0 +1,36 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// handleWait handles 'wait' actions, which pause the rule's run for their 'wait' duration, e.g. to
+// give a deploy 30s before checking its health. Cancelling the run, or reaching the rule's
+// 'timeout', ends the wait early, and the actions after it don't run. Dry runs don't wait.
+func handleWait(action models.Action, msg *models.Message, bot *models.Bot) error {
+	wait, err := utils.Substitute(action.Wait, msg.Vars)
+	if err != nil {
+		return err
+	}
+	duration, err := utils.ParseDuration(wait)
+	if err != nil || duration < 0 {
+		return fmt.Errorf("Invalid 'wait' '%s' in action '%s'", wait, action.Name)
+	}
+	if msg.Vars["_dry_run"] == "true" {
+		bot.Log.Debugf("Not waiting %s for action '%s' in a dry run", duration, action.Name)
+		return nil
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-msg.Run.Context().Done():
+		return fmt.Errorf("Stopped waiting for action '%s': %s", action.Name, msg.Run.Context().Err().Error())
+	}
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestHandleWait(t *testing.T) {
+	bot := &models.Bot{}
+	initLogger(bot)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		wait    string
+		dryRun  bool
+		ctx     context.Context
+		wantErr bool
+	}{
+		{"Wait", "10ms", false, context.Background(), false},
+		{"Variable", "${delay}", false, context.Background(), false},
+		{"Invalid", "soon", false, context.Background(), true},
+		{"Cancelled", "1h", false, cancelled, true},
+		{"Dry run", "1h", true, context.Background(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.Vars["delay"] = "10ms"
+			if tt.dryRun {
+				message.Vars["_dry_run"] = "true"
+			}
+			message.Run = models.NewRunContext(tt.ctx)
+			start := time.Now()
+			err := handleWait(models.Action{Name: "settle", Type: "wait", Wait: tt.wait}, &message, bot)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("handleWait() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if time.Since(start) > time.Second {
+				t.Errorf("handleWait() took %s", time.Since(start))
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/target/flottbot/models"
+)
+
+// matchPool processes messages on several workers at once. Messages of the same conversation
+// are processed one after the other, in the order they were read, so a slow rule only holds up
+// the conversation it was triggered in.
+type matchPool struct {
+	mu      sync.Mutex
+	workers chan struct{}               // a token per worker that is processing a conversation
+	waiting chan struct{}               // a token per message waiting behind its conversation
+	pending map[string][]models.Message // conversations being processed, with the messages waiting in them
+	process func(models.Message)
+}
+
+// newMatchPool creates a pool of workers processing messages with the given function. At most
+// maxWaiting messages wait behind their conversation before the pool stops taking messages.
+func newMatchPool(workers, maxWaiting int, process func(models.Message)) *matchPool {
+	if maxWaiting < 1 {
+		maxWaiting = 1
+	}
+	return &matchPool{
+		workers: make(chan struct{}, workers),
+		waiting: make(chan struct{}, maxWaiting),
+		pending: make(map[string][]models.Message),
+		process: process,
+	}
+}
+
+// submit hands a message to the pool. It blocks while all workers are busy with other
+// conversations, or while too many messages wait behind their conversation.
+func (p *matchPool) submit(message models.Message) {
+	key := conversationKey(message)
+
+	p.mu.Lock()
+	if queue, busy := p.pending[key]; busy {
+		p.mu.Unlock()
+		p.waiting <- struct{}{}
+		p.mu.Lock()
+		// The conversation may have finished while this waited for room
+		if queue, busy = p.pending[key]; busy {
+			p.pending[key] = append(queue, message)
+			p.mu.Unlock()
+			return
+		}
+		<-p.waiting
+	}
+	p.pending[key] = nil
+	p.mu.Unlock()
+
+	p.workers <- struct{}{}
+	go p.work(key, message)
+}
+
+// work processes a message and then the messages that arrived in its conversation meanwhile
+func (p *matchPool) work(key string, message models.Message) {
+	for {
+		p.process(message)
+
+		p.mu.Lock()
+		queue := p.pending[key]
+		if len(queue) == 0 {
+			delete(p.pending, key)
+			p.mu.Unlock()
+			<-p.workers
+			return
+		}
+		message = queue[0]
+		p.pending[key] = queue[1:]
+		p.mu.Unlock()
+		<-p.waiting
+	}
+}
+
+// conversationKey identifies the conversation a message belongs to, e.g. a channel or a DM
+func conversationKey(message models.Message) string {
+	return strconv.Itoa(int(message.Service)) + "/" + message.ChannelID
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestMatchPool(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var processed []string
+	done := make(chan string, 10)
+
+	pool := newMatchPool(2, 10, func(message models.Message) {
+		// The first message of the slow channel takes until it's released
+		if message.ID == "slow-1" {
+			<-release
+		}
+		mu.Lock()
+		processed = append(processed, message.ID)
+		mu.Unlock()
+		done <- message.ID
+	})
+
+	message := func(id, channel string) models.Message {
+		m := models.NewMessage()
+		m.ID = id
+		m.Service = models.MsgServiceChat
+		m.ChannelID = channel
+		return m
+	}
+	pool.submit(message("slow-1", "C1"))
+	pool.submit(message("slow-2", "C1"))
+	pool.submit(message("fast-1", "C2"))
+	pool.submit(message("fast-2", "C2"))
+
+	// Other conversations aren't held up by the slow one
+	for _, want := range []string{"fast-1", "fast-2"} {
+		select {
+		case got := <-done:
+			if got != want {
+				t.Fatalf("processed %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was held up by another conversation", want)
+		}
+	}
+
+	// Messages of a conversation are processed in order
+	close(release)
+	for _, want := range []string{"slow-1", "slow-2"} {
+		select {
+		case got := <-done:
+			if got != want {
+				t.Fatalf("processed %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was never processed", want)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(processed) != 4 {
+		t.Errorf("processed %v", processed)
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/target/flottbot/models"
+)
+
+// maxArtifactSize limits how big artifacts can be, so a runaway download can't fill the disk
+const maxArtifactSize = 100 << 20
+
+// ArtifactPath resolves the name or path of an artifact to a path in the message's artifact directory
+// (${_artifact.dir}), so artifacts can't be read or written anywhere else
+func ArtifactPath(name string, msg *models.Message) (string, error) {
+	dir := msg.Vars["_artifact.dir"]
+	if len(dir) == 0 {
+		return "", errors.New("There is no artifact directory, the rule doesn't use artifacts")
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if !inDir(dir, path) {
+		return "", fmt.Errorf("Artifact '%s' is not in the artifact directory", name)
+	}
+	return path, nil
+}
+
+// inDir tells whether path is inside dir
+func inDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// SaveArtifact writes an artifact to the message's artifact directory, returning its path and size
+func SaveArtifact(name string, r io.Reader, msg *models.Message) (string, int64, error) {
+	path, err := ArtifactPath(name, msg)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", 0, err
+	}
+	// Don't write through links a script may have left in the directory
+	dir, err := filepath.EvalSymlinks(msg.Vars["_artifact.dir"])
+	if err != nil {
+		return "", 0, err
+	}
+	if parent, err := filepath.EvalSymlinks(filepath.Dir(path)); err != nil || (parent != dir && !inDir(dir, parent)) {
+		return "", 0, fmt.Errorf("Artifact '%s' is not in the artifact directory", name)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		os.Remove(path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", 0, err
+	}
+	size, err := io.Copy(f, io.LimitReader(r, maxArtifactSize+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size > maxArtifactSize {
+		err = fmt.Errorf("Artifact '%s' is larger than %d bytes", name, maxArtifactSize)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+	return path, size, nil
+}
+
+// ReadArtifact reads an artifact from the message's artifact directory, to be uploaded or attached.
+// Links are followed only as long as they stay in the directory; a script can't get other files
+// uploaded by linking to them.
+func ReadArtifact(name string, msg *models.Message) (models.File, error) {
+	path, err := ArtifactPath(name, msg)
+	if err != nil {
+		return models.File{}, err
+	}
+	dir, err := filepath.EvalSymlinks(msg.Vars["_artifact.dir"])
+	if err != nil {
+		return models.File{}, err
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return models.File{}, fmt.Errorf("Could not find artifact '%s'", name)
+	}
+	if !inDir(dir, real) {
+		return models.File{}, fmt.Errorf("Artifact '%s' is not in the artifact directory", name)
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return models.File{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return models.File{}, fmt.Errorf("Artifact '%s' is not a regular file", name)
+	}
+	if info.Size() > maxArtifactSize {
+		return models.File{}, fmt.Errorf("Artifact '%s' is larger than %d bytes", name, maxArtifactSize)
+	}
+	data, err := ioutil.ReadFile(real)
+	if err != nil {
+		return models.File{}, err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if len(contentType) == 0 {
+		contentType = http.DetectContentType(data)
+	}
+	return models.File{Name: filepath.Base(path), ContentType: contentType, Data: data}, nil
+}
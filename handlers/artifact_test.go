@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outside, err := ioutil.TempFile("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(outside.Name())
+	outside.WriteString("secret")
+	outside.Close()
+
+	msg := models.NewMessage()
+	msg.Vars["_artifact.dir"] = dir
+
+	path, size, err := SaveArtifact("report.csv", strings.NewReader("a,b\n1,2\n"), &msg)
+	if err != nil || path != filepath.Join(dir, "report.csv") || size != 8 {
+		t.Fatalf("SaveArtifact() = %s, %d, %v", path, size, err)
+	}
+	if err := os.Symlink(outside.Name(), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{"Name", "report.csv", "a,b\n1,2\n", false},
+		{"Path", path, "a,b\n1,2\n", false},
+		{"Missing", "missing.csv", "", true},
+		{"Outside", outside.Name(), "", true},
+		{"Relative outside", "../" + filepath.Base(outside.Name()), "", true},
+		{"Directory", dir, "", true},
+		{"Link outside", "link", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := ReadArtifact(tt.file, &msg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadArtifact() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && (string(file.Data) != tt.want || file.Name != "report.csv" || len(file.ContentType) == 0) {
+				t.Errorf("ReadArtifact() = %+v", file)
+			}
+		})
+	}
+
+	// Saving through a link replaces the link instead of writing to its target
+	if _, _, err := SaveArtifact("link", strings.NewReader("overwritten"), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(outside.Name()); string(data) != "secret" {
+		t.Errorf("SaveArtifact() wrote through a link: %s", data)
+	}
+
+	delete(msg.Vars, "_artifact.dir")
+	if _, _, err := SaveArtifact("report.csv", strings.NewReader(""), &msg); err == nil {
+		t.Error("SaveArtifact() without an artifact directory should fail")
+	}
+}
+
+func TestHTTPReqArtifact(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"report":"big"}`))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	msg := models.NewMessage()
+	msg.Vars["_artifact.dir"] = dir
+	msg.Vars["date"] = "2019-05-01"
+
+	resp, err := HTTPReq(models.Action{Type: http.MethodGet, URL: ts.URL, Artifact: "report-${date}.json"}, &msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Artifact != filepath.Join(dir, "report-2019-05-01.json") || resp.ArtifactSize != 16 || len(resp.Raw) > 0 {
+		t.Errorf("HTTPReq() = %+v", resp)
+	}
+	if data, _ := ioutil.ReadFile(resp.Artifact); string(data) != `{"report":"big"}` {
+		t.Errorf("HTTPReq() saved %s", data)
+	}
+}
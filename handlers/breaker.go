@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// circuitBreaker stops calling a URL for a while after it failed too many times in a row,
+// so a dead service isn't hammered (e.g. by scheduled rules) and rules fail fast instead of hanging
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	cooldown  time.Duration
+	circuits  map[string]*circuit
+	timeNowFn func() time.Time
+}
+
+// circuit is the state of the breaker for one URL
+type circuit struct {
+	failures  int
+	openUntil time.Time
+}
+
+// breakerKey is the key of the circuit breaker in the context of a rule run
+type breakerKey struct{}
+
+// WithCircuitBreaker returns a context whose rule runs' HTTP actions share a circuit breaker, which
+// opens the circuit for a URL after the given number of consecutive failed requests (network errors
+// or 5xx responses), failing requests to it until the cooldown has passed. Each bot has its own, so
+// one bot's failing service doesn't stop another from calling it. Without one, URLs are always called.
+func WithCircuitBreaker(ctx context.Context, failures int, cooldown time.Duration) context.Context {
+	return context.WithValue(ctx, breakerKey{}, newCircuitBreaker(failures, cooldown))
+}
+
+// newCircuitBreaker creates a circuit breaker; zero failures disables it
+func newCircuitBreaker(failures int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{failures: failures, cooldown: cooldown, circuits: map[string]*circuit{}, timeNowFn: time.Now}
+}
+
+// breakerFor returns the circuit breaker of a rule run, a disabled one if it has none
+func breakerFor(ctx context.Context) *circuitBreaker {
+	if b, ok := ctx.Value(breakerKey{}).(*circuitBreaker); ok {
+		return b
+	}
+	return newCircuitBreaker(0, 0)
+}
+
+// circuitKey identifies the service called, ignoring the query string
+func circuitKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// allow tells whether a URL may be called. Once the cooldown has passed, calls are let through
+// again; the next failure opens the circuit again right away.
+func (b *circuitBreaker) allow(rawURL string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures == 0 {
+		return nil
+	}
+	c, ok := b.circuits[circuitKey(rawURL)]
+	if !ok || c.failures < b.failures || !b.timeNowFn().Before(c.openUntil) {
+		return nil
+	}
+	return fmt.Errorf("Circuit breaker for %s is open after %d failed requests, not calling it until %s",
+		circuitKey(rawURL), c.failures, c.openUntil.Format(time.RFC3339))
+}
+
+// record keeps track of whether a call to a URL succeeded
+func (b *circuitBreaker) record(rawURL string, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures == 0 {
+		return
+	}
+	key := circuitKey(rawURL)
+	if success {
+		delete(b.circuits, key)
+		return
+	}
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+	c.failures++
+	if c.failures >= b.failures {
+		c.openUntil = b.timeNowFn().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// defaultEmailTimeout is how long sending an email may take, unless the action sets 'timeout'
+const defaultEmailTimeout = 30
+
+// SendEmail handles 'email' actions, sending the action's subject and body to its recipients
+// through the SMTP server in bot.yml, with artifacts attached
+func SendEmail(args models.Action, msg *models.Message, bot *models.Bot) error {
+	if len(bot.SMTPHost) == 0 {
+		return fmt.Errorf("Action '%s' can't send email, 'smtp_host' is not set in bot.yml", args.Name)
+	}
+
+	from := args.From
+	if len(from) == 0 {
+		from = bot.SMTPFrom
+	}
+	from, err := utils.Substitute(from, msg.Vars)
+	if err != nil {
+		return err
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return fmt.Errorf("Invalid sender '%s' for action '%s': %s", from, args.Name, err.Error())
+	}
+	to, err := emailAddresses(args.To, msg)
+	if err != nil {
+		return err
+	}
+	cc, err := emailAddresses(args.CC, msg)
+	if err != nil {
+		return err
+	}
+	if len(to)+len(cc) == 0 {
+		return fmt.Errorf("no recipients were supplied for the '%s' action named: %s", args.Type, args.Name)
+	}
+	subject, err := utils.Substitute(args.Subject, msg.Vars)
+	if err != nil {
+		return err
+	}
+	body, err := utils.Substitute(args.Body, msg.Vars)
+	if err != nil {
+		return err
+	}
+	attachments := make([]models.File, len(args.Attachments))
+	for i, a := range args.Attachments {
+		name, err := utils.Substitute(a, msg.Vars)
+		if err != nil {
+			return err
+		}
+		if attachments[i], err = ReadArtifact(name, msg); err != nil {
+			return err
+		}
+	}
+
+	data, err := buildEmail(sender, to, cc, subject, body, attachments, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if args.Timeout == 0 {
+		args.Timeout = defaultEmailTimeout
+	}
+	recipients := make([]string, 0, len(to)+len(cc))
+	for _, a := range append(to, cc...) {
+		recipients = append(recipients, a.Address)
+	}
+	return sendSMTP(msg.Run.Context(), bot, sender.Address, recipients, data, time.Duration(args.Timeout)*time.Second)
+}
+
+// emailAddresses substitutes the variables in a list of email addresses and parses them;
+// an entry may hold several addresses, separated by commas
+func emailAddresses(list []string, msg *models.Message) ([]*mail.Address, error) {
+	addresses := []*mail.Address{}
+	for _, entry := range list {
+		value, err := utils.Substitute(entry, msg.Vars)
+		if err != nil {
+			return nil, err
+		}
+		if len(strings.TrimSpace(value)) == 0 {
+			continue
+		}
+		parsed, err := mail.ParseAddressList(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid email address '%s': %s", value, err.Error())
+		}
+		addresses = append(addresses, parsed...)
+	}
+	return addresses, nil
+}
+
+// buildEmail creates a MIME message with a plain text body and attachments
+func buildEmail(from *mail.Address, to, cc []*mail.Address, subject, body string, attachments []models.File, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		// Values come from chat, don't let them add headers of their own
+		value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	list := func(addresses []*mail.Address) string {
+		s := make([]string, len(addresses))
+		for i, a := range addresses {
+			s[i] = a.String()
+		}
+		return strings.Join(s, ", ")
+	}
+
+	header("From", from.String())
+	if len(to) > 0 {
+		header("To", list(to))
+	}
+	if len(cc) > 0 {
+		header("Cc", list(cc))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject), " ")))
+	header("Date", now.Format(time.RFC1123Z))
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+	header("Message-ID", fmt.Sprintf("<%d.flottbot@%s>", now.UnixNano(), domain))
+	header("MIME-Version", "1.0")
+
+	writeBody := func(w *bytes.Buffer) error {
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(body)); err != nil {
+			return err
+		}
+		return qp.Close()
+	}
+
+	if len(attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeBody(&buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+
+	w, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var text bytes.Buffer
+	if err := writeBody(&text); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(text.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for _, a := range attachments {
+		contentType := a.ContentType
+		if len(contentType) == 0 {
+			contentType = "application/octet-stream"
+		}
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			fmt.Fprintf(w, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(w, "%s\r\n", encoded)
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendSMTP delivers an email through the SMTP server in bot.yml. 'smtp_tls' is 'starttls' (default),
+// 'tls' for servers that only talk TLS (usually port 465), or 'none'. Sending stops when ctx is done.
+func sendSMTP(ctx context.Context, bot *models.Bot, from string, recipients []string, data []byte, timeout time.Duration) error {
+	address, err := utils.Substitute(bot.SMTPHost, map[string]string{})
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+		address = net.JoinHostPort(address, "587")
+	}
+	username, err := utils.Substitute(bot.SMTPUsername, map[string]string{})
+	if err != nil {
+		return err
+	}
+	password, err := utils.Substitute(bot.SMTPPassword, map[string]string{})
+	if err != nil {
+		return err
+	}
+	utils.AddSecret(password)
+
+	mode := strings.ToLower(bot.SMTPTLS)
+	tlsConfig := &tls.Config{ServerName: host}
+	if mode != "" && mode != "starttls" && mode != "tls" && mode != "none" {
+		return fmt.Errorf("Unknown 'smtp_tls: %s', use 'starttls', 'tls', or 'none'", bot.SMTPTLS)
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("Could not connect to SMTP server '%s': %s", address, err.Error())
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// Closing the connection stops the conversation with the server when ctx is done
+	sent := make(chan struct{})
+	defer close(sent)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-sent:
+		}
+	}()
+
+	if mode == "tls" {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return fmt.Errorf("Could not connect to SMTP server '%s': %s", address, err.Error())
+		}
+		conn = tlsConn
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if mode == "" || mode == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server '%s' does not support STARTTLS, set 'smtp_tls: none' to send email unencrypted", address)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if len(username) > 0 {
+		if err := c.Auth(smtp.PlainAuth("", username, password, host)); err != nil {
+			return fmt.Errorf("Could not authenticate with SMTP server '%s': %s", address, err.Error())
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, r := range recipients {
+		if err := c.Rcpt(r); err != nil {
+			return fmt.Errorf("SMTP server '%s' refused recipient '%s': %s", address, r, err.Error())
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
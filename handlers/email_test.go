@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+// fakeSMTP accepts one email without TLS, sending what it received on the returned channel
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var session strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250-localhost")
+				reply("250 8BITMIME")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				session.WriteString(strings.TrimSpace(line) + "\n")
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 Go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					session.WriteString(line)
+				}
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				received <- session.String()
+				return
+			default:
+				reply("502 Not implemented")
+			}
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+func TestSendEmail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr, received := fakeSMTP(t)
+	bot := &models.Bot{SMTPHost: addr, SMTPFrom: "Flottbot <bot@example.com>", SMTPTLS: "none"}
+	msg := models.NewMessage()
+	msg.Vars["_artifact.dir"] = dir
+	msg.Vars["service"] = "api"
+	msg.Vars["owner"] = "owner@example.com"
+	if _, _, err := SaveArtifact("report.csv", strings.NewReader("a,b\n1,2\n"), &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	action := models.Action{
+		Name:        "notify",
+		Type:        "email",
+		To:          []string{"${owner}", ""},
+		CC:          []string{"team@example.com, lead@example.com"},
+		Subject:     "Report for ${service}\r\nBcc: attacker@example.com",
+		Body:        "Here is the report for ${service}.",
+		Attachments: []string{"report.csv"},
+	}
+	if err := SendEmail(action, &msg, bot); err != nil {
+		t.Fatalf("SendEmail() error = %v", err)
+	}
+
+	session := <-received
+	for _, want := range []string{
+		"MAIL FROM:<bot@example.com>",
+		"RCPT TO:<owner@example.com>",
+		"RCPT TO:<team@example.com>",
+		"RCPT TO:<lead@example.com>",
+		"From: \"Flottbot\" <bot@example.com>\r\n",
+		"To: <owner@example.com>\r\n",
+		"Cc: <team@example.com>, <lead@example.com>\r\n",
+		"Subject: Report for api Bcc: attacker@example.com\r\n",
+		"Content-Type: multipart/mixed; boundary=",
+		"Here is the report for api.",
+		"Content-Disposition: attachment; filename=report.csv",
+		"YSxiCjEsMgo=",
+	} {
+		if !strings.Contains(session, want) {
+			t.Errorf("SendEmail() sent\n%s\nwithout %q", session, want)
+		}
+	}
+	if strings.Contains(session, "\r\nBcc:") {
+		t.Errorf("SendEmail() let the subject add a header:\n%s", session)
+	}
+
+	// Parsing the message it sent works
+	data := session[strings.Index(session, "From:"):]
+	if _, err := mail.ReadMessage(strings.NewReader(data)); err != nil {
+		t.Errorf("SendEmail() sent an invalid message: %v", err)
+	}
+}
+
+func TestSendEmailErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		bot    *models.Bot
+		action models.Action
+	}{
+		{"No SMTP server", &models.Bot{}, models.Action{To: []string{"a@example.com"}}},
+		{"No recipients", &models.Bot{SMTPHost: "localhost", SMTPFrom: "bot@example.com"}, models.Action{}},
+		{"Invalid recipient", &models.Bot{SMTPHost: "localhost", SMTPFrom: "bot@example.com"}, models.Action{To: []string{"not an address"}}},
+		{"Invalid sender", &models.Bot{SMTPHost: "localhost"}, models.Action{To: []string{"a@example.com"}}},
+		{"Missing attachment", &models.Bot{SMTPHost: "localhost", SMTPFrom: "bot@example.com"}, models.Action{To: []string{"a@example.com"}, Attachments: []string{"missing.csv"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := models.NewMessage()
+			if err := SendEmail(tt.action, &msg, tt.bot); err == nil {
+				t.Error("SendEmail() should fail")
+			}
+		})
+	}
+
+	// Servers that can't encrypt aren't used unless 'smtp_tls: none' says so
+	addr, _ := fakeSMTP(t)
+	msg := models.NewMessage()
+	err := SendEmail(models.Action{To: []string{"a@example.com"}}, &msg, &models.Bot{SMTPHost: addr, SMTPFrom: "bot@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("SendEmail() error = %v, want a STARTTLS error", err)
+	}
+}
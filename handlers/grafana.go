@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// Grafana renders images with a browser, which takes a while
+const defaultGrafanaTimeout = 60
+
+// Size of rendered panels, unless the action sets 'width' and 'height'
+const (
+	defaultGrafanaWidth  = 1000
+	defaultGrafanaHeight = 500
+)
+
+// GrafanaRender handles 'grafana' actions, rendering a panel of a dashboard (or the whole dashboard,
+// when the action doesn't set 'panel') of the Grafana in bot.yml as a PNG image. The image is returned
+// with the link to what it shows.
+func GrafanaRender(args models.Action, msg *models.Message, bot *models.Bot) (models.File, string, error) {
+	if len(bot.GrafanaURL) == 0 {
+		return models.File{}, "", fmt.Errorf("Action '%s' can't render a Grafana panel, 'grafana_url' is not set in bot.yml", args.Name)
+	}
+	baseURL, err := utils.Substitute(bot.GrafanaURL, map[string]string{})
+	if err != nil {
+		return models.File{}, "", err
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+	token, err := utils.Substitute(bot.GrafanaToken, map[string]string{})
+	if err != nil {
+		return models.File{}, "", err
+	}
+	utils.AddSecret(token)
+
+	dashboard, err := utils.Substitute(args.Dashboard, msg.Vars)
+	if err != nil {
+		return models.File{}, "", err
+	}
+	if len(dashboard) == 0 {
+		return models.File{}, "", fmt.Errorf("no dashboard was supplied for the '%s' action named: %s", args.Type, args.Name)
+	}
+
+	timeRange := time.Hour
+	if len(args.Range) > 0 {
+		if timeRange, err = parseDuration(args.Range, msg); err != nil || timeRange <= 0 {
+			return models.File{}, "", fmt.Errorf("Invalid 'range' '%s' for action '%s', use e.g. 30m, 6h, or 7d", args.Range, args.Name)
+		}
+	}
+
+	params := url.Values{}
+	params.Set("orgId", "1")
+	params.Set("from", "now-"+grafanaDuration(timeRange))
+	params.Set("to", "now")
+	names := make([]string, 0, len(args.DashboardVars))
+	for name := range args.DashboardVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := utils.Substitute(args.DashboardVars[name], msg.Vars)
+		if err != nil {
+			return models.File{}, "", err
+		}
+		params.Set("var-"+name, value)
+	}
+
+	// d-solo shows a single panel, d the whole dashboard; the slug after the UID doesn't matter
+	kind := "d"
+	if args.Panel > 0 {
+		kind = "d-solo"
+		params.Set("panelId", strconv.Itoa(args.Panel))
+	}
+	path := fmt.Sprintf("/%s/%s/flottbot", kind, url.PathEscape(dashboard))
+	link := baseURL + path + "?" + params.Encode()
+	if args.Panel > 0 {
+		// People get the panel within its dashboard
+		linkParams := url.Values{}
+		for k, v := range params {
+			linkParams[k] = v
+		}
+		linkParams.Del("panelId")
+		linkParams.Set("viewPanel", strconv.Itoa(args.Panel))
+		link = fmt.Sprintf("%s/d/%s/flottbot?%s", baseURL, url.PathEscape(dashboard), linkParams.Encode())
+	}
+
+	width, height := args.Width, args.Height
+	if width <= 0 {
+		width = defaultGrafanaWidth
+	}
+	if height <= 0 {
+		height = defaultGrafanaHeight
+	}
+	params.Set("width", strconv.Itoa(width))
+	params.Set("height", strconv.Itoa(height))
+	params.Set("tz", "UTC")
+
+	transport, err := transportFor(args, msg)
+	if err != nil {
+		return models.File{}, "", err
+	}
+	if args.Timeout == 0 {
+		args.Timeout = defaultGrafanaTimeout
+	}
+	client := &http.Client{Timeout: time.Duration(args.Timeout) * time.Second, Transport: transport}
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/render"+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return models.File{}, "", err
+	}
+	// Requests stop when the rule's run is cancelled, times out, or is abandoned
+	req = req.WithContext(msg.Run.Context())
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if len(msg.TraceParent) > 0 {
+		req.Header.Set("traceparent", msg.TraceParent)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return models.File{}, "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return models.File{}, "", err
+	}
+	if resp.StatusCode != http.StatusOK || !bytes.HasPrefix(data, []byte("\x89PNG")) {
+		if len(data) > 200 {
+			data = data[:200]
+		}
+		return models.File{}, "", fmt.Errorf("Grafana could not render dashboard '%s' (%d): %s", dashboard, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	name := dashboard
+	if args.Panel > 0 {
+		name = fmt.Sprintf("%s-%d", dashboard, args.Panel)
+	}
+	return models.File{Name: name + ".png", ContentType: "image/png", Data: data}, link, nil
+}
+
+// grafanaDuration writes a duration the way Grafana's relative times take it, e.g. 90m or 7d
+func grafanaDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
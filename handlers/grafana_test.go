@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestGrafanaRender(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\nimage"
+	var gotURL string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL = r.URL.String()
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"Unauthorized"}`))
+			return
+		}
+		if strings.Contains(r.URL.Path, "missing") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Dashboard not found"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(png))
+	}))
+	defer ts.Close()
+	bot := &models.Bot{GrafanaURL: ts.URL + "/", GrafanaToken: "token"}
+
+	tests := []struct {
+		name     string
+		action   models.Action
+		wantURL  string
+		wantLink string
+		wantFile string
+		wantErr  bool
+	}{
+		{"Panel", models.Action{Dashboard: "svc-${service}", Panel: 4, Range: "6h", DashboardVars: map[string]string{"service": "${service}", "env": "prod"}},
+			"/render/d-solo/svc-api/flottbot?from=now-6h&height=500&orgId=1&panelId=4&to=now&tz=UTC&var-env=prod&var-service=api&width=1000",
+			"/d/svc-api/flottbot?from=now-6h&orgId=1&to=now&var-env=prod&var-service=api&viewPanel=4",
+			"svc-api-4.png", false},
+		{"Dashboard", models.Action{Dashboard: "overview", Width: 1600, Height: 900},
+			"/render/d/overview/flottbot?from=now-1h&height=900&orgId=1&to=now&tz=UTC&width=1600",
+			"/d/overview/flottbot?from=now-1h&orgId=1&to=now",
+			"overview.png", false},
+		{"Days", models.Action{Dashboard: "overview", Range: "7d"}, "/render/d/overview/flottbot?from=now-7d&height=500&orgId=1&to=now&tz=UTC&width=1000", "", "", false},
+		{"Not found", models.Action{Dashboard: "missing"}, "", "", "", true},
+		{"No dashboard", models.Action{}, "", "", "", true},
+		{"Invalid range", models.Action{Dashboard: "overview", Range: "later"}, "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := models.NewMessage()
+			msg.Vars["service"] = "api"
+			file, link, err := GrafanaRender(tt.action, &msg, bot)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GrafanaRender() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if gotURL != tt.wantURL {
+				t.Errorf("GrafanaRender() requested %s, want %s", gotURL, tt.wantURL)
+			}
+			if len(tt.wantLink) > 0 && link != ts.URL+tt.wantLink {
+				t.Errorf("GrafanaRender() link = %s, want %s", link, ts.URL+tt.wantLink)
+			}
+			if len(tt.wantFile) > 0 && (file.Name != tt.wantFile || string(file.Data) != png || file.ContentType != "image/png") {
+				t.Errorf("GrafanaRender() file = %+v", file)
+			}
+		})
+	}
+}
+
+func Test_grafanaDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		90 * time.Minute:        "90m",
+		6 * time.Hour:           "6h",
+		48 * time.Hour:          "2d",
+		1500 * time.Millisecond: "1s",
+	}
+	for d, want := range tests {
+		if got := grafanaDuration(d); got != want {
+			t.Errorf("grafanaDuration(%s) = %s, want %s", d, got, want)
+		}
+	}
+}
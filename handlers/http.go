@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,6 +16,12 @@ import (
 	"github.com/target/flottbot/utils"
 )
 
+// defaultRetryBackoff is how long to wait before the first retry of a failed request; the wait doubles after each retry
+const defaultRetryBackoff = time.Second
+
+// defaultRetryOnStatus are the response statuses retried when 'retry_on_status' is not set
+var defaultRetryOnStatus = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
 // HTTPReq handles 'http' actions for rules
 func HTTPReq(args models.Action, msg *models.Message) (*models.HTTPResponse, error) {
 	if args.Timeout == 0 {
@@ -21,8 +29,14 @@ func HTTPReq(args models.Action, msg *models.Message) (*models.HTTPResponse, err
 		args.Timeout = 10
 	}
 
+	transport, err := transportFor(args, msg)
+	if err != nil {
+		return nil, err
+	}
+
 	client := &http.Client{
-		Timeout: time.Duration(args.Timeout) * time.Second,
+		Timeout:   time.Duration(args.Timeout) * time.Second,
+		Transport: transport,
 	}
 
 	// check the URL string from defined action has a variable, try to substitute it
@@ -41,11 +55,96 @@ func HTTPReq(args models.Action, msg *models.Message) (*models.HTTPResponse, err
 		return nil, err
 	}
 
+	// Keep the payload around, it is sent again on retries
+	var body []byte
+	if payload != nil {
+		if body, err = ioutil.ReadAll(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	backoff := defaultRetryBackoff
+	if len(args.RetryBackoff) > 0 {
+		if backoff, err = time.ParseDuration(args.RetryBackoff); err != nil {
+			return nil, fmt.Errorf("Invalid 'retry_backoff' '%s': %s", args.RetryBackoff, err.Error())
+		}
+	}
+
+	// Requests stop when the rule's run is cancelled, times out, or is abandoned
+	ctx := msg.Run.Context()
+	breaker := breakerFor(ctx)
+
+	refreshedToken := false
+	for attempt := 0; ; attempt++ {
+		if err := breaker.allow(url); err != nil {
+			return nil, err
+		}
+
+		result, err := doRequest(ctx, client, args, url, body, msg)
+		// Cancelled requests say nothing about the service
+		if (err == nil || isNetworkError(err)) && ctx.Err() == nil {
+			breaker.record(url, err == nil && result.Status < http.StatusInternalServerError)
+		}
+
+		// The OAuth2 token may have been revoked, get a new one and try again once
+		if err == nil && result.Status == http.StatusUnauthorized && !refreshedToken && forgetOAuth2Tokens(args, msg) {
+			refreshedToken = true
+			attempt--
+			continue
+		}
+
+		if attempt >= args.Retries || !shouldRetry(args, result, err) || ctx.Err() != nil {
+			return result, err
+		}
+		select {
+		case <-time.After(backoff << uint(attempt)):
+		case <-ctx.Done():
+			return result, err
+		}
+	}
+}
+
+// shouldRetry tells whether a request failed in a way that is worth another try
+func shouldRetry(args models.Action, result *models.HTTPResponse, err error) bool {
+	if err != nil {
+		return isNetworkError(err)
+	}
+	retryOn := args.RetryOnStatus
+	if len(retryOn) == 0 {
+		retryOn = defaultRetryOnStatus
+	}
+	for _, status := range retryOn {
+		if result.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// isNetworkError tells whether a request failed to reach the service, as opposed to e.g. having an invalid URL
+func isNetworkError(err error) bool {
+	urlErr, ok := err.(*url.Error)
+	return ok && urlErr.Op != "parse"
+}
+
+// doRequest makes a single request for an action
+func doRequest(ctx context.Context, client *http.Client, args models.Action, url string, body []byte, msg *models.Message) (*models.HTTPResponse, error) {
+	var payload io.Reader
+	if body != nil {
+		payload = bytes.NewReader(body)
+	}
+
 	req, err := http.NewRequest(args.Type, url, payload)
 	if err != nil {
 		return nil, err
 	}
 	req.Close = true
+	req = req.WithContext(ctx)
+
+	// Propagate the trace so the receiving service can join it
+	if len(msg.TraceParent) > 0 {
+		req.Header.Set("traceparent", msg.TraceParent)
+	}
 
 	// Add custom headers to request
 	for k, v := range args.CustomHeaders {
@@ -56,6 +155,22 @@ func HTTPReq(args models.Action, msg *models.Message) (*models.HTTPResponse, err
 		req.Header.Add(k, value)
 	}
 
+	// Authenticate with OAuth2 access tokens
+	for _, auth := range args.Auth {
+		if !strings.EqualFold(auth.Type, "oauth2") {
+			continue
+		}
+		oauth2, err := newOAuth2Client(auth, msg)
+		if err != nil {
+			return nil, err
+		}
+		token, err := oauth2.token(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -63,6 +178,19 @@ func HTTPReq(args models.Action, msg *models.Message) (*models.HTTPResponse, err
 
 	defer resp.Body.Close()
 
+	// Save the response as a file for later actions instead of keeping it in memory
+	if len(args.Artifact) > 0 {
+		name, err := utils.Substitute(args.Artifact, msg.Vars)
+		if err != nil {
+			return nil, err
+		}
+		path, size, err := SaveArtifact(name, resp.Body, msg)
+		if err != nil {
+			return nil, err
+		}
+		return &models.HTTPResponse{Status: resp.StatusCode, Artifact: path, ArtifactSize: size}, nil
+	}
+
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -82,6 +210,21 @@ func HTTPReq(args models.Action, msg *models.Message) (*models.HTTPResponse, err
 	return &result, nil
 }
 
+// forgetOAuth2Tokens drops the cached OAuth2 tokens of an action, telling whether it uses any
+func forgetOAuth2Tokens(args models.Action, msg *models.Message) bool {
+	forgot := false
+	for _, auth := range args.Auth {
+		if !strings.EqualFold(auth.Type, "oauth2") {
+			continue
+		}
+		if oauth2, err := newOAuth2Client(auth, msg); err == nil {
+			oauth2.forget()
+			forgot = true
+		}
+	}
+	return forgot
+}
+
 // Depending on the type of request we want to deal with the payload accordingly
 func prepRequestData(url, actionType string, data map[string]interface{}, msg *models.Message) (string, io.Reader, error) {
 	if len(data) > 0 {
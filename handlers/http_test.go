@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"context"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/target/flottbot/models"
 )
@@ -232,3 +235,134 @@ func Test_createJSONPayload(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPReqRetries(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		// Fail twice, then succeed; the payload must be sent every time
+		if calls <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name          string
+		retries       int
+		retryOnStatus []int
+		wantStatus    int
+		wantCalls     int
+	}{
+		{"No retries", 0, nil, http.StatusServiceUnavailable, 1},
+		{"Retried until success", 3, nil, http.StatusOK, 3},
+		{"Out of retries", 1, nil, http.StatusServiceUnavailable, 2},
+		{"Status not retried", 3, []int{http.StatusBadGateway}, http.StatusServiceUnavailable, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			msg := models.NewMessage()
+			action := models.Action{
+				Name:          "Retry Action",
+				Type:          "POST",
+				URL:           ts.URL,
+				QueryData:     map[string]interface{}{"key": "value"},
+				Retries:       tt.retries,
+				RetryBackoff:  "1ms",
+				RetryOnStatus: tt.retryOnStatus,
+			}
+			got, err := HTTPReq(action, &msg)
+			if err != nil {
+				t.Fatalf("HTTPReq() error = %v", err)
+			}
+			if got.Status != tt.wantStatus || calls != tt.wantCalls {
+				t.Errorf("HTTPReq() status = %d after %d calls, want %d after %d calls", got.Status, calls, tt.wantStatus, tt.wantCalls)
+			}
+			if got.Status == http.StatusOK && got.Raw != `{"key":"value"}` {
+				t.Errorf("HTTPReq() payload on retry = %s, want %s", got.Raw, `{"key":"value"}`)
+			}
+		})
+	}
+}
+
+func TestHTTPReqCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	msg := models.NewMessage()
+	ctx, cancel := context.WithCancel(context.Background())
+	msg.Run = models.NewRunContext(ctx)
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	action := models.Action{Name: "Slow Action", Type: "GET", URL: ts.URL, Timeout: 10, Retries: 3, RetryBackoff: "1ms"}
+	if _, err := HTTPReq(action, &msg); err == nil {
+		t.Error("HTTPReq() expected an error for a cancelled request")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("HTTPReq() took %s to give up the cancelled request", elapsed)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	ctx := WithCircuitBreaker(context.Background(), 2, time.Minute)
+	now := time.Now()
+	breakerFor(ctx).timeNowFn = func() time.Time { return now }
+
+	msg := models.NewMessage()
+	msg.Run = models.NewRunContext(ctx)
+	action := models.Action{Name: "Breaker Action", Type: "GET", URL: ts.URL + "/status?check=1"}
+	for i := 0; i < 2; i++ {
+		if _, err := HTTPReq(action, &msg); err != nil {
+			t.Fatalf("HTTPReq() error = %v", err)
+		}
+	}
+
+	// The circuit is open for the URL, whatever the query string
+	action.URL = ts.URL + "/status?check=2"
+	if _, err := HTTPReq(action, &msg); err == nil {
+		t.Error("HTTPReq() with an open circuit should fail")
+	}
+	if calls != 2 {
+		t.Errorf("HTTPReq() with an open circuit called the URL, %d calls", calls)
+	}
+
+	// Other URLs are not affected
+	action.URL = ts.URL + "/other"
+	if _, err := HTTPReq(action, &msg); err != nil {
+		t.Errorf("HTTPReq() to another URL error = %v", err)
+	}
+
+	// After the cooldown, the URL is called again
+	now = now.Add(2 * time.Minute)
+	action.URL = ts.URL + "/status"
+	if _, err := HTTPReq(action, &msg); err != nil {
+		t.Errorf("HTTPReq() after the cooldown error = %v", err)
+	}
+	if calls != 4 {
+		t.Errorf("HTTPReq() after the cooldown made %d calls, want 4", calls)
+	}
+
+	// The runs of other bots have circuit breakers of their own
+	other := models.NewMessage()
+	other.Run = models.NewRunContext(WithCircuitBreaker(context.Background(), 2, time.Minute))
+	if _, err := HTTPReq(action, &other); err != nil {
+		t.Errorf("HTTPReq() of another bot error = %v", err)
+	}
+}
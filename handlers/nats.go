@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/target/flottbot/models"
+)
+
+// publishNATS publishes a message to a NATS subject. It speaks just enough of the NATS
+// client protocol to connect, publish, and wait for the server to acknowledge it.
+// The servers in the broker's addresses are tried in order.
+func publishNATS(ctx context.Context, conf models.Broker, subject, payload string) error {
+	if strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("Invalid NATS subject '%s'", subject)
+	}
+	addresses := conf.Addresses
+	if len(addresses) == 0 {
+		addresses = []string{"nats://localhost:4222"}
+	}
+
+	var err error
+	for _, address := range addresses {
+		if err = publishNATSServer(ctx, address, conf, subject, payload); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// publishNATSServer publishes a message to one NATS server
+func publishNATSServer(ctx context.Context, address string, conf models.Broker, subject, payload string) error {
+	if !strings.Contains(address, "://") {
+		address = "nats://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if len(u.Port()) == 0 {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// The server introduces itself first
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("Unexpected greeting from NATS server '%s': %s", u.Host, strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line[len("INFO "):])), &info); err != nil {
+		return fmt.Errorf("Invalid greeting from NATS server '%s': %s", u.Host, err.Error())
+	}
+
+	if info.TLSRequired || conf.TLS || u.Scheme == "tls" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	connect := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "flottbot",
+		"lang":     "go",
+		"version":  "",
+		"protocol": 0,
+	}
+	user, pass := conf.Username, conf.Password
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	}
+	switch {
+	case len(user) > 0 && len(pass) > 0:
+		connect["user"] = user
+		connect["pass"] = pass
+	case len(user) > 0:
+		connect["auth_token"] = user
+	case len(pass) > 0:
+		connect["auth_token"] = pass
+	}
+	connectJSON, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+
+	command := fmt.Sprintf("CONNECT %s\r\nPUB %s %d\r\n%s\r\nPING\r\n", connectJSON, subject, len(payload), payload)
+	if _, err := conn.Write([]byte(command)); err != nil {
+		return err
+	}
+
+	// Once the server answers the PING, it has processed the message
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			conn.Write([]byte("PONG\r\n"))
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server '%s' refused the message: %s", u.Host, strings.Trim(strings.TrimSpace(line[len("-ERR"):]), "'"))
+		}
+	}
+}
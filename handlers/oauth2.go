@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// oauth2ExpiryMargin renews tokens this long before they expire, so they don't expire mid-request
+const oauth2ExpiryMargin = 30 * time.Second
+
+// oauth2DefaultLifetime is how long tokens are cached when the token endpoint doesn't say when they expire
+const oauth2DefaultLifetime = 5 * time.Minute
+
+// oauth2Token is an access token and when it expires
+type oauth2Token struct {
+	accessToken string
+	expiry      time.Time
+}
+
+// oauth2Tokens caches access tokens, keyed by token URL, client ID, and scopes,
+// so rules using the same client share its token
+var oauth2Tokens = struct {
+	sync.Mutex
+	byClient  map[string]oauth2Token
+	timeNowFn func() time.Time
+}{byClient: map[string]oauth2Token{}, timeNowFn: time.Now}
+
+// oauth2Client is an 'oauth2' auth entry of an action, with its variables substituted
+type oauth2Client struct {
+	tokenURL, clientID, clientSecret string
+	scopes                           []string
+}
+
+// key identifies the client's tokens in the cache
+func (c oauth2Client) key() string {
+	return c.tokenURL + "|" + c.clientID + "|" + strings.Join(c.scopes, " ")
+}
+
+// newOAuth2Client reads an action's 'oauth2' auth entry
+func newOAuth2Client(auth models.Auth, msg *models.Message) (oauth2Client, error) {
+	fields := []string{auth.TokenURL, auth.ClientID, auth.ClientSecret}
+	for i, f := range fields {
+		value, err := utils.Substitute(f, msg.Vars)
+		if err != nil {
+			return oauth2Client{}, err
+		}
+		fields[i] = value
+	}
+	if len(fields[0]) == 0 || len(fields[1]) == 0 {
+		return oauth2Client{}, fmt.Errorf("'token_url' and 'client_id' are required for oauth2 auth")
+	}
+	utils.AddSecret(fields[2])
+	return oauth2Client{tokenURL: fields[0], clientID: fields[1], clientSecret: fields[2], scopes: auth.Scopes}, nil
+}
+
+// token gets an access token for the client with the client credentials grant, reusing it until it is about to expire.
+// The request stops when ctx is done.
+func (c oauth2Client) token(ctx context.Context, client *http.Client) (string, error) {
+	oauth2Tokens.Lock()
+	defer oauth2Tokens.Unlock()
+	if t, ok := oauth2Tokens.byClient[c.key()]; ok && oauth2Tokens.timeNowFn().Add(oauth2ExpiryMargin).Before(t.expiry) {
+		return t.accessToken, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Could not get OAuth2 token: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("Could not get OAuth2 token: %s", err.Error())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Could not get OAuth2 token: %s returned %d: %s", c.tokenURL, resp.StatusCode, utils.Redact(string(body)))
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("Could not get OAuth2 token: %s", err.Error())
+	}
+	if len(result.AccessToken) == 0 {
+		return "", fmt.Errorf("Could not get OAuth2 token: %s returned no access_token", c.tokenURL)
+	}
+	// Never log the token
+	utils.AddSecret(result.AccessToken)
+
+	lifetime := oauth2DefaultLifetime
+	if result.ExpiresIn > 0 {
+		lifetime = time.Duration(result.ExpiresIn) * time.Second
+	}
+	oauth2Tokens.byClient[c.key()] = oauth2Token{accessToken: result.AccessToken, expiry: oauth2Tokens.timeNowFn().Add(lifetime)}
+	return result.AccessToken, nil
+}
+
+// forget drops the client's cached token, e.g. because it was revoked
+func (c oauth2Client) forget() {
+	oauth2Tokens.Lock()
+	defer oauth2Tokens.Unlock()
+	delete(oauth2Tokens.byClient, c.key())
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestHTTPReqOAuth2(t *testing.T) {
+	issued := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "bot" || secret != "s3cr3t" || r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "read write" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid_client"}`))
+			return
+		}
+		issued++
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "bearer", "expires_in": 3600}`, issued)
+	}))
+	defer tokenServer.Close()
+
+	revoked := ""
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if auth == "" || auth == "Bearer "+revoked {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(auth))
+	}))
+	defer api.Close()
+
+	now := time.Now()
+	oauth2Tokens.timeNowFn = func() time.Time { return now }
+	defer func() { oauth2Tokens.timeNowFn = time.Now }()
+
+	msg := models.NewMessage()
+	msg.Vars["client_secret"] = "s3cr3t"
+	action := models.Action{
+		Name: "OAuth2 Action",
+		Type: "GET",
+		URL:  api.URL,
+		Auth: []models.Auth{{
+			Type:         "oauth2",
+			TokenURL:     tokenServer.URL,
+			ClientID:     "bot",
+			ClientSecret: "${client_secret}",
+			Scopes:       []string{"read", "write"},
+		}},
+	}
+
+	steps := []struct {
+		name    string
+		before  func()
+		want    string
+		wantErr bool
+	}{
+		{"Token is fetched", func() {}, "Bearer token-1", false},
+		{"Token is reused", func() {}, "Bearer token-1", false},
+		{"Token is renewed before it expires", func() { now = now.Add(time.Hour - 10*time.Second) }, "Bearer token-2", false},
+		{"Revoked token is replaced", func() { revoked = "token-2" }, "Bearer token-3", false},
+		{"Invalid client", func() { msg.Vars["client_secret"] = "wrong"; oauth2Tokens.byClient = map[string]oauth2Token{} }, "", true},
+	}
+	for _, step := range steps {
+		step.before()
+		got, err := HTTPReq(action, &msg)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: HTTPReq() error = %v, wantErr %v", step.name, err, step.wantErr)
+		}
+		if err == nil && got.Raw != step.want {
+			t.Errorf("%s: HTTPReq() sent %q, want %q", step.name, got.Raw, step.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// defaultOnCallTimeout is how long on-call lookups may take, unless the action sets 'timeout'
+const defaultOnCallTimeout = 10
+
+// Where the on-call providers' APIs are, unless bot.yml says otherwise (e.g. Opsgenie's EU instance)
+const (
+	defaultPagerDutyURL = "https://api.pagerduty.com"
+	defaultOpsgenieURL  = "https://api.opsgenie.com"
+)
+
+// uuidPattern tells Opsgenie schedule IDs from names
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// OnCall handles 'oncall' actions, looking up who is on call for a PagerDuty or Opsgenie schedule right now
+func OnCall(args models.Action, msg *models.Message, bot *models.Bot) ([]models.OnCall, error) {
+	schedule, err := utils.Substitute(args.Schedule, msg.Vars)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedule) == 0 {
+		return nil, fmt.Errorf("no schedule was supplied for the '%s' action named: %s", args.Type, args.Name)
+	}
+
+	transport, err := transportFor(args, msg)
+	if err != nil {
+		return nil, err
+	}
+	if args.Timeout == 0 {
+		args.Timeout = defaultOnCallTimeout
+	}
+	client := &http.Client{Timeout: time.Duration(args.Timeout) * time.Second, Transport: transport}
+
+	switch strings.ToLower(args.Provider) {
+	case "pagerduty":
+		return pagerDutyOnCall(client, schedule, msg, bot)
+	case "opsgenie":
+		return opsgenieOnCall(client, schedule, msg, bot)
+	default:
+		return nil, fmt.Errorf("Unknown on-call provider '%s' for action '%s', use 'pagerduty' or 'opsgenie'", args.Provider, args.Name)
+	}
+}
+
+// pagerDutyOnCall looks up who is on call for a PagerDuty schedule (by ID)
+func pagerDutyOnCall(client *http.Client, schedule string, msg *models.Message, bot *models.Bot) ([]models.OnCall, error) {
+	baseURL, token, err := onCallSettings(bot.PagerDutyURL, defaultPagerDutyURL, bot.PagerDutyToken, "pagerduty_token")
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"schedule_ids[]": {schedule}, "include[]": {"users"}, "earliest": {"true"}}
+
+	var resp struct {
+		OnCalls []struct {
+			EscalationLevel int       `json:"escalation_level"`
+			End             time.Time `json:"end"`
+			User            struct {
+				Name  string `json:"name"`
+				Email string `json:"email"`
+			} `json:"user"`
+		} `json:"oncalls"`
+	}
+	headers := map[string]string{"Authorization": "Token token=" + token, "Accept": "application/vnd.pagerduty+json;version=2"}
+	if err := onCallRequest(client, baseURL+"/oncalls?"+query.Encode(), headers, msg, &resp); err != nil {
+		return nil, err
+	}
+
+	// Whoever is first in line comes first
+	sort.SliceStable(resp.OnCalls, func(i, j int) bool {
+		return resp.OnCalls[i].EscalationLevel < resp.OnCalls[j].EscalationLevel
+	})
+	onCalls := make([]models.OnCall, len(resp.OnCalls))
+	for i, o := range resp.OnCalls {
+		onCalls[i] = models.OnCall{Name: o.User.Name, Email: o.User.Email, Until: o.End}
+	}
+	return onCalls, nil
+}
+
+// opsgenieOnCall looks up who is on call for an Opsgenie schedule (by name or ID)
+func opsgenieOnCall(client *http.Client, schedule string, msg *models.Message, bot *models.Bot) ([]models.OnCall, error) {
+	baseURL, token, err := onCallSettings(bot.OpsgenieURL, defaultOpsgenieURL, bot.OpsgenieToken, "opsgenie_token")
+	if err != nil {
+		return nil, err
+	}
+	identifierType := "name"
+	if uuidPattern.MatchString(schedule) {
+		identifierType = "id"
+	}
+	headers := map[string]string{"Authorization": "GenieKey " + token}
+
+	var resp struct {
+		Data struct {
+			OnCallRecipients []string `json:"onCallRecipients"`
+		} `json:"data"`
+	}
+	endpoint := fmt.Sprintf("%s/v2/schedules/%s/on-calls?scheduleIdentifierType=%s&flat=true", baseURL, url.PathEscape(schedule), identifierType)
+	if err := onCallRequest(client, endpoint, headers, msg, &resp); err != nil {
+		return nil, err
+	}
+
+	// Opsgenie only tells the usernames (email addresses) of who's on call
+	onCalls := make([]models.OnCall, len(resp.Data.OnCallRecipients))
+	for i, username := range resp.Data.OnCallRecipients {
+		var user struct {
+			Data struct {
+				FullName string `json:"fullName"`
+			} `json:"data"`
+		}
+		onCalls[i] = models.OnCall{Name: username, Email: username}
+		if err := onCallRequest(client, baseURL+"/v2/users/"+url.PathEscape(username), headers, msg, &user); err == nil && len(user.Data.FullName) > 0 {
+			onCalls[i].Name = user.Data.FullName
+		}
+	}
+	return onCalls, nil
+}
+
+// onCallSettings resolves a provider's URL and token from bot.yml
+func onCallSettings(baseURL, defaultURL, token, tokenSetting string) (string, string, error) {
+	if len(token) == 0 {
+		return "", "", fmt.Errorf("'%s' is not set in bot.yml", tokenSetting)
+	}
+	if len(baseURL) == 0 {
+		baseURL = defaultURL
+	}
+	baseURL, err := utils.Substitute(baseURL, map[string]string{})
+	if err != nil {
+		return "", "", err
+	}
+	token, err = utils.Substitute(token, map[string]string{})
+	if err != nil {
+		return "", "", err
+	}
+	utils.AddSecret(token)
+	return strings.TrimRight(baseURL, "/"), token, nil
+}
+
+// onCallRequest gets a JSON document from an on-call provider's API
+func onCallRequest(client *http.Client, endpoint string, headers map[string]string, msg *models.Message, result interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	// Requests stop when the rule's run is cancelled, times out, or is abandoned
+	req = req.WithContext(msg.Run.Context())
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if len(msg.TraceParent) > 0 {
+		req.Header.Set("traceparent", msg.TraceParent)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("On-call lookup failed (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, result)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestOnCall(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/oncalls" && r.Header.Get("Authorization") == "Token token=pd" && r.URL.Query().Get("schedule_ids[]") == "PABC123":
+			w.Write([]byte(`{"oncalls":[
+				{"escalation_level":2,"end":"2019-05-02T09:00:00Z","user":{"name":"Backup Person","email":"backup@example.com"}},
+				{"escalation_level":1,"end":"2019-05-01T17:00:00Z","user":{"name":"Jane Doe","email":"jane@example.com"}}]}`))
+		case r.URL.Path == "/v2/schedules/SRE Primary/on-calls" && r.Header.Get("Authorization") == "GenieKey og" && r.URL.Query().Get("scheduleIdentifierType") == "name":
+			w.Write([]byte(`{"data":{"onCallRecipients":["john@example.com","ghost@example.com"]}}`))
+		case r.URL.Path == "/v2/users/john@example.com":
+			w.Write([]byte(`{"data":{"fullName":"John Smith","username":"john@example.com"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"not found"}`))
+		}
+	}))
+	defer ts.Close()
+	bot := &models.Bot{PagerDutyURL: ts.URL, PagerDutyToken: "pd", OpsgenieURL: ts.URL + "/", OpsgenieToken: "og"}
+
+	tests := []struct {
+		name    string
+		bot     *models.Bot
+		action  models.Action
+		want    []models.OnCall
+		wantErr bool
+	}{
+		{"PagerDuty", bot, models.Action{Provider: "pagerduty", Schedule: "${schedule}"}, []models.OnCall{
+			{Name: "Jane Doe", Email: "jane@example.com", Until: time.Date(2019, 5, 1, 17, 0, 0, 0, time.UTC)},
+			{Name: "Backup Person", Email: "backup@example.com", Until: time.Date(2019, 5, 2, 9, 0, 0, 0, time.UTC)},
+		}, false},
+		{"Opsgenie", bot, models.Action{Provider: "Opsgenie", Schedule: "SRE Primary"}, []models.OnCall{
+			{Name: "John Smith", Email: "john@example.com"},
+			{Name: "ghost@example.com", Email: "ghost@example.com"},
+		}, false},
+		{"Unknown schedule", bot, models.Action{Provider: "pagerduty", Schedule: "PNOPE"}, nil, true},
+		{"No schedule", bot, models.Action{Provider: "pagerduty"}, nil, true},
+		{"Unknown provider", bot, models.Action{Provider: "victorops", Schedule: "x"}, nil, true},
+		{"No token", &models.Bot{}, models.Action{Provider: "opsgenie", Schedule: "x"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := models.NewMessage()
+			msg.Vars["schedule"] = "PABC123"
+			got, err := OnCall(tt.action, &msg, tt.bot)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OnCall() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OnCall() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// defaultPromTimeout is how long Prometheus and Alertmanager requests may take, unless the action sets 'timeout'
+const defaultPromTimeout = 10
+
+// promPoints is how many samples range queries return per series when the action doesn't set 'step'
+const promPoints = 60
+
+// PromQuery handles 'prometheus' actions, running the action's PromQL query against the Prometheus
+// in bot.yml: an instant query, or a range query over the last 'range' (e.g. 1h) when it's set
+func PromQuery(args models.Action, msg *models.Message, bot *models.Bot, now time.Time) ([]models.PromSeries, error) {
+	if len(bot.PrometheusURL) == 0 {
+		return nil, fmt.Errorf("Action '%s' can't query Prometheus, 'prometheus_url' is not set in bot.yml", args.Name)
+	}
+	query, err := utils.Substitute(args.Query, msg.Vars)
+	if err != nil {
+		return nil, err
+	}
+	if len(query) == 0 {
+		return nil, fmt.Errorf("no query was supplied for the '%s' action named: %s", args.Type, args.Name)
+	}
+
+	params := url.Values{"query": {query}}
+	path := "/api/v1/query"
+	if len(args.Range) > 0 {
+		r, err := parseDuration(args.Range, msg)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid 'range' for action '%s': %s", args.Name, err.Error())
+		}
+		step := r / promPoints
+		if len(args.Step) > 0 {
+			if step, err = parseDuration(args.Step, msg); err != nil {
+				return nil, fmt.Errorf("Invalid 'step' for action '%s': %s", args.Name, err.Error())
+			}
+		}
+		if step < time.Second {
+			step = time.Second
+		}
+		path = "/api/v1/query_range"
+		params.Set("start", promTime(now.Add(-r)))
+		params.Set("end", promTime(now))
+		params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	} else {
+		params.Set("time", promTime(now))
+	}
+
+	var data struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}
+	err = promRequest(args, msg, bot.PrometheusURL, bot.PrometheusToken, http.MethodGet, path+"?"+params.Encode(), nil, &data)
+	if err != nil {
+		return nil, err
+	}
+	return parsePromResult(data.ResultType, data.Result)
+}
+
+// CreateSilence handles 'silence' actions, silencing the alerts matching the action's 'matchers'
+// in the Alertmanager in bot.yml for 'duration' (e.g. 2h)
+func CreateSilence(args models.Action, msg *models.Message, bot *models.Bot, now time.Time) (*models.Silence, error) {
+	if len(bot.AlertmanagerURL) == 0 {
+		return nil, fmt.Errorf("Action '%s' can't create a silence, 'alertmanager_url' is not set in bot.yml", args.Name)
+	}
+	if len(args.Matchers) == 0 {
+		return nil, fmt.Errorf("no matchers were supplied for the '%s' action named: %s", args.Type, args.Name)
+	}
+	duration, err := parseDuration(args.Duration, msg)
+	if err != nil || duration <= 0 {
+		return nil, fmt.Errorf("Invalid 'duration' '%s' for action '%s', use e.g. 30m, 2h, or 1d", args.Duration, args.Name)
+	}
+
+	type matcher struct {
+		Name    string `json:"name"`
+		Value   string `json:"value"`
+		IsRegex bool   `json:"isRegex"`
+	}
+	matchers := []matcher{}
+	for name, value := range args.Matchers {
+		v, err := utils.Substitute(value, msg.Vars)
+		if err != nil {
+			return nil, err
+		}
+		// A silence matching everything would hide every alert
+		if len(v) == 0 {
+			return nil, fmt.Errorf("Matcher '%s' of action '%s' is empty", name, args.Name)
+		}
+		matchers = append(matchers, matcher{Name: name, Value: v})
+	}
+	sort.Slice(matchers, func(i, j int) bool { return matchers[i].Name < matchers[j].Name })
+
+	comment, err := utils.Substitute(args.Comment, msg.Vars)
+	if err != nil {
+		return nil, err
+	}
+	createdBy := msg.Vars["_user.name"]
+	if len(createdBy) == 0 {
+		createdBy = "flottbot"
+	}
+	if len(comment) == 0 {
+		comment = "Silenced from chat by " + createdBy
+	}
+
+	silence := map[string]interface{}{
+		"matchers":  matchers,
+		"startsAt":  now.UTC().Format(time.RFC3339),
+		"endsAt":    now.Add(duration).UTC().Format(time.RFC3339),
+		"createdBy": createdBy,
+		"comment":   comment,
+	}
+	body, err := json.Marshal(silence)
+	if err != nil {
+		return nil, err
+	}
+
+	var created struct {
+		SilenceID string `json:"silenceID"`
+	}
+	err = promRequest(args, msg, bot.AlertmanagerURL, bot.AlertmanagerToken, http.MethodPost, "/api/v2/silences", body, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Silence{ID: created.SilenceID, EndsAt: now.Add(duration)}, nil
+}
+
+// promRequest calls the Prometheus or Alertmanager API, decoding the response into result.
+// Prometheus wraps its responses in {"status": ..., "data": ...}, Alertmanager doesn't.
+func promRequest(args models.Action, msg *models.Message, baseURL, token, method, path string, body []byte, result interface{}) error {
+	baseURL, err := utils.Substitute(baseURL, map[string]string{})
+	if err != nil {
+		return err
+	}
+	token, err = utils.Substitute(token, map[string]string{})
+	if err != nil {
+		return err
+	}
+	utils.AddSecret(token)
+
+	transport, err := transportFor(args, msg)
+	if err != nil {
+		return err
+	}
+	if args.Timeout == 0 {
+		args.Timeout = defaultPromTimeout
+	}
+	client := &http.Client{Timeout: time.Duration(args.Timeout) * time.Second, Transport: transport}
+
+	var payload io.Reader
+	if body != nil {
+		payload = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(baseURL, "/")+path, payload)
+	if err != nil {
+		return err
+	}
+	// Requests stop when the rule's run is cancelled, times out, or is abandoned
+	req = req.WithContext(msg.Run.Context())
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if len(msg.TraceParent) > 0 {
+		req.Header.Set("traceparent", msg.TraceParent)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(path, "/api/v1/") {
+		var wrapped struct {
+			Status string          `json:"status"`
+			Error  string          `json:"error"`
+			Data   json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return fmt.Errorf("Unexpected response from Prometheus (%d): %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+		}
+		if wrapped.Status != "success" {
+			return fmt.Errorf("Prometheus query failed: %s", wrapped.Error)
+		}
+		return json.Unmarshal(wrapped.Data, result)
+	}
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Alertmanager returned %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	return json.Unmarshal(raw, result)
+}
+
+// parsePromResult turns the result of a query into series, whatever its type
+func parsePromResult(resultType string, result json.RawMessage) ([]models.PromSeries, error) {
+	switch resultType {
+	case "vector", "matrix":
+		var series []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+			Values [][]interface{}   `json:"values"`
+		}
+		if err := json.Unmarshal(result, &series); err != nil {
+			return nil, err
+		}
+		parsed := make([]models.PromSeries, len(series))
+		for i, s := range series {
+			values := s.Values
+			if resultType == "vector" {
+				values = [][]interface{}{s.Value}
+			}
+			samples, err := promSamples(values)
+			if err != nil {
+				return nil, err
+			}
+			parsed[i] = models.PromSeries{Metric: s.Metric, Samples: samples}
+		}
+		return parsed, nil
+	case "scalar":
+		var value []interface{}
+		if err := json.Unmarshal(result, &value); err != nil {
+			return nil, err
+		}
+		samples, err := promSamples([][]interface{}{value})
+		if err != nil {
+			return nil, err
+		}
+		return []models.PromSeries{{Metric: map[string]string{}, Samples: samples}}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported Prometheus result type '%s'", resultType)
+	}
+}
+
+// promSamples parses [<unix time>, "<value>"] pairs
+func promSamples(values [][]interface{}) ([]models.PromSample, error) {
+	samples := make([]models.PromSample, len(values))
+	for i, v := range values {
+		if len(v) != 2 {
+			return nil, fmt.Errorf("Unexpected sample in Prometheus result: %v", v)
+		}
+		t, ok := v[0].(float64)
+		s, ok2 := v[1].(string)
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("Unexpected sample in Prometheus result: %v", v)
+		}
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		sec := int64(t)
+		samples[i] = models.PromSample{Time: time.Unix(sec, int64((t-float64(sec))*1e9)).UTC(), Value: value}
+	}
+	return samples, nil
+}
+
+// promTime formats a time the way the Prometheus API takes it
+func promTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
+
+// parseDuration parses a duration like 30m or 2h, which may come from variables; days (1d) work too
+func parseDuration(s string, msg *models.Message) (time.Duration, error) {
+	s, err := utils.Substitute(s, msg.Vars)
+	if err != nil {
+		return 0, err
+	}
+	return utils.ParseDuration(s)
+}
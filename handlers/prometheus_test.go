@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestPromQuery(t *testing.T) {
+	now := time.Unix(1556668800, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		q := r.URL.Query()
+		switch {
+		case q.Get("query") == "bad(":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		case r.URL.Path == "/api/v1/query" && q.Get("time") == "1556668800.000":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"__name__":"up","job":"api"},"value":[1556668800,"1"]},
+				{"metric":{"__name__":"up","job":"web"},"value":[1556668800,"0"]}]}}`))
+		case r.URL.Path == "/api/v1/query_range" && q.Get("start") == "1556665200.000" && q.Get("step") == "60":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+				{"metric":{"job":"api"},"values":[[1556665200,"1.5"],[1556665260.5,"2.5"]]}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`404 page not found`))
+		}
+	}))
+	defer ts.Close()
+	bot := &models.Bot{PrometheusURL: ts.URL + "/", PrometheusToken: "token"}
+
+	tests := []struct {
+		name    string
+		action  models.Action
+		want    []models.PromSeries
+		wantErr bool
+	}{
+		{"Instant", models.Action{Query: "up{job=~\"${jobs}\"}"}, []models.PromSeries{
+			{Metric: map[string]string{"__name__": "up", "job": "api"}, Samples: []models.PromSample{{Time: now.UTC(), Value: 1}}},
+			{Metric: map[string]string{"__name__": "up", "job": "web"}, Samples: []models.PromSample{{Time: now.UTC(), Value: 0}}},
+		}, false},
+		{"Range", models.Action{Query: "rate(x[5m])", Range: "${range}"}, []models.PromSeries{
+			{Metric: map[string]string{"job": "api"}, Samples: []models.PromSample{
+				{Time: now.Add(-time.Hour).UTC(), Value: 1.5},
+				{Time: now.Add(-time.Hour + 60500*time.Millisecond).UTC(), Value: 2.5},
+			}},
+		}, false},
+		{"Query error", models.Action{Query: "bad("}, nil, true},
+		{"No query", models.Action{}, nil, true},
+		{"Invalid range", models.Action{Query: "up", Range: "soon"}, nil, true},
+		{"Not Prometheus", models.Action{Query: "up", Range: "2h"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := models.NewMessage()
+			msg.Vars["jobs"] = "api|web"
+			msg.Vars["range"] = "1h"
+			got, err := PromQuery(tt.action, &msg, bot, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PromQuery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("PromQuery() = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+
+	msg := models.NewMessage()
+	if _, err := PromQuery(models.Action{Query: "up"}, &msg, &models.Bot{}, now); err == nil {
+		t.Error("PromQuery() without 'prometheus_url' should fail")
+	}
+}
+
+func TestCreateSilence(t *testing.T) {
+	now := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	var got map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v2/silences" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"silenceID":"abc-123"}`))
+	}))
+	defer ts.Close()
+	bot := &models.Bot{AlertmanagerURL: ts.URL}
+
+	msg := models.NewMessage()
+	msg.Vars["_user.name"] = "jdoe"
+	msg.Vars["alert"] = "HighCPU"
+	msg.Vars["for"] = "2h"
+	msg.Vars["empty"] = ""
+	silence, err := CreateSilence(models.Action{Matchers: map[string]string{"alertname": "${alert}", "env": "prod"}, Duration: "${for}"}, &msg, bot, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if silence.ID != "abc-123" || !silence.EndsAt.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("CreateSilence() = %+v", silence)
+	}
+	want := `{"comment":"Silenced from chat by jdoe","createdBy":"jdoe","endsAt":"2019-05-01T14:00:00Z",` +
+		`"matchers":[{"isRegex":false,"name":"alertname","value":"HighCPU"},{"isRegex":false,"name":"env","value":"prod"}],` +
+		`"startsAt":"2019-05-01T12:00:00Z"}`
+	if gotJSON, _ := json.Marshal(got); string(gotJSON) != want {
+		t.Errorf("CreateSilence() sent %s, want %s", gotJSON, want)
+	}
+
+	tests := []struct {
+		name   string
+		action models.Action
+	}{
+		{"No matchers", models.Action{Duration: "2h"}},
+		{"Empty matcher", models.Action{Matchers: map[string]string{"alertname": "${empty}"}, Duration: "2h"}},
+		{"No duration", models.Action{Matchers: map[string]string{"alertname": "x"}}},
+		{"Negative duration", models.Action{Matchers: map[string]string{"alertname": "x"}, Duration: "-1d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CreateSilence(tt.action, &msg, bot, now); err == nil {
+				t.Error("CreateSilence() should fail")
+			}
+		})
+	}
+}
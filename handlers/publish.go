@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// defaultPublishTimeout is how long publishing a message may take, unless the action sets 'timeout'
+const defaultPublishTimeout = 10
+
+// kafkaWriters keeps a writer per broker and topic, created on first use
+var kafkaWriters = struct {
+	sync.Mutex
+	byTopic map[string]*kafka.Writer
+}{byTopic: map[string]*kafka.Writer{}}
+
+// Publish handles 'publish' actions, sending the action's message to a topic (Kafka),
+// subject (NATS), or queue (SQS) of one of the configured brokers.
+// The ID the broker assigned to the message is returned, if it assigns one.
+func Publish(args models.Action, msg *models.Message, bot *models.Bot) (string, error) {
+	conf, ok := bot.Brokers[args.Broker]
+	if !ok {
+		return "", fmt.Errorf("Unknown broker '%s' for action '%s'", args.Broker, args.Name)
+	}
+
+	topic, err := utils.Substitute(args.Topic, msg.Vars)
+	if err != nil {
+		return "", err
+	}
+	if len(topic) == 0 {
+		return "", fmt.Errorf("no topic was supplied for the '%s' action named: %s", args.Type, args.Name)
+	}
+	payload, err := utils.Substitute(args.Message, msg.Vars)
+	if err != nil {
+		return "", err
+	}
+	key, err := utils.Substitute(args.Key, msg.Vars)
+	if err != nil {
+		return "", err
+	}
+
+	conf, err = resolveBroker(conf)
+	if err != nil {
+		return "", err
+	}
+
+	if args.Timeout == 0 {
+		args.Timeout = defaultPublishTimeout
+	}
+	ctx, cancel := context.WithTimeout(msg.Run.Context(), time.Duration(args.Timeout)*time.Second)
+	defer cancel()
+
+	switch strings.ToLower(conf.Type) {
+	case "kafka":
+		return "", publishKafka(ctx, args.Broker, conf, topic, key, payload)
+	case "nats":
+		return "", publishNATS(ctx, conf, topic, payload)
+	case "sqs":
+		return publishSQS(ctx, conf, topic, key, payload)
+	default:
+		return "", fmt.Errorf("Broker '%s' has unknown type '%s', use 'kafka', 'nats', or 'sqs'", args.Broker, conf.Type)
+	}
+}
+
+// resolveBroker substitutes variables (e.g. secrets) in a broker's settings
+func resolveBroker(conf models.Broker) (models.Broker, error) {
+	addresses := make([]string, len(conf.Addresses))
+	for i, a := range conf.Addresses {
+		address, err := utils.Substitute(a, map[string]string{})
+		if err != nil {
+			return conf, err
+		}
+		addresses[i] = address
+	}
+	conf.Addresses = addresses
+
+	var err error
+	if conf.Username, err = utils.Substitute(conf.Username, map[string]string{}); err != nil {
+		return conf, err
+	}
+	if conf.Password, err = utils.Substitute(conf.Password, map[string]string{}); err != nil {
+		return conf, err
+	}
+	utils.AddSecret(conf.Password)
+	if conf.Region, err = utils.Substitute(conf.Region, map[string]string{}); err != nil {
+		return conf, err
+	}
+	return conf, nil
+}
+
+// publishKafka writes a message to a Kafka topic. Messages with the same key go to the same partition.
+func publishKafka(ctx context.Context, name string, conf models.Broker, topic, key, payload string) error {
+	if len(conf.Addresses) == 0 {
+		return fmt.Errorf("Broker '%s' has no addresses", name)
+	}
+
+	kafkaWriters.Lock()
+	writer, ok := kafkaWriters.byTopic[name+"/"+topic]
+	if !ok {
+		dialer := &kafka.Dialer{Timeout: 10 * time.Second, DualStack: true}
+		if conf.TLS {
+			dialer.TLS = &tls.Config{}
+		}
+		if len(conf.Username) > 0 {
+			dialer.SASLMechanism = plain.Mechanism{Username: conf.Username, Password: conf.Password}
+		}
+		writer = kafka.NewWriter(kafka.WriterConfig{
+			Brokers:  conf.Addresses,
+			Topic:    topic,
+			Dialer:   dialer,
+			Balancer: &kafka.Hash{},
+			// Chat commands publish one message at a time, don't wait for batches to fill
+			BatchSize: 1,
+		})
+		kafkaWriters.byTopic[name+"/"+topic] = writer
+	}
+	kafkaWriters.Unlock()
+
+	message := kafka.Message{Value: []byte(payload)}
+	if len(key) > 0 {
+		message.Key = []byte(key)
+	}
+	return writer.WriteMessages(ctx, message)
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+// fakeNATS accepts NATS connections and sends the messages published to it on the returned channel
+func fakeNATS(t *testing.T, reject string) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"auth_required\":true}\r\n")
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch fields[0] {
+					case "CONNECT":
+						published <- "connect " + strings.TrimSpace(line[len("CONNECT "):])
+					case "PUB":
+						n, _ := strconv.Atoi(fields[len(fields)-1])
+						payload := make([]byte, n+2)
+						if _, err := r.Read(payload); err != nil {
+							return
+						}
+						if len(reject) > 0 {
+							fmt.Fprintf(conn, "-ERR '%s'\r\n", reject)
+							return
+						}
+						published <- fields[1] + " " + string(payload[:n])
+					case "PING":
+						fmt.Fprint(conn, "PONG\r\n")
+					}
+				}
+			}(conn)
+		}
+	}()
+	return l.Addr().String(), published
+}
+
+func TestPublishNATS(t *testing.T) {
+	addr, published := fakeNATS(t, "")
+	rejectAddr, _ := fakeNATS(t, "Permissions Violation for Publish to builds")
+
+	bot := new(models.Bot)
+	bot.Brokers = map[string]models.Broker{
+		"nats":     {Type: "nats", Addresses: []string{"nats://flottbot:secret@" + addr}},
+		"failover": {Type: "nats", Addresses: []string{"127.0.0.1:1", addr}},
+		"readonly": {Type: "nats", Addresses: []string{rejectAddr}},
+		"nowhere":  {Type: "rabbitmq"},
+	}
+
+	msg := models.NewMessage()
+	msg.Vars["repo"] = "flottbot"
+
+	action := models.Action{Name: "build", Type: "publish", Broker: "nats", Topic: "builds.${repo}", Message: `{"repo":"${repo}"}`}
+	if _, err := Publish(action, &msg, bot); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	var connect map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(<-published, "connect ")), &connect); err != nil || connect["user"] != "flottbot" || connect["pass"] != "secret" {
+		t.Errorf("Publish() connected with %v", connect)
+	}
+	if got := <-published; got != `builds.flottbot {"repo":"flottbot"}` {
+		t.Errorf("Publish() published %q", got)
+	}
+
+	action.Broker = "failover"
+	if _, err := Publish(action, &msg, bot); err != nil {
+		t.Errorf("Publish() to second server error = %v", err)
+	}
+
+	action.Broker = "readonly"
+	if _, err := Publish(action, &msg, bot); err == nil || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Errorf("Publish() error = %v, want the server's error", err)
+	}
+
+	for _, a := range []models.Action{
+		{Name: "unknown broker", Broker: "nope", Topic: "builds", Message: "x"},
+		{Name: "unknown type", Broker: "nowhere", Topic: "builds", Message: "x"},
+		{Name: "no topic", Broker: "nats", Message: "x"},
+		{Name: "invalid subject", Broker: "nats", Topic: "builds now", Message: "x"},
+		{Name: "missing variable", Broker: "nats", Topic: "builds", Message: "${missing}"},
+	} {
+		if _, err := Publish(a, &msg, bot); err == nil {
+			t.Errorf("Publish() %s expected an error", a.Name)
+		}
+	}
+}
+
+func TestPublishSQS(t *testing.T) {
+	var input map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential=AKID/") || !strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/sqs/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("X-Amz-Target") != "AmazonSQS.SendMessage" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &input)
+		if strings.HasSuffix(input["QueueUrl"], "/missing") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.sqs#QueueDoesNotExist","message":"The specified queue does not exist."}`))
+			return
+		}
+		w.Write([]byte(`{"MessageId":"5fea7756-0ea4-451a-a703-a558b933e274","MD5OfMessageBody":"x"}`))
+	}))
+	defer ts.Close()
+
+	bot := new(models.Bot)
+	bot.Brokers = map[string]models.Broker{
+		"sqs": {Type: "sqs", Addresses: []string{ts.URL}, Username: "AKID", Password: "secret"},
+	}
+	msg := models.NewMessage()
+	msg.Vars["repo"] = "flottbot"
+
+	action := models.Action{Name: "build", Type: "publish", Broker: "sqs", Topic: "https://sqs.eu-west-1.amazonaws.com/123456789012/builds.fifo", Key: "${repo}", Message: "build ${repo}"}
+	id, err := Publish(action, &msg, bot)
+	if err != nil || id != "5fea7756-0ea4-451a-a703-a558b933e274" {
+		t.Fatalf("Publish() = %q, %v", id, err)
+	}
+	if input["MessageBody"] != "build flottbot" || input["MessageGroupId"] != "flottbot" || len(input["MessageDeduplicationId"]) == 0 {
+		t.Errorf("Publish() sent %v", input)
+	}
+
+	action.Topic = "https://sqs.eu-west-1.amazonaws.com/123456789012/missing"
+	if _, err := Publish(action, &msg, bot); err == nil || !strings.Contains(err.Error(), "QueueDoesNotExist") {
+		t.Errorf("Publish() error = %v, want QueueDoesNotExist", err)
+	}
+}
+
+func Test_sqsRegion(t *testing.T) {
+	tests := []struct {
+		name     string
+		queueURL string
+		want     string
+	}{
+		{"Queue URL", "https://sqs.us-east-2.amazonaws.com/123456789012/builds", "us-east-2"},
+		{"China", "https://sqs.cn-north-1.amazonaws.com.cn/123456789012/builds", "cn-north-1"},
+		{"Other URL", "http://localhost:4566/000000000000/builds", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqsRegion(tt.queueURL); got != tt.want {
+				t.Errorf("sqsRegion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,16 @@
 package handlers
 
 import (
-	"context"
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -12,49 +18,155 @@ import (
 	"github.com/target/flottbot/utils"
 )
 
+// defaultKillGrace is how long a timed out script has to exit after SIGTERM before it's killed
+const defaultKillGrace = 5 * time.Second
+
+// defaultStreamInterval is how often streamed output is sent to chat
+const defaultStreamInterval = 2 * time.Second
+
+// baseEnv are the variables of the bot's environment every script gets;
+// others have to be allowed by the action's 'env'
+var baseEnv = []string{"PATH", "HOME", "USER", "LANG", "LC_ALL", "TZ", "TMPDIR"}
+
 // ScriptExec handles 'exec' actions; script executions for rules
 func ScriptExec(args models.Action, msg *models.Message, bot *models.Bot) (*models.ScriptResponse, error) {
+	return ScriptExecStream(args, msg, bot, nil)
+}
+
+// ScriptExecStream handles 'exec' actions like ScriptExec. If onOutput is set, it receives
+// what the script prints to stdout while it runs, a few lines at a time.
+func ScriptExecStream(args models.Action, msg *models.Message, bot *models.Bot, onOutput func(string)) (*models.ScriptResponse, error) {
 	bot.Log.Debugf("Executing process for action '%s'", args.Name)
 	// Default timeout of 20 seconds for any script execution, modifyable in rule file
 	if args.Timeout == 0 {
 		args.Timeout = 20
 	}
+	killGrace := defaultKillGrace
+	if len(args.KillGrace) > 0 {
+		d, err := time.ParseDuration(args.KillGrace)
+		if err != nil {
+			return &models.ScriptResponse{Status: 1}, fmt.Errorf("Invalid kill_grace '%s' for action '%s': %s", args.KillGrace, args.Name, err.Error())
+		}
+		killGrace = d
+	}
 
 	// Prep default response
 	result := &models.ScriptResponse{
 		Status: 1, // Default is exit code 1 (error)
 	}
 
-	// Create context for executing command; will deal with timeouts
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(args.Timeout)*time.Second)
-	defer cancel()
-
 	// Deal with variable substitution in command
 	cmdProcessed, err := utils.Substitute(args.Cmd, msg.Vars)
 	if err != nil {
 		return result, err
 	}
+	dir, err := utils.Substitute(args.Dir, msg.Vars)
+	if err != nil {
+		return result, err
+	}
+	env, err := scriptEnv(args, msg)
+	if err != nil {
+		return result, err
+	}
 
 	// Parse out all the arguments from the supplied command
 	bin := utils.FindArgs(cmdProcessed)
-	// Execute the command + arguments with the context
-	cmd := exec.CommandContext(ctx, bin[0], bin[1:]...)
+	// Run the command in a container, if the action asks for one
+	var containerName string
+	if len(args.Container.Image) > 0 {
+		containerName = "flottbot-" + models.GenerateMessageID()
+		// The docker client needs the bot's environment, the container only gets the script's
+		names := make([]string, len(env))
+		for i, kv := range env {
+			names[i] = kv[:strings.Index(kv, "=")]
+		}
+		bin = containerCommand(args.Container, containerName, names, bin)
+		env = append(os.Environ(), env...)
+	}
+	cmd := exec.Command(bin[0], bin[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	// Run the script in its own process group, so whatever it started is stopped with it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	// Capture stdout/stderr
-	out, err := cmd.Output()
+	var stdout, stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	var stdoutPipe io.ReadCloser
+	if onOutput == nil {
+		cmd.Stdout = &stdout
+	} else if stdoutPipe, err = cmd.StdoutPipe(); err != nil {
+		return result, err
+	}
 
-	// Handle timeouts
-	if ctx.Err() == context.DeadlineExceeded {
-		result.Output = "Hmm, something timed out. Please try again."
-		return result, fmt.Errorf("Timeout reached, exec process for action '%s' cancelled", args.Name)
+	if err = cmd.Start(); err == nil {
+		// Ask the script to stop once the timeout is reached or the rule's run is done, then make it.
+		// Once it has exited its process group ID may be reused, so nothing is signalled anymore.
+		var (
+			stopMu sync.Mutex
+			exited bool
+			kill   *time.Timer
+		)
+		stop := func() {
+			stopMu.Lock()
+			defer stopMu.Unlock()
+			if exited || kill != nil {
+				return
+			}
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+			if len(containerName) > 0 {
+				// Killing the docker client doesn't stop the container
+				exec.Command("docker", "kill", containerName).Run()
+			}
+			kill = time.AfterFunc(killGrace, func() { syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) })
+		}
+		timedOut := make(chan struct{})
+		timer := time.AfterFunc(time.Duration(args.Timeout)*time.Second, func() {
+			close(timedOut)
+			stop()
+		})
+		finished, cancelled := make(chan struct{}), make(chan struct{})
+		go func() {
+			select {
+			case <-msg.Run.Context().Done():
+				close(cancelled)
+				stop()
+			case <-finished:
+			}
+		}()
+		if stdoutPipe != nil {
+			streamOutput(stdoutPipe, &stdout, onOutput)
+		}
+		err = cmd.Wait()
+		timer.Stop()
+		close(finished)
+		stopMu.Lock()
+		exited = true
+		if kill != nil {
+			kill.Stop()
+		}
+		stopMu.Unlock()
+
+		// Handle timeouts and cancellations
+		select {
+		case <-timedOut:
+			result.Output = "Hmm, something timed out. Please try again."
+			return result, fmt.Errorf("Timeout reached, exec process for action '%s' cancelled", args.Name)
+		case <-cancelled:
+			// Whatever the script printed so far is all there is
+			result.Output = strings.Trim(stdout.String(), " \n")
+			return result, fmt.Errorf("Exec process for action '%s' stopped: %s", args.Name, msg.Run.Context().Err())
+		default:
+		}
 	}
+	out := stdout.Bytes()
 
 	// Deal with non-zero exit codes
 	if err != nil {
 		switch err.(type) {
 		case *exec.ExitError:
 			ws := err.(*exec.ExitError).Sys().(syscall.WaitStatus)
-			stderr := strings.Trim(string(err.(*exec.ExitError).Stderr), " \n")
+			stderr := strings.Trim(stderr.String(), " \n")
 			bot.Log.Debugf("Process for action '%s' exited with status %d: %s", args.Name, ws.ExitStatus(), stderr)
 			result.Status = ws.ExitStatus()
 			result.Output = stderr
@@ -79,3 +191,109 @@ func ScriptExec(args models.Action, msg *models.Message, bot *models.Bot) (*mode
 
 	return result, nil
 }
+
+// scriptEnv builds a script's environment: a few basic variables of the bot's environment,
+// those the action allows with 'env', and the ones it sets with 'env_vars'
+func scriptEnv(args models.Action, msg *models.Message) ([]string, error) {
+	env := []string{}
+	for _, name := range append(baseEnv, args.Env...) {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	names := make([]string, 0, len(args.EnvVars))
+	for name := range args.EnvVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := utils.Substitute(args.EnvVars[name], msg.Vars)
+		if err != nil {
+			return nil, err
+		}
+		// viper lowercases keys, but environment variables are conventionally upper case
+		env = append(env, strings.ToUpper(name)+"="+value)
+	}
+	return env, nil
+}
+
+// streamOutput copies a script's output to out, passing it on to onOutput
+// at most every defaultStreamInterval
+func streamOutput(r io.Reader, out *bytes.Buffer, onOutput func(string)) {
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	ticker := time.NewTicker(defaultStreamInterval)
+	defer ticker.Stop()
+	var pending []string
+	flush := func() {
+		if len(pending) > 0 {
+			onOutput(strings.Join(pending, "\n"))
+			pending = nil
+		}
+	}
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				flush()
+				return
+			}
+			out.WriteString(line + "\n")
+			pending = append(pending, line)
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Defaults for the containers 'exec' actions run in
+const (
+	defaultContainerCPUs      = "1"
+	defaultContainerMemory    = "512m"
+	defaultContainerPidsLimit = 256
+	defaultContainerNetwork   = "none"
+)
+
+// containerCommand wraps a command in a 'docker run' of the given container. The container has
+// no network unless it asks for one, runs without capabilities, and is removed when the command exits.
+// A workspace directory on the host is mounted as its working directory, /workspace.
+// The named variables are passed on from the docker client's environment.
+func containerCommand(c models.Container, name string, env []string, bin []string) []string {
+	if len(c.CPUs) == 0 {
+		c.CPUs = defaultContainerCPUs
+	}
+	if len(c.Memory) == 0 {
+		c.Memory = defaultContainerMemory
+	}
+	if c.PidsLimit == 0 {
+		c.PidsLimit = defaultContainerPidsLimit
+	}
+	if len(c.Network) == 0 {
+		c.Network = defaultContainerNetwork
+	}
+
+	run := []string{
+		"docker", "run", "--rm", "--name", name,
+		"--network", c.Network,
+		"--cpus", c.CPUs,
+		"--memory", c.Memory,
+		"--pids-limit", strconv.Itoa(c.PidsLimit),
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+	}
+	if len(c.Workspace) > 0 {
+		run = append(run, "--volume", c.Workspace+":/workspace", "--workdir", "/workspace")
+	}
+	for _, e := range env {
+		run = append(run, "--env", e)
+	}
+	run = append(run, c.Image)
+	return append(run, bin...)
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"context"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/target/flottbot/models"
 )
@@ -69,3 +72,105 @@ func TestScriptExec(t *testing.T) {
 		})
 	}
 }
+
+func Test_containerCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		container models.Container
+		env       []string
+		want      []string
+	}{
+		{"Defaults", models.Container{Image: "alpine:3.9"}, nil, []string{"docker", "run", "--rm", "--name", "flottbot-test", "--network", "none", "--cpus", "1", "--memory", "512m", "--pids-limit", "256", "--cap-drop", "ALL", "--security-opt", "no-new-privileges", "alpine:3.9", "echo", "hi there"}},
+		{"Limits, network, and workspace", models.Container{Image: "python:3.7", CPUs: "0.5", Memory: "128m", PidsLimit: 32, Network: "bridge", Workspace: "/srv/runbooks"}, []string{"PATH", "TOKEN"}, []string{"docker", "run", "--rm", "--name", "flottbot-test", "--network", "bridge", "--cpus", "0.5", "--memory", "128m", "--pids-limit", "32", "--cap-drop", "ALL", "--security-opt", "no-new-privileges", "--volume", "/srv/runbooks:/workspace", "--workdir", "/workspace", "--env", "PATH", "--env", "TOKEN", "python:3.7", "echo", "hi there"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containerCommand(tt.container, "flottbot-test", tt.env, []string{"echo", "hi there"}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("containerCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScriptExecEnvironment(t *testing.T) {
+	os.Setenv("FLOTTBOT_ALLOWED", "allowed")
+	os.Setenv("FLOTTBOT_SECRET", "secret")
+	defer os.Unsetenv("FLOTTBOT_ALLOWED")
+	defer os.Unsetenv("FLOTTBOT_SECRET")
+
+	bot := new(models.Bot)
+	msg := models.NewMessage()
+	msg.Vars["repo"] = "flottbot"
+
+	action := newExecAction(`/bin/sh -c "echo $FLOTTBOT_ALLOWED-$FLOTTBOT_SECRET-$REPO-$(pwd)"`)
+	action.Env = []string{"FLOTTBOT_ALLOWED"}
+	action.EnvVars = map[string]string{"repo": "${repo}"}
+	action.Dir = "/tmp"
+
+	got, err := ScriptExec(action, &msg, bot)
+	if err != nil {
+		t.Fatalf("ScriptExec() error = %v", err)
+	}
+	if got.Output != "allowed--flottbot-/tmp" {
+		t.Errorf("ScriptExec() = %q, want %q", got.Output, "allowed--flottbot-/tmp")
+	}
+}
+
+func TestScriptExecKill(t *testing.T) {
+	bot := new(models.Bot)
+	msg := models.NewMessage()
+
+	// The script ignores SIGTERM, so it's killed once the grace period is over
+	action := newExecAction(`/bin/sh -c "trap '' TERM; sleep 30"`)
+	action.Timeout = 1
+	action.KillGrace = "500ms"
+
+	start := time.Now()
+	got, err := ScriptExec(action, &msg, bot)
+	if err == nil || got.Output != "Hmm, something timed out. Please try again." {
+		t.Errorf("ScriptExec() = %v, %v", got, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ScriptExec() took %s to kill the script", elapsed)
+	}
+
+	action.KillGrace = "soon"
+	if _, err := ScriptExec(action, &msg, bot); err == nil {
+		t.Error("ScriptExec() expected an error for an invalid kill_grace")
+	}
+}
+
+func TestScriptExecCancel(t *testing.T) {
+	bot := new(models.Bot)
+	msg := models.NewMessage()
+	ctx, cancel := context.WithCancel(context.Background())
+	msg.Run = models.NewRunContext(ctx)
+
+	action := newExecAction(`/bin/sh -c "echo started; sleep 30"`)
+	action.Timeout = 30
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	got, err := ScriptExec(action, &msg, bot)
+	if err == nil || got.Output != "started" {
+		t.Errorf("ScriptExec() = %v, %v", got, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ScriptExec() took %s to stop the cancelled script", elapsed)
+	}
+}
+
+func TestScriptExecStream(t *testing.T) {
+	bot := new(models.Bot)
+	msg := models.NewMessage()
+
+	var streamed []string
+	action := newExecAction(`/bin/sh -c "echo one; echo two; exit 3"`)
+	got, err := ScriptExecStream(action, &msg, bot, func(output string) { streamed = append(streamed, output) })
+	if err == nil || got.Status != 3 || got.Output != "one\ntwo" {
+		t.Errorf("ScriptExecStream() = %v, %v", got, err)
+	}
+	if !reflect.DeepEqual(streamed, []string{"one\ntwo"}) {
+		t.Errorf("ScriptExecStream() streamed %q", streamed)
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	// Database drivers for 'sql' actions
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// defaultSQLMaxRows limits how many rows a query returns, unless the database sets 'max_rows'
+const defaultSQLMaxRows = 100
+
+// readStatements are the statements that only read data
+var readStatements = []string{"select", "with", "show", "explain", "describe", "desc", "values", "table"}
+
+// sqlPools keeps a connection pool per configured database, opened on first use
+var sqlPools = struct {
+	sync.Mutex
+	byName map[string]*sql.DB
+}{byName: map[string]*sql.DB{}}
+
+// SQLQuery handles 'sql' actions, running the action's query with its params substituted into placeholders
+func SQLQuery(args models.Action, msg *models.Message, bot *models.Bot) (*models.SQLResult, error) {
+	conf, ok := bot.Databases[args.Database]
+	if !ok {
+		return nil, fmt.Errorf("Unknown database '%s' for action '%s'", args.Database, args.Name)
+	}
+	if len(args.Query) == 0 {
+		return nil, fmt.Errorf("no query was supplied for the '%s' action named: %s", args.Type, args.Name)
+	}
+
+	// Variables only ever become query parameters, never part of the query itself
+	params := make([]interface{}, len(args.Params))
+	for i, p := range args.Params {
+		value, err := utils.Substitute(p, msg.Vars)
+		if err != nil {
+			return nil, err
+		}
+		params[i] = value
+	}
+
+	reads := isReadStatement(args.Query)
+	if conf.ReadOnly && (!reads || hasMultipleStatements(args.Query)) {
+		return nil, fmt.Errorf("Database '%s' is read-only, action '%s' may only run a single SELECT query", args.Database, args.Name)
+	}
+
+	db, err := sqlPool(args.Database, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Timeout == 0 {
+		args.Timeout = 10
+	}
+	ctx, cancel := context.WithTimeout(msg.Run.Context(), time.Duration(args.Timeout)*time.Second)
+	defer cancel()
+
+	// Read-only databases are also queried in read-only transactions, where the driver supports them
+	var querier interface {
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+		ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	} = db
+	if conf.ReadOnly && conf.Driver != "sqlite3" {
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		querier = tx
+	}
+
+	if !reads {
+		res, err := querier.ExecContext(ctx, args.Query, params...)
+		if err != nil {
+			return nil, err
+		}
+		affected, _ := res.RowsAffected()
+		return &models.SQLResult{RowsAffected: affected}, nil
+	}
+
+	rows, err := querier.QueryContext(ctx, args.Query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	maxRows := conf.MaxRows
+	if maxRows == 0 {
+		maxRows = defaultSQLMaxRows
+	}
+	return readRows(rows, maxRows)
+}
+
+// sqlPool gets the connection pool for a database
+func sqlPool(name string, conf models.Database) (*sql.DB, error) {
+	sqlPools.Lock()
+	defer sqlPools.Unlock()
+	if db, ok := sqlPools.byName[name]; ok {
+		return db, nil
+	}
+
+	dsn, err := utils.Substitute(conf.DSN, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has no read-only transactions, but connections can be made read-only
+	if conf.ReadOnly && conf.Driver == "sqlite3" {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_query_only=true"
+	}
+
+	db, err := sql.Open(conf.Driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open database '%s': %s", name, err.Error())
+	}
+	if conf.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(conf.MaxOpenConns)
+		db.SetMaxIdleConns(conf.MaxOpenConns)
+	}
+	sqlPools.byName[name] = db
+	return db, nil
+}
+
+// readRows reads up to max rows of a query's result
+func readRows(rows *sql.Rows, max int) (*models.SQLResult, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.SQLResult{Columns: columns, Rows: []map[string]interface{}{}}
+	for rows.Next() {
+		if len(result.Rows) == max {
+			result.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			// Text is often returned as bytes
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+// isReadStatement tells whether a query only reads data, judging by its first keyword
+func isReadStatement(query string) bool {
+	fields := strings.Fields(strings.ToLower(stripSQLComments(query)))
+	if len(fields) == 0 {
+		return false
+	}
+	keyword := strings.TrimLeft(fields[0], "(")
+	for _, s := range readStatements {
+		if keyword == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMultipleStatements tells whether a query contains more than one statement
+func hasMultipleStatements(query string) bool {
+	query = stripSQLComments(query)
+	var quote rune
+	for i, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == ';':
+			return len(strings.TrimSpace(query[i+1:])) > 0
+		}
+	}
+	return false
+}
+
+// stripSQLComments removes -- and /* */ comments from a query
+func stripSQLComments(query string) string {
+	var b strings.Builder
+	for i := 0; i < len(query); i++ {
+		switch {
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.Index(query[i:], "\n")
+			if end < 0 {
+				return b.String()
+			}
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return b.String()
+			}
+			i += end + 3
+			b.WriteByte(' ')
+			continue
+		}
+		b.WriteByte(query[i])
+	}
+	return b.String()
+}
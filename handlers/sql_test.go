@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestSQLQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dsn := "file:" + filepath.Join(dir, "test.db")
+
+	bot := new(models.Bot)
+	bot.Databases = map[string]models.Database{
+		"rw": {Driver: "sqlite3", DSN: dsn},
+		"ro": {Driver: "sqlite3", DSN: dsn, ReadOnly: true, MaxRows: 2},
+	}
+
+	msg := models.NewMessage()
+	msg.Vars["name"] = "api'; DROP TABLE services; --"
+	msg.Vars["owner"] = "platform"
+
+	steps := []struct {
+		name        string
+		action      models.Action
+		wantRows    int
+		wantTrunc   bool
+		wantErr     bool
+		wantChanged int64
+	}{
+		{"Create table", models.Action{Database: "rw", Query: "CREATE TABLE services (name TEXT, owner TEXT, replicas INTEGER)"}, 0, false, false, 0},
+		{"Insert with params", models.Action{Database: "rw", Query: "INSERT INTO services VALUES (?, ?, 3), ('web', ?, 2), ('db', 'data', 1)", Params: []string{"${name}", "${owner}", "${owner}"}}, 0, false, false, 3},
+		{"Select", models.Action{Database: "rw", Query: "SELECT name, replicas FROM services WHERE owner = ? ORDER BY name", Params: []string{"${owner}"}}, 2, false, false, 0},
+		{"Max rows", models.Action{Database: "ro", Query: "-- all of them\nSELECT * FROM services"}, 2, true, false, 0},
+		{"Read-only rejects writes", models.Action{Database: "ro", Query: "DELETE FROM services"}, 0, false, true, 0},
+		{"Read-only rejects several statements", models.Action{Database: "ro", Query: "SELECT 1; DELETE FROM services"}, 0, false, true, 0},
+		{"Read-only connection rejects writes in disguise", models.Action{Database: "ro", Query: "WITH x AS (SELECT 1) INSERT INTO services SELECT 'x', 'y', 1 FROM x"}, 0, false, true, 0},
+		{"Unknown database", models.Action{Database: "nope", Query: "SELECT 1"}, 0, false, true, 0},
+		{"Missing variable", models.Action{Database: "rw", Query: "SELECT ?", Params: []string{"${missing}"}}, 0, false, true, 0},
+		{"Invalid query", models.Action{Database: "rw", Query: "SELECT * FROM nope"}, 0, false, true, 0},
+	}
+	for _, step := range steps {
+		step.action.Name, step.action.Type = step.name, "sql"
+		got, err := SQLQuery(step.action, &msg, bot)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: SQLQuery() error = %v, wantErr %v", step.name, err, step.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if len(got.Rows) != step.wantRows || got.Truncated != step.wantTrunc || got.RowsAffected != step.wantChanged {
+			t.Errorf("%s: SQLQuery() = %d rows (truncated %v, %d changed), want %d rows (truncated %v, %d changed)",
+				step.name, len(got.Rows), got.Truncated, got.RowsAffected, step.wantRows, step.wantTrunc, step.wantChanged)
+		}
+	}
+}
+
+func Test_isReadStatement(t *testing.T) {
+	tests := []struct {
+		query        string
+		wantRead     bool
+		wantMultiple bool
+	}{
+		{"SELECT * FROM t", true, false},
+		{"  /* report */ with x as (select 1) select * from x;", true, false},
+		{"(SELECT 1) UNION (SELECT 2)", true, false},
+		{"EXPLAIN SELECT 1", true, false},
+		{"UPDATE t SET a = 1", false, false},
+		{"SELECT ';' FROM t", true, false},
+		{"SELECT 1; DROP TABLE t", true, true},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		if got := isReadStatement(tt.query); got != tt.wantRead {
+			t.Errorf("isReadStatement(%q) = %v, want %v", tt.query, got, tt.wantRead)
+		}
+		if got := hasMultipleStatements(tt.query); got != tt.wantMultiple {
+			t.Errorf("hasMultipleStatements(%q) = %v, want %v", tt.query, got, tt.wantMultiple)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/target/flottbot/awsauth"
+	"github.com/target/flottbot/models"
+)
+
+// publishSQS sends a message to the SQS queue with the given URL and returns its message ID.
+// For FIFO queues, the key is the message group ID.
+// Requests go to the broker's first address, if it has one, e.g. for testing against a local SQS.
+func publishSQS(ctx context.Context, conf models.Broker, queueURL, key, payload string) (string, error) {
+	region := conf.Region
+	if len(region) == 0 {
+		region = sqsRegion(queueURL)
+	}
+	if len(region) == 0 {
+		return "", fmt.Errorf("Could not determine the AWS region of SQS queue '%s', set the broker's 'region'", queueURL)
+	}
+
+	endpoint := "https://sqs." + region + ".amazonaws.com/"
+	if len(conf.Addresses) > 0 {
+		endpoint = conf.Addresses[0]
+	}
+
+	creds := awsauth.CredentialsFromEnv()
+	if len(conf.Username) > 0 {
+		creds = awsauth.Credentials{AccessKey: conf.Username, SecretKey: conf.Password}
+	}
+
+	input := map[string]string{"QueueUrl": queueURL, "MessageBody": payload}
+	if strings.HasSuffix(queueURL, ".fifo") {
+		if len(key) == 0 {
+			key = "flottbot"
+		}
+		input["MessageGroupId"] = key
+		input["MessageDeduplicationId"] = models.GenerateMessageID()
+	}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS.SendMessage")
+	awsauth.Sign(req, body, "sqs", region, creds, time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(respBody, &failure) == nil && len(failure.Type) > 0 {
+			return "", fmt.Errorf("SQS returned %d: %s: %s", resp.StatusCode, failure.Type, failure.Message)
+		}
+		return "", fmt.Errorf("SQS returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var result struct {
+		MessageID string `json:"MessageId"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", err
+	}
+	return result.MessageID, nil
+}
+
+// sqsRegion finds the region in a queue URL like https://sqs.us-east-1.amazonaws.com/123456789012/builds,
+// falling back to the AWS_REGION environment variable
+func sqsRegion(queueURL string) string {
+	if u, err := url.Parse(queueURL); err == nil {
+		parts := strings.Split(u.Hostname(), ".")
+		if len(parts) >= 4 && parts[0] == "sqs" && parts[2] == "amazonaws" {
+			return parts[1]
+		}
+	}
+	return os.Getenv("AWS_REGION")
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// defaultSSHTimeout is how long an SSH command may run, unless the action sets 'timeout'
+const defaultSSHTimeout = 20
+
+// SSHExec handles 'ssh' actions, running the action's command on a remote host.
+// The host's key must be known, either from the action's 'host_key' or the known hosts file.
+// Commands that ran but failed return an *ssh.ExitError.
+func SSHExec(args models.Action, msg *models.Message, knownHostsFile string) (*models.ScriptResponse, error) {
+	// Prep default response
+	result := &models.ScriptResponse{
+		Status: 1, // Default is exit code 1 (error)
+	}
+
+	host, err := utils.Substitute(args.Host, msg.Vars)
+	if err != nil {
+		return result, err
+	}
+	if len(host) == 0 {
+		return result, fmt.Errorf("no host was supplied for the '%s' action named: %s", args.Type, args.Name)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	command, err := utils.Substitute(args.Cmd, msg.Vars)
+	if err != nil {
+		return result, err
+	}
+	user, err := utils.Substitute(args.User, msg.Vars)
+	if err != nil {
+		return result, err
+	}
+	key, err := utils.Substitute(args.SSHKey, map[string]string{})
+	if err != nil {
+		return result, err
+	}
+	// The key is either the private key itself (e.g. from a secrets backend) or the path to it
+	if !strings.HasPrefix(strings.TrimSpace(key), "-----BEGIN") {
+		b, err := ioutil.ReadFile(key)
+		if err != nil {
+			return result, fmt.Errorf("Could not read SSH key for action '%s': %s", args.Name, err.Error())
+		}
+		key = string(b)
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(key))
+	if err != nil {
+		return result, fmt.Errorf("Invalid SSH key for action '%s': %s", args.Name, err.Error())
+	}
+
+	hostKeyCallback, err := sshHostKeyCallback(args.HostKey, knownHostsFile)
+	if err != nil {
+		return result, fmt.Errorf("Could not verify SSH host key for action '%s': %s", args.Name, err.Error())
+	}
+
+	if args.Timeout == 0 {
+		args.Timeout = defaultSSHTimeout
+	}
+	timeout := time.Duration(args.Timeout) * time.Second
+
+	client, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return result, err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return result, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() { done <- session.Run(command) }()
+
+	// Closing the connection stops the command from holding up the rule
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		client.Close()
+		result.Output = "Hmm, something timed out. Please try again."
+		return result, fmt.Errorf("Timeout reached, SSH command for action '%s' cancelled", args.Name)
+	case <-msg.Run.Context().Done():
+		client.Close()
+		// Whatever the command printed so far is all there is
+		<-done
+		result.Output = strings.Trim(stdout.String(), " \n")
+		return result, fmt.Errorf("SSH command for action '%s' stopped: %s", args.Name, msg.Run.Context().Err())
+	}
+
+	result.Output = strings.Trim(stdout.String(), " \n")
+	if err != nil {
+		exitErr, ok := err.(*ssh.ExitError)
+		if !ok {
+			return result, err
+		}
+		result.Status = exitErr.ExitStatus()
+		// if nothing was printed to stdout before the error, use stderr as output
+		if len(result.Output) == 0 {
+			result.Output = strings.Trim(stderr.String(), " \n")
+		}
+		return result, exitErr
+	}
+
+	result.Status = 0
+	return result, nil
+}
+
+// sshHostKeyCallback verifies host keys against the given key (in authorized_keys format)
+// or, without one, against a known hosts file
+func sshHostKeyCallback(hostKey, knownHostsFile string) (ssh.HostKeyCallback, error) {
+	if len(hostKey) > 0 {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+		if err != nil {
+			return nil, err
+		}
+		return ssh.FixedHostKey(key), nil
+	}
+	if len(knownHostsFile) == 0 {
+		return nil, fmt.Errorf("set the action's 'host_key' or the bot's 'ssh_known_hosts'")
+	}
+	return knownhosts.New(knownHostsFile)
+}
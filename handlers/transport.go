@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// transports caches the transports of actions with custom TLS or proxy settings, keyed by those settings,
+// so certificates are only read once and connections can be reused
+var transports = struct {
+	sync.Mutex
+	byConfig map[string]*http.Transport
+}{byConfig: map[string]*http.Transport{}}
+
+// transportFor creates the transport for an action's client certificate, CA bundle, and proxy settings.
+// Actions without any of them use Go's default transport, which honors the HTTP(S)_PROXY environment variables.
+func transportFor(args models.Action, msg *models.Message) (http.RoundTripper, error) {
+	settings := []string{args.TLSCert, args.TLSKey, args.TLSCA, args.Proxy}
+	for i, s := range settings {
+		value, err := utils.Substitute(s, msg.Vars)
+		if err != nil {
+			return nil, err
+		}
+		settings[i] = value
+	}
+	cert, key, ca, proxy := settings[0], settings[1], settings[2], settings[3]
+	if len(cert) == 0 && len(key) == 0 && len(ca) == 0 && len(proxy) == 0 && !args.TLSInsecureSkipVerify {
+		return http.DefaultTransport, nil
+	}
+
+	cacheKey := fmt.Sprintf("%q", append(settings, fmt.Sprint(args.TLSInsecureSkipVerify)))
+	transports.Lock()
+	defer transports.Unlock()
+	if transport, ok := transports.byConfig[cacheKey]; ok {
+		return transport, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: args.TLSInsecureSkipVerify}
+	if len(cert) > 0 || len(key) > 0 {
+		if len(cert) == 0 || len(key) == 0 {
+			return nil, errors.New("Both 'tls_cert' and 'tls_key' are needed for a client certificate")
+		}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load client certificate: %s", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+	if len(ca) > 0 {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read CA bundle: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in CA bundle '%s'", ca)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// Same settings as Go's default transport
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}
+	if len(proxy) > 0 {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid proxy '%s': %s", proxy, err.Error())
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	transports.byConfig[cacheKey] = transport
+	return transport, nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+// writeClientCert creates a self-signed client certificate and its key in dir
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "flottbot"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return cert, certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHTTPReqTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientCert, certFile, keyFile := writeClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", ts.Certificate().Raw)
+
+	tests := []struct {
+		name    string
+		action  models.Action
+		want    string
+		wantErr bool
+	}{
+		{"Client certificate and CA", models.Action{TLSCert: certFile, TLSKey: keyFile, TLSCA: caFile}, "hello flottbot", false},
+		{"Missing client certificate", models.Action{TLSCA: caFile}, "", true},
+		{"Unknown CA", models.Action{TLSCert: certFile, TLSKey: keyFile}, "", true},
+		{"Key without certificate", models.Action{TLSKey: keyFile, TLSCA: caFile}, "", true},
+		{"Missing CA bundle", models.Action{TLSCA: filepath.Join(dir, "missing.pem")}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := models.NewMessage()
+			tt.action.Name, tt.action.Type, tt.action.URL = "TLS Action", "GET", ts.URL
+			got, err := HTTPReq(tt.action, &msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HTTPReq() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Raw != tt.want {
+				t.Errorf("HTTPReq() = %s, want %s", got.Raw, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPReqProxy(t *testing.T) {
+	proxied := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("from proxy"))
+	}))
+	defer proxy.Close()
+
+	msg := models.NewMessage()
+	msg.Vars["proxy"] = proxy.URL
+	action := models.Action{Name: "Proxy Action", Type: "GET", URL: "http://internal.example/api", Proxy: "${proxy}"}
+	got, err := HTTPReq(action, &msg)
+	if err != nil {
+		t.Fatalf("HTTPReq() error = %v", err)
+	}
+	if got.Raw != "from proxy" || proxied != "http://internal.example/api" {
+		t.Errorf("HTTPReq() = %s via proxy for %s, want the proxy to get %s", got.Raw, proxied, action.URL)
+	}
+
+	transport, err := transportFor(action, &msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyURL, _ := transport.(*http.Transport).Proxy(&http.Request{URL: &url.URL{Scheme: "http", Host: "internal.example"}})
+	if proxyURL.String() != proxy.URL {
+		t.Errorf("transportFor() proxy = %s, want %s", proxyURL, proxy.URL)
+	}
+}
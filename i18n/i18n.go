@@ -0,0 +1,70 @@
+package i18n
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Catalog holds the translations of the bot's messages, keyed by locale and then by message key
+type Catalog map[string]map[string]string
+
+// Load reads a catalog from a directory of files named after their locale, e.g. 'de.yml' or 'pt-BR.json'.
+// Nested keys are flattened, so 'errors: {missing_args: ...}' is looked up as 'errors.missing_args'.
+func Load(dir string) (Catalog, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := Catalog{}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		conf := viper.New()
+		conf.SetConfigFile(filepath.Join(dir, f.Name()))
+		if err := conf.ReadInConfig(); err != nil {
+			return nil, err
+		}
+
+		locale := Normalize(strings.TrimSuffix(f.Name(), filepath.Ext(f.Name())))
+		messages := catalog[locale]
+		if messages == nil {
+			messages = map[string]string{}
+			catalog[locale] = messages
+		}
+		for _, key := range conf.AllKeys() {
+			messages[key] = conf.GetString(key)
+		}
+	}
+	return catalog, nil
+}
+
+// Lookup finds the translation of a message, trying each locale in turn. A regional
+// locale (e.g. 'pt-BR') falls back to its language (e.g. 'pt') before the next locale.
+func (c Catalog) Lookup(key string, locales ...string) (string, bool) {
+	key = strings.ToLower(key)
+	for _, locale := range locales {
+		locale = Normalize(locale)
+		if len(locale) == 0 {
+			continue
+		}
+		if text, ok := c[locale][key]; ok {
+			return text, true
+		}
+		if i := strings.Index(locale, "-"); i > 0 {
+			if text, ok := c[locale[:i]][key]; ok {
+				return text, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Normalize makes locales written differently comparable, e.g. 'en_US' and 'en-us' both become 'en-us'
+func Normalize(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
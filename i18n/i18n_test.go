@@ -0,0 +1,64 @@
+package i18n
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"de.yml":    "greeting: Hallo\nerrors:\n  missing_args: Da fehlt etwas\n",
+		"pt_BR.yml": "greeting: Olá\n",
+		"fr.json":   `{"greeting": "Bonjour"}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	catalog, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		locales []string
+		want    string
+		wantOK  bool
+	}{
+		{"Exact locale", "greeting", []string{"de"}, "Hallo", true},
+		{"Nested key", "errors.missing_args", []string{"de"}, "Da fehlt etwas", true},
+		{"Keys are case insensitive", "Errors.Missing_Args", []string{"de"}, "Da fehlt etwas", true},
+		{"Regional locale", "greeting", []string{"pt-BR"}, "Olá", true},
+		{"Regional locale falls back to language", "greeting", []string{"de-AT"}, "Hallo", true},
+		{"JSON catalog", "greeting", []string{"fr"}, "Bonjour", true},
+		{"Falls back to next locale", "greeting", []string{"es", "", "de"}, "Hallo", true},
+		{"Missing key", "farewell", []string{"de"}, "", false},
+		{"No locales", "greeting", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := catalog.Lookup(tt.key, tt.locales...)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Lookup() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLoadMissingDir(t *testing.T) {
+	if _, err := Load(filepath.Join(os.TempDir(), "does-not-exist")); err == nil {
+		t.Error("Load() of a missing directory should fail")
+	}
+}
@@ -0,0 +1,259 @@
+// Package jsonpath extracts values from JSON documents with JSONPath expressions
+// (e.g. '$.items[?(@.state == "open")].title') or jq-style paths (e.g. '.items[0].title | length').
+//
+// Supported JSONPath: $, .name, ['name'], [n] (negative counts from the end), [start:end],
+// [*], ..name (recursive descent), and filters [?(@.path)] and [?(@.path <op> value)]
+// with ==, !=, <, <=, >, and >=.
+// Supported jq: ., .name, ."name", .[n], .[], and the pipes 'length', 'keys', 'first', 'last', and 'join("sep")'.
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled expression
+type Path struct {
+	expr  string
+	steps []step
+	pipes []pipe
+}
+
+// node is a value found while evaluating a path, along with where it was found
+type node struct {
+	value interface{}
+	path  string
+}
+
+// Compile parses a JSONPath expression or jq-style path
+func Compile(expr string) (*Path, error) {
+	parts := splitPipes(expr)
+	p := &parser{expr: strings.TrimSpace(parts[0])}
+	steps, err := p.parsePath()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid path '%s': %s", expr, err.Error())
+	}
+
+	path := &Path{expr: expr, steps: steps}
+	for _, part := range parts[1:] {
+		pipe, err := parsePipe(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid path '%s': %s", expr, err.Error())
+		}
+		path.pipes = append(path.pipes, pipe)
+	}
+	return path, nil
+}
+
+// Decode reads a JSON document, keeping numbers as they were written
+func Decode(raw []byte) (interface{}, error) {
+	var data interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Evaluate finds the values the path points to in a decoded JSON document.
+// It fails if the path does not resolve, saying where it stopped resolving.
+func (p *Path) Evaluate(data interface{}) ([]interface{}, error) {
+	nodes := []node{{value: data, path: "$"}}
+	for _, s := range p.steps {
+		next := []node{}
+		for _, n := range nodes {
+			found, err := s.apply(n)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' does not resolve: %s", p.expr, err.Error())
+			}
+			next = append(next, found...)
+		}
+		nodes = next
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("'%s' does not match anything", p.expr)
+	}
+
+	values := make([]interface{}, len(nodes))
+	for i, n := range nodes {
+		values[i] = n.value
+	}
+	for _, pipe := range p.pipes {
+		for i, v := range values {
+			result, err := pipe(v)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' does not resolve: %s", p.expr, err.Error())
+			}
+			values[i] = result
+		}
+	}
+	return values, nil
+}
+
+// String formats the values a path found: a single string, number, or boolean as is,
+// and anything else (objects, arrays, or several values) as JSON
+func String(values []interface{}) (string, error) {
+	if len(values) == 1 {
+		switch v := values[0].(type) {
+		case nil:
+			return "", nil
+		case string:
+			return v, nil
+		case json.Number:
+			return v.String(), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		case int:
+			return strconv.Itoa(v), nil
+		}
+	}
+
+	var encoded interface{} = values
+	if len(values) == 1 {
+		encoded = values[0]
+	}
+	b, err := json.Marshal(encoded)
+	return string(b), err
+}
+
+// splitPipes splits a jq-style expression on pipes outside of quotes and brackets
+func splitPipes(expr string) []string {
+	parts := []string{}
+	depth, quote, last := 0, byte(0), 0
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case c == '|' && depth == 0 && !strings.HasPrefix(expr[i:], "||"):
+			parts = append(parts, expr[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, expr[last:])
+}
+
+// pipe transforms each value a path found
+type pipe func(v interface{}) (interface{}, error)
+
+// parsePipe parses one of the supported jq functions
+func parsePipe(expr string) (pipe, error) {
+	switch expr {
+	case "length":
+		return func(v interface{}) (interface{}, error) {
+			switch val := v.(type) {
+			case []interface{}:
+				return len(val), nil
+			case map[string]interface{}:
+				return len(val), nil
+			case string:
+				return len([]rune(val)), nil
+			case nil:
+				return 0, nil
+			}
+			return nil, fmt.Errorf("%s has no length", describe(v))
+		}, nil
+	case "keys":
+		return func(v interface{}) (interface{}, error) {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s has no keys", describe(v))
+			}
+			keys := make([]interface{}, 0, len(obj))
+			for _, k := range sortedKeys(obj) {
+				keys = append(keys, k)
+			}
+			return keys, nil
+		}, nil
+	case "first", "last":
+		return func(v interface{}) (interface{}, error) {
+			arr, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cannot take the %s item of %s", expr, describe(v))
+			}
+			if len(arr) == 0 {
+				return nil, nil
+			}
+			if expr == "first" {
+				return arr[0], nil
+			}
+			return arr[len(arr)-1], nil
+		}, nil
+	}
+
+	if strings.HasPrefix(expr, "join(") && strings.HasSuffix(expr, ")") {
+		sep, err := unquote(strings.TrimSpace(expr[len("join(") : len(expr)-1]))
+		if err != nil {
+			return nil, err
+		}
+		return func(v interface{}) (interface{}, error) {
+			arr, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cannot join %s", describe(v))
+			}
+			items := make([]string, len(arr))
+			for i, item := range arr {
+				s, err := String([]interface{}{item})
+				if err != nil {
+					return nil, err
+				}
+				items[i] = s
+			}
+			return strings.Join(items, sep), nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported function '%s'", expr)
+}
+
+// describe names the type of a JSON value for error messages
+func describe(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case json.Number, int, float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// sortedKeys lists the keys of an object in order, so results are stable
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// unquote reads a string literal in single or double quotes
+func unquote(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1], nil
+	}
+	if len(s) >= 2 && s[0] == '"' {
+		return strconv.Unquote(s)
+	}
+	return "", fmt.Errorf("expected a quoted string, got '%s'", s)
+}
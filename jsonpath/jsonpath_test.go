@@ -0,0 +1,93 @@
+package jsonpath
+
+import (
+	"testing"
+)
+
+const testDoc = `{
+	"name": "flottbot",
+	"stars": 120,
+	"archived": false,
+	"license": null,
+	"owner": {"login": "target", "site-admin": true},
+	"issues": [
+		{"id": 1, "title": "Crash on start", "state": "open", "labels": ["bug"]},
+		{"id": 2, "title": "Add jq", "state": "closed"},
+		{"id": 3, "title": "Docs", "state": "open", "comments": 12.5}
+	]
+}`
+
+func TestEvaluate(t *testing.T) {
+	data, err := Decode([]byte(testDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{"Root key", "$.name", "flottbot", false},
+		{"Number keeps its form", "$.stars", "120", false},
+		{"Boolean", "$.archived", "false", false},
+		{"Null", "$.license", "", false},
+		{"Nested key", "$.owner.login", "target", false},
+		{"Bracket key", "$.owner['site-admin']", "true", false},
+		{"Index", "$.issues[1].title", "Add jq", false},
+		{"Negative index", "$.issues[-1].id", "3", false},
+		{"Slice", "$.issues[0:2].id", "[1,2]", false},
+		{"Wildcard", "$.issues[*].state", `["open","closed","open"]`, false},
+		{"Recursive descent", "$..labels", `["bug"]`, false},
+		{"Filter", `$.issues[?(@.state == "open")].title`, `["Crash on start","Docs"]`, false},
+		{"Numeric filter", "$.issues[?(@.id >= 2)].id", "[2,3]", false},
+		{"Existence filter", "$.issues[?(@.comments)].comments", "12.5", false},
+		{"Object", "$.owner", `{"login":"target","site-admin":true}`, false},
+		{"jq path", ".issues[0].labels[0]", "bug", false},
+		{"jq quoted key", `.owner."site-admin"`, "true", false},
+		{"jq iterate", ".issues[].id", "[1,2,3]", false},
+		{"jq identity", ". | keys | join(\",\")", "archived,issues,license,name,owner,stars", false},
+		{"jq length", ".issues | length", "3", false},
+		{"Paths after pipes are not supported", ".issues | first | .title", "", true},
+		{"jq last", ".issues | last", `{"comments":12.5,"id":3,"state":"open","title":"Docs"}`, false},
+		{"Missing key", "$.owner.email", "", true},
+		{"Index out of range", "$.issues[5].title", "", true},
+		{"Not an array", "$.owner[0]", "", true},
+		{"Nothing matches", `$.issues[?(@.state == "merged")]`, "", true},
+		{"Invalid path", "issues", "", true},
+		{"Unsupported function", ".issues | sort", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := Compile(tt.expr)
+			var got string
+			if err == nil {
+				var values []interface{}
+				values, err = path.Evaluate(data)
+				if err == nil {
+					got, err = String(values)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("%s: error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("%s = %s, want %s", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrorMessage(t *testing.T) {
+	data, _ := Decode([]byte(testDoc))
+	path, err := Compile("$.issues[1].labels[0]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = path.Evaluate(data)
+	want := "'$.issues[1].labels[0]' does not resolve: $.issues[1] has no key 'labels'"
+	if err == nil || err.Error() != want {
+		t.Errorf("Evaluate() error = %v, want %s", err, want)
+	}
+}
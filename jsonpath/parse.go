@@ -0,0 +1,246 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// step finds the values a part of a path points to, starting from a value
+type step interface {
+	apply(n node) ([]node, error)
+}
+
+// parser reads the steps of a path
+type parser struct {
+	expr string
+	pos  int
+}
+
+// parsePath parses a path starting at '$' (or '@' in filters), or a jq-style path starting at '.'
+func (p *parser) parsePath() ([]step, error) {
+	switch {
+	case strings.HasPrefix(p.expr, "$"), strings.HasPrefix(p.expr, "@"):
+		p.pos++
+	case strings.HasPrefix(p.expr, "."):
+	default:
+		return nil, fmt.Errorf("a path must start with '$' or '.'")
+	}
+
+	steps := []step{}
+	for p.pos < len(p.expr) {
+		switch {
+		case strings.HasPrefix(p.expr[p.pos:], ".."):
+			p.pos += 2
+			inner, err := p.parseMember()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, recursiveStep{inner})
+		case p.expr[p.pos] == '.':
+			p.pos++
+			// A lone '.' is jq's identity, '.[' is followed by a bracket
+			if p.pos == len(p.expr) || p.expr[p.pos] == '[' {
+				continue
+			}
+			s, err := p.parseMember()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, s)
+		case p.expr[p.pos] == '[':
+			s, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, s)
+		default:
+			return nil, fmt.Errorf("unexpected '%c' at position %d", p.expr[p.pos], p.pos)
+		}
+	}
+	return steps, nil
+}
+
+// parseMember parses what follows a dot: a name, a quoted name, '*', or a bracket
+func (p *parser) parseMember() (step, error) {
+	if p.pos == len(p.expr) {
+		return nil, fmt.Errorf("missing name at the end")
+	}
+	switch c := p.expr[p.pos]; {
+	case c == '*':
+		p.pos++
+		return wildcardStep{}, nil
+	case c == '[':
+		return p.parseBracket()
+	case c == '"':
+		end := closingQuote(p.expr, p.pos)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string at position %d", p.pos)
+		}
+		name, err := strconv.Unquote(p.expr[p.pos : end+1])
+		if err != nil {
+			return nil, err
+		}
+		p.pos = end + 1
+		return childStep{name}, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.expr) && isNameChar(p.expr[p.pos]) {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, fmt.Errorf("unexpected '%c' at position %d", p.expr[p.pos], p.pos)
+	}
+	return childStep{p.expr[start:p.pos]}, nil
+}
+
+// parseBracket parses [n], [start:end], [*], [], ['name'], and [?(filter)]
+func (p *parser) parseBracket() (step, error) {
+	start := p.pos
+	end := closingBracket(p.expr, p.pos)
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated '[' at position %d", start)
+	}
+	content := strings.TrimSpace(p.expr[start+1 : end])
+	p.pos = end + 1
+
+	switch {
+	case content == "" || content == "*":
+		return wildcardStep{}, nil
+	case strings.HasPrefix(content, "?(") && strings.HasSuffix(content, ")"):
+		return parseFilter(content[2 : len(content)-1])
+	case strings.HasPrefix(content, "'") || strings.HasPrefix(content, `"`):
+		name, err := unquote(content)
+		if err != nil {
+			return nil, err
+		}
+		return childStep{name}, nil
+	case strings.Contains(content, ":"):
+		bounds := strings.SplitN(content, ":", 2)
+		s := sliceStep{}
+		for i, b := range bounds {
+			b = strings.TrimSpace(b)
+			if len(b) == 0 {
+				continue
+			}
+			n, err := strconv.Atoi(b)
+			if err != nil {
+				return nil, fmt.Errorf("invalid slice '%s'", content)
+			}
+			if i == 0 {
+				s.start = &n
+			} else {
+				s.end = &n
+			}
+		}
+		return s, nil
+	}
+
+	i, err := strconv.Atoi(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index '%s'", content)
+	}
+	return indexStep{i}, nil
+}
+
+// filterOps are the supported comparisons, longest first so '<=' isn't read as '<'
+var filterOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseFilter parses a filter condition like '@.state == "open"' or '@.labels'
+func parseFilter(cond string) (step, error) {
+	left, op, right := cond, "", ""
+	for i := 0; i < len(cond) && len(op) == 0; i++ {
+		if cond[i] == '"' || cond[i] == '\'' {
+			if end := closingQuote(cond, i); end > 0 {
+				i = end
+			}
+			continue
+		}
+		for _, candidate := range filterOps {
+			if strings.HasPrefix(cond[i:], candidate) {
+				left, op, right = cond[:i], candidate, cond[i+len(candidate):]
+				break
+			}
+		}
+	}
+
+	p := &parser{expr: strings.TrimSpace(left)}
+	if !strings.HasPrefix(p.expr, "@") {
+		return nil, fmt.Errorf("a filter must start with '@'")
+	}
+	steps, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+
+	f := filterStep{steps: steps, op: op}
+	if len(op) > 0 {
+		if f.value, err = parseLiteral(strings.TrimSpace(right)); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// parseLiteral reads the value a filter compares with
+func parseLiteral(s string) (interface{}, error) {
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if strings.HasPrefix(s, "'") || strings.HasPrefix(s, `"`) {
+		return unquote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return json.Number(s), nil
+	}
+	return nil, fmt.Errorf("invalid value '%s'", s)
+}
+
+// isNameChar tells whether a character can be part of an unquoted name
+func isNameChar(c byte) bool {
+	return c == '_' || c == '-' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// closingQuote finds the quote ending the string starting at start
+func closingQuote(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// closingBracket finds the ']' matching the '[' at start, skipping over strings and nested brackets
+func closingBracket(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			end := closingQuote(s, i)
+			if end < 0 {
+				return -1
+			}
+			i = end
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
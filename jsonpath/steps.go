@@ -0,0 +1,226 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// childStep selects a key of an object
+type childStep struct {
+	name string
+}
+
+func (s childStep) apply(n node) ([]node, error) {
+	obj, ok := n.value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is %s, not an object", n.path, describe(n.value))
+	}
+	v, ok := obj[s.name]
+	if !ok {
+		return nil, fmt.Errorf("%s has no key '%s'", n.path, s.name)
+	}
+	return []node{{value: v, path: n.path + "." + s.name}}, nil
+}
+
+// indexStep selects an item of an array, counting from the end if negative
+type indexStep struct {
+	index int
+}
+
+func (s indexStep) apply(n node) ([]node, error) {
+	arr, ok := n.value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is %s, not an array", n.path, describe(n.value))
+	}
+	i := s.index
+	if i < 0 {
+		i += len(arr)
+	}
+	if i < 0 || i >= len(arr) {
+		return nil, fmt.Errorf("%s has %d items, there is no item %d", n.path, len(arr), s.index)
+	}
+	return []node{{value: arr[i], path: n.path + "[" + strconv.Itoa(i) + "]"}}, nil
+}
+
+// sliceStep selects a range of items of an array
+type sliceStep struct {
+	start, end *int
+}
+
+func (s sliceStep) apply(n node) ([]node, error) {
+	arr, ok := n.value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is %s, not an array", n.path, describe(n.value))
+	}
+	start, end := 0, len(arr)
+	if s.start != nil {
+		start = bound(*s.start, len(arr))
+	}
+	if s.end != nil {
+		end = bound(*s.end, len(arr))
+	}
+	nodes := []node{}
+	for i := start; i < end; i++ {
+		nodes = append(nodes, node{value: arr[i], path: n.path + "[" + strconv.Itoa(i) + "]"})
+	}
+	return nodes, nil
+}
+
+// bound turns a slice bound into an index within an array of the given length
+func bound(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > length {
+		return length
+	}
+	return i
+}
+
+// wildcardStep selects all items of an array or all values of an object
+type wildcardStep struct{}
+
+func (wildcardStep) apply(n node) ([]node, error) {
+	return children(n), nil
+}
+
+// children lists the items of an array or the values of an object, in key order
+func children(n node) []node {
+	nodes := []node{}
+	switch v := n.value.(type) {
+	case []interface{}:
+		for i, item := range v {
+			nodes = append(nodes, node{value: item, path: n.path + "[" + strconv.Itoa(i) + "]"})
+		}
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			nodes = append(nodes, node{value: v[k], path: n.path + "." + k})
+		}
+	}
+	return nodes
+}
+
+// recursiveStep applies a step to a value and everything nested in it
+type recursiveStep struct {
+	inner step
+}
+
+func (s recursiveStep) apply(n node) ([]node, error) {
+	found := []node{}
+	pending := []node{n}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = append(pending[1:], children(current)...)
+		// Values the step doesn't apply to are skipped, not errors
+		if matches, err := s.inner.apply(current); err == nil {
+			found = append(found, matches...)
+		}
+	}
+	return found, nil
+}
+
+// filterStep selects the items of an array (or values of an object) matching a condition
+type filterStep struct {
+	steps []step
+	op    string
+	value interface{}
+}
+
+func (s filterStep) apply(n node) ([]node, error) {
+	matched := []node{}
+	for _, child := range children(n) {
+		if s.matches(child) {
+			matched = append(matched, child)
+		}
+	}
+	return matched, nil
+}
+
+// matches tells whether an item meets the filter's condition
+func (s filterStep) matches(n node) bool {
+	nodes := []node{n}
+	for _, st := range s.steps {
+		next := []node{}
+		for _, current := range nodes {
+			found, err := st.apply(current)
+			if err != nil {
+				return false
+			}
+			next = append(next, found...)
+		}
+		nodes = next
+	}
+	if len(nodes) != 1 {
+		return false
+	}
+	if len(s.op) == 0 {
+		return true
+	}
+	return compare(nodes[0].value, s.op, s.value)
+}
+
+// compare compares two JSON values; only numbers and strings can be ordered
+func compare(a interface{}, op string, b interface{}) bool {
+	if fa, ok := number(a); ok {
+		if fb, ok := number(b); ok {
+			switch op {
+			case "==":
+				return fa == fb
+			case "!=":
+				return fa != fb
+			case "<":
+				return fa < fb
+			case "<=":
+				return fa <= fb
+			case ">":
+				return fa > fb
+			case ">=":
+				return fa >= fb
+			}
+		}
+	}
+	if sa, ok := a.(string); ok {
+		if sb, ok := b.(string); ok {
+			switch op {
+			case "==":
+				return sa == sb
+			case "!=":
+				return sa != sb
+			case "<":
+				return sa < sb
+			case "<=":
+				return sa <= sb
+			case ">":
+				return sa > sb
+			case ">=":
+				return sa >= sb
+			}
+		}
+	}
+	// Objects and arrays can't be compared
+	switch a.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	}
+	return false
+}
+
+// number reads a JSON number
+func number(v interface{}) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
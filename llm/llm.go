@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Message is one turn of a conversation with the model
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Conversation roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Client talks to an OpenAI-compatible chat completions API, e.g. OpenAI itself
+// or a self-hosted model served by vLLM, Ollama, or LocalAI
+type Client struct {
+	url    string
+	token  string
+	model  string
+	client *http.Client
+}
+
+// NewClient creates a client for the API at url (e.g. https://api.openai.com/v1) using the given model.
+// The token is sent as a bearer token and may be empty for self-hosted models.
+func NewClient(url, token, model string, timeout time.Duration) *Client {
+	return &Client{
+		url:    strings.TrimSuffix(url, "/"),
+		token:  token,
+		model:  model,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Chat sends a conversation to the model and returns its reply. If onChunk is set,
+// the reply is streamed and onChunk is called with each piece of it as it arrives.
+// The request stops when ctx is done.
+func (c *Client) Chat(ctx context.Context, messages []Message, onChunk func(chunk string)) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model":    c.model,
+		"messages": messages,
+		"stream":   onChunk != nil,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if len(c.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("LLM returned %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+
+	if onChunk == nil {
+		var completion struct {
+			Choices []struct {
+				Message Message `json:"message"`
+			} `json:"choices"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+			return "", err
+		}
+		if len(completion.Choices) == 0 {
+			return "", errors.New("LLM returned no reply")
+		}
+		return completion.Choices[0].Message.Content, nil
+	}
+
+	return readStream(resp, onChunk)
+}
+
+// readStream reads a streamed reply sent as server-sent events, one 'data:' line per chunk
+func readStream(resp *http.Response, onChunk func(chunk string)) (string, error) {
+	var reply strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta Message `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return reply.String(), err
+		}
+		if len(chunk.Choices) == 0 || len(chunk.Choices[0].Delta.Content) == 0 {
+			continue
+		}
+		reply.WriteString(chunk.Choices[0].Delta.Content)
+		onChunk(chunk.Choices[0].Delta.Content)
+	}
+	return reply.String(), scanner.Err()
+}
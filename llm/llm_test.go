@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChat(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"unauthorized"}`))
+			return
+		}
+		var req struct {
+			Model    string    `json:"model"`
+			Messages []Message `json:"messages"`
+			Stream   bool      `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "gpt-test" || len(req.Messages) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !req.Stream {
+			w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Hello there!"}}]}`))
+			return
+		}
+		for _, chunk := range []string{"Hello", " there", "!"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer ts.Close()
+
+	conversation := []Message{{Role: RoleSystem, Content: "Be nice"}, {Role: RoleUser, Content: "Hi"}}
+	client := NewClient(ts.URL+"/v1/", "secret", "gpt-test", time.Second)
+
+	reply, err := client.Chat(context.Background(), conversation, nil)
+	if err != nil || reply != "Hello there!" {
+		t.Errorf("Chat() = %q, %v", reply, err)
+	}
+
+	chunks := []string{}
+	reply, err = client.Chat(context.Background(), conversation, func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil || reply != "Hello there!" {
+		t.Errorf("Chat() streamed = %q, %v", reply, err)
+	}
+	if want := []string{"Hello", " there", "!"}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("Chat() streamed chunks %v, want %v", chunks, want)
+	}
+
+	if _, err := NewClient(ts.URL+"/v1", "wrong", "gpt-test", time.Second).Chat(context.Background(), conversation, nil); err == nil {
+		t.Error("Chat() expected an error for an unauthorized request")
+	}
+}
+
+func TestChatCancelled(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := NewClient(ts.URL, "", "gpt-test", time.Minute).Chat(ctx, []Message{{Role: RoleUser, Content: "Hi"}}, nil)
+	if err == nil || time.Since(start) > 10*time.Second {
+		t.Errorf("Chat() = %v after %s, want it stopped when the context is cancelled", err, time.Since(start))
+	}
+}
@@ -2,24 +2,93 @@ package models
 
 // Action defines the structure for Actions used within Rules
 type Action struct {
-	Name             string                 `mapstructure:"name" binding:"required"`
-	Type             string                 `mapstructure:"type" binding:"required"`
-	URL              string                 `mapstructure:"url"`
-	Cmd              string                 `mapstructure:"cmd"`
-	Timeout          int                    `mapstructure:"timeout"`
-	QueryData        map[string]interface{} `mapstructure:"query_data"`
-	CustomHeaders    map[string]string      `mapstructure:"custom_headers"`
-	Auth             []Auth                 `mapstructure:"auth"`
-	ExposeJSONFields map[string]string      `mapstructure:"expose_json_fields"`
-	Response         string                 `mapstructure:"response"`
-	LimitToRooms     []string               `mapstructure:"limit_to_rooms"`
-	Message          string                 `mapstructure:"message"`
-	Reaction         string                 `mapstructure:"update_reaction" binding:"omitempty"`
+	Name                  string                 `mapstructure:"name" binding:"required"`
+	Type                  string                 `mapstructure:"type" binding:"required"`
+	DependsOn             []string               `mapstructure:"depends_on" binding:"omitempty"`
+	RunIf                 string                 `mapstructure:"run_if" binding:"omitempty"`
+	SkipIf                string                 `mapstructure:"skip_if" binding:"omitempty"`
+	When                  string                 `mapstructure:"when" binding:"omitempty"`
+	ForEach               string                 `mapstructure:"for_each" binding:"omitempty"`
+	OnError               OnError                `mapstructure:"on_error" binding:"omitempty"`
+	Destructive           bool                   `mapstructure:"destructive" binding:"omitempty"`
+	URL                   string                 `mapstructure:"url"`
+	Cmd                   string                 `mapstructure:"cmd"`
+	Container             Container              `mapstructure:"container" binding:"omitempty"`
+	Dir                   string                 `mapstructure:"dir" binding:"omitempty"`
+	Env                   []string               `mapstructure:"env" binding:"omitempty"`
+	EnvVars               map[string]string      `mapstructure:"env_vars" binding:"omitempty"`
+	KillGrace             string                 `mapstructure:"kill_grace" binding:"omitempty"`
+	StreamOutput          bool                   `mapstructure:"stream_output" binding:"omitempty"`
+	Host                  string                 `mapstructure:"host" binding:"omitempty"`
+	User                  string                 `mapstructure:"user" binding:"omitempty"`
+	SSHKey                string                 `mapstructure:"ssh_key" binding:"omitempty"`
+	HostKey               string                 `mapstructure:"host_key" binding:"omitempty"`
+	Timeout               int                    `mapstructure:"timeout"`
+	Retries               int                    `mapstructure:"retries"`
+	RetryBackoff          string                 `mapstructure:"retry_backoff"`
+	RetryOnStatus         []int                  `mapstructure:"retry_on_status"`
+	TLSCert               string                 `mapstructure:"tls_cert"`
+	TLSKey                string                 `mapstructure:"tls_key"`
+	TLSCA                 string                 `mapstructure:"tls_ca"`
+	TLSInsecureSkipVerify bool                   `mapstructure:"tls_insecure_skip_verify"`
+	Proxy                 string                 `mapstructure:"proxy"`
+	Artifact              string                 `mapstructure:"artifact" binding:"omitempty"`
+	QueryData             map[string]interface{} `mapstructure:"query_data"`
+	CustomHeaders         map[string]string      `mapstructure:"custom_headers"`
+	Auth                  []Auth                 `mapstructure:"auth"`
+	ExposeJSONFields      map[string]string      `mapstructure:"expose_json_fields"`
+	Extract               map[string]string      `mapstructure:"extract"`
+	Response              string                 `mapstructure:"response"`
+	LimitToRooms          []string               `mapstructure:"limit_to_rooms"`
+	Message               string                 `mapstructure:"message"`
+	Reaction              string                 `mapstructure:"update_reaction" binding:"omitempty"`
+	Database              string                 `mapstructure:"database" binding:"omitempty"`
+	Query                 string                 `mapstructure:"query" binding:"omitempty"`
+	Params                []string               `mapstructure:"params" binding:"omitempty"`
+	Range                 string                 `mapstructure:"range" binding:"omitempty"`
+	Step                  string                 `mapstructure:"step" binding:"omitempty"`
+	Matchers              map[string]string      `mapstructure:"matchers" binding:"omitempty"`
+	Duration              string                 `mapstructure:"duration" binding:"omitempty"`
+	Comment               string                 `mapstructure:"comment" binding:"omitempty"`
+	Wait                  string                 `mapstructure:"wait" binding:"omitempty"`
+	Dashboard             string                 `mapstructure:"dashboard" binding:"omitempty"`
+	Panel                 int                    `mapstructure:"panel" binding:"omitempty"`
+	DashboardVars         map[string]string      `mapstructure:"dashboard_vars" binding:"omitempty"`
+	Width                 int                    `mapstructure:"width" binding:"omitempty"`
+	Height                int                    `mapstructure:"height" binding:"omitempty"`
+	Provider              string                 `mapstructure:"provider" binding:"omitempty"`
+	Schedule              string                 `mapstructure:"schedule" binding:"omitempty"`
+	Rule                  string                 `mapstructure:"rule" binding:"omitempty"`
+	Vars                  map[string]string      `mapstructure:"vars" binding:"omitempty"`
+	Broker                string                 `mapstructure:"broker" binding:"omitempty"`
+	Topic                 string                 `mapstructure:"topic" binding:"omitempty"`
+	Key                   string                 `mapstructure:"key" binding:"omitempty"`
+	From                  string                 `mapstructure:"from" binding:"omitempty"`
+	To                    []string               `mapstructure:"to" binding:"omitempty"`
+	CC                    []string               `mapstructure:"cc" binding:"omitempty"`
+	Subject               string                 `mapstructure:"subject" binding:"omitempty"`
+	Body                  string                 `mapstructure:"body" binding:"omitempty"`
+	Attachments           []string               `mapstructure:"attachments" binding:"omitempty"`
+	Model                 string                 `mapstructure:"model" binding:"omitempty"`
+	SystemPrompt          string                 `mapstructure:"system_prompt" binding:"omitempty"`
+	History               int                    `mapstructure:"history" binding:"omitempty"`
+}
+
+// OnError defines what happens when an action fails: a fallback message replacing the rule's output,
+// actions to run instead, and whether the rule continues with its next action or aborts ('then')
+type OnError struct {
+	Message string   `mapstructure:"message"`
+	Actions []Action `mapstructure:"actions"`
+	Then    string   `mapstructure:"then"`
 }
 
 // Auth is a basic Auth data structure
 type Auth struct {
-	Type string `mapstructure:"type"`
-	User string `mapstructure:"user"`
-	Pass string `mapstructure:"pass"`
+	Type         string   `mapstructure:"type"`
+	User         string   `mapstructure:"user"`
+	Pass         string   `mapstructure:"pass"`
+	TokenURL     string   `mapstructure:"token_url"`
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	Scopes       []string `mapstructure:"scopes"`
 }
@@ -0,0 +1,31 @@
+package models
+
+// AutoResponders are the canned answers of the 'autoresponders' built-in module, configured per
+// channel with 'auto_responders' in bot.yml
+type AutoResponders struct {
+	OfficeHours OfficeHours        `mapstructure:"office_hours"` // when channels that don't set their own are staffed
+	Channels    []ChannelResponder `mapstructure:"channels"`
+}
+
+// ChannelResponder holds the canned answers of a channel, and who manages them
+type ChannelResponder struct {
+	Channel     string         `mapstructure:"channel"`      // by name or ID
+	Admins      []string       `mapstructure:"admins"`       // who can manage its answers from chat besides the bot's admins, by user name or ID
+	OfficeHours OfficeHours    `mapstructure:"office_hours"` // when the channel is staffed, default the office hours of all channels
+	Answers     []AutoResponse `mapstructure:"answers"`
+}
+
+// AutoResponse answers messages that mention any of its keywords
+type AutoResponse struct {
+	Keywords   []string `mapstructure:"keywords" json:"keywords"`
+	Answer     string   `mapstructure:"answer" json:"answer,omitempty"`
+	AfterHours string   `mapstructure:"after_hours" json:"after_hours,omitempty"` // answered instead outside office hours
+}
+
+// OfficeHours are when a channel is staffed; without a start and end, it always is
+type OfficeHours struct {
+	Days     []string `mapstructure:"days"`     // e.g. [sat, sun], default monday to friday
+	Start    string   `mapstructure:"start"`    // e.g. 09:00
+	End      string   `mapstructure:"end"`      // e.g. 17:00
+	Timezone string   `mapstructure:"timezone"` // e.g. America/Chicago, default the bot's
+}
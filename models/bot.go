@@ -1,33 +1,138 @@
 package models
 
-import "github.com/sirupsen/logrus"
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/target/flottbot/audit"
+	"github.com/target/flottbot/i18n"
+	"github.com/target/flottbot/nlu"
+	"github.com/target/flottbot/storage"
+)
 
 // Bot is a struct representation of bot.yml
 type Bot struct {
 	// Bot fields
-	ID                            string            `mapstructure:"id"`
-	Name                          string            `mapstructure:"name" binding:"required"`
-	SlackToken                    string            `mapstructure:"slack_token"`
-	SlackVerificationToken        string            `mapstructure:"slack_verification_token"`
-	SlackWorkspaceToken           string            `mapstructure:"slack_workspace_token"`
-	SlackEventsCallbackPath       string            `mapstructure:"slack_events_callback_path"`
-	SlackInteractionsCallbackPath string            `mapstructure:"slack_interactions_callback_path"`
-	DiscordToken                  string            `mapstructure:"discord_token"`
-	Users                         map[string]string `mapstructure:"slack_users"`
-	UserGroups                    map[string]string `mapstructure:"slack_usergroups"`
-	Rooms                         map[string]string `mapstructure:"slack_channels"`
-	CLI                           bool              `mapstructure:"cli,omitempty"`
-	CLIUser                       string            `mapstructure:"cli_user,omitempty"`
-	Scheduler                     bool              `mapstructure:"scheduler,omitempty"`
-	ChatApplication               string            `mapstructure:"chat_application" binding:"required"`
-	Debug                         bool              `mapstructure:"debug,omitempty"`
-	LogJSON                       bool              `mapstructure:"log_json,omitempty"`
-	InteractiveComponents         bool              `mapstructure:"interactive_components,omitempty"`
-	Metrics                       bool              `mapstructure:"metrics,omitempty"`
-	CustomHelpText                string            `mapstructure:"custom_help_text,omitempty"`
+	ID                            string              `mapstructure:"id"`
+	Name                          string              `mapstructure:"name" binding:"required"`
+	SlackToken                    string              `mapstructure:"slack_token"`
+	SlackVerificationToken        string              `mapstructure:"slack_verification_token"`
+	SlackWorkspaceToken           string              `mapstructure:"slack_workspace_token"`
+	SlackWorkspaceTokens          map[string]string   `mapstructure:"slack_workspace_tokens,omitempty"`
+	SlackEventsCallbackPath       string              `mapstructure:"slack_events_callback_path"`
+	SlackInteractionsCallbackPath string              `mapstructure:"slack_interactions_callback_path"`
+	SlackEventsAddress            string              `mapstructure:"slack_events_address,omitempty"`
+	SlackInteractionsAddress      string              `mapstructure:"slack_interactions_address,omitempty"`
+	SlackUserCacheTTL             string              `mapstructure:"slack_user_cache_ttl,omitempty"`
+	DiscordToken                  string              `mapstructure:"discord_token"`
+	Users                         map[string]string   `mapstructure:"slack_users"`
+	UserGroups                    map[string]string   `mapstructure:"slack_usergroups"`
+	Rooms                         map[string]string   `mapstructure:"slack_channels"`
+	CLI                           bool                `mapstructure:"cli,omitempty"`
+	CLIUser                       string              `mapstructure:"cli_user,omitempty"`
+	Scheduler                     bool                `mapstructure:"scheduler,omitempty"`
+	ChatApplication               string              `mapstructure:"chat_application" binding:"required"`
+	Debug                         bool                `mapstructure:"debug,omitempty"`
+	LogJSON                       bool                `mapstructure:"log_json,omitempty"`
+	InteractiveComponents         bool                `mapstructure:"interactive_components,omitempty"`
+	Metrics                       bool                `mapstructure:"metrics,omitempty"`
+	CustomHelpText                string              `mapstructure:"custom_help_text,omitempty"`
+	Admins                        []string            `mapstructure:"admins,omitempty"`
+	StateDir                      string              `mapstructure:"state_dir,omitempty"`
+	Storage                       string              `mapstructure:"storage,omitempty"`
+	StorageURL                    string              `mapstructure:"storage_url,omitempty"`
+	StorageEncryptionKeys         []string            `mapstructure:"storage_encryption_keys,omitempty"`
+	HighAvailability              bool                `mapstructure:"high_availability,omitempty"`
+	SharedQueue                   bool                `mapstructure:"shared_queue,omitempty"`
+	EventDedupSize                int                 `mapstructure:"event_dedup_size,omitempty"`
+	EventDedupStore               bool                `mapstructure:"event_dedup_store,omitempty"`
+	TracingEndpoint               string              `mapstructure:"tracing_endpoint,omitempty"`
+	TracingHeaders                map[string]string   `mapstructure:"tracing_headers,omitempty"`
+	AdminAPI                      bool                `mapstructure:"admin_api,omitempty"`
+	AdminAPIAddress               string              `mapstructure:"admin_api_address,omitempty"`
+	AdminAPIToken                 string              `mapstructure:"admin_api_token,omitempty"`
+	Health                        bool                `mapstructure:"health,omitempty"`
+	HealthAddress                 string              `mapstructure:"health_address,omitempty"`
+	Audit                         string              `mapstructure:"audit,omitempty"`
+	AuditTarget                   string              `mapstructure:"audit_target,omitempty"`
+	RuleStats                     bool                `mapstructure:"rule_stats,omitempty"`
+	RecordTraffic                 bool                `mapstructure:"record_traffic,omitempty"`
+	RecordFile                    string              `mapstructure:"record_file,omitempty"`
+	DryRun                        bool                `mapstructure:"dry_run,omitempty"`
+	RedactPatterns                []string            `mapstructure:"redact_patterns,omitempty"`
+	InputMiddleware               []Middleware        `mapstructure:"input_middleware,omitempty"`
+	OutputMiddleware              []Middleware        `mapstructure:"output_middleware,omitempty"`
+	OutputLimits                  OutputLimits        `mapstructure:"output_limits,omitempty"`
+	HTTPAuth                      map[string]HTTPAuth `mapstructure:"http_auth,omitempty"`
+	HTTPLimits                    HTTPLimits          `mapstructure:"http_limits,omitempty"`
+	Bridges                       []Bridge            `mapstructure:"bridges,omitempty"`
+	Identities                    map[string][]string `mapstructure:"identities,omitempty"`
+	MatchMode                     string              `mapstructure:"match_mode,omitempty"`
+	InputQueueSize                int                 `mapstructure:"input_queue_size,omitempty"`
+	InputQueueOverflow            string              `mapstructure:"input_queue_overflow,omitempty"`
+	Workers                       int                 `mapstructure:"workers,omitempty"`
+	OutputParallelism             int                 `mapstructure:"output_parallelism,omitempty"`
+	ShutdownTimeout               string              `mapstructure:"shutdown_timeout,omitempty"`
+	ErrorChannel                  string              `mapstructure:"error_channel,omitempty"`
+	Heartbeat                     Heartbeat           `mapstructure:"heartbeat,omitempty"`
+	NLU                           string              `mapstructure:"nlu,omitempty"`
+	NLUURL                        string              `mapstructure:"nlu_url,omitempty"`
+	NLUToken                      string              `mapstructure:"nlu_token,omitempty"`
+	NLUCredentials                string              `mapstructure:"nlu_credentials,omitempty"`
+	NLULanguage                   string              `mapstructure:"nlu_language,omitempty"`
+	NLUConfidence                 float64             `mapstructure:"nlu_confidence,omitempty"`
+	LLMURL                        string              `mapstructure:"llm_url,omitempty"`
+	LLMToken                      string              `mapstructure:"llm_token,omitempty"`
+	LLMModel                      string              `mapstructure:"llm_model,omitempty"`
+	LLMSystemPrompt               string              `mapstructure:"llm_system_prompt,omitempty"`
+	LLMHistory                    int                 `mapstructure:"llm_history,omitempty"`
+	LLMFallback                   bool                `mapstructure:"llm_fallback,omitempty"`
+	DefaultLocale                 string              `mapstructure:"default_locale,omitempty"`
+	ChannelLocales                map[string]string   `mapstructure:"channel_locales,omitempty"`
+	CircuitBreakerFailures        int                 `mapstructure:"circuit_breaker_failures,omitempty"`
+	CircuitBreakerCooldown        string              `mapstructure:"circuit_breaker_cooldown,omitempty"`
+	HTTPTLSCert                   string              `mapstructure:"http_tls_cert,omitempty"`
+	HTTPTLSKey                    string              `mapstructure:"http_tls_key,omitempty"`
+	HTTPTLSCA                     string              `mapstructure:"http_tls_ca,omitempty"`
+	HTTPProxy                     string              `mapstructure:"http_proxy,omitempty"`
+	Databases                     map[string]Database `mapstructure:"databases,omitempty"`
+	Brokers                       map[string]Broker   `mapstructure:"brokers,omitempty"`
+	SSHUser                       string              `mapstructure:"ssh_user,omitempty"`
+	SSHKey                        string              `mapstructure:"ssh_key,omitempty"`
+	SSHKnownHosts                 string              `mapstructure:"ssh_known_hosts,omitempty"`
+	SMTPHost                      string              `mapstructure:"smtp_host,omitempty"`
+	SMTPUsername                  string              `mapstructure:"smtp_username,omitempty"`
+	SMTPPassword                  string              `mapstructure:"smtp_password,omitempty"`
+	SMTPFrom                      string              `mapstructure:"smtp_from,omitempty"`
+	SMTPTLS                       string              `mapstructure:"smtp_tls,omitempty"`
+	PrometheusURL                 string              `mapstructure:"prometheus_url,omitempty"`
+	PrometheusToken               string              `mapstructure:"prometheus_token,omitempty"`
+	AlertmanagerURL               string              `mapstructure:"alertmanager_url,omitempty"`
+	AlertmanagerToken             string              `mapstructure:"alertmanager_token,omitempty"`
+	GrafanaURL                    string              `mapstructure:"grafana_url,omitempty"`
+	GrafanaToken                  string              `mapstructure:"grafana_token,omitempty"`
+	PagerDutyURL                  string              `mapstructure:"pagerduty_url,omitempty"`
+	PagerDutyToken                string              `mapstructure:"pagerduty_token,omitempty"`
+	OpsgenieURL                   string              `mapstructure:"opsgenie_url,omitempty"`
+	OpsgenieToken                 string              `mapstructure:"opsgenie_token,omitempty"`
+	Modules                       []string            `mapstructure:"modules,omitempty"`
+	Incidents                     Incidents           `mapstructure:"incidents,omitempty"`
+	Standups                      []Standup           `mapstructure:"standups,omitempty"`
+	Digests                       []Digest            `mapstructure:"digests,omitempty"`
+	FeedbackReport                FeedbackReport      `mapstructure:"feedback_report,omitempty"`
+	Protection                    Protection          `mapstructure:"protection,omitempty"`
+	AutoResponders                AutoResponders      `mapstructure:"auto_responders,omitempty"`
+	CommandAliases                map[string]string   `mapstructure:"command_aliases,omitempty"`
+	MentionPrefixes               []string            `mapstructure:"mention_prefixes,omitempty"`
+	Bots                          []string            `mapstructure:"bots,omitempty"`
 	// System
 	Log          logrus.Logger
 	RunChat      bool
 	RunCLI       bool
 	RunScheduler bool
+	Store        storage.Storage
+	InstanceID   string
+	AuditSink    audit.Sink
+	NLUProvider  nlu.Provider
+	Catalog      i18n.Catalog
+	ConfigDir    string // set for the additional bots of a process, see 'bots' in bot.yml
 }
@@ -0,0 +1,15 @@
+package models
+
+// Bridge relays the messages of one of a bot's channels to channels of other bots running in the
+// same process, configured with 'bridges' in bot.yml
+type Bridge struct {
+	Channel string         `mapstructure:"channel"` // the channel of this bot, by name or ID
+	To      []BridgeTarget `mapstructure:"to"`
+	Format  string         `mapstructure:"format"` // how relayed messages are written, in Markdown
+}
+
+// BridgeTarget is a channel messages are relayed to
+type BridgeTarget struct {
+	Bot     string `mapstructure:"bot"`     // the name of the bot, this bot if it's empty
+	Channel string `mapstructure:"channel"` // the channel of that bot, by name or ID
+}
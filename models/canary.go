@@ -0,0 +1,10 @@
+package models
+
+// Canary makes a rule the new version of another rule, its stable version, for some of the messages
+// that rule would run for: a percentage of them, and those of some users. The other messages get the
+// stable version. The canary is matched with its own trigger, in place of the stable version's.
+type Canary struct {
+	Of      string   `mapstructure:"of"`      // the name of the stable version
+	Percent float64  `mapstructure:"percent"` // of the messages that get the canary, e.g. 10
+	Users   []string `mapstructure:"users"`   // who always get the canary, by user name or ID
+}
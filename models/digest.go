@@ -0,0 +1,14 @@
+package models
+
+// Digest collects the outputs of the rules that name it with 'digest', instead of sending each of them,
+// and posts them as one message on its schedule, e.g. an hourly digest of alerts. It's configured with
+// 'digests' in bot.yml.
+type Digest struct {
+	Name     string `mapstructure:"name"`      // what rules call it with 'digest'
+	Channel  string `mapstructure:"channel"`   // where it's posted
+	Schedule string `mapstructure:"schedule"`  // when it's posted, like a rule's 'schedule'
+	GroupBy  string `mapstructure:"group_by"`  // e.g. '${alert}'; outputs with the same value are counted together, and the latest is shown
+	MaxItems int    `mapstructure:"max_items"` // how many outputs, or groups, are listed, default 20
+	Locale   string `mapstructure:"locale"`    // of its text, default the channel's
+	Timezone string `mapstructure:"timezone"`  // of the times in it, default UTC
+}
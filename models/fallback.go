@@ -0,0 +1,9 @@
+package models
+
+// Fallback is where a rule's messages to 'output_to_users' also go when a user is away, e.g. for
+// paging-style notifications that must reach someone
+type Fallback struct {
+	Identity bool   `mapstructure:"identity"` // to the user's accounts on the other chat applications (see 'identities' in bot.yml)
+	Email    string `mapstructure:"email"`    // to an email address; ${user} is the user of 'output_to_users'
+	Subject  string `mapstructure:"subject"`  // the subject of the email
+}
@@ -0,0 +1,9 @@
+package models
+
+// FeedbackReport posts a summary of the feedback on the answers of rules with 'feedback' to a channel,
+// weekly by default. It's configured with 'feedback_report' in bot.yml.
+type FeedbackReport struct {
+	Channel  string `mapstructure:"channel"`  // where it's posted
+	Schedule string `mapstructure:"schedule"` // when it's posted, like a rule's 'schedule', default Mondays at 9:00
+	Days     int    `mapstructure:"days"`     // how many days it covers, default 7
+}
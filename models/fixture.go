@@ -0,0 +1,10 @@
+package models
+
+// Fixture is the canned result of an HTTP or exec action, used instead of running the action when rules are simulated
+type Fixture struct {
+	Rule   string `mapstructure:"rule"`   // the rule the action belongs to, any rule if empty
+	Action string `mapstructure:"action"` // the action's name
+	Status int    `mapstructure:"status"` // the HTTP status (default 200), or the exit status of exec and ssh actions
+	Body   string `mapstructure:"body"`   // the HTTP response's body, or the output of exec and ssh actions
+	Error  string `mapstructure:"error"`  // fails the action, e.g. as if the request couldn't be made
+}
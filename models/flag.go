@@ -0,0 +1,12 @@
+package models
+
+// Flag declares a '--flag' of a 'respond' rule, e.g. 'deploy api --env staging --force'. Its value is
+// available to the rule like an arg, by its name.
+type Flag struct {
+	Name        string `mapstructure:"name" binding:"required"`         // given as --name
+	Short       string `mapstructure:"short" binding:"omitempty"`       // a single letter it can also be given as, e.g. -e
+	Type        string `mapstructure:"type" binding:"omitempty"`        // like the type of a variable; 'bool' flags take no value
+	Default     string `mapstructure:"default" binding:"omitempty"`     // its value when it's not given, default empty or 'false' for 'bool'
+	Required    bool   `mapstructure:"required" binding:"omitempty"`    // whether it must be given
+	Description string `mapstructure:"description" binding:"omitempty"` // shown in the usage of the rule
+}
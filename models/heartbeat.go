@@ -0,0 +1,12 @@
+package models
+
+// Heartbeat has the bot show it's alive, and watch its chat application for silence, configured
+// with 'heartbeat' in bot.yml
+type Heartbeat struct {
+	Interval     string `mapstructure:"interval"`      // how often, default 5m
+	URL          string `mapstructure:"url"`           // pinged every interval while all is well, e.g. a dead man's switch
+	Channel      string `mapstructure:"channel"`       // posted to every interval while all is well
+	Message      string `mapstructure:"message"`       // what's posted to the channel
+	Silence      string `mapstructure:"silence"`       // how long the chat application may be silent, default 30m
+	AlertChannel string `mapstructure:"alert_channel"` // told when it's silent for longer, default 'error_channel'
+}
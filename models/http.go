@@ -5,4 +5,7 @@ type HTTPResponse struct {
 	Status int
 	Raw    string
 	Data   interface{}
+	// Set instead of Raw and Data when the response was saved as an artifact
+	Artifact     string
+	ArtifactSize int64
 }
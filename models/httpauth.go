@@ -0,0 +1,15 @@
+package models
+
+// HTTPAuth protects an HTTP server the bot exposes, configured per server with 'http_auth' in bot.yml.
+// Requests have to pass every check that is set.
+type HTTPAuth struct {
+	AllowIPs       []string `mapstructure:"allow_ips"`       // the addresses and CIDR ranges requests may come from
+	TrustedProxies []string `mapstructure:"trusted_proxies"` // the proxies whose X-Forwarded-For is believed
+	Username       string   `mapstructure:"username"`        // basic auth; a bearer token works too, when both are set
+	Password       string   `mapstructure:"password"`
+	BearerToken    string   `mapstructure:"bearer_token"`
+	HMACSecret     string   `mapstructure:"hmac_secret"`    // the secret the request body is signed with
+	HMACHeader     string   `mapstructure:"hmac_header"`    // the header with the signature, default X-Signature-256
+	HMACAlgorithm  string   `mapstructure:"hmac_algorithm"` // sha256 (default), sha1, or sha512
+	HMACPrefix     string   `mapstructure:"hmac_prefix"`    // what precedes the hex signature, e.g. 'sha256='
+}
@@ -0,0 +1,12 @@
+package models
+
+// HTTPLimits bounds the requests the HTTP servers the bot exposes take, configured with
+// 'http_limits' in bot.yml, so that broken or malicious callers can't exhaust memory or connections
+type HTTPLimits struct {
+	MaxBodyBytes      int64  `mapstructure:"max_body_bytes"`      // the largest request body, default 1 MiB
+	MaxHeaderBytes    int    `mapstructure:"max_header_bytes"`    // the largest request headers, default 64 KiB
+	ReadHeaderTimeout string `mapstructure:"read_header_timeout"` // how long reading request headers may take, default 10s
+	ReadTimeout       string `mapstructure:"read_timeout"`        // how long reading a whole request may take, default 30s
+	WriteTimeout      string `mapstructure:"write_timeout"`       // how long handling a request and responding may take, default 30s
+	IdleTimeout       string `mapstructure:"idle_timeout"`        // how long idle connections are kept open, default 2m
+}
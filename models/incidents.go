@@ -0,0 +1,11 @@
+package models
+
+// Incidents configures the 'incidents' built-in module, with 'incidents' in bot.yml. It works
+// without any of these set.
+type Incidents struct {
+	ChannelPrefix   string   `mapstructure:"channel_prefix"`   // what incident channels are named with, default 'incident-'
+	Severities      []string `mapstructure:"severities"`       // the severities incidents can have, default sev1 to sev4
+	Responders      []string `mapstructure:"responders"`       // invited to every incident channel
+	AnnounceChannel string   `mapstructure:"announce_channel"` // told when incidents start and are resolved
+	RetroTemplate   string   `mapstructure:"retro_template"`   // posted when an incident is resolved
+}
@@ -0,0 +1,9 @@
+package models
+
+// MatchOptions change how the 'respond' or 'hear' of a rule matches messages, e.g. ones typed on mobile
+// keyboards, which turn quotes into smart quotes and add emoji
+type MatchOptions struct {
+	CaseSensitive bool `mapstructure:"case_sensitive" binding:"omitempty"` // match the case of the trigger, which is ignored by default
+	Normalize     bool `mapstructure:"normalize" binding:"omitempty"`      // compose unicode characters (NFC) first, so 'é' matches however it was typed
+	StripSymbols  bool `mapstructure:"strip_symbols" binding:"omitempty"`  // straighten smart quotes and dashes, and leave out emoji first
+}
@@ -0,0 +1,8 @@
+package models
+
+// Memory describes a value a rule stores in, or reads from, the bot's conversation memory
+type Memory struct {
+	Key   string `mapstructure:"key" binding:"required"`
+	Value string `mapstructure:"value" binding:"omitempty"`
+	Scope string `mapstructure:"scope" binding:"omitempty"` // 'channel' (default) or 'user'
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"time"
 
 	"github.com/rs/xid"
@@ -11,13 +12,17 @@ type Message struct {
 	ID                string
 	Type              MessageType
 	Service           MessageService
+	Event             MessageEvent // whether the message was sent, or a message was edited or deleted
 	ChannelID         string
 	ChannelName       string
 	Input             string
 	Output            string
 	Error             string
-	Timestamp         string
-	ThreadTimestamp   string
+	Timestamp         string    // the chat application's ID of the message, e.g. Slack's 'ts'
+	Time              time.Time // when the message was sent, as far as the chat application tells
+	ThreadID          string    // the thread the message is in, or its output is sent to, if any
+	ReplyToID         string    // the message the output replies to, on chat applications with replies or threads
+	StartThread       bool      // start a thread on ReplyToID for the output, unless it's in a thread already
 	BotMentioned      bool
 	DirectMessageOnly bool
 	Debug             bool
@@ -29,6 +34,55 @@ type Message struct {
 	OutputToRooms     []string
 	OutputToUsers     []string
 	Remotes           Remotes
+	TraceParent       string     // W3C trace context of the span currently handling the message
+	CallDepth         int        // how many 'call_rule' actions deep the message is being handled
+	Files             []File     // files to upload along with the output
+	Run               RunContext // the rule run handling the message
+}
+
+// RunContext carries the context of the rule run handling a message, from the remote that read it
+// to the actions. It's done when the run is cancelled (e.g. its job), reaches the rule's 'timeout',
+// or is abandoned when the bot shuts down, so requests and scripts stop instead of leaking.
+type RunContext struct {
+	ctx context.Context
+}
+
+// NewRunContext creates the context of a rule run
+func NewRunContext(ctx context.Context) RunContext {
+	return RunContext{ctx: ctx}
+}
+
+// Context is the context of the run, context.Background() outside of one
+func (r RunContext) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// DeepCopy keeps the context when a message is copied (see github.com/mohae/deepcopy), since all
+// copies of a message belong to the same run
+func (r RunContext) DeepCopy() interface{} {
+	return r
+}
+
+// OutputThread is the thread the output of a message is sent to: the thread it's in, or the
+// message it replies to, when it starts a thread. Remotes map it to their own kind of thread,
+// e.g. Slack's 'thread_ts'; it's empty when the output goes to the channel.
+func (m Message) OutputThread() string {
+	if len(m.ThreadID) == 0 && m.StartThread {
+		return m.ReplyToID
+	}
+	return m.ThreadID
+}
+
+// File is a file sent along with a message: one a user shared with the bot, or one sent along with
+// its output, e.g. a CSV file or a chart
+type File struct {
+	Name        string
+	ContentType string
+	URL         string // where to get the file, when the bot doesn't have its contents
+	Data        []byte
 }
 
 // MessageType is used to differentiate between different message types
@@ -53,6 +107,20 @@ const (
 	MsgServiceScheduler
 )
 
+// MessageEvent is used to differentiate between messages being sent, edited, and deleted, the bot
+// joining or leaving channels, and users joining
+type MessageEvent int
+
+// Supported MessageEvents
+const (
+	MsgEventSent MessageEvent = iota
+	MsgEventEdited
+	MsgEventDeleted
+	MsgEventJoined     // the bot joined the channel
+	MsgEventLeft       // the bot left the channel
+	MsgEventUserJoined // a user joined the workspace, e.g. the Slack team or Discord server
+)
+
 // GenerateMessageID generates a random ID for a message
 func GenerateMessageID() string {
 	return xid.New().String()
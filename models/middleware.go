@@ -0,0 +1,19 @@
+package models
+
+// Middleware is a step of the chain the messages a bot receives or sends pass through, configured
+// with 'input_middleware' and 'output_middleware' in bot.yml
+type Middleware struct {
+	Type        string            `mapstructure:"type"`
+	Cmd         string            `mapstructure:"cmd"`         // script: the command the message is handed to
+	Timeout     int               `mapstructure:"timeout"`     // script, filter: seconds to wait for the command, or the moderation API
+	FailClosed  bool              `mapstructure:"fail_closed"` // script, filter: drop the message when the command, or the moderation API, fails
+	Text        string            `mapstructure:"text"`        // append: the text added to the output; filter: what's sent instead of blocked output
+	Words       []string          `mapstructure:"words"`       // replace, filter: the words masked in the output
+	Wordlists   []string          `mapstructure:"wordlists"`   // filter: files with more words, one per line
+	Replacement string            `mapstructure:"replacement"` // replace, filter: what the words are replaced with
+	Action      string            `mapstructure:"action"`      // filter: 'mask' the words (default), or 'block' the output
+	URL         string            `mapstructure:"url"`         // filter: the moderation API the output is checked with
+	Token       string            `mapstructure:"token"`       // filter: the bearer token of the moderation API
+	MaxLength   map[string]int    `mapstructure:"max_length"`  // max_length: the longest output, by chat application
+	Aliases     map[string]string `mapstructure:"aliases"`     // alias: the name to give users, by user name or ID
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// OnCall is someone on call for a schedule
+type OnCall struct {
+	Name  string
+	Email string
+	Until time.Time // when their shift ends, if the provider tells
+}
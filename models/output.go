@@ -0,0 +1,11 @@
+package models
+
+// OutputLimit is how long messages sent to a chat application can be, and what happens to longer
+// ones, configured with 'output_limits' in bot.yml
+type OutputLimit struct {
+	MaxLength int    `mapstructure:"max_length"`
+	Policy    string `mapstructure:"policy"` // 'split', 'thread', or 'truncate'
+}
+
+// OutputLimits are the output limits by chat application ('slack', 'discord', 'cli', ...)
+type OutputLimits map[string]OutputLimit
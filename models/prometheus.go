@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// PromSeries is one time series of a Prometheus query's result; instant queries have one sample per series
+type PromSeries struct {
+	Metric  map[string]string
+	Samples []PromSample
+}
+
+// PromSample is a value of a time series at a point in time
+type PromSample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Silence is a silence created in Alertmanager
+type Silence struct {
+	ID     string
+	EndsAt time.Time
+}
@@ -0,0 +1,15 @@
+package models
+
+// Prompt asks the user to choose among options, configured with 'prompt' in a rule. Choosing an
+// option is like sending the option's value to the bot, so other rules take it from there.
+type Prompt struct {
+	Text    string         `mapstructure:"text" binding:"omitempty"`
+	Options []PromptOption `mapstructure:"options" binding:"omitempty"`
+}
+
+// PromptOption is an option of a prompt
+type PromptOption struct {
+	Text  string `mapstructure:"text" binding:"required"`   // what the option says
+	Value string `mapstructure:"value" binding:"required"`  // what choosing it sends the bot, may have variables
+	Style string `mapstructure:"style" binding:"omitempty"` // 'primary' or 'danger', where buttons have styles
+}
@@ -0,0 +1,15 @@
+package models
+
+// Protection guards a bot in public communities, e.g. a Discord server, from spam and abuse, configured
+// with 'protection' in bot.yml. It's on for the chat applications in 'remotes'.
+type Protection struct {
+	Remotes          []string `mapstructure:"remotes"`           // the chat applications protected, e.g. discord
+	FloodMessages    int      `mapstructure:"flood_messages"`    // how many messages a user may send within flood_window, default 10
+	FloodWindow      string   `mapstructure:"flood_window"`      // default 1m
+	BlockInvites     bool     `mapstructure:"block_invites"`     // whether invites to Discord servers and Telegram groups are spam
+	BlockLinks       bool     `mapstructure:"block_links"`       // whether links to other domains than allowed_domains are spam
+	AllowedDomains   []string `mapstructure:"allowed_domains"`   // the domains, and their subdomains, links may go to
+	IgnoreFor        string   `mapstructure:"ignore_for"`        // how long users who flood or spam are ignored, default 1h
+	ShadowIgnore     []string `mapstructure:"shadow_ignore"`     // the users always ignored, without telling them, by name or ID
+	ModeratorChannel string   `mapstructure:"moderator_channel"` // told when users are ignored, default 'error_channel'
+}
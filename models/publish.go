@@ -0,0 +1,11 @@
+package models
+
+// Broker is a message broker 'publish' actions can send messages to, configured in bot.yml
+type Broker struct {
+	Type      string   `mapstructure:"type"`
+	Addresses []string `mapstructure:"addresses"`
+	Username  string   `mapstructure:"username"`
+	Password  string   `mapstructure:"password"`
+	TLS       bool     `mapstructure:"tls"`
+	Region    string   `mapstructure:"region"`
+}
@@ -2,27 +2,67 @@ package models
 
 // Rule is a struct representation of the .yml rules
 type Rule struct {
-	Name               string   `mapstructure:"name" binding:"required"`
-	Respond            string   `mapstructure:"respond" binding:"omitempty"`
-	Hear               string   `mapstructure:"hear" binding:"omitempty"`
-	Schedule           string   `mapstructure:"schedule"`
-	Args               []string `mapstructure:"args" binding:"required"`
-	DirectMessageOnly  bool     `mapstructure:"direct_message_only" binding:"required"`
-	OutputToRooms      []string `mapstructure:"output_to_rooms" binding:"omitempty"`
-	OutputToUsers      []string `mapstructure:"output_to_users" binding:"omitempty"`
-	AllowUsers         []string `mapstructure:"allow_users" binding:"omitempty"`
-	AllowUserGroups    []string `mapstructure:"allow_usergroups" binding:"omitempty"`
-	IgnoreUsers        []string `mapstructure:"ignore_users" binding:"omitempty"`
-	IgnoreUserGroups   []string `mapstructure:"ignore_usergroups" binding:"omitempty"`
-	StartMessageThread bool     `mapstructure:"start_message_thread" binding:"omitempty"`
-	FormatOutput       string   `mapstructure:"format_output"`
-	HelpText           string   `mapstructure:"help_text"`
-	IncludeInHelp      bool     `mapstructure:"include_in_help" binding:"required"`
-	Active             bool     `mapstructure:"active" binding:"required"`
-	Debug              bool     `mapstructure:"debug" binding:"required"`
-	Actions            []Action `mapstructure:"actions" binding:"required"`
-	Remotes            Remotes  `mapstructure:"remotes" binding:"omitempty"`
-	Reaction           string   `mapstructure:"reaction" binding:"omitempty"`
+	SchemaVersion      int               `mapstructure:"schema_version" binding:"required"`
+	Name               string            `mapstructure:"name" binding:"required"`
+	Respond            string            `mapstructure:"respond" binding:"omitempty"`
+	Aliases            []string          `mapstructure:"aliases" binding:"omitempty"`
+	Hear               string            `mapstructure:"hear" binding:"omitempty"`
+	Match              MatchOptions      `mapstructure:"match" binding:"omitempty"`
+	Intent             string            `mapstructure:"intent" binding:"omitempty"`
+	Slots              map[string]string `mapstructure:"slots" binding:"omitempty"`
+	Files              []string          `mapstructure:"files" binding:"omitempty"`
+	Events             []string          `mapstructure:"events" binding:"omitempty"`
+	Schedule           string            `mapstructure:"schedule"`
+	Args               []string          `mapstructure:"args" binding:"required"`
+	Flags              []Flag            `mapstructure:"flags" binding:"omitempty"`
+	DirectMessageOnly  bool              `mapstructure:"direct_message_only" binding:"required"`
+	OutputToRooms      []string          `mapstructure:"output_to_rooms" binding:"omitempty"`
+	OutputToUsers      []string          `mapstructure:"output_to_users" binding:"omitempty"`
+	Fallback           Fallback          `mapstructure:"fallback" binding:"omitempty"`
+	AllowUsers         []string          `mapstructure:"allow_users" binding:"omitempty"`
+	AllowUserGroups    []string          `mapstructure:"allow_usergroups" binding:"omitempty"`
+	IgnoreUsers        []string          `mapstructure:"ignore_users" binding:"omitempty"`
+	IgnoreUserGroups   []string          `mapstructure:"ignore_usergroups" binding:"omitempty"`
+	StartMessageThread bool              `mapstructure:"start_message_thread" binding:"omitempty"`
+	Digest             string            `mapstructure:"digest" binding:"omitempty"`
+	Feedback           bool              `mapstructure:"feedback" binding:"omitempty"`
+	FormatOutput       string            `mapstructure:"format_output"`
+	ForEach            string            `mapstructure:"for_each" binding:"omitempty"`
+	FormatItem         string            `mapstructure:"format_item" binding:"omitempty"`
+	Markdown           bool              `mapstructure:"markdown" binding:"omitempty"`
+	Format             string            `mapstructure:"format" binding:"omitempty"`
+	FormatData         string            `mapstructure:"format_data" binding:"omitempty"`
+	FormatColumns      []string          `mapstructure:"format_columns" binding:"omitempty"`
+	ChartLabel         string            `mapstructure:"chart_label" binding:"omitempty"`
+	ChartValue         string            `mapstructure:"chart_value" binding:"omitempty"`
+	UploadFiles        []string          `mapstructure:"upload_files" binding:"omitempty"`
+	HelpText           string            `mapstructure:"help_text"`
+	Description        string            `mapstructure:"description" binding:"omitempty"`
+	Example            string            `mapstructure:"example" binding:"omitempty"`
+	IncludeInHelp      bool              `mapstructure:"include_in_help" binding:"required"`
+	Active             bool              `mapstructure:"active" binding:"required"`
+	When               string            `mapstructure:"when" binding:"omitempty"`
+	Priority           int               `mapstructure:"priority" binding:"omitempty"`
+	Actions            []Action          `mapstructure:"actions" binding:"required"`
+	ParallelActions    bool              `mapstructure:"parallel_actions" binding:"omitempty"`
+	MaxConcurrent      int               `mapstructure:"max_concurrent" binding:"omitempty"`
+	Lock               string            `mapstructure:"lock" binding:"omitempty"`
+	QueuedMessage      string            `mapstructure:"queued_message" binding:"omitempty"`
+	Job                bool              `mapstructure:"job" binding:"omitempty"`
+	Timeout            string            `mapstructure:"timeout" binding:"omitempty"`
+	Debounce           string            `mapstructure:"debounce" binding:"omitempty"`
+	Correlate          string            `mapstructure:"correlate" binding:"omitempty"`
+	CorrelateWindow    string            `mapstructure:"correlate_window" binding:"omitempty"`
+	Remotes            Remotes           `mapstructure:"remotes" binding:"omitempty"`
+	Reaction           string            `mapstructure:"reaction" binding:"omitempty"`
+	Remember           []Memory          `mapstructure:"remember" binding:"omitempty"`
+	Recall             []Memory          `mapstructure:"recall" binding:"omitempty"`
+	Vars               []Variable        `mapstructure:"vars" binding:"omitempty"`
+	Prompt             Prompt            `mapstructure:"prompt" binding:"omitempty"`
+	Template           TemplateRef       `mapstructure:"template" binding:"omitempty"`
+	Canary             Canary            `mapstructure:"canary" binding:"omitempty"`
 	// The following fields are not included in rule file
 	RemoveReaction string
+	Version        string // 'stable' or 'canary' for rules with a canary, when they're hit
+	Disabled       bool   // whether an admin disabled the rule at runtime, see 'rule disable'
 }
@@ -5,3 +5,13 @@ type ScriptResponse struct {
 	Status int
 	Output string
 }
+
+// Container is the container an 'exec' action's command runs in, instead of directly on the bot's host
+type Container struct {
+	Image     string `mapstructure:"image"`
+	CPUs      string `mapstructure:"cpus"`
+	Memory    string `mapstructure:"memory"`
+	PidsLimit int    `mapstructure:"pids_limit"`
+	Network   string `mapstructure:"network"`
+	Workspace string `mapstructure:"workspace"`
+}
@@ -0,0 +1,18 @@
+package models
+
+// Database is a database 'sql' actions can query, configured in bot.yml
+type Database struct {
+	Driver       string `mapstructure:"driver"`
+	DSN          string `mapstructure:"dsn"`
+	ReadOnly     bool   `mapstructure:"read_only"`
+	MaxOpenConns int    `mapstructure:"max_open_conns"`
+	MaxRows      int    `mapstructure:"max_rows"`
+}
+
+// SQLResult is the base response data type for SQL queries
+type SQLResult struct {
+	Columns      []string
+	Rows         []map[string]interface{}
+	Truncated    bool
+	RowsAffected int64
+}
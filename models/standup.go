@@ -0,0 +1,12 @@
+package models
+
+// Standup is a check-in of the 'standups' built-in module, configured with 'standups' in bot.yml: the
+// bot asks its members its questions by direct message, and posts their answers to its channel
+type Standup struct {
+	Name      string   `mapstructure:"name"`      // what people call it in commands, default its channel
+	Channel   string   `mapstructure:"channel"`   // where the summary is posted
+	Schedule  string   `mapstructure:"schedule"`  // when members are asked, like a rule's 'schedule'
+	Members   []string `mapstructure:"members"`   // who's asked, by user ID
+	Questions []string `mapstructure:"questions"` // what they're asked, default what they did, will do, and what blocks them
+	Collect   string   `mapstructure:"collect"`   // how long answers are collected before the summary is posted, default 2h
+}
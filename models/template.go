@@ -0,0 +1,23 @@
+package models
+
+// Template is a named, reusable output, read from a file in the templates directory, that rules
+// show with 'template' so e.g. every deploy announcement looks the same
+type Template struct {
+	Name        string          `mapstructure:"name" binding:"required"`
+	Description string          `mapstructure:"description" binding:"omitempty"`
+	Params      []TemplateParam `mapstructure:"params" binding:"omitempty"`
+	Text        string          `mapstructure:"text" binding:"required"`
+}
+
+// TemplateParam is a parameter a template is filled in with
+type TemplateParam struct {
+	Name     string `mapstructure:"name" binding:"required"`
+	Default  string `mapstructure:"default" binding:"omitempty"`  // used when a rule doesn't pass it
+	Required bool   `mapstructure:"required" binding:"omitempty"` // rules must pass it
+}
+
+// TemplateRef is a rule's reference to a template, with the parameters to fill it in with
+type TemplateRef struct {
+	Name   string            `mapstructure:"name" binding:"required"`
+	Params map[string]string `mapstructure:"params" binding:"omitempty"` // may have variables
+}
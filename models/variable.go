@@ -0,0 +1,11 @@
+package models
+
+// Variable declares a variable of a rule: its type, its default, whether it's required, and how
+// long it's kept
+type Variable struct {
+	Name     string `mapstructure:"name" binding:"required"`
+	Type     string `mapstructure:"type" binding:"omitempty"` // 'string' (default), 'int', 'number', 'bool', 'duration', or 'json'
+	Default  string `mapstructure:"default" binding:"omitempty"`
+	Required bool   `mapstructure:"required" binding:"omitempty"`
+	Scope    string `mapstructure:"scope" binding:"omitempty"` // 'rule' (default), 'conversation', or 'global'
+}
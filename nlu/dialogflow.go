@@ -0,0 +1,212 @@
+package nlu
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dialogflowScope is the OAuth2 scope needed to detect intents
+const dialogflowScope = "https://www.googleapis.com/auth/dialogflow"
+
+// Dialogflow asks a Dialogflow (v2) agent for the intent of a message,
+// authenticating with a Google Cloud service account
+type Dialogflow struct {
+	projectID   string
+	language    string
+	clientEmail string
+	privateKey  *rsa.PrivateKey
+	tokenURL    string
+	apiURL      string
+	client      *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expires     time.Time
+}
+
+// validate that Dialogflow adheres to provider interface
+var _ Provider = (*Dialogflow)(nil)
+
+// serviceAccount is the relevant part of a Google Cloud service account key file
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// NewDialogflow creates a provider for the Dialogflow agent of the project the
+// service account key file (JSON) at credentialsPath belongs to
+func NewDialogflow(credentialsPath, language string) (*Dialogflow, error) {
+	raw, err := ioutil.ReadFile(credentialsPath)
+	if err != nil {
+		return nil, err
+	}
+	var account serviceAccount
+	if err := json.Unmarshal(raw, &account); err != nil {
+		return nil, fmt.Errorf("Invalid service account key file: %s", err.Error())
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("Service account key file has no private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("Service account private key is not an RSA key")
+	}
+
+	if len(language) == 0 {
+		language = "en"
+	}
+	if len(account.TokenURI) == 0 {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &Dialogflow{
+		projectID:   account.ProjectID,
+		language:    language,
+		clientEmail: account.ClientEmail,
+		privateKey:  rsaKey,
+		tokenURL:    account.TokenURI,
+		apiURL:      "https://dialogflow.googleapis.com",
+		client:      newHTTPClient(),
+	}, nil
+}
+
+// Parse implementation to satisfy provider interface
+func (d *Dialogflow) Parse(text, sessionID string) (*Result, error) {
+	token, err := d.token()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"queryInput": map[string]interface{}{
+			"text": map[string]string{"text": text, "languageCode": d.language},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/v2/projects/%s/agent/sessions/%s:detectIntent", d.apiURL, d.projectID, url.PathEscape(sessionID))
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Dialogflow returned %d", resp.StatusCode)
+	}
+
+	var parsed struct {
+		QueryResult struct {
+			Intent struct {
+				DisplayName string `json:"displayName"`
+			} `json:"intent"`
+			IntentDetectionConfidence float64                `json:"intentDetectionConfidence"`
+			Parameters                map[string]interface{} `json:"parameters"`
+		} `json:"queryResult"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Intent:     parsed.QueryResult.Intent.DisplayName,
+		Confidence: parsed.QueryResult.IntentDetectionConfidence,
+		Entities:   make(map[string]string),
+	}
+	for k, v := range parsed.QueryResult.Parameters {
+		result.Entities[k] = fmt.Sprint(v)
+	}
+	return result, nil
+}
+
+// token returns an OAuth2 access token for the service account, requesting a new one
+// shortly before the current one expires
+func (d *Dialogflow) token() (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.accessToken) > 0 && time.Now().Before(d.expires) {
+		return d.accessToken, nil
+	}
+
+	assertion, err := d.signedAssertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+	resp, err := d.client.PostForm(d.tokenURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Could not get Dialogflow access token: %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	d.accessToken = token.AccessToken
+	d.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return d.accessToken, nil
+}
+
+// signedAssertion creates the JWT the service account exchanges for an access token
+func (d *Dialogflow) signedAssertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   d.clientEmail,
+		"scope": dialogflowScope,
+		"aud":   d.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, d.privateKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{unsigned, base64.RawURLEncoding.EncodeToString(signature)}, "."), nil
+}
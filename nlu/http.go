@@ -0,0 +1,50 @@
+package nlu
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// HTTP asks any service implementing a minimal JSON interface for the intent of a message.
+// The service receives {"text": "...", "session_id": "..."} and must reply with
+// {"intent": "...", "confidence": 0.9, "entities": {"name": "value"}}.
+type HTTP struct {
+	url    string
+	client *http.Client
+}
+
+// validate that HTTP adheres to provider interface
+var _ Provider = (*HTTP)(nil)
+
+// NewHTTP creates a provider for the NLU service at url
+func NewHTTP(url string) *HTTP {
+	return &HTTP{url: url, client: newHTTPClient()}
+}
+
+// Parse implementation to satisfy provider interface
+func (h *HTTP) Parse(text, sessionID string) (*Result, error) {
+	body, err := json.Marshal(map[string]string{"text": text, "session_id": sessionID})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("NLU service returned %d", resp.StatusCode)
+	}
+
+	var parsed struct {
+		Intent     string            `json:"intent"`
+		Confidence float64           `json:"confidence"`
+		Entities   map[string]string `json:"entities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &Result{Intent: parsed.Intent, Confidence: parsed.Confidence, Entities: parsed.Entities}, nil
+}
@@ -0,0 +1,24 @@
+package nlu
+
+import (
+	"net/http"
+	"time"
+)
+
+// Provider determines the intent of a message and the entities mentioned in it
+// using a natural language understanding (NLU) service
+type Provider interface {
+	Parse(text, sessionID string) (*Result, error)
+}
+
+// Result is the intent an NLU service recognized in a message
+type Result struct {
+	Intent     string
+	Confidence float64
+	Entities   map[string]string
+}
+
+// newHTTPClient creates the HTTP client used to talk to NLU services
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: 10 * time.Second}
+}
@@ -0,0 +1,132 @@
+package nlu
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["text"] != "deploy api to prod" || req["session_id"] != "C1-U1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"intent":"deploy_service","confidence":0.92,"entities":{"service":"api","env":"prod"}}`))
+	}))
+	defer ts.Close()
+
+	result, err := NewHTTP(ts.URL).Parse("deploy api to prod", "C1-U1")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if result.Intent != "deploy_service" || result.Confidence != 0.92 || result.Entities["service"] != "api" {
+		t.Errorf("Parse() = %+v", result)
+	}
+
+	if _, err := NewHTTP(ts.URL).Parse("something else", "C1-U1"); err == nil {
+		t.Error("Parse() expected an error for a failed request")
+	}
+}
+
+func TestRasa(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/model/parse" || r.URL.Query().Get("token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"intent":{"name":"deploy_service","confidence":0.8},"entities":[{"entity":"service","value":"api"},{"entity":"replicas","value":3}]}`))
+	}))
+	defer ts.Close()
+
+	result, err := NewRasa(ts.URL+"/", "secret").Parse("deploy 3 api", "C1-U1")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if result.Intent != "deploy_service" || result.Entities["service"] != "api" || result.Entities["replicas"] != "3" {
+		t.Errorf("Parse() = %+v", result)
+	}
+
+	if _, err := NewRasa(ts.URL, "wrong").Parse("deploy 3 api", "C1-U1"); err == nil {
+		t.Error("Parse() expected an error for an unauthorized request")
+	}
+}
+
+func TestDialogflow(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenRequests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			tokenRequests++
+			if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || strings.Count(r.FormValue("assertion"), ".") != 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"access_token":"access","expires_in":3600}`))
+		case r.URL.Path == "/v2/projects/my-project/agent/sessions/C1-U1:detectIntent":
+			if r.Header.Get("Authorization") != "Bearer access" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"queryResult":{"intent":{"displayName":"deploy_service"},"intentDetectionConfidence":0.7,"parameters":{"service":"api"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "dialogflow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	credentials, _ := json.Marshal(serviceAccount{
+		ProjectID:   "my-project",
+		ClientEmail: "bot@my-project.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:    ts.URL + "/token",
+	})
+	path := filepath.Join(dir, "credentials.json")
+	if err := ioutil.WriteFile(path, credentials, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDialogflow(path, "")
+	if err != nil {
+		t.Fatalf("NewDialogflow() error = %v", err)
+	}
+	d.apiURL = ts.URL
+
+	for i := 0; i < 2; i++ {
+		result, err := d.Parse("deploy api", "C1-U1")
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if result.Intent != "deploy_service" || result.Confidence != 0.7 || result.Entities["service"] != "api" {
+			t.Errorf("Parse() = %+v", result)
+		}
+	}
+	if tokenRequests != 1 {
+		t.Errorf("requested %d access tokens, want 1", tokenRequests)
+	}
+}
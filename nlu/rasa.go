@@ -0,0 +1,69 @@
+package nlu
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Rasa asks a Rasa server (https://rasa.com) for the intent of a message
+type Rasa struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// validate that Rasa adheres to provider interface
+var _ Provider = (*Rasa)(nil)
+
+// NewRasa creates a provider for the Rasa server at url, e.g. http://rasa:5005.
+// The token is only needed if the server was started with '--auth-token'.
+func NewRasa(url, token string) *Rasa {
+	return &Rasa{url: strings.TrimSuffix(url, "/"), token: token, client: newHTTPClient()}
+}
+
+// Parse implementation to satisfy provider interface
+func (r *Rasa) Parse(text, sessionID string) (*Result, error) {
+	body, err := json.Marshal(map[string]string{"text": text, "message_id": sessionID})
+	if err != nil {
+		return nil, err
+	}
+	url := r.url + "/model/parse"
+	if len(r.token) > 0 {
+		url = url + "?token=" + r.token
+	}
+	resp, err := r.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Rasa returned %d", resp.StatusCode)
+	}
+
+	var parsed struct {
+		Intent struct {
+			Name       string  `json:"name"`
+			Confidence float64 `json:"confidence"`
+		} `json:"intent"`
+		Entities []struct {
+			Entity string      `json:"entity"`
+			Value  interface{} `json:"value"`
+		} `json:"entities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Intent:     parsed.Intent.Name,
+		Confidence: parsed.Intent.Confidence,
+		Entities:   make(map[string]string),
+	}
+	for _, e := range parsed.Entities {
+		result.Entities[e.Entity] = fmt.Sprint(e.Value)
+	}
+	return result, nil
+}
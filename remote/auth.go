@@ -0,0 +1,262 @@
+package remote
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// The HTTP servers the bot exposes, by the name 'http_auth' configures them with
+const (
+	ServerEvents       = "events"       // Slack's Events API
+	ServerInteractions = "interactions" // Slack's interactive components
+	ServerAdmin        = "admin"        // the admin API
+	ServerHealth       = "health"       // health checks
+	ServerMetrics      = "metrics"      // Prometheus metrics
+	// ServerAll configures the servers that aren't configured by name
+	ServerAll = "all"
+)
+
+// ServerNames are the names 'http_auth' can configure
+var ServerNames = []string{ServerEvents, ServerInteractions, ServerAdmin, ServerHealth, ServerMetrics, ServerAll}
+
+// maxSignedBody is the largest request body whose HMAC signature is checked
+const maxSignedBody = 10 << 20
+
+// hmacAlgorithms are the hash functions HMAC signatures can be made with
+var hmacAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// serverAuth is the 'http_auth' of a server, ready to check requests with
+type serverAuth struct {
+	allowed        []*net.IPNet
+	trustedProxies []*net.IPNet
+	username       string
+	password       string
+	bearerToken    string
+	hmacSecret     []byte
+	hmacHeader     string
+	hmacPrefix     string
+	hmacHash       func() hash.Hash
+}
+
+// Authenticate puts the checks 'http_auth' configures for a server in front of its handler:
+// where requests may come from, basic or bearer auth, and an HMAC signature of the body. The
+// server's own settings apply, else the ones for 'all'; without either, requests pass as they are.
+func Authenticate(name string, handler http.Handler, bot *models.Bot) (http.Handler, error) {
+	config, ok := bot.HTTPAuth[name]
+	if !ok {
+		if config, ok = bot.HTTPAuth[ServerAll]; !ok {
+			return handler, nil
+		}
+	}
+	auth, err := newServerAuth(name, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, reason := auth.check(r); status != http.StatusOK {
+			bot.Log.Warnf("HTTP server '%s': rejected %s %s from %s: %s", name, r.Method, r.URL.Path, r.RemoteAddr, reason)
+			if status == http.StatusUnauthorized && len(auth.username) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="flottbot"`)
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}), nil
+}
+
+// newServerAuth prepares the 'http_auth' of a server, filling in the secrets it refers to
+func newServerAuth(name string, config models.HTTPAuth) (*serverAuth, error) {
+	auth := &serverAuth{}
+	var err error
+	if auth.allowed, err = ParseNetworks(config.AllowIPs); err != nil {
+		return nil, fmt.Errorf("Invalid 'allow_ips' for the '%s' server: %s", name, err.Error())
+	}
+	if auth.trustedProxies, err = ParseNetworks(config.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("Invalid 'trusted_proxies' for the '%s' server: %s", name, err.Error())
+	}
+
+	secrets := []struct {
+		setting string
+		value   string
+		into    *string
+	}{
+		{"username", config.Username, &auth.username},
+		{"password", config.Password, &auth.password},
+		{"bearer_token", config.BearerToken, &auth.bearerToken},
+	}
+	for _, s := range secrets {
+		if *s.into, err = utils.Substitute(s.value, map[string]string{}); err != nil {
+			return nil, fmt.Errorf("Could not set '%s' for the '%s' server: %s", s.setting, name, err.Error())
+		}
+	}
+
+	if len(config.HMACSecret) > 0 {
+		secret, err := utils.Substitute(config.HMACSecret, map[string]string{})
+		if err != nil {
+			return nil, fmt.Errorf("Could not set 'hmac_secret' for the '%s' server: %s", name, err.Error())
+		}
+		auth.hmacSecret = []byte(secret)
+		auth.hmacHeader = config.HMACHeader
+		if len(auth.hmacHeader) == 0 {
+			auth.hmacHeader = "X-Signature-256"
+		}
+		auth.hmacPrefix = config.HMACPrefix
+		algorithm := strings.ToLower(config.HMACAlgorithm)
+		if len(algorithm) == 0 {
+			algorithm = "sha256"
+		}
+		if auth.hmacHash = hmacAlgorithms[algorithm]; auth.hmacHash == nil {
+			return nil, fmt.Errorf("Unknown 'hmac_algorithm' '%s' for the '%s' server, use 'sha256', 'sha1', or 'sha512'", config.HMACAlgorithm, name)
+		}
+	}
+	return auth, nil
+}
+
+// check tells whether a request passes the server's checks, and why not if it doesn't
+func (a *serverAuth) check(r *http.Request) (int, string) {
+	if len(a.allowed) > 0 {
+		ip := a.clientIP(r)
+		if !containsIP(a.allowed, ip) {
+			return http.StatusForbidden, fmt.Sprintf("%s is not allowed", ip)
+		}
+	}
+
+	if len(a.username) > 0 || len(a.bearerToken) > 0 {
+		if !a.authorized(r) {
+			return http.StatusUnauthorized, "missing or wrong credentials"
+		}
+	}
+
+	if len(a.hmacSecret) > 0 {
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSignedBody+1))
+		if err != nil {
+			return http.StatusBadRequest, "could not read the body"
+		}
+		if len(body) > maxSignedBody {
+			return http.StatusRequestEntityTooLarge, "body too large to check its signature"
+		}
+		// Handlers read the body again
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if !a.signed(r.Header.Get(a.hmacHeader), body) {
+			return http.StatusUnauthorized, "missing or wrong signature"
+		}
+	}
+	return http.StatusOK, ""
+}
+
+// authorized checks a request's basic auth or bearer token
+func (a *serverAuth) authorized(r *http.Request) bool {
+	if len(a.username) > 0 {
+		if user, password, ok := r.BasicAuth(); ok &&
+			subtle.ConstantTimeCompare([]byte(user), []byte(a.username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(a.password)) == 1 {
+			return true
+		}
+	}
+	if len(a.bearerToken) > 0 {
+		header := r.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(a.bearerToken)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// signed checks the HMAC signature of a request's body
+func (a *serverAuth) signed(signature string, body []byte) bool {
+	if !strings.HasPrefix(signature, a.hmacPrefix) {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, a.hmacPrefix))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(a.hmacHash, a.hmacSecret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// clientIP is the address a request comes from: its peer, or, when the peer is a trusted proxy,
+// the last address in X-Forwarded-For that isn't one
+func (a *serverAuth) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if !containsIP(a.trustedProxies, ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(a.trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// ParseNetworks parses IP addresses and CIDR ranges, e.g. '10.0.0.1' or '192.30.252.0/22'
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("'%s' is not an IP address or CIDR range", value)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			value = fmt.Sprintf("%s/%d", value, bits)
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an IP address or CIDR range", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// containsIP tells whether an address is in one of the networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package remote
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestAuthenticate(t *testing.T) {
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	bot := &models.Bot{Log: *logrus.New(), HTTPAuth: map[string]models.HTTPAuth{
+		ServerEvents: {
+			AllowIPs:       []string{"192.30.252.0/22", "10.1.1.1"},
+			TrustedProxies: []string{"10.0.0.0/8"},
+			HMACSecret:     "s3cret",
+			HMACHeader:     "X-Hub-Signature-256",
+			HMACPrefix:     "sha256=",
+		},
+		ServerAll: {Username: "ops", Password: "pa55", BearerToken: "t0ken"},
+	}}
+	bot.Log.SetOutput(ioutil.Discard)
+
+	tests := []struct {
+		name       string
+		server     string
+		remoteAddr string
+		headers    map[string]string
+		body       string
+		want       int
+	}{
+		{"Allowed and signed", ServerEvents, "192.30.253.7:4321", map[string]string{"X-Hub-Signature-256": sign("{}")}, "{}", http.StatusOK},
+		{"Allowed address", ServerEvents, "10.1.1.1:4321", map[string]string{"X-Hub-Signature-256": sign("{}")}, "{}", http.StatusOK},
+		{"Not allowed", ServerEvents, "203.0.113.9:4321", map[string]string{"X-Hub-Signature-256": sign("{}")}, "{}", http.StatusForbidden},
+		{"Through a trusted proxy", ServerEvents, "10.2.3.4:4321", map[string]string{"X-Forwarded-For": "203.0.113.9, 192.30.253.7", "X-Hub-Signature-256": sign("{}")}, "{}", http.StatusOK},
+		{"Spoofed through a trusted proxy", ServerEvents, "10.2.3.4:4321", map[string]string{"X-Forwarded-For": "192.30.253.7, 203.0.113.9", "X-Hub-Signature-256": sign("{}")}, "{}", http.StatusForbidden},
+		{"Forwarded by an untrusted peer", ServerEvents, "203.0.113.9:4321", map[string]string{"X-Forwarded-For": "192.30.253.7", "X-Hub-Signature-256": sign("{}")}, "{}", http.StatusForbidden},
+		{"Wrong signature", ServerEvents, "192.30.253.7:4321", map[string]string{"X-Hub-Signature-256": sign("{ }")}, "{}", http.StatusUnauthorized},
+		{"No signature", ServerEvents, "192.30.253.7:4321", nil, "{}", http.StatusUnauthorized},
+		{"Basic auth", ServerAdmin, "203.0.113.9:4321", map[string]string{"Authorization": "Basic b3BzOnBhNTU="}, "", http.StatusOK},
+		{"Bearer token", ServerHealth, "203.0.113.9:4321", map[string]string{"Authorization": "Bearer t0ken"}, "", http.StatusOK},
+		{"Wrong bearer token", ServerHealth, "203.0.113.9:4321", map[string]string{"Authorization": "Bearer nope"}, "", http.StatusUnauthorized},
+		{"No credentials", ServerMetrics, "203.0.113.9:4321", nil, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := Authenticate(tt.server, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The body is still there for the handler
+				body, _ := ioutil.ReadAll(r.Body)
+				if string(body) != tt.body {
+					t.Errorf("Handler got body %q, want %q", body, tt.body)
+				}
+			}), bot)
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+
+			r := httptest.NewRequest("POST", "/slack_events/v1/bot", strings.NewReader(tt.body))
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("Authenticate() responded %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+
+	if _, err := Authenticate(ServerEvents, http.NotFoundHandler(), &models.Bot{HTTPAuth: map[string]models.HTTPAuth{ServerEvents: {AllowIPs: []string{"10.0.0.0/33"}}}}); err == nil {
+		t.Error("Authenticate() with an invalid range succeeded")
+	}
+}
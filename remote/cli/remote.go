@@ -9,6 +9,7 @@ import (
 
 	"github.com/target/flottbot/models"
 	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/tracing"
 	"github.com/target/flottbot/version"
 )
 
@@ -58,25 +59,35 @@ MMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMMM`)
 	fmt.Println(version.String())
 	fmt.Println("Enter CLI mode: hit <Enter>. <Ctrl-C> to exit.")
 	scanner := bufio.NewScanner(os.Stdin)
+	remote.SetStatus(remote.StatusName(bot, "cli"), "reading", "")
 	for scanner.Scan() {
 		fmt.Print("\n", bot.Name, "> ")
 		req := scanner.Text()
 		if len(strings.TrimSpace(req)) > 0 {
-			message := models.NewMessage()
-
-			message.Type = models.MsgTypeDirect
-			message.Service = models.MsgServiceCLI
-			message.Input = req
-
-			message.Vars["_user.id"] = user
-			message.Vars["_user.firstname"] = user
-			message.Vars["_user.name"] = user
+			message := readMessage(req, user, bot)
+			span := tracing.Start("", "cli.read")
+			message.TraceParent = span.TraceParent()
+			span.End()
 			inputMsgs <- message
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		bot.Log.Debugf("Error reading standard input: %v", err)
 	}
+	remote.SetStatus(remote.StatusName(bot, "cli"), "stopped", "")
+}
+
+// readMessage creates the message for the bot to process from a line read from the CLI. Prefixes the
+// bot is addressed with are taken off like in chat, so commands can be pasted from chat.
+func readMessage(req, user string, bot *models.Bot) models.Message {
+	message := models.NewMessage()
+	message.Type = models.MsgTypeDirect
+	message.Service = models.MsgServiceCLI
+	message.Input, message.BotMentioned = remote.RemovePrefix(req, bot.MentionPrefixes)
+	message.Vars["_user.id"] = user
+	message.Vars["_user.firstname"] = user
+	message.Vars["_user.name"] = user
+	return message
 }
 
 // Send implementation to satisfy remote interface
@@ -88,6 +99,11 @@ func (c *Client) Send(message models.Message, bot *models.Bot) {
 	w.Flush()
 }
 
+// Capabilities implementation to satisfy remote interface, a terminal only shows text
+func (c *Client) Capabilities() remote.Capabilities {
+	return remote.Capabilities{}
+}
+
 // InteractiveComponents implementation to satisfy remote interface
 func (c *Client) InteractiveComponents(inputMsgs chan<- models.Message, message *models.Message, rule models.Rule, bot *models.Bot) {
 	// not implemented for CLI
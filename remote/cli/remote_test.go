@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestReadMessage(t *testing.T) {
+	bot := &models.Bot{MentionPrefixes: []string{"!", "hubot"}}
+	tests := []struct {
+		name          string
+		req           string
+		wantInput     string
+		wantMentioned bool
+	}{
+		{"Plain", "deploy api", "deploy api", false},
+		{"Symbol prefix", "!deploy api", "deploy api", true},
+		{"Word prefix", "Hubot: deploy api", "deploy api", true},
+		{"Prefix in a word", "hubotdeploy", "hubotdeploy", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := readMessage(tt.req, "jane", bot)
+			if message.Input != tt.wantInput || message.BotMentioned != tt.wantMentioned {
+				t.Errorf("readMessage() = %q, mentioned %v, want %q, %v", message.Input, message.BotMentioned, tt.wantInput, tt.wantMentioned)
+			}
+			if message.Service != models.MsgServiceCLI || message.Type != models.MsgTypeDirect || message.Vars["_user.name"] != "jane" {
+				t.Errorf("readMessage() = %+v, want a direct CLI message from jane", message)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package remote
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+// defaultEventCacheSize is how many events are remembered, unless bot.yml sets 'event_dedup_size'
+const defaultEventCacheSize = 1000
+
+// eventTTL is how long an event is remembered; chat applications give up retrying well before that
+const eventTTL = time.Hour
+
+// eventsBucket is the storage bucket recording which events were received, when it's shared
+const eventsBucket = "seen_events"
+
+// eventCache remembers the most recently received events, forgetting the oldest when it's full
+type eventCache struct {
+	mu      sync.Mutex
+	order   *list.List // most recently received first
+	entries map[string]*list.Element
+}
+
+// eventEntry is an event remembered by an eventCache
+type eventEntry struct {
+	key      string
+	received time.Time
+}
+
+var (
+	// seenEvents are the events each bot received, so bots in the same process don't drop each
+	// other's events, e.g. when they're in the same Slack workspace
+	seenEvents   = make(map[*models.Bot]*eventCache)
+	seenEventsMu sync.Mutex
+)
+
+// eventsOf returns the events a bot received
+func eventsOf(bot *models.Bot) *eventCache {
+	seenEventsMu.Lock()
+	defer seenEventsMu.Unlock()
+	c, ok := seenEvents[bot]
+	if !ok {
+		c = &eventCache{order: list.New(), entries: make(map[string]*list.Element)}
+		seenEvents[bot] = c
+	}
+	return c
+}
+
+// SeenEvent records that a remote received the event with the given ID, and reports whether it
+// was received before, e.g. because the chat application retried sending it when the bot was slow to
+// respond. Events are remembered in memory; with 'event_dedup_store' (or 'high_availability') they are
+// also recorded in the storage backend, so replicas of the bot don't process each other's retries.
+func SeenEvent(source, id string, bot *models.Bot) bool {
+	if len(id) == 0 {
+		return false
+	}
+	key := source + "/" + id
+	size := bot.EventDedupSize
+	if size <= 0 {
+		size = defaultEventCacheSize
+	}
+	if eventsOf(bot).add(key, size, time.Now()) {
+		return true
+	}
+
+	if (!bot.EventDedupStore && !bot.HighAvailability) || bot.Store == nil {
+		return false
+	}
+	// The claim value is unique per delivery, so only the first delivery claims the event
+	claimed, err := bot.Store.Claim(eventsBucket, key, []byte(bot.InstanceID+"/"+models.GenerateMessageID()), eventTTL)
+	if err != nil {
+		// Better to risk processing an event twice than not at all
+		bot.Log.Errorf("Could not record event %s, processing it anyway: %s", key, err.Error())
+		return false
+	}
+	return !claimed
+}
+
+// add remembers an event, and reports whether it was already remembered
+func (c *eventCache) add(key string, size int, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*eventEntry)
+		if now.Sub(entry.received) < eventTTL {
+			c.order.MoveToFront(e)
+			return true
+		}
+		entry.received = now
+		c.order.MoveToFront(e)
+		return false
+	}
+
+	c.entries[key] = c.order.PushFront(&eventEntry{key: key, received: now})
+	for c.order.Len() > size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*eventEntry).key)
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package remote
+
+import (
+	"container/list"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestEventCache(t *testing.T) {
+	now := time.Now()
+	cache := &eventCache{order: list.New(), entries: make(map[string]*list.Element)}
+
+	tests := []struct {
+		name     string
+		key      string
+		received time.Time
+		want     bool
+	}{
+		{"First delivery", "a", now, false},
+		{"Retry", "a", now.Add(time.Minute), true},
+		{"Other event", "b", now, false},
+		{"Third event evicts the least recent", "c", now, false},
+		{"Evicted event", "a", now, false},
+		{"Recent event stays", "c", now, true},
+		{"Expired event", "c", now.Add(2 * eventTTL), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cache.add(tt.key, 2, tt.received); got != tt.want {
+				t.Errorf("add(%s) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeenEvent(t *testing.T) {
+	bot := &models.Bot{}
+	if SeenEvent("test", "Ev1", bot) {
+		t.Error("SeenEvent() of a new event = true")
+	}
+	if !SeenEvent("test", "Ev1", bot) {
+		t.Error("SeenEvent() of a retried event = false")
+	}
+	if SeenEvent("other", "Ev1", bot) {
+		t.Error("SeenEvent() should tell events of different remotes apart")
+	}
+	if SeenEvent("test", "", bot) || SeenEvent("test", "", bot) {
+		t.Error("SeenEvent() of events without ID should always be false")
+	}
+
+	// Replicas sharing a store don't process each other's retries
+	store := memory.New()
+	replica1 := &models.Bot{EventDedupStore: true, InstanceID: "replica-1", Store: store}
+	replica2 := &models.Bot{EventDedupStore: true, InstanceID: "replica-2", Store: store}
+	if SeenEvent("test", "Ev2", replica1) {
+		t.Error("SeenEvent() of a new event = true")
+	}
+	if !SeenEvent("test", "Ev2", replica2) {
+		t.Error("SeenEvent() of an event another replica received = false")
+	}
+}
@@ -1,8 +1,12 @@
 package discord
 
 import (
+	"mime"
+	"path/filepath"
+
 	"github.com/bwmarrin/discordgo"
 	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/tracing"
 )
 
 /*
@@ -41,5 +45,21 @@ func populateMessage(message models.Message, msgType models.MessageType, channel
 	}
 
 	message.Debug = true
+
+	// Start the message's trace; the span marks the moment the message was read
+	span := tracing.Start("", "discord.read")
+	span.SetAttribute("channel.id", channel)
+	message.TraceParent = span.TraceParent()
+	span.End()
 	return message
 }
+
+// attachedFiles are the files attached to a message; Discord doesn't say what type they are, so it's
+// told by their extension
+func attachedFiles(attachments []*discordgo.MessageAttachment) []models.File {
+	files := make([]models.File, 0, len(attachments))
+	for _, attachment := range attachments {
+		files = append(files, models.File{Name: attachment.Filename, ContentType: mime.TypeByExtension(filepath.Ext(attachment.Filename)), URL: attachment.URL})
+	}
+	return files
+}
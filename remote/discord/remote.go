@@ -1,7 +1,11 @@
 package discord
 
 import (
+	"bytes"
+	"errors"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/target/flottbot/models"
@@ -22,6 +26,9 @@ type Client struct {
 // validate that Client adheres to remote interface
 var _ remote.Remote = (*Client)(nil)
 
+// validate that Client can edit the messages it posts
+var _ remote.MessageEditor = (*Client)(nil)
+
 // creates a new Discord session
 func (c *Client) new() *discordgo.Session {
 	// Create a new Discord session using the provided bot token
@@ -29,6 +36,8 @@ func (c *Client) new() *discordgo.Session {
 	if err != nil {
 		return nil
 	}
+	// Without the Message Content intent, Discord leaves the text out of the messages the bot reads
+	dg.Identify.Intents = discordgo.IntentsAllWithoutPrivileged | discordgo.IntentsMessageContent
 	return dg
 }
 
@@ -44,10 +53,32 @@ func (c *Client) Read(inputMsgs chan<- models.Message, rules map[string]models.R
 		bot.Log.Error("Failed to initialize Discord client")
 		return
 	}
-	err := dg.Open()
-	if err != nil {
+	// The Discord package reconnects when the connection drops, keep track of it
+	name := remote.StatusName(bot, "discord")
+	dg.AddHandler(func(s *discordgo.Session, e *discordgo.Connect) {
+		remote.ConnectionUp(name)
+		remote.SetStatus(name, "connected", "")
+	})
+	dg.AddHandler(func(s *discordgo.Session, e *discordgo.Disconnect) {
+		remote.ConnectionDown(name)
+		select {
+		case <-remote.Stopping():
+		default:
+			remote.SetStatus(name, "disconnected", "reconnecting")
+		}
+	})
+
+	// Connecting is retried with a backoff until it works
+	remote.Supervise("discord", func(func()) error {
+		return readSession(dg, inputMsgs, bot)
+	}, bot)
+}
+
+// readSession connects to Discord and reads messages until the bot shuts down
+func readSession(dg *discordgo.Session, inputMsgs chan<- models.Message, bot *models.Bot) error {
+	if err := dg.Open(); err != nil {
 		bot.Log.Errorf("Failed to open connection to Discord server. Error: %s", err.Error())
-		return
+		return err
 	}
 	// Wait here until CTRL-C or other term signal is received
 	bot.Log.Infof("Discord is now running '%s'. Press CTRL-C to exit", bot.Name)
@@ -56,25 +87,135 @@ func (c *Client) Read(inputMsgs chan<- models.Message, rules map[string]models.R
 	user, err := dg.User("@me")
 	if err != nil {
 		bot.Log.Errorf("Failed to get bot name from Discord. Error: %s", err.Error())
-		return
+		dg.Close()
+		return err
 	}
 	bot.Name = user.Username
 
 	// Register a callback for MessageCreate events
 	dg.AddHandler(handleDiscordMessage(bot, inputMsgs))
+	// and for messages being edited or deleted
+	dg.AddHandler(handleDiscordUpdate(bot, inputMsgs))
+	dg.AddHandler(handleDiscordDelete(bot, inputMsgs))
+	// and for users joining a server
+	dg.AddHandler(handleDiscordMemberAdd(bot, inputMsgs))
+	// Any event shows the connection is alive, see 'heartbeat' in bot.yml
+	dg.AddHandler(func(s *discordgo.Session, event interface{}) {
+		remote.Heard(remote.StatusName(bot, "discord"))
+	})
+
+	// Stop reading when the bot shuts down
+	<-remote.Stopping()
+	if err := dg.Close(); err != nil {
+		bot.Log.Errorf("Could not close connection to Discord: %s", err.Error())
+	}
+	remote.SetStatus(remote.StatusName(bot, "discord"), "disconnected", "shutting down")
+	return nil
 }
 
-// Send implementation to satisfy remote interface
+// Send implementation to satisfy remote interface. Threads are channels of their own on Discord, so
+// output for a thread (see models.Message.OutputThread) is sent to it, starting it if need be.
 func (c *Client) Send(message models.Message, bot *models.Bot) {
 	dg := c.new()
 	switch message.Type {
 	case models.MsgTypeDirect, models.MsgTypeChannel:
-		dg.ChannelMessageSend(message.ChannelID, message.Output)
+		// Messages to 'output_to_users' (by user ID) are sent to them directly
+		for _, userID := range message.OutputToUsers {
+			channel, err := dg.UserChannelCreate(userID)
+			if err != nil {
+				bot.Log.Errorf("Could not send a direct message to Discord user %s: %s", userID, err.Error())
+				continue
+			}
+			dg.ChannelMessageSend(channel.ID, message.Output)
+		}
+		if len(message.OutputToUsers) > 0 {
+			return
+		}
+		channel, send, startOn := messageSend(message)
+		if len(startOn) > 0 {
+			thread, err := dg.MessageThreadStart(channel, startOn, threadName(message, bot), threadArchiveMinutes)
+			if err != nil {
+				bot.Log.Errorf("Could not start a Discord thread, replying in the channel: %s", err.Error())
+				send.Reference = &discordgo.MessageReference{MessageID: startOn, ChannelID: channel}
+			} else {
+				channel = thread.ID
+			}
+		}
+		if _, err := dg.ChannelMessageSendComplex(channel, send); err != nil {
+			bot.Log.Errorf("Could not send message to Discord: %s", err.Error())
+		}
 	default:
 		bot.Log.Errorf("Unable to send message of type %d", message.Type)
 	}
 }
 
+// threadArchiveMinutes is how long a thread the bot started stays open without messages, a day
+const threadArchiveMinutes = 1440
+
+// messageSend creates what's sent to Discord for a message, and the channel it's sent to: the thread
+// it's for, if any, or else the message's channel, replying to the message it replies to. When a
+// thread has to be started on the message it replies to first, that message is returned too.
+func messageSend(message models.Message) (string, *discordgo.MessageSend, string) {
+	channel := message.ChannelID
+	send := &discordgo.MessageSend{Content: message.Output}
+	for _, file := range message.Files {
+		send.Files = append(send.Files, &discordgo.File{Name: file.Name, ContentType: file.ContentType, Reader: bytes.NewReader(file.Data)})
+	}
+	switch {
+	case len(message.ThreadID) > 0:
+		channel = message.ThreadID
+	case len(message.ReplyToID) > 0 && message.StartThread:
+		return channel, send, message.ReplyToID
+	case len(message.ReplyToID) > 0:
+		send.Reference = &discordgo.MessageReference{MessageID: message.ReplyToID, ChannelID: message.ChannelID}
+	}
+	return channel, send, ""
+}
+
+// threadName names a thread the bot starts after the message it's started on, as far as Discord allows
+func threadName(message models.Message, bot *models.Bot) string {
+	name := []rune(strings.Join(strings.Fields(message.Input), " "))
+	if len(name) == 0 {
+		return bot.Name
+	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	return string(name)
+}
+
+// PostMessage posts a message in a channel, or in a thread of it, and returns its ID
+func (c *Client) PostMessage(channel, threadID, text string, bot *models.Bot) (string, error) {
+	dg := c.new()
+	if dg == nil {
+		return "", errors.New("Could not create a Discord session")
+	}
+	// Threads are channels of their own
+	if len(threadID) > 0 {
+		channel = threadID
+	}
+	posted, err := dg.ChannelMessageSend(channel, text)
+	if err != nil {
+		return "", err
+	}
+	return posted.ID, nil
+}
+
+// EditMessage replaces the text of a message the bot posted
+func (c *Client) EditMessage(channel, id, text string, bot *models.Bot) error {
+	dg := c.new()
+	if dg == nil {
+		return errors.New("Could not create a Discord session")
+	}
+	_, err := dg.ChannelMessageEdit(channel, id, text)
+	return err
+}
+
+// Capabilities implementation to satisfy remote interface. Reactions aren't implemented.
+func (c *Client) Capabilities() remote.Capabilities {
+	return remote.Capabilities{Threads: true, Files: true, Editing: true}
+}
+
 // InteractiveComponents implementation to satisfy remote interface
 func (c *Client) InteractiveComponents(inputMsgs chan<- models.Message, message *models.Message, rule models.Rule, bot *models.Bot) {
 	// not implemented for Discord
@@ -89,42 +230,144 @@ func handleDiscordMessage(bot *models.Bot, inputMsgs chan<- models.Message) inte
 		if m.Author.Bot {
 			return
 		}
-		// Ignore messages in public channels that don't mention the bot
+		remote.RememberMessage("discord", m.ChannelID, m.ID, remote.Recent{UserID: m.Author.ID, Text: m.Content})
 		ch, _ := s.Channel(m.ChannelID)
-		if ch.Type == discordgo.ChannelTypeGuildText {
-			botmention := false
-			for _, mention := range m.Mentions {
-				if mention.Username == bot.Name {
-					botmention = true
-				}
-			}
-			if !botmention {
-				return
-			}
+		remote.Record(bot, "discord", "message_create", recordedMessage{Message: m.Message, ChannelType: ch.Type, BotUser: s.State.User})
+		if message, ok := readMessage(m.Message, ch.Type, s.State.User, bot); ok {
+			inputMsgs <- message
 		}
-		// Process message
-		message := models.NewMessage()
-		switch m.Type {
-		case discordgo.MessageTypeDefault:
-			t, err := m.Timestamp.Parse()
-			if err != nil {
-				bot.Log.Errorf("Discord Remote: Failed to parse message timestamp.")
+	}
+}
+
+// handleDiscordUpdate handles messages being edited. Discord doesn't say what they said before, so
+// that's only known for messages the bot saw being sent.
+func handleDiscordUpdate(bot *models.Bot, inputMsgs chan<- models.Message) interface{} {
+	return func(s *discordgo.Session, m *discordgo.MessageUpdate) {
+		// Updates without an author are Discord adding embeds, not users editing
+		if m.Author == nil || m.Author.Bot {
+			return
+		}
+		previous, _ := remote.RecallMessage("discord", m.ChannelID, m.ID)
+		if previous.Text == m.Content {
+			return
+		}
+		remote.RememberMessage("discord", m.ChannelID, m.ID, remote.Recent{UserID: m.Author.ID, Text: m.Content})
+		ch, _ := s.Channel(m.ChannelID)
+		remote.Record(bot, "discord", "message_update", recordedMessage{Message: m.Message, ChannelType: ch.Type, BotUser: s.State.User, Previous: &previous})
+		if message, ok := readChange(m.Message, models.MsgEventEdited, previous, ch.Type, s.State.User, bot); ok {
+			inputMsgs <- message
+		}
+	}
+}
+
+// handleDiscordDelete handles messages being deleted. Discord only says which message it was, so
+// only messages the bot saw being sent are handled.
+func handleDiscordDelete(bot *models.Bot, inputMsgs chan<- models.Message) interface{} {
+	return func(s *discordgo.Session, m *discordgo.MessageDelete) {
+		previous, ok := remote.RecallMessage("discord", m.ChannelID, m.ID)
+		if !ok {
+			return
+		}
+		ch, _ := s.Channel(m.ChannelID)
+		remote.Record(bot, "discord", "message_delete", recordedMessage{Message: m.Message, ChannelType: ch.Type, BotUser: s.State.User, Previous: &previous})
+		if message, ok := readChange(m.Message, models.MsgEventDeleted, previous, ch.Type, s.State.User, bot); ok {
+			inputMsgs <- message
+		}
+	}
+}
+
+// handleDiscordMemberAdd handles users joining a server the bot is in. They're sent to the bot as a
+// direct message from them, so rules with 'events' can welcome them.
+func handleDiscordMemberAdd(bot *models.Bot, inputMsgs chan<- models.Message) interface{} {
+	return func(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
+		if m.User == nil || m.User.Bot {
+			return
+		}
+		channel, err := s.UserChannelCreate(m.User.ID)
+		if err != nil {
+			bot.Log.Errorf("Could not open a direct message with new Discord user %s: %s", m.User.ID, err.Error())
+			return
+		}
+		message := populateMessage(models.NewMessage(), models.MsgTypeDirect, channel.ID, "", "", false, m.User, bot)
+		message.Event = models.MsgEventUserJoined
+		message.Vars["_guild.id"] = m.GuildID
+		inputMsgs <- message
+	}
+}
+
+// readChange creates the message for the bot to process from a message that was edited or deleted,
+// with what it said before as ${_previous_text}. Deleted messages are read as they were sent.
+func readChange(m *discordgo.Message, event models.MessageEvent, previous remote.Recent, channelType discordgo.ChannelType, botUser *discordgo.User, bot *models.Bot) (models.Message, bool) {
+	if event == models.MsgEventDeleted {
+		deleted := *m
+		deleted.Type = discordgo.MessageTypeDefault
+		deleted.Content = previous.Text
+		deleted.Author = &discordgo.User{ID: previous.UserID}
+		deleted.Mentions = nil
+		if strings.Contains(previous.Text, "<@"+botUser.ID+">") {
+			deleted.Mentions = []*discordgo.User{botUser}
+		}
+		if deleted.Timestamp.IsZero() {
+			deleted.Timestamp = time.Now()
+		}
+		m = &deleted
+	}
+	message, ok := readMessage(m, channelType, botUser, bot)
+	if !ok {
+		return message, false
+	}
+	message.Event = event
+	message.Vars["_previous_text"], _ = removeBotMention(previous.Text, botUser.ID, bot.MentionPrefixes)
+	return message, true
+}
+
+// readMessage creates the message for the bot to process from a message created in a channel of the given type
+func readMessage(m *discordgo.Message, channelType discordgo.ChannelType, botUser *discordgo.User, bot *models.Bot) (models.Message, bool) {
+	thread := channelType == discordgo.ChannelTypeGuildPublicThread || channelType == discordgo.ChannelTypeGuildPrivateThread || channelType == discordgo.ChannelTypeGuildNewsThread
+	// Ignore messages in public channels, and their threads, that don't mention the bot, unless the channel is bridged
+	if channelType == discordgo.ChannelTypeGuildText || thread {
+		botmention := false
+		for _, mention := range m.Mentions {
+			if mention.Username == bot.Name {
+				botmention = true
 			}
-			timestamp := strconv.FormatInt(t.Unix(), 10)
-			msgType := models.MsgTypeChannel
-			switch ch.Type {
-			case discordgo.ChannelTypeDM:
-				msgType = models.MsgTypeDirect
-			case discordgo.ChannelTypeGuildText:
-				break
-			default:
-				bot.Log.Debugf("Discord Remote: read message from unsupported channel type '%d'. Defaulting to use channel type 0 ('GUILD_TEXT')", ch.Type)
+		}
+		bridged := false
+		for _, bridge := range bot.Bridges {
+			if strings.TrimPrefix(bridge.Channel, "#") == m.ChannelID {
+				bridged = true
 			}
-			contents, mentioned := removeBotMention(m.Content, s.State.User.ID)
-			message = populateMessage(message, msgType, m.ChannelID, contents, timestamp, mentioned, s.State.User, bot)
+		}
+		if !botmention && !bridged {
+			return models.Message{}, false
+		}
+	}
+	// Process message
+	message := models.NewMessage()
+	switch m.Type {
+	case discordgo.MessageTypeDefault:
+		t := m.Timestamp
+		timestamp := strconv.FormatInt(t.Unix(), 10)
+		msgType := models.MsgTypeChannel
+		switch channelType {
+		case discordgo.ChannelTypeDM:
+			msgType = models.MsgTypeDirect
+		case discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildPublicThread, discordgo.ChannelTypeGuildPrivateThread, discordgo.ChannelTypeGuildNewsThread:
+			break
 		default:
-			bot.Log.Errorf("Discord Remote: read message of unsupported type '%d'. Unable to populate message attributes", m.Type)
+			bot.Log.Debugf("Discord Remote: read message from unsupported channel type '%d'. Defaulting to use channel type 0 ('GUILD_TEXT')", channelType)
 		}
-		inputMsgs <- message
+		contents, mentioned := removeBotMention(m.Content, botUser.ID, bot.MentionPrefixes)
+		message = populateMessage(message, msgType, m.ChannelID, contents, timestamp, mentioned, botUser, bot)
+		message.Time = t
+		message.ReplyToID = m.ID
+		// Threads are channels of their own, the output goes to the thread the message is in
+		if thread {
+			message.ThreadID = m.ChannelID
+		}
+		message.Files = attachedFiles(m.Attachments)
+	default:
+		bot.Log.Errorf("Discord Remote: read message of unsupported type '%d'. Unable to populate message attributes", m.Type)
 	}
+	return message, true
 }
@@ -0,0 +1,90 @@
+package discord
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sirupsen/logrus"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestMessageSend(t *testing.T) {
+	tests := []struct {
+		name        string
+		threadID    string
+		replyToID   string
+		startThread bool
+		wantChannel string
+		wantRef     string
+		wantStartOn string
+	}{
+		{"Channel", "", "", false, "C1", "", ""},
+		{"Reply", "", "M1", false, "C1", "M1", ""},
+		{"In a thread", "T1", "M1", false, "T1", "", ""},
+		{"In a thread, starting one", "T1", "M1", true, "T1", "", ""},
+		{"Start a thread", "", "M1", true, "C1", "", "M1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.ChannelID = "C1"
+			message.Output = "hello"
+			message.ThreadID = tt.threadID
+			message.ReplyToID = tt.replyToID
+			message.StartThread = tt.startThread
+			message.Files = []models.File{{Name: "report.csv", Data: []byte("a,b")}}
+
+			channel, send, startOn := messageSend(message)
+			if channel != tt.wantChannel || startOn != tt.wantStartOn {
+				t.Errorf("messageSend() = %q, starting a thread on %q, want %q, %q", channel, startOn, tt.wantChannel, tt.wantStartOn)
+			}
+			ref := ""
+			if send.Reference != nil {
+				ref = send.Reference.MessageID
+				if send.Reference.ChannelID != "C1" {
+					t.Errorf("messageSend() referenced channel %q, want C1", send.Reference.ChannelID)
+				}
+			}
+			if ref != tt.wantRef {
+				t.Errorf("messageSend() replied to %q, want %q", ref, tt.wantRef)
+			}
+			if send.Content != "hello" || len(send.Files) != 1 || send.Files[0].Name != "report.csv" {
+				t.Errorf("messageSend() = %+v, want the output and its file", send)
+			}
+		})
+	}
+}
+
+func TestReadMessageInThread(t *testing.T) {
+	bot := &models.Bot{Name: "flottbot"}
+	bot.Log = *logrus.New()
+	botUser := &discordgo.User{ID: "B1", Username: "flottbot"}
+	m := &discordgo.Message{
+		ID:        "M1",
+		ChannelID: "T1",
+		Content:   "<@B1> deploy",
+		Timestamp: time.Now(),
+		Author:    &discordgo.User{ID: "U1", Username: "jane"},
+		Mentions:  []*discordgo.User{botUser},
+	}
+
+	message, ok := readMessage(m, discordgo.ChannelTypeGuildPublicThread, botUser, bot)
+	if !ok || message.ThreadID != "T1" || message.ReplyToID != "M1" || message.Type != models.MsgTypeChannel {
+		t.Errorf("readMessage() in a thread = %+v, %v, want it answered in thread T1", message, ok)
+	}
+
+	m.Mentions = nil
+	m.Content = "deploy"
+	if _, ok := readMessage(m, discordgo.ChannelTypeGuildPublicThread, botUser, bot); ok {
+		t.Error("readMessage() in a thread without a mention = true, want it ignored")
+	}
+}
+
+func TestNewAsksForMessageContent(t *testing.T) {
+	dg := (&Client{Token: "token"}).new()
+	if dg == nil || dg.Identify.Intents&discordgo.IntentsMessageContent == 0 || dg.Identify.Intents&discordgo.IntentsGuildMessages == 0 {
+		t.Errorf("new() didn't ask for the intents needed to read messages")
+	}
+}
@@ -0,0 +1,43 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+)
+
+// validate that Client can replay recorded payloads
+var _ remote.Replayer = (*Client)(nil)
+
+// recordedMessage is a recorded message, with what else reading it needs to know
+type recordedMessage struct {
+	Message     *discordgo.Message    `json:"message"`
+	ChannelType discordgo.ChannelType `json:"channel_type"`
+	BotUser     *discordgo.User       `json:"bot_user"`
+	Previous    *remote.Recent        `json:"previous,omitempty"` // what an edited or deleted message said before
+}
+
+// Replay turns a recorded Discord payload into the message the bot would have read from it
+func (c *Client) Replay(recording remote.Recording, bot *models.Bot) (models.Message, bool, error) {
+	events := map[string]models.MessageEvent{"message_create": models.MsgEventSent, "message_update": models.MsgEventEdited, "message_delete": models.MsgEventDeleted}
+	event, ok := events[recording.Kind]
+	if !ok {
+		return models.Message{}, false, fmt.Errorf("Unknown kind of Discord payload '%s'", recording.Kind)
+	}
+	var recorded recordedMessage
+	if err := json.Unmarshal(recording.Payload, &recorded); err != nil {
+		return models.Message{}, false, err
+	}
+	if recorded.Message == nil || recorded.BotUser == nil || (event != models.MsgEventSent && recorded.Previous == nil) {
+		return models.Message{}, false, fmt.Errorf("Recorded Discord message is incomplete")
+	}
+	if event != models.MsgEventSent {
+		message, ok := readChange(recorded.Message, event, *recorded.Previous, recorded.ChannelType, recorded.BotUser, bot)
+		return message, ok, nil
+	}
+	message, ok := readMessage(recorded.Message, recorded.ChannelType, recorded.BotUser, bot)
+	return message, ok, nil
+}
@@ -3,6 +3,8 @@ package discord
 import (
 	"fmt"
 	"strings"
+
+	"github.com/target/flottbot/remote"
 )
 
 /*
@@ -11,8 +13,9 @@ Utility functions (does not use discord package)
 ================================================
 */
 
-// removeBotMention - parse out the preppended bot mention in a message
-func removeBotMention(contents, botID string) (string, bool) {
+// removeBotMention - parse out the preppended bot mention in a message, or one of the
+// prefixes the bot is addressed with ('mention_prefixes' in bot.yml)
+func removeBotMention(contents, botID string, prefixes []string) (string, bool) {
 	mention := fmt.Sprintf("<@%s>", botID)
 	wasMentioned := false
 	if strings.HasPrefix(contents, mention) {
@@ -20,5 +23,8 @@ func removeBotMention(contents, botID string) (string, bool) {
 		contents = strings.TrimSpace(contents)
 		wasMentioned = true
 	}
+	if !wasMentioned {
+		contents, wasMentioned = remote.RemovePrefix(contents, prefixes)
+	}
 	return contents, wasMentioned
 }
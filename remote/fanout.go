@@ -0,0 +1,37 @@
+package remote
+
+import "sync"
+
+// defaultFanOutParallelism is how many targets a message is sent to at once, unless bot.yml sets 'output_parallelism'
+const defaultFanOutParallelism = 5
+
+// FanOut sends a message to several targets (e.g. the rooms and users of 'output_to_rooms' and
+// 'output_to_users') at once, at most parallelism of them at a time. Every target is tried, and the
+// errors of the targets that failed are returned by target.
+func FanOut(targets []string, parallelism int, send func(target string) error) map[string]error {
+	if parallelism <= 0 {
+		parallelism = defaultFanOutParallelism
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		errs   = make(map[string]error)
+		tokens = make(chan struct{}, parallelism)
+	)
+	for _, target := range targets {
+		wg.Add(1)
+		tokens <- struct{}{}
+		go func(target string) {
+			defer wg.Done()
+			defer func() { <-tokens }()
+			if err := send(target); err != nil {
+				mu.Lock()
+				errs[target] = err
+				mu.Unlock()
+			}
+		}(target)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,65 @@
+package remote
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFanOut(t *testing.T) {
+	tests := []struct {
+		name        string
+		targets     []string
+		parallelism int
+		failing     map[string]bool
+		wantMax     int
+	}{
+		{"No targets", nil, 5, nil, 0},
+		{"All succeed", []string{"a", "b", "c", "d"}, 2, nil, 2},
+		{"Some fail", []string{"a", "b", "c", "d", "e", "f"}, 3, map[string]bool{"b": true, "e": true}, 3},
+		{"Default parallelism", []string{"a", "b", "c", "d", "e", "f", "g"}, 0, map[string]bool{"a": true}, defaultFanOutParallelism},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			running, maxRunning := 0, 0
+			sent := make(map[string]bool)
+
+			errs := FanOut(tt.targets, tt.parallelism, func(target string) error {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				sent[target] = true
+				mu.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+				if tt.failing[target] {
+					return errors.New("channel_not_found")
+				}
+				return nil
+			})
+
+			if len(sent) != len(tt.targets) {
+				t.Errorf("FanOut() sent to %d targets, want %d", len(sent), len(tt.targets))
+			}
+			if maxRunning > tt.wantMax {
+				t.Errorf("FanOut() sent to %d targets at once, want at most %d", maxRunning, tt.wantMax)
+			}
+			if len(errs) != len(tt.failing) {
+				t.Errorf("FanOut() returned %v, want errors for %v", errs, tt.failing)
+			}
+			for target := range tt.failing {
+				if errs[target] == nil {
+					t.Errorf("FanOut() returned no error for '%s'", target)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// Limits are the bounds of requests to the HTTP servers, from 'http_limits' with defaults filled in
+type Limits struct {
+	MaxBodyBytes      int64
+	MaxHeaderBytes    int
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+}
+
+// DefaultLimits apply to whatever 'http_limits' leaves out
+var DefaultLimits = Limits{
+	MaxBodyBytes:      1 << 20,
+	MaxHeaderBytes:    64 << 10,
+	ReadHeaderTimeout: 10 * time.Second,
+	ReadTimeout:       30 * time.Second,
+	WriteTimeout:      30 * time.Second,
+	IdleTimeout:       2 * time.Minute,
+}
+
+// ParseLimits reads 'http_limits', e.g. to check it when validating the bot's configuration
+func ParseLimits(config models.HTTPLimits) (Limits, error) {
+	limits := DefaultLimits
+	if config.MaxBodyBytes < 0 {
+		return limits, fmt.Errorf("Invalid 'max_body_bytes' %d, use a positive number of bytes", config.MaxBodyBytes)
+	}
+	if config.MaxBodyBytes > 0 {
+		limits.MaxBodyBytes = config.MaxBodyBytes
+	}
+	if config.MaxHeaderBytes < 0 {
+		return limits, fmt.Errorf("Invalid 'max_header_bytes' %d, use a positive number of bytes", config.MaxHeaderBytes)
+	}
+	if config.MaxHeaderBytes > 0 {
+		limits.MaxHeaderBytes = config.MaxHeaderBytes
+	}
+
+	timeouts := []struct {
+		setting string
+		value   string
+		into    *time.Duration
+	}{
+		{"read_header_timeout", config.ReadHeaderTimeout, &limits.ReadHeaderTimeout},
+		{"read_timeout", config.ReadTimeout, &limits.ReadTimeout},
+		{"write_timeout", config.WriteTimeout, &limits.WriteTimeout},
+		{"idle_timeout", config.IdleTimeout, &limits.IdleTimeout},
+	}
+	for _, t := range timeouts {
+		if len(t.value) == 0 {
+			continue
+		}
+		d, err := utils.ParseDuration(t.value)
+		if err != nil || d <= 0 {
+			return limits, fmt.Errorf("Invalid '%s' '%s', use a duration like '30s'", t.setting, t.value)
+		}
+		*t.into = d
+	}
+	return limits, nil
+}
+
+// configure sets the timeouts and header limit of a server
+func (l Limits) configure(srv *http.Server) {
+	srv.MaxHeaderBytes = l.MaxHeaderBytes
+	srv.ReadHeaderTimeout = l.ReadHeaderTimeout
+	srv.ReadTimeout = l.ReadTimeout
+	srv.WriteTimeout = l.WriteTimeout
+	srv.IdleTimeout = l.IdleTimeout
+}
+
+// limitBody reads request bodies before the handler gets them, so none of them reads more than
+// max bytes: larger bodies are answered with 413, ones that don't arrive in time with 408
+func limitBody(name string, max int64, handler http.Handler, bot *models.Bot) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > max {
+			rejectBody(w, r, name, http.StatusRequestEntityTooLarge, "body too large", bot)
+			return
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, max+1))
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				rejectBody(w, r, name, http.StatusRequestTimeout, "body took too long to arrive", bot)
+				return
+			}
+			rejectBody(w, r, name, http.StatusBadRequest, "could not read the body", bot)
+			return
+		}
+		if int64(len(body)) > max {
+			rejectBody(w, r, name, http.StatusRequestEntityTooLarge, "body too large", bot)
+			return
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// rejectBody responds to a request whose body isn't read, closing the connection since the rest
+// of the body would still be on it
+func rejectBody(w http.ResponseWriter, r *http.Request, name string, status int, reason string, bot *models.Bot) {
+	bot.Log.Warnf("HTTP server '%s': rejected %s %s from %s: %s", name, r.Method, r.URL.Path, r.RemoteAddr, reason)
+	w.Header().Set("Connection", "close")
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,81 @@
+package remote
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/target/flottbot/models"
+)
+
+// timeoutReader fails like a connection whose read deadline passed
+type timeoutReader struct{}
+
+func (timeoutReader) Read([]byte) (int, error) { return 0, timeoutError{} }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestLimitBody(t *testing.T) {
+	bot := &models.Bot{Log: *logrus.New()}
+	bot.Log.SetOutput(ioutil.Discard)
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		slow          bool
+		want          int
+	}{
+		{"Small enough", "0123456789", 10, false, http.StatusOK},
+		{"Too large", "0123456789A", 11, false, http.StatusRequestEntityTooLarge},
+		{"Too large without a length", "0123456789A", -1, false, http.StatusRequestEntityTooLarge},
+		{"Too slow", "", -1, true, http.StatusRequestTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := limitBody(ServerEvents, 10, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				if string(body) != tt.body {
+					t.Errorf("Handler got body %q, want %q", body, tt.body)
+				}
+			}), bot)
+
+			r := httptest.NewRequest("POST", "/slack_events/v1/bot", strings.NewReader(tt.body))
+			if tt.slow {
+				r.Body = ioutil.NopCloser(timeoutReader{})
+			}
+			r.ContentLength = tt.contentLength
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("limitBody() responded %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits(models.HTTPLimits{MaxBodyBytes: 2048, WriteTimeout: "1m"})
+	if err != nil {
+		t.Fatalf("ParseLimits() error = %v", err)
+	}
+	if limits.MaxBodyBytes != 2048 || limits.WriteTimeout != time.Minute || limits.ReadTimeout != DefaultLimits.ReadTimeout {
+		t.Errorf("ParseLimits() = %+v", limits)
+	}
+
+	invalid := []models.HTTPLimits{{MaxBodyBytes: -1}, {MaxHeaderBytes: -1}, {IdleTimeout: "-5s"}, {ReadHeaderTimeout: "soon"}}
+	for _, config := range invalid {
+		if _, err := ParseLimits(config); err == nil {
+			t.Errorf("ParseLimits(%+v) succeeded", config)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package remote
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RemovePrefix takes a prefix the bot is addressed with off the start of a message, e.g. '!deploy' or
+// 'hubot: deploy', as with a mention of the bot. Prefixes ending in a letter or digit must be followed
+// by a space, ':', or ','; others, like '!', may be followed by the command right away. Case is ignored,
+// and the longest matching prefix wins.
+func RemovePrefix(contents string, prefixes []string) (string, bool) {
+	if len(prefixes) == 0 {
+		return contents, false
+	}
+	trimmed := strings.TrimSpace(contents)
+	for _, prefix := range longestFirst(prefixes) {
+		if len(trimmed) < len(prefix) || !strings.EqualFold(trimmed[:len(prefix)], prefix) {
+			continue
+		}
+		rest := trimmed[len(prefix):]
+		if isWordPrefix(prefix) {
+			next, _ := utf8.DecodeRuneInString(rest)
+			if len(rest) > 0 && !unicode.IsSpace(next) && next != ':' && next != ',' {
+				continue
+			}
+			rest = strings.TrimLeft(rest, ":,")
+		}
+		// A prefix on its own isn't a command
+		if rest = strings.TrimSpace(rest); len(rest) > 0 {
+			return rest, true
+		}
+	}
+	return contents, false
+}
+
+// longestFirst sorts the prefixes that aren't blank by length, longest first
+func longestFirst(prefixes []string) []string {
+	sorted := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if prefix = strings.TrimSpace(prefix); len(prefix) > 0 {
+			sorted = append(sorted, prefix)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	return sorted
+}
+
+// isWordPrefix determines whether a prefix ends like a word, e.g. 'hubot', so it can't run into the command
+func isWordPrefix(prefix string) bool {
+	last, _ := utf8.DecodeLastRuneInString(prefix)
+	return unicode.IsLetter(last) || unicode.IsDigit(last)
+}
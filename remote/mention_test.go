@@ -0,0 +1,33 @@
+package remote
+
+import "testing"
+
+func TestRemovePrefix(t *testing.T) {
+	prefixes := []string{"!", "!!", "hubot", "bot"}
+
+	tests := []struct {
+		name          string
+		contents      string
+		want          string
+		wantMentioned bool
+	}{
+		{"Symbol", "!deploy api", "deploy api", true},
+		{"Longest symbol", "!!deploy", "deploy", true},
+		{"Symbol and space", "! deploy", "deploy", true},
+		{"Word", "hubot deploy api", "deploy api", true},
+		{"Word and colon", "Hubot: deploy", "deploy", true},
+		{"Word and comma", "bot, deploy", "deploy", true},
+		{"Word in a word", "bottle of water", "bottle of water", false},
+		{"Prefix only", "hubot", "hubot", false},
+		{"Not at the start", "deploy !now", "deploy !now", false},
+		{"No prefix", "deploy api", "deploy api", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, mentioned := RemovePrefix(tt.contents, prefixes)
+			if got != tt.want || mentioned != tt.wantMentioned {
+				t.Errorf("RemovePrefix() = %q, %v, want %q, %v", got, mentioned, tt.want, tt.wantMentioned)
+			}
+		})
+	}
+}
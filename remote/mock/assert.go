@@ -0,0 +1,70 @@
+package mock
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+
+	"github.com/target/flottbot/models"
+)
+
+// Expect returns the next message the bot sends, and fails the test if it sends none within the timeout
+func (c *Client) Expect(t testing.TB, timeout time.Duration) models.Message {
+	t.Helper()
+	message, err := c.Await(timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+// ExpectNone fails the test if the bot sends a message within the given time
+func (c *Client) ExpectNone(t testing.TB, wait time.Duration) {
+	t.Helper()
+	if message, err := c.Await(wait); err == nil {
+		t.Fatalf("The bot sent %q, expected no message", message.Output)
+	}
+}
+
+// AssertOutput fails the test if the text of a message the bot sent isn't the expected one
+func AssertOutput(t testing.TB, message models.Message, want string) {
+	t.Helper()
+	if message.Output != want {
+		t.Errorf("The bot sent %q, want %q", message.Output, want)
+	}
+}
+
+// AssertOutputContains fails the test if the text of a message the bot sent doesn't contain the expected text
+func AssertOutputContains(t testing.TB, message models.Message, want string) {
+	t.Helper()
+	if !strings.Contains(message.Output, want) {
+		t.Errorf("The bot sent %q, which doesn't contain %q", message.Output, want)
+	}
+}
+
+// AssertAttachment returns the Slack attachment with the given title of a message the bot sent,
+// and fails the test if it has none
+func AssertAttachment(t testing.TB, message models.Message, title string) slack.Attachment {
+	t.Helper()
+	for _, attachment := range message.Remotes.Slack.Attachments {
+		if attachment.Title == title {
+			return attachment
+		}
+	}
+	t.Fatalf("The message %q has no attachment titled %q", message.Output, title)
+	return slack.Attachment{}
+}
+
+// AssertFile returns the file with the given name sent along with a message, and fails the test if there is none
+func AssertFile(t testing.TB, message models.Message, name string) models.File {
+	t.Helper()
+	for _, file := range message.Files {
+		if file.Name == name {
+			return file
+		}
+	}
+	t.Fatalf("The message %q has no file named %q", message.Output, name)
+	return models.File{}
+}
@@ -0,0 +1,428 @@
+// Package mock is an in-memory chat application for testing a bot's rules end to end, e.g. in the
+// Go integration tests of a project embedding flottbot. Tests send messages to the bot with Say or
+// Post, and wait for what it sends back with Await or Expect:
+//
+//	bot := &models.Bot{Name: "testbot", ConfigDir: "/path/to/config", Storage: "memory"}
+//	client := mock.New(bot)
+//	core.Configure(bot)
+//	core.Run(bot)
+//
+//	client.Say("hello")
+//	mock.AssertOutput(t, client.Expect(t, 5*time.Second), "Hello, tester!")
+package mock
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+)
+
+// DefaultUser is the user who sends the messages of a client, unless Post says otherwise
+const DefaultUser = "tester"
+
+var (
+	clientsMu sync.Mutex
+	clients   = make(map[*models.Bot]*Client)
+)
+
+// Client is the mock chat application of a bot. It's safe to use from several goroutines.
+type Client struct {
+	inbox chan models.Message
+
+	mu        sync.Mutex
+	sent      []models.Message
+	next      int           // the first sent message Await hasn't returned yet
+	changed   chan struct{} // closed when the bot sends a message or reacts
+	reactions []Reaction
+	edits     []MessageEdit
+	away      map[string]bool
+	channels  map[string]*Channel
+}
+
+// Input is a message sent to the bot
+type Input struct {
+	Text    string
+	User    string        // the name and ID of the sender, DefaultUser if empty
+	Channel string        // the channel the message is sent in, mentioning the bot; empty for a direct message
+	Thread  string        // the thread the message is sent in, if any
+	Files   []models.File // files shared along with the message
+	Time    time.Time     // when the message was sent, now if zero
+}
+
+// Reaction is an emoji reaction the bot added to a message, e.g. with 'reaction' in a rule, or removed
+// from it, with 'update_reaction'
+type Reaction struct {
+	MessageID string
+	Emoji     string
+	Removed   bool
+}
+
+// MessageEdit is a change the bot made to the text of a message it sent, e.g. the counter of a rule
+// with 'correlate'
+type MessageEdit struct {
+	MessageID string
+	Text      string
+}
+
+// Channel is a channel the bot created, e.g. for an incident
+type Channel struct {
+	Name    string
+	Members []string // the users invited to it
+	Pins    []string // the messages the bot pinned in it
+}
+
+// validate that Client adheres to remote interface
+var _ remote.Remote = (*Client)(nil)
+
+// validate that Client can set up channels
+var _ remote.ChannelManager = (*Client)(nil)
+
+// validate that Client can edit the messages it posts
+var _ remote.MessageEditor = (*Client)(nil)
+
+// New creates the mock chat application of a bot and makes it the bot's chat application.
+// Call it before configuring and running the bot.
+func New(bot *models.Bot) *Client {
+	c := &Client{inbox: make(chan models.Message, 100), changed: make(chan struct{})}
+	bot.ChatApplication = "mock"
+	clientsMu.Lock()
+	clients[bot] = c
+	clientsMu.Unlock()
+	return c
+}
+
+// ForBot returns the mock chat application created for a bot with New
+func ForBot(bot *models.Bot) (*Client, bool) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	c, ok := clients[bot]
+	return c, ok
+}
+
+// Say sends the bot a direct message from DefaultUser
+func (c *Client) Say(text string) models.Message {
+	return c.Post(Input{Text: text})
+}
+
+// Post sends the bot a message, and returns it as the bot reads it
+func (c *Client) Post(input Input) models.Message {
+	message := models.NewMessage()
+	message.Service = models.MsgServiceChat
+	message.Input = input.Text
+	message.Timestamp = strconv.FormatInt(time.Now().UnixNano(), 10)
+	message.Time = input.Time
+	if message.Time.IsZero() {
+		message.Time = time.Now()
+	}
+	message.ThreadID = input.Thread
+	message.ReplyToID = message.Timestamp
+	message.Files = input.Files
+
+	message.Type = models.MsgTypeDirect
+	if len(input.Channel) > 0 {
+		message.Type = models.MsgTypeChannel
+		message.ChannelID = input.Channel
+		message.ChannelName = input.Channel
+		message.BotMentioned = true
+	}
+
+	user := input.User
+	if len(user) == 0 {
+		user = DefaultUser
+	}
+	message.Vars["_user.id"] = user
+	message.Vars["_user.name"] = user
+	message.Vars["_user.firstname"] = user
+
+	c.inbox <- message
+	return message
+}
+
+// Edit changes the text of a message sent with Post, and returns the edit as the bot reads it
+func (c *Client) Edit(message models.Message, text string) models.Message {
+	return c.change(message, models.MsgEventEdited, text)
+}
+
+// Delete deletes a message sent with Post, and returns the deletion as the bot reads it
+func (c *Client) Delete(message models.Message) models.Message {
+	return c.change(message, models.MsgEventDeleted, message.Input)
+}
+
+// Join adds the bot to a channel, and returns the event as the bot reads it
+func (c *Client) Join(channel string) models.Message {
+	return c.channelEvent(models.MsgEventJoined, channel)
+}
+
+// Leave removes the bot from a channel, and returns the event as the bot reads it
+func (c *Client) Leave(channel string) models.Message {
+	return c.channelEvent(models.MsgEventLeft, channel)
+}
+
+// Arrive has a user join the workspace, and returns the event as the bot reads it: a direct message
+// from the user
+func (c *Client) Arrive(user string) models.Message {
+	message := models.NewMessage()
+	message.Service = models.MsgServiceChat
+	message.Type = models.MsgTypeDirect
+	message.Event = models.MsgEventUserJoined
+	message.Vars["_user.id"] = user
+	message.Vars["_user.name"] = user
+	message.Vars["_user.firstname"] = user
+
+	c.inbox <- message
+	return message
+}
+
+// channelEvent sends the bot the event of it joining or leaving a channel
+func (c *Client) channelEvent(event models.MessageEvent, channel string) models.Message {
+	message := models.NewMessage()
+	message.Service = models.MsgServiceChat
+	message.Type = models.MsgTypeChannel
+	message.Event = event
+	message.ChannelID = channel
+	message.ChannelName = channel
+	message.Vars["_channel.id"] = channel
+	message.Vars["_channel.name"] = channel
+
+	c.inbox <- message
+	return message
+}
+
+// change sends the bot an edit or deletion of a message
+func (c *Client) change(message models.Message, event models.MessageEvent, text string) models.Message {
+	change := models.NewMessage()
+	change.Service = message.Service
+	change.Type = message.Type
+	change.Event = event
+	change.Input = text
+	change.Timestamp = message.Timestamp
+	change.Time = message.Time
+	change.ThreadID = message.ThreadID
+	change.ReplyToID = message.ReplyToID
+	change.ChannelID = message.ChannelID
+	change.ChannelName = message.ChannelName
+	change.BotMentioned = message.BotMentioned
+	for _, name := range []string{"_user.id", "_user.name", "_user.firstname"} {
+		change.Vars[name] = message.Vars[name]
+	}
+	change.Vars["_previous_text"] = message.Input
+
+	c.inbox <- change
+	return change
+}
+
+// Await returns the next message the bot sends, waiting for up to the timeout
+func (c *Client) Await(timeout time.Duration) (models.Message, error) {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		if c.next < len(c.sent) {
+			message := c.sent[c.next]
+			c.next++
+			c.mu.Unlock()
+			return message, nil
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return models.Message{}, fmt.Errorf("The bot sent no message within %s", timeout)
+		}
+	}
+}
+
+// Sent returns every message the bot has sent so far
+func (c *Client) Sent() []models.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]models.Message{}, c.sent...)
+}
+
+// SetAway sets whether a user is away, e.g. to test a rule's 'fallback'
+func (c *Client) SetAway(user string, away bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.away == nil {
+		c.away = make(map[string]bool)
+	}
+	c.away[user] = away
+}
+
+// Away looks up a user of 'output_to_users', and whether they're away; users are their own IDs
+func (c *Client) Away(user string, bot *models.Bot) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return user, c.away[user], nil
+}
+
+// Channels returns the channels the bot created so far; channels are their own IDs
+func (c *Client) Channels() map[string]Channel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	channels := make(map[string]Channel, len(c.channels))
+	for id, channel := range c.channels {
+		channels[id] = Channel{Name: channel.Name, Members: append([]string{}, channel.Members...), Pins: append([]string{}, channel.Pins...)}
+	}
+	return channels
+}
+
+// CreateChannel creates a channel, which is its own ID
+func (c *Client) CreateChannel(name string, bot *models.Bot) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.channels == nil {
+		c.channels = make(map[string]*Channel)
+	}
+	if _, ok := c.channels[name]; ok {
+		return "", fmt.Errorf("Channel '%s' already exists", name)
+	}
+	c.channels[name] = &Channel{Name: name}
+	return name, nil
+}
+
+// Invite adds users to a channel the bot created
+func (c *Client) Invite(channel string, users []string, bot *models.Bot) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, ok := c.channels[channel]
+	if !ok {
+		return fmt.Errorf("Channel '%s' does not exist", channel)
+	}
+	ch.Members = append(ch.Members, users...)
+	return nil
+}
+
+// Pin pins a message in a channel the bot created
+func (c *Client) Pin(channel, text string, bot *models.Bot) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, ok := c.channels[channel]
+	if !ok {
+		return fmt.Errorf("Channel '%s' does not exist", channel)
+	}
+	ch.Pins = append(ch.Pins, text)
+	return nil
+}
+
+// PostMessage sends a message to a channel, or a thread of it, like Send, and returns its ID
+func (c *Client) PostMessage(channel, threadID, text string, bot *models.Bot) (string, error) {
+	message := models.NewMessage()
+	message.Service = models.MsgServiceChat
+	message.Type = models.MsgTypeChannel
+	message.ChannelID = channel
+	message.OutputToRooms = []string{channel}
+	message.ThreadID = threadID
+	message.Output = text
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, message)
+	c.notify()
+	return message.ID, nil
+}
+
+// EditMessage changes the text of a message the bot sent with PostMessage; Sent returns it as edited
+func (c *Client) EditMessage(channel, id, text string, bot *models.Bot) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.sent {
+		if c.sent[i].ID == id && c.sent[i].ChannelID == channel {
+			c.sent[i].Output = text
+			c.edits = append(c.edits, MessageEdit{MessageID: id, Text: text})
+			c.notify()
+			return nil
+		}
+	}
+	return fmt.Errorf("Message '%s' does not exist in channel '%s'", id, channel)
+}
+
+// Edits returns every edit the bot has made to its messages so far
+func (c *Client) Edits() []MessageEdit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]MessageEdit{}, c.edits...)
+}
+
+// Reactions returns every reaction the bot has added or removed so far
+func (c *Client) Reactions() []Reaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Reaction{}, c.reactions...)
+}
+
+// Reaction implementation to satisfy remote interface
+func (c *Client) Reaction(message models.Message, rule models.Rule, bot *models.Bot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(rule.RemoveReaction) > 0 {
+		c.react(Reaction{MessageID: message.ID, Emoji: rule.RemoveReaction, Removed: true})
+	}
+	if len(rule.Reaction) > 0 {
+		c.react(Reaction{MessageID: message.ID, Emoji: rule.Reaction})
+	}
+}
+
+// react records a reaction, unless it was already recorded: every message a rule sends comes with
+// its reaction, but a message can only have the same reaction once; c.mu must be held
+func (c *Client) react(reaction Reaction) {
+	for _, r := range c.reactions {
+		if r == reaction {
+			return
+		}
+	}
+	c.reactions = append(c.reactions, reaction)
+	c.notify()
+}
+
+// Read implementation to satisfy remote interface
+func (c *Client) Read(inputMsgs chan<- models.Message, rules map[string]models.Rule, bot *models.Bot) {
+	remote.SetStatus(remote.StatusName(bot, "mock"), "reading", "")
+	for {
+		select {
+		case message := <-c.inbox:
+			// Like in chat applications, the bot's 'mention_prefixes' address it
+			message.Input, _ = remote.RemovePrefix(message.Input, bot.MentionPrefixes)
+			inputMsgs <- message
+		case <-remote.Stopping():
+			remote.SetStatus(remote.StatusName(bot, "mock"), "stopped", "")
+			return
+		}
+	}
+}
+
+// Send implementation to satisfy remote interface. Like chat applications, it leaves out messages
+// without any content, e.g. those that only carry a reaction.
+func (c *Client) Send(message models.Message, bot *models.Bot) {
+	if len(message.Output) == 0 && len(message.Files) == 0 && len(message.Remotes.Slack.Attachments) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, message)
+	c.notify()
+}
+
+// Capabilities implementation to satisfy remote interface. Like Slack, it takes everything, so
+// tests can inspect it.
+func (c *Client) Capabilities() remote.Capabilities {
+	return remote.Capabilities{Threads: true, Ephemeral: true, Attachments: true, Reactions: true, Files: true, Editing: true}
+}
+
+// InteractiveComponents implementation to satisfy remote interface. Like Slack's, the attachments
+// of the rule go along with the message it sends, so tests can inspect them.
+func (c *Client) InteractiveComponents(inputMsgs chan<- models.Message, message *models.Message, rule models.Rule, bot *models.Bot) {
+	if message != nil {
+		message.Remotes = rule.Remotes
+	}
+}
+
+// notify wakes up the tests waiting in Await; c.mu must be held
+func (c *Client) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
@@ -0,0 +1,153 @@
+package mock_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/core"
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote/mock"
+)
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flottbot-mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "config", "rules"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "config", "rules", "hello.yml"), []byte(`
+name: hello
+active: true
+respond: hello
+reaction: wave
+format_output: "Hello, ${_user.firstname}!"
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "config", "rules", "options.yml"), []byte(`
+name: options
+active: true
+respond: options
+remotes:
+  slack:
+    attachments:
+      - title: Choose an action
+        text: What should I do?
+format_output: "Options"
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "config", "rules", "import.yml"), []byte(`
+name: import
+active: true
+files:
+  - "*.csv"
+format_output: "Importing ${_file.name} from ${_file.url}"
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "config", "rules", "moderate.yml"), []byte(`
+name: moderate
+active: true
+hear: /password/
+events:
+  - edited
+format_output: "Please don't post passwords, ${_user.name} (it said '${_previous_text}')"
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "config", "rules", "intro.yml"), []byte(`
+name: intro
+active: true
+events:
+  - joined
+format_output: "Hi #${_channel.name}, ask me for help to see what I can do!"
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "config", "rules", "welcome.yml"), []byte(`
+name: welcome
+active: true
+events:
+  - user_joined
+format_output: "Welcome, ${_user.firstname}!"
+`), 0644)
+
+	bot := &models.Bot{Name: "testbot", ConfigDir: filepath.Join(dir, "config"), StateDir: filepath.Join(dir, "state"), Storage: "memory"}
+	client := mock.New(bot)
+	core.Configure(bot)
+	core.Run(bot)
+
+	t.Run("Direct message", func(t *testing.T) {
+		client.Say("hello")
+		mock.AssertOutput(t, client.Expect(t, 5*time.Second), "Hello, tester!")
+	})
+
+	t.Run("Channel message", func(t *testing.T) {
+		input := client.Post(mock.Input{Text: "hello", User: "alice", Channel: "ops"})
+		message := client.Expect(t, 5*time.Second)
+		mock.AssertOutput(t, message, "Hello, alice!")
+		if message.ChannelID != "ops" {
+			t.Errorf("The bot replied in %q, want %q", message.ChannelID, "ops")
+		}
+		found := false
+		for _, reaction := range client.Reactions() {
+			if reaction == (mock.Reaction{MessageID: input.ID, Emoji: "wave"}) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Reactions() = %+v, want 'wave' on %s", client.Reactions(), input.ID)
+		}
+	})
+
+	t.Run("Attachments", func(t *testing.T) {
+		client.Say("options")
+		message := client.Expect(t, 5*time.Second)
+		mock.AssertOutputContains(t, message, "Options")
+		if attachment := mock.AssertAttachment(t, message, "Choose an action"); attachment.Text != "What should I do?" {
+			t.Errorf("Attachment text = %q, want %q", attachment.Text, "What should I do?")
+		}
+	})
+
+	t.Run("Files", func(t *testing.T) {
+		client.Post(mock.Input{Files: []models.File{{Name: "notes.txt", URL: "https://files.example.com/notes.txt"}, {Name: "Users.CSV", URL: "https://files.example.com/users.csv"}}})
+		message := client.Expect(t, 5*time.Second)
+		mock.AssertOutput(t, message, "Importing Users.CSV from https://files.example.com/users.csv")
+		if len(message.Files) > 0 {
+			t.Errorf("The bot sent back files %+v", message.Files)
+		}
+	})
+
+	t.Run("Edits", func(t *testing.T) {
+		input := client.Post(mock.Input{Text: "deploying now", User: "alice", Channel: "ops"})
+		// No rule matches it, so the bot says what it understands
+		mock.AssertOutputContains(t, client.Expect(t, 5*time.Second), "I understand these commands")
+		client.Edit(input, "deploying now, the password is hunter2")
+		mock.AssertOutput(t, client.Expect(t, 5*time.Second), "Please don't post passwords, alice (it said 'deploying now')")
+		// Rules without 'events' only see messages being sent
+		client.Delete(input)
+		client.ExpectNone(t, 200*time.Millisecond)
+	})
+
+	t.Run("Joining channels", func(t *testing.T) {
+		client.Join("releases")
+		message := client.Expect(t, 5*time.Second)
+		mock.AssertOutput(t, message, "Hi #releases, ask me for help to see what I can do!")
+		if message.ChannelID != "releases" {
+			t.Errorf("The bot introduced itself in %q, want %q", message.ChannelID, "releases")
+		}
+		client.Leave("releases")
+		client.ExpectNone(t, 200*time.Millisecond)
+	})
+
+	t.Run("New users", func(t *testing.T) {
+		client.Arrive("bob")
+		message := client.Expect(t, 5*time.Second)
+		mock.AssertOutput(t, message, "Welcome, bob!")
+		if message.Type != models.MsgTypeDirect || message.Vars["_user.id"] != "bob" {
+			t.Errorf("The bot welcomed %q in a message of type %d, want a direct message to bob", message.Vars["_user.id"], message.Type)
+		}
+	})
+
+	t.Run("No response", func(t *testing.T) {
+		client.ExpectNone(t, 200*time.Millisecond)
+		if got := len(client.Sent()); got != 8 {
+			t.Errorf("Sent() has %d messages, want 8", got)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package remote
+
+import (
+	"container/list"
+	"sync"
+)
+
+// recentCacheSize is how many messages are remembered, so what they said is known when they're
+// edited or deleted
+const recentCacheSize = 1000
+
+// Recent is a message a user sent lately, as it was sent
+type Recent struct {
+	UserID string `json:"user_id"`
+	Text   string `json:"text"`
+	Thread string `json:"thread,omitempty"`
+}
+
+// recentCache remembers the most recently sent messages, forgetting the oldest when it's full
+type recentCache struct {
+	mu      sync.Mutex
+	order   *list.List // most recently sent first
+	entries map[string]*list.Element
+}
+
+// recentEntry is a message remembered by a recentCache
+type recentEntry struct {
+	key     string
+	message Recent
+}
+
+var recentMessages = &recentCache{order: list.New(), entries: make(map[string]*list.Element)}
+
+// RememberMessage remembers a message a user sent in a channel, by the ID the remote gives it. Chat
+// applications don't always say what a message said before it was edited or deleted.
+func RememberMessage(source, channel, id string, message Recent) {
+	if len(id) == 0 {
+		return
+	}
+	recentMessages.remember(source+"/"+channel+"/"+id, message, recentCacheSize)
+}
+
+// RecallMessage looks up a message remembered with RememberMessage
+func RecallMessage(source, channel, id string) (Recent, bool) {
+	return recentMessages.recall(source + "/" + channel + "/" + id)
+}
+
+// remember remembers a message, or what it says now
+func (c *recentCache) remember(key string, message Recent, size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*recentEntry).message = message
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&recentEntry{key: key, message: message})
+	for c.order.Len() > size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*recentEntry).key)
+	}
+}
+
+// recall looks up a remembered message
+func (c *recentCache) recall(key string) (Recent, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return Recent{}, false
+	}
+	return e.Value.(*recentEntry).message, true
+}
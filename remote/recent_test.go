@@ -0,0 +1,33 @@
+package remote
+
+import (
+	"container/list"
+	"testing"
+)
+
+func TestRecentCache(t *testing.T) {
+	cache := &recentCache{order: list.New(), entries: make(map[string]*list.Element)}
+	cache.remember("a", Recent{UserID: "U1", Text: "one"}, 2)
+	cache.remember("b", Recent{UserID: "U1", Text: "two"}, 2)
+	cache.remember("a", Recent{UserID: "U1", Text: "one, edited"}, 2)
+	cache.remember("c", Recent{UserID: "U2", Text: "three"}, 2)
+
+	tests := []struct {
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{"a", "one, edited", true},
+		{"b", "", false},
+		{"c", "three", true},
+		{"d", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := cache.recall(tt.key)
+			if ok != tt.wantOK || got.Text != tt.want {
+				t.Errorf("recall(%s) = %+v, %v, want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package remote
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/target/flottbot/models"
+)
+
+var (
+	connectionsUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "flottbot_remote_connected",
+			Help: "Whether the connection of a remote is up (1) or not (0)",
+		},
+		[]string{"remote"},
+	)
+	reconnects = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "flottbot_remote_reconnects",
+			Help: "Total No. of times a remote connected again after its connection went down",
+		},
+		[]string{"remote"},
+	)
+)
+
+var (
+	connectedMu sync.Mutex
+	connected   = make(map[string]bool) // remotes whose connection was up before, by status name
+)
+
+// Collectors are the metrics of the remotes' connections, for the Prometheus server
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{connectionsUp, reconnects}
+}
+
+// ConnectionUp records that the connection of the named remote is up, counting a reconnect
+// when it was up before
+func ConnectionUp(name string) {
+	connectedMu.Lock()
+	defer connectedMu.Unlock()
+	if connected[name] {
+		reconnects.With(prometheus.Labels{"remote": name}).Inc()
+	}
+	connected[name] = true
+	connectionsUp.With(prometheus.Labels{"remote": name}).Set(1)
+}
+
+// ConnectionDown records that the connection of the named remote went down
+func ConnectionDown(name string) {
+	connectionsUp.With(prometheus.Labels{"remote": name}).Set(0)
+}
+
+// Backoff is how long to wait between attempts to connect: it doubles with every attempt, from Min
+// up to Max, with jitter so that bots cut off at the same time don't all come back at once
+type Backoff struct {
+	Min      time.Duration
+	Max      time.Duration
+	attempts uint
+}
+
+// Next is how long to wait before the next attempt: between half of and the full backoff
+func (b *Backoff) Next() time.Duration {
+	d := b.Max
+	if b.attempts < 32 && b.Min<<b.attempts < b.Max {
+		d = b.Min << b.attempts
+	}
+	b.attempts++
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Reset starts the backoff over, e.g. once connected
+func (b *Backoff) Reset() {
+	b.attempts = 0
+}
+
+// reconnectBackoff is the backoff between attempts to connect of Supervise
+var reconnectBackoff = Backoff{Min: time.Second, Max: 5 * time.Minute}
+
+// Supervise keeps the connection of a remote up until the bot stops: session connects and reads
+// until the connection ends, and is run again, after a backoff, whenever it does. session calls up
+// once connected, which starts the backoff over. The connection's state is kept in the metrics.
+func Supervise(remote string, session func(up func()) error, bot *models.Bot) {
+	name := StatusName(bot, remote)
+	backoff := &Backoff{Min: reconnectBackoff.Min, Max: reconnectBackoff.Max}
+	for {
+		err := session(func() {
+			backoff.Reset()
+			ConnectionUp(name)
+		})
+		ConnectionDown(name)
+		select {
+		case <-Stopping():
+			return
+		default:
+		}
+
+		wait := backoff.Next()
+		if err != nil {
+			SetStatus(name, "disconnected", err.Error())
+			bot.Log.Errorf("Connection of %s ended: %s; reconnecting in %s", remote, err.Error(), wait)
+		} else {
+			SetStatus(name, "disconnected", "reconnecting")
+			bot.Log.Warnf("Connection of %s ended; reconnecting in %s", remote, wait)
+		}
+		select {
+		case <-Stopping():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package remote
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/target/flottbot/models"
+)
+
+func TestBackoff(t *testing.T) {
+	b := &Backoff{Min: time.Second, Max: 10 * time.Second}
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if got := b.Next(); got < want/2 || got > want {
+			t.Errorf("Next() #%d = %s, want between %s and %s", i+1, got, want/2, want)
+		}
+	}
+	b.Reset()
+	if got := b.Next(); got > time.Second {
+		t.Errorf("Next() after Reset() = %s, want at most 1s", got)
+	}
+}
+
+func TestSupervise(t *testing.T) {
+	defer func(backoff Backoff) { reconnectBackoff = backoff }(reconnectBackoff)
+	reconnectBackoff = Backoff{Min: time.Millisecond, Max: 10 * time.Millisecond}
+
+	bot := &models.Bot{Log: *logrus.New()}
+	bot.Log.SetOutput(ioutil.Discard)
+	sessions := make(chan int, 10)
+	reconnected := make(chan struct{})
+	attempt := 0
+	go Supervise("supervised", func(up func()) error {
+		attempt++
+		sessions <- attempt
+		switch attempt {
+		case 1:
+			return errors.New("connection refused")
+		case 2:
+			up()
+			return nil
+		default:
+			up()
+			close(reconnected)
+			select {}
+		}
+	}, bot)
+
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supervise() did not reconnect")
+	}
+	if len(sessions) != 3 {
+		t.Errorf("Supervise() ran %d sessions, want 3", len(sessions))
+	}
+	if status := Statuses()["supervised"]; status.State != "disconnected" || status.Detail != "reconnecting" {
+		t.Errorf("Supervise() left status %+v after a session ended", status)
+	}
+	connectedMu.Lock()
+	defer connectedMu.Unlock()
+	if !connected["supervised"] {
+		t.Error("Supervise() did not record the connection being up")
+	}
+}
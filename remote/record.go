@@ -0,0 +1,133 @@
+package remote
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/utils"
+)
+
+// redacted replaces the secrets in recorded payloads
+const redacted = "[REDACTED]"
+
+// secretFields are the fields of payloads whose values are always secret, e.g. Slack's verification token
+var secretFields = regexp.MustCompile(`(?i)token|secret|password|passwd|authorization|api_?key|credential|cookie|signature`)
+
+// recordMu keeps the lines of recordings from getting mixed up, since remotes record concurrently
+var recordMu sync.Mutex
+
+// Recording is a payload a remote received, e.g. a Slack event, as recorded with 'record_traffic'
+type Recording struct {
+	Time    time.Time       `json:"time"`
+	Bot     string          `json:"bot"`
+	BotID   string          `json:"bot_id,omitempty"` // the bot's user ID in the chat application
+	Remote  string          `json:"remote"`           // e.g. 'slack'
+	Kind    string          `json:"kind"`             // e.g. 'event', 'rtm', or 'interaction'
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Replayer is implemented by remotes whose recorded payloads can be replayed. Replay turns a recording
+// into the message the remote would have read, if the payload was one.
+type Replayer interface {
+	Replay(recording Recording, bot *models.Bot) (models.Message, bool, error)
+}
+
+// Record appends a payload a remote received to the bot's recording, with 'record_traffic' in
+// bot.yml, to reproduce problems with it later with 'flottbot replay'. The payload is either the
+// raw JSON the remote received, or a value to encode as JSON. Secrets are removed from it: the
+// values of fields like 'token', and whatever the bot redacts from its output.
+func Record(bot *models.Bot, remoteName, kind string, payload interface{}) {
+	if !bot.RecordTraffic {
+		return
+	}
+
+	raw, ok := payload.([]byte)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(payload); err != nil {
+			bot.Log.Errorf("Could not record %s %s: %s", remoteName, kind, err.Error())
+			return
+		}
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		bot.Log.Errorf("Could not record %s %s: %s", remoteName, kind, err.Error())
+		return
+	}
+	sanitized, err := json.Marshal(sanitize(value))
+	if err != nil {
+		bot.Log.Errorf("Could not record %s %s: %s", remoteName, kind, err.Error())
+		return
+	}
+
+	line, err := json.Marshal(Recording{Time: time.Now(), Bot: bot.Name, BotID: bot.ID, Remote: remoteName, Kind: kind, Payload: sanitized})
+	if err != nil {
+		bot.Log.Errorf("Could not record %s %s: %s", remoteName, kind, err.Error())
+		return
+	}
+
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	f, err := os.OpenFile(bot.RecordFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		bot.Log.Errorf("Could not record %s %s: %s", remoteName, kind, err.Error())
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		bot.Log.Errorf("Could not record %s %s: %s", remoteName, kind, err.Error())
+	}
+}
+
+// ReadRecordings reads the payloads recorded in a file, oldest first
+func ReadRecordings(file string) ([]Recording, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	recordings := []Recording{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var recording Recording
+		if err := json.Unmarshal(scanner.Bytes(), &recording); err != nil {
+			return nil, fmt.Errorf("Could not read line %d of '%s': %s", line, file, err.Error())
+		}
+		recordings = append(recordings, recording)
+	}
+	return recordings, scanner.Err()
+}
+
+// sanitize removes the secrets from a decoded JSON value
+func sanitize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if _, ok := field.(string); ok && secretFields.MatchString(key) {
+				v[key] = redacted
+				continue
+			}
+			v[key] = sanitize(field)
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = sanitize(v[i])
+		}
+		return v
+	case string:
+		return utils.Redact(v)
+	}
+	return value
+}
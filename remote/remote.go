@@ -22,6 +22,42 @@ type Remote interface {
 	Send(message models.Message, bot *models.Bot)
 
 	InteractiveComponents(inputMsgs chan<- models.Message, message *models.Message, rule models.Rule, bot *models.Bot)
+
+	Capabilities() Capabilities
+}
+
+// Capabilities are the features of its chat application a remote supports. What the bot sends is
+// adapted to the ones it lacks (see core/degrade.go), rather than features silently going missing.
+type Capabilities struct {
+	Threads     bool // replies in threads
+	Ephemeral   bool // messages only the user who triggered them sees
+	Attachments bool // rich attachments, e.g. with buttons
+	Reactions   bool // emoji reactions to messages
+	Files       bool // uploading files
+	Editing     bool // editing messages the bot sent
+}
+
+// ChannelManager is implemented by remotes that can set up channels, e.g. for the incident module
+type ChannelManager interface {
+	// CreateChannel creates a public channel and returns its ID
+	CreateChannel(name string, bot *models.Bot) (string, error)
+
+	// Invite adds users (by name, email, or ID) to a channel
+	Invite(channel string, users []string, bot *models.Bot) error
+
+	// Pin posts a message in a channel and pins it
+	Pin(channel, text string, bot *models.Bot) error
+}
+
+// MessageEditor is implemented by remotes that can edit the messages the bot posts, e.g. to count
+// repeated alerts in the message their follow-ups are threaded under
+type MessageEditor interface {
+	// PostMessage posts text in a channel, in the thread of the message with ID threadID unless it's
+	// empty, and returns the ID of the message
+	PostMessage(channel, threadID, text string, bot *models.Bot) (string, error)
+
+	// EditMessage replaces the text of a message the bot posted
+	EditMessage(channel, id, text string, bot *models.Bot) error
 }
 
 // Reaction enables the bot to add emoji reactions to messages
@@ -39,6 +75,11 @@ func Send(c context.Context, message models.Message, bot *models.Bot) {
 	FromContext(c).Send(message, bot)
 }
 
+// GetCapabilities tells which features of its chat application a remote supports
+func GetCapabilities(c context.Context) Capabilities {
+	return FromContext(c).Capabilities()
+}
+
 // InteractiveComponents enables the bot to listen to Interactive Components coming from a remote
 func InteractiveComponents(c context.Context, inputMsgs chan<- models.Message, message *models.Message, rule models.Rule, bot *models.Bot) {
 	FromContext(c).InteractiveComponents(inputMsgs, message, rule, bot)
@@ -3,13 +3,18 @@ package scheduler
 import (
 	"fmt"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/robfig/cron"
 	"github.com/target/flottbot/models"
 	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/storage"
+	"github.com/target/flottbot/tracing"
 )
 
+// leaseTTL is how long the scheduler lease is held without being renewed
+const leaseTTL = 30 * time.Second
+
 // Client struct
 type Client struct {
 }
@@ -34,6 +39,24 @@ func (c *Client) Read(inputMsgs chan<- models.Message, rules map[string]models.R
 			break
 		}
 	}
+	// When several replicas of the bot run, only the one holding the lease runs schedules
+	var lease *storage.Lease
+	if bot.HighAvailability {
+		lease = storage.NewLease(bot.Store, "scheduler", bot.InstanceID, leaseTTL)
+		go lease.Run(remote.Stopping(), func(held bool, err error) {
+			switch {
+			case err != nil:
+				bot.Log.Errorf("Scheduler could not renew its lease: %s", err.Error())
+			case held:
+				remote.SetStatus(remote.StatusName(bot, "scheduler"), "running", "leader")
+				bot.Log.Infof("Instance '%s' is now running schedules", bot.InstanceID)
+			default:
+				remote.SetStatus(remote.StatusName(bot, "scheduler"), "standby", "another replica runs schedules")
+				bot.Log.Infof("Instance '%s' stopped running schedules", bot.InstanceID)
+			}
+		})
+	}
+
 	// Create a list of cron jobs to execute
 	jobs := []*cron.Cron{}
 
@@ -56,20 +79,18 @@ func (c *Client) Read(inputMsgs chan<- models.Message, rules map[string]models.R
 
 			bot.Log.Debugf("Scheduler is running rule '%s'", rule.Name)
 			cron := cron.New()
-			scheduleName := rule.Name
-			input := fmt.Sprintf("<@%s> ", bot.ID) // send message as self
-			outputRooms := rule.OutputToRooms
-			outputUsers := rule.OutputToUsers
+			scheduleRule := rule
 			cron.AddFunc(rule.Schedule, func() {
-				// Build message
-				message := models.NewMessage()
-				message.Service = models.MsgServiceScheduler
-				message.Input = input // send message as self
-				message.Attributes["from_schedule"] = scheduleName
-				message.Type = models.MsgTypeChannel
-				message.OutputToRooms = outputRooms
-				message.OutputToUsers = outputUsers
-				inputMsgs <- message
+				// Another replica of the bot is running schedules
+				if lease != nil && !lease.Held() {
+					return
+				}
+				// Paused schedules keep ticking but don't produce messages
+				if IsPaused(scheduleRule.Name, bot) {
+					bot.Log.Debugf("Schedule '%s' is paused, skipping", scheduleRule.Name)
+					return
+				}
+				inputMsgs <- NewMessage(scheduleRule, bot)
 			})
 			jobs = append(jobs, cron)
 		}
@@ -77,10 +98,32 @@ func (c *Client) Read(inputMsgs chan<- models.Message, rules map[string]models.R
 
 	if len(jobs) == 0 {
 		bot.Log.Warn("Found no schedule-type rules. Scheduler is closing")
+		remote.SetStatus(remote.StatusName(bot, "scheduler"), "idle", "no schedule-type rules")
 		return
 	}
 
+	if !bot.HighAvailability {
+		remote.SetStatus(remote.StatusName(bot, "scheduler"), "running", "")
+	}
 	processJobs(jobs, bot)
+	remote.SetStatus(remote.StatusName(bot, "scheduler"), "stopped", "")
+}
+
+// NewMessage builds the message that triggers the given schedule-type rule
+func NewMessage(rule models.Rule, bot *models.Bot) models.Message {
+	message := models.NewMessage()
+	message.Service = models.MsgServiceScheduler
+	message.Input = fmt.Sprintf("<@%s> ", bot.ID) // send message as self
+	message.Attributes["from_schedule"] = rule.Name
+	message.Type = models.MsgTypeChannel
+	message.OutputToRooms = rule.OutputToRooms
+	message.OutputToUsers = rule.OutputToUsers
+
+	span := tracing.Start("", "scheduler.trigger")
+	span.SetAttribute("schedule.name", rule.Name)
+	message.TraceParent = span.TraceParent()
+	span.End()
+	return message
 }
 
 // Send implementation to satisfy remote interface
@@ -88,6 +131,12 @@ func (c *Client) Send(message models.Message, bot *models.Bot) {
 	// not implemented for Scheduler
 }
 
+// Capabilities implementation to satisfy remote interface, scheduled messages are sent by the
+// chat application
+func (c *Client) Capabilities() remote.Capabilities {
+	return remote.Capabilities{}
+}
+
 // InteractiveComponents implementation to satisfy remote interface
 func (c *Client) InteractiveComponents(inputMsgs chan<- models.Message, message *models.Message, rule models.Rule, bot *models.Bot) {
 	// not implemented for Scheduler
@@ -95,15 +144,13 @@ func (c *Client) InteractiveComponents(inputMsgs chan<- models.Message, message
 
 // Process the Cron jobs
 func processJobs(jobs []*cron.Cron, bot *models.Bot) {
-	// Create wait group for cron jobs and execute them
-	wg := &sync.WaitGroup{}
-	wg.Add(len(jobs))
+	// Execute the cron jobs until the bot shuts down
 	for _, job := range jobs {
 		go func(c *cron.Cron) {
 			c.Start()
 		}(job)
 		defer job.Stop()
 	}
-	wg.Wait()
+	<-remote.Stopping()
 	bot.Log.Warn("Scheduler is closing")
 }
@@ -0,0 +1,28 @@
+package scheduler
+
+import (
+	"github.com/target/flottbot/models"
+)
+
+// pausedBucket is the storage bucket holding the names of paused schedules
+const pausedBucket = "paused_schedules"
+
+// IsPaused reports whether the schedule for the given rule name is paused
+func IsPaused(name string, bot *models.Bot) bool {
+	_, ok, err := bot.Store.Get(pausedBucket, name)
+	if err != nil {
+		bot.Log.Errorf("Could not check whether schedule '%s' is paused: %s", name, err.Error())
+		return false
+	}
+	return ok
+}
+
+// Pause stops the schedule for the given rule name from firing until it is resumed
+func Pause(name string, bot *models.Bot) error {
+	return bot.Store.Set(pausedBucket, name, []byte("paused"), 0)
+}
+
+// Resume lets a paused schedule for the given rule name fire again
+func Resume(name string, bot *models.Bot) error {
+	return bot.Store.Delete(pausedBucket, name)
+}
@@ -0,0 +1,30 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestPauseResume(t *testing.T) {
+	testBot := new(models.Bot)
+	testBot.Store = memory.New()
+
+	if err := Pause("sched1", testBot); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	if !IsPaused("sched1", testBot) {
+		t.Error("IsPaused() = false, want true after Pause()")
+	}
+	if IsPaused("sched2", testBot) {
+		t.Error("IsPaused() = true for a schedule that was never paused")
+	}
+
+	if err := Resume("sched1", testBot); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if IsPaused("sched1", testBot) {
+		t.Error("IsPaused() = true, want false after Resume()")
+	}
+}
@@ -0,0 +1,91 @@
+package remote
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/target/flottbot/models"
+)
+
+// server is an HTTP server started with ListenAndServe
+type server struct {
+	*http.Server
+	reader bool // messages are read from the server, e.g. Slack's Events API
+}
+
+var (
+	serversMu sync.Mutex
+	servers   []server
+	stopping  = make(chan struct{})
+	stopOnce  sync.Once
+)
+
+// ListenAndServe serves HTTP requests like http.ListenAndServe, but lets the bot shut the server down
+// gracefully. The servers of readers are shut down as soon as the bot stops reading messages,
+// the others (e.g. metrics) once everything read has been handled. Requests pass the checks
+// 'http_auth' configures for the server's name (see Authenticate) first, and are bounded by
+// 'http_limits' (see Limits).
+func ListenAndServe(name, addr string, handler http.Handler, reader bool, bot *models.Bot) error {
+	handler, err := Authenticate(name, handler, bot)
+	if err != nil {
+		bot.Log.Errorf("HTTP server '%s' not started: %s", name, err.Error())
+		return err
+	}
+	limits, err := ParseLimits(bot.HTTPLimits)
+	if err != nil {
+		bot.Log.Errorf("HTTP server '%s' not started: %s", name, err.Error())
+		return err
+	}
+
+	srv := &http.Server{Addr: addr, Handler: limitBody(name, limits.MaxBodyBytes, handler, bot)}
+	limits.configure(srv)
+	serversMu.Lock()
+	servers = append(servers, server{Server: srv, reader: reader})
+	serversMu.Unlock()
+
+	err = srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Stopping is closed once the bot starts shutting down; remotes stop reading messages when it is
+func Stopping() <-chan struct{} {
+	return stopping
+}
+
+// StopReaders tells the remotes to stop reading messages, and shuts down the servers messages are read from
+func StopReaders(ctx context.Context) error {
+	stopOnce.Do(func() { close(stopping) })
+	return shutdownServers(ctx, true)
+}
+
+// ShutdownServers shuts down the remaining HTTP servers, waiting for the requests they're handling
+func ShutdownServers(ctx context.Context) error {
+	return shutdownServers(ctx, false)
+}
+
+// shutdownServers shuts down the servers of readers, or all remaining ones
+func shutdownServers(ctx context.Context, readersOnly bool) error {
+	serversMu.Lock()
+	var remaining, closing []server
+	for _, srv := range servers {
+		if readersOnly && !srv.reader {
+			remaining = append(remaining, srv)
+			continue
+		}
+		closing = append(closing, srv)
+	}
+	servers = remaining
+	serversMu.Unlock()
+
+	var firstErr error
+	for _, srv := range closing {
+		if err := srv.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
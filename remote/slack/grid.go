@@ -0,0 +1,171 @@
+package slack
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+
+	"github.com/target/flottbot/models"
+)
+
+// workspace is where an event of the Events API happened. On Enterprise Grid, and in channels shared with
+// other organizations, the sender of a message can be in another workspace than the one the event is for.
+type workspace struct {
+	TeamID       string `json:"team_id"`
+	EnterpriseID string `json:"enterprise_id"`
+	// Slack tells whether the channel is shared with another organization, in newer payloads only
+	ExtShared *bool `json:"is_ext_shared_channel"`
+	Event     struct {
+		Team       string `json:"team"`
+		UserTeam   string `json:"user_team"`
+		SourceTeam string `json:"source_team"`
+	} `json:"event"`
+}
+
+// parseWorkspace parses where an event of the Events API happened
+func parseWorkspace(body []byte) workspace {
+	var ws workspace
+	if err := json.Unmarshal(body, &ws); err != nil {
+		return workspace{}
+	}
+	return ws
+}
+
+// senderTeam is the workspace the sender of the event is in
+func (ws workspace) senderTeam() string {
+	for _, team := range []string{ws.Event.UserTeam, ws.Event.Team, ws.TeamID} {
+		if len(team) > 0 {
+			return team
+		}
+	}
+	return ""
+}
+
+// workspaceToken is the workspace token of the first of the teams that has one in bot.yml's
+// 'slack_workspace_tokens', by team or enterprise ID, or else 'slack_workspace_token'
+func workspaceToken(bot *models.Bot, teams ...string) string {
+	for _, team := range teams {
+		if token, ok := bot.SlackWorkspaceTokens[team]; ok && len(team) > 0 {
+			return token
+		}
+	}
+	return bot.SlackWorkspaceToken
+}
+
+// workspaceUsers looks up Slack users with the token of the workspace they're in, before the bot's own,
+// so users of the other workspaces of an Enterprise Grid org aren't missing
+type workspaceUsers struct {
+	api   userInfoGetter
+	teams []string
+	bot   *models.Bot
+	// newAPI creates the client for a token, tests replace it
+	newAPI func(token string) userInfoGetter
+}
+
+// usersOf creates what looks up the users of a workspace
+func usersOf(api userInfoGetter, ws workspace, bot *models.Bot) userInfoGetter {
+	if len(bot.SlackWorkspaceTokens) == 0 {
+		return api
+	}
+	return workspaceUsers{
+		api:    api,
+		teams:  []string{ws.senderTeam(), ws.TeamID, ws.EnterpriseID},
+		bot:    bot,
+		newAPI: func(token string) userInfoGetter { return slack.New(token) },
+	}
+}
+
+// GetUserInfo implementation to satisfy the userInfoGetter interface
+func (w workspaceUsers) GetUserInfo(userID string) (*slack.User, error) {
+	tried := make(map[string]bool)
+	for _, team := range w.teams {
+		token, ok := w.bot.SlackWorkspaceTokens[team]
+		if !ok || len(team) == 0 || tried[token] {
+			continue
+		}
+		tried[token] = true
+		user, err := w.newAPI(token).GetUserInfo(userID)
+		if err == nil {
+			return user, nil
+		}
+		w.bot.Log.Debugf("Could not look up Slack user '%s' in workspace '%s': %s", userID, team, err.Error())
+	}
+	return w.api.GetUserInfo(userID)
+}
+
+// channelInfoGetter looks up Slack channels, e.g. a *slack.Client
+type channelInfoGetter interface {
+	GetConversationInfo(channelID string, includeLocale bool) (*slack.Channel, error)
+}
+
+// sharedChannels remembers which channels are shared with other workspaces or organizations, as long
+// as Slack users are remembered
+var sharedChannels = struct {
+	sync.Mutex
+	channels map[string]cachedChannel
+}{channels: make(map[string]cachedChannel)}
+
+// cachedChannel is whether a channel is shared, remembered until it expires
+type cachedChannel struct {
+	shared  bool
+	expires time.Time
+}
+
+// rtmWorkspace is where a message read from RTM was sent; RTM only tells the workspace of the sender
+func rtmWorkspace(ev *slack.MessageEvent) workspace {
+	ws := workspace{TeamID: ev.Team}
+	ws.Event.Team = ev.Team
+	return ws
+}
+
+// isSharedChannel determines whether a channel is shared with other workspaces or organizations
+func isSharedChannel(api channelInfoGetter, channel string, bot *models.Bot) bool {
+	now := time.Now()
+	sharedChannels.Lock()
+	cached, ok := sharedChannels.channels[channel]
+	sharedChannels.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.shared
+	}
+
+	info, err := api.GetConversationInfo(channel, false)
+	if err != nil {
+		bot.Log.Debugf("Could not look up whether channel '%s' is shared: %s", channel, err.Error())
+		return false
+	}
+	shared := info.IsShared || info.IsExtShared
+	if ttl := userCacheTTL(bot); ttl > 0 {
+		sharedChannels.Lock()
+		sharedChannels.channels[channel] = cachedChannel{shared: shared, expires: now.Add(ttl)}
+		sharedChannels.Unlock()
+	}
+	return shared
+}
+
+// tagWorkspace lets rules know where a message was sent, as ${_team.id}, ${_enterprise.id}, ${_user.team},
+// and ${_channel.is_shared}, and has answers to it use the token of its workspace
+func tagWorkspace(message *models.Message, ws workspace, channels channelInfoGetter, bot *models.Bot) {
+	if message.Service != models.MsgServiceChat {
+		return
+	}
+	message.Vars["_team.id"] = ws.TeamID
+	message.Vars["_enterprise.id"] = ws.EnterpriseID
+	message.Vars["_user.team"] = ws.senderTeam()
+	message.Attributes["ws_token"] = workspaceToken(bot, ws.TeamID, ws.EnterpriseID)
+
+	shared := false
+	switch {
+	case message.Type == models.MsgTypeDirect:
+	case ws.ExtShared != nil && *ws.ExtShared:
+		shared = true
+	case len(ws.Event.SourceTeam) > 0 && ws.Event.SourceTeam != ws.TeamID:
+		// Messages sent from another workspace can only be in shared channels
+		shared = true
+	case channels != nil:
+		shared = isSharedChannel(channels, message.ChannelID, bot)
+	}
+	message.Vars["_channel.is_shared"] = strconv.FormatBool(shared)
+}
@@ -0,0 +1,113 @@
+package slack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nlopes/slack"
+	"github.com/sirupsen/logrus"
+
+	"github.com/target/flottbot/models"
+)
+
+// fakeChannels knows which channels are shared
+type fakeChannels struct {
+	shared map[string]bool
+}
+
+func (f fakeChannels) GetConversationInfo(channel string, includeLocale bool) (*slack.Channel, error) {
+	shared, ok := f.shared[channel]
+	if !ok {
+		return nil, errors.New("channel_not_found")
+	}
+	info := &slack.Channel{}
+	info.IsExtShared = shared
+	return info, nil
+}
+
+// teamUsers knows the users of one workspace
+type teamUsers struct {
+	users map[string]bool
+}
+
+func (f teamUsers) GetUserInfo(user string) (*slack.User, error) {
+	if !f.users[user] {
+		return nil, errors.New("user_not_found")
+	}
+	return &slack.User{ID: user}, nil
+}
+
+func TestTagWorkspace(t *testing.T) {
+	bot := &models.Bot{SlackWorkspaceToken: "xoxp-main", SlackWorkspaceTokens: map[string]string{"T2": "xoxp-sales"}}
+	bot.Log = *logrus.New()
+	channels := fakeChannels{shared: map[string]bool{"CSHARED": true, "CLOCAL": false}}
+
+	tests := []struct {
+		name       string
+		payload    string
+		channel    string
+		msgType    models.MessageType
+		wantTeam   string
+		wantUser   string
+		wantShared string
+		wantToken  string
+	}{
+		{"Single workspace", `{"team_id":"T1","event":{"type":"message"}}`, "CLOCAL", models.MsgTypeChannel, "T1", "T1", "false", "xoxp-main"},
+		{"Looked up shared channel", `{"team_id":"T1","event":{"type":"message"}}`, "CSHARED", models.MsgTypeChannel, "T1", "T1", "true", "xoxp-main"},
+		{"Shared according to the payload", `{"team_id":"T1","is_ext_shared_channel":true,"event":{}}`, "CUNKNOWN", models.MsgTypeChannel, "T1", "T1", "true", "xoxp-main"},
+		{"Sent from another workspace", `{"team_id":"T1","event":{"user_team":"T3","source_team":"T3"}}`, "CUNKNOWN", models.MsgTypeChannel, "T1", "T3", "true", "xoxp-main"},
+		{"Grid workspace with its own token", `{"team_id":"T2","enterprise_id":"E1","event":{"team":"T2"}}`, "CLOCAL", models.MsgTypeChannel, "T2", "T2", "false", "xoxp-sales"},
+		{"Direct message", `{"team_id":"T1","event":{}}`, "DCHAT", models.MsgTypeDirect, "T1", "T1", "false", "xoxp-main"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := models.NewMessage()
+			message.Service = models.MsgServiceChat
+			message.Type = tt.msgType
+			message.ChannelID = tt.channel
+			tagWorkspace(&message, parseWorkspace([]byte(tt.payload)), channels, bot)
+			if message.Vars["_team.id"] != tt.wantTeam || message.Vars["_user.team"] != tt.wantUser || message.Vars["_channel.is_shared"] != tt.wantShared {
+				t.Errorf("tagWorkspace() team %q, user team %q, shared %q, want %q, %q, %q",
+					message.Vars["_team.id"], message.Vars["_user.team"], message.Vars["_channel.is_shared"], tt.wantTeam, tt.wantUser, tt.wantShared)
+			}
+			if message.Attributes["ws_token"] != tt.wantToken {
+				t.Errorf("tagWorkspace() token %q, want %q", message.Attributes["ws_token"], tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestWorkspaceUsers(t *testing.T) {
+	bot := &models.Bot{SlackWorkspaceTokens: map[string]string{"T2": "xoxp-sales", "E1": "xoxp-org"}}
+	bot.Log = *logrus.New()
+	workspaces := map[string]teamUsers{
+		"xoxp-sales": {users: map[string]bool{"W2": true}},
+		"xoxp-org":   {users: map[string]bool{"W2": true, "W3": true}},
+	}
+	own := teamUsers{users: map[string]bool{"U1": true}}
+
+	tests := []struct {
+		name    string
+		payload string
+		user    string
+		wantErr bool
+	}{
+		{"User of the bot's workspace", `{"team_id":"T1"}`, "U1", false},
+		{"User of another grid workspace", `{"team_id":"T1","event":{"user_team":"T2"}}`, "W2", false},
+		{"User only the org token finds", `{"team_id":"T2","enterprise_id":"E1"}`, "W3", false},
+		{"Unknown user", `{"team_id":"T2","enterprise_id":"E1"}`, "W4", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := usersOf(own, parseWorkspace([]byte(tt.payload)), bot).(workspaceUsers)
+			api.newAPI = func(token string) userInfoGetter { return workspaces[token] }
+			user, err := api.GetUserInfo(tt.user)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetUserInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && user.ID != tt.user {
+				t.Errorf("GetUserInfo() = %+v", user)
+			}
+		})
+	}
+}
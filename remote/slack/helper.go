@@ -6,13 +6,18 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/nlopes/slack"
 	"github.com/nlopes/slack/slackevents"
 	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/tracing"
 	"github.com/target/flottbot/utils"
 )
 
@@ -22,6 +27,12 @@ Slack helper functions (anything that uses the 'nlopes/slack' package)
 ======================================================================
 */
 
+// interactionsBucket is the storage bucket correlating interactive component callbacks with the rules that sent them
+const interactionsBucket = "slack_interactions"
+
+// interactionsTTL is how long a sent interactive component can be correlated with its rule
+const interactionsTTL = 24 * time.Hour
+
 // constructInteractiveComponentMessage creates a message specifically for a matched rule from the Interactive Components server
 func constructInteractiveComponentMessage(callback slack.AttachmentActionCallback, bot *models.Bot) models.Message {
 	text := ""
@@ -62,10 +73,32 @@ func constructInteractiveComponentMessage(callback slack.AttachmentActionCallbac
 	if msgType == models.MsgTypePrivateChannel {
 		channel = callback.Channel.ID
 	}
-	contents, mentioned := removeBotMention(text, bot.ID)
+	contents, mentioned := removeBotMention(text, bot.ID, bot.MentionPrefixes)
 	return populateMessage(message, messageType, channel, contents, callback.MessageTs, callback.MessageTs, mentioned, user, bot)
 }
 
+// readInteraction creates the message for the bot to process from a user's interaction with a component
+func readInteraction(callback slack.AttachmentActionCallback, bot *models.Bot) models.Message {
+	message := constructInteractiveComponentMessage(callback, bot)
+	// Let rules know which rule sent the component the user interacted with
+	origin, ok, err := bot.Store.Get(interactionsBucket, callback.CallbackID)
+	if err != nil {
+		bot.Log.Errorf("getInteractiveComponentRuleHandler: Could not look up interaction: %s", err.Error())
+	}
+	if ok {
+		message.Vars["_interaction.rule"] = string(origin)
+	}
+	return message
+}
+
+// interactionKey identifies a user's interaction with a component, so retries of it can be recognized
+func interactionKey(callback slack.AttachmentActionCallback) string {
+	if len(callback.TriggerID) > 0 {
+		return callback.TriggerID
+	}
+	return callback.CallbackID + "/" + callback.User.ID + "/" + callback.ActionTs
+}
+
 // getEventsAPIHealthHandler creates and returns the handler for health checks on the Slack Events API reader
 func getEventsAPIHealthHandler(bot *models.Bot) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -100,45 +133,221 @@ func handleURLVerification(body string, w http.ResponseWriter, r *http.Request)
 	sendHTTPResponse(statusCode, "", slackResponse.Challenge, w, r)
 }
 
-func handleCallBack(api *slack.Client, event slackevents.EventsAPIInnerEvent, bot *models.Bot, inputMsgs chan<- models.Message, w http.ResponseWriter, r *http.Request) {
+func handleCallBack(api *slack.Client, event slackevents.EventsAPIInnerEvent, ws workspace, bot *models.Bot, inputMsgs chan<- models.Message, w http.ResponseWriter, r *http.Request) {
 	// write back to the event to ensure the event does not trigger again
 	sendHTTPResponse(http.StatusOK, "", "{}", w, r)
 
 	// process the event
 	bot.Log.Debugf("getEventsAPIEventHandler: Received event '%s'", event.Type)
+	if message, ok := readEvent(api, event, ws, bot); ok {
+		inputMsgs <- message
+	}
+}
+
+// readEvent handles an event of the Events API that happened in a workspace, and returns the message for
+// the bot to process if it's one
+func readEvent(api *slack.Client, event slackevents.EventsAPIInnerEvent, ws workspace, bot *models.Bot) (models.Message, bool) {
 	switch ev := event.Data.(type) {
 	// There are Events API specific MessageEvents
 	// https://api.slack.com/events/message.channels
 	case *slackevents.MessageEvent:
-		senderID := ev.User
-		// Only process messages that aren't from the bot itself
-		if len(senderID) > 0 && bot.ID != senderID {
-			channel := ev.Channel
-			msgType, err := getMessageType(channel)
-			if err != nil {
-				bot.Log.Debug(err.Error())
-			}
-			text, mentioned := removeBotMention(ev.Text, bot.ID)
-			user, err := api.GetUserInfo(senderID)
-			if err != nil && len(senderID) > 0 { // we only care if senderID is not empty and there's an error (senderID == "" could be a thread from a message)
-				bot.Log.Errorf("getEventsAPIEventHandler: Did not get Slack user info: %s", err.Error())
-			}
-			timestamp := ev.TimeStamp
-			threadTimestamp := ev.ThreadTimeStamp
-			inputMsgs <- populateMessage(models.NewMessage(), msgType, channel, text, timestamp, threadTimestamp, mentioned, user, bot)
+		message, ok := readEventsMessage(usersOf(api, ws, bot), ev, bot)
+		if ok {
+			tagWorkspace(&message, ws, api, bot)
 		}
+		return message, ok
+	// A user changed their profile, look them up again next time
+	case *slack.UserChangeEvent:
+		forgetUser(ev.User.ID)
 	// This is an Event shared between RTM and the Events API
 	case *slack.MemberJoinedChannelEvent:
 		// get bot rooms
 		bot.Rooms = getRooms(api)
-		bot.Log.Debugf("%s has joined the channel %s", bot.Name, bot.Rooms[ev.Channel])
+		if ev.User == bot.ID {
+			bot.Log.Debugf("%s has joined the channel %s", bot.Name, ev.Channel)
+			return readChannelEvent(api, models.MsgEventJoined, ev.Channel, ev.Inviter, bot)
+		}
 	case *slack.MemberLeftChannelEvent:
-		// remove room
-		delete(bot.Rooms, ev.Channel)
-		bot.Log.Debugf("%s has left the channel %s", bot.Name, bot.Rooms[ev.Channel])
+		if ev.User == bot.ID {
+			bot.Log.Debugf("%s has left the channel %s", bot.Name, ev.Channel)
+			message, ok := readChannelEvent(api, models.MsgEventLeft, ev.Channel, "", bot)
+			// remove room
+			removeRoom(ev.Channel, bot)
+			return message, ok
+		}
 	default:
 		bot.Log.Errorf("getEventsAPIEventHandler: Unrecognized event type")
 	}
+	return models.Message{}, false
+}
+
+// readMessage creates the message for the bot to process from a message a user sent, and the files they
+// shared with it. Messages without a sender (e.g. some thread updates) and the bot's own messages are skipped.
+func readMessage(api userInfoGetter, senderID, channel, text, timestamp, threadTimestamp string, files []models.File, bot *models.Bot) (models.Message, bool) {
+	if len(senderID) == 0 || bot.ID == senderID {
+		return models.Message{}, false
+	}
+	remote.RememberMessage("slack", channel, timestamp, remote.Recent{UserID: senderID, Text: text, Thread: threadTimestamp})
+	msgType, err := getMessageType(channel)
+	if err != nil {
+		bot.Log.Debug(err.Error())
+	}
+	text, mentioned := removeBotMention(text, bot.ID, bot.MentionPrefixes)
+	user, err := getUserInfo(api, senderID, bot)
+	if err != nil {
+		bot.Log.Errorf("Did not get Slack user info: %s", err.Error())
+	}
+	message := populateMessage(models.NewMessage(), msgType, channel, text, timestamp, threadTimestamp, mentioned, user, bot)
+	message.Files = files
+	return message, true
+}
+
+// readMessageEvent creates the message for the bot to process from a message event of the RTM API: a
+// message a user sent, edited ('message_changed'), or deleted ('message_deleted')
+func readMessageEvent(api userInfoGetter, ev *slack.MessageEvent, bot *models.Bot) (models.Message, bool) {
+	switch ev.SubType {
+	case "message_changed":
+		if ev.SubMessage == nil {
+			return models.Message{}, false
+		}
+		edit := remote.Recent{UserID: ev.SubMessage.User, Text: ev.SubMessage.Text, Thread: ev.SubMessage.ThreadTimestamp}
+		return readChange(api, ev.Channel, ev.SubMessage.Timestamp, &edit, remote.Recent{}, bot)
+	case "message_deleted":
+		return readChange(api, ev.Channel, ev.DeletedTimestamp, nil, remote.Recent{}, bot)
+	}
+	return readMessage(api, ev.User, ev.Channel, ev.Text, ev.Timestamp, ev.ThreadTimestamp, messageFiles(ev.Files), bot)
+}
+
+// readEventsMessage creates the message for the bot to process from a message event of the Events API,
+// which also tells what an edited or deleted message said before
+func readEventsMessage(api userInfoGetter, ev *slackevents.MessageEvent, bot *models.Bot) (models.Message, bool) {
+	previous, timestamp := remote.Recent{}, ""
+	if ev.PreviousMessage != nil {
+		previous = remote.Recent{UserID: ev.PreviousMessage.User, Text: ev.PreviousMessage.Text, Thread: ev.PreviousMessage.ThreadTimeStamp}
+		timestamp = ev.PreviousMessage.TimeStamp
+	}
+	switch ev.SubType {
+	case "message_changed":
+		if ev.Message == nil {
+			return models.Message{}, false
+		}
+		edit := remote.Recent{UserID: ev.Message.User, Text: ev.Message.Text, Thread: ev.Message.ThreadTimeStamp}
+		return readChange(api, ev.Channel, ev.Message.TimeStamp, &edit, previous, bot)
+	case "message_deleted":
+		return readChange(api, ev.Channel, timestamp, nil, previous, bot)
+	}
+	return readMessage(api, ev.User, ev.Channel, ev.Text, ev.TimeStamp, ev.ThreadTimeStamp, eventFiles(ev.Files), bot)
+}
+
+// readChange creates the message for the bot to process from a message a user edited, or deleted when
+// there's no edit. What it said before is ${_previous_text}, if Slack tells or the bot saw it being sent;
+// deleted messages the bot knows nothing about are skipped.
+func readChange(api userInfoGetter, channel, timestamp string, edit *remote.Recent, previous remote.Recent, bot *models.Bot) (models.Message, bool) {
+	if len(previous.UserID) == 0 {
+		previous, _ = remote.RecallMessage("slack", channel, timestamp)
+	}
+	event, current := models.MsgEventDeleted, previous
+	if edit != nil {
+		// Slack also says a message changed when it unfurls its links
+		if edit.Text == previous.Text {
+			return models.Message{}, false
+		}
+		event, current = models.MsgEventEdited, *edit
+	}
+	message, ok := readMessage(api, current.UserID, channel, current.Text, timestamp, current.Thread, nil, bot)
+	if !ok {
+		return message, false
+	}
+	message.Event = event
+	message.Vars["_previous_text"], _ = removeBotMention(previous.Text, bot.ID, bot.MentionPrefixes)
+	return message, true
+}
+
+// readChannelEvent creates the message for the bot to process when it joins or leaves a channel, so
+// rules with 'events' can e.g. introduce the bot. The user is whoever invited the bot, if Slack tells.
+func readChannelEvent(api userInfoGetter, event models.MessageEvent, channel, userID string, bot *models.Bot) (models.Message, bool) {
+	msgType, err := getMessageType(channel)
+	if err != nil {
+		bot.Log.Debug(err.Error())
+		return models.Message{}, false
+	}
+	var user *slack.User
+	if len(userID) > 0 {
+		if user, err = getUserInfo(api, userID, bot); err != nil {
+			bot.Log.Errorf("Did not get Slack user info: %s", err.Error())
+		}
+	}
+	message := populateMessage(models.NewMessage(), msgType, channel, "", "", "", false, user, bot)
+	message.Event = event
+	message.Vars["_channel.id"] = channel
+	message.Vars["_channel.name"] = message.ChannelName
+	return message, true
+}
+
+// imOpener opens direct messages with Slack users, e.g. a *slack.Client
+type imOpener interface {
+	OpenIMChannel(user string) (bool, bool, string, error)
+}
+
+// readUserJoined creates the message for the bot to process when a user joins the workspace: a direct
+// message from them, so rules with 'events' can welcome them
+func readUserJoined(api imOpener, user *slack.User, bot *models.Bot) (models.Message, bool) {
+	if user.IsBot || len(user.ID) == 0 {
+		return models.Message{}, false
+	}
+	_, _, channel, err := api.OpenIMChannel(user.ID)
+	if err != nil {
+		bot.Log.Errorf("Could not open a direct message with new user %s: %s", user.ID, err.Error())
+		return models.Message{}, false
+	}
+	message := populateMessage(models.NewMessage(), models.MsgTypeDirect, channel, "", "", "", false, user, bot)
+	message.Event = models.MsgEventUserJoined
+	return message, true
+}
+
+// teamJoinEvent is a 'team_join' event of the Events API
+type teamJoinEvent struct {
+	Token   string `json:"token"`
+	EventID string `json:"event_id"`
+	Event   struct {
+		Type string     `json:"type"`
+		User slack.User `json:"user"`
+	} `json:"event"`
+}
+
+// parseTeamJoin parses a 'team_join' event of the Events API
+func parseTeamJoin(body []byte) (teamJoinEvent, bool) {
+	var event teamJoinEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.Event.Type != "team_join" {
+		return event, false
+	}
+	return event, true
+}
+
+// removeRoom forgets a channel the bot left
+func removeRoom(channel string, bot *models.Bot) {
+	if name, ok := findKey(bot.Rooms, channel); ok {
+		delete(bot.Rooms, name)
+	}
+}
+
+// messageFiles are the files shared with a message of the RTM API. They're private to the workspace,
+// so they're downloaded from their URL with the bot's token.
+func messageFiles(shared []slack.File) []models.File {
+	files := make([]models.File, 0, len(shared))
+	for _, file := range shared {
+		files = append(files, models.File{Name: file.Name, ContentType: file.Mimetype, URL: file.URLPrivateDownload})
+	}
+	return files
+}
+
+// eventFiles are the files shared with a message of the Events API
+func eventFiles(shared []slackevents.File) []models.File {
+	files := make([]models.File, 0, len(shared))
+	for _, file := range shared {
+		files = append(files, models.File{Name: file.Name, ContentType: file.Mimetype, URL: file.URLPrivateDownload})
+	}
+	return files
 }
 
 // getEventsAPIEventHandler creates and returns the handler for events coming from the the Slack Events API reader
@@ -152,8 +361,26 @@ func getEventsAPIEventHandler(api *slack.Client, vToken string, inputMsgs chan<-
 		}
 
 		buf := new(bytes.Buffer)
-		buf.ReadFrom(r.Body)
+		if _, err := buf.ReadFrom(r.Body); err != nil {
+			bot.Log.Errorf("Slack API Server: failed to read request body: %s", err.Error())
+			sendHTTPResponse(http.StatusBadRequest, "", "Could not read the request body", w, r)
+			return
+		}
 		body := buf.String()
+		remote.Record(bot, "slack", "event", buf.Bytes())
+		remote.Heard(remote.StatusName(bot, "slack"))
+
+		// Slack's events package doesn't know users joining the workspace
+		if event, ok := parseTeamJoin(buf.Bytes()); ok && event.Token == vToken {
+			sendHTTPResponse(http.StatusOK, "", "{}", w, r)
+			if remote.SeenEvent("slack", event.EventID, bot) {
+				return
+			}
+			if message, ok := readUserJoined(api, &event.Event.User, bot); ok {
+				inputMsgs <- message
+			}
+			return
+		}
 
 		eventsAPIEvent, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionVerifyToken(&slackevents.TokenComparator{VerificationToken: vToken}))
 		if err != nil {
@@ -170,7 +397,13 @@ func getEventsAPIEventHandler(api *slack.Client, vToken string, inputMsgs chan<-
 
 		// process the event
 		if eventsAPIEvent.Type == slackevents.CallbackEvent {
-			handleCallBack(api, eventsAPIEvent.InnerEvent, bot, inputMsgs, w, r)
+			// Slack retries events it thinks weren't received, e.g. when the bot was slow to respond
+			if cb, ok := eventsAPIEvent.Data.(*slackevents.EventsAPICallbackEvent); ok && remote.SeenEvent("slack", cb.EventID, bot) {
+				bot.Log.Debugf("Slack API Server: Skipping event %s, it was already received (retry %s)", cb.EventID, r.Header.Get("X-Slack-Retry-Num"))
+				sendHTTPResponse(http.StatusOK, "", "{}", w, r)
+				return
+			}
+			handleCallBack(api, eventsAPIEvent.InnerEvent, parseWorkspace(buf.Bytes()), bot, inputMsgs, w, r)
 		}
 	}
 }
@@ -206,6 +439,8 @@ func getInteractiveComponentRuleHandler(verificationToken string, inputMsgs chan
 		}
 
 		contents := sanitizeContents(buff)
+		remote.Record(bot, "slack", "interaction", []byte(contents))
+		remote.Heard(remote.StatusName(bot, "slack"))
 
 		var callback slack.AttachmentActionCallback
 		if err := json.Unmarshal([]byte(contents), &callback); err != nil {
@@ -225,9 +460,15 @@ func getInteractiveComponentRuleHandler(verificationToken string, inputMsgs chan
 			return
 		}
 
+		// Interactions retried by Slack are only acknowledged
+		if remote.SeenEvent("slack-interaction", interactionKey(callback), bot) {
+			bot.Log.Debugf("getInteractiveComponentRuleHandler: Skipping interaction %s, it was already received", interactionKey(callback))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
 		// Construct and send out message
-		message := constructInteractiveComponentMessage(callback, bot)
-		inputMsgs <- message
+		inputMsgs <- readInteraction(callback, bot)
 
 		// Respond
 		w.WriteHeader(http.StatusOK)
@@ -268,8 +509,13 @@ func getSlackUsers(api *slack.Client, message models.Message) ([]slack.User, err
 	return slackUsers, nil
 }
 
-// getUserID - returns the user's Slack user ID via email
+// getUserID - returns the user's Slack user ID via email, or the ID itself if it's given
 func getUserID(email string, users []slack.User, bot *models.Bot) string {
+	for _, u := range users {
+		if u.ID == email {
+			return u.ID
+		}
+	}
 	email = strings.ToLower(email)
 	for _, u := range users {
 		if strings.Contains(strings.ToLower(u.Profile.Email), email) {
@@ -302,31 +548,47 @@ func handleDirectMessage(api *slack.Client, message models.Message, bot *models.
 func handleNonDirectMessage(api *slack.Client, users []slack.User, message models.Message, bot *models.Bot) error {
 	// 'direct_message_only' is either 'false' OR
 	// 'direct_message_only' was probably never set
+	// Rooms and users are sent to at once, 'output_parallelism' of them at a time
+	var targets []string
+	sends := make(map[string]func() error)
 	// Is output to rooms set?
-	if len(message.OutputToRooms) > 0 {
-		for _, roomID := range message.OutputToRooms {
-			err := sendChannelMessage(api, roomID, message)
-			if err != nil {
-				return err
-			}
+	for _, roomID := range message.OutputToRooms {
+		roomID := roomID
+		if _, ok := sends[roomID]; ok {
+			continue
+		}
+		targets = append(targets, roomID)
+		sends[roomID] = func() error {
+			return sendChannelMessage(api, roomID, message)
 		}
 	}
 	// Is output to users set?
-	if len(message.OutputToUsers) > 0 {
-		for _, u := range message.OutputToUsers {
+	for _, u := range message.OutputToUsers {
+		u := u
+		if _, ok := sends[u]; ok {
+			continue
+		}
+		targets = append(targets, u)
+		sends[u] = func() error {
 			// Get users Slack user ID
 			userID := getUserID(u, users, bot)
-			if len(userID) > 0 {
-				// If 'direct_message_only' is 'false' but the user listed himself in the 'output_to_users'
-				if userID == message.Vars["_user.id"] && !message.DirectMessageOnly {
-					bot.Log.Warn("You have specified 'direct_message_only' as 'false' but listed yourself in 'output_to_users'")
-				}
-				// Respond back to these users via direct message
-				err := sendDirectMessage(api, userID, message)
-				if err != nil {
-					return err
-				}
+			if len(userID) == 0 {
+				return fmt.Errorf("Could not find user")
 			}
+			// If 'direct_message_only' is 'false' but the user listed himself in the 'output_to_users'
+			if userID == message.Vars["_user.id"] && !message.DirectMessageOnly {
+				bot.Log.Warn("You have specified 'direct_message_only' as 'false' but listed yourself in 'output_to_users'")
+			}
+			// Respond back to these users via direct message
+			return sendDirectMessage(api, userID, message)
+		}
+	}
+	if len(targets) > 0 {
+		errs := remote.FanOut(targets, bot.OutputParallelism, func(target string) error {
+			return sends[target]()
+		})
+		if len(errs) > 0 {
+			reportFanOutErrors(api, message, len(targets), errs, bot)
 		}
 	}
 	// Was there no specified output set?
@@ -383,7 +645,9 @@ func populateMessage(message models.Message, msgType models.MessageType, channel
 		message.Input = text
 		message.Output = ""
 		message.Timestamp = timeStamp
-		message.ThreadTimestamp = threadTimestamp
+		message.Time = slackTime(timeStamp)
+		message.ThreadID = threadTimestamp
+		message.ReplyToID = timeStamp
 		message.BotMentioned = mentioned
 		message.Attributes["ws_token"] = bot.SlackWorkspaceToken
 
@@ -404,9 +668,17 @@ func populateMessage(message models.Message, msgType models.MessageType, channel
 			message.Vars["_user.lastname"] = user.Profile.LastName
 			message.Vars["_user.name"] = user.Name
 			message.Vars["_user.id"] = user.ID
+			message.Vars["_user.locale"] = getUserLocale(user, bot)
+			message.Vars["_user.timezone"] = user.TZ
 		}
 
 		message.Debug = true // TODO: is this even needed?
+
+		// Start the message's trace; the span marks the moment the message was read
+		span := tracing.Start("", "slack.read")
+		span.SetAttribute("channel.id", channel)
+		message.TraceParent = span.TraceParent()
+		span.End()
 		return message
 	default:
 		bot.Log.Debugf("Read message of unsupported type '%T'. Unable to populate message attributes", msgType)
@@ -433,6 +705,10 @@ func processInteractiveComponentRule(rule models.Rule, message *models.Message,
 			}
 			message.Remotes.Slack.Attachments = config.Attachments
 			message.IsEphemeral = true // We default Slack Message attachment's as ephemeral
+			// Remember which rule sent the attachment so the callback can be correlated with it
+			if err := bot.Store.Set(interactionsBucket, message.ID, []byte(rule.Name), interactionsTTL); err != nil {
+				bot.Log.Errorf("Could not store interaction for rule '%s': %s", rule.Name, err.Error())
+			}
 		}
 	}
 }
@@ -450,44 +726,84 @@ func readFromEventsAPI(api *slack.Client, vToken string, inputMsgs chan<- models
 	router.HandleFunc(bot.SlackEventsCallbackPath, getEventsAPIEventHandler(api, vToken, inputMsgs, bot)).Methods("POST")
 
 	// Start listening to Slack events
-	go http.ListenAndServe(":3000", router)
+	go remote.ListenAndServe(remote.ServerEvents, bot.SlackEventsAddress, router, true, bot)
 
+	remote.SetStatus(remote.StatusName(bot, "slack"), "listening", "Events API")
 	bot.Log.Infof("Slack Events API server is listening to %s", bot.SlackEventsCallbackPath)
 }
 
+// rtmSilence is how long RTM may deliver no events, not even the replies to its pings, before its
+// connection is taken for dead and replaced
+const rtmSilence = 2 * time.Minute
+
 // readFromRTM utilizes the Slack API client to read messages via RTM.
 // This method of reading is not preferred and the event-based read should instead be used.
-func readFromRTM(rtm *slack.RTM, inputMsgs chan<- models.Message, bot *models.Bot) {
-	go rtm.ManageConnection()
+// The connection is supervised: when it ends or goes silent, a new one is made after a backoff.
+func readFromRTM(api *slack.Client, inputMsgs chan<- models.Message, bot *models.Bot) {
+	remote.Supervise("slack", func(up func()) error {
+		return readRTMSession(api.NewRTM(), up, inputMsgs, bot)
+	}, bot)
+}
+
+// readRTMSession reads from an RTM connection until it ends. The Slack package reconnects after
+// some failures itself; the session ends when it gives up, e.g. on invalid authorization, or when
+// the connection goes silent.
+func readRTMSession(rtm *slack.RTM, up func(), inputMsgs chan<- models.Message, bot *models.Bot) error {
+	managed := make(chan struct{})
+	go func() {
+		rtm.ManageConnection()
+		close(managed)
+	}()
+	silence := time.NewTimer(rtmSilence)
+	defer silence.Stop()
+
 	for {
 		select {
+		case <-remote.Stopping():
+			if err := rtm.Disconnect(); err != nil {
+				bot.Log.Errorf("Could not disconnect from Slack RTM: %s", err.Error())
+			}
+			remote.SetStatus(remote.StatusName(bot, "slack"), "disconnected", "shutting down")
+			return nil
+		case <-managed:
+			return fmt.Errorf("Slack RTM stopped connecting")
+		case <-silence.C:
+			abandonRTM(rtm, managed)
+			return fmt.Errorf("No events from Slack RTM for %s", rtmSilence)
 		case msg := <-rtm.IncomingEvents:
+			if !silence.Stop() {
+				<-silence.C
+			}
+			silence.Reset(rtmSilence)
+			// Any event, e.g. the latency reports of pings, shows the connection is alive
+			remote.Heard(remote.StatusName(bot, "slack"))
+			// The snapshot of the workspace sent when connecting is large, and of no use for replays
+			if _, ok := msg.Data.(*slack.ConnectedEvent); !ok {
+				remote.Record(bot, "slack", "rtm", msg)
+			}
 			switch ev := msg.Data.(type) {
 			case *slack.MessageEvent:
-				senderID := ev.User
 				// Sometimes message events in RTM don't have a User ID?
-				// Also, only process messages that aren't from the bot itself
-				if len(senderID) > 0 && bot.ID != senderID {
-					channel := ev.Channel
-					msgType, err := getMessageType(channel)
-					if err != nil {
-						bot.Log.Debug(err.Error())
-					}
-					text, mentioned := removeBotMention(ev.Text, bot.ID)
-					user, err := rtm.GetUserInfo(senderID)
-					if err != nil && len(senderID) > 0 { // we only care if senderID is not empty and there's an error (senderID == "" could be a thread from a message)
-						bot.Log.Errorf("Did not get Slack user info: %s", err.Error())
-					}
-					timestamp := ev.Timestamp
-					threadTimestamp := ev.ThreadTimestamp
-					inputMsgs <- populateMessage(models.NewMessage(), msgType, channel, text, timestamp, threadTimestamp, mentioned, user, bot)
+				if message, ok := readMessageEvent(rtm, ev, bot); ok {
+					tagWorkspace(&message, rtmWorkspace(ev), rtm, bot)
+					inputMsgs <- message
 				}
 			case *slack.ConnectedEvent:
-				// populate users
+				// populate users, also after reconnecting, since they may have changed meanwhile
 				populateBotUsers(ev.Info.Users, bot)
 				// populate user groups
 				populateUserGroups(bot)
+				// and rooms
+				bot.Rooms = getRooms(&rtm.Client)
+				remote.SetStatus(remote.StatusName(bot, "slack"), "connected", "RTM")
+				up()
 				bot.Log.Debugf("RTM connection established!")
+			case *slack.DisconnectedEvent:
+				// Unless we disconnected, the Slack package reconnects
+				if !ev.Intentional {
+					remote.ConnectionDown(remote.StatusName(bot, "slack"))
+					remote.SetStatus(remote.StatusName(bot, "slack"), "disconnected", "reconnecting")
+				}
 			case *slack.GroupJoinedEvent:
 				// when the bot joins a channel add it to the internal lookup
 				// NOTE: looks like there is another unsupported event we could use
@@ -497,13 +813,40 @@ func readFromRTM(rtm *slack.RTM, inputMsgs chan<- models.Message, bot *models.Bo
 					bot.Rooms[ev.Channel.Name] = ev.Channel.ID
 					bot.Log.Debugf("Joined new channel. %s(%s) added to lookup", ev.Channel.Name, ev.Channel.ID)
 				}
+				if message, ok := readChannelEvent(rtm, models.MsgEventJoined, ev.Channel.ID, "", bot); ok {
+					inputMsgs <- message
+				}
+			case *slack.ChannelJoinedEvent:
+				bot.Rooms[ev.Channel.Name] = ev.Channel.ID
+				if message, ok := readChannelEvent(rtm, models.MsgEventJoined, ev.Channel.ID, "", bot); ok {
+					inputMsgs <- message
+				}
+			case *slack.ChannelLeftEvent:
+				if message, ok := readChannelEvent(rtm, models.MsgEventLeft, ev.Channel, "", bot); ok {
+					inputMsgs <- message
+				}
+				removeRoom(ev.Channel, bot)
+			case *slack.GroupLeftEvent:
+				if message, ok := readChannelEvent(rtm, models.MsgEventLeft, ev.Channel, "", bot); ok {
+					inputMsgs <- message
+				}
+				removeRoom(ev.Channel, bot)
+			case *slack.UserChangeEvent:
+				// a user changed their profile, look them up again next time
+				forgetUser(ev.User.ID)
+			case *slack.TeamJoinEvent:
+				if message, ok := readUserJoined(rtm, &ev.User, bot); ok {
+					inputMsgs <- message
+				}
 			case *slack.HelloEvent:
 				// ignore - this is the very first initial event sent when connecting to Slack
 			case *slack.RTMError:
 				bot.Log.Error(ev.Error())
 			case *slack.ConnectionErrorEvent:
+				remote.SetStatus(remote.StatusName(bot, "slack"), "disconnected", ev.Error())
 				bot.Log.Errorf("RTM connection error: %+v", ev)
 			case *slack.InvalidAuthEvent:
+				remote.SetStatus(remote.StatusName(bot, "slack"), "disconnected", "invalid authorization")
 				if !bot.CLI {
 					bot.Log.Debug("Invalid Authorization. Please double check your Slack token.")
 				}
@@ -512,6 +855,43 @@ func readFromRTM(rtm *slack.RTM, inputMsgs chan<- models.Message, bot *models.Bo
 	} // EOF for
 }
 
+// abandonRTM disconnects an RTM connection that's being replaced, and drops whatever it still
+// delivers until it stops. A dead connection may not take the disconnect right away, so it isn't
+// waited for.
+func abandonRTM(rtm *slack.RTM, managed <-chan struct{}) {
+	go rtm.Disconnect()
+	go func() {
+		for {
+			select {
+			case <-rtm.IncomingEvents:
+			case <-managed:
+				return
+			}
+		}
+	}()
+}
+
+// reportFanOutErrors - tells the user who triggered a message which of its rooms and users it could not be sent to;
+// messages nobody triggered, e.g. scheduled ones, only have their errors logged
+func reportFanOutErrors(api *slack.Client, message models.Message, total int, errs map[string]error, bot *models.Bot) {
+	failed := make([]string, 0, len(errs))
+	for target, err := range errs {
+		bot.Log.Errorf("Problem sending message to '%s': %s", target, err.Error())
+		failed = append(failed, fmt.Sprintf("'%s' (%s)", target, err.Error()))
+	}
+	sort.Strings(failed)
+
+	userID := message.Vars["_user.id"]
+	if len(userID) == 0 || len(message.ChannelID) == 0 {
+		return
+	}
+	text := fmt.Sprintf("Could not send the message to %d of %d targets: %s", len(errs), total, strings.Join(failed, ", "))
+	_, err := api.PostEphemeral(message.ChannelID, userID, slack.MsgOptionText(text, false), slack.MsgOptionTS(message.OutputThread()))
+	if err != nil {
+		bot.Log.Errorf("Could not report failed sends to '%s': %s", userID, err.Error())
+	}
+}
+
 // send - handles the sending logic of a message going to Slack
 func send(api *slack.Client, message models.Message, bot *models.Bot) {
 	users, err := getSlackUsers(api, message)
@@ -533,12 +913,20 @@ func send(api *slack.Client, message models.Message, bot *models.Bot) {
 
 // sendBackToOriginMessage - sends a message back to where it came from in Slack; this is pretty much a catch-all among the other send functions
 func sendBackToOriginMessage(api *slack.Client, message models.Message) error {
-	return sendMessage(api, message.IsEphemeral, message.ChannelID, message.Vars["_user.id"], message.Output, message.ThreadTimestamp, message.Attributes["ws_token"], message.Remotes.Slack.Attachments)
+	err := sendMessage(api, message.IsEphemeral, message.ChannelID, message.Vars["_user.id"], message.Output, message.OutputThread(), message.Attributes["ws_token"], message.Remotes.Slack.Attachments)
+	if err != nil {
+		return err
+	}
+	return uploadFiles(api, message.ChannelID, message)
 }
 
 // sendChannelMessage - sends a message to a Slack channel
 func sendChannelMessage(api *slack.Client, channel string, message models.Message) error {
-	return sendMessage(api, message.IsEphemeral, channel, message.Vars["_user.id"], message.Output, message.ThreadTimestamp, message.Attributes["ws_token"], message.Remotes.Slack.Attachments)
+	err := sendMessage(api, message.IsEphemeral, channel, message.Vars["_user.id"], message.Output, message.OutputThread(), message.Attributes["ws_token"], message.Remotes.Slack.Attachments)
+	if err != nil {
+		return err
+	}
+	return uploadFiles(api, channel, message)
 }
 
 // sendDirectMessage - sends a message back to the user who dm'ed your bot
@@ -547,7 +935,32 @@ func sendDirectMessage(api *slack.Client, userID string, message models.Message)
 	if err != nil {
 		return err
 	}
-	return sendMessage(api, message.IsEphemeral, imChannelID, message.Vars["_user.id"], message.Output, message.ThreadTimestamp, message.Attributes["ws_token"], message.Remotes.Slack.Attachments)
+	err = sendMessage(api, message.IsEphemeral, imChannelID, message.Vars["_user.id"], message.Output, message.OutputThread(), message.Attributes["ws_token"], message.Remotes.Slack.Attachments)
+	if err != nil {
+		return err
+	}
+	return uploadFiles(api, imChannelID, message)
+}
+
+// uploadFiles - uploads the files sent along with a message, e.g. CSV files or charts, to the same channel and thread;
+// files are visible to everyone in the channel, so they're not uploaded for ephemeral messages
+func uploadFiles(api *slack.Client, channel string, message models.Message) error {
+	if message.IsEphemeral {
+		return nil
+	}
+	for _, file := range message.Files {
+		_, err := api.UploadFile(slack.FileUploadParameters{
+			Reader:          bytes.NewReader(file.Data),
+			Filename:        file.Name,
+			Title:           file.Name,
+			Channels:        []string{channel},
+			ThreadTimestamp: message.OutputThread(),
+		})
+		if err != nil {
+			return fmt.Errorf("Could not upload file '%s': %s", file.Name, err.Error())
+		}
+	}
+	return nil
 }
 
 // sendMessage - does the final send to Slack; adds any Slack-specific message parameters to the message to be sent out
@@ -573,6 +986,8 @@ func sendMessage(api *slack.Client, ephemeral bool, channel, userID, text, threa
 	if len(text) > 0 && strings.Contains(text, "http") {
 		if isValidURL(text) {
 			if len(attachments) > 0 {
+				// the same message may be sent to several channels at once, so don't change the shared attachments
+				attachments = append([]slack.Attachment{}, attachments...)
 				attachments[0].ImageURL = text
 			} else {
 				attachments = []slack.Attachment{
@@ -654,3 +1069,60 @@ func unfurlLink(workspaceToken, messageTimeStamp, channel, link string) error {
 	}
 	return fmt.Errorf("URL link to unfurl is invalid, please check it's validity and try again")
 }
+
+// userLocales caches the locales of Slack users, keyed by user ID
+var userLocales = struct {
+	sync.Mutex
+	locales map[string]string
+}{locales: map[string]string{}}
+
+// localeClient looks up user locales; a slow Slack API mustn't hold up the message being read
+var localeClient = &http.Client{Timeout: 10 * time.Second}
+
+// getUserLocale gets the locale a Slack user has set (e.g. 'en-US'), used to reply in their language.
+// Slack only includes it in user info when asked to, so it is looked up once per user,
+// and only if the bot has translations.
+func getUserLocale(user *slack.User, bot *models.Bot) string {
+	if len(user.Locale) > 0 || len(bot.Catalog) == 0 || len(bot.SlackToken) == 0 {
+		return user.Locale
+	}
+
+	userLocales.Lock()
+	locale, ok := userLocales.locales[user.ID]
+	userLocales.Unlock()
+	if ok {
+		return locale
+	}
+
+	resp, err := localeClient.PostForm("https://slack.com/api/users.info", url.Values{
+		"token":          {bot.SlackToken},
+		"user":           {user.ID},
+		"include_locale": {"true"},
+	})
+	if err != nil {
+		bot.Log.Errorf("getUserLocale: Could not get Slack user locale: %s", err.Error())
+		return ""
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		User  struct {
+			Locale string `json:"locale"`
+		} `json:"user"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		bot.Log.Errorf("getUserLocale: Could not get Slack user locale: %s", err.Error())
+		return ""
+	}
+	if !info.OK {
+		bot.Log.Errorf("getUserLocale: Could not get Slack user locale: %s", info.Error)
+		return ""
+	}
+
+	userLocales.Lock()
+	userLocales.locales[user.ID] = info.User.Locale
+	userLocales.Unlock()
+	return info.User.Locale
+}
@@ -1,7 +1,8 @@
 package slack
 
 import (
-	"net/http"
+	"fmt"
+	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/nlopes/slack"
@@ -25,6 +26,12 @@ type Client struct {
 // validate that Client adheres to remote interface
 var _ remote.Remote = (*Client)(nil)
 
+// validate that Client can set up channels
+var _ remote.ChannelManager = (*Client)(nil)
+
+// validate that Client can edit the messages it posts
+var _ remote.MessageEditor = (*Client)(nil)
+
 // instantiate a new slack client
 func (c *Client) new() *slack.Client {
 	api := slack.New(c.Token)
@@ -92,8 +99,7 @@ func (c *Client) Read(inputMsgs chan<- models.Message, rules map[string]models.R
 		readFromEventsAPI(api, c.VerificationToken, inputMsgs, bot)
 	} else if len(c.Token) > 0 {
 		bot.ID = rat.UserID
-		rtm := api.NewRTM()
-		readFromRTM(rtm, inputMsgs, bot)
+		readFromRTM(api, inputMsgs, bot)
 	} else {
 		if !bot.CLI {
 			bot.Log.Fatal("Did not find either Slack Token or Slack Verification Token. Unable to read from Slack")
@@ -109,13 +115,6 @@ func (c *Client) Send(message models.Message, bot *models.Bot) {
 
 	api := c.new()
 
-	// check message size and trim if necessary because
-	// slack messages have a hard limit of 4000 characters
-	if len(message.Output) > 4000 {
-		contents := message.Output
-		message.Output = contents[:3997] + "..."
-	}
-
 	// Timestamp message
 	message.EndTime = models.MessageTimestamp()
 
@@ -128,7 +127,89 @@ func (c *Client) Send(message models.Message, bot *models.Bot) {
 	}
 }
 
-var interactionsRouter *mux.Router
+// Away looks up a user of 'output_to_users' (by email, or user ID), and whether they're away
+func (c *Client) Away(user string, bot *models.Bot) (string, bool, error) {
+	api := c.new()
+	users, err := api.GetUsers()
+	if err != nil {
+		return "", false, err
+	}
+	userID := getUserID(user, users, bot)
+	if len(userID) == 0 {
+		return "", false, fmt.Errorf("Could not find user '%s'", user)
+	}
+	presence, err := api.GetUserPresence(userID)
+	if err != nil {
+		return userID, false, err
+	}
+	return userID, presence.Presence == "away", nil
+}
+
+// CreateChannel creates a public channel and returns its ID
+func (c *Client) CreateChannel(name string, bot *models.Bot) (string, error) {
+	channel, err := c.new().CreateConversation(name, false)
+	if err != nil {
+		return "", err
+	}
+	return channel.ID, nil
+}
+
+// Invite adds users (by email, or user ID) to a channel; users who can't be found are skipped
+func (c *Client) Invite(channel string, users []string, bot *models.Bot) error {
+	if len(users) == 0 {
+		return nil
+	}
+	api := c.new()
+	slackUsers, err := api.GetUsers()
+	if err != nil {
+		return err
+	}
+	userIDs := []string{}
+	for _, user := range users {
+		if userID := getUserID(user, slackUsers, bot); len(userID) > 0 {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+	_, err = api.InviteUsersToConversation(channel, userIDs...)
+	return err
+}
+
+// Pin posts a message in a channel and pins it
+func (c *Client) Pin(channel, text string, bot *models.Bot) error {
+	api := c.new()
+	channelID, timestamp, err := api.PostMessage(channel, text, slack.PostMessageParameters{AsUser: true})
+	if err != nil {
+		return err
+	}
+	return api.AddPin(channelID, slack.NewRefToMessage(channelID, timestamp))
+}
+
+// PostMessage posts a message in a channel, or in a thread of it, and returns its timestamp, which
+// is its ID in Slack
+func (c *Client) PostMessage(channel, threadID, text string, bot *models.Bot) (string, error) {
+	_, timestamp, err := c.new().PostMessage(channel, text, slack.PostMessageParameters{AsUser: true, ThreadTimestamp: threadID})
+	return timestamp, err
+}
+
+// EditMessage replaces the text of a message the bot posted, by its timestamp
+func (c *Client) EditMessage(channel, id, text string, bot *models.Bot) error {
+	_, _, _, err := c.new().UpdateMessage(channel, id, text)
+	return err
+}
+
+// interactionsRouters are the routers of the bots' Interactive Components servers
+var interactionsRouters = struct {
+	sync.Mutex
+	routers map[*models.Bot]*mux.Router
+}{routers: make(map[*models.Bot]*mux.Router)}
+
+// Capabilities implementation to satisfy remote interface
+func (c *Client) Capabilities() remote.Capabilities {
+	return remote.Capabilities{Threads: true, Ephemeral: true, Attachments: true, Reactions: true, Files: true, Editing: true}
+}
 
 // InteractiveComponents implementation to satisfy remote interface
 // It will serve as a way for your bot to handle advance messaging, such as message attachments.
@@ -140,9 +221,12 @@ func (c *Client) InteractiveComponents(inputMsgs chan<- models.Message, message
 			bot.Log.Warn("Closing interactions reader (will not be able to read interactive components)")
 			return
 		}
-		if interactionsRouter == nil {
+		interactionsRouters.Lock()
+		interactionsRouter, ok := interactionsRouters.routers[bot]
+		if !ok {
 			// create router for the Interactive Components server
 			interactionsRouter = mux.NewRouter()
+			interactionsRouters.routers[bot] = interactionsRouter
 
 			// interaction health check handler
 			interactionsRouter.HandleFunc("/interaction_health", getInteractiveComponentHealthHandler(bot)).Methods("GET")
@@ -155,14 +239,16 @@ func (c *Client) InteractiveComponents(inputMsgs chan<- models.Message, message
 			if !isValidPath(bot.SlackInteractionsCallbackPath) {
 				bot.Log.Error("Invalid events path. Please double check your path value/syntax (e.g. \"/slack_events/v1/mybot_dev-v1_interactions\")")
 				bot.Log.Warn("Closing interaction components reader (will not be able to read interactive components)")
+				interactionsRouters.Unlock()
 				return
 			}
 			interactionsRouter.HandleFunc(bot.SlackInteractionsCallbackPath, ruleHandle).Methods("POST")
 
 			// start Interactive Components server
-			go http.ListenAndServe(":4000", interactionsRouter)
+			go remote.ListenAndServe(remote.ServerInteractions, bot.SlackInteractionsAddress, interactionsRouter, true, bot)
 			bot.Log.Infof("Slack Interactive Components server is listening to %s", bot.SlackInteractionsCallbackPath)
 		}
+		interactionsRouters.Unlock()
 
 		// Process the hit rule for Interactive Components, e.g. interactive messages
 		processInteractiveComponentRule(rule, message, bot)
@@ -0,0 +1,75 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nlopes/slack"
+	"github.com/nlopes/slack/slackevents"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+)
+
+// validate that Client can replay recorded payloads
+var _ remote.Replayer = (*Client)(nil)
+
+// recordedToken accepts the verification tokens of recorded events, which were removed when recording
+type recordedToken struct{}
+
+// Verify implementation to satisfy the slackevents verifier
+func (recordedToken) Verify(string) bool {
+	return true
+}
+
+// Replay turns a recorded Slack payload into the message the bot would have read from it.
+// Looking up the user who sent a message needs the bot's Slack token.
+func (c *Client) Replay(recording remote.Recording, bot *models.Bot) (models.Message, bool, error) {
+	api := c.new()
+	switch recording.Kind {
+	// Events API
+	case "event":
+		if joined, ok := parseTeamJoin(recording.Payload); ok {
+			message, ok := readUserJoined(api, &joined.Event.User, bot)
+			return message, ok, nil
+		}
+		event, err := slackevents.ParseEvent(recording.Payload, slackevents.OptionVerifyToken(recordedToken{}))
+		if err != nil {
+			return models.Message{}, false, err
+		}
+		if event.Type != slackevents.CallbackEvent {
+			return models.Message{}, false, nil
+		}
+		message, ok := readEvent(api, event.InnerEvent, parseWorkspace(recording.Payload), bot)
+		return message, ok, nil
+	// RTM
+	case "rtm":
+		var event struct {
+			Type string
+			Data json.RawMessage
+		}
+		if err := json.Unmarshal(recording.Payload, &event); err != nil {
+			return models.Message{}, false, err
+		}
+		if event.Type != "message" {
+			return models.Message{}, false, nil
+		}
+		var ev slack.MessageEvent
+		if err := json.Unmarshal(event.Data, &ev); err != nil {
+			return models.Message{}, false, err
+		}
+		message, ok := readMessageEvent(api, &ev, bot)
+		if ok {
+			tagWorkspace(&message, rtmWorkspace(&ev), api, bot)
+		}
+		return message, ok, nil
+	// Interactive components
+	case "interaction":
+		var callback slack.AttachmentActionCallback
+		if err := json.Unmarshal(recording.Payload, &callback); err != nil {
+			return models.Message{}, false, err
+		}
+		return readInteraction(callback, bot), true, nil
+	}
+	return models.Message{}, false, fmt.Errorf("Unknown kind of Slack payload '%s'", recording.Kind)
+}
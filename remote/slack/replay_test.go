@@ -0,0 +1,130 @@
+package slack
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"github.com/sirupsen/logrus"
+
+	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestReplay(t *testing.T) {
+	users.mu.Lock()
+	users.users["U123"] = cachedUser{user: &slack.User{ID: "U123", Name: "jane"}, expires: time.Now().Add(time.Hour)}
+	users.mu.Unlock()
+	defer forgetUser("U123")
+
+	bot := &models.Bot{ID: "UBOT", Store: memory.New()}
+	bot.Log = *logrus.New()
+	bot.Store.Set(interactionsBucket, "deploy-confirm", []byte("deploy"), 0)
+
+	tests := []struct {
+		name      string
+		kind      string
+		payload   string
+		wantInput string
+		wantOK    bool
+		wantErr   bool
+	}{
+		{"Events API message", "event", `{"token":"[REDACTED]","type":"event_callback","event_id":"Ev1","event":{"type":"message","user":"U123","channel":"D12345678","text":"<@UBOT> deploy api","ts":"1.2"}}`, "deploy api", true, false},
+		{"Events API message from the bot", "event", `{"token":"[REDACTED]","type":"event_callback","event_id":"Ev2","event":{"type":"message","user":"UBOT","channel":"D12345678","text":"hi","ts":"1.2"}}`, "", false, false},
+		{"Events API challenge", "event", `{"token":"[REDACTED]","type":"url_verification","challenge":"abc"}`, "", false, false},
+		{"RTM message", "rtm", `{"Type":"message","Data":{"type":"message","user":"U123","channel":"C12345678","text":"<@UBOT> status","ts":"1.2"}}`, "status", true, false},
+		{"RTM hello", "rtm", `{"Type":"hello","Data":{}}`, "", false, false},
+		{"Interaction", "interaction", `{"token":"[REDACTED]","callback_id":"deploy-confirm","channel":{"id":"D12345678"},"user":{"id":"U123","name":"jane.doe"},"actions":[{"value":"yes"}]}`, "yes", true, false},
+		{"Unknown kind", "slash_command", `{}`, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recording := remote.Recording{Remote: "slack", Kind: tt.kind, Payload: json.RawMessage(tt.payload)}
+			message, ok, err := (&Client{}).Replay(recording, bot)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Replay() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("Replay() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if message.Input != tt.wantInput || !message.BotMentioned && message.Type != models.MsgTypeDirect {
+				t.Errorf("Replay() = input %q, mentioned %v, type %d", message.Input, message.BotMentioned, message.Type)
+			}
+			if message.Vars["_user.id"] != "U123" {
+				t.Errorf("Replay() user = %q, want U123", message.Vars["_user.id"])
+			}
+			if tt.kind == "interaction" && message.Vars["_interaction.rule"] != "deploy" {
+				t.Errorf("Replay() _interaction.rule = %q, want deploy", message.Vars["_interaction.rule"])
+			}
+		})
+	}
+}
+
+func TestReplayChanges(t *testing.T) {
+	users.mu.Lock()
+	users.users["U123"] = cachedUser{user: &slack.User{ID: "U123", Name: "jane"}, expires: time.Now().Add(time.Hour)}
+	users.mu.Unlock()
+	defer forgetUser("U123")
+
+	bot := &models.Bot{ID: "UBOT"}
+	bot.Log = *logrus.New()
+
+	// The recordings are replayed in order, so the bot saw the first message being sent before it's edited
+	tests := []struct {
+		name         string
+		kind         string
+		payload      string
+		wantEvent    models.MessageEvent
+		wantInput    string
+		wantPrevious string
+		wantOK       bool
+	}{
+		{"RTM message", "rtm", `{"Type":"message","Data":{"type":"message","user":"U123","channel":"D12345678","text":"deploy api","ts":"2.1"}}`, models.MsgEventSent, "deploy api", "", true},
+		{"RTM edit", "rtm", `{"Type":"message","Data":{"type":"message","subtype":"message_changed","channel":"D12345678","message":{"type":"message","user":"U123","text":"deploy web","ts":"2.1"},"ts":"2.2"}}`, models.MsgEventEdited, "deploy web", "deploy api", true},
+		{"RTM unfurl", "rtm", `{"Type":"message","Data":{"type":"message","subtype":"message_changed","channel":"D12345678","message":{"type":"message","user":"U123","text":"deploy web","ts":"2.1"},"ts":"2.3"}}`, 0, "", "", false},
+		{"RTM deletion", "rtm", `{"Type":"message","Data":{"type":"message","subtype":"message_deleted","channel":"D12345678","deleted_ts":"2.1","ts":"2.4"}}`, models.MsgEventDeleted, "deploy web", "deploy web", true},
+		{"RTM deletion of an unknown message", "rtm", `{"Type":"message","Data":{"type":"message","subtype":"message_deleted","channel":"D12345678","deleted_ts":"9.9","ts":"2.5"}}`, 0, "", "", false},
+		{"Events API deletion", "event", `{"token":"[REDACTED]","type":"event_callback","event_id":"Ev3","event":{"type":"message","subtype":"message_deleted","channel":"D12345678","previous_message":{"type":"message","user":"U123","text":"the password is hunter2","ts":"3.1"},"ts":"3.2"}}`, models.MsgEventDeleted, "the password is hunter2", "the password is hunter2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recording := remote.Recording{Remote: "slack", Kind: tt.kind, Payload: json.RawMessage(tt.payload)}
+			message, ok, err := (&Client{}).Replay(recording, bot)
+			if err != nil || ok != tt.wantOK {
+				t.Fatalf("Replay() = %v, %v, want %v", ok, err, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if message.Event != tt.wantEvent || message.Input != tt.wantInput || message.Vars["_previous_text"] != tt.wantPrevious {
+				t.Errorf("Replay() = event %d, input %q, previous text %q", message.Event, message.Input, message.Vars["_previous_text"])
+			}
+		})
+	}
+}
+
+func TestParseTeamJoin(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		wantUser string
+		wantOK   bool
+	}{
+		{"Team join", `{"token":"abc","type":"event_callback","event_id":"Ev5","event":{"type":"team_join","user":{"id":"U456","name":"new.hire"}}}`, "U456", true},
+		{"Message", `{"token":"abc","type":"event_callback","event_id":"Ev6","event":{"type":"message","user":"U123","text":"hi"}}`, "", false},
+		{"Not JSON", `team_join`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := parseTeamJoin([]byte(tt.payload))
+			if ok != tt.wantOK || (ok && (event.Event.User.ID != tt.wantUser || event.Token != "abc")) {
+				t.Errorf("parseTeamJoin() = %+v, %v, want user %q, %v", event, ok, tt.wantUser, tt.wantOK)
+			}
+		})
+	}
+}
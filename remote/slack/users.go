@@ -0,0 +1,79 @@
+package slack
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+
+	"github.com/target/flottbot/models"
+)
+
+// defaultUserCacheTTL is how long looked up Slack users are remembered, unless bot.yml sets 'slack_user_cache_ttl'
+const defaultUserCacheTTL = 10 * time.Minute
+
+// userInfoGetter looks up Slack users, e.g. a *slack.Client
+type userInfoGetter interface {
+	GetUserInfo(user string) (*slack.User, error)
+}
+
+// userCache remembers looked up Slack users, so busy workspaces don't run into Slack's rate limits.
+// It is shared by the RTM and Events API readers.
+type userCache struct {
+	mu    sync.Mutex
+	users map[string]cachedUser
+}
+
+// cachedUser is a Slack user remembered by a userCache
+type cachedUser struct {
+	user    *slack.User
+	expires time.Time
+}
+
+var users = &userCache{users: make(map[string]cachedUser)}
+
+// getUserInfo looks up a Slack user, unless it was looked up recently
+func getUserInfo(api userInfoGetter, userID string, bot *models.Bot) (*slack.User, error) {
+	return users.get(api, userID, userCacheTTL(bot), time.Now())
+}
+
+// forgetUser makes the next lookup of a Slack user ask Slack again, e.g. after the user changed their profile
+func forgetUser(userID string) {
+	users.mu.Lock()
+	defer users.mu.Unlock()
+	delete(users.users, userID)
+}
+
+// get looks up a user in the cache, and asks Slack if the user isn't cached or has expired
+func (c *userCache) get(api userInfoGetter, userID string, ttl time.Duration, now time.Time) (*slack.User, error) {
+	c.mu.Lock()
+	cached, ok := c.users[userID]
+	c.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.user, nil
+	}
+
+	user, err := api.GetUserInfo(userID)
+	if err != nil {
+		return user, err
+	}
+	if ttl > 0 {
+		c.mu.Lock()
+		c.users[userID] = cachedUser{user: user, expires: now.Add(ttl)}
+		c.mu.Unlock()
+	}
+	return user, nil
+}
+
+// userCacheTTL is how long looked up Slack users are remembered; 0 turns the cache off
+func userCacheTTL(bot *models.Bot) time.Duration {
+	if len(bot.SlackUserCacheTTL) == 0 {
+		return defaultUserCacheTTL
+	}
+	ttl, err := time.ParseDuration(bot.SlackUserCacheTTL)
+	if err != nil {
+		bot.Log.Warnf("Invalid slack_user_cache_ttl '%s', using %s", bot.SlackUserCacheTTL, defaultUserCacheTTL)
+		return defaultUserCacheTTL
+	}
+	return ttl
+}
@@ -0,0 +1,67 @@
+package slack
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// fakeUsers counts how often users are looked up
+type fakeUsers struct {
+	lookups int
+}
+
+func (f *fakeUsers) GetUserInfo(user string) (*slack.User, error) {
+	f.lookups++
+	if user == "UMISSING" {
+		return nil, errors.New("user_not_found")
+	}
+	return &slack.User{ID: user, Name: "jane"}, nil
+}
+
+func TestUserCache(t *testing.T) {
+	now := time.Now()
+	api := &fakeUsers{}
+	cache := &userCache{users: make(map[string]cachedUser)}
+
+	tests := []struct {
+		name        string
+		userID      string
+		ttl         time.Duration
+		at          time.Time
+		wantLookups int
+		wantErr     bool
+	}{
+		{"First lookup", "U111", time.Minute, now, 1, false},
+		{"Cached", "U111", time.Minute, now.Add(30 * time.Second), 1, false},
+		{"Expired", "U111", time.Minute, now.Add(2 * time.Minute), 2, false},
+		{"Errors aren't cached", "UMISSING", time.Minute, now, 3, true},
+		{"Errors aren't cached either time", "UMISSING", time.Minute, now, 4, true},
+		{"Cache off", "U222", 0, now, 5, false},
+		{"Cache off again", "U222", 0, now, 6, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := cache.get(api, tt.userID, tt.ttl, tt.at)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && user.ID != tt.userID {
+				t.Errorf("get() = %+v", user)
+			}
+			if api.lookups != tt.wantLookups {
+				t.Errorf("get() looked up users %d times, want %d", api.lookups, tt.wantLookups)
+			}
+		})
+	}
+
+	// Changed users are looked up again
+	users = cache
+	forgetUser("U111")
+	cache.get(api, "U111", time.Minute, now.Add(2*time.Minute))
+	if api.lookups != 7 {
+		t.Errorf("forgetUser() didn't make the user be looked up again")
+	}
+}
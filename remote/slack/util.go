@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/target/flottbot/models"
+	"github.com/target/flottbot/remote"
 )
 
 /*
@@ -27,6 +30,21 @@ func findKey(m map[string]string, value string) (key string, ok bool) {
 	return
 }
 
+// slackTime is when a message was sent, from its 'ts': Unix seconds and microseconds, e.g. '1558391234.000200'.
+// It's the zero time for messages without one.
+func slackTime(ts string) time.Time {
+	parts := strings.SplitN(ts, ".", 2)
+	secs, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	var micros int64
+	if len(parts) == 2 {
+		micros, _ = strconv.ParseInt((parts[1] + "000000")[:6], 10, 64)
+	}
+	return time.Unix(secs, micros*int64(time.Microsecond))
+}
+
 // getMessageType - gets the type of message based on where it came from
 func getMessageType(channel string) (models.MessageType, error) {
 	re := regexp.MustCompile(`^(C|D|G)[A-Z0-9]{8}$`) // match known 9-char channel ID types
@@ -70,8 +88,9 @@ func isValidURL(url string) bool {
 	return false
 }
 
-// removeBotMention - parse out the preppended bot mention in a message
-func removeBotMention(contents, botID string) (string, bool) {
+// removeBotMention - parse out the preppended bot mention in a message, or one of the
+// prefixes the bot is addressed with ('mention_prefixes' in bot.yml)
+func removeBotMention(contents, botID string, prefixes []string) (string, bool) {
 	mention := fmt.Sprintf("<@%s> ", botID)
 	wasMentioned := false
 	if strings.HasPrefix(contents, mention) {
@@ -79,6 +98,9 @@ func removeBotMention(contents, botID string) (string, bool) {
 		contents = strings.TrimSpace(contents)
 		wasMentioned = true
 	}
+	if !wasMentioned {
+		contents, wasMentioned = remote.RemovePrefix(contents, prefixes)
+	}
 	return contents, wasMentioned
 }
 
@@ -0,0 +1,27 @@
+package slack
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlackTime(t *testing.T) {
+	tests := []struct {
+		name string
+		ts   string
+		want time.Time
+	}{
+		{"Message", "1558391234.000200", time.Unix(1558391234, 200000)},
+		{"Whole seconds", "1558391234", time.Unix(1558391234, 0)},
+		{"Short fraction", "1558391234.5", time.Unix(1558391234, 500000000)},
+		{"None", "", time.Time{}},
+		{"Not a timestamp", "abc", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slackTime(tt.ts); !got.Equal(tt.want) {
+				t.Errorf("slackTime(%q) = %v, want %v", tt.ts, got, tt.want)
+			}
+		})
+	}
+}
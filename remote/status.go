@@ -0,0 +1,62 @@
+package remote
+
+import (
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/models"
+)
+
+// Status describes the state of a remote's connection, e.g. for the admin API
+type Status struct {
+	State     string     `json:"state"`
+	Detail    string     `json:"detail,omitempty"`
+	Since     time.Time  `json:"since"`
+	LastHeard *time.Time `json:"last_heard,omitempty"` // when the remote last received anything, see Heard
+}
+
+var (
+	statusMu sync.RWMutex
+	statuses = make(map[string]Status)
+)
+
+// SetStatus records the current state of the named remote, e.g. 'connected' or 'disconnected'
+func SetStatus(name, state, detail string) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if current, ok := statuses[name]; ok && current.State == state && current.Detail == detail {
+		return
+	}
+	statuses[name] = Status{State: state, Detail: detail, Since: time.Now(), LastHeard: statuses[name].LastHeard}
+}
+
+// Heard records that the named remote just received something from its chat application, e.g. an
+// event or a ping; a remote that stays connected but hears nothing may have been silently cut off
+func Heard(name string) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	status := statuses[name]
+	now := time.Now()
+	status.LastHeard = &now
+	statuses[name] = status
+}
+
+// StatusName is the name a bot's remote records its state under. When several bots run in one
+// process, the remotes of the additional bots are told apart by the bot's name, e.g. 'deploy-bot/slack'.
+func StatusName(bot *models.Bot, remote string) string {
+	if len(bot.ConfigDir) == 0 {
+		return remote
+	}
+	return bot.Name + "/" + remote
+}
+
+// Statuses returns the last recorded state of every remote
+func Statuses() map[string]Status {
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	result := make(map[string]Status, len(statuses))
+	for name, status := range statuses {
+		result[name] = status
+	}
+	return result
+}
@@ -0,0 +1,101 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+)
+
+// Bar chart layout, in pixels
+const (
+	chartMargin   = 16
+	chartBarWidth = 40
+	chartBarGap   = 16
+	chartHeight   = 200
+	chartMaxBars  = 50
+)
+
+var (
+	chartBackground = color.RGBA{255, 255, 255, 255}
+	chartText       = color.RGBA{33, 33, 33, 255}
+	chartAxis       = color.RGBA{158, 158, 158, 255}
+	chartBar        = color.RGBA{66, 133, 244, 255}
+)
+
+// BarChart draws a bar chart of values as a PNG image, one bar per label.
+// Negative values are drawn as empty bars.
+func BarChart(title string, labels []string, values []float64) ([]byte, error) {
+	if len(labels) != len(values) {
+		return nil, fmt.Errorf("Could not draw chart: %d labels for %d values", len(labels), len(values))
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("Could not draw chart: no values")
+	}
+	if len(values) > chartMaxBars {
+		return nil, fmt.Errorf("Could not draw chart: too many values (%d), at most %d can be drawn", len(values), chartMaxBars)
+	}
+
+	max := 0.0
+	valueLabels := make([]string, len(values))
+	for i, v := range values {
+		if v > max {
+			max = v
+		}
+		valueLabels[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	// Bars are wide enough for their labels
+	slot := chartBarWidth
+	for i := range labels {
+		if w := textWidth(labels[i], 1); w > slot {
+			slot = w
+		}
+		if w := textWidth(valueLabels[i], 1); w > slot {
+			slot = w
+		}
+	}
+
+	titleHeight := 0
+	if len(title) > 0 {
+		titleHeight = glyphHeight*2 + chartMargin
+	}
+	width := 2*chartMargin + len(values)*slot + (len(values)-1)*chartBarGap
+	if w := 2*chartMargin + textWidth(title, 2); w > width {
+		width = w
+	}
+	// Room for the value above the tallest bar, and the labels below the axis
+	top := chartMargin + titleHeight + glyphHeight + 4
+	axis := top + chartHeight
+	height := axis + 4 + glyphHeight + chartMargin
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBackground}, image.ZP, draw.Src)
+
+	if len(title) > 0 {
+		drawText(img, (width-textWidth(title, 2))/2, chartMargin, title, 2, chartText)
+	}
+	draw.Draw(img, image.Rect(chartMargin/2, axis, width-chartMargin/2, axis+1), &image.Uniform{chartAxis}, image.ZP, draw.Src)
+
+	for i, v := range values {
+		x := chartMargin + i*(slot+chartBarGap)
+		barHeight := 0
+		if v > 0 && max > 0 {
+			barHeight = int(v / max * chartHeight)
+		}
+		barLeft := x + (slot-chartBarWidth)/2
+		draw.Draw(img, image.Rect(barLeft, axis-barHeight, barLeft+chartBarWidth, axis), &image.Uniform{chartBar}, image.ZP, draw.Src)
+
+		drawText(img, x+(slot-textWidth(valueLabels[i], 1))/2, axis-barHeight-glyphHeight-4, valueLabels[i], 1, chartText)
+		drawText(img, x+(slot-textWidth(labels[i], 1))/2, axis+4, labels[i], 1, chartText)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("Could not draw chart: %s", err.Error())
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,106 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Markdown dialects output can be converted to
+const (
+	DialectSlack   = "slack"   // Slack's mrkdwn
+	DialectDiscord = "discord" // Discord's Markdown
+	DialectPlain   = "plain"   // no formatting, e.g. for the CLI
+)
+
+var (
+	// markdownCode are blocks and spans of code, which are never converted
+	markdownCode = regexp.MustCompile("(?s)```.*?```|`[^`\n]+`")
+	// markdownHeading and markdownBullet start a line
+	markdownHeading = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*$`)
+	markdownBullet  = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	// markdownInline are, in order: **bold**, __bold__, *italic*, _italic_, ~~strikethrough~~, and [links](url)
+	markdownInline = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__|\*([^*\s](?:[^*\n]*?[^*\s])?)\*|\b_([^_\n]+?)_\b|~~(.+?)~~|\[([^\]\n]+)\]\(([^)\s]+)\)`)
+)
+
+// Markdown converts text written in Markdown (CommonMark: **bold**, *italic*, ~~strikethrough~~,
+// [links](https://example.com), # headings, - lists, and `code`) to the syntax of a dialect, so
+// rules don't need to be written for one chat application. Code is left as it is; text is
+// returned unchanged for unknown dialects.
+func Markdown(text, dialect string) string {
+	if dialect != DialectSlack && dialect != DialectDiscord && dialect != DialectPlain {
+		return text
+	}
+	var converted strings.Builder
+	last := 0
+	for _, code := range markdownCode.FindAllStringIndex(text, -1) {
+		converted.WriteString(markdownLines(text[last:code[0]], dialect))
+		converted.WriteString(text[code[0]:code[1]])
+		last = code[1]
+	}
+	converted.WriteString(markdownLines(text[last:], dialect))
+	return converted.String()
+}
+
+// markdownLines converts the headings and lists, and then the inline formatting, of text without code
+func markdownLines(text, dialect string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if match := markdownHeading.FindStringSubmatch(line); match != nil {
+			lines[i] = markdownStrong(markdownInlines(match[1], dialect), dialect)
+			continue
+		}
+		if dialect == DialectSlack {
+			line = markdownBullet.ReplaceAllString(line, "$1• ")
+		}
+		lines[i] = markdownInlines(line, dialect)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdownInlines converts bold and italic text, strikethrough, and links
+func markdownInlines(text, dialect string) string {
+	return markdownInline.ReplaceAllStringFunc(text, func(match string) string {
+		groups := markdownInline.FindStringSubmatch(match)
+		switch {
+		case len(groups[1]) > 0 || len(groups[2]) > 0:
+			return markdownStrong(markdownInlines(groups[1]+groups[2], dialect), dialect)
+		case len(groups[3]) > 0 || len(groups[4]) > 0:
+			inner := markdownInlines(groups[3]+groups[4], dialect)
+			switch dialect {
+			case DialectSlack:
+				return "_" + inner + "_"
+			case DialectDiscord:
+				return "*" + inner + "*"
+			}
+			return inner
+		case len(groups[5]) > 0:
+			inner := markdownInlines(groups[5], dialect)
+			switch dialect {
+			case DialectSlack:
+				return "~" + inner + "~"
+			case DialectDiscord:
+				return "~~" + inner + "~~"
+			}
+			return inner
+		}
+		label, url := groups[6], groups[7]
+		if dialect == DialectSlack {
+			return "<" + url + "|" + label + ">"
+		}
+		if label == url {
+			return url
+		}
+		return label + " (" + url + ")"
+	})
+}
+
+// markdownStrong makes text bold
+func markdownStrong(text, dialect string) string {
+	switch dialect {
+	case DialectSlack:
+		return "*" + text + "*"
+	case DialectDiscord:
+		return "**" + text + "**"
+	}
+	return text
+}
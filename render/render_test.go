@@ -0,0 +1,134 @@
+package render
+
+import (
+	"bytes"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+func TestRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr bool
+	}{
+		{"Array", `[{"a":1},{"a":2,"b":"x"}]`, 2, false},
+		{"Object", `{"a":1}`, 1, false},
+		{"Empty array", `[]`, 0, false},
+		{"Array of numbers", `[1,2]`, 0, true},
+		{"Not JSON", `a | b`, 0, true},
+		{"String", `"a"`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := Rows(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Rows() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(rows) != tt.want {
+				t.Errorf("Rows() = %v, want %d rows", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestTable(t *testing.T) {
+	rows, err := Rows(`[{"name":"api","replicas":3,"tags":["a"]},{"name":"web-frontend","replicas":12,"owner":null}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := Columns(rows)
+	if !reflect.DeepEqual(columns, []string{"name", "owner", "replicas", "tags"}) {
+		t.Errorf("Columns() = %v", columns)
+	}
+
+	want := "name         | replicas | tags\n" +
+		"-------------+----------+------\n" +
+		"api          | 3        | [\"a\"]\n" +
+		"web-frontend | 12       |"
+	if got := Table([]string{"name", "replicas", "tags"}, rows); got != want {
+		t.Errorf("Table() =\n%s\nwant\n%s", got, want)
+	}
+
+	csv, err := CSV([]string{"name", "replicas"}, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(csv); got != "name,replicas\napi,3\nweb-frontend,12\n" {
+		t.Errorf("CSV() = %q", got)
+	}
+}
+
+func TestBarChart(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  []string
+		values  []float64
+		wantErr bool
+	}{
+		{"Chart", []string{"api", "web-frontend", "worker"}, []float64{3, 12.5, 0}, false},
+		{"Negative and zero values", []string{"a", "b"}, []float64{-1, 0}, false},
+		{"No values", nil, nil, true},
+		{"Mismatched labels", []string{"a"}, []float64{1, 2}, true},
+		{"Too many values", make([]string, chartMaxBars+1), make([]float64, chartMaxBars+1), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := BarChart("Replicas", tt.labels, tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BarChart() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("BarChart() is not a PNG: %v", err)
+			}
+			if img.Bounds().Dx() < len(tt.values)*chartBarWidth || img.Bounds().Dy() < chartHeight {
+				t.Errorf("BarChart() size = %v", img.Bounds())
+			}
+		})
+	}
+}
+
+func TestGlyphs(t *testing.T) {
+	for r, glyph := range glyphs {
+		for _, line := range glyph {
+			if len(line) != glyphWidth {
+				t.Errorf("glyph %q has a line %q that is not %d wide", r, line, glyphWidth)
+			}
+		}
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		dialect string
+		want    string
+	}{
+		{"Slack bold and italic", "**deployed** to *prod*", DialectSlack, "*deployed* to _prod_"},
+		{"Slack link", "see [the logs](https://logs.example.com/1)", DialectSlack, "see <https://logs.example.com/1|the logs>"},
+		{"Slack strikethrough", "~~old~~ new", DialectSlack, "~old~ new"},
+		{"Slack heading and list", "# Status\n- web: up\n* db: down", DialectSlack, "*Status*\n• web: up\n• db: down"},
+		{"Slack nested", "**see [logs](https://l.example.com)**", DialectSlack, "*see <https://l.example.com|logs>*"},
+		{"Snake case", "run deploy_web_app now", DialectSlack, "run deploy_web_app now"},
+		{"Code is left alone", "`**raw**` and\n```\n[x](y) *z*\n```", DialectSlack, "`**raw**` and\n```\n[x](y) *z*\n```"},
+		{"Discord", "# Status\n__up__, _mostly_, see [logs](https://l.example.com)", DialectDiscord, "**Status**\n**up**, *mostly*, see logs (https://l.example.com)"},
+		{"Plain", "**up**, see [logs](https://l.example.com) or [https://e.com](https://e.com)", DialectPlain, "up, see logs (https://l.example.com) or https://e.com"},
+		{"Unknown dialect", "**up**", "teletype", "**up**"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Markdown(tt.text, tt.dialect); got != tt.want {
+				t.Errorf("Markdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
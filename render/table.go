@@ -0,0 +1,129 @@
+// Package render turns lists of result objects (e.g. from SQL queries or HTTP APIs) into
+// something people can read in chat: aligned tables, CSV files, and bar charts.
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Rows parses a JSON array of objects; a single object is one row
+func Rows(data string) ([]map[string]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("Could not parse rows: %s", err.Error())
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}, nil
+	case []interface{}:
+		rows := make([]map[string]interface{}, len(v))
+		for i, item := range v {
+			row, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Could not parse rows: item %d is not an object", i)
+			}
+			rows[i] = row
+		}
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("Could not parse rows: expected an array of objects")
+	}
+}
+
+// Columns are the keys of the rows, sorted, for rows whose columns weren't chosen
+func Columns(rows []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	columns := []string{}
+	for _, row := range rows {
+		for column := range row {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// Value formats a column's value; missing values and null are empty, objects and arrays are JSON
+func Value(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Table renders rows as a plain text table with aligned columns, to be shown in a code block
+func Table(columns []string, rows []map[string]interface{}) string {
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = len([]rune(column))
+		for _, row := range rows {
+			if w := len([]rune(Value(row[column]))); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	line := func(values []string) string {
+		cells := make([]string, len(values))
+		for i, v := range values {
+			cells[i] = v + strings.Repeat(" ", widths[i]-len([]rune(v)))
+		}
+		return strings.TrimRight(strings.Join(cells, " | "), " ")
+	}
+
+	lines := []string{line(columns)}
+	separators := make([]string, len(widths))
+	for i, w := range widths {
+		separators[i] = strings.Repeat("-", w)
+	}
+	lines = append(lines, strings.Join(separators, "-+-"))
+	for _, row := range rows {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = Value(row[column])
+		}
+		lines = append(lines, line(values))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CSV renders rows as a CSV file with a header line
+func CSV(columns []string, rows []map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(columns); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = Value(row[column])
+		}
+		if err := w.Write(values); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,97 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/target/flottbot/awsauth"
+)
+
+// AWSSecretsManager fetches secrets from AWS Secrets Manager.
+// Requests are signed with AWS Signature Version 4.
+type AWSSecretsManager struct {
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	endpoint     string
+	client       *http.Client
+	now          func() time.Time
+}
+
+// validate that AWSSecretsManager adheres to provider interface
+var _ Provider = (*AWSSecretsManager)(nil)
+
+// NewAWSSecretsManager creates a provider for Secrets Manager in the given region.
+// The session token is only needed for temporary credentials.
+func NewAWSSecretsManager(region, accessKey, secretKey, sessionToken string) *AWSSecretsManager {
+	return &AWSSecretsManager{
+		region:       region,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: sessionToken,
+		endpoint:     "https://secretsmanager." + region + ".amazonaws.com/",
+		client:       &http.Client{Timeout: 10 * time.Second},
+		now:          time.Now,
+	}
+}
+
+// Fetch implementation to satisfy provider interface.
+// Secrets holding a JSON object expose each of its fields as a key; the whole secret
+// is always available under the empty key.
+func (a *AWSSecretsManager) Fetch(name string) (map[string]string, time.Duration, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return nil, 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, a.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.sign(req, body)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("AWS Secrets Manager returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(respBody, &secret); err != nil {
+		return nil, 0, err
+	}
+
+	values := map[string]string{"": secret.SecretString}
+	var fields map[string]interface{}
+	if json.Unmarshal([]byte(secret.SecretString), &fields) == nil {
+		for k, v := range fields {
+			values[k] = fmt.Sprint(v)
+		}
+	}
+	return values, 0, nil
+}
+
+// sign adds AWS Signature Version 4 headers to a request
+func (a *AWSSecretsManager) sign(req *http.Request, body []byte) {
+	awsauth.Sign(req, body, "secretsmanager", a.region, awsauth.Credentials{
+		AccessKey:    a.accessKey,
+		SecretKey:    a.secretKey,
+		SessionToken: a.sessionToken,
+	}, a.now())
+}
@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTTL is how long secrets without a lease are cached before being fetched again
+const defaultTTL = 15 * time.Minute
+
+// Provider fetches secrets from a secrets manager.
+// A secret is a set of key/value pairs; the returned duration is how long the values
+// may be used before they must be fetched again (0 if the secret has no lease).
+type Provider interface {
+	Fetch(path string) (map[string]string, time.Duration, error)
+}
+
+// cachedSecret is a fetched secret and when it must be fetched again
+type cachedSecret struct {
+	values  map[string]string
+	expires time.Time
+}
+
+// Resolver resolves secret references of the form '<scheme>:<path>#<key>',
+// e.g. 'vault:secret/data/flottbot#slack_token' or 'awssm:flottbot/slack',
+// caching secrets until their lease expires
+type Resolver struct {
+	mu        sync.Mutex
+	providers map[string]Provider
+	cache     map[string]cachedSecret
+}
+
+// NewResolver creates a resolver without any providers
+func NewResolver() *Resolver {
+	return &Resolver{
+		providers: make(map[string]Provider),
+		cache:     make(map[string]cachedSecret),
+	}
+}
+
+// Register makes a provider available for references using the given scheme
+func (r *Resolver) Register(scheme string, provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[scheme] = provider
+}
+
+// Resolve looks up the value a secret reference points to.
+// The key may be omitted for secrets holding a single value.
+func (r *Resolver) Resolve(ref string) (string, error) {
+	scheme, path, key, err := parseReference(ref)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	provider, ok := r.providers[scheme]
+	if !ok {
+		return "", fmt.Errorf("Secret '%s' uses '%s', which has not been configured", ref, scheme)
+	}
+
+	cacheKey := scheme + ":" + path
+	secret, ok := r.cache[cacheKey]
+	if !ok || time.Now().After(secret.expires) {
+		values, ttl, err := provider.Fetch(path)
+		if err != nil {
+			return "", fmt.Errorf("Could not fetch secret '%s': %s", ref, err.Error())
+		}
+		if ttl <= 0 {
+			ttl = defaultTTL
+		}
+		secret = cachedSecret{values: values, expires: time.Now().Add(ttl)}
+		r.cache[cacheKey] = secret
+	}
+
+	if value, ok := secret.values[key]; ok {
+		return value, nil
+	}
+	if len(key) == 0 {
+		if len(secret.values) == 1 {
+			for _, value := range secret.values {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("Secret '%s' holds %d values, add '#<key>' to pick one", ref, len(secret.values))
+	}
+	return "", fmt.Errorf("Secret '%s' has no key '%s'", path, key)
+}
+
+// parseReference splits a secret reference into its scheme, path, and optional key
+func parseReference(ref string) (scheme, path, key string, err error) {
+	parts := strings.SplitN(strings.TrimSpace(ref), ":", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		return "", "", "", fmt.Errorf("Invalid secret reference '%s', expected '<scheme>:<path>#<key>'", ref)
+	}
+	scheme, path = parts[0], parts[1]
+	if i := strings.LastIndex(path, "#"); i >= 0 {
+		path, key = path[:i], path[i+1:]
+	}
+	return scheme, path, key, nil
+}
@@ -0,0 +1,136 @@
+package secrets
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProvider counts fetches and serves fixed values
+type fakeProvider struct {
+	values  map[string]string
+	ttl     time.Duration
+	fetches int
+}
+
+func (f *fakeProvider) Fetch(path string) (map[string]string, time.Duration, error) {
+	f.fetches++
+	if path != "bot" {
+		return nil, 0, errors.New("not found")
+	}
+	return f.values, f.ttl, nil
+}
+
+func TestResolve(t *testing.T) {
+	multi := &fakeProvider{values: map[string]string{"token": "abc", "key": "def"}, ttl: time.Hour}
+	single := &fakeProvider{values: map[string]string{"token": "xyz"}, ttl: -1}
+	r := NewResolver()
+	r.Register("vault", multi)
+	r.Register("awssm", single)
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"Key", "vault:bot#token", "abc", false},
+		{"Other key", "vault:bot#key", "def", false},
+		{"Missing key", "vault:bot#nope", "", true},
+		{"Ambiguous", "vault:bot", "", true},
+		{"Single value", "awssm:bot", "xyz", false},
+		{"Unknown path", "vault:nope#token", "", true},
+		{"Unknown scheme", "gcp:bot#token", "", true},
+		{"Invalid", "vault:", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// one fetch for 'bot', which is then cached, and one for the unknown path
+	if multi.fetches != 2 {
+		t.Errorf("vault secrets were fetched %d times, want 2", multi.fetches)
+	}
+
+	// expire the lease
+	r.cache["vault:bot"] = cachedSecret{values: multi.values, expires: time.Now().Add(-time.Second)}
+	r.Resolve("vault:bot#token")
+	if multi.fetches != 3 {
+		t.Errorf("expired secret was not fetched again")
+	}
+}
+
+func TestVault(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/bot":
+			w.Write([]byte(`{"lease_duration":0,"data":{"data":{"token":"abc"},"metadata":{"version":3}}}`))
+		case "/v1/database/creds/bot":
+			w.Write([]byte(`{"lease_duration":3600,"data":{"username":"bot","password":"pw"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer ts.Close()
+
+	v := NewVault(ts.URL, "root")
+	values, ttl, err := v.Fetch("secret/data/bot")
+	if err != nil || values["token"] != "abc" || ttl != 0 {
+		t.Errorf("Fetch(kv v2) = %v, %v, %v", values, ttl, err)
+	}
+	values, ttl, err = v.Fetch("database/creds/bot")
+	if err != nil || values["password"] != "pw" || ttl != time.Hour {
+		t.Errorf("Fetch(dynamic) = %v, %v, %v", values, ttl, err)
+	}
+	if _, _, err := v.Fetch("secret/data/missing"); err == nil {
+		t.Error("Fetch() expected an error for a missing secret")
+	}
+	if _, _, err := NewVault(ts.URL, "wrong").Fetch("secret/data/bot"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Fetch() error = %v, want permission denied", err)
+	}
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20190101/us-east-1/secretsmanager/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, Signature=") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"Name":"bot","SecretString":"{\"token\":\"abc\"}"}`))
+	}))
+	defer ts.Close()
+
+	a := NewAWSSecretsManager("us-east-1", "AKID", "secret", "session")
+	a.endpoint = ts.URL + "/"
+	a.now = func() time.Time { return time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	values, _, err := a.Fetch("bot")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if values["token"] != "abc" || values[""] != `{"token":"abc"}` {
+		t.Errorf("Fetch() = %v", values)
+	}
+}
@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Vault fetches secrets from HashiCorp Vault over its HTTP API.
+// Both the KV (version 1 and 2) and dynamic secrets engines are supported.
+type Vault struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// validate that Vault adheres to provider interface
+var _ Provider = (*Vault)(nil)
+
+// NewVault creates a provider for the Vault server at addr, e.g. https://vault.example.com:8200
+func NewVault(addr, token string) *Vault {
+	return &Vault{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// vaultResponse is the relevant part of a Vault secret response
+type vaultResponse struct {
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+// Fetch implementation to satisfy provider interface
+func (v *Vault) Fetch(path string) (map[string]string, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, v.addr+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	var secret vaultResponse
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return nil, 0, fmt.Errorf("Unexpected response from Vault: %s", err.Error())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("Vault returned %d: %s", resp.StatusCode, strings.Join(secret.Errors, ", "))
+	}
+
+	data := secret.Data
+	// KV version 2 nests the secret's values next to its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		values[k] = fmt.Sprint(v)
+	}
+	return values, time.Duration(secret.LeaseDuration) * time.Second, nil
+}
@@ -0,0 +1,145 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/target/flottbot/storage"
+)
+
+// openTimeout bounds how long to wait for the lock on the database file,
+// which is held exclusively by another process using the same file
+const openTimeout = 5 * time.Second
+
+// Storage keeps state in a local BoltDB file. The file can only be opened by one
+// process at a time, so this backend suits a single instance of the bot.
+type Storage struct {
+	db *bbolt.DB
+}
+
+// validate that Storage adheres to storage interface
+var _ storage.Storage = (*Storage)(nil)
+
+// New opens (or creates) the BoltDB file at path
+func New(path string) (*Storage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bbolt.Open(path, 0644, &bbolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{db: db}, nil
+}
+
+// Get implementation to satisfy storage interface
+func (s *Storage) Get(bucket, key string) ([]byte, bool, error) {
+	var value []byte
+	found := false
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		v, expires := decode(b.Get([]byte(key)))
+		if v == nil || storage.Expired(expires) {
+			return nil
+		}
+		// values are only valid for the life of the transaction
+		value = append([]byte{}, v...)
+		found = true
+		return nil
+	})
+	return value, found, err
+}
+
+// Set implementation to satisfy storage interface
+func (s *Storage) Set(bucket, key string, value []byte, ttl time.Duration) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), encode(value, storage.Expiry(ttl)))
+	})
+}
+
+// Claim implementation to satisfy storage interface
+func (s *Storage) Claim(bucket, key string, value []byte, ttl time.Duration) (bool, error) {
+	claimed := false
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		v, expires := decode(b.Get([]byte(key)))
+		if v != nil && !storage.Expired(expires) && !bytes.Equal(v, value) {
+			return nil
+		}
+		claimed = true
+		return b.Put([]byte(key), encode(value, storage.Expiry(ttl)))
+	})
+	return claimed, err
+}
+
+// Delete implementation to satisfy storage interface
+func (s *Storage) Delete(bucket, key string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// List implementation to satisfy storage interface
+func (s *Storage) List(bucket string) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, raw []byte) error {
+			v, expires := decode(raw)
+			if v != nil && !storage.Expired(expires) {
+				values[string(k)] = append([]byte{}, v...)
+			}
+			return nil
+		})
+	})
+	return values, err
+}
+
+// Close implementation to satisfy storage interface
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// encode prefixes a value with its expiry time as big-endian unix nanoseconds (0 for none)
+func encode(value []byte, expires time.Time) []byte {
+	buf := make([]byte, 8+len(value))
+	if !expires.IsZero() {
+		binary.BigEndian.PutUint64(buf, uint64(expires.UnixNano()))
+	}
+	copy(buf[8:], value)
+	return buf
+}
+
+// decode splits a stored value into its value and expiry time
+func decode(raw []byte) ([]byte, time.Time) {
+	if len(raw) < 8 {
+		return nil, time.Time{}
+	}
+	var expires time.Time
+	if n := binary.BigEndian.Uint64(raw[:8]); n > 0 {
+		expires = time.Unix(0, int64(n))
+	}
+	return raw[8:], expires
+}
@@ -0,0 +1,58 @@
+package bolt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltstorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := New(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Set("things", "a", []byte("1"), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := s.Set("things", "gone", []byte("2"), time.Nanosecond); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	time.Sleep(time.Millisecond)
+
+	got, ok, err := s.Get("things", "a")
+	if err != nil || !ok || string(got) != "1" {
+		t.Errorf("Get() = %s, %v, %v, want 1, true, nil", got, ok, err)
+	}
+	if _, ok, _ := s.Get("things", "gone"); ok {
+		t.Error("Get() found an expired value")
+	}
+	if _, ok, _ := s.Get("other", "a"); ok {
+		t.Error("Get() found a value in a bucket that was never written")
+	}
+
+	list, err := s.List("things")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := map[string][]byte{"a": []byte("1")}; !reflect.DeepEqual(list, want) {
+		t.Errorf("List() = %v, want %v", list, want)
+	}
+
+	if err := s.Delete("things", "a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, ok, _ := s.Get("things", "a"); ok {
+		t.Error("Get() found a deleted value")
+	}
+}
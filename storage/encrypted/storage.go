@@ -0,0 +1,229 @@
+package encrypted
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/storage"
+)
+
+// prefix marks encrypted values, followed by the ID of the key they're encrypted with and the
+// base64 encoded nonce and ciphertext, e.g. 'enc1:1a2b3c4d:...'. Values without it were stored
+// before encryption was turned on, and are read as they are.
+const prefix = "enc1:"
+
+// Storage encrypts the values of some buckets of another storage backend with AES-GCM, e.g. those
+// holding conversation memory and audit records. The first of its keys encrypts, all of them
+// decrypt, so keys are rotated by putting a new key first and keeping the old ones until Rotate
+// re-encrypted the values. Values are bound to their bucket and key, so they can't be swapped.
+// Claim isn't encrypted, the values it compares are left as they are.
+type Storage struct {
+	// Logf, when set, logs the values List leaves out because they can't be decrypted
+	Logf func(format string, args ...interface{})
+
+	store   storage.Storage
+	keys    []encryptionKey
+	buckets map[string]bool
+	// locks keep Rotate from overwriting what's set or deleted meanwhile, by hash of bucket and key
+	locks [64]sync.Mutex
+}
+
+// encryptionKey is a key of a Storage, with the ID stored with the values it encrypts
+type encryptionKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// validate that Storage adheres to storage interface
+var _ storage.Storage = (*Storage)(nil)
+
+// New wraps store, encrypting the values of the given buckets. Keys are 16, 24, or 32 bytes long,
+// for AES-128, AES-192, or AES-256; the first one encrypts.
+func New(store storage.Storage, keys [][]byte, buckets []string) (*Storage, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("No encryption keys were given")
+	}
+	s := &Storage{store: store, buckets: make(map[string]bool)}
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid encryption key #%d: %s", i+1, err.Error())
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(key)
+		s.keys = append(s.keys, encryptionKey{id: fmt.Sprintf("%x", sum[:4]), aead: aead})
+	}
+	for _, bucket := range buckets {
+		s.buckets[bucket] = true
+	}
+	return s, nil
+}
+
+// Get implementation to satisfy storage interface
+func (s *Storage) Get(bucket, key string) ([]byte, bool, error) {
+	value, ok, err := s.store.Get(bucket, key)
+	if err != nil || !ok || !s.buckets[bucket] {
+		return value, ok, err
+	}
+	value, err = s.decrypt(bucket, key, value)
+	return value, err == nil, err
+}
+
+// Set implementation to satisfy storage interface
+func (s *Storage) Set(bucket, key string, value []byte, ttl time.Duration) error {
+	mu := s.lock(bucket, key)
+	mu.Lock()
+	defer mu.Unlock()
+	if s.buckets[bucket] {
+		var err error
+		if value, err = s.encrypt(bucket, key, value); err != nil {
+			return err
+		}
+	}
+	return s.store.Set(bucket, key, value, ttl)
+}
+
+// Claim implementation to satisfy storage interface
+func (s *Storage) Claim(bucket, key string, value []byte, ttl time.Duration) (bool, error) {
+	mu := s.lock(bucket, key)
+	mu.Lock()
+	defer mu.Unlock()
+	return s.store.Claim(bucket, key, value, ttl)
+}
+
+// Delete implementation to satisfy storage interface
+func (s *Storage) Delete(bucket, key string) error {
+	mu := s.lock(bucket, key)
+	mu.Lock()
+	defer mu.Unlock()
+	return s.store.Delete(bucket, key)
+}
+
+// List implementation to satisfy storage interface. Values that can't be decrypted, e.g. those
+// encrypted with a key that was removed, are left out, so they don't hide the others.
+func (s *Storage) List(bucket string) (map[string][]byte, error) {
+	values, err := s.store.List(bucket)
+	if err != nil || !s.buckets[bucket] {
+		return values, err
+	}
+	for key, value := range values {
+		plain, err := s.decrypt(bucket, key, value)
+		if err != nil {
+			if s.Logf != nil {
+				s.Logf("Leaving out a value that can't be read: %s", err.Error())
+			}
+			delete(values, key)
+			continue
+		}
+		values[key] = plain
+	}
+	return values, nil
+}
+
+// Close implementation to satisfy storage interface
+func (s *Storage) Close() error {
+	return s.store.Close()
+}
+
+// Rotate re-encrypts the values of a bucket that aren't encrypted with the first key, e.g. after
+// a new key was added, or that were stored before encryption was turned on, and tells how many it
+// re-encrypted. Rewritten values don't expire, so it's meant for buckets whose values never do.
+// It can run while the bot uses the storage: each value is read again and rewritten under its lock,
+// so values set or deleted meanwhile are left alone.
+func (s *Storage) Rotate(bucket string) (int, error) {
+	values, err := s.store.List(bucket)
+	if err != nil {
+		return 0, err
+	}
+	rotated := 0
+	for key := range values {
+		ok, err := s.rotate(bucket, key)
+		if err != nil {
+			return rotated, err
+		}
+		if ok {
+			rotated++
+		}
+	}
+	return rotated, nil
+}
+
+// rotate re-encrypts a value with the first key, if it's still there and encrypted with another one
+func (s *Storage) rotate(bucket, key string) (bool, error) {
+	mu := s.lock(bucket, key)
+	mu.Lock()
+	defer mu.Unlock()
+	value, ok, err := s.store.Get(bucket, key)
+	if err != nil || !ok || bytes.HasPrefix(value, []byte(prefix+s.keys[0].id+":")) {
+		return false, err
+	}
+	plain, err := s.decrypt(bucket, key, value)
+	if err != nil {
+		return false, err
+	}
+	if value, err = s.encrypt(bucket, key, plain); err != nil {
+		return false, err
+	}
+	return true, s.store.Set(bucket, key, value, 0)
+}
+
+// lock returns the lock of a value
+func (s *Storage) lock(bucket, key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write(additionalData(bucket, key))
+	return &s.locks[h.Sum32()%uint32(len(s.locks))]
+}
+
+// encrypt encrypts a value with the first key
+func (s *Storage) encrypt(bucket, key string, value []byte) ([]byte, error) {
+	k := s.keys[0]
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := k.aead.Seal(nonce, nonce, value, additionalData(bucket, key))
+	return []byte(prefix + k.id + ":" + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// decrypt decrypts a value with the key it was encrypted with
+func (s *Storage) decrypt(bucket, key string, value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, []byte(prefix)) {
+		return value, nil
+	}
+	parts := bytes.SplitN(value[len(prefix):], []byte(":"), 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Value of '%s' in '%s' is not a valid encrypted value", key, bucket)
+	}
+	for _, k := range s.keys {
+		if k.id != string(parts[0]) {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(string(parts[1]))
+		if err != nil || len(sealed) < k.aead.NonceSize() {
+			return nil, fmt.Errorf("Value of '%s' in '%s' is not a valid encrypted value", key, bucket)
+		}
+		plain, err := k.aead.Open(nil, sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():], additionalData(bucket, key))
+		if err != nil {
+			return nil, fmt.Errorf("Could not decrypt the value of '%s' in '%s': %s", key, bucket, err.Error())
+		}
+		return plain, nil
+	}
+	return nil, fmt.Errorf("Value of '%s' in '%s' is encrypted with key %s, which is not configured", key, bucket, parts[0])
+}
+
+// additionalData binds a value to where it's stored
+func additionalData(bucket, key string) []byte {
+	return []byte(bucket + "/" + key)
+}
@@ -0,0 +1,128 @@
+package encrypted
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/target/flottbot/storage/memory"
+)
+
+var (
+	oldKey = bytes.Repeat([]byte("o"), 32)
+	newKey = bytes.Repeat([]byte("n"), 32)
+)
+
+func TestStorage(t *testing.T) {
+	backend := memory.New()
+	s, err := New(backend, [][]byte{oldKey}, []string{"memory"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := s.Set("memory", "channel:C1/db_password", []byte("hunter2"), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := s.Set("karma", "gopher", []byte("3"), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// Only the listed buckets are encrypted
+	raw, _, _ := backend.Get("memory", "channel:C1/db_password")
+	if !bytes.HasPrefix(raw, []byte(prefix)) || bytes.Contains(raw, []byte("hunter2")) {
+		t.Errorf("Set() stored %q", raw)
+	}
+	if raw, _, _ := backend.Get("karma", "gopher"); string(raw) != "3" {
+		t.Errorf("Set() stored %q in a bucket that isn't encrypted", raw)
+	}
+
+	value, ok, err := s.Get("memory", "channel:C1/db_password")
+	if err != nil || !ok || string(value) != "hunter2" {
+		t.Errorf("Get() = %q, %t, %v", value, ok, err)
+	}
+	if _, ok, err := s.Get("memory", "missing"); ok || err != nil {
+		t.Errorf("Get() of a missing key = %t, %v", ok, err)
+	}
+
+	// Values stored before encryption was turned on are read as they are
+	backend.Set("memory", "channel:C1/plain", []byte("old"), 0)
+	values, err := s.List("memory")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := map[string][]byte{"channel:C1/db_password": []byte("hunter2"), "channel:C1/plain": []byte("old")}; !reflect.DeepEqual(values, want) {
+		t.Errorf("List() = %q, want %q", values, want)
+	}
+
+	// Values can't be moved to another key
+	backend.Set("memory", "channel:C2/db_password", raw, 0)
+	if _, _, err := s.Get("memory", "channel:C2/db_password"); err == nil {
+		t.Error("Get() of a value moved to another key succeeded")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	backend := memory.New()
+	before, _ := New(backend, [][]byte{oldKey}, []string{"audit"})
+	before.Set("audit", "1", []byte("first"), 0)
+	backend.Set("audit", "2", []byte("second"), 0)
+
+	after, err := New(backend, [][]byte{newKey, oldKey}, []string{"audit"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if value, _, err := after.Get("audit", "1"); err != nil || string(value) != "first" {
+		t.Errorf("Get() with the old key = %q, %v", value, err)
+	}
+	rotated, err := after.Rotate("audit")
+	if err != nil || rotated != 2 {
+		t.Errorf("Rotate() = %d, %v, want 2", rotated, err)
+	}
+	if rotated, _ := after.Rotate("audit"); rotated != 0 {
+		t.Errorf("Rotate() again = %d, want 0", rotated)
+	}
+
+	// Once rotated, the old key isn't needed anymore
+	only, _ := New(backend, [][]byte{newKey}, []string{"audit"})
+	values, err := only.List("audit")
+	if err != nil || string(values["1"]) != "first" || string(values["2"]) != "second" {
+		t.Errorf("List() with the new key = %q, %v", values, err)
+	}
+	if _, _, err := before.Get("audit", "1"); err == nil {
+		t.Error("Get() without the new key succeeded")
+	}
+
+	// Values that can't be decrypted are left out of a list, and logged
+	logged := 0
+	before.Logf = func(format string, args ...interface{}) { logged++ }
+	before.Set("audit", "3", []byte("third"), 0)
+	values, err = before.List("audit")
+	if err != nil || len(values) != 1 || string(values["3"]) != "third" || logged != 2 {
+		t.Errorf("List() with values it can't decrypt = %q, %v, logged %d times", values, err, logged)
+	}
+}
+
+func TestRotateDeleted(t *testing.T) {
+	backend := memory.New()
+	before, _ := New(backend, [][]byte{oldKey}, []string{"memory"})
+	before.Set("memory", "gone", []byte("secret"), 0)
+
+	// A value deleted after Rotate listed the bucket stays deleted
+	after, _ := New(backend, [][]byte{newKey, oldKey}, []string{"memory"})
+	after.Delete("memory", "gone")
+	if ok, err := after.rotate("memory", "gone"); ok || err != nil {
+		t.Errorf("rotate() of a deleted value = %t, %v", ok, err)
+	}
+	if _, ok, _ := backend.Get("memory", "gone"); ok {
+		t.Error("rotate() brought a deleted value back")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(memory.New(), nil, nil); err == nil {
+		t.Error("New() without keys succeeded")
+	}
+	if _, err := New(memory.New(), [][]byte{[]byte("short")}, nil); err == nil {
+		t.Error("New() with a key of the wrong length succeeded")
+	}
+}
@@ -0,0 +1,163 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/storage"
+)
+
+// fileSuffix is appended to a bucket name to get the name of the file backing it
+const fileSuffix = ".store.json"
+
+// Storage keeps state in JSON files, one per bucket, within a directory.
+// It is the default backend and suits a single instance of the bot.
+type Storage struct {
+	mu      sync.Mutex
+	dir     string
+	buckets map[string]map[string]entry
+}
+
+// entry is the on-disk representation of a stored value
+type entry struct {
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// validate that Storage adheres to storage interface
+var _ storage.Storage = (*Storage)(nil)
+
+// New creates a file store rooted at dir, creating the directory if needed
+func New(dir string) (*Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Storage{dir: dir, buckets: make(map[string]map[string]entry)}, nil
+}
+
+// Get implementation to satisfy storage interface
+func (s *Storage) Get(bucket, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.load(bucket)
+	if err != nil {
+		return nil, false, err
+	}
+	e, ok := entries[key]
+	if !ok || storage.Expired(e.Expires) {
+		return nil, false, nil
+	}
+	return e.Value, true, nil
+}
+
+// Set implementation to satisfy storage interface
+func (s *Storage) Set(bucket, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.load(bucket)
+	if err != nil {
+		return err
+	}
+	entries[key] = entry{Value: value, Expires: storage.Expiry(ttl)}
+	return s.save(bucket, entries)
+}
+
+// Claim implementation to satisfy storage interface
+func (s *Storage) Claim(bucket, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.load(bucket)
+	if err != nil {
+		return false, err
+	}
+	if e, ok := entries[key]; ok && !storage.Expired(e.Expires) && !bytes.Equal(e.Value, value) {
+		return false, nil
+	}
+	entries[key] = entry{Value: value, Expires: storage.Expiry(ttl)}
+	return true, s.save(bucket, entries)
+}
+
+// Delete implementation to satisfy storage interface
+func (s *Storage) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.load(bucket)
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[key]; !ok {
+		return nil
+	}
+	delete(entries, key)
+	return s.save(bucket, entries)
+}
+
+// List implementation to satisfy storage interface
+func (s *Storage) List(bucket string) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.load(bucket)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte)
+	for k, e := range entries {
+		if !storage.Expired(e.Expires) {
+			values[k] = e.Value
+		}
+	}
+	return values, nil
+}
+
+// Close implementation to satisfy storage interface
+func (s *Storage) Close() error {
+	return nil
+}
+
+// load returns the entries of a bucket, reading them from disk the first time; callers must hold mu
+func (s *Storage) load(bucket string) (map[string]entry, error) {
+	if entries, ok := s.buckets[bucket]; ok {
+		return entries, nil
+	}
+	entries := make(map[string]entry)
+	b, err := ioutil.ReadFile(s.path(bucket))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &entries); err != nil {
+			return nil, err
+		}
+	}
+	s.buckets[bucket] = entries
+	return entries, nil
+}
+
+// save writes the entries of a bucket to disk, dropping expired ones; callers must hold mu
+func (s *Storage) save(bucket string, entries map[string]entry) error {
+	for k, e := range entries {
+		if storage.Expired(e.Expires) {
+			delete(entries, k)
+		}
+	}
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash can't leave a half-written bucket behind
+	tmp := s.path(bucket) + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(bucket))
+}
+
+// path returns the file backing a bucket
+func (s *Storage) path(bucket string) string {
+	return filepath.Join(s.dir, bucket+fileSuffix)
+}
@@ -0,0 +1,72 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestorage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := New(dir)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := s.Set("things", "a", []byte("1"), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := s.Set("things", "b", []byte("2"), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := s.Set("things", "gone", []byte("3"), time.Nanosecond); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := s.Delete("things", "b"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	time.Sleep(time.Millisecond)
+
+	// a new store on the same directory should see the persisted values
+	reopened, err := New(dir)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		key       string
+		wantValue []byte
+		wantOk    bool
+	}{
+		{"Stored value", "a", []byte("1"), true},
+		{"Deleted value", "b", nil, false},
+		{"Expired value", "gone", nil, false},
+		{"Missing value", "nope", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := reopened.Get("things", tt.key)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.wantValue) || ok != tt.wantOk {
+				t.Errorf("Get() = %s, %v, want %s, %v", got, ok, tt.wantValue, tt.wantOk)
+			}
+		})
+	}
+
+	list, err := reopened.List("things")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := map[string][]byte{"a": []byte("1")}; !reflect.DeepEqual(list, want) {
+		t.Errorf("List() = %v, want %v", list, want)
+	}
+}
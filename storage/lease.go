@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// leaseBucket is the bucket holding all leases
+const leaseBucket = "leases"
+
+// Lease is a named, time-limited claim that at most one owner holds at a time.
+// Replicas of the bot sharing a backend use leases to elect a single leader, e.g. for running schedules.
+type Lease struct {
+	store Storage
+	name  string
+	owner string
+	ttl   time.Duration
+	held  int32
+}
+
+// NewLease creates a lease called name that owner will try to hold.
+// An owner that stops renewing the lease loses it after ttl.
+func NewLease(store Storage, name, owner string, ttl time.Duration) *Lease {
+	return &Lease{store: store, name: name, owner: owner, ttl: ttl}
+}
+
+// Held reports whether the owner held the lease when it last tried to acquire or renew it
+func (l *Lease) Held() bool {
+	return atomic.LoadInt32(&l.held) == 1
+}
+
+// Renew tries to acquire the lease, or extend it if the owner already holds it, and reports whether it is held
+func (l *Lease) Renew() (bool, error) {
+	held, err := l.store.Claim(leaseBucket, l.name, []byte(l.owner), l.ttl)
+	if err != nil {
+		// without being able to reach the backend we can't be sure nobody else took over
+		held = false
+	}
+	if held {
+		atomic.StoreInt32(&l.held, 1)
+	} else {
+		atomic.StoreInt32(&l.held, 0)
+	}
+	return held, err
+}
+
+// Run keeps renewing the lease well before it expires, until stop is closed.
+// onChange, if set, is called whenever the owner gains or loses the lease.
+func (l *Lease) Run(stop <-chan struct{}, onChange func(held bool, err error)) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		wasHeld := l.Held()
+		held, err := l.Renew()
+		if onChange != nil && (held != wasHeld || err != nil) {
+			onChange(held, err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
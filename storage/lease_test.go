@@ -0,0 +1,34 @@
+package storage_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/target/flottbot/storage"
+	"github.com/target/flottbot/storage/memory"
+)
+
+func TestLease(t *testing.T) {
+	store := memory.New()
+	first := storage.NewLease(store, "scheduler", "replica-1", 50*time.Millisecond)
+	second := storage.NewLease(store, "scheduler", "replica-2", 50*time.Millisecond)
+
+	if held, _ := first.Renew(); !held {
+		t.Fatal("first owner should acquire a free lease")
+	}
+	if held, _ := second.Renew(); held {
+		t.Fatal("second owner should not acquire a lease that is held")
+	}
+	if held, _ := first.Renew(); !held {
+		t.Fatal("first owner should be able to renew its own lease")
+	}
+
+	// the first owner stops renewing, so the lease expires and can be taken over
+	time.Sleep(60 * time.Millisecond)
+	if held, _ := second.Renew(); !held {
+		t.Fatal("second owner should acquire an expired lease")
+	}
+	if held, _ := first.Renew(); held || first.Held() {
+		t.Fatal("first owner should have lost the lease")
+	}
+}
@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/storage"
+)
+
+// Storage keeps state in process memory; nothing survives a restart
+type Storage struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string]entry
+}
+
+// entry is a stored value along with its expiry time
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+// validate that Storage adheres to storage interface
+var _ storage.Storage = (*Storage)(nil)
+
+// New creates an empty in-memory store
+func New() *Storage {
+	return &Storage{buckets: make(map[string]map[string]entry)}
+}
+
+// Get implementation to satisfy storage interface
+func (s *Storage) Get(bucket, key string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.buckets[bucket][key]
+	if !ok || storage.Expired(e.expires) {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// Set implementation to satisfy storage interface
+func (s *Storage) Set(bucket, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = make(map[string]entry)
+	}
+	s.buckets[bucket][key] = entry{value: value, expires: storage.Expiry(ttl)}
+	return nil
+}
+
+// Claim implementation to satisfy storage interface
+func (s *Storage) Claim(bucket, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.buckets[bucket][key]; ok && !storage.Expired(e.expires) && !bytes.Equal(e.value, value) {
+		return false, nil
+	}
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = make(map[string]entry)
+	}
+	s.buckets[bucket][key] = entry{value: value, expires: storage.Expiry(ttl)}
+	return true, nil
+}
+
+// Delete implementation to satisfy storage interface
+func (s *Storage) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets[bucket], key)
+	return nil
+}
+
+// List implementation to satisfy storage interface
+func (s *Storage) List(bucket string) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := make(map[string][]byte)
+	for k, e := range s.buckets[bucket] {
+		if storage.Expired(e.expires) {
+			delete(s.buckets[bucket], k)
+			continue
+		}
+		values[k] = e.value
+	}
+	return values, nil
+}
+
+// Close implementation to satisfy storage interface
+func (s *Storage) Close() error {
+	return nil
+}
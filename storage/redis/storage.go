@@ -0,0 +1,305 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/target/flottbot/storage"
+)
+
+// keyPrefix namespaces all keys written by the bot
+const keyPrefix = "flottbot"
+
+// dialTimeout bounds how long connecting to Redis may take
+const dialTimeout = 5 * time.Second
+
+// ioTimeout bounds how long sending a command to Redis and reading its reply may take
+const ioTimeout = 5 * time.Second
+
+// Storage keeps state in Redis, which lets several replicas of the bot share it.
+// It speaks the Redis protocol (RESP) directly over a single connection.
+type Storage struct {
+	mu       sync.Mutex
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	conn     net.Conn
+	reader   *bufio.Reader
+}
+
+// validate that Storage adheres to storage interface
+var _ storage.Storage = (*Storage)(nil)
+
+// New connects to the Redis server at the given URL, e.g. redis://:password@localhost:6379/0
+func New(rawURL string) (*Storage, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("Unsupported Redis URL scheme '%s'", u.Scheme)
+	}
+
+	s := &Storage{addr: u.Host, timeout: ioTimeout}
+	if !strings.Contains(s.addr, ":") {
+		s.addr = s.addr + ":6379"
+	}
+	if u.User != nil {
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); len(db) > 0 {
+		s.db, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Redis database '%s'", db)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get implementation to satisfy storage interface
+func (s *Storage) Get(bucket, key string) ([]byte, bool, error) {
+	reply, err := s.do("GET", redisKey(bucket, key))
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	return reply.([]byte), true, nil
+}
+
+// Set implementation to satisfy storage interface
+func (s *Storage) Set(bucket, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", redisKey(bucket, key), string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+	_, err := s.do(args...)
+	return err
+}
+
+// claimScript atomically sets a key if it is missing or already holds the given value
+const claimScript = `
+local current = redis.call('GET', KEYS[1])
+if current and current ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`
+
+// Claim implementation to satisfy storage interface
+func (s *Storage) Claim(bucket, key string, value []byte, ttl time.Duration) (bool, error) {
+	ttlMillis := strconv.FormatInt(int64(ttl/time.Millisecond), 10)
+	reply, err := s.do("EVAL", claimScript, "1", redisKey(bucket, key), string(value), ttlMillis)
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+// Delete implementation to satisfy storage interface
+func (s *Storage) Delete(bucket, key string) error {
+	_, err := s.do("DEL", redisKey(bucket, key))
+	return err
+}
+
+// List implementation to satisfy storage interface
+func (s *Storage) List(bucket string) (map[string][]byte, error) {
+	prefix := redisKey(bucket, "")
+	values := make(map[string][]byte)
+	cursor := "0"
+	for {
+		reply, err := s.do("SCAN", cursor, "MATCH", prefix+"*", "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			return nil, errors.New("Unexpected reply to Redis SCAN")
+		}
+		cursor = string(page[0].([]byte))
+		keys, _ := page[1].([]interface{})
+		for _, k := range keys {
+			key := string(k.([]byte))
+			value, err := s.do("GET", key)
+			if err != nil {
+				return nil, err
+			}
+			// the key may have expired between SCAN and GET
+			if value != nil {
+				values[strings.TrimPrefix(key, prefix)] = value.([]byte)
+			}
+		}
+		if cursor == "0" {
+			return values, nil
+		}
+	}
+}
+
+// Close implementation to satisfy storage interface
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// connect dials Redis, authenticates, and selects the database; callers must hold mu
+func (s *Storage) connect() error {
+	conn, err := net.DialTimeout("tcp", s.addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+	if len(s.password) > 0 {
+		if _, _, err := s.roundTrip("AUTH", s.password); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	if s.db > 0 {
+		if _, _, err := s.roundTrip("SELECT", strconv.Itoa(s.db)); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends a command, reconnecting if the connection was lost. The command is only sent again
+// if none of it reached the connection, as Redis may have run it even if its reply never came.
+func (s *Storage) do(args ...string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return nil, err
+		}
+	}
+	reply, sent, err := s.roundTrip(args...)
+	if !connectionLost(err) {
+		return reply, err
+	}
+	// The reply may still arrive, so the connection can't be used for the next command
+	s.conn.Close()
+	s.conn = nil
+	if sent {
+		return nil, err
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	reply, _, err = s.roundTrip(args...)
+	if connectionLost(err) {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return reply, err
+}
+
+// roundTrip writes a command and reads its reply, and tells whether any of the command was written;
+// callers must hold mu
+func (s *Storage) roundTrip(args ...string) (interface{}, bool, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := s.conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		return nil, false, err
+	}
+	if n, err := io.WriteString(s.conn, b.String()); err != nil {
+		return nil, n > 0, err
+	}
+	reply, err := readReply(s.reader)
+	return reply, true, err
+}
+
+// connectionLost tells whether an error means the connection to Redis broke or timed out
+func connectionLost(err error) bool {
+	_, isNetErr := err.(net.Error)
+	return isNetErr || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// readReply parses a single RESP reply; bulk strings are returned as []byte and nil replies as nil
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("Empty reply from Redis")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("Redis error: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2) // include trailing \r\n
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("Unexpected reply from Redis: %q", line)
+	}
+}
+
+// redisKey builds the namespaced Redis key for a bucket and key
+func redisKey(bucket, key string) string {
+	return keyPrefix + ":" + bucket + ":" + key
+}
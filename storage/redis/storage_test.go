@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    interface{}
+		wantErr bool
+	}{
+		{"Simple string", "+OK\r\n", "OK", false},
+		{"Error", "-ERR unknown command\r\n", nil, true},
+		{"Integer", ":42\r\n", int64(42), false},
+		{"Bulk string", "$5\r\nhello\r\n", []byte("hello"), false},
+		{"Nil bulk string", "$-1\r\n", nil, false},
+		{"Array", "*2\r\n$1\r\n0\r\n*1\r\n$3\r\nkey\r\n", []interface{}{[]byte("0"), []interface{}{[]byte("key")}}, false},
+		{"Garbage", "?what\r\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readReply(bufio.NewReader(strings.NewReader(tt.raw)))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readReply() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readReply() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeRedis accepts connections and reads a command on each, answering it with reply, or not at all
+// if reply is empty; it counts the commands it read
+func fakeRedis(t *testing.T, reply string) (net.Listener, *int64) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := new(int64)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					if _, err := readReply(r); err != nil {
+						return
+					}
+					atomic.AddInt64(commands, 1)
+					if len(reply) == 0 {
+						time.Sleep(time.Second)
+						return
+					}
+					conn.Write([]byte(reply))
+				}
+			}()
+		}
+	}()
+	return ln, commands
+}
+
+func TestDo(t *testing.T) {
+	t.Run("Reply", func(t *testing.T) {
+		ln, commands := fakeRedis(t, ":1\r\n")
+		defer ln.Close()
+		s := &Storage{addr: ln.Addr().String(), timeout: time.Second}
+		defer s.Close()
+		if reply, err := s.do("DEL", "key"); err != nil || reply != int64(1) || atomic.LoadInt64(commands) != 1 {
+			t.Errorf("do() = %v, %v after %d commands, want 1 after 1", reply, err, atomic.LoadInt64(commands))
+		}
+	})
+
+	t.Run("No reply", func(t *testing.T) {
+		ln, commands := fakeRedis(t, "")
+		defer ln.Close()
+		s := &Storage{addr: ln.Addr().String(), timeout: 100 * time.Millisecond}
+		defer s.Close()
+		start := time.Now()
+		if _, err := s.do("SET", "key", "value", "NX"); err == nil {
+			t.Error("do() without a reply should fail")
+		}
+		if took := time.Since(start); took > time.Second {
+			t.Errorf("do() took %s, want it to give up after its timeout", took)
+		}
+		time.Sleep(200 * time.Millisecond)
+		if n := atomic.LoadInt64(commands); n != 1 {
+			t.Errorf("do() sent the command %d times, want it sent once as Redis may have run it", n)
+		}
+		if s.conn != nil {
+			t.Error("do() kept the connection whose reply may still arrive")
+		}
+	})
+
+	t.Run("Closed connection", func(t *testing.T) {
+		ln, commands := fakeRedis(t, "+OK\r\n")
+		defer ln.Close()
+		s := &Storage{addr: ln.Addr().String(), timeout: time.Second}
+		defer s.Close()
+		if err := s.connect(); err != nil {
+			t.Fatal(err)
+		}
+		s.conn.Close()
+		if reply, err := s.do("PING"); err != nil || reply != "OK" || atomic.LoadInt64(commands) != 1 {
+			t.Errorf("do() = %v, %v after %d commands, want it sent again on a new connection", reply, err, atomic.LoadInt64(commands))
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package storage
+
+import "time"
+
+// Storage - this interface allows the bot to persist state (e.g. conversation memory,
+// paused schedules, or dedup caches) without caring where it is kept.
+// Values are grouped into buckets, and each backend (e.g. see '/storage/redis/storage.go')
+// decides how buckets and keys map onto its own data model.
+// A backend shared by several replicas of the bot lets them share state.
+type Storage interface {
+	// Get returns the value stored under key in bucket, and whether it was found
+	Get(bucket, key string) ([]byte, bool, error)
+
+	// Set stores value under key in bucket; a ttl of 0 means the value never expires
+	Set(bucket, key string, value []byte, ttl time.Duration) error
+
+	// Claim stores value under key in bucket only if the key is missing, expired, or already
+	// holds the same value, and reports whether it did. It is atomic across everything sharing
+	// the backend, which makes it suitable for deduplication and leases.
+	Claim(bucket, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// Delete removes key from bucket; deleting a missing key is not an error
+	Delete(bucket, key string) error
+
+	// List returns all unexpired key/value pairs in bucket
+	List(bucket string) (map[string][]byte, error)
+
+	// Close releases any resources held by the backend
+	Close() error
+}
+
+// Expired reports whether a value with the given expiry time has expired.
+// A zero expiry time never expires.
+func Expired(expires time.Time) bool {
+	return !expires.IsZero() && time.Now().After(expires)
+}
+
+// Expiry converts a ttl into an absolute expiry time; a ttl of 0 never expires
+func Expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
@@ -0,0 +1,208 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// batchSize is the number of spans sent to the collector at once
+	batchSize = 100
+	// flushInterval is the longest a finished span waits before being sent
+	flushInterval = 5 * time.Second
+	// queueSize is the number of finished spans buffered before new ones are dropped
+	queueSize = 1000
+)
+
+// exporter sends finished spans to an OpenTelemetry collector using OTLP over HTTP (JSON encoding)
+type exporter struct {
+	endpoint    string
+	serviceName string
+	headers     map[string]string
+	client      *http.Client
+	queue       chan *Span
+	onError     func(error)
+}
+
+var (
+	exporterMu sync.RWMutex
+	current    *exporter
+)
+
+// Configure starts exporting spans to the OTLP/HTTP endpoint of an OpenTelemetry collector,
+// e.g. http://otel-collector:4318. Spans are reported under serviceName, and headers
+// (e.g. for authentication) are added to every export request. Export errors are passed to onError.
+func Configure(endpoint, serviceName string, headers map[string]string, onError func(error)) {
+	e := &exporter{
+		endpoint:    strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		serviceName: serviceName,
+		headers:     headers,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan *Span, queueSize),
+		onError:     onError,
+	}
+	go e.run()
+
+	exporterMu.Lock()
+	current = e
+	exporterMu.Unlock()
+}
+
+// export queues a finished span, dropping it if the exporter can't keep up
+func export(s *Span) {
+	exporterMu.RLock()
+	e := current
+	exporterMu.RUnlock()
+	if e == nil {
+		return
+	}
+	select {
+	case e.queue <- s:
+	default:
+	}
+}
+
+// run batches queued spans and sends them to the collector
+func (e *exporter) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := []*Span{}
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := e.send(batch); err != nil && e.onError != nil {
+			e.onError(err)
+		}
+		batch = []*Span{}
+	}
+}
+
+// send posts a batch of spans to the collector
+func (e *exporter) send(batch []*Span) error {
+	body, err := json.Marshal(e.payload(batch))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Trace collector returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP JSON data structures, see https://github.com/open-telemetry/opentelemetry-proto
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// payload converts a batch of spans into an OTLP export request
+func (e *exporter) payload(batch []*Span) otlpRequest {
+	spans := []otlpSpan{}
+	for _, s := range batch {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              1, // internal
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        attributes(s.attributes),
+			Status:            otlpStatus{Code: 1}, // ok
+		}
+		if len(s.err) > 0 {
+			span.Status = otlpStatus{Code: 2, Message: s.err} // error
+		}
+		s.mu.Unlock()
+		spans = append(spans, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attributes(map[string]string{"service.name": e.serviceName})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "flottbot"}, Spans: spans}},
+	}}}
+}
+
+// attributes converts a map into sorted OTLP attributes
+func attributes(m map[string]string) []otlpAttribute {
+	attrs := []otlpAttribute{}
+	for k, v := range m {
+		attrs = append(attrs, otlpAttribute{Key: k, Value: otlpValue{StringValue: v}})
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Key < attrs[j].Key
+	})
+	return attrs
+}
@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Span is a timed operation within a trace, e.g. reading a message or running an action.
+// Spans are cheap to create even when no exporter is configured, so trace IDs
+// can always be propagated to downstream services.
+type Span struct {
+	mu         sync.Mutex
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        string
+	ended      bool
+}
+
+// traceParentPattern matches a W3C trace context 'traceparent' header, e.g. 00-<trace id>-<span id>-01
+var traceParentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// Start begins a span named name. The parent is the 'traceparent' of the enclosing span;
+// an empty or invalid parent starts a new trace.
+func Start(parent, name string) *Span {
+	span := &Span{
+		spanID:     randomHex(8),
+		name:       name,
+		start:      time.Now(),
+		attributes: make(map[string]string),
+	}
+	if m := traceParentPattern.FindStringSubmatch(parent); m != nil {
+		span.traceID = m[1]
+		span.parentID = m[2]
+	} else {
+		span.traceID = randomHex(16)
+	}
+	return span
+}
+
+// TraceParent returns the W3C trace context 'traceparent' value identifying the span,
+// to be passed on to child spans and outbound requests
+func (s *Span) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.traceID, s.spanID)
+}
+
+// TraceID returns the ID of the trace the span belongs to
+func (s *Span) TraceID() string {
+	return s.traceID
+}
+
+// SetAttribute records a key/value pair describing the span
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed; a nil error is ignored
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End finishes the span and hands it to the exporter, if one is configured.
+// Ending a span more than once has no effect.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	export(s)
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms; fall back to the clock just in case
+		return fmt.Sprintf("%0*x", n*2, time.Now().UnixNano())[:n*2]
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	root := Start("", "root")
+	if !traceParentPattern.MatchString(root.TraceParent()) {
+		t.Fatalf("TraceParent() = %s, not a valid traceparent", root.TraceParent())
+	}
+	if root.parentID != "" {
+		t.Errorf("root span has parent %s", root.parentID)
+	}
+
+	child := Start(root.TraceParent(), "child")
+	if child.TraceID() != root.TraceID() {
+		t.Errorf("child TraceID() = %s, want %s", child.TraceID(), root.TraceID())
+	}
+	if child.parentID != root.spanID {
+		t.Errorf("child parent = %s, want %s", child.parentID, root.spanID)
+	}
+
+	orphan := Start("not-a-traceparent", "orphan")
+	if orphan.TraceID() == root.TraceID() || orphan.parentID != "" {
+		t.Errorf("invalid parent should start a new trace")
+	}
+}
+
+func TestExport(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer ts.Close()
+
+	e := &exporter{
+		endpoint:    ts.URL + "/v1/traces",
+		serviceName: "testbot",
+		headers:     map[string]string{"X-Api-Key": "secret"},
+		client:      ts.Client(),
+	}
+
+	span := Start("", "rule hello")
+	span.SetAttribute("rule.name", "hello")
+	span.SetError(errors.New("boom"))
+	span.End()
+
+	if err := e.send([]*Span{span}); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+
+	var req otlpRequest
+	if err := json.Unmarshal(<-bodies, &req); err != nil {
+		t.Fatal(err)
+	}
+	got := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if got.Name != "rule hello" || got.TraceID != span.TraceID() || got.Status.Code != 2 {
+		t.Errorf("exported span = %+v", got)
+	}
+	if !regexp.MustCompile(`^[0-9]+$`).MatchString(got.StartTimeUnixNano) {
+		t.Errorf("StartTimeUnixNano = %s", got.StartTimeUnixNano)
+	}
+	if len(got.Attributes) != 1 || got.Attributes[0].Value.StringValue != "hello" {
+		t.Errorf("exported attributes = %+v", got.Attributes)
+	}
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envRefPattern matches references to environment variables: ${NAME}, ${NAME:-default}, and ${NAME:?message}
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:-|:\?)([^}]*))?\}`)
+
+// ExpandEnv replaces the references to environment variables in the configuration fields of v, i.e.
+// the fields with a 'mapstructure' tag and the structs, lists, and maps in them:
+//
+//	${NAME:-default}: the variable's value, or the default if it isn't set (or empty)
+//	${NAME:?message}: the variable's value; the variable is required, so it's an error if it isn't set
+//	${NAME}: the variable's value if it's set, with plain set to true; otherwise it's left as it is
+//
+// Rules expand only the first two forms when they're loaded, since ${name} may as well be a variable of
+// the message they're triggered by (those are looked up in the environment when the rule runs).
+// The error lists all required variables that aren't set. $${...} is never expanded.
+func ExpandEnv(v interface{}, plain bool) error {
+	missing := make(map[string]string)
+	MapStrings(v, func(s string) string {
+		return expandEnvString(s, plain, missing)
+	})
+	if len(missing) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := make([]string, 0, len(names))
+	for _, name := range names {
+		if len(missing[name]) > 0 {
+			errs = append(errs, fmt.Sprintf("%s (%s)", name, missing[name]))
+			continue
+		}
+		errs = append(errs, name)
+	}
+	return fmt.Errorf("Required environment variables are not set: %s", strings.Join(errs, ", "))
+}
+
+// MapStrings replaces every string in the configuration fields of v, i.e. the fields with a
+// 'mapstructure' tag and the structs, lists, and maps in them, with what fn returns for it
+func MapStrings(v interface{}, fn func(string) string) {
+	mapStrings(reflect.ValueOf(v), fn)
+}
+
+// mapStrings replaces the strings in a value
+func mapStrings(v reflect.Value, fn func(string) string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			mapStrings(v.Elem(), fn)
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		// Strings in interfaces, e.g. in maps of arbitrary YAML, can't be changed in place
+		if s, ok := v.Interface().(string); ok {
+			if v.CanSet() {
+				v.Set(reflect.ValueOf(fn(s)))
+			}
+			return
+		}
+		mapStrings(v.Elem(), fn)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if _, ok := t.Field(i).Tag.Lookup("mapstructure"); !ok || !v.Field(i).CanSet() {
+				continue
+			}
+			mapStrings(v.Field(i), fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			mapStrings(v.Index(i), fn)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			// Map values can't be changed in place, so they're replaced in a copy
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			mapStrings(value, fn)
+			v.SetMapIndex(key, value)
+		}
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(fn(v.String()))
+		}
+	}
+}
+
+// expandEnvString expands the references to environment variables in a string
+func expandEnvString(value string, plain bool, missing map[string]string) string {
+	var result strings.Builder
+	last := 0
+	for _, loc := range envRefPattern.FindAllStringSubmatchIndex(value, -1) {
+		// $${...} is escaped
+		if loc[0] > 0 && value[loc[0]-1] == '$' {
+			continue
+		}
+		name := value[loc[2]:loc[3]]
+		env, set := os.LookupEnv(name)
+		replacement := value[loc[0]:loc[1]]
+		switch {
+		case loc[4] < 0:
+			if plain && set {
+				replacement = env
+			}
+		case value[loc[4]:loc[5]] == ":-":
+			replacement = env
+			if len(env) == 0 {
+				replacement = value[loc[6]:loc[7]]
+			}
+		default:
+			replacement = env
+			if len(env) == 0 {
+				missing[name] = value[loc[6]:loc[7]]
+			}
+		}
+		result.WriteString(value[last:loc[0]])
+		result.WriteString(replacement)
+		last = loc[1]
+	}
+	result.WriteString(value[last:])
+	return result.String()
+}
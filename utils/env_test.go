@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+type envTestAction struct {
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+type envTestConfig struct {
+	Token   string                 `mapstructure:"token"`
+	Rooms   []string               `mapstructure:"rooms"`
+	Actions []envTestAction        `mapstructure:"actions"`
+	Extra   map[string]interface{} `mapstructure:"extra"`
+	Skipped string
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("FLOTTBOT_TEST_TOKEN", "s3cr3t")
+	os.Setenv("FLOTTBOT_TEST_HOST", "api.example.com")
+	os.Setenv("FLOTTBOT_TEST_EMPTY", "")
+	defer os.Unsetenv("FLOTTBOT_TEST_TOKEN")
+	defer os.Unsetenv("FLOTTBOT_TEST_HOST")
+	defer os.Unsetenv("FLOTTBOT_TEST_EMPTY")
+
+	tests := []struct {
+		name    string
+		config  envTestConfig
+		plain   bool
+		want    envTestConfig
+		wantErr string
+	}{
+		{
+			"Plain references in bot config",
+			envTestConfig{Token: "${FLOTTBOT_TEST_TOKEN}", Rooms: []string{"${FLOTTBOT_TEST_UNSET}"}, Skipped: "${FLOTTBOT_TEST_TOKEN}"},
+			true,
+			envTestConfig{Token: "s3cr3t", Rooms: []string{"${FLOTTBOT_TEST_UNSET}"}, Skipped: "${FLOTTBOT_TEST_TOKEN}"},
+			"",
+		},
+		{
+			"Plain references in rules are left for the message",
+			envTestConfig{Token: "${FLOTTBOT_TEST_TOKEN} ${service} ${_user.name}"},
+			false,
+			envTestConfig{Token: "${FLOTTBOT_TEST_TOKEN} ${service} ${_user.name}"},
+			"",
+		},
+		{
+			"Defaults",
+			envTestConfig{
+				Actions: []envTestAction{{
+					URL:     "https://${FLOTTBOT_TEST_HOST:-localhost}/${FLOTTBOT_TEST_UNSET:-v1}",
+					Headers: map[string]string{"X-Env": "${FLOTTBOT_TEST_EMPTY:-dev}"},
+				}},
+				Extra: map[string]interface{}{"region": "${FLOTTBOT_TEST_UNSET:-us-east-1}", "count": 3},
+			},
+			false,
+			envTestConfig{
+				Actions: []envTestAction{{
+					URL:     "https://api.example.com/v1",
+					Headers: map[string]string{"X-Env": "dev"},
+				}},
+				Extra: map[string]interface{}{"region": "us-east-1", "count": 3},
+			},
+			"",
+		},
+		{
+			"Required",
+			envTestConfig{Token: "${FLOTTBOT_TEST_TOKEN:?the Slack token}"},
+			false,
+			envTestConfig{Token: "s3cr3t"},
+			"",
+		},
+		{
+			"Missing required",
+			envTestConfig{Token: "${FLOTTBOT_TEST_UNSET:?the Slack token}", Rooms: []string{"${FLOTTBOT_TEST_EMPTY:?}"}},
+			true,
+			envTestConfig{Token: "", Rooms: []string{""}},
+			"Required environment variables are not set: FLOTTBOT_TEST_EMPTY, FLOTTBOT_TEST_UNSET (the Slack token)",
+		},
+		{
+			"Escaped",
+			envTestConfig{Token: "$${FLOTTBOT_TEST_TOKEN} $${FLOTTBOT_TEST_UNSET:?required}"},
+			true,
+			envTestConfig{Token: "$${FLOTTBOT_TEST_TOKEN} $${FLOTTBOT_TEST_UNSET:?required}"},
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ExpandEnv(&tt.config, tt.plain)
+			if (err != nil) != (len(tt.wantErr) > 0) || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("ExpandEnv() error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(tt.config, tt.want) {
+				t.Errorf("ExpandEnv() = %+v, want %+v", tt.config, tt.want)
+			}
+		})
+	}
+}
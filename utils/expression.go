@@ -0,0 +1,426 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expression is a condition parsed by ParseExpression, e.g. for a rule's or action's 'when':
+//
+//	${_user.email} endsWith '@corp.com' && ${env} != 'prod'
+//
+// It's made of variables (${name}, pipelines like ${name | lower} included), 'single' or "double"
+// quoted strings, numbers, true and false, compared with == != < <= > >= and the string operators
+// contains, startsWith, endsWith, and matches (a regular expression), combined with && || ! and
+// parentheses. The functions lower(), upper(), trim(), and len() work on values. Values compare as
+// numbers when both sides are numbers; a value on its own is false when it's empty, 'false', '0',
+// or 'no', and true otherwise.
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// exprNode is a part of a parsed expression, evaluated to a value
+type exprNode interface {
+	eval(vars map[string]string) (string, error)
+}
+
+// exprFuncs are the functions expressions can call, taking one value
+var exprFuncs = map[string]func(string) string{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"len":   func(s string) string { return strconv.Itoa(len([]rune(s))) },
+}
+
+// exprOperators are the comparison operators, by how they're written
+var exprOperators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"contains": true, "startsWith": true, "endsWith": true, "matches": true,
+}
+
+// ParseExpression parses a condition (see Expression), so that mistakes in it are found before
+// it's evaluated
+func ParseExpression(source string) (*Expression, error) {
+	tokens, err := lexExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid expression '%s': %s", source, err.Error())
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected '%s'", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid expression '%s': %s", source, err.Error())
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// EvaluateExpression parses and evaluates a condition with the given variables
+func EvaluateExpression(source string, vars map[string]string) (bool, error) {
+	expr, err := ParseExpression(source)
+	if err != nil {
+		return false, err
+	}
+	return expr.Evaluate(vars)
+}
+
+// Evaluate tells whether the expression is true for the given variables. Variables that aren't
+// defined are an error, as they are for Substitute; use ${name | default ""} for optional ones.
+func (e *Expression) Evaluate(vars map[string]string) (bool, error) {
+	value, err := e.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	return truthy(value), nil
+}
+
+// String is the expression as it was written
+func (e *Expression) String() string {
+	return e.source
+}
+
+// truthy tells whether a value is true: empty values, 'false', '0', and 'no' are false
+func truthy(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "0", "no":
+		return false
+	default:
+		return true
+	}
+}
+
+// boolValue is how expressions represent true and false
+func boolValue(b bool) string {
+	return strconv.FormatBool(b)
+}
+
+type exprTokenKind int
+
+const (
+	tokenValue    exprTokenKind = iota // a string or number literal, or true or false
+	tokenVariable                      // ${...}
+	tokenName                          // a function or a word operator, e.g. endsWith
+	tokenSymbol                        // an operator or punctuation, e.g. && or (
+)
+
+// exprToken is a token of an expression
+type exprToken struct {
+	kind exprTokenKind
+	text string
+}
+
+// lexExpression splits an expression into tokens
+func lexExpression(source string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(source[i:], "${"):
+			end := strings.Index(source[i:], "}")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed variable at '%s'", source[i:])
+			}
+			tokens = append(tokens, exprToken{tokenVariable, source[i : i+end+1]})
+			i += end + 1
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(source[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed string at '%s'", source[i:])
+			}
+			tokens = append(tokens, exprToken{tokenValue, source[i+1 : i+1+end]})
+			i += end + 2
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(source) && (source[j] == '.' || (source[j] >= '0' && source[j] <= '9')) {
+				j++
+			}
+			if _, err := strconv.ParseFloat(source[i:j], 64); err != nil {
+				return nil, fmt.Errorf("invalid number '%s'", source[i:j])
+			}
+			tokens = append(tokens, exprToken{tokenValue, source[i:j]})
+			i = j
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			j := i + 1
+			for j < len(source) && (source[j] == '_' || (source[j] >= 'a' && source[j] <= 'z') || (source[j] >= 'A' && source[j] <= 'Z') || (source[j] >= '0' && source[j] <= '9')) {
+				j++
+			}
+			word := source[i:j]
+			if word == "true" || word == "false" {
+				tokens = append(tokens, exprToken{tokenValue, word})
+			} else {
+				tokens = append(tokens, exprToken{tokenName, word})
+			}
+			i = j
+		default:
+			symbol := ""
+			for _, s := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", ","} {
+				if strings.HasPrefix(source[i:], s) {
+					symbol = s
+					break
+				}
+			}
+			if len(symbol) == 0 {
+				return nil, fmt.Errorf("unexpected '%c'", c)
+			}
+			tokens = append(tokens, exprToken{tokenSymbol, symbol})
+			i += len(symbol)
+		}
+	}
+	return tokens, nil
+}
+
+// exprParser parses the tokens of an expression, by precedence: || binds least, then &&, then !,
+// then comparisons
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// peek is the next token's text, empty at the end
+func (p *exprParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos].text
+}
+
+// expect consumes the next token, which has to be the given symbol
+func (p *exprParser) expect(symbol string) error {
+	if p.pos >= len(p.tokens) {
+		return fmt.Errorf("expected '%s' at the end", symbol)
+	}
+	if t := p.tokens[p.pos]; t.kind != tokenSymbol || t.text != symbol {
+		return fmt.Errorf("expected '%s', got '%s'", symbol, t.text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenSymbol && p.peek() == "||" {
+		p.pos++
+		var right exprNode
+		right, err = p.parseAnd()
+		left = logicalNode{op: "||", left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	for err == nil && p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenSymbol && p.peek() == "&&" {
+		p.pos++
+		var right exprNode
+		right, err = p.parseNot()
+		left = logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenSymbol && p.peek() == "!" {
+		p.pos++
+		operand, err := p.parseNot()
+		return notNode{operand}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseValue()
+	if err != nil || p.pos >= len(p.tokens) {
+		return left, err
+	}
+	t := p.tokens[p.pos]
+	if (t.kind != tokenSymbol && t.kind != tokenName) || !exprOperators[t.text] {
+		return left, nil
+	}
+	p.pos++
+	right, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	node := comparisonNode{op: t.text, left: left, right: right}
+	// Patterns written out in the expression are checked right away
+	if lit, ok := right.(literalNode); ok && t.text == "matches" {
+		if node.pattern, err = regexp.Compile(string(lit)); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %s", string(lit), err.Error())
+		}
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseValue() (exprNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case tokenValue:
+		return literalNode(t.text), nil
+	case tokenVariable:
+		return variableNode(t.text), nil
+	case tokenName:
+		fn, ok := exprFuncs[t.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown function '%s'", t.text)
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return funcNode{name: t.text, fn: fn, arg: arg}, nil
+	default:
+		if t.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expect(")")
+		}
+		return nil, fmt.Errorf("unexpected '%s'", t.text)
+	}
+}
+
+// literalNode is a string or number written out in an expression
+type literalNode string
+
+func (n literalNode) eval(vars map[string]string) (string, error) {
+	return string(n), nil
+}
+
+// variableNode is a variable, e.g. ${_user.email} or ${env | lower}. Its value is never parsed as
+// part of the expression.
+type variableNode string
+
+func (n variableNode) eval(vars map[string]string) (string, error) {
+	return Substitute(string(n), vars)
+}
+
+// funcNode is a call of one of exprFuncs
+type funcNode struct {
+	name string
+	fn   func(string) string
+	arg  exprNode
+}
+
+func (n funcNode) eval(vars map[string]string) (string, error) {
+	value, err := n.arg.eval(vars)
+	if err != nil {
+		return "", err
+	}
+	return n.fn(value), nil
+}
+
+// notNode negates a value
+type notNode struct {
+	operand exprNode
+}
+
+func (n notNode) eval(vars map[string]string) (string, error) {
+	value, err := n.operand.eval(vars)
+	if err != nil {
+		return "", err
+	}
+	return boolValue(!truthy(value)), nil
+}
+
+// logicalNode is && or ||; the right side is only evaluated when it matters
+type logicalNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n logicalNode) eval(vars map[string]string) (string, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return "", err
+	}
+	if truthy(left) == (n.op == "||") {
+		return boolValue(truthy(left)), nil
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return "", err
+	}
+	return boolValue(truthy(right)), nil
+}
+
+// comparisonNode compares two values
+type comparisonNode struct {
+	op          string
+	left, right exprNode
+	pattern     *regexp.Regexp // for 'matches' with a pattern written out in the expression
+}
+
+func (n comparisonNode) eval(vars map[string]string) (string, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return "", err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return "", err
+	}
+
+	switch n.op {
+	case "contains":
+		return boolValue(strings.Contains(left, right)), nil
+	case "startsWith":
+		return boolValue(strings.HasPrefix(left, right)), nil
+	case "endsWith":
+		return boolValue(strings.HasSuffix(left, right)), nil
+	case "matches":
+		pattern := n.pattern
+		if pattern == nil {
+			if pattern, err = regexp.Compile(right); err != nil {
+				return "", fmt.Errorf("Invalid pattern '%s': %s", right, err.Error())
+			}
+		}
+		return boolValue(pattern.MatchString(left)), nil
+	}
+
+	// Numbers compare as numbers, anything else as strings
+	var cmp int
+	l, lErr := strconv.ParseFloat(strings.TrimSpace(left), 64)
+	r, rErr := strconv.ParseFloat(strings.TrimSpace(right), 64)
+	switch {
+	case lErr == nil && rErr == nil && l < r:
+		cmp = -1
+	case lErr == nil && rErr == nil && l > r:
+		cmp = 1
+	case lErr == nil && rErr == nil:
+		cmp = 0
+	default:
+		cmp = strings.Compare(left, right)
+	}
+
+	switch n.op {
+	case "==":
+		return boolValue(cmp == 0), nil
+	case "!=":
+		return boolValue(cmp != 0), nil
+	case "<":
+		return boolValue(cmp < 0), nil
+	case "<=":
+		return boolValue(cmp <= 0), nil
+	case ">":
+		return boolValue(cmp > 0), nil
+	default:
+		return boolValue(cmp >= 0), nil
+	}
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	vars := map[string]string{
+		"_user.email": "gopher@corp.com",
+		"env":         "staging",
+		"count":       "9",
+		"empty":       "",
+		"sneaky":      "' || true || '",
+	}
+
+	tests := []struct {
+		name    string
+		expr    string
+		want    bool
+		wantErr bool
+	}{
+		{"String operators", `${_user.email} endsWith '@corp.com' && ${env} != 'prod'`, true, false},
+		{"Starts with", `${_user.email} startsWith "admin"`, false, false},
+		{"Contains", `${env} contains 'stag'`, true, false},
+		{"Matches", `${_user.email} matches '^[a-z]+@corp\.com$'`, true, false},
+		{"Numbers", `${count} > 10`, false, false},
+		{"Numbers not strings", `${count} < 10 && ${count} >= 9`, true, false},
+		{"Strings", `${env} < 'test'`, true, false},
+		{"Or", `${env} == 'prod' || ${env} == 'staging'`, true, false},
+		{"Precedence", `${env} == 'prod' && false || true`, true, false},
+		{"Parentheses", `${env} == 'prod' && (false || true)`, false, false},
+		{"Not", `!(${env} == 'prod')`, true, false},
+		{"Value on its own", `${empty}`, false, false},
+		{"Functions", `upper(${env}) == 'STAGING' && len(trim('  go  ')) == 2`, true, false},
+		{"Pipelines", `${env | upper} == 'STAGING'`, true, false},
+		{"Values aren't parsed", `${sneaky} == 'x'`, false, false},
+		{"Short circuit", `${env} == 'staging' || ${nope}`, true, false},
+		{"Undefined variable", `${nope} == 'x'`, false, true},
+		{"Default for undefined variable", `${nope | default "x"} == 'x'`, true, false},
+		{"Bad pattern", `${env} matches '('`, false, true},
+		{"Unknown function", `shout(${env})`, false, true},
+		{"Unknown operator", `${env} = 'prod'`, false, true},
+		{"Unclosed string", `${env} == 'prod`, false, true},
+		{"Unclosed parenthesis", `(${env} == 'prod'`, false, true},
+		{"Empty", ``, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EvaluateExpression(tt.expr, vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EvaluateExpression() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("EvaluateExpression() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,23 +1,26 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Match checks given value against given pattern
 func Match(pattern, value string, trimInput bool) (string, bool) {
-	re := strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
-	regx := new(regexp.Regexp)
+	return MatchCase(pattern, value, trimInput, false)
+}
 
-	if re {
-		pattern = strings.Replace(pattern, "/", "", -1)
-		regx = regexp.MustCompile("(?i)" + pattern)
-	} else {
-		regx = regexp.MustCompile(fmt.Sprintf(`(?i)^(%s$|%s[^\S])`, pattern, pattern))
+// MatchCase is like Match, but matches the case of the pattern if caseSensitive
+func MatchCase(pattern, value string, trimInput, caseSensitive bool) (string, bool) {
+	regx, err := matchRegexp(pattern, caseSensitive)
+	if err != nil {
+		return "", false
 	}
 
 	input := value
@@ -33,10 +36,92 @@ func Match(pattern, value string, trimInput bool) (string, bool) {
 	return strings.Trim(input, " "), regx.MatchString(value)
 }
 
+// MatchRegexp compiles the 'respond' or 'hear' pattern of a rule: /.../ is a regular expression,
+// anything else matches the start of a message
+func MatchRegexp(pattern string) (*regexp.Regexp, error) {
+	return matchRegexp(pattern, false)
+}
+
+// matchRegexp compiles a 'respond' or 'hear' pattern, ignoring case unless caseSensitive
+func matchRegexp(pattern string, caseSensitive bool) (*regexp.Regexp, error) {
+	flags := "(?i)"
+	if caseSensitive {
+		flags = ""
+	}
+	if strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return regexp.Compile(flags + strings.Replace(pattern, "/", "", -1))
+	}
+	return regexp.Compile(fmt.Sprintf(`%s^(%s$|%s[^\S])`, flags, pattern, pattern))
+}
+
+// SecretResolver resolves references to secrets kept in a secrets manager, e.g. 'vault:secret/data/bot#token'.
+// It is set when the bot is configured; secret references are left untouched otherwise.
+var SecretResolver func(ref string) (string, error)
+
+// secretRefPattern finds secret references embedded in a value, e.g. 'Bearer ${awssm:api/token}'
+var secretRefPattern = regexp.MustCompile(`\${((?:vault|awssm):[^}]+)}`)
+
 // Substitute checks given value for variables and looks them up to determine whether we
-// have a matching replacement available
+// have a matching replacement available. Variables can be piped through template functions
+// for formatting, e.g. ${_user.name | default "friend" | upper} (see TemplateFuncs).
 func Substitute(value string, tokens map[string]string) (string, error) {
+	// Secrets are resolved first so values of variables are never treated as secret references
+	value, err := substituteSecrets(value)
+	if err != nil {
+		return value, err
+	}
+
+	// Pipelines are evaluated separately from the text around them, so their output
+	// is never searched for variables again
 	var errs []string
+	var result strings.Builder
+	last := 0
+	for _, loc := range pipelinePattern.FindAllStringSubmatchIndex(value, -1) {
+		// $${...} is escaped
+		if loc[0] > 0 && value[loc[0]-1] == '$' {
+			continue
+		}
+		result.WriteString(substituteVars(value[last:loc[0]], tokens, &errs))
+		output, err := substitutePipeline(value[loc[2]:loc[3]], value[loc[4]:loc[5]], tokens)
+		if err != nil {
+			errs = append(errs, err.Error())
+			output = value[loc[0]:loc[1]]
+		}
+		result.WriteString(output)
+		last = loc[1]
+	}
+	result.WriteString(substituteVars(value[last:], tokens, &errs))
+	value = result.String()
+
+	// Concat any caught errors into one error message and return it with unsubstituted value
+	if len(errs) > 0 {
+		errMsg := strings.Join(errs, " ")
+		return value, errors.New(errMsg)
+	}
+	return value, nil
+}
+
+// varPattern finds variables in a value, e.g. ${_user.name}, and escaped ones, e.g. $${_user.name}
+var varPattern = regexp.MustCompile(`\$?\${([A-Za-z0-9_\-\.]+)}`)
+
+// SubstituteVars replaces the variables in a value that are set in vars, and leaves anything else as
+// it is. Unlike Substitute, it never looks up environment variables or secrets, or runs pipelines, so
+// it's safe for text anyone can write, e.g. answers taught from chat.
+func SubstituteVars(value string, vars map[string]string) string {
+	return varPattern.ReplaceAllStringFunc(value, func(hit string) string {
+		if strings.HasPrefix(hit, "$$") {
+			return hit[1:]
+		}
+		if v, ok := vars[strip(hit)]; ok {
+			return v
+		}
+		return hit
+	})
+}
+
+// substituteVars replaces the variables in a value with their values, collecting an error for each
+// variable that has not been defined
+func substituteVars(value string, tokens map[string]string, errs *[]string) string {
 	if match, hits := findVars(value); match {
 		for _, hit := range hits {
 			tok := strip(hit)
@@ -55,18 +140,56 @@ func Substitute(value string, tokens map[string]string) (string, error) {
 				value = strings.Replace(value, hit, os.Getenv(tok), -1)
 			} else {
 				err := fmt.Sprintf("Variable '%s' has not been defined.", tok)
-				errs = append(errs, err)
+				*errs = append(*errs, err)
 			}
 		}
 	}
-	// Concat any caught errors into one error message and return it with unsubstituted value
+	return value
+}
+
+// substituteSecrets replaces secret references with the secrets' values. A value can either be
+// a reference as a whole (e.g. 'vault:secret/data/bot#token') or embed references as ${vault:...}.
+func substituteSecrets(value string) (string, error) {
+	if SecretResolver == nil {
+		return value, nil
+	}
+
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "vault:") || strings.HasPrefix(trimmed, "awssm:") {
+		secret, err := SecretResolver(trimmed)
+		AddSecret(secret)
+		return secret, err
+	}
+
+	var errs []string
+	value = secretRefPattern.ReplaceAllStringFunc(value, func(hit string) string {
+		secret, err := SecretResolver(secretRefPattern.FindStringSubmatch(hit)[1])
+		if err != nil {
+			errs = append(errs, err.Error())
+			return hit
+		}
+		AddSecret(secret)
+		return secret
+	})
 	if len(errs) > 0 {
-		errMsg := strings.Join(errs, " ")
-		return value, fmt.Errorf(errMsg)
+		return value, errors.New(strings.Join(errs, " "))
 	}
 	return value, nil
 }
 
+// ParseDuration parses a duration like 30m or 2h; unlike time.ParseDuration, days (1d) work too
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %s", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
 // FindArgs goes through a string and tokenizes as parameters
 func FindArgs(stripped string) []string {
 	re := regexp.MustCompile(`["“]([^"“”]+)["”]|([^"“”\s]+)`)
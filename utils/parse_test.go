@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestMatch(t *testing.T) {
@@ -39,6 +41,13 @@ func TestMatch(t *testing.T) {
 			}
 		})
 	}
+
+	if _, hit := MatchCase(`command`, `CoMMaND arg`, true, true); hit {
+		t.Errorf("MatchCase() matched a different case")
+	}
+	if _, hit := MatchCase(`/^(COMMAND)/`, `COMMAND arg`, true, true); !hit {
+		t.Errorf("MatchCase() didn't match the same case")
+	}
 }
 
 func TestSubstitute(t *testing.T) {
@@ -76,6 +85,96 @@ func TestSubstitute(t *testing.T) {
 	}
 }
 
+func TestSubstituteVars(t *testing.T) {
+	os.Setenv("TEST_ENV_VAR", "1234")
+	defer os.Unsetenv("TEST_ENV_VAR")
+	SecretResolver = func(ref string) (string, error) { return "s3cr3t", nil }
+	defer func() { SecretResolver = nil }()
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"Var", "Ask ${_user.name} in #it", "Ask jane in #it"},
+		{"Env var", "${TEST_ENV_VAR}", "${TEST_ENV_VAR}"},
+		{"Secret", "${vault:secret/data/bot#token} vault:secret/data/bot#token", "${vault:secret/data/bot#token} vault:secret/data/bot#token"},
+		{"Pipeline", `${_user.name | upper}`, `${_user.name | upper}`},
+		{"Escaped", "$${_user.name}", "${_user.name}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SubstituteVars(tt.value, map[string]string{"_user.name": "jane"}); got != tt.want {
+				t.Errorf("SubstituteVars() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubstituteSecrets(t *testing.T) {
+	SecretResolver = func(ref string) (string, error) {
+		if ref == "vault:secret/data/bot#token" {
+			return "s3cr3t", nil
+		}
+		return "", fmt.Errorf("unknown secret %s", ref)
+	}
+	defer func() { SecretResolver = nil }()
+
+	tests := []struct {
+		name    string
+		value   string
+		tokens  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"Whole value", "vault:secret/data/bot#token", nil, "s3cr3t", false},
+		{"Embedded", "Bearer ${vault:secret/data/bot#token}", nil, "Bearer s3cr3t", false},
+		{"Embedded with var", "${user}:${vault:secret/data/bot#token}", map[string]string{"user": "bot"}, "bot:s3cr3t", false},
+		{"Unknown secret", "${vault:secret/data/nope#token}", nil, "${vault:secret/data/nope#token}", true},
+		{"Var holding a reference", "${input}", map[string]string{"input": "vault:secret/data/bot#token"}, "vault:secret/data/bot#token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Substitute(tt.value, tt.tokens)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Substitute() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Substitute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"Minutes", "30m", 30 * time.Minute, false},
+		{"Hours and minutes", " 1h30m ", 90 * time.Minute, false},
+		{"Days", "2d", 48 * time.Hour, false},
+		{"Fractional days", "0.5d", 12 * time.Hour, false},
+		{"Invalid days", "xd", 0, true},
+		{"Invalid", "soon", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDuration(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDuration() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestFindArgs(t *testing.T) {
 	type args struct {
 		stripped string
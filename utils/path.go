@@ -21,8 +21,11 @@ func PathExists(p string) (string, error) {
 		return "", errCurrPath
 	}
 
-	exPath := filepath.Dir(ex)
-	fullPath := filepath.Join(exPath, p)
+	// Relative paths are relative to the executable's directory
+	fullPath := p
+	if !filepath.IsAbs(p) {
+		fullPath = filepath.Join(filepath.Dir(ex), p)
+	}
 
 	if _, err := os.Stat(fullPath); err != nil {
 		if os.IsNotExist(err) {
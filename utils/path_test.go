@@ -35,6 +35,7 @@ func TestPathExists(t *testing.T) {
 	}{
 		{"Path exists", args{p: inputString}, wantString, false},
 		{"Path does not exist", args{p: "none"}, "", true},
+		{"Absolute path", args{p: dir}, wantString, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
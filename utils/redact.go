@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redactedMask replaces redacted values
+const redactedMask = "[REDACTED]"
+
+// minSecretLength is the shortest secret value that gets redacted, to avoid masking common words
+const minSecretLength = 6
+
+// tokenPatterns match common credentials, so they are masked even if the bot doesn't know them
+var tokenPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`xox[abposr]-[A-Za-z0-9-]{10,}`),                                              // Slack tokens
+	regexp.MustCompile(`xapp-[A-Za-z0-9-]{10,}`),                                                     // Slack app-level tokens
+	regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36,}`),                                                 // GitHub tokens
+	regexp.MustCompile(`(?:AKIA|ASIA)[0-9A-Z]{16}`),                                                  // AWS access key IDs
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`),           // JSON Web Tokens
+	regexp.MustCompile(`(?i)(bearer|basic)\s+[A-Za-z0-9._~+/=-]{16,}`),                               // Authorization headers
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), // private keys
+}
+
+var (
+	redactMu       sync.RWMutex
+	redactSecrets  = make(map[string]bool)
+	redactPatterns []*regexp.Regexp
+)
+
+// AddSecret registers a value that must never show up in logs or chat output
+func AddSecret(value string) {
+	value = strings.TrimSpace(value)
+	if len(value) < minSecretLength {
+		return
+	}
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	redactSecrets[value] = true
+}
+
+// AddRedactPattern registers a regular expression whose matches are redacted, in addition to the built-in token patterns
+func AddRedactPattern(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	redactPatterns = append(redactPatterns, re)
+	return nil
+}
+
+// Redact masks known secret values and anything that looks like a credential
+func Redact(value string) string {
+	if len(value) == 0 {
+		return value
+	}
+
+	redactMu.RLock()
+	secrets := make([]string, 0, len(redactSecrets))
+	for secret := range redactSecrets {
+		secrets = append(secrets, secret)
+	}
+	patterns := append(tokenPatterns[:len(tokenPatterns):len(tokenPatterns)], redactPatterns...)
+	redactMu.RUnlock()
+
+	// Replace longer secrets first, in case one secret contains another
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	for _, secret := range secrets {
+		value = strings.Replace(value, secret, redactedMask, -1)
+	}
+	for _, re := range patterns {
+		value = re.ReplaceAllString(value, redactedMask)
+	}
+	return value
+}
@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// pipelinePattern finds variables piped through template functions, e.g. ${_user.name | default "friend" | upper}
+var pipelinePattern = regexp.MustCompile(`\$\{\s*([A-Za-z0-9:*_\-\.\?]+)\s*\|([^}]+)\}`)
+
+// TemplateFuncs are the functions available in ${var | ...} pipelines, modeled after the
+// Sprig library. Functions take the piped value as their last argument.
+var TemplateFuncs = template.FuncMap{
+	// defaults
+	"default":  defaultValue,
+	"empty":    isEmpty,
+	"coalesce": coalesce,
+
+	// strings
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"title":      strings.Title,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"repeat":     func(count interface{}, s string) string { return strings.Repeat(s, toInt(count)) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"quote":      strconv.Quote,
+	"squote":     func(s string) string { return "'" + s + "'" },
+	"shellQuote": func(s string) string { return "'" + strings.Replace(s, "'", `'\''`, -1) + "'" },
+	"trunc":      trunc,
+	"abbrev":     abbrev,
+	"padLeft":    func(width interface{}, s string) string { return pad(toInt(width), s, true) },
+	"padRight":   func(width interface{}, s string) string { return pad(toInt(width), s, false) },
+	"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       join,
+
+	// dates
+	"now":        time.Now,
+	"date":       func(layout string, t interface{}) (string, error) { return formatDate(layout, t, "") },
+	"dateInZone": func(layout, zone string, t interface{}) (string, error) { return formatDate(layout, t, zone) },
+	"toDate":     func(layout, s string) (time.Time, error) { return time.Parse(layout, s) },
+	"unixEpoch":  func(t interface{}) (string, error) { return formatDate("", t, "") },
+
+	// encoding
+	"toJson":       toJSON,
+	"toPrettyJson": toPrettyJSON,
+	"fromJson":     fromJSON,
+	"toYaml":       toYAML,
+
+	// math, on numbers or numeric strings
+	"add":   func(a, b interface{}) float64 { return toFloat(b) + toFloat(a) },
+	"sub":   func(a, b interface{}) float64 { return toFloat(b) - toFloat(a) },
+	"mul":   func(a, b interface{}) float64 { return toFloat(b) * toFloat(a) },
+	"div":   divide,
+	"mod":   modulo,
+	"max":   func(a, b interface{}) float64 { return math.Max(toFloat(a), toFloat(b)) },
+	"min":   func(a, b interface{}) float64 { return math.Min(toFloat(a), toFloat(b)) },
+	"floor": func(a interface{}) float64 { return math.Floor(toFloat(a)) },
+	"ceil":  func(a interface{}) float64 { return math.Ceil(toFloat(a)) },
+	"round": func(a interface{}) float64 { return math.Round(toFloat(a)) },
+
+	// conversion
+	"int":      toInt,
+	"float":    toFloat,
+	"toString": func(v interface{}) string { return fmt.Sprint(v) },
+}
+
+// substitutePipeline runs a variable's value through a template pipeline. The value is handed to the
+// template as data, so it is never interpreted as template code itself.
+func substitutePipeline(name, pipeline string, tokens map[string]string) (string, error) {
+	head := "$.value"
+	value, ok := tokens[name]
+	if !ok {
+		value, ok = os.LookupEnv(name)
+	}
+	// Pipelines can also start with a function, e.g. ${now | date "15:04"}
+	if _, isFunc := TemplateFuncs[name]; !ok && isFunc {
+		head = name
+	}
+
+	t, err := template.New(name).Funcs(TemplateFuncs).Parse("{{ " + head + " |" + pipeline + " }}")
+	if err != nil {
+		return "", fmt.Errorf("Invalid pipeline for '%s': %s", name, err.Error())
+	}
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, map[string]string{"value": value}); err != nil {
+		return "", fmt.Errorf("Could not evaluate pipeline for '%s': %s", name, err.Error())
+	}
+	return buf.String(), nil
+}
+
+// isEmpty tells whether a value is its type's zero value, or a blank string
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	if s, ok := v.(string); ok {
+		return len(strings.TrimSpace(s)) == 0
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	}
+	return reflect.DeepEqual(v, reflect.Zero(rv.Type()).Interface())
+}
+
+// defaultValue returns the value, or def if the value is empty
+func defaultValue(def, v interface{}) interface{} {
+	if isEmpty(v) {
+		return def
+	}
+	return v
+}
+
+// coalesce returns the first value that is not empty
+func coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !isEmpty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// trunc shortens a string to length characters; a negative length keeps the end of the string
+func trunc(length interface{}, s string) string {
+	n := toInt(length)
+	runes := []rune(s)
+	switch {
+	case n >= 0 && len(runes) > n:
+		return string(runes[:n])
+	case n < 0 && len(runes) > -n:
+		return string(runes[len(runes)+n:])
+	}
+	return s
+}
+
+// abbrev shortens a string to width characters, ending it with an ellipsis if it was cut off
+func abbrev(width interface{}, s string) string {
+	n := toInt(width)
+	runes := []rune(s)
+	if n < 4 || len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+// pad fills a string up to width characters with spaces, on the left or on the right
+func pad(width int, s string, left bool) string {
+	padding := width - len([]rune(s))
+	if padding <= 0 {
+		return s
+	}
+	if left {
+		return strings.Repeat(" ", padding) + s
+	}
+	return s + strings.Repeat(" ", padding)
+}
+
+// join concatenates the items of a list
+func join(sep string, list interface{}) string {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fmt.Sprint(list)
+	}
+	items := make([]string, rv.Len())
+	for i := range items {
+		items[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return strings.Join(items, sep)
+}
+
+// dateLayouts are the formats dates in variables are recognized in
+var dateLayouts = []string{time.RFC3339Nano, time.RFC1123Z, time.RFC1123, "2006-01-02 15:04:05", "2006-01-02"}
+
+// toTime reads a date from a variable, given as a time, Unix timestamp (like Slack's '1554821760.000200'), or formatted date
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case int, int64, float64:
+		return unixTime(toFloat(t)), nil
+	case string:
+		if secs, err := strconv.ParseFloat(strings.TrimSpace(t), 64); err == nil {
+			return unixTime(secs), nil
+		}
+		for _, layout := range dateLayouts {
+			if parsed, err := time.Parse(layout, strings.TrimSpace(t)); err == nil {
+				return parsed, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("'%v' is not a date", v)
+}
+
+// unixTime converts fractional Unix seconds to a time
+func unixTime(secs float64) time.Time {
+	whole, frac := math.Modf(secs)
+	return time.Unix(int64(whole), int64(frac*1e9))
+}
+
+// formatDate formats a date with a Go layout, e.g. '2006-01-02 15:04', in the given time zone (or UTC).
+// Without a layout, the date is formatted as Unix seconds.
+func formatDate(layout string, v interface{}, zone string) (string, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return "", err
+	}
+	loc := time.UTC
+	if len(zone) > 0 {
+		if loc, err = time.LoadLocation(zone); err != nil {
+			return "", err
+		}
+	}
+	if len(layout) == 0 {
+		return strconv.FormatInt(t.Unix(), 10), nil
+	}
+	return t.In(loc).Format(layout), nil
+}
+
+// toJSON encodes a value as JSON
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// toPrettyJSON encodes a value as indented JSON
+func toPrettyJSON(v interface{}) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	return string(b), err
+}
+
+// fromJSON decodes a JSON string, e.g. to pick a field out of an action's raw output
+func fromJSON(s string) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
+
+// toYAML encodes a value as YAML
+func toYAML(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	return strings.TrimSuffix(string(b), "\n"), err
+}
+
+// divide divides the piped value by a; dividing by zero is an error
+func divide(a, b interface{}) (float64, error) {
+	if toFloat(a) == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return toFloat(b) / toFloat(a), nil
+}
+
+// modulo is the remainder of dividing the piped value by a
+func modulo(a, b interface{}) (int, error) {
+	if toInt(a) == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return toInt(b) % toInt(a), nil
+}
+
+// toFloat reads a number from a value, 0 if it isn't one
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f
+	}
+	f, _ := strconv.ParseFloat(fmt.Sprint(v), 64)
+	return f
+}
+
+// toInt reads a whole number from a value, dropping any decimals
+func toInt(v interface{}) int {
+	return int(toFloat(v))
+}
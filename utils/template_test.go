@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSubstitutePipelines(t *testing.T) {
+	os.Setenv("TEST_PIPELINE_ENV", "env value")
+	defer os.Unsetenv("TEST_PIPELINE_ENV")
+
+	tokens := map[string]string{
+		"name":    "gopher",
+		"empty":   "",
+		"count":   "7",
+		"ts":      "1554821760.000200",
+		"date":    "2019-04-09T14:56:00Z",
+		"json":    `{"items":[1,2]}`,
+		"sneaky":  "${TEST_PIPELINE_ENV}",
+		"list":    "a,b,c",
+		"version": "42",
+		"hostile": "x'; rm -rf /; echo '",
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"Upper", `${name | upper}`, "GOPHER", false},
+		{"Shell quote", `echo ${hostile | shellQuote}`, `echo 'x'\''; rm -rf /; echo '\'''`, false},
+		{"Chained", `hi ${empty | default "friend" | title}!`, "hi Friend!", false},
+		{"Undefined var uses default", `${nope | default "n/a"}`, "n/a", false},
+		{"Mixed with vars", `${name}: ${count | add 1}`, "gopher: 8", false},
+		{"Math", `${count | mul 3 | sub 1 | div 4}`, "5", false},
+		{"Modulo", `${count | mod 4}`, "3", false},
+		{"Division by zero", `${count | div 0}`, `${count | div 0}`, true},
+		{"Trunc", `${name | trunc 3}`, "gop", false},
+		{"Abbrev", `${name | abbrev 5}`, "go...", false},
+		{"Pad", `[${name | padLeft 8}][${name | padRight 8}]`, "[  gopher][gopher  ]", false},
+		{"Zero padding", `${version | int | printf "%05d"}`, "00042", false},
+		{"Slack timestamp", `${ts | date "2006-01-02 15:04"}`, "2019-04-09 14:56", false},
+		{"Date in zone", `${date | dateInZone "15:04 MST" "America/Chicago"}`, "09:56 CDT", false},
+		{"Unix epoch", `${date | unixEpoch}`, "1554821760", false},
+		{"Not a date", `${name | date "2006"}`, `${name | date "2006"}`, true},
+		{"Starts with a function", `${now | date "2006" | len}`, "4", false},
+		{"JSON", `${name | toJson}`, `"gopher"`, false},
+		{"From JSON", `${json | fromJson | toYaml}`, "items:\n- 1\n- 2", false},
+		{"Split and join", `${list | split "," | join " / "}`, "a / b / c", false},
+		{"Env var", `${TEST_PIPELINE_ENV | upper}`, "ENV VALUE", false},
+		{"Output is not substituted again", `${sneaky | lower}`, "${test_pipeline_env}", false},
+		{"Escaped", `$${name | upper}`, `$${name | upper}`, false},
+		{"Invalid pipeline", `${name | nosuchfunc}`, `${name | nosuchfunc}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Substitute(tt.value, tokens)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Substitute() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Substitute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}